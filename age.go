@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// defaultAgeBuckets are the limits of the -by-age buckets without
+// -age-buckets: files changed in the last week, month and six months, and
+// older ones
+const defaultAgeBuckets = "1w,1mo,6mo"
+
+// ageLimitPattern matches a limit of -age-buckets, like 30d, 2w, 6mo or 1y
+var ageLimitPattern = regexp.MustCompile(`^([1-9][0-9]*)(d|w|mo|y)$`)
+
+// ageUnits name the units of ageLimitPattern
+var ageUnits = map[string]string{"d": "day", "w": "week", "mo": "month", "y": "year"}
+
+// ageLimit is the upper bound of an age bucket, counted in calendar days,
+// months or years back from the time of the report
+type ageLimit struct {
+	Spec  string // As given, like 6mo
+	Label string // Like 6 months
+	count int
+	unit  string
+}
+
+// parseAgeBuckets parses the comma-separated limits of -age-buckets, which
+// must grow from one to the next
+func parseAgeBuckets(value string) ([]ageLimit, error) {
+	var limits []ageLimit
+	now := time.Now()
+	for _, spec := range splitList(value) {
+		match := ageLimitPattern.FindStringSubmatch(spec)
+		if match == nil {
+			return nil, fmt.Errorf("invalid age %q (expected a number of days, weeks, months or years, like 30d, 2w, 6mo or 1y)", spec)
+		}
+		count, _ := strconv.Atoi(match[1])
+		label := fmt.Sprintf("%d %s", count, ageUnits[match[2]])
+		if count > 1 {
+			label += "s"
+		}
+		limit := ageLimit{Spec: spec, Label: label, count: count, unit: match[2]}
+		if n := len(limits); n > 0 && !limit.since(now).Before(limits[n-1].since(now)) {
+			return nil, fmt.Errorf("age %s isn't longer than %s before it", spec, limits[n-1].Spec)
+		}
+		limits = append(limits, limit)
+	}
+	if len(limits) == 0 {
+		return nil, fmt.Errorf("no ages given")
+	}
+	return limits, nil
+}
+
+// since returns the earliest time a file can have changed at to be younger
+// than the limit
+func (l ageLimit) since(now time.Time) time.Time {
+	switch l.unit {
+	case "w":
+		return now.AddDate(0, 0, -7*l.count)
+	case "mo":
+		return now.AddDate(0, -l.count, 0)
+	case "y":
+		return now.AddDate(-l.count, 0, 0)
+	default:
+		return now.AddDate(0, 0, -l.count)
+	}
+}
+
+// AgeTokenInfo stores the tokens of the files last changed within an age
+// bucket
+type AgeTokenInfo struct {
+	Age        string `json:"age"`              // Like < 1 week, older than 6 months or unknown
+	Within     string `json:"within,omitempty"` // The -age-buckets limit, like 1w, for all but the last buckets
+	TokenCount int    `json:"total"`
+	Files      int    `json:"files"`
+}
+
+// AgeReport is the -by-age breakdown of a scan
+type AgeReport struct {
+	Buckets  []*AgeTokenInfo `json:"buckets"`
+	Commits  int             `json:"dated_by_commit"`   // Files dated by the last commit that changed them
+	Modified int             `json:"dated_by_modified"` // Files dated by their modification time
+}
+
+// countByAge buckets the counted files, including those below -min, by how
+// long ago they last changed: the author date of the last commit that changed
+// them, for files git tracks, since a fresh checkout gives every file the
+// same modification time, or else their modification time. Files with
+// neither, like those of a bucket or web page, are of unknown age.
+func countByAge(repo *RepoTokenInfo, options *CommandOptions) *AgeReport {
+	dir := repo.Path
+	if options.IsSingleFile {
+		dir = filepath.Dir(repo.Path)
+	}
+
+	// The dates are looked up on copies, so the report doesn't gain the
+	// fields of -with-metadata
+	dates := make(map[string]*FileTokenInfo)
+	var files []*FileTokenInfo
+	add := func(fileInfo *FileTokenInfo) {
+		dated := &FileTokenInfo{Path: fileInfo.Path, TokenCount: fileInfo.TokenCount}
+		if info, err := os.Stat(fileInfo.Path); err == nil {
+			dated.ModTime = info.ModTime()
+		}
+		dates[relativeTo(dir, fileInfo.Path)] = dated
+		files = append(files, dated)
+	}
+	for _, dirInfo := range repo.Dirs {
+		for _, fileInfo := range dirInfo.Files {
+			add(fileInfo)
+		}
+	}
+	for _, fileInfo := range repo.BelowMin {
+		add(fileInfo)
+	}
+	if err := lastCommits(dir, dates); err != nil {
+		logger.Debug("no git history for -by-age, dating files by their modification time", "path", dir, "error", err)
+	}
+
+	report := &AgeReport{}
+	now := time.Now()
+	for _, limit := range options.ageBuckets {
+		report.Buckets = append(report.Buckets, &AgeTokenInfo{Age: "< " + limit.Label, Within: limit.Spec})
+	}
+	older := &AgeTokenInfo{Age: "older than " + options.ageBuckets[len(options.ageBuckets)-1].Label}
+	unknown := &AgeTokenInfo{Age: "unknown"}
+	for _, fileInfo := range files {
+		changed := fileInfo.LastCommitTime
+		if changed.IsZero() {
+			changed = fileInfo.ModTime
+		}
+		bucket := older
+		switch {
+		case changed.IsZero():
+			bucket = unknown
+		case !fileInfo.LastCommitTime.IsZero():
+			report.Commits++
+		default:
+			report.Modified++
+		}
+		for i, limit := range options.ageBuckets {
+			if !changed.IsZero() && changed.After(limit.since(now)) {
+				bucket = report.Buckets[i]
+				break
+			}
+		}
+		bucket.TokenCount += fileInfo.TokenCount
+		bucket.Files++
+	}
+	report.Buckets = append(report.Buckets, older)
+	if unknown.Files > 0 {
+		report.Buckets = append(report.Buckets, unknown)
+	}
+	return report
+}
+
+// PrintAges prints the tokens of each age bucket, with their share of the
+// total and how the files were dated
+func PrintAges(report *AgeReport, options *CommandOptions) {
+	total := 0
+	for _, bucket := range report.Buckets {
+		total += bucket.TokenCount
+	}
+
+	fmt.Printf("Age (%s by the last change of their files):\n", options.unitName())
+	fmt.Println("----------------------------------")
+	for _, bucket := range report.Buckets {
+		fmt.Printf("%s: %s %s (%.1f%%, %s files)\n", capitalize(bucket.Age), formatCount(bucket.TokenCount), options.unitName(), percentOf(bucket.TokenCount, total), formatCount(bucket.Files))
+	}
+	fmt.Printf("Dated by the last commit of %s files and the modification time of %s\n", formatCount(report.Commits), formatCount(report.Modified))
+}
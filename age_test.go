@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAgeBuckets(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string // The labels, or the error
+	}{
+		{defaultAgeBuckets, "1 week, 1 month, 6 months"},
+		{"30d, 2y", "30 days, 2 years"},
+		{"1w,7d", "age 7d isn't longer than 1w before it"},
+		{"6mo,1mo", "age 1mo isn't longer than 6mo before it"},
+		{"3h", `invalid age "3h" (expected a number of days, weeks, months or years, like 30d, 2w, 6mo or 1y)`},
+		{"0d", `invalid age "0d"`},
+		{" , ", "no ages given"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			limits, err := parseAgeBuckets(tt.value)
+			var labels []string
+			for _, limit := range limits {
+				labels = append(labels, limit.Label)
+			}
+			got := strings.Join(labels, ", ")
+			if err != nil {
+				got = err.Error()
+			}
+			if !strings.HasPrefix(got, tt.want) {
+				t.Errorf("parseAgeBuckets = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAgeLimitSince(t *testing.T) {
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{"30d", time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)},
+		{"2w", time.Date(2026, 3, 17, 12, 0, 0, 0, time.UTC)},
+		{"1mo", time.Date(2026, 3, 3, 12, 0, 0, 0, time.UTC)}, // February 31st, normalized like time.AddDate
+		{"1y", time.Date(2025, 3, 31, 12, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		limits, err := parseAgeBuckets(tt.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := limits[0].since(now); !got.Equal(tt.want) {
+			t.Errorf("%s before %v is %v, want %v", tt.spec, now, got, tt.want)
+		}
+	}
+}
+
+func TestCountByAge(t *testing.T) {
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q")
+	writeTree(t, dir, map[string]string{"old.txt": "hello world"})
+	runGit(t, dir, "add", "old.txt")
+	t.Setenv("GIT_AUTHOR_DATE", time.Now().AddDate(-2, 0, 0).Format(time.RFC3339))
+	runGit(t, dir, "commit", "-q", "-m", "old")
+	writeTree(t, dir, map[string]string{"recent.txt": "one two three"})
+	runGit(t, dir, "add", "recent.txt")
+	t.Setenv("GIT_AUTHOR_DATE", time.Now().AddDate(0, 0, -3).Format(time.RFC3339))
+	runGit(t, dir, "commit", "-q", "-m", "recent")
+
+	// An untracked file is dated by its modification time
+	writeTree(t, dir, map[string]string{"untracked.txt": "four"})
+	modified := time.Now().AddDate(0, -2, 0)
+	if err := os.Chtimes(filepath.Join(dir, "untracked.txt"), modified, modified); err != nil {
+		t.Fatal(err)
+	}
+
+	repo, options := scanTree(t, dir, "-model", "cl100k_base", "-by-age")
+	// A file that's gone has no date
+	repo.BelowMin = append(repo.BelowMin, &FileTokenInfo{Path: filepath.Join(dir, "gone.txt"), TokenCount: 1})
+	report := countByAge(repo, options)
+	var buckets []string
+	for _, bucket := range report.Buckets {
+		buckets = append(buckets, bucket.Age+": "+formatCount(bucket.TokenCount)+" in "+formatCount(bucket.Files))
+	}
+	want := "< 1 week: 3 in 1, < 1 month: 0 in 0, < 6 months: 1 in 1, older than 6 months: 2 in 1, unknown: 1 in 1"
+	if got := strings.Join(buckets, ", "); got != want || report.Commits != 2 || report.Modified != 1 {
+		t.Errorf("buckets %s, dated by %d commits and %d modification times, want %s by 2 and 1", got, report.Commits, report.Modified, want)
+	}
+	for _, dirInfo := range repo.Dirs {
+		for _, fileInfo := range dirInfo.Files {
+			if fileInfo.LastAuthor != "" || !fileInfo.LastCommitTime.IsZero() {
+				t.Errorf("-by-age added the metadata of -with-metadata to %s", fileInfo.Path)
+			}
+		}
+	}
+
+	out := captureStdout(t, func() { PrintAges(report, options) })
+	for _, line := range []string{"Age (tokens by the last change of their files):\n", "< 1 week: 3 tokens (42.9%, 1 files)\n", "Older than 6 months: 2 tokens (28.6%, 1 files)\n", "Dated by the last commit of 2 files and the modification time of 1\n"} {
+		if !strings.Contains(out, line) {
+			t.Errorf("PrintAges printed\n%s\nwant %q", out, line)
+		}
+	}
+}
+
+func TestByAgeCommand(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world"})
+	out := captureStdout(t, func() {
+		findCommand("scan").run([]string{"-by-age", "-age-buckets", "1d,1y", "-model", "cl100k_base", dir})
+	})
+	if !strings.Contains(out, "< 1 day: 2 tokens (100.0%, 1 files)\n< 1 year: 0 tokens (0.0%, 0 files)\nOlder than 1 year: 0 tokens") {
+		t.Errorf("scan -by-age printed\n%s", out)
+	}
+	stderr, code := exitStatus(t, func() { findCommand("scan").run([]string{"-age-buckets", "1y,1mo", dir}) })
+	if code != 2 || !strings.Contains(stderr, "age 1mo isn't longer than 1y before it") {
+		t.Errorf("exit %d, stderr:\n%s", code, stderr)
+	}
+}
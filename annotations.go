@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// outputFormats are the report formats -format accepts
+var outputFormats = map[string]bool{"text": true, "tree": true, "github-annotations": true, "gh-summary": true, "html": true, "json": true, "jsonl": true, "ndjson": true, "yaml": true, "toml": true}
+
+// formatAliases are the other names -format accepts for some formats, like
+// ndjson, as newline-delimited JSON is also called, for jsonl
+var formatAliases = map[string]string{"ndjson": "jsonl"}
+
+// PrintAnnotations prints the scan as GitHub Actions workflow commands: a
+// warning on every file above -max-file-tokens, which GitHub shows on the
+// file in the pull request diff, and a notice with the total. Paths are
+// relative to the scan root, so scan the repository root for them to match.
+func PrintAnnotations(repo *RepoTokenInfo, options *CommandOptions) {
+	var large []*FileTokenInfo
+	if options.MaxFileTokens > 0 {
+		for _, dirInfo := range repo.Dirs {
+			for _, fileInfo := range dirInfo.Files {
+				if fileInfo.TokenCount > options.MaxFileTokens {
+					large = append(large, fileInfo)
+				}
+			}
+		}
+	}
+	sort.Slice(large, func(i, j int) bool {
+		return large[i].Path < large[j].Path
+	})
+
+	for _, fileInfo := range large {
+		relativePath, err := filepath.Rel(repo.Path, fileInfo.Path)
+		if err != nil || options.IsSingleFile {
+			relativePath = fileInfo.Path
+		}
+		relativePath = filepath.ToSlash(relativePath)
+		fmt.Printf("::warning file=%s,title=%s::%s\n",
+			escapeAnnotationProperty(relativePath),
+			escapeAnnotationProperty("Large file"),
+			escapeAnnotationData(fmt.Sprintf("%s is %s %s (limit %s)", relativePath, formatCount(fileInfo.TokenCount), options.unitName(), formatCount(options.MaxFileTokens))))
+	}
+
+	message := fmt.Sprintf("%s %s in %s", formatCount(repo.TokenCount), options.unitName(), repo.Path)
+	if options.MaxFileTokens > 0 {
+		message += fmt.Sprintf(", %d files above %s", len(large), formatCount(options.MaxFileTokens))
+	}
+	fmt.Printf("::notice title=%s::%s\n", escapeAnnotationProperty("Token count"), escapeAnnotationData(message))
+}
+
+// escapeAnnotationData escapes the message of a workflow command
+func escapeAnnotationData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeAnnotationProperty escapes a property value of a workflow command
+func escapeAnnotationProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
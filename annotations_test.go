@@ -0,0 +1,52 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPrintAnnotations(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"big,1.txt": strings.Repeat("word ", 20),
+		"sub/b.txt": strings.Repeat("word ", 30),
+		"small.txt": "word",
+	})
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"no limit", nil, "::notice title=Token count::53 tokens in " + dir + "\n"},
+		{"limit", []string{"-max-file-tokens", "10"},
+			"::warning file=big%2C1.txt,title=Large file::big,1.txt is 21 tokens (limit 10)\n" +
+				"::warning file=sub/b.txt,title=Large file::sub/b.txt is 31 tokens (limit 10)\n" +
+				"::notice title=Token count::53 tokens in " + dir + ", 2 files above 10\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, options := scanTree(t, dir, append([]string{"-model", "cl100k_base"}, tt.args...)...)
+			if out := captureStdout(t, func() { PrintAnnotations(repo, options) }); out != tt.want {
+				t.Errorf("annotations:\n%s\nwant:\n%s", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscapeAnnotation(t *testing.T) {
+	if got, want := escapeAnnotationData("50%\r\nof a:b,c"), "50%25%0D%0Aof a:b,c"; got != want {
+		t.Errorf("escapeAnnotationData = %q, want %q", got, want)
+	}
+	if got, want := escapeAnnotationProperty("50%\nof a:b,c"), "50%25%0Aof a%3Ab%2Cc"; got != want {
+		t.Errorf("escapeAnnotationProperty = %q, want %q", got, want)
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	dir := t.TempDir()
+	stderr, code := exitStatus(t, func() { findCommand("scan").run([]string{"-format", "sarif", dir}) })
+	if code != 1 || !strings.Contains(stderr, `Error: unknown format "sarif"`) {
+		t.Errorf("exit %d, stderr:\n%s", code, stderr)
+	}
+}
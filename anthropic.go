@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"token-counter/tokenizers"
+)
+
+// isAnthropicModel reports whether a -model name is a Claude model, counted
+// with Anthropic's token counting API
+func isAnthropicModel(name string) bool {
+	return strings.HasPrefix(name, "claude-")
+}
+
+// newAnthropicCounter returns a counter for model that asks Anthropic's
+// /v1/messages/count_tokens endpoint, authenticating with ANTHROPIC_API_KEY.
+// The endpoint counts a whole message, so the few tokens it adds around the
+// text are measured once, by counting a one-token message, and subtracted.
+func newAnthropicCounter(model string) (tokenizers.Tokenizer, error) {
+	apiKey := os.Getenv("ANTHROPIC_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("counting %s tokens needs ANTHROPIC_API_KEY", model)
+	}
+	base := os.Getenv("ANTHROPIC_BASE_URL")
+	if base == "" {
+		base = "https://api.anthropic.com"
+	}
+	endpoint := strings.TrimSuffix(base, "/") + "/v1/messages/count_tokens"
+
+	header := make(http.Header)
+	header.Set("x-api-key", apiKey)
+	header.Set("anthropic-version", "2023-06-01")
+
+	type message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	countMessage := func(text string) (int, error) {
+		request := map[string]any{"model": model, "messages": []message{{Role: "user", Content: text}}}
+		var response struct {
+			InputTokens int `json:"input_tokens"`
+		}
+		if err := postJSON(endpoint, header, request, &response); err != nil {
+			return 0, fmt.Errorf("count_tokens for %s: %w", model, err)
+		}
+		return response.InputTokens, nil
+	}
+
+	var mu sync.Mutex
+	overhead := -1
+	count := func(text string) (int, error) {
+		mu.Lock()
+		if overhead < 0 {
+			n, err := countMessage("x")
+			if err != nil {
+				mu.Unlock()
+				return 0, err
+			}
+			overhead = max(n-1, 0)
+		}
+		mu.Unlock()
+
+		n, err := countMessage(text)
+		if err != nil {
+			return 0, err
+		}
+		return max(n-overhead, 0), nil
+	}
+	return &apiCounter{model: model, count: count, cache: true}, nil
+}
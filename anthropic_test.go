@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAnthropicCounter(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/v1/messages/count_tokens" || r.Header.Get("x-api-key") != "key" || r.Header.Get("anthropic-version") == "" {
+			http.Error(w, `{"error": {"message": "wrong request"}}`, http.StatusBadRequest)
+			return
+		}
+		var request struct {
+			Model    string `json:"model"`
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Model != "claude-sonnet-4-5" || len(request.Messages) != 1 || request.Messages[0].Role != "user" {
+			http.Error(w, `{"error": {"message": "bad body"}}`, http.StatusBadRequest)
+			return
+		}
+		text := request.Messages[0].Content
+		if text == "reject" {
+			http.Error(w, `{"error": {"message": "text rejected"}}`, http.StatusBadRequest)
+			return
+		}
+		// Every message counts 5 tokens more than its text
+		json.NewEncoder(w).Encode(map[string]int{"input_tokens": len(strings.Fields(text)) + 5})
+	}))
+	defer server.Close()
+	t.Setenv("ANTHROPIC_API_KEY", "key")
+	t.Setenv("ANTHROPIC_BASE_URL", server.URL+"/")
+
+	tok, err := newAnthropicCounter("claude-sonnet-4-5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text     string
+		want     int
+		err      string
+		requests int // Requests made so far
+	}{
+		{"one two three", 3, "", 2}, // The first count measures the overhead too
+		{"one two three", 3, "", 2}, // From the cache
+		{"four five", 2, "", 3},
+		{"reject", 0, "count_tokens for claude-sonnet-4-5: 400 Bad Request: text rejected", 4},
+	}
+	for _, tt := range tests {
+		got, err := tok.Count(tt.text)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("Count(%q) error = %v, want %q", tt.text, err, tt.err)
+			}
+		} else if err != nil || got != tt.want {
+			t.Errorf("Count(%q) = %d, %v, want %d", tt.text, got, err, tt.want)
+		}
+		if requests != tt.requests {
+			t.Errorf("after Count(%q), %d requests were made, want %d", tt.text, requests, tt.requests)
+		}
+	}
+}
+
+func TestAnthropicCounterCredentials(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "")
+	if _, err := newAnthropicCounter("claude-sonnet-4-5"); err == nil || err.Error() != "counting claude-sonnet-4-5 tokens needs ANTHROPIC_API_KEY" {
+		t.Errorf("newAnthropicCounter without a key = %v", err)
+	}
+	if !isAnthropicModel("claude-opus-4-1") || isAnthropicModel("gpt-4o") {
+		t.Error("isAnthropicModel doesn't tell Claude models apart")
+	}
+}
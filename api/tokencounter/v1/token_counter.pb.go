@@ -0,0 +1,747 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: tokencounter/v1/token_counter.proto
+
+// Package tokencounter.v1 exposes the token counting engine over gRPC.
+
+package tokencounterv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type CountRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Text to count.
+	Text string `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	// Encoding to count with, e.g. cl100k_base or o200k_base. Defaults to the
+	// server's -model.
+	Model string `protobuf:"bytes,2,opt,name=model,proto3" json:"model,omitempty"`
+	// Optional identifier echoed back in the response, to match up streamed replies.
+	Id            string `protobuf:"bytes,3,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CountRequest) Reset() {
+	*x = CountRequest{}
+	mi := &file_tokencounter_v1_token_counter_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CountRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CountRequest) ProtoMessage() {}
+
+func (x *CountRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tokencounter_v1_token_counter_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CountRequest.ProtoReflect.Descriptor instead.
+func (*CountRequest) Descriptor() ([]byte, []int) {
+	return file_tokencounter_v1_token_counter_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *CountRequest) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *CountRequest) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+func (x *CountRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type CountResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Model         string                 `protobuf:"bytes,2,opt,name=model,proto3" json:"model,omitempty"`
+	Tokens        int64                  `protobuf:"varint,3,opt,name=tokens,proto3" json:"tokens,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CountResponse) Reset() {
+	*x = CountResponse{}
+	mi := &file_tokencounter_v1_token_counter_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CountResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CountResponse) ProtoMessage() {}
+
+func (x *CountResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tokencounter_v1_token_counter_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CountResponse.ProtoReflect.Descriptor instead.
+func (*CountResponse) Descriptor() ([]byte, []int) {
+	return file_tokencounter_v1_token_counter_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CountResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *CountResponse) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+func (x *CountResponse) GetTokens() int64 {
+	if x != nil {
+		return x.Tokens
+	}
+	return 0
+}
+
+type ScanRepoRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Directory to scan, relative to the server's scan root.
+	Path string `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	// Encoding to count with. Defaults to the server's -model.
+	Model string `protobuf:"bytes,2,opt,name=model,proto3" json:"model,omitempty"`
+	// Whether to respect .gitignore rules (defaults to true).
+	RespectGitignore *bool `protobuf:"varint,3,opt,name=respect_gitignore,json=respectGitignore,proto3,oneof" json:"respect_gitignore,omitempty"`
+	// Whether to include hidden files and directories.
+	IncludeHidden bool `protobuf:"varint,4,opt,name=include_hidden,json=includeHidden,proto3" json:"include_hidden,omitempty"`
+	// Minimum token count for a file to be listed; smaller files still count
+	// in the total.
+	MinTokens     int64 `protobuf:"varint,5,opt,name=min_tokens,json=minTokens,proto3" json:"min_tokens,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ScanRepoRequest) Reset() {
+	*x = ScanRepoRequest{}
+	mi := &file_tokencounter_v1_token_counter_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ScanRepoRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScanRepoRequest) ProtoMessage() {}
+
+func (x *ScanRepoRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_tokencounter_v1_token_counter_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScanRepoRequest.ProtoReflect.Descriptor instead.
+func (*ScanRepoRequest) Descriptor() ([]byte, []int) {
+	return file_tokencounter_v1_token_counter_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ScanRepoRequest) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *ScanRepoRequest) GetModel() string {
+	if x != nil {
+		return x.Model
+	}
+	return ""
+}
+
+func (x *ScanRepoRequest) GetRespectGitignore() bool {
+	if x != nil && x.RespectGitignore != nil {
+		return *x.RespectGitignore
+	}
+	return false
+}
+
+func (x *ScanRepoRequest) GetIncludeHidden() bool {
+	if x != nil {
+		return x.IncludeHidden
+	}
+	return false
+}
+
+func (x *ScanRepoRequest) GetMinTokens() int64 {
+	if x != nil {
+		return x.MinTokens
+	}
+	return 0
+}
+
+type ScanRepoResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Event:
+	//
+	//	*ScanRepoResponse_Progress
+	//	*ScanRepoResponse_Result
+	Event         isScanRepoResponse_Event `protobuf_oneof:"event"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ScanRepoResponse) Reset() {
+	*x = ScanRepoResponse{}
+	mi := &file_tokencounter_v1_token_counter_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ScanRepoResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScanRepoResponse) ProtoMessage() {}
+
+func (x *ScanRepoResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_tokencounter_v1_token_counter_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScanRepoResponse.ProtoReflect.Descriptor instead.
+func (*ScanRepoResponse) Descriptor() ([]byte, []int) {
+	return file_tokencounter_v1_token_counter_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ScanRepoResponse) GetEvent() isScanRepoResponse_Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *ScanRepoResponse) GetProgress() *ScanProgress {
+	if x != nil {
+		if x, ok := x.Event.(*ScanRepoResponse_Progress); ok {
+			return x.Progress
+		}
+	}
+	return nil
+}
+
+func (x *ScanRepoResponse) GetResult() *ScanResult {
+	if x != nil {
+		if x, ok := x.Event.(*ScanRepoResponse_Result); ok {
+			return x.Result
+		}
+	}
+	return nil
+}
+
+type isScanRepoResponse_Event interface {
+	isScanRepoResponse_Event()
+}
+
+type ScanRepoResponse_Progress struct {
+	Progress *ScanProgress `protobuf:"bytes,1,opt,name=progress,proto3,oneof"`
+}
+
+type ScanRepoResponse_Result struct {
+	Result *ScanResult `protobuf:"bytes,2,opt,name=result,proto3,oneof"`
+}
+
+func (*ScanRepoResponse_Progress) isScanRepoResponse_Event() {}
+
+func (*ScanRepoResponse_Result) isScanRepoResponse_Event() {}
+
+// ScanProgress is sent after each file is counted.
+type ScanProgress struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	File          *FileCount             `protobuf:"bytes,1,opt,name=file,proto3" json:"file,omitempty"`
+	FilesScanned  int64                  `protobuf:"varint,2,opt,name=files_scanned,json=filesScanned,proto3" json:"files_scanned,omitempty"`
+	TokensSoFar   int64                  `protobuf:"varint,3,opt,name=tokens_so_far,json=tokensSoFar,proto3" json:"tokens_so_far,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ScanProgress) Reset() {
+	*x = ScanProgress{}
+	mi := &file_tokencounter_v1_token_counter_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ScanProgress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScanProgress) ProtoMessage() {}
+
+func (x *ScanProgress) ProtoReflect() protoreflect.Message {
+	mi := &file_tokencounter_v1_token_counter_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScanProgress.ProtoReflect.Descriptor instead.
+func (*ScanProgress) Descriptor() ([]byte, []int) {
+	return file_tokencounter_v1_token_counter_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ScanProgress) GetFile() *FileCount {
+	if x != nil {
+		return x.File
+	}
+	return nil
+}
+
+func (x *ScanProgress) GetFilesScanned() int64 {
+	if x != nil {
+		return x.FilesScanned
+	}
+	return 0
+}
+
+func (x *ScanProgress) GetTokensSoFar() int64 {
+	if x != nil {
+		return x.TokensSoFar
+	}
+	return 0
+}
+
+// ScanResult is the final message of a ScanRepo stream.
+type ScanResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Path          string                 `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	TotalTokens   int64                  `protobuf:"varint,2,opt,name=total_tokens,json=totalTokens,proto3" json:"total_tokens,omitempty"`
+	Directories   []*DirectoryCount      `protobuf:"bytes,3,rep,name=directories,proto3" json:"directories,omitempty"`
+	Errors        []*FileError           `protobuf:"bytes,4,rep,name=errors,proto3" json:"errors,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ScanResult) Reset() {
+	*x = ScanResult{}
+	mi := &file_tokencounter_v1_token_counter_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ScanResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScanResult) ProtoMessage() {}
+
+func (x *ScanResult) ProtoReflect() protoreflect.Message {
+	mi := &file_tokencounter_v1_token_counter_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScanResult.ProtoReflect.Descriptor instead.
+func (*ScanResult) Descriptor() ([]byte, []int) {
+	return file_tokencounter_v1_token_counter_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ScanResult) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *ScanResult) GetTotalTokens() int64 {
+	if x != nil {
+		return x.TotalTokens
+	}
+	return 0
+}
+
+func (x *ScanResult) GetDirectories() []*DirectoryCount {
+	if x != nil {
+		return x.Directories
+	}
+	return nil
+}
+
+func (x *ScanResult) GetErrors() []*FileError {
+	if x != nil {
+		return x.Errors
+	}
+	return nil
+}
+
+type DirectoryCount struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Path          string                 `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Tokens        int64                  `protobuf:"varint,2,opt,name=tokens,proto3" json:"tokens,omitempty"`
+	Files         []*FileCount           `protobuf:"bytes,3,rep,name=files,proto3" json:"files,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DirectoryCount) Reset() {
+	*x = DirectoryCount{}
+	mi := &file_tokencounter_v1_token_counter_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DirectoryCount) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DirectoryCount) ProtoMessage() {}
+
+func (x *DirectoryCount) ProtoReflect() protoreflect.Message {
+	mi := &file_tokencounter_v1_token_counter_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DirectoryCount.ProtoReflect.Descriptor instead.
+func (*DirectoryCount) Descriptor() ([]byte, []int) {
+	return file_tokencounter_v1_token_counter_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *DirectoryCount) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *DirectoryCount) GetTokens() int64 {
+	if x != nil {
+		return x.Tokens
+	}
+	return 0
+}
+
+func (x *DirectoryCount) GetFiles() []*FileCount {
+	if x != nil {
+		return x.Files
+	}
+	return nil
+}
+
+type FileCount struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Path          string                 `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Tokens        int64                  `protobuf:"varint,2,opt,name=tokens,proto3" json:"tokens,omitempty"`
+	Bytes         int64                  `protobuf:"varint,3,opt,name=bytes,proto3" json:"bytes,omitempty"`
+	Lines         int64                  `protobuf:"varint,4,opt,name=lines,proto3" json:"lines,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileCount) Reset() {
+	*x = FileCount{}
+	mi := &file_tokencounter_v1_token_counter_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileCount) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileCount) ProtoMessage() {}
+
+func (x *FileCount) ProtoReflect() protoreflect.Message {
+	mi := &file_tokencounter_v1_token_counter_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileCount.ProtoReflect.Descriptor instead.
+func (*FileCount) Descriptor() ([]byte, []int) {
+	return file_tokencounter_v1_token_counter_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *FileCount) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *FileCount) GetTokens() int64 {
+	if x != nil {
+		return x.Tokens
+	}
+	return 0
+}
+
+func (x *FileCount) GetBytes() int64 {
+	if x != nil {
+		return x.Bytes
+	}
+	return 0
+}
+
+func (x *FileCount) GetLines() int64 {
+	if x != nil {
+		return x.Lines
+	}
+	return 0
+}
+
+type FileError struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Path          string                 `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FileError) Reset() {
+	*x = FileError{}
+	mi := &file_tokencounter_v1_token_counter_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FileError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FileError) ProtoMessage() {}
+
+func (x *FileError) ProtoReflect() protoreflect.Message {
+	mi := &file_tokencounter_v1_token_counter_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FileError.ProtoReflect.Descriptor instead.
+func (*FileError) Descriptor() ([]byte, []int) {
+	return file_tokencounter_v1_token_counter_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *FileError) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *FileError) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+var File_tokencounter_v1_token_counter_proto protoreflect.FileDescriptor
+
+const file_tokencounter_v1_token_counter_proto_rawDesc = "" +
+	"\n" +
+	"#tokencounter/v1/token_counter.proto\x12\x0ftokencounter.v1\"H\n" +
+	"\fCountRequest\x12\x12\n" +
+	"\x04text\x18\x01 \x01(\tR\x04text\x12\x14\n" +
+	"\x05model\x18\x02 \x01(\tR\x05model\x12\x0e\n" +
+	"\x02id\x18\x03 \x01(\tR\x02id\"M\n" +
+	"\rCountResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
+	"\x05model\x18\x02 \x01(\tR\x05model\x12\x16\n" +
+	"\x06tokens\x18\x03 \x01(\x03R\x06tokens\"\xc9\x01\n" +
+	"\x0fScanRepoRequest\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x14\n" +
+	"\x05model\x18\x02 \x01(\tR\x05model\x120\n" +
+	"\x11respect_gitignore\x18\x03 \x01(\bH\x00R\x10respectGitignore\x88\x01\x01\x12%\n" +
+	"\x0einclude_hidden\x18\x04 \x01(\bR\rincludeHidden\x12\x1d\n" +
+	"\n" +
+	"min_tokens\x18\x05 \x01(\x03R\tminTokensB\x14\n" +
+	"\x12_respect_gitignore\"\x8f\x01\n" +
+	"\x10ScanRepoResponse\x12;\n" +
+	"\bprogress\x18\x01 \x01(\v2\x1d.tokencounter.v1.ScanProgressH\x00R\bprogress\x125\n" +
+	"\x06result\x18\x02 \x01(\v2\x1b.tokencounter.v1.ScanResultH\x00R\x06resultB\a\n" +
+	"\x05event\"\x87\x01\n" +
+	"\fScanProgress\x12.\n" +
+	"\x04file\x18\x01 \x01(\v2\x1a.tokencounter.v1.FileCountR\x04file\x12#\n" +
+	"\rfiles_scanned\x18\x02 \x01(\x03R\ffilesScanned\x12\"\n" +
+	"\rtokens_so_far\x18\x03 \x01(\x03R\vtokensSoFar\"\xba\x01\n" +
+	"\n" +
+	"ScanResult\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12!\n" +
+	"\ftotal_tokens\x18\x02 \x01(\x03R\vtotalTokens\x12A\n" +
+	"\vdirectories\x18\x03 \x03(\v2\x1f.tokencounter.v1.DirectoryCountR\vdirectories\x122\n" +
+	"\x06errors\x18\x04 \x03(\v2\x1a.tokencounter.v1.FileErrorR\x06errors\"n\n" +
+	"\x0eDirectoryCount\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x16\n" +
+	"\x06tokens\x18\x02 \x01(\x03R\x06tokens\x120\n" +
+	"\x05files\x18\x03 \x03(\v2\x1a.tokencounter.v1.FileCountR\x05files\"c\n" +
+	"\tFileCount\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x16\n" +
+	"\x06tokens\x18\x02 \x01(\x03R\x06tokens\x12\x14\n" +
+	"\x05bytes\x18\x03 \x01(\x03R\x05bytes\x12\x14\n" +
+	"\x05lines\x18\x04 \x01(\x03R\x05lines\"9\n" +
+	"\tFileError\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage2\xfb\x01\n" +
+	"\fTokenCounter\x12F\n" +
+	"\x05Count\x12\x1d.tokencounter.v1.CountRequest\x1a\x1e.tokencounter.v1.CountResponse\x12P\n" +
+	"\vCountStream\x12\x1d.tokencounter.v1.CountRequest\x1a\x1e.tokencounter.v1.CountResponse(\x010\x01\x12Q\n" +
+	"\bScanRepo\x12 .tokencounter.v1.ScanRepoRequest\x1a!.tokencounter.v1.ScanRepoResponse0\x01B2Z0token-counter/api/tokencounter/v1;tokencounterv1b\x06proto3"
+
+var (
+	file_tokencounter_v1_token_counter_proto_rawDescOnce sync.Once
+	file_tokencounter_v1_token_counter_proto_rawDescData []byte
+)
+
+func file_tokencounter_v1_token_counter_proto_rawDescGZIP() []byte {
+	file_tokencounter_v1_token_counter_proto_rawDescOnce.Do(func() {
+		file_tokencounter_v1_token_counter_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_tokencounter_v1_token_counter_proto_rawDesc), len(file_tokencounter_v1_token_counter_proto_rawDesc)))
+	})
+	return file_tokencounter_v1_token_counter_proto_rawDescData
+}
+
+var file_tokencounter_v1_token_counter_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_tokencounter_v1_token_counter_proto_goTypes = []any{
+	(*CountRequest)(nil),     // 0: tokencounter.v1.CountRequest
+	(*CountResponse)(nil),    // 1: tokencounter.v1.CountResponse
+	(*ScanRepoRequest)(nil),  // 2: tokencounter.v1.ScanRepoRequest
+	(*ScanRepoResponse)(nil), // 3: tokencounter.v1.ScanRepoResponse
+	(*ScanProgress)(nil),     // 4: tokencounter.v1.ScanProgress
+	(*ScanResult)(nil),       // 5: tokencounter.v1.ScanResult
+	(*DirectoryCount)(nil),   // 6: tokencounter.v1.DirectoryCount
+	(*FileCount)(nil),        // 7: tokencounter.v1.FileCount
+	(*FileError)(nil),        // 8: tokencounter.v1.FileError
+}
+var file_tokencounter_v1_token_counter_proto_depIdxs = []int32{
+	4, // 0: tokencounter.v1.ScanRepoResponse.progress:type_name -> tokencounter.v1.ScanProgress
+	5, // 1: tokencounter.v1.ScanRepoResponse.result:type_name -> tokencounter.v1.ScanResult
+	7, // 2: tokencounter.v1.ScanProgress.file:type_name -> tokencounter.v1.FileCount
+	6, // 3: tokencounter.v1.ScanResult.directories:type_name -> tokencounter.v1.DirectoryCount
+	8, // 4: tokencounter.v1.ScanResult.errors:type_name -> tokencounter.v1.FileError
+	7, // 5: tokencounter.v1.DirectoryCount.files:type_name -> tokencounter.v1.FileCount
+	0, // 6: tokencounter.v1.TokenCounter.Count:input_type -> tokencounter.v1.CountRequest
+	0, // 7: tokencounter.v1.TokenCounter.CountStream:input_type -> tokencounter.v1.CountRequest
+	2, // 8: tokencounter.v1.TokenCounter.ScanRepo:input_type -> tokencounter.v1.ScanRepoRequest
+	1, // 9: tokencounter.v1.TokenCounter.Count:output_type -> tokencounter.v1.CountResponse
+	1, // 10: tokencounter.v1.TokenCounter.CountStream:output_type -> tokencounter.v1.CountResponse
+	3, // 11: tokencounter.v1.TokenCounter.ScanRepo:output_type -> tokencounter.v1.ScanRepoResponse
+	9, // [9:12] is the sub-list for method output_type
+	6, // [6:9] is the sub-list for method input_type
+	6, // [6:6] is the sub-list for extension type_name
+	6, // [6:6] is the sub-list for extension extendee
+	0, // [0:6] is the sub-list for field type_name
+}
+
+func init() { file_tokencounter_v1_token_counter_proto_init() }
+func file_tokencounter_v1_token_counter_proto_init() {
+	if File_tokencounter_v1_token_counter_proto != nil {
+		return
+	}
+	file_tokencounter_v1_token_counter_proto_msgTypes[2].OneofWrappers = []any{}
+	file_tokencounter_v1_token_counter_proto_msgTypes[3].OneofWrappers = []any{
+		(*ScanRepoResponse_Progress)(nil),
+		(*ScanRepoResponse_Result)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_tokencounter_v1_token_counter_proto_rawDesc), len(file_tokencounter_v1_token_counter_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   9,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_tokencounter_v1_token_counter_proto_goTypes,
+		DependencyIndexes: file_tokencounter_v1_token_counter_proto_depIdxs,
+		MessageInfos:      file_tokencounter_v1_token_counter_proto_msgTypes,
+	}.Build()
+	File_tokencounter_v1_token_counter_proto = out.File
+	file_tokencounter_v1_token_counter_proto_goTypes = nil
+	file_tokencounter_v1_token_counter_proto_depIdxs = nil
+}
@@ -0,0 +1,211 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: tokencounter/v1/token_counter.proto
+
+// Package tokencounter.v1 exposes the token counting engine over gRPC.
+
+package tokencounterv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	TokenCounter_Count_FullMethodName       = "/tokencounter.v1.TokenCounter/Count"
+	TokenCounter_CountStream_FullMethodName = "/tokencounter.v1.TokenCounter/CountStream"
+	TokenCounter_ScanRepo_FullMethodName    = "/tokencounter.v1.TokenCounter/ScanRepo"
+)
+
+// TokenCounterClient is the client API for TokenCounter service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// TokenCounter counts tokens in text and in directories on the server.
+type TokenCounterClient interface {
+	// Count counts the tokens in a single piece of text.
+	Count(ctx context.Context, in *CountRequest, opts ...grpc.CallOption) (*CountResponse, error)
+	// CountStream counts every request sent on the stream and answers each one
+	// in order, keeping the connection and tokenizer warm between requests.
+	CountStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[CountRequest, CountResponse], error)
+	// ScanRepo scans a directory on the server, streaming a progress update for
+	// every file counted and finishing with the complete result.
+	ScanRepo(ctx context.Context, in *ScanRepoRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ScanRepoResponse], error)
+}
+
+type tokenCounterClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTokenCounterClient(cc grpc.ClientConnInterface) TokenCounterClient {
+	return &tokenCounterClient{cc}
+}
+
+func (c *tokenCounterClient) Count(ctx context.Context, in *CountRequest, opts ...grpc.CallOption) (*CountResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CountResponse)
+	err := c.cc.Invoke(ctx, TokenCounter_Count_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tokenCounterClient) CountStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[CountRequest, CountResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TokenCounter_ServiceDesc.Streams[0], TokenCounter_CountStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[CountRequest, CountResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TokenCounter_CountStreamClient = grpc.BidiStreamingClient[CountRequest, CountResponse]
+
+func (c *tokenCounterClient) ScanRepo(ctx context.Context, in *ScanRepoRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ScanRepoResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &TokenCounter_ServiceDesc.Streams[1], TokenCounter_ScanRepo_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ScanRepoRequest, ScanRepoResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TokenCounter_ScanRepoClient = grpc.ServerStreamingClient[ScanRepoResponse]
+
+// TokenCounterServer is the server API for TokenCounter service.
+// All implementations must embed UnimplementedTokenCounterServer
+// for forward compatibility.
+//
+// TokenCounter counts tokens in text and in directories on the server.
+type TokenCounterServer interface {
+	// Count counts the tokens in a single piece of text.
+	Count(context.Context, *CountRequest) (*CountResponse, error)
+	// CountStream counts every request sent on the stream and answers each one
+	// in order, keeping the connection and tokenizer warm between requests.
+	CountStream(grpc.BidiStreamingServer[CountRequest, CountResponse]) error
+	// ScanRepo scans a directory on the server, streaming a progress update for
+	// every file counted and finishing with the complete result.
+	ScanRepo(*ScanRepoRequest, grpc.ServerStreamingServer[ScanRepoResponse]) error
+	mustEmbedUnimplementedTokenCounterServer()
+}
+
+// UnimplementedTokenCounterServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedTokenCounterServer struct{}
+
+func (UnimplementedTokenCounterServer) Count(context.Context, *CountRequest) (*CountResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Count not implemented")
+}
+func (UnimplementedTokenCounterServer) CountStream(grpc.BidiStreamingServer[CountRequest, CountResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method CountStream not implemented")
+}
+func (UnimplementedTokenCounterServer) ScanRepo(*ScanRepoRequest, grpc.ServerStreamingServer[ScanRepoResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method ScanRepo not implemented")
+}
+func (UnimplementedTokenCounterServer) mustEmbedUnimplementedTokenCounterServer() {}
+func (UnimplementedTokenCounterServer) testEmbeddedByValue()                      {}
+
+// UnsafeTokenCounterServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TokenCounterServer will
+// result in compilation errors.
+type UnsafeTokenCounterServer interface {
+	mustEmbedUnimplementedTokenCounterServer()
+}
+
+func RegisterTokenCounterServer(s grpc.ServiceRegistrar, srv TokenCounterServer) {
+	// If the following call pancis, it indicates UnimplementedTokenCounterServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&TokenCounter_ServiceDesc, srv)
+}
+
+func _TokenCounter_Count_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TokenCounterServer).Count(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TokenCounter_Count_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TokenCounterServer).Count(ctx, req.(*CountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TokenCounter_CountStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(TokenCounterServer).CountStream(&grpc.GenericServerStream[CountRequest, CountResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TokenCounter_CountStreamServer = grpc.BidiStreamingServer[CountRequest, CountResponse]
+
+func _TokenCounter_ScanRepo_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ScanRepoRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(TokenCounterServer).ScanRepo(m, &grpc.GenericServerStream[ScanRepoRequest, ScanRepoResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type TokenCounter_ScanRepoServer = grpc.ServerStreamingServer[ScanRepoResponse]
+
+// TokenCounter_ServiceDesc is the grpc.ServiceDesc for TokenCounter service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TokenCounter_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "tokencounter.v1.TokenCounter",
+	HandlerType: (*TokenCounterServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Count",
+			Handler:    _TokenCounter_Count_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "CountStream",
+			Handler:       _TokenCounter_CountStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "ScanRepo",
+			Handler:       _TokenCounter_ScanRepo_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "tokencounter/v1/token_counter.proto",
+}
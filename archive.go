@@ -0,0 +1,195 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	pathpkg "path"
+	"path/filepath"
+	"strings"
+)
+
+// maxArchiveEntrySize is the largest archive entry read into memory; bigger
+// entries are reported as errors rather than risking a decompression bomb
+const maxArchiveEntrySize = 64 << 20
+
+// archiveKind returns the kind of archive path is by its name: zip, tar,
+// tar.gz or gz (a single gzip-compressed file), or "" if it's not one
+func archiveKind(path string) string {
+	name := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return "zip"
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(name, ".tar"):
+		return "tar"
+	case strings.HasSuffix(name, ".gz"):
+		return "gz"
+	}
+	return ""
+}
+
+// archiveEntry is a regular file read from an archive
+type archiveEntry struct {
+	Name string
+	Info os.FileInfo
+	Data []byte
+}
+
+// readArchive reads the regular files of an archive into memory, calling fn
+// for each of them. Entries larger than maxArchiveEntrySize are passed with
+// a nil Data and an error.
+func readArchive(path string, fn func(entry *archiveEntry, err error)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	switch archiveKind(path) {
+	case "zip":
+		stat, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		reader, err := zip.NewReader(file, stat.Size())
+		if err != nil {
+			return err
+		}
+		for _, f := range reader.File {
+			if !f.Mode().IsRegular() {
+				continue
+			}
+			if f.UncompressedSize64 > maxArchiveEntrySize {
+				fn(&archiveEntry{Name: f.Name, Info: f.FileInfo()}, fmt.Errorf("entry is larger than %d MB", maxArchiveEntrySize>>20))
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				fn(&archiveEntry{Name: f.Name, Info: f.FileInfo()}, err)
+				continue
+			}
+			data, err := readLimited(rc)
+			rc.Close()
+			fn(&archiveEntry{f.Name, f.FileInfo(), data}, err)
+		}
+		return nil
+
+	case "tar", "tar.gz":
+		var r io.Reader = file
+		if archiveKind(path) == "tar.gz" {
+			gz, err := gzip.NewReader(file)
+			if err != nil {
+				return err
+			}
+			defer gz.Close()
+			r = gz
+		}
+		reader := tar.NewReader(r)
+		for {
+			header, err := reader.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if header.Typeflag != tar.TypeReg {
+				continue
+			}
+			data, err := readLimited(reader)
+			fn(&archiveEntry{header.Name, header.FileInfo(), data}, err)
+		}
+
+	case "gz":
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		stat, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		// A plain .gz holds a single file named like the archive without .gz
+		name := gz.Name
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		data, err := readLimited(gz)
+		fn(&archiveEntry{name, stat, data}, err)
+		return nil
+	}
+	return fmt.Errorf("unsupported archive")
+}
+
+// readLimited reads r up to maxArchiveEntrySize
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxArchiveEntrySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxArchiveEntrySize {
+		return nil, fmt.Errorf("entry is larger than %d MB", maxArchiveEntrySize>>20)
+	}
+	return data, nil
+}
+
+// countArchive counts the text entries of an archive. Entries are reported
+// under the archive's path, so the archive shows up as a directory with its
+// own subdirectories. The same hidden and extension rules as on disk apply,
+// and binary entries are skipped.
+func countArchive(path string, encs []namedCodec, options *CommandOptions) ([]*FileTokenInfo, []*FileError, error) {
+	var files []*FileTokenInfo
+	var errs []*FileError
+
+	err := readArchive(path, func(entry *archiveEntry, err error) {
+		// Clean the name as if it were absolute, so it can't escape the archive
+		name := strings.TrimPrefix(pathpkg.Clean("/"+filepath.ToSlash(entry.Name)), "/")
+		virtualPath := filepath.Join(path, filepath.FromSlash(name))
+
+		if options.IgnoreHidden {
+			for _, part := range strings.Split(name, "/") {
+				if strings.HasPrefix(part, ".") {
+					logSkip(options, virtualPath, false, "hidden", "")
+					return
+				}
+			}
+		}
+		ext := strings.ToLower(filepath.Ext(virtualPath))
+		if options.skipsExtension(ext) {
+			logSkip(options, virtualPath, false, "extension", "unsupported file type")
+			return
+		}
+		if options.tooLarge(entry.Info) {
+			logSkip(options, virtualPath, false, "size", fmt.Sprintf("%d bytes is above -max-file-bytes", entry.Info.Size()))
+			return
+		}
+		if err != nil {
+			errs = append(errs, &FileError{virtualPath, err})
+			return
+		}
+		if mimeType, binary := sniffType(entry.Data); binary && !options.countsAsText(ext) {
+			logSkip(options, virtualPath, false, "binary", binaryReason(mimeType))
+			return
+		}
+		if options.ExcludeGenerated {
+			if reason := generatedReason(virtualPath, entry.Data); reason != "" {
+				logSkip(options, virtualPath, false, "generated", reason)
+				return
+			}
+		}
+
+		fileInfo, err := countData(virtualPath, entry.Data, encs, options)
+		if err != nil {
+			errs = append(errs, &FileError{virtualPath, err})
+			return
+		}
+		files = append(files, fileInfo)
+	})
+	return files, errs, err
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// zipArchive returns a zip of the files, by name
+func zipArchive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, contents := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(contents))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// gzipped returns data compressed with gzip
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	gw.Write(data)
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestArchiveKind(t *testing.T) {
+	for path, want := range map[string]string{
+		"a.zip": "zip", "A.ZIP": "zip", "a.tar": "tar", "a.tar.gz": "tar.gz",
+		"a.tgz": "tar.gz", "notes.txt.gz": "gz", "a.txt": "", "zip": "",
+	} {
+		if got := archiveKind(path); got != want {
+			t.Errorf("archiveKind(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestScanArchives(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"src.zip":      string(zipArchive(t, map[string]string{"a.txt": "hello world", "lib/b.go": "package lib", ".env": "hidden", "logo.png": "binary"})),
+		"docs.tar.gz":  string(gzipped(t, tarball(t, map[string]string{"docs/c.md": "one two three"}).Bytes())),
+		"notes.txt.gz": string(gzipped(t, []byte("x"))),
+		"plain.txt":    "y",
+	})
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"skipped", nil, []string{"plain.txt"}},
+		{"counted", []string{"-archives"}, []string{"docs.tar.gz/docs/c.md", "notes.txt.gz/notes.txt", "plain.txt", "src.zip/a.txt", "src.zip/lib/b.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, _ := scanTree(t, dir, append([]string{"-model", "cl100k_base"}, tt.args...)...)
+			if got := countedPaths(dir, repo); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("counted %v, want %v", got, tt.want)
+			}
+			if len(repo.Errors) != 0 {
+				t.Errorf("errors %v", repo.Errors)
+			}
+		})
+	}
+}
+
+func TestScanBrokenArchive(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"broken.zip": "not a zip", "a.txt": "hello"})
+	repo, _ := scanTree(t, dir, "-model", "cl100k_base", "-archives")
+	if got := countedPaths(dir, repo); !reflect.DeepEqual(got, []string{"a.txt"}) {
+		t.Errorf("counted %v, want only a.txt", got)
+	}
+	if len(repo.Errors) != 1 || repo.Errors[0].Path != filepath.Join(dir, "broken.zip") {
+		t.Errorf("errors %v, want one for broken.zip", repo.Errors)
+	}
+
+	if _, err := readLimited(bytes.NewReader(make([]byte, maxArchiveEntrySize+1))); err == nil {
+		t.Error("readLimited of an entry above the limit succeeded")
+	}
+	if err := readArchive(filepath.Join(dir, "missing.zip"), func(*archiveEntry, error) {}); !os.IsNotExist(err) {
+		t.Errorf("readArchive of a missing file = %v", err)
+	}
+}
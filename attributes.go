@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+)
+
+// gitAttributesFile is the per-directory file git reads path attributes from
+const gitAttributesFile = ".gitattributes"
+
+// skippableAttributes are the attributes -skip-attributes can skip the paths
+// of: those git archive leaves out, and those GitHub leaves out of a
+// repository's language statistics
+var skippableAttributes = []string{"export-ignore", "linguist-vendored", "linguist-generated"}
+
+// parseSkipAttributes parses the comma-separated attributes of
+// -skip-attributes, where all stands for every one of them
+func parseSkipAttributes(value string) ([]string, error) {
+	var attrs []string
+	for _, attr := range splitList(value) {
+		switch {
+		case attr == "all":
+			attrs = append(attrs, skippableAttributes...)
+		case slices.Contains(skippableAttributes, attr):
+			attrs = append(attrs, attr)
+		default:
+			return nil, fmt.Errorf("unknown attribute %q (expected %s or all)", attr, strings.Join(skippableAttributes, ", "))
+		}
+	}
+	return attrs, nil
+}
+
+// attributeRule is a line of a .gitattributes file
+type attributeRule struct {
+	pattern *gitignore.GitIgnore
+	line    int
+	text    string
+	attrs   map[string]bool // Whether each attribute the line names is set by it, rather than unset or unspecified
+}
+
+// attributeFile is the rules of a .gitattributes file, in file order
+type attributeFile struct {
+	path  string
+	rules []*attributeRule
+}
+
+// parseAttributeFile reads the .gitattributes file at path, or returns nil if
+// there isn't one. Only the attributes in attrs are kept. An attribute is set
+// by attr or attr=value, except attr=false, and unset by -attr; !attr makes
+// it unspecified again. Negative patterns aren't allowed, as in git.
+func parseAttributeFile(path string, attrs []string) (*attributeFile, *FileError) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, &FileError{path, err}
+	}
+
+	file := &attributeFile{path: path}
+	for i, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "!") {
+			continue
+		}
+		rule := &attributeRule{line: i + 1, text: strings.Join(fields, " "), attrs: make(map[string]bool)}
+		for _, field := range fields[1:] {
+			name, value, hasValue := strings.Cut(field, "=")
+			set := !hasValue || value != "false"
+			if trimmed, ok := strings.CutPrefix(name, "-"); ok {
+				name, set = trimmed, false
+			} else if trimmed, ok := strings.CutPrefix(name, "!"); ok {
+				name, set = trimmed, false
+			}
+			if slices.Contains(attrs, name) {
+				rule.attrs[name] = set
+			}
+		}
+		if len(rule.attrs) > 0 {
+			rule.pattern = gitignore.CompileIgnoreLines(fields[0])
+			file.rules = append(file.rules, rule)
+		}
+	}
+	return file, nil
+}
+
+// gitAttributes holds the .gitattributes files found during a scan, keyed by
+// the directory they were loaded from, and the repository's
+// .git/info/attributes, for -skip-attributes
+type gitAttributes struct {
+	attrs []string // The attributes whose paths are skipped
+	dirs  map[string]*attributeFile
+	info  *attributeFile
+}
+
+// newGitAttributes starts collecting the attributes of a scan of rootPath,
+// reading its .git/info/attributes. It returns nil without attrs.
+func newGitAttributes(rootPath string, attrs []string) (*gitAttributes, *FileError) {
+	if len(attrs) == 0 {
+		return nil, nil
+	}
+	a := &gitAttributes{attrs: attrs, dirs: make(map[string]*attributeFile)}
+	info, err := parseAttributeFile(filepath.Join(gitDir(rootPath), "info", "attributes"), attrs)
+	a.info = info
+	return a, err
+}
+
+// load reads the .gitattributes file in dir, if there is one
+func (a *gitAttributes) load(dir string) *FileError {
+	if a == nil {
+		return nil
+	}
+	dir = filepath.Clean(dir)
+	if _, ok := a.dirs[dir]; ok {
+		return nil
+	}
+	file, err := parseAttributeFile(filepath.Join(dir, gitAttributesFile), a.attrs)
+	if file != nil {
+		a.dirs[dir] = file
+	}
+	return err
+}
+
+// rule returns the .gitattributes line that marks path with one of the
+// skipped attributes, like vendor/.gitattributes:3: *.min.js
+// linguist-generated, or an empty string if none does. As in git, the
+// .gitattributes of a deeper directory take precedence over those above it,
+// later lines over earlier ones, and .git/info/attributes over them all.
+// Patterns are matched as in .gitignore files, so a pattern that marks a
+// directory marks everything under it.
+func (a *gitAttributes) rule(rootPath string, path string) string {
+	rootPath = filepath.Clean(rootPath)
+	if a == nil || filepath.Clean(path) == rootPath {
+		return ""
+	}
+
+	// The files from lowest to highest precedence, each with the directory
+	// its patterns are relative to
+	type source struct {
+		dir  string
+		file *attributeFile
+	}
+	var sources []source
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if file, ok := a.dirs[dir]; ok {
+			sources = append([]source{{dir, file}}, sources...)
+		}
+		if dir == rootPath || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	if a.info != nil {
+		sources = append(sources, source{rootPath, a.info})
+	}
+
+	set := make(map[string]string) // The line that decided each attribute, if it set it
+	for _, src := range sources {
+		relPath, err := matchPath(src.dir, path)
+		if err != nil {
+			continue
+		}
+		for _, rule := range src.file.rules {
+			if !rule.pattern.MatchesPath(relPath) {
+				continue
+			}
+			for attr, isSet := range rule.attrs {
+				if isSet {
+					set[attr] = fmt.Sprintf("%s:%d: %s", relativeTo(rootPath, src.file.path), rule.line, rule.text)
+				} else {
+					delete(set, attr)
+				}
+			}
+		}
+	}
+	for _, attr := range a.attrs {
+		if line, ok := set[attr]; ok {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseSkipAttributes(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr string
+	}{
+		{"linguist-generated", []string{"linguist-generated"}, ""},
+		{"export-ignore, linguist-vendored", []string{"export-ignore", "linguist-vendored"}, ""},
+		{"all", skippableAttributes, ""},
+		{"binary", nil, `unknown attribute "binary" (expected export-ignore, linguist-vendored, linguist-generated or all)`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseSkipAttributes(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("parseSkipAttributes error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || !slices.Equal(got, tt.want) {
+				t.Errorf("parseSkipAttributes = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSkipAttributes(t *testing.T) {
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q")
+	writeTree(t, dir, map[string]string{
+		".gitattributes":        "# comments are skipped\n*.pb.go linguist-generated\ndocs/ export-ignore\nkeep.pb.go -linguist-generated\n",
+		"main.go":               "hello world",
+		"api.pb.go":             "one two three",
+		"keep.pb.go":            "four",
+		"docs/a.md":             "hello",
+		"vendor/.gitattributes": "lib.js linguist-vendored\n",
+		"vendor/lib.js":         "hello",
+		"vendor/other.js":       "four",
+		".git/info/attributes":  "main.go linguist-vendored\n",
+	})
+	tests := []struct {
+		name    string
+		value   string
+		counted []string
+		skipped map[string]string
+	}{
+		{"generated", "linguist-generated", []string{"docs/a.md", "keep.pb.go", "main.go", "vendor/lib.js", "vendor/other.js"},
+			map[string]string{"api.pb.go": ".gitattributes:2: *.pb.go linguist-generated"}},
+		{"nested file", "linguist-vendored", []string{"api.pb.go", "docs/a.md", "keep.pb.go", "vendor/other.js"},
+			map[string]string{"vendor/lib.js": "vendor/.gitattributes:1: lib.js linguist-vendored", "main.go": ".git/info/attributes:1: main.go linguist-vendored"}},
+		{"directory", "export-ignore", []string{"api.pb.go", "keep.pb.go", "main.go", "vendor/lib.js", "vendor/other.js"},
+			map[string]string{"docs/a.md": ".gitattributes:3: docs/ export-ignore"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := testOptions(t, "-model", "cl100k_base", "-skip-attributes", tt.value)
+			skipped := make(map[string]string)
+			options.OnSkip = func(s *SkippedFile) {
+				if s.Reason == "gitattributes" {
+					skipped[s.Path] = s.Detail
+				}
+			}
+			repo, err := ProcessRepository(t.Context(), dir, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := countedPaths(dir, repo); !slices.Equal(got, tt.counted) {
+				t.Errorf("counted %v, want %v", got, tt.counted)
+			}
+			for path, rule := range tt.skipped {
+				if skipped[filepath.Join(dir, path)] != rule {
+					t.Errorf("skipped %v, want %s by %q", skipped, path, rule)
+				}
+			}
+		})
+	}
+}
+
+func TestParseAttributeFile(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{".gitattributes": "*.go text\n!*.md linguist-generated\n*.js -linguist-generated linguist-vendored\n"})
+	file, err := parseAttributeFile(filepath.Join(dir, ".gitattributes"), skippableAttributes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Lines without a skippable attribute and negative patterns are left out
+	if len(file.rules) != 1 || file.rules[0].line != 3 || file.rules[0].attrs["linguist-generated"] || !file.rules[0].attrs["linguist-vendored"] {
+		t.Errorf("rules %+v", file.rules)
+	}
+	if file, err := parseAttributeFile(filepath.Join(dir, "missing"), skippableAttributes); file != nil || err != nil {
+		t.Errorf("missing file parsed as %+v, %v", file, err)
+	}
+	if _, err := parseAttributeFile(dir, skippableAttributes); err == nil || err.Path != dir {
+		t.Errorf("reading a directory returned %v", err)
+	}
+}
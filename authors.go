@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// AuthorTokenInfo stores how much of the counted code git blame attributes
+// to one author
+type AuthorTokenInfo struct {
+	Author     string `json:"author"`
+	TokenCount int    `json:"total"`
+	Lines      int    `json:"lines"`
+	Files      int    `json:"files"`
+}
+
+// blameRange is a run of consecutive lines last changed by the same author
+type blameRange struct {
+	Author string
+	Lines  []string
+}
+
+// blameFile runs git blame on path and groups its lines into ranges by author.
+// Uncommitted lines are attributed to git's "Not Committed Yet".
+func blameFile(path string) ([]blameRange, error) {
+	cmd := exec.Command("git", "blame", "--line-porcelain", "--", filepath.Base(path))
+	cmd.Dir = filepath.Dir(path)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git blame: %s", msg)
+		}
+		return nil, fmt.Errorf("git blame: %v", err)
+	}
+
+	var ranges []blameRange
+	author := ""
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "author "):
+			author = strings.TrimPrefix(line, "author ")
+		case strings.HasPrefix(line, "\t"):
+			// The line's content follows its headers, prefixed with a tab
+			content := line[1:]
+			if n := len(ranges); n > 0 && ranges[n-1].Author == author {
+				ranges[n-1].Lines = append(ranges[n-1].Lines, content)
+			} else {
+				ranges = append(ranges, blameRange{author, []string{content}})
+			}
+		}
+	}
+	return ranges, scanner.Err()
+}
+
+// countByAuthor blames every counted file and tokenizes each author's line
+// ranges, returning the authors sorted by token count. Files git can't blame
+// (untracked, or outside a repository) are returned as errors.
+func countByAuthor(repo *RepoTokenInfo, options *CommandOptions) ([]*AuthorTokenInfo, []*FileError, error) {
+	encs, err := newCodecs(options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	authors := make(map[string]*AuthorTokenInfo)
+	var errs []*FileError
+	for _, dirInfo := range repo.Dirs {
+		for _, fileInfo := range dirInfo.Files {
+			ranges, err := blameFile(fileInfo.Path)
+			if err != nil {
+				errs = append(errs, &FileError{fileInfo.Path, err})
+				continue
+			}
+
+			seen := make(map[string]bool)
+			for _, r := range ranges {
+				count, err := countUnits(strings.Join(r.Lines, "\n"), encs[0], options.CountMode)
+				if err != nil {
+					errs = append(errs, &FileError{fileInfo.Path, err})
+					break
+				}
+
+				author, ok := authors[r.Author]
+				if !ok {
+					author = &AuthorTokenInfo{Author: r.Author}
+					authors[r.Author] = author
+				}
+				author.TokenCount += count
+				author.Lines += len(r.Lines)
+				if !seen[r.Author] {
+					seen[r.Author] = true
+					author.Files++
+				}
+			}
+		}
+	}
+
+	var sorted []*AuthorTokenInfo
+	for _, author := range authors {
+		sorted = append(sorted, author)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].TokenCount != sorted[j].TokenCount {
+			return sorted[i].TokenCount > sorted[j].TokenCount
+		}
+		return sorted[i].Author < sorted[j].Author
+	})
+	return sorted, errs, nil
+}
+
+// PrintAuthors prints each author's share of the blamed tokens
+func PrintAuthors(authors []*AuthorTokenInfo, options *CommandOptions) {
+	total := 0
+	for _, author := range authors {
+		total += author.TokenCount
+	}
+
+	fmt.Printf("Authors (%s by git blame):\n", options.unitName())
+	fmt.Println("----------------------------------")
+	for _, author := range authors {
+		pct := 0.0
+		if total > 0 {
+			pct = float64(author.TokenCount) * 100 / float64(total)
+		}
+		fmt.Printf("%s: %d %s (%.1f%%, %d lines in %d files)\n", author.Author, author.TokenCount, options.unitName(), pct, author.Lines, author.Files)
+	}
+	if len(authors) == 0 {
+		fmt.Println("No files could be blamed")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCountByAuthor(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world\n"})
+	runGit(t, dir, "init", "-q")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-qm", "first")
+	writeTree(t, dir, map[string]string{"a.txt": "hello world\none two three\n", "b.txt": "x\n"})
+	runGit(t, dir, "add", "a.txt", "b.txt")
+	runGit(t, dir, "-c", "user.name=Other", "commit", "-qm", "second")
+	writeTree(t, dir, map[string]string{"untracked.txt": "y\n"})
+
+	repo, options := scanTree(t, dir, "-model", "cl100k_base")
+	authors, errs, err := countByAuthor(repo, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(authors) != 2 {
+		t.Fatalf("authors = %+v, want Other and Test", authors)
+	}
+	// "one two three" and "x" to Other, "hello world" to Test
+	if a := authors[0]; a.Author != "Other" || a.TokenCount != 4 || a.Lines != 2 || a.Files != 2 {
+		t.Errorf("first author = %+v, want Other with 4 tokens in 2 lines of 2 files", a)
+	}
+	if a := authors[1]; a.Author != "Test" || a.TokenCount != 2 || a.Lines != 1 || a.Files != 1 {
+		t.Errorf("second author = %+v, want Test with 2 tokens in 1 line of 1 file", a)
+	}
+	// A file git can't blame is an error, not an author
+	if len(errs) != 1 || filepath.Base(errs[0].Path) != "untracked.txt" {
+		t.Errorf("errors = %v, want one for untracked.txt", errs)
+	}
+
+	out := captureStdout(t, func() { PrintAuthors(authors, options) })
+	if !strings.Contains(out, "Other: 4 tokens (66.7%, 2 lines in 2 files)") {
+		t.Errorf("PrintAuthors printed:\n%s", out)
+	}
+	if out := captureStdout(t, func() { PrintAuthors(nil, options) }); !strings.Contains(out, "No files could be blamed") {
+		t.Errorf("PrintAuthors without authors printed:\n%s", out)
+	}
+}
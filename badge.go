@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// badgeFormats are the values accepted by badge's -format
+var badgeFormats = map[string]bool{"svg": true, "json": true}
+
+// badgeColors are the named colors of shields.io badges
+var badgeColors = map[string]string{
+	"brightgreen": "#4c1", "green": "#97ca00", "yellowgreen": "#a4a61d", "yellow": "#dfb317",
+	"orange": "#fe7d37", "red": "#e05d44", "blue": "#007ec6", "lightgrey": "#9f9f9f", "grey": "#555",
+}
+
+// badgeHexColor matches the hex colors a badge can have instead of a named one
+var badgeHexColor = regexp.MustCompile(`^#?([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+// shieldsEndpoint is the JSON shields.io's endpoint badges read, see
+// https://shields.io/badges/endpoint-badge
+type shieldsEndpoint struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Label         string `json:"label"`
+	Message       string `json:"message"`
+	Color         string `json:"color"`
+}
+
+// badgeCommand defines the badge subcommand, which counts a directory and
+// prints a badge of its total, as an SVG or as the JSON of a shields.io
+// endpoint badge
+func badgeCommand(fs *flag.FlagSet) func() {
+	options := &CommandOptions{}
+	var format, label, color string
+
+	registerFlags(fs, options)
+	registerWalkFlags(fs, options)
+	registerRevFlag(fs, options)
+	fs.StringVar(&format, "format", "svg", "Output format: svg, or json for a shields.io endpoint badge")
+	fs.StringVar(&label, "label", "", "Text of the badge's left side (defaults to the unit counted, e.g. tokens)")
+	fs.StringVar(&color, "badge-color", "blue", "Color of the badge's right side: a shields.io color name such as blue or brightgreen, or a hex color")
+	fs.StringVar(&options.Output, "output", "", "File to write the badge to (defaults to stdout)")
+	return func() {
+		if !badgeFormats[format] {
+			fmt.Fprintf(os.Stderr, "Error: unknown format %q (expected svg or json)\n", format)
+			exit(1)
+		}
+		if _, err := badgeFill(color); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		if err := resolveTarget(fs, options); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		if label == "" {
+			label = options.unitName()
+		}
+
+		ctx, cancel := commandContext(options)
+		defer cancel()
+		var repo *RepoTokenInfo
+		var err error
+		if options.IsSingleFile {
+			repo, err = ProcessSingleFile(ctx, options.Path, options)
+		} else {
+			repo, err = ProcessRepository(ctx, options.Path, options)
+		}
+		if interrupted(err) {
+			err = interruptedError(err, options)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error processing %s: %v\n", options.Path, err)
+			exit(1)
+		}
+
+		badge, _ := renderBadge(format, label, compactCount(repo.TokenCount), color)
+		if options.Output == "" {
+			fmt.Print(badge)
+		} else if err := os.WriteFile(options.Output, []byte(badge), 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", options.Output, err)
+			exit(1)
+		}
+
+		PrintErrors(repo)
+		if options.Strict && len(repo.Errors) > 0 {
+			exit(1)
+		}
+	}
+}
+
+// compactCount formats a count the way badges show it, with three
+// significant digits at most, e.g. 980, 12.3k, 845k or 1.2M
+func compactCount(n int) string {
+	if n < 1000 {
+		return strconv.Itoa(n)
+	}
+	value := float64(n)
+	suffixes := []string{"k", "M", "B"}
+	i := 0
+	for value /= 1e3; value >= 999.5 && i < len(suffixes)-1; value /= 1e3 {
+		i++
+	}
+	if value >= 99.95 {
+		return strconv.FormatFloat(value, 'f', 0, 64) + suffixes[i]
+	}
+	return strings.TrimSuffix(strconv.FormatFloat(value, 'f', 1, 64), ".0") + suffixes[i]
+}
+
+// badgeFill returns the SVG fill of a badge color
+func badgeFill(color string) (string, error) {
+	if fill, ok := badgeColors[color]; ok {
+		return fill, nil
+	}
+	if badgeHexColor.MatchString(color) {
+		return "#" + strings.TrimPrefix(color, "#"), nil
+	}
+	return "", fmt.Errorf("unknown badge color %q (expected a name such as blue or brightgreen, or a hex color)", color)
+}
+
+// renderBadge renders a badge as an SVG or as shields.io endpoint JSON
+func renderBadge(format string, label string, message string, color string) (string, error) {
+	fill, err := badgeFill(color)
+	if err != nil {
+		return "", err
+	}
+	if format == "json" {
+		data, _ := json.MarshalIndent(shieldsEndpoint{1, label, message, strings.TrimPrefix(color, "#")}, "", "  ")
+		return string(data) + "\n", nil
+	}
+	return badgeSVG(label, message, fill), nil
+}
+
+// badgeSVG draws a badge in the flat style of shields.io. Text widths are
+// estimated from the character count, as the badge's font isn't measured.
+func badgeSVG(label string, message string, fill string) string {
+	labelWidth, messageWidth := len(label)*7+10, len(message)*7+10
+	width := labelWidth + messageWidth
+	title := html.EscapeString(label + ": " + message)
+	label, message = html.EscapeString(label), html.EscapeString(message)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s">`+"\n", width, title)
+	fmt.Fprintf(&b, "<title>%s</title>\n", title)
+	b.WriteString(`<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>` + "\n")
+	fmt.Fprintf(&b, `<clipPath id="r"><rect width="%d" height="20" rx="3" fill="#fff"/></clipPath>`+"\n", width)
+	fmt.Fprintf(&b, `<g clip-path="url(#r)"><rect width="%d" height="20" fill="#555"/><rect x="%d" width="%d" height="20" fill="%s"/><rect width="%d" height="20" fill="url(#s)"/></g>`+"\n", labelWidth, labelWidth, messageWidth, fill, width)
+	b.WriteString(`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">` + "\n")
+	for _, text := range []struct {
+		x    int
+		text string
+	}{{labelWidth / 2, label}, {labelWidth + messageWidth/2, message}} {
+		fmt.Fprintf(&b, `<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%d" y="14">%s</text>`+"\n", text.x, text.text, text.x, text.text)
+	}
+	b.WriteString("</g>\n</svg>\n")
+	return b.String()
+}
+
+// serveBadge serves /badge/<repo>.svg and /badge/<repo>.json, the badge of
+// the total of a -metrics-repos entry as of its last scan. Query parameters
+// label and color override the defaults.
+func (s *tokenCounterServer) serveBadge(w http.ResponseWriter, r *http.Request) {
+	m := s.metrics
+	name, format := r.PathValue("repo"), ""
+	for _, ext := range []string{"svg", "json"} {
+		if strings.HasSuffix(name, "."+ext) {
+			name, format = strings.TrimSuffix(name, "."+ext), ext
+		}
+	}
+	if format == "" {
+		http.Error(w, "badge paths end in .svg or .json", http.StatusNotFound)
+		return
+	}
+
+	m.mu.Lock()
+	byLanguage, ok := m.repoTokens[name]
+	total := 0
+	for _, count := range byLanguage {
+		total += count
+	}
+	m.mu.Unlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("%s is not a -metrics-repos entry, or hasn't been scanned yet", name), http.StatusNotFound)
+		return
+	}
+
+	label, color := r.URL.Query().Get("label"), r.URL.Query().Get("color")
+	if label == "" {
+		label = s.options.unitName()
+	}
+	if color == "" {
+		color = "blue"
+	}
+	badge, err := renderBadge(format, label, compactCount(total), color)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+	} else {
+		w.Header().Set("Content-Type", "image/svg+xml")
+	}
+	// Let shields.io and browsers cache the badge for a few minutes
+	w.Header().Set("Cache-Control", "max-age=300")
+	fmt.Fprint(w, badge)
+}
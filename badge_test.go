@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompactCount(t *testing.T) {
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, "0"},
+		{980, "980"},
+		{1000, "1k"},
+		{12345, "12.3k"},
+		{99960, "100k"},
+		{845000, "845k"},
+		{999600, "1M"},
+		{1234567, "1.2M"},
+		{5_000_000_000, "5B"},
+		{2_000_000_000_000, "2000B"},
+	}
+	for _, tt := range tests {
+		if got := compactCount(tt.n); got != tt.want {
+			t.Errorf("compactCount(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestBadgeFill(t *testing.T) {
+	tests := []struct {
+		color string
+		want  string
+		ok    bool
+	}{
+		{"blue", "#007ec6", true},
+		{"brightgreen", "#4c1", true},
+		{"ff8800", "#ff8800", true},
+		{"#abc", "#abc", true},
+		{"purple", "", false},
+		{"#12345", "", false},
+	}
+	for _, tt := range tests {
+		got, err := badgeFill(tt.color)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("badgeFill(%q) = %q, %v, want %q", tt.color, got, err, tt.want)
+		}
+	}
+}
+
+func TestRenderBadge(t *testing.T) {
+	svg, err := renderBadge("svg", "tokens", "<1k>", "green")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`aria-label="tokens: &lt;1k&gt;"`, `fill="#97ca00"`, `width="90"`, `<text x="71" y="14">&lt;1k&gt;</text>`} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("SVG has no %s:\n%s", want, svg)
+		}
+	}
+
+	data, err := renderBadge("json", "code", "12.3k", "#ff8800")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var endpoint shieldsEndpoint
+	if err := json.Unmarshal([]byte(data), &endpoint); err != nil || endpoint != (shieldsEndpoint{1, "code", "12.3k", "ff8800"}) {
+		t.Errorf("endpoint %+v, %v", endpoint, err)
+	}
+
+	if _, err := renderBadge("svg", "tokens", "1", "purple"); err == nil {
+		t.Error("badge with an unknown color rendered")
+	}
+}
+
+func TestBadgeCommand(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world", "b.txt": "one two three"})
+
+	out := captureStdout(t, func() {
+		findCommand("badge").run([]string{"-model", "cl100k_base", "-format", "json", "-label", "context", dir})
+	})
+	if want := `"message": "5"`; !strings.Contains(out, want) || !strings.Contains(out, `"label": "context"`) {
+		t.Errorf("badge:\n%s", out)
+	}
+
+	output := filepath.Join(t.TempDir(), "badge.svg")
+	captureStdout(t, func() { findCommand("badge").run([]string{"-model", "cl100k_base", "-output", output, dir}) })
+	if data, err := os.ReadFile(output); err != nil || !strings.Contains(string(data), `aria-label="tokens: 5"`) {
+		t.Errorf("-output wrote %s, %v", data, err)
+	}
+}
+
+func TestBadgeCommandErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"unknown format", []string{"-format", "png", "."}, `Error: unknown format "png" (expected svg or json)`},
+		{"unknown color", []string{"-badge-color", "purple", "."}, `Error: unknown badge color "purple"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderr, code := exitStatus(t, func() { findCommand("badge").run(tt.args) })
+			if code != 1 || !strings.Contains(stderr, tt.want) {
+				t.Errorf("exit %d, stderr:\n%s", code, stderr)
+			}
+		})
+	}
+}
+
+func TestServeBadge(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"main.go": "package main\n"})
+	repo, options := scanTree(t, dir, "-model", "cl100k_base")
+	server := &tokenCounterServer{options: options, metrics: newServerMetrics()}
+	server.metrics.setRepo("api", repo)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /badge/{repo...}", server.serveBadge)
+
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+		want        string
+	}{
+		{"/badge/api.svg", http.StatusOK, "image/svg+xml", `aria-label="tokens: 3"`},
+		{"/badge/api.json?label=ctx&color=red", http.StatusOK, "application/json", `"label": "ctx"`},
+		{"/badge/api.png", http.StatusNotFound, "", "badge paths end in .svg or .json"},
+		{"/badge/web.svg", http.StatusNotFound, "", "web is not a -metrics-repos entry"},
+		{"/badge/api.svg?color=purple", http.StatusBadRequest, "", `unknown badge color "purple"`},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest("GET", tt.path, nil))
+		if rec.Code != tt.status || !strings.Contains(rec.Body.String(), tt.want) {
+			t.Errorf("GET %s: %d %s", tt.path, rec.Code, rec.Body.String())
+		}
+		if tt.contentType != "" && rec.Header().Get("Content-Type") != tt.contentType {
+			t.Errorf("GET %s: Content-Type %q", tt.path, rec.Header().Get("Content-Type"))
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// defaultBaselineFile is where baseline write stores the baseline, relative
+// to the scan root. It's hidden, so it isn't counted itself.
+const defaultBaselineFile = ".token-baseline.json"
+
+// Baseline is the committed record of the token count of each directory that
+// baseline check compares a scan against
+type Baseline struct {
+	Metadata    *ScanMetadata  `json:"metadata,omitempty"` // How the baseline was written
+	Model       string         `json:"model"`
+	Unit        string         `json:"unit"`
+	Total       int            `json:"total"`
+	Directories map[string]int `json:"directories"` // Slash-separated paths relative to the scan root
+}
+
+// baselineCommand writes a baseline of the per-directory counts or checks a
+// scan against one, failing when a directory grew more than -tolerance
+// percent over its baseline, like a bundle size ratchet
+func baselineCommand(fs *flag.FlagSet) func() {
+	options := &CommandOptions{}
+	var file string
+	var tolerance float64
+
+	registerFlags(fs, options)
+	registerWalkFlags(fs, options)
+	registerRevFlag(fs, options)
+	fs.StringVar(&file, "baseline", "", "Baseline file (default "+defaultBaselineFile+" in the scanned directory)")
+	fs.Float64Var(&tolerance, "tolerance", 5, "Percentage a directory may grow over its baseline before check fails")
+	return func() {
+		// The action comes first, so parse the flags that follow it too
+		action := fs.Arg(0)
+		if action != "write" && action != "check" {
+			fmt.Fprintln(os.Stderr, "Error: expected baseline write or baseline check")
+			fs.Usage()
+			exit(2)
+		}
+		fs.Parse(fs.Args()[1:])
+
+		if tolerance < 0 {
+			fmt.Fprintln(os.Stderr, "Error: -tolerance can't be negative")
+			exit(1)
+		}
+		if err := resolveTarget(fs, options); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		if options.IsSingleFile {
+			fmt.Fprintln(os.Stderr, "Error: baseline needs a directory to scan")
+			exit(1)
+		}
+		if file == "" {
+			file = filepath.Join(revReportedPath(options.Path, options), defaultBaselineFile)
+		}
+
+		ctx, cancel := commandContext(options)
+		defer cancel()
+		repo, err := ProcessRepository(ctx, options.Path, options)
+		if interrupted(err) {
+			err = interruptedError(err, options)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error processing %s: %v\n", options.Path, err)
+			exit(1)
+		}
+		reportRevPaths(repo, options)
+		current := newBaseline(repo, options)
+		passed := true
+
+		if action == "write" {
+			current.Metadata = newScanMetadata(repo, options)
+			if err := writeBaseline(file, current); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing baseline: %v\n", err)
+				exit(1)
+			}
+			fmt.Fprintf(os.Stderr, "Wrote baseline of %d directories (%s %s) to %s\n", len(current.Directories), formatCount(current.Total), current.Unit, file)
+		} else {
+			baseline, err := readBaseline(file)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading baseline: %v\n", err)
+				exit(1)
+			}
+			if baseline.Model != current.Model || baseline.Unit != current.Unit {
+				fmt.Fprintf(os.Stderr, "Error: the baseline counts %s with %s, but this scan counts %s with %s\n", baseline.Unit, baseline.Model, current.Unit, current.Model)
+				exit(1)
+			}
+			passed = checkBaseline(baseline, current, tolerance, options)
+		}
+
+		PrintErrors(repo)
+		if !passed || options.Strict && len(repo.Errors) > 0 {
+			exit(1)
+		}
+	}
+}
+
+// newBaseline records the counts of a scan
+func newBaseline(repo *RepoTokenInfo, options *CommandOptions) *Baseline {
+	baseline := &Baseline{
+		Model:       options.modelName(),
+		Unit:        options.unitName(),
+		Total:       repo.TokenCount,
+		Directories: make(map[string]int),
+	}
+	for _, dirInfo := range repo.Dirs {
+		relativePath, err := filepath.Rel(repo.Path, dirInfo.Path)
+		if err != nil {
+			relativePath = dirInfo.Path
+		}
+		baseline.Directories[filepath.ToSlash(relativePath)] = dirInfo.TokenCount
+	}
+	return baseline
+}
+
+// writeBaseline writes baseline to file as indented JSON, which keeps diffs
+// of the committed file readable
+func writeBaseline(file string, baseline *Baseline) error {
+	data, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0644)
+}
+
+// readBaseline reads a baseline written by writeBaseline
+func readBaseline(file string) (*Baseline, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var baseline Baseline
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return &baseline, nil
+}
+
+// checkBaseline prints the directories, and the total, that grew more than
+// tolerance percent over the baseline and reports whether there were none.
+// Directories missing from the baseline only count towards the total.
+func checkBaseline(baseline *Baseline, current *Baseline, tolerance float64, options *CommandOptions) bool {
+	var paths []string
+	for path := range current.Directories {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	overBudget := func(count int, budget int) bool {
+		return float64(count) > float64(budget)*(1+tolerance/100)
+	}
+	growth := func(count int, budget int) string {
+		if budget == 0 {
+			return "was empty"
+		}
+		return fmt.Sprintf("%+.1f%%", float64(count-budget)*100/float64(budget))
+	}
+
+	failures, shrunk := 0, 0
+	var added []string
+	for _, path := range paths {
+		count := current.Directories[path]
+		budget, ok := baseline.Directories[path]
+		switch {
+		case !ok:
+			added = append(added, path)
+		case overBudget(count, budget):
+			failures++
+			fmt.Printf("%s %s: %s %s, baseline %s (%s)\n", options.paint(ansiRed, "FAIL"), path, formatCount(count), current.Unit, formatCount(budget), growth(count, budget))
+		case count < budget:
+			shrunk++
+		}
+	}
+	for _, path := range added {
+		fmt.Printf("new  %s: %s %s, not in the baseline\n", path, formatCount(current.Directories[path]), current.Unit)
+	}
+	if overBudget(current.Total, baseline.Total) {
+		failures++
+		fmt.Printf("%s total: %s %s, baseline %s (%s)\n", options.paint(ansiRed, "FAIL"), formatCount(current.Total), current.Unit, formatCount(baseline.Total), growth(current.Total, baseline.Total))
+	}
+
+	if failures > 0 {
+		fmt.Printf("\n%d over the baseline by more than %.1f%%. If the growth is expected, run token-counter baseline write to accept it.\n", failures, tolerance)
+		return false
+	}
+	fmt.Printf("Within %.1f%% of the baseline: %s %s (baseline %s)\n", tolerance, formatCount(current.Total), current.Unit, formatCount(baseline.Total))
+	if shrunk > 0 {
+		fmt.Printf("%d directories shrank; run token-counter baseline write to lower the baseline.\n", shrunk)
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBaselineCommand(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"a.txt":   strings.Repeat("word ", 20),
+		"b/b.txt": strings.Repeat("word ", 10),
+	})
+	run := func(args ...string) { findCommand("baseline").run(append(args, "-model", "cl100k_base", dir)) }
+
+	captureStderr(t, func() { run("write") })
+	baseline, err := readBaseline(filepath.Join(dir, defaultBaselineFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{".": 21, "b": 11}; !reflect.DeepEqual(baseline.Directories, want) || baseline.Total != 32 || baseline.Metadata == nil {
+		t.Errorf("baseline %+v, want directories %v and a total of 32", baseline, want)
+	}
+	if out := captureStdout(t, func() { run("check") }); !strings.Contains(out, "Within 5.0% of the baseline: 32 tokens (baseline 32)") {
+		t.Errorf("check printed:\n%s", out)
+	}
+
+	// Growing b by a token is within the tolerance, by 10 isn't
+	writeTree(t, dir, map[string]string{"b/b.txt": strings.Repeat("word ", 11)})
+	if out := captureStdout(t, func() { run("check", "-tolerance", "10") }); !strings.Contains(out, "Within 10.0%") {
+		t.Errorf("check -tolerance 10 printed:\n%s", out)
+	}
+	writeTree(t, dir, map[string]string{"b/b.txt": strings.Repeat("word ", 20)})
+	if _, code := exitStatus(t, func() { captureStdout(t, func() { run("check") }) }); code != 1 {
+		t.Errorf("check of a directory over the baseline exited %d, want 1", code)
+	}
+}
+
+func TestBaselineCommandErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "word"})
+	bad := filepath.Join(dir, "bad.json")
+	os.WriteFile(bad, []byte("{"), 0o644)
+	other := filepath.Join(dir, "other.json")
+	writeBaseline(other, &Baseline{Model: "o200k_base", Unit: "tokens", Directories: map[string]int{}})
+
+	tests := []struct {
+		name string
+		args []string
+		code int
+		want string
+	}{
+		{"no action", []string{dir}, 2, "Error: expected baseline write or baseline check"},
+		{"negative tolerance", []string{"check", "-tolerance", "-1", dir}, 1, "Error: -tolerance can't be negative"},
+		{"missing", []string{"check", dir}, 1, "Error reading baseline:"},
+		{"invalid", []string{"check", "-baseline", bad, dir}, 1, "bad.json: unexpected end of JSON input"},
+		{"other model", []string{"check", "-model", "cl100k_base", "-baseline", other, dir}, 1, "but this scan counts tokens with cl100k_base"},
+		{"file", []string{"check", filepath.Join(dir, "a.txt")}, 1, "Error: baseline needs a directory to scan"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderr, code := exitStatus(t, func() { findCommand("baseline").run(tt.args) })
+			if code != tt.code || !strings.Contains(stderr, tt.want) {
+				t.Errorf("exit %d, stderr:\n%s\nwant exit %d and %q", code, stderr, tt.code, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckBaseline(t *testing.T) {
+	baseline := &Baseline{Unit: "tokens", Total: 300, Directories: map[string]int{".": 100, "a": 100, "b": 100, "gone": 0}}
+	tests := []struct {
+		name    string
+		current map[string]int
+		passed  bool
+		want    []string
+	}{
+		{"unchanged", map[string]int{".": 100, "a": 100, "b": 100}, true, []string{"Within 5.0% of the baseline: 300 tokens (baseline 300)"}},
+		{"shrunk", map[string]int{".": 100, "a": 90, "b": 100}, true, []string{"1 directories shrank"}},
+		{"new", map[string]int{".": 100, "a": 100, "b": 100, "c": 10}, true, []string{"new  c: 10 tokens, not in the baseline"}},
+		{"grew", map[string]int{".": 100, "a": 120, "b": 100}, false, []string{"FAIL a: 120 tokens, baseline 100 (+20.0%)", "FAIL total: 320 tokens, baseline 300 (+6.7%)", "2 over the baseline"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := &Baseline{Unit: "tokens", Directories: tt.current}
+			for _, count := range tt.current {
+				current.Total += count
+			}
+			var passed bool
+			out := captureStdout(t, func() { passed = checkBaseline(baseline, current, 5, &CommandOptions{}) })
+			if passed != tt.passed {
+				t.Errorf("checkBaseline = %v, want %v", passed, tt.passed)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("output is missing %q:\n%s", want, out)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import "sync"
+
+// fileBatch collects files to count, counting a batch of them concurrently
+// once it has size of them and then handing the results to done in the order
+// the files were added. With a size of 1, files are counted as they're
+// added.
+type fileBatch struct {
+	size  int
+	count func(path string) (*FileTokenInfo, error)
+	done  func(path string, fileInfo *FileTokenInfo, err error) error
+
+	paths []string
+}
+
+// add queues path, counting the batch if it's full
+func (b *fileBatch) add(path string) error {
+	b.paths = append(b.paths, path)
+	if len(b.paths) < b.size {
+		return nil
+	}
+	return b.flush()
+}
+
+// flush counts the queued files. It stops at the first error done returns.
+func (b *fileBatch) flush() error {
+	paths := b.paths
+	b.paths = nil
+
+	infos := make([]*FileTokenInfo, len(paths))
+	errs := make([]error, len(paths))
+	if len(paths) == 1 {
+		infos[0], errs[0] = b.count(paths[0])
+	} else {
+		var wg sync.WaitGroup
+		for i, path := range paths {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				infos[i], errs[i] = b.count(path)
+			}()
+		}
+		wg.Wait()
+	}
+
+	for i, path := range paths {
+		if err := b.done(path, infos[i], errs[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFileBatch(t *testing.T) {
+	errStop := errors.New("stop")
+	tests := []struct {
+		name    string
+		size    int
+		paths   []string
+		stopAt  string // Path done fails for
+		want    []string
+		wantErr error
+	}{
+		{"one at a time", 1, []string{"a", "b", "c"}, "", []string{"a", "b", "c"}, nil},
+		{"batches", 2, []string{"a", "b", "c", "d", "e"}, "", []string{"a", "b", "c", "d", "e"}, nil},
+		{"stopped", 3, []string{"a", "b", "c", "d"}, "b", []string{"a", "b"}, errStop},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inFlight, maxInFlight atomic.Int32
+			var done []string
+			b := &fileBatch{
+				size: tt.size,
+				count: func(path string) (*FileTokenInfo, error) {
+					n := inFlight.Add(1)
+					defer inFlight.Add(-1)
+					for {
+						m := maxInFlight.Load()
+						if n <= m || maxInFlight.CompareAndSwap(m, n) {
+							break
+						}
+					}
+					// Later files finish first, to check the order is kept
+					time.Sleep(time.Duration(len(tt.paths)-slices.Index(tt.paths, path)) * time.Millisecond)
+					return &FileTokenInfo{Path: path}, nil
+				},
+				done: func(path string, fileInfo *FileTokenInfo, err error) error {
+					if err != nil || fileInfo.Path != path {
+						t.Errorf("done(%q) got %v, %v", path, fileInfo, err)
+					}
+					done = append(done, path)
+					if path == tt.stopAt {
+						return errStop
+					}
+					return nil
+				},
+			}
+			var err error
+			for _, path := range tt.paths {
+				if err = b.add(path); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				err = b.flush()
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(done, tt.want) {
+				t.Errorf("done %v, want %v", done, tt.want)
+			}
+			if int(maxInFlight.Load()) > tt.size {
+				t.Errorf("%d files were counted at once, more than the batch size %d", maxInFlight.Load(), tt.size)
+			}
+		})
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// benchFormats are the output formats of the bench subcommand
+var benchFormats = map[string]bool{"text": true, "json": true}
+
+// benchSampleSize is the size of the built-in sample corpus, and
+// benchSampleFile the size of the files it's cut into
+const (
+	benchSampleSize = 1 << 20
+	benchSampleFile = 4 << 10
+)
+
+// benchSample is the text the built-in sample corpus repeats: prose, code and
+// data, as a repository mixes them
+const benchSample = `Tokenizers split text into the pieces a language model reads. Prose, with its
+common words and punctuation, packs about four characters into a token, while
+code and data, with their identifiers, indentation and symbols, take more.
+
+func (c *Cache) Get(key string) (value []byte, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Since(entry.added) > c.ttl {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+{"id": 1842, "name": "token-counter", "tags": ["cli", "llm", "tokens"], "stars": 312, "license": "MIT"}
+
+def moving_average(values, window=3):
+    return [sum(values[i:i + window]) / window for i in range(len(values) - window + 1)]
+
+`
+
+// BenchReport is the result of the bench subcommand
+type BenchReport struct {
+	Metadata *ScanMetadata  `json:"metadata"`
+	Corpora  []*BenchCorpus `json:"corpora"`
+	Results  []*BenchResult `json:"results"`
+}
+
+// BenchCorpus is a set of texts the tokenizers are measured on
+type BenchCorpus struct {
+	Name  string `json:"name"`
+	Files int    `json:"files"`
+	Bytes int    `json:"bytes"`
+
+	texts []string
+}
+
+// BenchResult is the throughput of a tokenizer on a corpus with a number of
+// workers counting files at once
+type BenchResult struct {
+	Model           string  `json:"model"`
+	Corpus          string  `json:"corpus"`
+	Workers         int     `json:"workers"`
+	Tokens          int     `json:"tokens"`
+	Seconds         float64 `json:"seconds"`
+	TokensPerSecond float64 `json:"tokens_per_second"`
+	MBPerSecond     float64 `json:"mb_per_second"`
+}
+
+// benchCommand defines the bench subcommand, which measures how fast each
+// tokenizer counts, on a built-in sample and on the files of a directory
+func benchCommand(fs *flag.FlagSet) func() {
+	options := &CommandOptions{}
+	var workers []int
+	var maxBytes int64
+	var minTime time.Duration
+	var sampleOnly bool
+	registerFlags(fs, options)
+	registerWalkFlags(fs, options)
+	fs.Func("workers", "Comma-separated numbers of files counted at once to measure with (default 1 and the number of CPUs)", func(value string) error {
+		workers = nil
+		for _, item := range splitList(value) {
+			n, err := strconv.Atoi(item)
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid number of workers %q", item)
+			}
+			workers = append(workers, n)
+		}
+		return nil
+	})
+	fs.Func("max-bytes", "Most bytes of the directory's files to measure with, with an optional K, M or G suffix (default 32M)", func(value string) error {
+		size, err := parseByteSize(value)
+		maxBytes = size
+		return err
+	})
+	fs.DurationVar(&minTime, "min-time", time.Second, "Shortest time to count each corpus for; it's counted again until then, for steadier numbers")
+	fs.BoolVar(&sampleOnly, "sample-only", false, "Measure with the built-in sample only, without reading a directory")
+	fs.StringVar(&options.Format, "format", "text", "Output format: text or json")
+	return func() {
+		if !benchFormats[options.Format] {
+			fmt.Fprintf(os.Stderr, "Error: unknown format %q (expected text or json)\n", options.Format)
+			exit(1)
+		}
+		if options.unitName() != "tokens" {
+			fmt.Fprintln(os.Stderr, "Error: bench measures tokenizers, so it only counts tokens")
+			exit(1)
+		}
+		if len(workers) == 0 {
+			workers = []int{1}
+			if runtime.NumCPU() > 1 {
+				workers = append(workers, runtime.NumCPU())
+			}
+		}
+		if maxBytes == 0 {
+			maxBytes = 32 << 20
+		}
+
+		encs, err := benchCodecs(options)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		corpora := []*BenchCorpus{benchSampleCorpus()}
+		if !sampleOnly {
+			if err := resolveTarget(fs, options); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+			ctx, cancel := commandContext(options)
+			defer cancel()
+			corpus, err := benchDirectoryCorpus(ctx, options, maxBytes)
+			if interrupted(err) {
+				err = interruptedError(err, options)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error processing %s: %v\n", options.Path, err)
+				exit(1)
+			}
+			if corpus.Files > 0 {
+				corpora = append(corpora, corpus)
+			}
+		}
+
+		report := &BenchReport{
+			Metadata: &ScanMetadata{
+				Tool:      "token-counter",
+				Version:   toolVersion(),
+				Model:     options.modelName(),
+				Unit:      options.unitName(),
+				Command:   commandLine,
+				Path:      options.Path,
+				Timestamp: time.Now().UTC().Truncate(time.Second),
+			},
+			Corpora: corpora,
+		}
+		for _, corpus := range corpora {
+			report.Metadata.Files += corpus.Files
+		}
+		for _, enc := range encs {
+			for _, corpus := range corpora {
+				for _, n := range workers {
+					if !options.Quiet {
+						logger.Info("measuring", "model", enc.Name, "corpus", corpus.Name, "workers", n)
+					}
+					result, err := benchCount(enc, corpus, n, minTime)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "Error: %s: %v\n", enc.Name, err)
+						exit(1)
+					}
+					report.Results = append(report.Results, result)
+				}
+			}
+		}
+
+		if options.Format == "json" {
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+			fmt.Println(string(data))
+			return
+		}
+		printBench(report)
+	}
+}
+
+// benchCodecs returns the tokenizers to measure: those of -models,
+// -tokenizer-file or -bpe-vocab if given, otherwise every tiktoken encoding.
+// Counting APIs are left to their providers to measure.
+func benchCodecs(options *CommandOptions) ([]namedCodec, error) {
+	if len(options.Models) == 0 && options.TokenizerFile == "" && options.BPEVocab == "" {
+		for _, enc := range encodings {
+			options.Models = append(options.Models, string(enc.Name))
+		}
+	}
+	encs, err := newCodecs(options)
+	if err != nil {
+		return nil, err
+	}
+	if len(options.Models) == 0 {
+		encs[0].Name = options.modelName()
+	}
+	for _, enc := range encs {
+		if usesAPI([]namedCodec{enc}) {
+			return nil, fmt.Errorf("%s is counted by an API, which bench doesn't measure", enc.Name)
+		}
+	}
+	return encs, nil
+}
+
+// benchSampleCorpus returns the built-in sample, cut into files
+func benchSampleCorpus() *BenchCorpus {
+	text := strings.Repeat(benchSample, benchSampleSize/len(benchSample)+1)[:benchSampleSize]
+	corpus := &BenchCorpus{Name: "sample", Bytes: len(text)}
+	for len(text) > 0 {
+		end := min(benchSampleFile, len(text))
+		// Cut at a line break, so no file starts in the middle of a word
+		if i := strings.LastIndexByte(text[:end], '\n'); i > 0 && end < len(text) {
+			end = i + 1
+		}
+		corpus.texts = append(corpus.texts, text[:end])
+		text = text[end:]
+	}
+	corpus.Files = len(corpus.texts)
+	return corpus
+}
+
+// benchDirectoryCorpus reads the files a scan of the options' path would
+// count, up to maxBytes of them
+func benchDirectoryCorpus(ctx context.Context, options *CommandOptions, maxBytes int64) (*BenchCorpus, error) {
+	corpus := &BenchCorpus{Name: relativeTo(".", options.Path)}
+	if options.IsSingleFile {
+		data, err := ioutil.ReadFile(options.Path)
+		if err != nil {
+			return nil, err
+		}
+		text, _ := decodeText(data)
+		corpus.texts = append(corpus.texts, text)
+		corpus.Files, corpus.Bytes = 1, len(text)
+		return corpus, nil
+	}
+
+	var paths []string
+	var total int64
+	listing := *options
+	listing.collect = func(path string, info os.FileInfo) {
+		if total+info.Size() <= maxBytes {
+			paths = append(paths, path)
+			total += info.Size()
+		}
+	}
+	if _, err := ProcessRepository(ctx, options.Path, &listing); err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			logger.Warn("not measuring with file", "path", path, "err", err)
+			continue
+		}
+		text, _ := decodeText(data)
+		corpus.texts = append(corpus.texts, text)
+		corpus.Bytes += len(text)
+	}
+	corpus.Files = len(corpus.texts)
+	return corpus, nil
+}
+
+// benchCount counts a corpus with enc, with workers goroutines taking its
+// files in turn, as many times as fit in minTime (at least once)
+func benchCount(enc namedCodec, corpus *BenchCorpus, workers int, minTime time.Duration) (*BenchResult, error) {
+	result := &BenchResult{Model: enc.Name, Corpus: corpus.Name, Workers: workers}
+	var bytes int
+	start := time.Now()
+	for rounds := 0; rounds == 0 || time.Since(start) < minTime; rounds++ {
+		tokens, err := countCorpus(enc, corpus.texts, workers)
+		if err != nil {
+			return nil, err
+		}
+		result.Tokens = tokens
+		bytes += corpus.Bytes
+		result.TokensPerSecond += float64(tokens)
+	}
+	result.Seconds = time.Since(start).Seconds()
+	if result.Seconds > 0 {
+		result.TokensPerSecond /= result.Seconds
+		result.MBPerSecond = float64(bytes) / (1 << 20) / result.Seconds
+	}
+	return result, nil
+}
+
+// countCorpus counts every text with enc on workers goroutines and returns
+// the total
+func countCorpus(enc namedCodec, texts []string, workers int) (int, error) {
+	next := make(chan string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var firstErr error
+	total := 0
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for text := range next {
+				n, err := enc.Codec.Count(text)
+				mu.Lock()
+				total += n
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, text := range texts {
+		next <- text
+	}
+	close(next)
+	wg.Wait()
+	return total, firstErr
+}
+
+// printBench prints the corpora and the throughput of each tokenizer on them
+func printBench(report *BenchReport) {
+	for _, corpus := range report.Corpora {
+		fmt.Printf("Corpus %s: %s files, %.1f MB\n", corpus.Name, formatCount(corpus.Files), float64(corpus.Bytes)/(1<<20))
+	}
+	fmt.Printf("Version: %s, %d CPUs\n\n", report.Metadata.Version, runtime.NumCPU())
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MODEL\tCORPUS\tWORKERS\tTOKENS\tTOKENS/S\tMB/S\t")
+	for _, result := range report.Results {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%.2f\t\n", result.Model, result.Corpus, result.Workers,
+			formatCount(result.Tokens), formatCount(int(result.TokensPerSecond)), result.MBPerSecond)
+	}
+	w.Flush()
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestBenchSampleCorpus(t *testing.T) {
+	corpus := benchSampleCorpus()
+	bytes := 0
+	for i, text := range corpus.texts {
+		bytes += len(text)
+		if len(text) > benchSampleFile || i < len(corpus.texts)-1 && !strings.HasSuffix(text, "\n") {
+			t.Errorf("file %d has %d bytes and ends in %q", i, len(text), text[len(text)-1:])
+		}
+	}
+	if corpus.Bytes != benchSampleSize || bytes != benchSampleSize || corpus.Files != len(corpus.texts) {
+		t.Errorf("corpus of %d files and %d bytes, texts of %d, want %d", corpus.Files, corpus.Bytes, bytes, benchSampleSize)
+	}
+}
+
+func TestBenchDirectoryCorpus(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": strings.Repeat("a", 100), "b.txt": strings.Repeat("b", 100), "c.png": "\x89PNG"})
+	tests := []struct {
+		name     string
+		maxBytes int64
+		files    int
+	}{
+		{"everything", 1000, 2},
+		{"up to the limit", 150, 1},
+		{"nothing", 10, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := testOptions(t, "-model", "cl100k_base")
+			options.Path = dir
+			corpus, err := benchDirectoryCorpus(context.Background(), options, tt.maxBytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if corpus.Files != tt.files || corpus.Bytes != 100*tt.files {
+				t.Errorf("corpus of %d files and %d bytes, want %d files", corpus.Files, corpus.Bytes, tt.files)
+			}
+		})
+	}
+
+	options := testOptions(t)
+	options.Path = dir + "/missing"
+	if _, err := benchDirectoryCorpus(context.Background(), options, 1000); err == nil {
+		t.Error("benchDirectoryCorpus of a missing directory succeeded")
+	}
+}
+
+func TestCountCorpus(t *testing.T) {
+	codec, err := codecForName("cl100k_base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := namedCodec{"cl100k_base", codec}
+	texts := []string{"hello world", "one two three", "four", ""}
+	for _, workers := range []int{1, 3} {
+		if total, err := countCorpus(enc, texts, workers); err != nil || total != 6 {
+			t.Errorf("countCorpus with %d workers = %d, %v, want 6", workers, total, err)
+		}
+	}
+	result, err := benchCount(enc, &BenchCorpus{Name: "test", texts: texts, Bytes: 28}, 2, 0)
+	if err != nil || result.Tokens != 6 || result.Workers != 2 || result.TokensPerSecond <= 0 || result.MBPerSecond <= 0 {
+		t.Errorf("benchCount = %+v, %v", result, err)
+	}
+}
+
+func TestBenchCommand(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world"})
+	out := captureStdout(t, func() {
+		findCommand("bench").run([]string{"-quiet", "-models", "cl100k_base", "-workers", "1,2", "-min-time", "1ns", "-format", "json", dir})
+	})
+	var report BenchReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("bench -format json doesn't parse: %v\n%s", err, out)
+	}
+	if len(report.Corpora) != 2 || report.Corpora[1].Files != 1 || len(report.Results) != 4 || report.Metadata.Files != report.Corpora[0].Files+1 {
+		t.Errorf("report %s", out)
+	}
+	if last := report.Results[3]; last.Corpus != report.Corpora[1].Name || last.Workers != 2 || last.Tokens != 2 {
+		t.Errorf("last result %+v, want a.txt with 2 workers", last)
+	}
+
+	out = captureStdout(t, func() {
+		findCommand("bench").run([]string{"-quiet", "-models", "cl100k_base", "-workers", "1", "-min-time", "1ns", "-sample-only"})
+	})
+	if !strings.Contains(out, "Corpus sample: ") || !strings.Contains(out, "MODEL        CORPUS  WORKERS") || strings.Count(out, "cl100k_base") != 1 {
+		t.Errorf("bench -sample-only printed:\n%s", out)
+	}
+}
+
+func TestBenchCommandErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"format", []string{"-format", "xml"}, `Error: unknown format "xml" (expected text or json)`},
+		{"words", []string{"-count-mode", "words"}, "Error: bench measures tokenizers, so it only counts tokens"},
+		{"workers", []string{"-workers", "1,0"}, `invalid number of workers "0"`},
+		{"model", []string{"-models", "nope", "-sample-only"}, `Error: error loading model nope: unknown model "nope"`},
+		{"missing path", []string{"-models", "cl100k_base", "-min-time", "1ns", dir + "/missing"}, "missing: no such file or directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderr, code := exitStatus(t, func() { captureStdout(t, func() { findCommand("bench").run(tt.args) }) })
+			if code == 0 || !strings.Contains(stderr, tt.want) {
+				t.Errorf("exit %d, stderr:\n%s\nwant %q", code, stderr, tt.want)
+			}
+		})
+	}
+}
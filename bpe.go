@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// loadGPT2Tokenizer builds a byte-level BPE tokenizer from GPT-2-style
+// vocabulary files: encoder.json, mapping tokens to their ids, and vocab.bpe,
+// listing the merges in priority order after a "#version" line. Text is
+// pre-tokenized as GPT-2 does, so the files of GPT-2 itself count like
+// r50k_base.
+func loadGPT2Tokenizer(vocabPath string, encoderPath string) (*hfTokenizer, error) {
+	data, err := os.ReadFile(encoderPath)
+	if err != nil {
+		return nil, err
+	}
+	vocab := make(map[string]int)
+	if err := json.Unmarshal(data, &vocab); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", encoderPath, err)
+	}
+
+	data, err = os.ReadFile(vocabPath)
+	if err != nil {
+		return nil, err
+	}
+	var merges [][2]string
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" || (i == 0 && strings.HasPrefix(line, "#version")) {
+			continue
+		}
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("error parsing %s: invalid merge %q on line %d", vocabPath, line, i+1)
+		}
+		merges = append(merges, [2]string{parts[0], parts[1]})
+	}
+
+	useRegex, addPrefixSpace := true, false
+	file := &hfTokenizerFile{
+		PreTokenizer: &hfComponent{Type: "ByteLevel", UseRegex: &useRegex, AddPrefixSpace: &addPrefixSpace},
+		Model:        hfModel{Type: "BPE", Vocab: vocab},
+	}
+	return newHFTokenizer(vocabPath, file, merges)
+}
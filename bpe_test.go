@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeGPT2Files writes a GPT-2-style encoder.json and vocab.bpe that know
+// "hello" and " world", with Ġ standing for the space, as byte-level BPE
+// maps it
+func writeGPT2Files(t *testing.T, merges string) (vocab string, encoder string) {
+	t.Helper()
+	dir := t.TempDir()
+	vocab, encoder = filepath.Join(dir, "vocab.bpe"), filepath.Join(dir, "encoder.json")
+	tokens := []string{"h", "e", "l", "o", "w", "r", "d", "Ġ", "he", "ll", "hell", "hello", "Ġw", "or", "Ġwor", "ld", "Ġworld"}
+	ids := make(map[string]int)
+	for id, token := range tokens {
+		ids[token] = id
+	}
+	data, err := json.Marshal(ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(encoder, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(vocab, []byte(merges), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return vocab, encoder
+}
+
+const testGPT2Merges = "#version: 0.2\nh e\nl l\nhe ll\nhell o\nĠ w\no r\nĠw or\nl d\nĠwor ld\n"
+
+func TestGPT2Tokenizer(t *testing.T) {
+	tok, err := loadGPT2Tokenizer(writeGPT2Files(t, testGPT2Merges))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello", 1},
+		{"hello world", 2},
+		{"hell", 1},
+		{"world", 3},
+	}
+	for _, tt := range tests {
+		if got, err := tok.Count(tt.text); err != nil || got != tt.want {
+			t.Errorf("Count(%q) = %d, %v, want %d", tt.text, got, err, tt.want)
+		}
+	}
+
+	// CRLF line endings and no #version line parse the same
+	crlf, err := loadGPT2Tokenizer(writeGPT2Files(t, strings.ReplaceAll(strings.TrimPrefix(testGPT2Merges, "#version: 0.2\n"), "\n", "\r\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := crlf.Count("hello world"); got != 2 {
+		t.Errorf("Count with CRLF merges = %d, want 2", got)
+	}
+}
+
+func TestGPT2TokenizerErrors(t *testing.T) {
+	vocab, encoder := writeGPT2Files(t, testGPT2Merges)
+	badMerges, _ := writeGPT2Files(t, "#version: 0.2\nh e\nhello\n")
+	badEncoder := filepath.Join(t.TempDir(), "encoder.json")
+	if err := os.WriteFile(badEncoder, []byte("[1, 2]"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	tests := []struct {
+		name           string
+		vocab, encoder string
+		want           string
+	}{
+		{"invalid merge", badMerges, encoder, `invalid merge "hello" on line 3`},
+		{"encoder not a map", vocab, badEncoder, "error parsing " + badEncoder},
+		{"missing encoder", vocab, missing, "no such file"},
+		{"missing vocab", missing, encoder, "no such file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadGPT2Tokenizer(tt.vocab, tt.encoder); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("loadGPT2Tokenizer error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBPEFlags(t *testing.T) {
+	vocab, encoder := writeGPT2Files(t, testGPT2Merges)
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"both files", []string{"-bpe-vocab", vocab, "-bpe-encoder", encoder}, ""},
+		{"vocab alone", []string{"-bpe-vocab", vocab}, "-bpe-vocab and -bpe-encoder must be given together"},
+		{"with a tokenizer file", []string{"-bpe-vocab", vocab, "-bpe-encoder", encoder, "-tokenizer-file", "tokenizer.json"}, "-tokenizer-file can't be used with -bpe-vocab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := testOptions(t, tt.args...)
+			tok, err := newCodec(options)
+			if tt.want != "" {
+				if err == nil || err.Error() != tt.want {
+					t.Errorf("newCodec error = %v, want %q", err, tt.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n, _ := tok.Count("hello world"); n != 2 || options.modelName() != "vocab.bpe" {
+				t.Errorf("counted %d with model %q", n, options.modelName())
+			}
+		})
+	}
+}
@@ -0,0 +1,531 @@
+package main
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bucketURLPattern matches s3://bucket/prefix and gs://bucket/prefix URLs
+var bucketURLPattern = regexp.MustCompile(`^(s3|gs)://([^/]+)/?(.*)$`)
+
+// bucketDownloads is the number of objects downloaded at once
+const bucketDownloads = 8
+
+// emptySHA256 is the SHA-256 of an empty request body, for SigV4
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// bucketObject is an object listed under a bucket prefix
+type bucketObject struct {
+	Key  string
+	Size int64
+}
+
+// bucketClient lists and downloads the objects of a storage bucket
+type bucketClient interface {
+	list(prefix string) ([]bucketObject, error)
+	open(key string) (io.ReadCloser, error)
+}
+
+// isBucketURL reports whether path refers to an S3 or GCS bucket prefix
+func isBucketURL(path string) bool {
+	return bucketURLPattern.MatchString(path)
+}
+
+// fetchBucket downloads the objects under an s3:// or gs:// prefix into a
+// temporary directory, mirroring their keys below the prefix as paths, and
+// returns the directory, where each subprefix is a subdirectory. Objects the
+// scan would skip by their key or size alone (pruned, hidden, too deep, not
+// selected by -include, of a skipped extension or above -max-file-bytes) are
+// never downloaded; .gitignore and .tokenignore objects always are, so the
+// scan of the directory applies them. The directory is removed when the
+// program exits.
+func fetchBucket(bucketURL string, options *CommandOptions) (string, error) {
+	m := bucketURLPattern.FindStringSubmatch(bucketURL)
+	if m == nil {
+		return "", fmt.Errorf("not a bucket URL: %s", bucketURL)
+	}
+	scheme, bucket, prefix := m[1], m[2], m[3]
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	var client bucketClient
+	var err error
+	if scheme == "s3" {
+		client, err = newS3Client(bucket)
+	} else {
+		client, err = newGCSClient(bucket)
+	}
+	if err != nil {
+		return "", err
+	}
+	objects, err := client.list(prefix)
+	if err != nil {
+		return "", fmt.Errorf("error listing %s: %v", bucketURL, err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "token-counter-")
+	if err != nil {
+		return "", err
+	}
+	atExit(func() { os.RemoveAll(tmpDir) })
+	// Name the directory after the bucket and prefix, as the report shows it
+	dir := filepath.Join(tmpDir, bucket, filepath.FromSlash(prefix))
+	if !strings.HasPrefix(dir, filepath.Join(tmpDir, bucket)) {
+		return "", fmt.Errorf("invalid prefix in %s", bucketURL)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	var wanted []bucketObject
+	for _, object := range objects {
+		rel := strings.TrimPrefix(object.Key, prefix)
+		if rel == "" || strings.HasSuffix(rel, "/") {
+			continue // Folder placeholders
+		}
+		target := filepath.Join(dir, filepath.FromSlash(rel))
+		if !strings.HasPrefix(target, dir+string(os.PathSeparator)) || path.Clean(rel) != rel {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s, whose key isn't a valid path\n", object.Key)
+			continue
+		}
+		if reason, detail := skipObject(rel, object.Size, options); reason != "" {
+			logSkip(options, target, false, reason, detail)
+			continue
+		}
+		wanted = append(wanted, bucketObject{rel, object.Size})
+	}
+	if !options.Quiet {
+		logger.Info("downloading objects", "url", bucketURL, "objects", len(wanted), "listed", len(objects))
+	}
+
+	// Download the objects bucketDownloads at a time, stopping at the first error
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	queue := make(chan bucketObject)
+	for range bucketDownloads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for object := range queue {
+				if err := downloadObject(client, prefix+object.Key, filepath.Join(dir, filepath.FromSlash(object.Key))); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = fmt.Errorf("error downloading %s%s: %v", strings.TrimSuffix(bucketURL, "/")+"/", object.Key, err)
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, object := range wanted {
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			break
+		}
+		queue <- object
+	}
+	close(queue)
+	wg.Wait()
+	if firstErr != nil {
+		return "", firstErr
+	}
+	return dir, nil
+}
+
+// skipObject returns why a scan would skip the object at rel, a slash path
+// below the prefix, by its key and size alone, or "" to download it
+func skipObject(rel string, size int64, options *CommandOptions) (reason string, detail string) {
+	name := path.Base(rel)
+	if name == ".gitignore" || name == ".tokenignore" {
+		return "", ""
+	}
+	dirs := strings.Split(rel, "/")
+	dirs = dirs[:len(dirs)-1]
+	for i := range dirs {
+		if options.prunes(strings.Join(dirs[:i+1], "/")) {
+			return "pruned", ""
+		}
+		if options.IgnoreHidden && strings.HasPrefix(dirs[i], ".") {
+			return "hidden", ""
+		}
+	}
+	if options.MaxDepth > 0 && len(dirs) >= options.MaxDepth {
+		return "max-depth", "below -max-depth"
+	}
+	if options.IgnoreHidden && strings.HasPrefix(name, ".") {
+		return "hidden", ""
+	}
+	if options.includer != nil && !options.includer.MatchesPath(rel) {
+		return "include", "not matched by -include"
+	}
+	ext := strings.ToLower(path.Ext(name))
+	if !(options.Images && imageExts[ext]) && !(options.Archives && archiveKind(name) != "") && options.skipsExtension(ext) {
+		return "extension", "unsupported file type"
+	}
+	if options.MaxFileBytes > 0 && size > options.MaxFileBytes {
+		return "size", fmt.Sprintf("%d bytes is above -max-file-bytes", size)
+	}
+	return "", ""
+}
+
+// downloadObject streams an object into the file at target
+func downloadObject(client bucketClient, key string, target string) error {
+	body, err := client.open(key)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, body); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// bucketGet sends a GET request and returns the response body, or an error
+// with the start of the body if the response isn't 200 OK
+func bucketGet(req *http.Request) (io.ReadCloser, error) {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("unexpected response %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return resp.Body, nil
+}
+
+// s3Client talks to the S3 REST API, or any S3-compatible one set with
+// AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL, signing requests with Signature
+// Version 4 when credentials are found and sending them anonymously, for
+// public buckets, when they aren't
+type s3Client struct {
+	bucket       string
+	region       string
+	endpoint     *url.URL // Scheme and host of the API
+	pathStyle    bool     // Put the bucket in the path rather than the host name
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// newS3Client returns a client for an S3 bucket, with the credentials and
+// region of the environment, or of the AWS_PROFILE (or default) profile of
+// ~/.aws/credentials
+func newS3Client(bucket string) (*s3Client, error) {
+	c := &s3Client{
+		bucket:       bucket,
+		region:       os.Getenv("AWS_REGION"),
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if c.region == "" {
+		c.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if c.region == "" {
+		c.region = "us-east-1"
+	}
+	if c.accessKey == "" {
+		c.loadSharedCredentials()
+	}
+
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_S3")
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	if endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid S3 endpoint %q", endpoint)
+		}
+		c.endpoint, c.pathStyle = &url.URL{Scheme: u.Scheme, Host: u.Host}, true
+	} else {
+		// Bucket names with dots don't match the wildcard certificate
+		c.pathStyle = strings.Contains(bucket, ".")
+		c.endpoint = &url.URL{Scheme: "https", Host: "s3." + c.region + ".amazonaws.com"}
+	}
+	return c, nil
+}
+
+// loadSharedCredentials reads the keys of the AWS_PROFILE profile, or the
+// default one, from the shared credentials file
+func (c *s3Client) loadSharedCredentials() {
+	file := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if file == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return
+		}
+		file = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || section != profile {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "aws_access_key_id":
+			c.accessKey = strings.TrimSpace(value)
+		case "aws_secret_access_key":
+			c.secretKey = strings.TrimSpace(value)
+		case "aws_session_token":
+			c.sessionToken = strings.TrimSpace(value)
+		}
+	}
+}
+
+// list lists the objects under prefix with ListObjectsV2, a page at a time
+func (c *s3Client) list(prefix string) ([]bucketObject, error) {
+	var objects []bucketObject
+	token := ""
+	for {
+		query := map[string]string{"list-type": "2", "prefix": prefix}
+		if token != "" {
+			query["continuation-token"] = token
+		}
+		body, err := c.get("", query)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Contents []struct {
+				Key  string
+				Size int64
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(body).Decode(&page)
+		body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range page.Contents {
+			objects = append(objects, bucketObject{object.Key, object.Size})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// open downloads an object
+func (c *s3Client) open(key string) (io.ReadCloser, error) {
+	return c.get(key, nil)
+}
+
+// get sends a signed GET request for an object key, or for the bucket if key
+// is empty
+func (c *s3Client) get(key string, query map[string]string) (io.ReadCloser, error) {
+	host, uri := c.bucket+"."+c.endpoint.Host, "/"+awsEscape(key, false)
+	if c.pathStyle {
+		host, uri = c.endpoint.Host, "/"+c.bucket+"/"+awsEscape(key, false)
+	}
+	var params []string
+	for name, value := range query {
+		params = append(params, awsEscape(name, true)+"="+awsEscape(value, true))
+	}
+	sort.Strings(params)
+	rawQuery := strings.Join(params, "&")
+
+	target := c.endpoint.Scheme + "://" + host + uri
+	if rawQuery != "" {
+		target += "?" + rawQuery
+	}
+	req, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.accessKey != "" {
+		c.sign(req, host, uri, rawQuery, time.Now().UTC())
+	}
+	return bucketGet(req)
+}
+
+// sign adds a Signature Version 4 Authorization header to a request without
+// a body, see https://docs.aws.amazon.com/IAM/latest/UserGuide/reference_sigv-create-signed-request.html
+func (c *s3Client) sign(req *http.Request, host string, uri string, rawQuery string, now time.Time) {
+	amzDate, date := now.Format("20060102T150405Z"), now.Format("20060102")
+	headers := map[string]string{"host": host, "x-amz-content-sha256": emptySHA256, "x-amz-date": amzDate}
+	if c.sessionToken != "" {
+		headers["x-amz-security-token"] = c.sessionToken
+	}
+	names := sortedKeys(headers)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+		if name != "host" {
+			req.Header.Set(name, headers[name])
+		}
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{"GET", uri, rawQuery, canonicalHeaders.String(), signedHeaders, emptySHA256}, "\n")
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + c.secretKey)
+	for _, part := range []string{date, c.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", c.accessKey, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsEscape percent-encodes everything but the unreserved characters, the
+// way SigV4 expects, leaving slashes alone unless escapeSlash is set
+func awsEscape(s string, escapeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if 'A' <= ch && ch <= 'Z' || 'a' <= ch && ch <= 'z' || '0' <= ch && ch <= '9' || strings.IndexByte("-._~", ch) >= 0 || ch == '/' && !escapeSlash {
+			b.WriteByte(ch)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+// gcsClient talks to the Cloud Storage JSON API, or to an emulator set with
+// STORAGE_EMULATOR_HOST, with an access token from GOOGLE_OAUTH_ACCESS_TOKEN
+// or gcloud when it's installed, and anonymously, for public buckets,
+// otherwise
+type gcsClient struct {
+	bucket   string
+	endpoint string
+	token    string
+}
+
+// newGCSClient returns a client for a Cloud Storage bucket
+func newGCSClient(bucket string) (*gcsClient, error) {
+	c := &gcsClient{bucket: bucket, endpoint: "https://storage.googleapis.com", token: os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")}
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		c.endpoint = strings.TrimSuffix(host, "/")
+		if !strings.Contains(c.endpoint, "://") {
+			c.endpoint = "http://" + c.endpoint
+		}
+		return c, nil
+	}
+	if c.token == "" {
+		if _, err := exec.LookPath("gcloud"); err == nil {
+			out, err := exec.Command("gcloud", "auth", "print-access-token").Output()
+			if err != nil {
+				return nil, fmt.Errorf("error getting an access token from gcloud: %v", err)
+			}
+			c.token = strings.TrimSpace(string(out))
+		}
+	}
+	return c, nil
+}
+
+// list lists the objects under prefix, a page at a time
+func (c *gcsClient) list(prefix string) ([]bucketObject, error) {
+	var objects []bucketObject
+	token := ""
+	for {
+		query := url.Values{"prefix": {prefix}, "fields": {"items(name,size),nextPageToken"}}
+		if token != "" {
+			query.Set("pageToken", token)
+		}
+		body, err := c.get(c.endpoint + "/storage/v1/b/" + url.PathEscape(c.bucket) + "/o?" + query.Encode())
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Items []struct {
+				Name string `json:"name"`
+				Size string `json:"size"` // A decimal string, as it's a uint64
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		err = json.NewDecoder(body).Decode(&page)
+		body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range page.Items {
+			var size int64
+			fmt.Sscan(item.Size, &size)
+			objects = append(objects, bucketObject{item.Name, size})
+		}
+		if page.NextPageToken == "" {
+			return objects, nil
+		}
+		token = page.NextPageToken
+	}
+}
+
+// open downloads an object
+func (c *gcsClient) open(key string) (io.ReadCloser, error) {
+	return c.get(c.endpoint + "/storage/v1/b/" + url.PathEscape(c.bucket) + "/o/" + url.PathEscape(key) + "?alt=media")
+}
+
+// get sends a GET request with the access token, if there is one
+func (c *gcsClient) get(target string) (io.ReadCloser, error) {
+	req, err := http.NewRequest("GET", target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return bucketGet(req)
+}
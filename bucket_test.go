@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// bucketObjects are the objects of the test buckets, under the prefix
+// data/, with a folder placeholder, a hidden file, an image and a key that
+// would escape the download directory
+var bucketObjects = map[string]string{
+	"data/":              "",
+	"data/a.txt":         "hello world",
+	"data/sub/b.md":      "one two three",
+	"data/.hidden":       "secret",
+	"data/.gitignore":    "b.md\n",
+	"data/logo.png":      "not an image",
+	"data/../escape.txt": "outside",
+	"other/c.txt":        "not under the prefix",
+}
+
+// downloadedFiles returns the files under dir by slash path
+func downloadedFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, relativeTo(dir, path))
+		}
+		return nil
+	})
+	return files
+}
+
+func TestFetchBucketGCS(t *testing.T) {
+	t.Cleanup(runExitHooks)
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if r.URL.Query().Get("alt") == "media" {
+			key := strings.TrimPrefix(r.URL.Path, "/storage/v1/b/docs/o/")
+			if body, ok := bucketObjects[key]; ok {
+				fmt.Fprint(w, body)
+				return
+			}
+			http.NotFound(w, r)
+			return
+		}
+		// List a page of one object at a time
+		var names []string
+		for key := range bucketObjects {
+			if strings.HasPrefix(key, r.URL.Query().Get("prefix")) {
+				names = append(names, key)
+			}
+		}
+		sort.Strings(names)
+		page := 0
+		fmt.Sscan(r.URL.Query().Get("pageToken"), &page)
+		items := []map[string]string{{"name": names[page], "size": fmt.Sprint(len(bucketObjects[names[page]]))}}
+		next := ""
+		if page+1 < len(names) {
+			next = fmt.Sprint(page + 1)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"items": items, "nextPageToken": next})
+	}))
+	defer srv.Close()
+	t.Setenv("STORAGE_EMULATOR_HOST", strings.TrimPrefix(srv.URL, "http://"))
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "token")
+
+	options := testOptions(t, "-quiet")
+	var dir string
+	var err error
+	stderr := captureStderr(t, func() { dir, err = fetchBucket("gs://docs/data", options) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(downloadedFiles(t, dir), ","), ".gitignore,a.txt,sub/b.md"; got != want {
+		t.Errorf("downloaded %s, want %s", got, want)
+	}
+	if filepath.Base(dir) != "data" || filepath.Base(filepath.Dir(dir)) != "docs" {
+		t.Errorf("downloaded into %s, want a directory named after the bucket and prefix", dir)
+	}
+	if !strings.Contains(stderr, "Warning: skipping data/../escape.txt, whose key isn't a valid path") {
+		t.Errorf("no warning for the escaping key: %q", stderr)
+	}
+	if auth != "Bearer token" {
+		t.Errorf("Authorization %q", auth)
+	}
+
+	// The scan of the directory applies the downloaded .gitignore
+	repo, _ := scanTree(t, dir, "-model", "cl100k_base")
+	if got := countedPaths(dir, repo); strings.Join(got, ",") != "a.txt" {
+		t.Errorf("scan of the bucket counted %v", got)
+	}
+}
+
+func TestFetchBucketS3(t *testing.T) {
+	t.Cleanup(runExitHooks)
+	tests := []struct {
+		name      string
+		accessKey string
+		signed    bool
+	}{
+		{"signed", "AKID", true},
+		{"anonymous", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var auths []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				auths = append(auths, r.Header.Get("Authorization"))
+				if r.URL.Query().Get("list-type") == "2" {
+					if r.URL.Path != "/logs/" {
+						t.Errorf("listed %s, want the bucket in the path", r.URL.Path)
+					}
+					// Two pages, the second after the continuation token
+					if r.URL.Query().Get("continuation-token") == "" {
+						fmt.Fprint(w, `<ListBucketResult><Contents><Key>data/a.txt</Key><Size>11</Size></Contents><IsTruncated>true</IsTruncated><NextContinuationToken>next</NextContinuationToken></ListBucketResult>`)
+						return
+					}
+					fmt.Fprint(w, `<ListBucketResult><Contents><Key>data/sub/b.md</Key><Size>13</Size></Contents><IsTruncated>false</IsTruncated></ListBucketResult>`)
+					return
+				}
+				fmt.Fprint(w, bucketObjects[strings.TrimPrefix(r.URL.Path, "/logs/")])
+			}))
+			defer srv.Close()
+			t.Setenv("AWS_ENDPOINT_URL_S3", srv.URL)
+			t.Setenv("AWS_ACCESS_KEY_ID", tt.accessKey)
+			t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+			t.Setenv("AWS_REGION", "eu-west-1")
+			t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "none"))
+
+			dir, err := fetchBucket("s3://logs/data/", testOptions(t, "-quiet"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(downloadedFiles(t, dir), ","); got != "a.txt,sub/b.md" {
+				t.Errorf("downloaded %s", got)
+			}
+			for _, auth := range auths {
+				if signed := strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") && strings.Contains(auth, "/eu-west-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature="); signed != tt.signed {
+					t.Errorf("Authorization %q", auth)
+				}
+			}
+		})
+	}
+}
+
+func TestFetchBucketErrors(t *testing.T) {
+	t.Cleanup(runExitHooks)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("list-type") == "2" {
+			fmt.Fprint(w, `<ListBucketResult><Contents><Key>a.txt</Key><Size>1</Size></Contents></ListBucketResult>`)
+			return
+		}
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+	}))
+	defer srv.Close()
+	t.Setenv("AWS_ENDPOINT_URL_S3", srv.URL)
+
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{"download", "s3://logs", "error downloading s3://logs/a.txt: unexpected response 403 Forbidden: AccessDenied"},
+		{"not a bucket", "ftp://logs", "not a bucket URL: ftp://logs"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := fetchBucket(tt.url, testOptions(t, "-quiet")); err == nil || err.Error() != tt.want {
+				t.Errorf("fetchBucket error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	t.Setenv("AWS_ENDPOINT_URL_S3", "not a url")
+	if _, err := fetchBucket("s3://logs", testOptions(t, "-quiet")); err == nil || !strings.Contains(err.Error(), "invalid S3 endpoint") {
+		t.Errorf("invalid endpoint: %v", err)
+	}
+}
+
+func TestSkipObject(t *testing.T) {
+	tests := []struct {
+		rel    string
+		size   int64
+		args   []string
+		reason string
+	}{
+		{"a.txt", 10, nil, ""},
+		{"sub/.gitignore", 10, nil, ""},
+		{".config/a.txt", 10, nil, "hidden"},
+		{"node_modules/x/a.js", 10, []string{"-prune", "node_modules"}, "pruned"},
+		{"a/b/c.txt", 10, []string{"-max-depth", "2"}, "max-depth"},
+		{"a.go", 10, []string{"-include", "*.md"}, "include"},
+		{"logo.png", 10, nil, "extension"},
+		{"docs.zip", 10, nil, "extension"},
+		{"docs.zip", 10, []string{"-archives"}, ""},
+		{"big.txt", 2048, []string{"-max-file-bytes", "1K"}, "size"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.rel, func(t *testing.T) {
+			if reason, _ := skipObject(tt.rel, tt.size, testOptions(t, tt.args...)); reason != tt.reason {
+				t.Errorf("skipObject(%q) = %q, want %q", tt.rel, reason, tt.reason)
+			}
+		})
+	}
+}
+
+func TestAWSEscape(t *testing.T) {
+	tests := []struct {
+		s           string
+		escapeSlash bool
+		want        string
+	}{
+		{"data/a b.txt", false, "data/a%20b.txt"},
+		{"data/a b.txt", true, "data%2Fa%20b.txt"},
+		{"~user-name_1.txt", false, "~user-name_1.txt"},
+		{"ü+=", false, "%C3%BC%2B%3D"},
+	}
+	for _, tt := range tests {
+		if got := awsEscape(tt.s, tt.escapeSlash); got != tt.want {
+			t.Errorf("awsEscape(%q, %v) = %q, want %q", tt.s, tt.escapeSlash, got, tt.want)
+		}
+	}
+}
+
+func TestS3SharedCredentials(t *testing.T) {
+	credentials := filepath.Join(t.TempDir(), "credentials")
+	if err := os.WriteFile(credentials, []byte("[default]\naws_access_key_id = DEFAULT\n\n[work]\naws_access_key_id = WORK\naws_secret_access_key = s3cret\naws_session_token = session\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentials)
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	t.Setenv("AWS_ENDPOINT_URL_S3", "")
+	t.Setenv("AWS_ENDPOINT_URL", "")
+
+	tests := []struct {
+		profile string
+		key     string
+		secret  string
+	}{
+		{"", "DEFAULT", ""},
+		{"work", "WORK", "s3cret"},
+		{"missing", "", ""},
+	}
+	for _, tt := range tests {
+		t.Setenv("AWS_PROFILE", tt.profile)
+		c, err := newS3Client("my.bucket")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.accessKey != tt.key || c.secretKey != tt.secret {
+			t.Errorf("profile %q: keys %q, %q", tt.profile, c.accessKey, c.secretKey)
+		}
+		if c.region != "us-east-1" || !c.pathStyle || c.endpoint.Host != "s3.us-east-1.amazonaws.com" {
+			t.Errorf("client %+v, want path-style requests to us-east-1 for a bucket with dots", c)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// cachedFile is the count of a file with the stamp it had when it was read,
+// in the scan cache and in the answers of an index to scan -cached
+type cachedFile struct {
+	Path    string         `json:"path"` // Relative to the root, with slashes
+	ModTime int64          `json:"mod_time"`
+	Size    int64          `json:"size"`
+	Info    *FileTokenInfo `json:"info"`
+}
+
+// cachedError is a file an index couldn't count
+type cachedError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// scanCacheFile is the scan cache of a directory, as it's stored on disk
+type scanCacheFile struct {
+	Root     string        `json:"root"`
+	Settings string        `json:"settings"`
+	Files    []*cachedFile `json:"files"`
+}
+
+// newCachedFile records a counted file relative to root, without the
+// metadata added for the reports
+func newCachedFile(root string, fileInfo *FileTokenInfo) *cachedFile {
+	info := *fileInfo
+	info.ModTime, info.LastAuthor, info.LastCommitTime = time.Time{}, "", time.Time{}
+	return &cachedFile{
+		Path:    relativeTo(root, fileInfo.Path),
+		ModTime: fileInfo.stamp.modTime,
+		Size:    fileInfo.stamp.size,
+		Info:    &info,
+	}
+}
+
+// countCache holds the counts a -cached scan can reuse, by the path the scan
+// finds the file at, and records the counts of the scan to save for the next
+// one. A nil cache counts every file. It's safe for concurrent use.
+type countCache struct {
+	mu       sync.Mutex
+	root     string // The scan root, as the scan's paths start
+	settings string
+	file     string // Where the cache is saved
+	entries  map[string]*cachedFile
+	counted  []*cachedFile // The counts of this scan, found or made
+	hits     int
+
+	saveMu     sync.Mutex    // Held while the cache is written
+	checkpoint time.Duration // How often the counts are saved during the scan, for -resume (never if 0)
+	saved      time.Time     // When they were last saved
+}
+
+// countSettings returns a key of the settings a file's count depends on,
+// so counts made with other settings aren't reused. The version is part of
+// it, since a new release can count differently.
+func countSettings(options *CommandOptions) string {
+	return settingsKey(struct {
+		Version    string
+		Model      string
+		Models     []string
+		Tokenizer  []string
+		CountMode  string
+		ChatFormat string
+		View       string
+		Strip      []string
+		Segments   bool
+		Head, Tail int
+		Special    interface{}
+		Routes     []ModelRoute
+	}{toolVersion(), options.modelName(), options.Models, []string{options.TokenizerFile, options.BPEVocab, options.BPEEncoder},
+		options.CountMode, options.ChatFormat, options.View, options.Strip, options.Segments,
+		options.HeadTokens, options.TailTokens, specialSettings, options.routes})
+}
+
+// scanSettings returns a key of the settings of a whole scan: those of the
+// counts and those selecting the files, so an index answers a scan for it
+// only if it counted the same files the same way
+func scanSettings(options *CommandOptions) string {
+	return settingsKey(struct {
+		Count          string
+		Gitignore      bool
+		Hidden         bool
+		Min            int
+		FilterTotals   bool
+		Archives       bool
+		MaxDepth       int
+		Prune, Include []string
+		SkipAttributes []string
+		Generated      bool
+		SkipExts       []string
+		TextExts       []string
+		Submodules     bool
+		Symlinks       bool
+		Dedupe         bool
+		MaxFileBytes   int64
+	}{countSettings(options), options.RespectGitignore, options.IgnoreHidden, options.MinTokens, options.FilterAffectsTotals,
+		options.Archives, options.MaxDepth, options.Prune, options.Include, options.SkipAttributes, options.ExcludeGenerated, options.SkipExts, options.TextExts, options.Submodules, options.FollowSymlinks,
+		options.Dedupe, options.MaxFileBytes})
+}
+
+// settingsKey hashes the JSON of a set of settings
+func settingsKey(settings interface{}) string {
+	data, _ := json.Marshal(settings)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16])
+}
+
+// scanCachePath returns the file the scan cache of root is kept in, under
+// the user's cache directory, named after the root and the settings
+func scanCachePath(root string, settings string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(root + "\x00" + settings))
+	return filepath.Join(dir, "token-counter", "scans", hex.EncodeToString(sum[:16])+".json"), nil
+}
+
+// loadCountCache reads the scan cache of the options' path, if there is one.
+// The cache is only an optimization, so one that can't be read is ignored.
+func loadCountCache(options *CommandOptions) *countCache {
+	return openCountCache(options, scanCachePath)
+}
+
+// openCountCache reads the counts saved for the options' path in the file
+// named by name, from the absolute root and the settings of the counts, if
+// there are any, and saves them there
+func openCountCache(options *CommandOptions, name func(root string, settings string) (string, error)) *countCache {
+	cache := &countCache{root: options.Path, settings: countSettings(options), entries: make(map[string]*cachedFile), saved: time.Now()}
+	root, err := filepath.Abs(options.Path)
+	if err != nil {
+		return cache
+	}
+	path, err := name(root, cache.settings)
+	if err != nil {
+		return cache
+	}
+	cache.file = path
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cache
+	}
+	var stored scanCacheFile
+	if err := json.Unmarshal(data, &stored); err != nil || stored.Root != root || stored.Settings != cache.settings {
+		logger.Debug("ignoring the scan cache", "path", path, "err", err)
+		return cache
+	}
+	cache.add(stored.Files)
+	return cache
+}
+
+// add makes files, relative to the root, available to the scan
+func (c *countCache) add(files []*cachedFile) {
+	for _, file := range files {
+		if file.Info != nil {
+			c.entries[filepath.Join(c.root, filepath.FromSlash(file.Path))] = file
+		}
+	}
+}
+
+// lookup returns the cached count of the file at path if the file is
+// unchanged since, by its modification time and size
+func (c *countCache) lookup(path string) *FileTokenInfo {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	entry := c.entries[path]
+	c.mu.Unlock()
+	if entry == nil {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil || info.ModTime().UnixNano() != entry.ModTime || info.Size() != entry.Size {
+		return nil
+	}
+
+	fileInfo := *entry.Info
+	fileInfo.Path = path
+	fileInfo.stamp = fileStamp{entry.ModTime, entry.Size}
+	c.mu.Lock()
+	c.hits++
+	c.counted = append(c.counted, entry)
+	c.mu.Unlock()
+	return &fileInfo
+}
+
+// store records the count of a file the scan counted
+func (c *countCache) store(fileInfo *FileTokenInfo) {
+	if c == nil || fileInfo.stamp == (fileStamp{}) {
+		return
+	}
+	entry := newCachedFile(c.root, fileInfo)
+	c.mu.Lock()
+	c.counted = append(c.counted, entry)
+	due := c.checkpoint > 0 && time.Since(c.saved) >= c.checkpoint
+	if due {
+		c.saved = time.Now()
+	}
+	c.mu.Unlock()
+	if due {
+		if err := c.save(); err != nil {
+			logger.Warn("not saving the checkpoint", "err", err)
+		} else {
+			logger.Debug("saved the checkpoint", "path", c.file, "files", len(c.counted))
+		}
+	}
+}
+
+// save writes the counts of the scan as the cache of the next one, which
+// drops the files that are gone
+func (c *countCache) save() error {
+	root, err := filepath.Abs(c.root)
+	if err != nil {
+		return err
+	}
+	if c.file == "" {
+		return errors.New("no cache directory")
+	}
+	path := c.file
+	c.saveMu.Lock()
+	defer c.saveMu.Unlock()
+	c.mu.Lock()
+	data, err := json.Marshal(&scanCacheFile{Root: root, Settings: c.settings, Files: c.counted})
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// Write to a temporary file first so concurrent scans never read half of
+	// the cache
+	tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// cachedScan scans the options' path for -cached. A running index of the
+// directory answers instantly when it counts the same files the same way and
+// could sync with its watcher, which guarantees it has every change.
+// Otherwise the directory is walked, and only the files whose modification
+// time or size changed since the last -cached scan, or since the index
+// counted them, are counted again.
+func cachedScan(ctx context.Context, options *CommandOptions) (*RepoTokenInfo, error) {
+	var index *IndexFiles
+	if socket, err := findIndexSocket(options.Path); err == nil {
+		result, err := callIndex(socket, "files", indexParams{Sync: true})
+		if err == nil {
+			index = &IndexFiles{}
+			err = json.Unmarshal(result, index)
+		}
+		if err != nil {
+			logger.Warn("not using the index", "socket", socket, "err", err)
+			index = nil
+		}
+	}
+
+	root, err := filepath.Abs(options.Path)
+	if err != nil {
+		return nil, err
+	}
+	if index != nil && index.Root == root && index.Fresh && index.Scan == scanSettings(options) {
+		if !options.Quiet {
+			logger.Info("answering from the index", "root", root)
+		}
+		return repoFromIndex(index, options)
+	}
+
+	cache := loadCountCache(options)
+	if index != nil && index.Settings == cache.settings {
+		// An index of a parent directory has the counts of this one too
+		if rel, err := filepath.Rel(index.Root, root); err == nil {
+			for _, files := range [][]*cachedFile{index.Files, index.BelowMin} {
+				for _, file := range files {
+					if relPath, err := filepath.Rel(rel, filepath.FromSlash(file.Path)); err == nil && filepath.IsLocal(relPath) {
+						moved := *file
+						moved.Path = filepath.ToSlash(relPath)
+						cache.add([]*cachedFile{&moved})
+					}
+				}
+			}
+		}
+		if !options.Quiet {
+			logger.Info("checking the index's counts by modification time", "root", index.Root, "fresh", index.Fresh)
+		}
+	}
+
+	options.cache = cache
+	repo, err := ProcessRepository(ctx, options.Path, options)
+	options.cache = nil
+	if err != nil {
+		return repo, err
+	}
+	logger.Debug("reused cached counts", "files", cache.hits)
+	if err := cache.save(); err != nil {
+		logger.Warn("not saving the scan cache", "err", err)
+	}
+	return repo, nil
+}
+
+// repoFromIndex builds the result of a scan from the files of an index,
+// passing them to OnFile as a scan would
+func repoFromIndex(index *IndexFiles, options *CommandOptions) (*RepoTokenInfo, error) {
+	repo := &RepoTokenInfo{Path: options.Path, Dirs: make(map[string]*DirTokenInfo)}
+	restore := func(file *cachedFile) *FileTokenInfo {
+		fileInfo := *file.Info
+		fileInfo.Path = filepath.Join(options.Path, filepath.FromSlash(file.Path))
+		fileInfo.stamp = fileStamp{file.ModTime, file.Size}
+		return &fileInfo
+	}
+	for _, file := range index.Files {
+		fileInfo := restore(file)
+		repo.addFile(fileInfo)
+		if options.OnFile != nil {
+			if err := options.OnFile(fileInfo); err != nil {
+				return repo, err
+			}
+		}
+		if options.DiscardFiles {
+			repo.discardFile(fileInfo)
+		}
+	}
+	for _, file := range index.BelowMin {
+		repo.addBelowMin(restore(file), !options.FilterAffectsTotals)
+	}
+	for _, fileErr := range index.Errors {
+		repo.Errors = append(repo.Errors, &FileError{filepath.Join(options.Path, filepath.FromSlash(fileErr.Path)), errors.New(fileErr.Error)})
+	}
+	return repo, nil
+}
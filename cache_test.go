@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// cachedTree scans dir with a count cache kept in file, saves it and
+// returns the scan and the cache
+func cachedTree(t *testing.T, dir string, file string, args ...string) (*RepoTokenInfo, *countCache) {
+	t.Helper()
+	options := testOptions(t, append(args, "-model", "cl100k_base")...)
+	options.Path = dir
+	cache := openCountCache(options, func(string, string) (string, error) { return file, nil })
+	options.cache = cache
+	repo, err := ProcessRepository(context.Background(), dir, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.save(); err != nil {
+		t.Fatal(err)
+	}
+	return repo, cache
+}
+
+func TestCountCache(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, dir string, file string)
+		args   []string
+		hits   int
+	}{
+		{"unchanged", func(*testing.T, string, string) {}, nil, 2},
+		{"modified file", func(t *testing.T, dir string, _ string) {
+			writeTree(t, dir, map[string]string{"a.txt": "hello there world"})
+		}, nil, 1},
+		{"deleted file", func(t *testing.T, dir string, _ string) {
+			os.Remove(filepath.Join(dir, "a.txt"))
+		}, nil, 1},
+		{"other settings", func(*testing.T, string, string) {}, []string{"-segments"}, 0},
+		{"corrupt cache", func(t *testing.T, _ string, file string) {
+			os.WriteFile(file, []byte("{"), 0o644)
+		}, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, map[string]string{"a.txt": "hello world", "sub/b.txt": "one two three"})
+			file := filepath.Join(t.TempDir(), "cache", "scan.json")
+			cachedTree(t, dir, file)
+
+			tt.change(t, dir, file)
+			repo, cache := cachedTree(t, dir, file, tt.args...)
+			if cache.hits != tt.hits {
+				t.Errorf("%d cached counts were reused, want %d", cache.hits, tt.hits)
+			}
+			fresh, _ := scanTree(t, dir, append(tt.args, "-model", "cl100k_base")...)
+			if repo.TokenCount != fresh.TokenCount || strings.Join(countedPaths(dir, repo), ",") != strings.Join(countedPaths(dir, fresh), ",") {
+				t.Errorf("cached scan counted %d in %v, want %d in %v", repo.TokenCount, countedPaths(dir, repo), fresh.TokenCount, countedPaths(dir, fresh))
+			}
+		})
+	}
+
+	cache := &countCache{root: t.TempDir()}
+	if err := cache.save(); err == nil || err.Error() != "no cache directory" {
+		t.Errorf("save without a cache file = %v", err)
+	}
+	var none *countCache
+	if none.lookup("a.txt") != nil {
+		t.Error("a nil cache found a count")
+	}
+}
+
+func TestCachedScan(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world", "sub/b.txt": "one two three"})
+	options := testOptions(t, "-model", "cl100k_base")
+	options.Path = dir
+	scan := func() *RepoTokenInfo {
+		t.Helper()
+		repo, err := cachedScan(context.Background(), options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repo
+	}
+	if repo := scan(); repo.TokenCount != 5 {
+		t.Errorf("first cached scan counted %d tokens, want 5", repo.TokenCount)
+	}
+
+	// The next scan takes the counts of unchanged files from the cache,
+	// even when they're wrong
+	file, err := scanCachePath(dir, countSettings(options))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored scanCacheFile
+	data, err := os.ReadFile(file)
+	if err != nil || json.Unmarshal(data, &stored) != nil || len(stored.Files) != 2 {
+		t.Fatalf("the scan cache has %s, %v", data, err)
+	}
+	for _, cached := range stored.Files {
+		if cached.Path == "a.txt" {
+			cached.Info.TokenCount = 100
+		}
+	}
+	data, _ = json.Marshal(&stored)
+	os.WriteFile(file, data, 0o644)
+	if repo := scan(); repo.TokenCount != 103 {
+		t.Errorf("second cached scan counted %d tokens, want 103 from the cache", repo.TokenCount)
+	}
+
+	// A running index of the directory answers
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		findCommand("index").run([]string{"start", "-quiet", "-model", "cl100k_base", dir})
+	}()
+	defer func() {
+		findCommand("index").run([]string{"stop", "-quiet", dir})
+		<-done
+	}()
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if result, err := callIndex(indexSocket(dir), "files", indexParams{Sync: true}); err == nil && strings.Contains(string(result), `"fresh":true`) {
+			break
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Fatal("the index didn't start")
+		}
+	}
+	writeTree(t, dir, map[string]string{"c.txt": "four"})
+	if repo := scan(); repo.TokenCount != 6 {
+		t.Errorf("cached scan with an index counted %d tokens, want the index's 6", repo.TokenCount)
+	}
+}
+
+func TestRepoFromIndex(t *testing.T) {
+	dir := t.TempDir()
+	index := &IndexFiles{
+		Files:    []*cachedFile{{Path: "a.txt", Info: &FileTokenInfo{TokenCount: 2}}, {Path: "sub/b.txt", Info: &FileTokenInfo{TokenCount: 3}}},
+		BelowMin: []*cachedFile{{Path: "c.txt", Info: &FileTokenInfo{TokenCount: 1}}},
+		Errors:   []*cachedError{{Path: "d.txt", Error: "permission denied"}},
+	}
+	options := testOptions(t)
+	options.Path = dir
+	var streamed []string
+	options.OnFile = func(fileInfo *FileTokenInfo) error {
+		streamed = append(streamed, relativeTo(dir, fileInfo.Path))
+		return nil
+	}
+	repo, err := repoFromIndex(index, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.TokenCount != 6 || len(streamed) != 2 || len(repo.BelowMin) != 1 || len(repo.Errors) != 1 || repo.Errors[0].Path != filepath.Join(dir, "d.txt") {
+		t.Errorf("repo of %d tokens, streamed %v, below min %v, errors %v", repo.TokenCount, streamed, repo.BelowMin, repo.Errors)
+	}
+
+	options.OnFile = func(*FileTokenInfo) error { return os.ErrClosed }
+	if _, err := repoFromIndex(index, options); err != os.ErrClosed {
+		t.Errorf("repoFromIndex = %v, want the error of OnFile", err)
+	}
+}
+
+func TestCachedScanErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world"})
+	stderr, code := exitStatus(t, func() { findCommand("scan").run([]string{"-cached", "-file", filepath.Join(dir, "a.txt")}) })
+	if code != 1 || !strings.Contains(stderr, "Error: -cached only applies to the scan of a directory") {
+		t.Errorf("exit %d, stderr:\n%s", code, stderr)
+	}
+}
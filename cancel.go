@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+)
+
+// commandContext returns the context of a command: it's canceled by the
+// first Ctrl-C, so a scan can stop and report what it counted so far, and
+// after -timeout if one is set. A second Ctrl-C kills the process as usual.
+func commandContext(options *CommandOptions) (context.Context, context.CancelFunc) {
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-sigCtx.Done()
+		stop()
+	}()
+	ctx, cancel := withTimeout(sigCtx, options)
+	return ctx, func() {
+		cancel()
+		stop()
+	}
+}
+
+// withTimeout bounds ctx by the -timeout of options
+func withTimeout(ctx context.Context, options *CommandOptions) (context.Context, context.CancelFunc) {
+	if options.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, options.Timeout)
+}
+
+// interrupted reports whether err is a scan stopped by Ctrl-C or -timeout
+func interrupted(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// interruptedError describes why a command stopped early, for commands that
+// can't use partial results
+func interruptedError(err error, options *CommandOptions) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s", options.Timeout)
+	}
+	return fmt.Errorf("interrupted")
+}
+
+// reportPartial prints the results a scan collected before it was stopped,
+// with a warning on stderr, and exits with 130 after Ctrl-C or 1 after a
+// timeout
+func reportPartial(repo *RepoTokenInfo, err error, options *CommandOptions, print func()) {
+	files := 0
+	for _, dirInfo := range repo.Dirs {
+		files += len(dirInfo.Files)
+	}
+	fmt.Fprintf(os.Stderr, "Warning: scan %v; showing partial results for the %d files counted so far\n", interruptedError(err, options), files)
+	print()
+	if errors.Is(err, context.DeadlineExceeded) {
+		exit(1)
+	}
+	exit(130)
+}
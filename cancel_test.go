@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCanceledScan(t *testing.T) {
+	dir := t.TempDir()
+	files := make(map[string]string)
+	for i := 0; i < 20; i++ {
+		files[fmt.Sprintf("f%02d.txt", i)] = "some words"
+	}
+	writeTree(t, dir, files)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	options := testOptions(t, "-model", "cl100k_base")
+	options.Path = dir
+	options.OnFile = func(*FileTokenInfo) error {
+		cancel()
+		return nil
+	}
+	repo, err := ProcessRepository(ctx, dir, options)
+	if !errors.Is(err, context.Canceled) || !interrupted(err) {
+		t.Fatalf("canceled scan returned %v, want context.Canceled", err)
+	}
+	if counted := len(countedPaths(dir, repo)); counted == 0 || counted == len(files) {
+		t.Errorf("canceled scan counted %d of %d files, want some", counted, len(files))
+	}
+
+	options.OnFile = nil
+	options.Timeout = time.Nanosecond
+	ctx, cancelTimeout := withTimeout(context.Background(), options)
+	defer cancelTimeout()
+	time.Sleep(time.Millisecond)
+	if _, err := ProcessRepository(ctx, dir, options); !errors.Is(err, context.DeadlineExceeded) || !interrupted(err) {
+		t.Errorf("timed out scan returned %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestInterruptedError(t *testing.T) {
+	options := &CommandOptions{Timeout: 30 * time.Second}
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{context.Canceled, "interrupted"},
+		{fmt.Errorf("walking: %w", context.DeadlineExceeded), "timed out after 30s"},
+	}
+	for _, tt := range tests {
+		if got := interruptedError(tt.err, options).Error(); got != tt.want {
+			t.Errorf("interruptedError(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+	if interrupted(errors.New("other")) {
+		t.Error("interrupted(other) = true")
+	}
+}
+
+func TestReportPartial(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code int
+		want string
+	}{
+		{"interrupted", context.Canceled, 130, "Warning: scan interrupted; showing partial results for the 1 files counted so far"},
+		{"timed out", context.DeadlineExceeded, 1, "Warning: scan timed out after 1s; showing partial results for the 1 files counted so far"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderr, code := exitStatus(t, func() {
+				repo := &RepoTokenInfo{Dirs: map[string]*DirTokenInfo{".": {Files: []*FileTokenInfo{{Path: "a"}}}}}
+				reportPartial(repo, tt.err, &CommandOptions{Timeout: time.Second}, func() { fmt.Fprintln(os.Stderr, "the report") })
+			})
+			if code != tt.code || !strings.Contains(stderr, tt.want+"\nthe report\n") {
+				t.Errorf("exit %d, stderr:\n%s", code, stderr)
+			}
+		})
+	}
+}
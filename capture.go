@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// maxCaptureName is the longest name, in bytes, of the file a captured
+// command's output is counted as
+const maxCaptureName = 100
+
+// captureCommand runs command with the shell, as -exec does, and returns a
+// temporary file holding what it wrote to stdout, named after the command
+// so the report shows which output it counted. Its stderr goes to ours. A
+// command that fails is an error, since its output is likely incomplete.
+func captureCommand(command string) (string, error) {
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+	cmd := exec.Command(shell, flag, command)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("error running %q: %v", command, err)
+	}
+	path, copyErr := writeCapture(command, stdout)
+	if copyErr != nil {
+		// Don't wait for a command blocked on writing what isn't read any more
+		cmd.Process.Kill()
+	}
+	if err := cmd.Wait(); err != nil && copyErr == nil {
+		return "", fmt.Errorf("error running %q: %v", command, err)
+	}
+	return path, copyErr
+}
+
+// capturePipe copies a named pipe, like the /dev/fd/63 of a process
+// substitution, to a temporary file, since a pipe can only be read once and
+// a file is read twice: to sniff its type, then to count it
+func capturePipe(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return writeCapture(filepath.Base(path), file)
+}
+
+// writeCapture writes r to a file named after name in a temporary directory
+// that's removed when the program exits, and returns its path
+func writeCapture(name string, r io.Reader) (string, error) {
+	tmpDir, err := os.MkdirTemp("", "token-counter-")
+	if err != nil {
+		return "", err
+	}
+	atExit(func() { os.RemoveAll(tmpDir) })
+	name = strings.Trim(unsafeNameChars.ReplaceAllString(name, "_"), "_.")
+	if len(name) > maxCaptureName {
+		name = name[:maxCaptureName]
+	}
+	if name == "" {
+		name = "output"
+	}
+	path := filepath.Join(tmpDir, name+".txt")
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return "", err
+	}
+	return path, file.Close()
+}
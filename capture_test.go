@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCaptureCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh to run commands with")
+	}
+	tests := []struct {
+		name    string
+		command string
+		file    string
+		content string
+		wantErr string
+	}{
+		{"output", "printf 'hello world'", "printf_hello_world.txt", "hello world", ""},
+		{"long command", "echo " + strings.Repeat("a", 200), "echo_" + strings.Repeat("a", maxCaptureName-5) + ".txt", strings.Repeat("a", 200) + "\n", ""},
+		{"no name", "  ", "output.txt", "", ""},
+		{"fails", "echo partial; exit 3", "", "", `error running "echo partial; exit 3": exit status 3`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := captureCommand(tt.command)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("captureCommand error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(filepath.Dir(path))
+			data, _ := os.ReadFile(path)
+			if filepath.Base(path) != tt.file || string(data) != tt.content {
+				t.Errorf("captured %q into %s, want %q into %s", data, filepath.Base(path), tt.content, tt.file)
+			}
+		})
+	}
+}
+
+func TestCapturePipe(t *testing.T) {
+	pipe := filepath.Join(t.TempDir(), "63")
+	if err := exec.Command("mkfifo", pipe).Run(); err != nil {
+		t.Skip("can't make a named pipe:", err)
+	}
+	go func() {
+		if file, err := os.OpenFile(pipe, os.O_WRONLY, 0); err == nil {
+			file.WriteString("hello world")
+			file.Close()
+		}
+	}()
+	path, err := capturePipe(pipe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(filepath.Dir(path))
+	if data, _ := os.ReadFile(path); filepath.Base(path) != "63.txt" || string(data) != "hello world" {
+		t.Errorf("captured %q into %s", data, path)
+	}
+
+	if _, err := capturePipe(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("capturing a missing pipe succeeded")
+	}
+}
+
+func TestExecCommand(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh to run commands with")
+	}
+	tests := []struct {
+		name string
+		args []string
+		code int
+		want string
+	}{
+		{"with a path", []string{"-exec", "echo hi", t.TempDir()}, 1, "Error: -exec counts the output of a command and can't be given a path"},
+		{"failing command", []string{"-exec", "exit 3"}, 1, `error running "exit 3": exit status 3`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderr, code := exitStatus(t, func() { findCommand("scan").run(tt.args) })
+			if code != tt.code || !strings.Contains(stderr, tt.want) {
+				t.Errorf("exit %d, stderr:\n%s\nwant exit %d with %q", code, stderr, tt.code, tt.want)
+			}
+		})
+	}
+	t.Run("output", func(t *testing.T) {
+		out := captureStdout(t, func() {
+			findCommand("scan").run([]string{"-exec", "printf 'hello world'", "-quiet", "-model", "cl100k_base"})
+		})
+		if out != "2\n" {
+			t.Errorf("scan -exec printed %q, want 2", out)
+		}
+	})
+}
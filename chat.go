@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// chatFormats are the chat payload formats -chat-format accepts
+var chatFormats = map[string]bool{"openai": true, "anthropic": true}
+
+// parseChatFormat validates the value of -chat-format
+func parseChatFormat(value string) (string, error) {
+	if !chatFormats[value] {
+		return "", fmt.Errorf("unknown chat format %q (expected openai or anthropic)", value)
+	}
+	return value, nil
+}
+
+// The per-message overhead of OpenAI's chat models: every message is wrapped
+// in a few tokens, a name costs one more, and every reply is primed with
+// three, as OpenAI's cookbook counts them
+const (
+	openAITokensPerMessage = 3
+	openAITokensPerName    = 1
+	openAIReplyPriming     = 3
+)
+
+// anthropicTurns are the turn markers Claude's prompts are framed with
+var anthropicTurns = map[string]string{"user": "\n\nHuman: ", "assistant": "\n\nAssistant: "}
+
+// chatMessage is a message of a conversation, reduced to what's counted
+type chatMessage struct {
+	Role string
+	Name string
+	Text []string // The text parts of the content, tool calls and results
+}
+
+// chatConversation is one request to a chat API
+type chatConversation struct {
+	System   []string
+	Messages []chatMessage
+}
+
+// parseChat reads the conversations of a .json or .jsonl chat payload: a
+// request with a messages array (and, for Anthropic, a system prompt), a bare
+// array of messages, or a JSON Lines file of requests or of the messages of a
+// single conversation. It returns false for what isn't one, which is counted
+// as it is.
+func parseChat(path string, text string) ([]chatConversation, bool) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		var payload interface{}
+		if err := json.Unmarshal([]byte(text), &payload); err != nil {
+			return nil, false
+		}
+		conversation, ok := chatPayload(payload)
+		if !ok {
+			return nil, false
+		}
+		return []chatConversation{conversation}, true
+	case ".jsonl":
+		var conversations []chatConversation
+		var loose chatConversation // Messages given one per line
+		scanner := bufio.NewScanner(strings.NewReader(text))
+		scanner.Buffer(make([]byte, 64*1024), len(text)+1)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			var payload interface{}
+			if err := json.Unmarshal([]byte(line), &payload); err != nil {
+				return nil, false
+			}
+			if object, ok := payload.(map[string]interface{}); ok && object["messages"] == nil {
+				message, ok := chatMessageOf(object)
+				if !ok {
+					return nil, false
+				}
+				loose.Messages = append(loose.Messages, message)
+				continue
+			}
+			conversation, ok := chatPayload(payload)
+			if !ok {
+				return nil, false
+			}
+			conversations = append(conversations, conversation)
+		}
+		if len(loose.Messages) > 0 {
+			conversations = append(conversations, loose)
+		}
+		return conversations, len(conversations) > 0
+	}
+	return nil, false
+}
+
+// chatPayload reads a request with a messages array, or a bare array of
+// messages
+func chatPayload(payload interface{}) (chatConversation, bool) {
+	var conversation chatConversation
+	messages, ok := payload.([]interface{})
+	if object, isObject := payload.(map[string]interface{}); isObject {
+		messages, ok = object["messages"].([]interface{})
+		conversation.System = chatText(object["system"])
+	}
+	if !ok || len(messages) == 0 {
+		return conversation, false
+	}
+	for _, item := range messages {
+		object, ok := item.(map[string]interface{})
+		if !ok {
+			return conversation, false
+		}
+		message, ok := chatMessageOf(object)
+		if !ok {
+			return conversation, false
+		}
+		conversation.Messages = append(conversation.Messages, message)
+	}
+	return conversation, true
+}
+
+// chatMessageOf reads a message object, which needs a role
+func chatMessageOf(object map[string]interface{}) (chatMessage, bool) {
+	role, ok := object["role"].(string)
+	if !ok {
+		return chatMessage{}, false
+	}
+	name, _ := object["name"].(string)
+	message := chatMessage{Role: role, Name: name, Text: chatText(object["content"])}
+	message.Text = append(message.Text, chatText(object["tool_calls"])...)
+	return message, true
+}
+
+// chatText collects the text the model reads from message content: a
+// string, or blocks of text, tool calls with their arguments and tool
+// results. Images and other media aren't text and are left out.
+func chatText(content interface{}) []string {
+	switch value := content.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		var texts []string
+		for _, item := range value {
+			texts = append(texts, chatText(item)...)
+		}
+		return texts
+	case map[string]interface{}:
+		var texts []string
+		if text, ok := value["text"].(string); ok {
+			texts = append(texts, text)
+		}
+		if name, ok := value["name"].(string); ok {
+			texts = append(texts, name)
+		}
+		if input, ok := value["input"]; ok {
+			if data, err := json.Marshal(input); err == nil {
+				texts = append(texts, string(data))
+			}
+		}
+		if arguments, ok := value["arguments"].(string); ok {
+			texts = append(texts, arguments)
+		}
+		texts = append(texts, chatText(value["function"])...)
+		return append(texts, chatText(value["content"])...)
+	}
+	return nil
+}
+
+// countChat counts conversations the way format's API bills them: the text
+// of every message plus the tokens each message and reply are wrapped in
+func countChat(conversations []chatConversation, enc namedCodec, format string) (int, error) {
+	total := 0
+	count := func(text string) error {
+		n, err := enc.Codec.Count(text)
+		total += n
+		return err
+	}
+	for _, conversation := range conversations {
+		for _, text := range conversation.System {
+			if err := count(text); err != nil {
+				return 0, err
+			}
+		}
+		for _, message := range conversation.Messages {
+			switch format {
+			case "openai":
+				total += openAITokensPerMessage
+				if err := count(message.Role); err != nil {
+					return 0, err
+				}
+				if message.Name != "" {
+					total += openAITokensPerName
+					if err := count(message.Name); err != nil {
+						return 0, err
+					}
+				}
+			case "anthropic":
+				if err := count(anthropicTurns[message.Role]); err != nil {
+					return 0, err
+				}
+			}
+			for _, text := range message.Text {
+				if err := count(text); err != nil {
+					return 0, err
+				}
+			}
+		}
+		switch format {
+		case "openai":
+			total += openAIReplyPriming
+		case "anthropic":
+			if err := count(strings.TrimSuffix(anthropicTurns["assistant"], " ")); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return total, nil
+}
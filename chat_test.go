@@ -0,0 +1,116 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseChat(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		text string
+		want []chatConversation // nil for what isn't a chat payload
+	}{
+		{"openai request", "chat.json", `{"model":"gpt-4o","messages":[{"role":"system","content":"Be brief."},{"role":"user","name":"ann","content":"hello"}]}`,
+			[]chatConversation{{Messages: []chatMessage{{Role: "system", Text: []string{"Be brief."}}, {Role: "user", Name: "ann", Text: []string{"hello"}}}}}},
+		{"bare messages", "chat.json", `[{"role":"user","content":"hello"}]`,
+			[]chatConversation{{Messages: []chatMessage{{Role: "user", Text: []string{"hello"}}}}}},
+		{"anthropic blocks", "chat.json", `{"system":"Be brief.","messages":[{"role":"user","content":[{"type":"text","text":"hi"},{"type":"image","source":{"data":"..."}}]},` +
+			`{"role":"assistant","content":[{"type":"tool_use","name":"add","input":{"a":1}}]}]}`,
+			[]chatConversation{{System: []string{"Be brief."}, Messages: []chatMessage{{Role: "user", Text: []string{"hi"}}, {Role: "assistant", Text: []string{"add", `{"a":1}`}}}}}},
+		{"openai tool calls", "chat.json", `[{"role":"assistant","content":null,"tool_calls":[{"function":{"name":"add","arguments":"{\"a\":1}"}}]}]`,
+			[]chatConversation{{Messages: []chatMessage{{Role: "assistant", Text: []string{"add", `{"a":1}`}}}}}},
+		{"jsonl requests", "chats.jsonl", "{\"messages\":[{\"role\":\"user\",\"content\":\"a\"}]}\n\n{\"messages\":[{\"role\":\"user\",\"content\":\"b\"}]}\n",
+			[]chatConversation{{Messages: []chatMessage{{Role: "user", Text: []string{"a"}}}}, {Messages: []chatMessage{{Role: "user", Text: []string{"b"}}}}}},
+		{"jsonl messages", "chat.JSONL", "{\"role\":\"user\",\"content\":\"a\"}\n{\"role\":\"assistant\",\"content\":\"b\"}\n",
+			[]chatConversation{{Messages: []chatMessage{{Role: "user", Text: []string{"a"}}, {Role: "assistant", Text: []string{"b"}}}}}},
+		{"not json", "chat.json", `{"messages":`, nil},
+		{"no messages", "package.json", `{"name":"app"}`, nil},
+		{"empty messages", "chat.json", `{"messages":[]}`, nil},
+		{"message without a role", "chat.json", `[{"content":"hello"}]`, nil},
+		{"jsonl line without a role", "chat.jsonl", "{\"role\":\"user\",\"content\":\"a\"}\n{\"event\":\"click\"}\n", nil},
+		{"empty jsonl", "chat.jsonl", "\n", nil},
+		{"other extension", "chat.txt", `[{"role":"user","content":"hello"}]`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseChat(tt.path, tt.text)
+			if ok != (tt.want != nil) || ok && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseChat = %+v, %v, want %+v", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountChat(t *testing.T) {
+	codec, err := codecForName("cl100k_base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := namedCodec{"cl100k_base", codec}
+	count := func(texts ...string) int {
+		total := 0
+		for _, text := range texts {
+			n, _ := codec.Count(text)
+			total += n
+		}
+		return total
+	}
+	hello := []chatConversation{{Messages: []chatMessage{{Role: "user", Text: []string{"hello"}}}}}
+	tests := []struct {
+		name          string
+		conversations []chatConversation
+		format        string
+		want          int
+	}{
+		// OpenAI's cookbook counts a lone "hello" from the user as 8 tokens
+		{"openai", hello, "openai", 8},
+		{"openai name", []chatConversation{{Messages: []chatMessage{{Role: "user", Name: "ann", Text: []string{"hello"}}}}}, "openai", 9 + count("ann")},
+		{"openai conversations", append(hello, hello...), "openai", 16},
+		{"anthropic", []chatConversation{{System: []string{"Be brief."}, Messages: hello[0].Messages}}, "anthropic",
+			count("Be brief.", "\n\nHuman: ", "hello", "\n\nAssistant:")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := countChat(tt.conversations, enc, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("countChat = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChatFormat(t *testing.T) {
+	dir := t.TempDir()
+	chat := `[{"role":"user","content":"hello"}]`
+	writeTree(t, dir, map[string]string{"chat.json": chat, "notes.json": `{"hello":1}`})
+	tests := []struct {
+		name string
+		args []string
+		want map[string]int
+	}{
+		{"openai", []string{"-chat-format", "openai"}, map[string]int{"chat.json": 8, "notes.json": 5}},
+		{"off", nil, map[string]int{"chat.json": 11, "notes.json": 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, _ := scanTree(t, dir, append(tt.args, "-model", "cl100k_base")...)
+			for _, dirInfo := range repo.Dirs {
+				for _, fileInfo := range dirInfo.Files {
+					if rel := relativeTo(dir, fileInfo.Path); fileInfo.TokenCount != tt.want[rel] {
+						t.Errorf("%s counts %d tokens, want %d", rel, fileInfo.TokenCount, tt.want[rel])
+					}
+				}
+			}
+		})
+	}
+
+	if _, err := parseChatFormat("gemini"); err == nil || !strings.Contains(err.Error(), `unknown chat format "gemini" (expected openai or anthropic)`) {
+		t.Errorf("parseChatFormat(gemini) = %v", err)
+	}
+}
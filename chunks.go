@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// chunkCount returns how many chunks of chunkSize units, each overlapping the
+// previous one by overlap units, are needed to cover a file of the given size
+func chunkCount(size int, chunkSize int, overlap int) int {
+	if size == 0 {
+		return 0
+	}
+	if size <= chunkSize {
+		return 1
+	}
+	stride := chunkSize - overlap
+	return 1 + (size-chunkSize+stride-1)/stride
+}
+
+// chunksCommand defines the chunks subcommand, which reports how many chunks
+// token-based splitting would produce per file and for the whole corpus
+func chunksCommand(fs *flag.FlagSet) func() {
+	options := &CommandOptions{}
+	var chunkSize, overlap int
+
+	registerFlags(fs, options)
+	registerWalkFlags(fs, options)
+	registerRevFlag(fs, options)
+	registerReportFlags(fs, options)
+	fs.IntVar(&chunkSize, "chunk-size", 8000, "Maximum number of tokens per chunk")
+	fs.IntVar(&overlap, "overlap", 0, "Number of tokens shared by consecutive chunks")
+	return func() {
+		if chunkSize <= 0 || overlap < 0 || overlap >= chunkSize {
+			fmt.Fprintln(os.Stderr, "Error: -chunk-size must be positive and -overlap must be between 0 and the chunk size")
+			exit(1)
+		}
+
+		if err := resolveTarget(fs, options); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		var repo *RepoTokenInfo
+		var err error
+		ctx, cancel := commandContext(options)
+		defer cancel()
+		if options.IsSingleFile {
+			repo, err = ProcessSingleFile(ctx, options.Path, options)
+		} else {
+			repo, err = ProcessRepository(ctx, options.Path, options)
+		}
+		if interrupted(err) && repo != nil {
+			reportPartial(repo, err, options, func() {
+				PrintChunks(repo, options, chunkSize, overlap)
+				PrintErrors(repo)
+			})
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error processing %s: %v\n", options.Path, err)
+			exit(1)
+		}
+
+		PrintChunks(repo, options, chunkSize, overlap)
+
+		PrintErrors(repo)
+		if options.Strict && len(repo.Errors) > 0 {
+			exit(1)
+		}
+	}
+}
+
+// PrintChunks prints the chunk counts per directory and file, largest first
+func PrintChunks(repo *RepoTokenInfo, options *CommandOptions, chunkSize int, overlap int) {
+	type dirChunks struct {
+		Info   *DirTokenInfo
+		Chunks int
+	}
+
+	reportRevPaths(repo, options)
+	total := 0
+	var dirs []dirChunks
+	for _, dirInfo := range repo.Dirs {
+		entry := dirChunks{Info: dirInfo}
+		for _, fileInfo := range dirInfo.Files {
+			entry.Chunks += chunkCount(fileInfo.TokenCount, chunkSize, overlap)
+		}
+		total += entry.Chunks
+		dirs = append(dirs, entry)
+	}
+	// Files below -min aren't listed, but their chunks are part of the plan
+	if !options.FilterAffectsTotals {
+		for _, fileInfo := range repo.BelowMin {
+			total += chunkCount(fileInfo.TokenCount, chunkSize, overlap)
+		}
+	}
+	// Directories are ordered by chunk count unless -sort says otherwise
+	sortDescription := options.sortDescription()
+	if options.SortBy == "" {
+		sortDescription = "chunk count"
+		if options.Reverse {
+			sortDescription += ", reversed"
+		}
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if options.SortBy == "" && dirs[i].Chunks != dirs[j].Chunks {
+			return (dirs[i].Chunks > dirs[j].Chunks) != options.Reverse
+		}
+		return options.entryLess(dirs[i].Info.Path, dirs[j].Info.Path, dirs[i].Info.TokenCount, dirs[j].Info.TokenCount, len(dirs[i].Info.Files), len(dirs[j].Info.Files))
+	})
+
+	fmt.Printf("Chunk Plan for: %s\n", repo.Path)
+	fmt.Printf("Chunk size: %d %s, overlap: %d %s\n", chunkSize, options.unitName(), overlap, options.unitName())
+	fmt.Printf("Total chunks: %d (from %d %s)\n\n", total, repo.TokenCount, options.unitName())
+
+	if options.IsSingleFile {
+		return
+	}
+
+	fmt.Printf("Directories (sorted by %s):\n", sortDescription)
+	fmt.Println("----------------------------------")
+	for _, entry := range dirs {
+		fmt.Printf("%s: %d chunks (%d %s)\n", filepath.ToSlash(entry.Info.Path), entry.Chunks, entry.Info.TokenCount, options.unitName())
+
+		if options.ShowFiles {
+			files := append([]*FileTokenInfo(nil), entry.Info.Files...)
+			options.sortFiles(files)
+			for _, fileInfo := range files {
+				relativePath := relativeTo(repo.Path, fileInfo.Path)
+				fmt.Printf("  |- %s: %d chunks (%d %s)\n", relativePath,
+					chunkCount(fileInfo.TokenCount, chunkSize, overlap), fileInfo.TokenCount, options.unitName())
+			}
+		}
+		fmt.Println()
+	}
+}
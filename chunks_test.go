@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestChunkCount(t *testing.T) {
+	tests := []struct {
+		size, chunkSize, overlap int
+		want                     int
+	}{
+		{0, 100, 0, 0},
+		{1, 100, 0, 1},
+		{100, 100, 0, 1},
+		{101, 100, 0, 2},
+		{250, 100, 0, 3},
+		// Each chunk after the first adds chunkSize - overlap units
+		{180, 100, 20, 2},
+		{181, 100, 20, 3},
+	}
+	for _, tt := range tests {
+		if got := chunkCount(tt.size, tt.chunkSize, tt.overlap); got != tt.want {
+			t.Errorf("chunkCount(%d, %d, %d) = %d, want %d", tt.size, tt.chunkSize, tt.overlap, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeClipboard puts a wl-copy on PATH that saves what it's given, returning
+// the file it saves to
+func fakeClipboard(t *testing.T) string {
+	t.Helper()
+	if runtime.GOOS != "linux" {
+		t.Skip("the fake clipboard is a shell script")
+	}
+	bin := t.TempDir()
+	saved := filepath.Join(bin, "clipboard")
+	script := "#!/bin/sh\ncat > " + saved + "\n"
+	if err := os.WriteFile(filepath.Join(bin, "wl-copy"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return saved
+}
+
+func TestCopyToClipboard(t *testing.T) {
+	saved := fakeClipboard(t)
+	if err := copyToClipboard("hello"); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(saved); string(data) != "hello" {
+		t.Errorf("clipboard has %q, want hello", data)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	if err := copyToClipboard("hello"); err == nil || !strings.Contains(err.Error(), "no clipboard command found (tried wl-copy, xclip, xsel)") {
+		t.Errorf("copyToClipboard without a clipboard command = %v", err)
+	}
+}
+
+func TestCopySelection(t *testing.T) {
+	saved := fakeClipboard(t)
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"main.go":      "package main\n\nfunc main() { println(1, 2, 3) }\n",
+		"main_test.go": "package main\n",
+		"lib/lib.go":   "package lib\n",
+		"README.md":    "# Readme\n",
+	})
+	repo, options := scanTree(t, dir, "-model", "cl100k_base")
+
+	tests := []struct {
+		name    string
+		copy    CopyOptions
+		want    []string
+		notWant []string
+		err     string
+	}{
+		{"all", CopyOptions{}, []string{"main.go", "main_test.go", "lib/lib.go", "README.md", "==> 4 files,"}, nil, ""},
+		{"select", CopyOptions{Select: []string{"*.go", "!*_test.go"}}, []string{"main.go", "lib/lib.go", "==> 2 files,"}, []string{"main_test.go", "README.md"}, ""},
+		{"top", CopyOptions{Top: 1}, []string{"main.go", "==> 1 files,"}, []string{"lib/lib.go"}, ""},
+		{"nothing selected", CopyOptions{Select: []string{"*.rs"}}, nil, nil, "no files to copy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(saved)
+			var err error
+			captureStderr(t, func() { err = copySelection(repo, options, &tt.copy) })
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("copySelection error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := os.ReadFile(saved)
+			for _, want := range tt.want {
+				if !strings.Contains(string(data), want) {
+					t.Errorf("clipboard is missing %q:\n%s", want, data)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(string(data), notWant) {
+					t.Errorf("clipboard has %q:\n%s", notWant, data)
+				}
+			}
+		})
+	}
+}
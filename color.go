@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// ANSI escape sequences used in reports. The line colors are all the same
+// length, so rows stay aligned when tabwriter counts them as text.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiPlain  = "\x1b[00m"
+	ansiDim    = "\x1b[02m"
+	ansiYellow = "\x1b[33m"
+	ansiRed    = "\x1b[31m"
+)
+
+// colorModes are the values accepted by -color
+var colorModes = map[string]bool{"auto": true, "always": true, "never": true}
+
+// parseColorMode validates the value of -color
+func parseColorMode(value string) (string, error) {
+	if !colorModes[value] {
+		return "", fmt.Errorf("unknown color mode %q (expected auto, always or never)", value)
+	}
+	return value, nil
+}
+
+// useColor reports whether reports should be colored. In auto mode that's
+// when stdout is a terminal and NO_COLOR isn't set.
+func (o *CommandOptions) useColor() bool {
+	switch o.Color {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// paint wraps text in an escape sequence if colors are enabled
+func (o *CommandOptions) paint(code string, text string) string {
+	if !o.useColor() || code == ansiPlain {
+		return text
+	}
+	return code + text + ansiReset
+}
+
+// shareColor picks the line color for an entry by its share of the total:
+// red for a quarter or more, yellow for a tenth or more, dimmed below 1%
+func shareColor(count int, total int) string {
+	if total <= 0 {
+		return ansiPlain
+	}
+	share := float64(count) / float64(total)
+	switch {
+	case share >= 0.25:
+		return ansiRed
+	case share >= 0.10:
+		return ansiYellow
+	case share < 0.01:
+		return ansiDim
+	default:
+		return ansiPlain
+	}
+}
+
+// formatCount formats a count with thousands separators, e.g. 1,234,567
+func formatCount(n int) string {
+	digits := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, digits = "-", digits[1:]
+	}
+
+	out := make([]byte, 0, len(digits)+len(digits)/3)
+	for i := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			out = append(out, ',')
+		}
+		out = append(out, digits[i])
+	}
+	return sign + string(out)
+}
@@ -0,0 +1,66 @@
+package main
+
+import "testing"
+
+func TestFormatCount(t *testing.T) {
+	tests := []struct {
+		n    int
+		want string
+	}{
+		{0, "0"},
+		{999, "999"},
+		{1000, "1,000"},
+		{1234567, "1,234,567"},
+		{-12345, "-12,345"},
+	}
+	for _, tt := range tests {
+		if got := formatCount(tt.n); got != tt.want {
+			t.Errorf("formatCount(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestShareColor(t *testing.T) {
+	tests := []struct {
+		count, total int
+		want         string
+	}{
+		{30, 100, ansiRed},
+		{10, 100, ansiYellow},
+		{5, 100, ansiPlain},
+		{0, 100, ansiDim},
+		{5, 0, ansiPlain},
+	}
+	for _, tt := range tests {
+		if got := shareColor(tt.count, tt.total); got != tt.want {
+			t.Errorf("shareColor(%d, %d) = %q, want %q", tt.count, tt.total, got, tt.want)
+		}
+	}
+}
+
+func TestPaint(t *testing.T) {
+	tests := []struct {
+		color   string
+		noColor string
+		want    string
+	}{
+		{"always", "", ansiRed + "text" + ansiReset},
+		{"always", "1", ansiRed + "text" + ansiReset},
+		{"never", "", "text"},
+		// Stdout isn't a terminal under go test
+		{"auto", "", "text"},
+	}
+	for _, tt := range tests {
+		t.Setenv("NO_COLOR", tt.noColor)
+		options := testOptions(t, "-color", tt.color)
+		if got := options.paint(ansiRed, "text"); got != tt.want {
+			t.Errorf("-color %s painted %q, want %q", tt.color, got, tt.want)
+		}
+	}
+	if got := testOptions(t, "-color", "always").paint(ansiPlain, "text"); got != "text" {
+		t.Errorf("plain text painted %q", got)
+	}
+	if _, err := parseColorMode("sometimes"); err == nil {
+		t.Error("parseColorMode of an unknown mode succeeded")
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+)
+
+// command is a subcommand of token-counter. Define declares the command's
+// flags on fs and returns the function that runs it once they're parsed, so
+// the flag set can also be built without running anything, as the completion
+// scripts are.
+type command struct {
+	Name    string
+	Aliases []string // Older names that still work
+	Args    string   // Synopsis of the arguments, for the help
+	Summary string
+	Define  func(fs *flag.FlagSet) func()
+}
+
+// commands lists the subcommands. Running token-counter without one is a
+// shortcut for scan. It's filled in by init because the completion command
+// refers back to it.
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{Name: "scan", Args: "[options] [path]", Summary: "Count the tokens in a directory, file, GitHub repository, bucket or web page", Define: scanCommand},
+		{Name: "file", Args: "[options] <path>", Summary: "Count the tokens in a single file", Define: fileCommand},
+		{Name: "diff", Aliases: []string{"diff-git"}, Args: "[options] [path]", Summary: "Count the tokens in a git diff", Define: diffCommand},
+		{Name: "commits", Args: "-range <range> [options] [path]", Summary: "Count the tokens each commit of a range added and removed", Define: commitsCommand},
+		{Name: "export", Args: "[options] [path]", Summary: "Concatenate the selected files into a bundle within a token budget", Define: exportCommand},
+		{Name: "dataset", Args: "[options] <file.jsonl...>", Summary: "Count every record of JSONL datasets and report their distribution and the records over a limit", Define: datasetCommand},
+		{Name: "chunks", Args: "[options] [path]", Summary: "Report how many chunks token-based splitting would produce", Define: chunksCommand},
+		{Name: "plan", Args: "[options] [path]", Summary: "Split a token budget across directories by priority and report what fits", Define: planCommand},
+		{Name: "baseline", Args: "write|check [options] [path]", Summary: "Write a baseline of the per-directory counts or check that none grew past it", Define: baselineCommand},
+		{Name: "multi", Args: "[options] [path...]", Summary: "Count several repositories and rank them together in one report", Define: multiCommand},
+		{Name: "compare", Args: "[options] <pathA> <pathB>", Summary: "Compare two trees or revisions file by file and report the net change", Define: compareCommand},
+		{Name: "comment", Args: "[options] <base> <head>", Summary: "Render the change between a pull request's base and head as a Markdown comment for a bot to post", Define: commentCommand},
+		{Name: "history", Args: "[options] [path]", Summary: "Count the tokens of past commits at regular intervals", Define: historyCommand},
+		{Name: "badge", Args: "[options] [path]", Summary: "Print an SVG or shields.io badge of the token count", Define: badgeCommand},
+		{Name: "hook", Args: "[options]", Summary: "Check the staged changes against the per-file and per-pull-request limits of the config file, for a pre-commit hook", Define: hookCommand},
+		{Name: "install-hook", Args: "[options] [-- hook options]", Summary: "Install a git pre-commit hook that runs hook and blocks commits over the limits", Define: installHookCommand},
+		{Name: "explain", Args: "[options] <path...>", Summary: "Explain which rule includes a file or directory in a scan or leaves it out", Define: explainCommand},
+		{Name: "bench", Args: "[options] [path]", Summary: "Measure how fast each tokenizer counts, on a built-in sample and on a directory", Define: benchCommand},
+		{Name: "models", Args: "", Summary: "List the models tokens can be counted with", Define: modelsCommand},
+		{Name: "serve", Args: "[options] [path]", Summary: "Serve the counting engine over gRPC", Define: serveCommand},
+		{Name: "mcp", Args: "[options]", Summary: "Run a Model Context Protocol server on stdin and stdout", Define: mcpCommand},
+		{Name: "index", Args: "start|query|status|stop [options] [path|pattern...]", Summary: "Keep an index of a directory current as it changes and answer queries from it instantly", Define: indexCommand},
+		{Name: "daemon", Args: "[options]", Summary: "Serve JSON-RPC on a unix socket or stdin and stdout, with the tokenizer kept loaded", Define: daemonCommand},
+		{Name: "completion", Args: "bash|zsh|fish|powershell", Summary: "Print a shell completion script", Define: completionCommand},
+	}
+}
+
+// findCommand returns the subcommand with the given name or alias, or nil
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd
+		}
+		for _, alias := range cmd.Aliases {
+			if alias == name {
+				return cmd
+			}
+		}
+	}
+	return nil
+}
+
+// flagSet returns a new flag set with the command's flags and help
+func (c *command) flagSet() (*flag.FlagSet, func()) {
+	fs := flag.NewFlagSet(c.Name, flag.ExitOnError)
+	run := c.Define(fs)
+	fs.Usage = func() { c.printUsage(fs) }
+	return fs, run
+}
+
+// run parses args and runs the command
+func (c *command) run(args []string) {
+	fs, run := c.flagSet()
+	commandLine = append([]string{c.Name}, args...)
+	fs.Parse(args)
+	run()
+}
+
+// printUsage prints the help of a command. The help of scan, which is also
+// the help of token-counter itself, lists the other commands too.
+func (c *command) printUsage(fs *flag.FlagSet) {
+	out := fs.Output()
+	if c.Name == "scan" {
+		fmt.Fprintf(out, "Usage: token-counter [command] %s\n\n%s.\n\nCommands:\n", c.Args, c.Summary)
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for _, cmd := range commands {
+			fmt.Fprintf(w, "  %s\t%s\n", cmd.Name, cmd.Summary)
+		}
+		w.Flush()
+		fmt.Fprintln(out, "\nRun 'token-counter <command> -h' for the options of a command.")
+	} else {
+		fmt.Fprintf(out, "Usage: %s\n\n%s.\n", strings.TrimSpace("token-counter "+c.Name+" "+c.Args), c.Summary)
+	}
+
+	hasFlags := false
+	fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		fmt.Fprintln(out, "\nOptions:")
+		fs.PrintDefaults()
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFindCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"scan", "scan"},
+		{"diff", "diff"},
+		{"diff-git", "diff"},
+		{"completion", "completion"},
+		{"src", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		cmd := findCommand(tt.name)
+		got := ""
+		if cmd != nil {
+			got = cmd.Name
+		}
+		if got != tt.want {
+			t.Errorf("findCommand(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestCommandUsage(t *testing.T) {
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"scan", []string{"Usage: token-counter [command] [options] [path]", "Commands:", "  diff ", "  completion ", "-model"}},
+		{"models", []string{"Usage: token-counter models\n"}},
+		{"file", []string{"Usage: token-counter file [options] <path>", "Options:"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			fs, _ := findCommand(tt.command).flagSet()
+			out := captureStderr(t, fs.Usage)
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("usage of %s is missing %q:\n%s", tt.command, want, out)
+				}
+			}
+		})
+	}
+}
+
+func TestCommandBadFlag(t *testing.T) {
+	stderr, code := exitStatus(t, func() { findCommand("file").run([]string{"-no-such-flag"}) })
+	if code != 2 || !strings.Contains(stderr, "flag provided but not defined: -no-such-flag") {
+		t.Errorf("exit %d, stderr:\n%s", code, stderr)
+	}
+}
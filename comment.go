@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// commentMarker is the hidden first line of a comment, which a bot searches
+// a pull request's comments for to update its comment instead of adding one
+const commentMarker = "<!-- token-counter comment -->"
+
+// commentCommand defines the comment subcommand, which compares a pull
+// request's base and head like compare and renders the change as a compact
+// Markdown comment, with the files that changed most in a collapsed section,
+// for a bot to post on the pull request
+func commentCommand(fs *flag.FlagSet) func() {
+	options := &CommandOptions{}
+	var base, head string
+	var threshold, top int
+
+	registerFlags(fs, options)
+	registerWalkFlags(fs, options)
+	fs.StringVar(&base, "base", "", "Count the base tree at this commit, tag or branch, e.g. origin/main")
+	fs.StringVar(&head, "head", "", "Count the head tree at this commit, tag or branch (defaults to the files on disk)")
+	fs.IntVar(&threshold, "threshold", 100, "Least change in tokens, either way, for a file to be listed in the details")
+	fs.IntVar(&top, "top", 50, "Number of files listed in the details, largest changes first (0 for all)")
+	fs.StringVar(&options.Output, "output", "", "File to write the comment to (defaults to stdout)")
+	return func() {
+		if len(options.Models) > 1 {
+			fmt.Fprintln(os.Stderr, "Error: -models is not supported by comment")
+			exit(1)
+		}
+		if threshold < 0 {
+			fmt.Fprintln(os.Stderr, "Error: -threshold can't be negative")
+			exit(1)
+		}
+
+		paths := comparePaths(fs, options, base, head)
+		if paths == nil {
+			fmt.Fprintln(os.Stderr, "Error: comment needs two paths, or one path with -base or -head")
+			exit(1)
+		}
+		sides := scanCompareSides(fs, options, paths, base, head)
+		report := newCompareReport(sides[0], sides[1], options)
+
+		var b strings.Builder
+		printComment(&b, report, options, threshold, top)
+		if options.Output == "" {
+			fmt.Print(b.String())
+		} else if err := os.WriteFile(options.Output, []byte(b.String()), 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", options.Output, err)
+			exit(1)
+		}
+
+		failed := printCompareErrors(sides)
+		if options.Strict && failed {
+			exit(1)
+		}
+	}
+}
+
+// printComment writes a comparison as a pull request comment: the net
+// change in its heading, a table of both totals, a line on the files added,
+// removed and modified, and the files whose count changed by threshold or
+// more in a <details> section, which GitHub shows collapsed
+func printComment(w io.Writer, report *CompareReport, options *CommandOptions, threshold int, top int) {
+	unit := options.unitName()
+	fmt.Fprintf(w, "%s\n### Token impact: %s %s", commentMarker, signedCount(report.Delta), unit)
+	if report.A.Total > 0 {
+		fmt.Fprintf(w, " (%+.1f%%)", float64(report.Delta)*100/float64(report.A.Total))
+	}
+	fmt.Fprintf(w, "\n\nBase %s, head %s, counted with %s", commentSide(report.A), commentSide(report.B), report.Metadata.Model)
+	if options.fallback != nil {
+		fmt.Fprintf(w, ", approximately, since %s isn't available", options.fallback.Requested)
+	}
+	fmt.Fprint(w, ".\n\n")
+	fmt.Fprintf(w, "| | Base | Head | Change |\n|---|---:|---:|---:|\n")
+	fmt.Fprintf(w, "| %s | %s | %s | %s |\n", capitalize(unit), formatCount(report.A.Total), formatCount(report.B.Total), changeOf(report.B.Total, report.A.Total))
+	fmt.Fprintf(w, "| Files | %s | %s | %s |\n\n", formatCount(report.A.Files), formatCount(report.B.Files), signedCount(report.B.Files-report.A.Files))
+
+	if len(report.Files) == 0 {
+		fmt.Fprintln(w, "No file changed.")
+		return
+	}
+	var kinds []string
+	for _, kind := range []struct {
+		name    string
+		summary *CompareSummary
+	}{{"added", report.Added}, {"removed", report.Removed}, {"modified", report.Modified}} {
+		if kind.summary.Files > 0 {
+			kinds = append(kinds, fmt.Sprintf("%s %s (%s)", formatCount(kind.summary.Files), kind.name, signedCount(kind.summary.Delta)))
+		}
+	}
+	fmt.Fprintf(w, "Files: %s, %s unchanged.\n", strings.Join(kinds, ", "), formatCount(report.Unchanged))
+
+	// report.Files is sorted by the size of the change, so the files over the
+	// threshold come first
+	var listed []*CompareEntry
+	for _, entry := range report.Files {
+		if max(entry.Delta, -entry.Delta) < threshold {
+			break
+		}
+		listed = append(listed, entry)
+	}
+	if len(listed) == 0 {
+		fmt.Fprintf(w, "\nNo file changed by %s %s or more.\n", formatCount(threshold), unit)
+		return
+	}
+	files := "files"
+	if len(listed) == 1 {
+		files = "file"
+	}
+	fmt.Fprintf(w, "\n<details>\n<summary>%s %s changed by %s %s or more</summary>\n\n", formatCount(len(listed)), files, formatCount(threshold), unit)
+	more := 0
+	if top > 0 && len(listed) > top {
+		listed, more = listed[:top], len(listed)-top
+	}
+	fmt.Fprintf(w, "| File | Base | Head | Change |\n|---|---:|---:|---:|\n")
+	for _, entry := range listed {
+		before, after, change := formatCount(entry.Before), formatCount(entry.After), changeOf(entry.After, entry.Before)
+		switch entry.Status {
+		case "added":
+			before = ""
+		case "removed":
+			after, change = "", signedCount(entry.Delta)+", removed"
+		}
+		fmt.Fprintf(w, "| %s | %s | %s | %s |\n", markdownCode(entry.Path), before, after, change)
+	}
+	if more > 0 {
+		fmt.Fprintf(w, "\nAnd %s more.\n", formatCount(more))
+	}
+	fmt.Fprintln(w, "\n</details>")
+}
+
+// commentSide names a side of the comparison in a comment, by its revision
+// and commit if it has them, e.g. `origin/main` (`1a2b3c4d5e6f`), or by its
+// path
+func commentSide(side *CompareSide) string {
+	name := "`" + side.Path + "`"
+	if side.Rev != "" {
+		name = "`" + side.Rev + "`"
+	}
+	if side.Commit != "" && side.Commit != side.Rev {
+		name += fmt.Sprintf(" (`%.12s`)", side.Commit)
+	}
+	if side.Dirty {
+		name += " with uncommitted changes"
+	}
+	return name
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommentCommand(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	writeTree(t, a, map[string]string{"same.txt": "one two", "changed.txt": "hello world", "gone.txt": "one two three", "recounted.txt": "cat"})
+	writeTree(t, b, map[string]string{"same.txt": "one two", "changed.txt": "hello world again and again", "new/added.txt": "four", "recounted.txt": "dog"})
+	summary := "<!-- token-counter comment -->\n### Token impact: +1 tokens (+12.5%)\n\nBase `" + a + "`, head `" + b + "`, counted with cl100k_base.\n\n" +
+		"| | Base | Head | Change |\n|---|---:|---:|---:|\n| Tokens | 8 | 9 | +1, +12.5% |\n| Files | 4 | 4 | +0 |\n\n" +
+		"Files: 1 added (+1), 1 removed (-3), 2 modified (+3), 1 unchanged.\n"
+	tests := []struct {
+		name string
+		args []string
+		head string
+		want string
+	}{
+		{"defaults", nil, b, summary + "\nNo file changed by 100 tokens or more.\n"},
+		{"threshold", []string{"-threshold", "2"}, b, summary + "\n<details>\n<summary>2 files changed by 2 tokens or more</summary>\n\n" +
+			"| File | Base | Head | Change |\n|---|---:|---:|---:|\n| `changed.txt` | 2 | 5 | +3, +150.0% |\n| `gone.txt` | 3 |  | -3, removed |\n\n</details>\n"},
+		{"top", []string{"-threshold", "1", "-top", "1"}, b, summary + "\n<details>\n<summary>3 files changed by 1 tokens or more</summary>\n\n" +
+			"| File | Base | Head | Change |\n|---|---:|---:|---:|\n| `changed.txt` | 2 | 5 | +3, +150.0% |\n\nAnd 2 more.\n\n</details>\n"},
+		{"added", []string{"-threshold", "1", "-top", "0"}, b, "| `new/added.txt` |  | 1 | +1, new |\n"},
+		{"same trees", nil, a, "### Token impact: +0 tokens (+0.0%)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append(append([]string{"-model", "cl100k_base", "-quiet"}, tt.args...), a, tt.head)
+			out := captureStdout(t, func() { findCommand("comment").run(args) })
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("comment printed\n%s\nwant\n%s", out, tt.want)
+			}
+		})
+	}
+
+	output := filepath.Join(t.TempDir(), "comment.md")
+	findCommand("comment").run([]string{"-model", "cl100k_base", "-quiet", "-output", output, a, a})
+	if data, _ := os.ReadFile(output); !strings.HasSuffix(string(data), "| Files | 4 | 4 | +0 |\n\nNo file changed.\n") {
+		t.Errorf("-output has\n%s", data)
+	}
+}
+
+func TestCommentSide(t *testing.T) {
+	tests := []struct {
+		side CompareSide
+		want string
+	}{
+		{CompareSide{Path: "repo"}, "`repo`"},
+		{CompareSide{Path: "repo", Rev: "origin/main", Commit: "1a2b3c4d5e6f7a8b"}, "`origin/main` (`1a2b3c4d5e6f`)"},
+		{CompareSide{Path: "repo", Commit: "1a2b3c4d5e6f7a8b", Dirty: true}, "`repo` (`1a2b3c4d5e6f`) with uncommitted changes"},
+	}
+	for _, tt := range tests {
+		if got := commentSide(&tt.side); got != tt.want {
+			t.Errorf("commentSide = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestCommentCommandErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"one path", []string{"."}, "Error: comment needs two paths, or one path with -base or -head"},
+		{"-models", []string{"-models", "cl100k_base,o200k_base", ".", "."}, "Error: -models is not supported by comment"},
+		{"-threshold", []string{"-threshold", "-1", ".", "."}, "Error: -threshold can't be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderr, code := exitStatus(t, func() { findCommand("comment").run(tt.args) })
+			if code != 1 || !strings.Contains(stderr, tt.want) {
+				t.Errorf("exit %d, stderr:\n%s\nwant %q", code, stderr, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// commitsFormats are the values accepted by commits' -format
+var commitsFormats = map[string]bool{"text": true, "csv": true, "json": true}
+
+// commitsSorts are the values accepted by commits' -sort
+var commitsSorts = map[string]bool{"added": true, "removed": true, "net": true, "date": true}
+
+// commitHeader starts every commit in the git log output commits parses:
+// NUL, then the hash, author, date and subject separated by NULs
+const commitHeader = "%x00%H%x00%an%x00%aI%x00%s"
+
+// CommitTokenInfo is the count of the diff of one commit
+type CommitTokenInfo struct {
+	Commit  string    `json:"commit"`
+	Author  string    `json:"author"`
+	Date    time.Time `json:"date"`
+	Subject string    `json:"subject"`
+	Files   int       `json:"files"`   // Files the commit changed
+	Added   int       `json:"added"`   // Tokens in the added lines
+	Removed int       `json:"removed"` // Tokens in the removed lines
+	Net     int       `json:"net"`     // Change to the token count of the tree
+}
+
+// commitsCommand defines the commits subcommand, which counts the tokens
+// each commit of a range added and removed, to find the ones that grew the
+// repository the most
+func commitsCommand(fs *flag.FlagSet) func() {
+	options := &CommandOptions{}
+	var revRange, sortBy, format string
+	var limit int
+
+	registerFlags(fs, options)
+	fs.StringVar(&options.Path, "path", "", "Path of the repository, or a directory inside it (defaults to the current directory)")
+	fs.StringVar(&revRange, "range", "", "Range of commits to count, e.g. v1.0..HEAD")
+	fs.StringVar(&sortBy, "sort", "added", "Order of the commits: added, removed, net (tokens) or date")
+	fs.IntVar(&limit, "limit", 0, "Maximum number of commits to list (0 for all)")
+	fs.StringVar(&format, "format", "text", "Output format: text, csv or json")
+	fs.DurationVar(&options.Timeout, "timeout", 0, "Give up after this long, e.g. 60s (0 for no limit)")
+	return func() {
+		if revRange == "" {
+			fmt.Fprintln(os.Stderr, "Error: commits needs a -range, e.g. -range v1.0..HEAD")
+			exit(1)
+		}
+		if !commitsSorts[sortBy] {
+			fmt.Fprintf(os.Stderr, "Error: unknown sort %q (expected added, removed, net or date)\n", sortBy)
+			exit(1)
+		}
+		if !commitsFormats[format] {
+			fmt.Fprintf(os.Stderr, "Error: unknown format %q (expected text, csv or json)\n", format)
+			exit(1)
+		}
+		if len(options.Models) > 1 {
+			fmt.Fprintln(os.Stderr, "Error: -models is not supported by commits")
+			exit(1)
+		}
+		if options.Path == "" {
+			if fs.NArg() > 0 {
+				options.Path = fs.Arg(0)
+			} else {
+				options.Path = "."
+			}
+		}
+
+		ctx, cancel := commandContext(options)
+		defer cancel()
+		commits, err := countCommits(ctx, options.Path, revRange, options)
+		if interrupted(err) {
+			err = interruptedError(err, options)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		// git log lists the newest first
+		sort.SliceStable(commits, func(i, j int) bool {
+			a, b := commits[i], commits[j]
+			switch sortBy {
+			case "removed":
+				return a.Removed > b.Removed
+			case "net":
+				return a.Net > b.Net
+			case "date":
+				return a.Date.Before(b.Date)
+			default:
+				return a.Added > b.Added
+			}
+		})
+		listed := commits
+		if limit > 0 && len(listed) > limit {
+			listed = listed[:limit]
+		}
+
+		switch format {
+		case "csv":
+			printCommitsCSV(listed)
+		case "json":
+			metadata := newScanMetadata(&RepoTokenInfo{Path: options.Path}, options)
+			data, _ := json.MarshalIndent(map[string]any{"metadata": metadata, "range": revRange, "commits": listed}, "", "  ")
+			fmt.Println(string(data))
+		default:
+			printCommits(revRange, commits, listed, options)
+		}
+	}
+}
+
+// countCommits counts the diff of every commit in a range, reading them all
+// from a single git log. Merges are diffed against their first parent, so
+// the changes they bring in from a branch are counted once, in the merge.
+// A range starting with "-" is rejected, since git would take it for an
+// option.
+func countCommits(ctx context.Context, dir string, revRange string, options *CommandOptions) ([]*CommitTokenInfo, error) {
+	if strings.HasPrefix(revRange, "-") {
+		return nil, fmt.Errorf("invalid -range %q: a range can't start with \"-\"", revRange)
+	}
+	encs, err := newCodecs(options)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "log", "--no-color", "--no-ext-diff", "-p", "--diff-merges=first-parent", "--format="+commitHeader, revRange, "--")
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	var commits []*CommitTokenInfo
+	var current *CommitTokenInfo
+	var patch strings.Builder
+	finish := func() error {
+		if current == nil {
+			return nil
+		}
+		files := parseDiff(patch.String())
+		current.Files = len(files)
+		var err error
+		if current.Added, current.Removed, err = countDiffFiles(files, encs[0], options.CountMode); err != nil {
+			return fmt.Errorf("%s: %v", current.Commit, err)
+		}
+		current.Net = current.Added - current.Removed
+		commits = append(commits, current)
+		patch.Reset()
+		return ctx.Err()
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	var countErr error
+	for scanner.Scan() && countErr == nil {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "\x00") {
+			patch.WriteString(line)
+			patch.WriteByte('\n')
+			continue
+		}
+		if countErr = finish(); countErr != nil {
+			break
+		}
+		fields := strings.SplitN(line[1:], "\x00", 4)
+		for len(fields) < 4 {
+			fields = append(fields, "")
+		}
+		date, _ := time.Parse(time.RFC3339, fields[2])
+		current = &CommitTokenInfo{Commit: fields[0], Author: fields[1], Date: date, Subject: fields[3]}
+	}
+	if countErr == nil {
+		countErr = scanner.Err()
+	}
+	if countErr == nil {
+		countErr = finish()
+	}
+	if countErr != nil {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return nil, countErr
+	}
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git log: %s", msg)
+		}
+		return nil, fmt.Errorf("git log: %v", err)
+	}
+	return commits, nil
+}
+
+// signedCount formats a change in a count with its sign
+func signedCount(delta int) string {
+	sign := "+"
+	if delta < 0 {
+		sign = "-"
+	}
+	return sign + formatCount(max(delta, -delta))
+}
+
+// printCommits prints the totals of the range and a table of the listed
+// commits
+func printCommits(revRange string, commits []*CommitTokenInfo, listed []*CommitTokenInfo, options *CommandOptions) {
+	unit := options.unitName()
+	added, removed := 0, 0
+	for _, commit := range commits {
+		added += commit.Added
+		removed += commit.Removed
+	}
+	fmt.Printf("Token Count Summary for commits %s (%d commits)\n", revRange, len(commits))
+	fmt.Printf("Total %s added: %s, removed: %s, net: %s\n\n", unit, formatCount(added), formatCount(removed), signedCount(added-removed))
+	if len(listed) == 0 {
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "COMMIT\tDATE\tFILES\tADDED\tREMOVED\tNET\t\tSUBJECT\n")
+	for _, commit := range listed {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t\t%s\n", commit.Commit[:min(len(commit.Commit), 12)], commit.Date.Format("2006-01-02"), commit.Files, formatCount(commit.Added), formatCount(commit.Removed), signedCount(commit.Net), commit.Subject)
+	}
+	w.Flush()
+}
+
+// printCommitsCSV prints the listed commits as CSV, with full commit hashes
+func printCommitsCSV(commits []*CommitTokenInfo) {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"commit", "date", "author", "files", "added", "removed", "net", "subject"})
+	for _, commit := range commits {
+		w.Write([]string{commit.Commit, commit.Date.Format(time.RFC3339), commit.Author, strconv.Itoa(commit.Files), strconv.Itoa(commit.Added), strconv.Itoa(commit.Removed), strconv.Itoa(commit.Net), commit.Subject})
+	}
+	w.Flush()
+}
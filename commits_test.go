@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCountCommits(t *testing.T) {
+	dir := t.TempDir()
+	git := func(args ...string) { runGit(t, dir, args...) }
+	git("init", "-q")
+	writeTree(t, dir, map[string]string{"a.txt": "hello world\n"})
+	git("add", ".")
+	git("commit", "-qm", "first")
+	writeTree(t, dir, map[string]string{"a.txt": "x\n", "b.txt": "hello world\n"})
+	git("add", ".")
+	git("commit", "-qm", "second")
+
+	options := testOptions(t, "-model", "cl100k_base")
+	tests := []struct {
+		revRange string
+		subjects []string
+		wantErr  bool
+	}{
+		{"HEAD~1..HEAD", []string{"second"}, false},
+		{"HEAD", []string{"second", "first"}, false},
+		{"--output=commits.txt", nil, true},
+		{"no-such-rev", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.revRange, func(t *testing.T) {
+			commits, err := countCommits(context.Background(), dir, tt.revRange, options)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("countCommits error = %v, want error %v", err, tt.wantErr)
+			}
+			var subjects []string
+			for _, commit := range commits {
+				subjects = append(subjects, commit.Subject)
+			}
+			if len(subjects) != len(tt.subjects) {
+				t.Fatalf("commits %v, want %v", subjects, tt.subjects)
+			}
+			for i := range subjects {
+				if subjects[i] != tt.subjects[i] {
+					t.Errorf("commits %v, want %v", subjects, tt.subjects)
+				}
+			}
+		})
+	}
+
+	// The second commit added "hello world\n" and "x\n", and removed "hello world\n"
+	commits, err := countCommits(context.Background(), dir, "HEAD~1..HEAD", options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := commits[0]; c.Files != 2 || c.Added != 5 || c.Removed != 3 || c.Net != 2 {
+		t.Errorf("second commit = %+v, want 2 files, 5 added, 3 removed, net 2", c)
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// compareFormats are the values accepted by compare's -format
+var compareFormats = map[string]bool{"text": true, "csv": true, "json": true}
+
+// CompareReport is the per-file difference between two scans
+type CompareReport struct {
+	Metadata  *ScanMetadata   `json:"metadata"`
+	A         *CompareSide    `json:"a"`
+	B         *CompareSide    `json:"b"`
+	Delta     int             `json:"delta"` // Total of B less total of A
+	Added     *CompareSummary `json:"added"`
+	Removed   *CompareSummary `json:"removed"`
+	Modified  *CompareSummary `json:"modified"`
+	Unchanged int             `json:"unchanged"` // Files with the same contents on both sides
+	Files     []*CompareEntry `json:"files"`     // Changed files, by the size of their change
+}
+
+// CompareSide is one of the two scans of a comparison
+type CompareSide struct {
+	Path   string `json:"path"`
+	Rev    string `json:"rev,omitempty"`
+	Commit string `json:"commit,omitempty"`
+	Dirty  bool   `json:"dirty,omitempty"`
+	Total  int    `json:"total"`
+	Files  int    `json:"files"`
+
+	repo  *RepoTokenInfo
+	files map[string]*FileTokenInfo // By slash path relative to the root
+}
+
+// CompareSummary counts the files of one kind of change
+type CompareSummary struct {
+	Files int `json:"files"`
+	Delta int `json:"delta"`
+}
+
+// CompareEntry is a file that differs between the two scans
+type CompareEntry struct {
+	Path   string `json:"path"`
+	Status string `json:"status"` // added, removed or modified
+	Before int    `json:"before"`
+	After  int    `json:"after"`
+	Delta  int    `json:"delta"`
+}
+
+// compareCommand defines the compare subcommand, which scans two trees, such
+// as two checkouts, a worktree of another branch or two revisions, and
+// reports the files added, removed and modified between them and the net
+// change in tokens
+func compareCommand(fs *flag.FlagSet) func() {
+	options := &CommandOptions{}
+	var revA, revB, format string
+	var top int
+
+	registerFlags(fs, options)
+	registerWalkFlags(fs, options)
+	fs.StringVar(&revA, "rev-a", "", "Count the first tree at this commit, tag or branch, read from the git object database")
+	fs.StringVar(&revB, "rev-b", "", "Count the second tree at this commit, tag or branch")
+	fs.IntVar(&top, "top", 0, "Number of changed files to list, largest changes first (0 for all)")
+	fs.StringVar(&format, "format", "text", "Output format: text, csv or json")
+	return func() {
+		if !compareFormats[format] {
+			fmt.Fprintf(os.Stderr, "Error: unknown format %q (expected text, csv or json)\n", format)
+			exit(1)
+		}
+		if len(options.Models) > 1 {
+			fmt.Fprintln(os.Stderr, "Error: -models is not supported by compare")
+			exit(1)
+		}
+
+		paths := comparePaths(fs, options, revA, revB)
+		if paths == nil {
+			fmt.Fprintln(os.Stderr, "Error: compare needs two paths, or one path with -rev-a or -rev-b")
+			exit(1)
+		}
+		sides := scanCompareSides(fs, options, paths, revA, revB)
+		report := newCompareReport(sides[0], sides[1], options)
+		if top > 0 && len(report.Files) > top {
+			report.Files = report.Files[:top]
+		}
+		switch format {
+		case "csv":
+			printCompareCSV(os.Stdout, report)
+		case "json":
+			data, _ := json.MarshalIndent(report, "", "  ")
+			fmt.Println(string(data))
+		default:
+			printCompare(report, options)
+		}
+
+		failed := printCompareErrors(sides)
+		if options.Strict && failed {
+			exit(1)
+		}
+	}
+}
+
+// comparePaths returns the paths of the two sides of a comparison from the
+// arguments, or nil without two. With revisions, one path (or none, for the
+// current directory) can stand for both sides.
+func comparePaths(fs *flag.FlagSet, options *CommandOptions, revA string, revB string) []string {
+	paths := fs.Args()
+	if options.Path != "" {
+		paths = append([]string{options.Path}, paths...)
+	}
+	if len(paths) < 2 && (revA != "" || revB != "") {
+		if len(paths) == 0 {
+			paths = []string{"."}
+		}
+		paths = append(paths, paths[0])
+	}
+	if len(paths) != 2 {
+		return nil
+	}
+	return paths
+}
+
+// scanCompareSides scans the two sides of a comparison, each at its
+// revision if it has one, and exits on an error as the commands do
+func scanCompareSides(fs *flag.FlagSet, options *CommandOptions, paths []string, revA string, revB string) []*CompareSide {
+	// A profile applies to both sides, so it's read from -config or the
+	// current directory
+	options.Path = "."
+	if err := applyProfile(fs, options); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+
+	ctx, cancel := commandContext(options)
+	defer cancel()
+	var sides []*CompareSide
+	for i, rev := range []string{revA, revB} {
+		sideOptions := *options
+		sideOptions.Path, sideOptions.Rev = paths[i], rev
+		if isGitHubURL(sideOptions.Path) {
+			if !options.Quiet {
+				logger.Info("cloning repository", "url", sideOptions.Path)
+			}
+			dir, err := fetchGitHubRepo(sideOptions.Path)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+			sideOptions.Path = dir
+		}
+		sideOptions.Path = normalizePath(sideOptions.Path)
+		if rev != "" {
+			if err := snapshotRev(&sideOptions); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+		}
+		if info, err := os.Stat(sideOptions.Path); err != nil || !info.IsDir() {
+			fmt.Fprintf(os.Stderr, "Error: %s is not a directory\n", paths[i])
+			exit(1)
+		}
+
+		if !options.Quiet {
+			fmt.Fprintf(os.Stderr, "Processing directory: %s\n", revReportedPath(sideOptions.Path, &sideOptions))
+		}
+		repo, err := ProcessRepository(ctx, sideOptions.Path, &sideOptions)
+		if interrupted(err) {
+			err = interruptedError(err, options)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error processing %s: %v\n", sideOptions.Path, err)
+			exit(1)
+		}
+		// The second side counts with the encoding -model-fallback chose
+		if sideOptions.fallback != nil {
+			options.Model, options.fallback = sideOptions.Model, sideOptions.fallback
+		}
+		sides = append(sides, newCompareSide(paths[i], repo, &sideOptions))
+	}
+	return sides
+}
+
+// printCompareErrors prints the files of either side that couldn't be
+// counted, and reports whether there were any
+func printCompareErrors(sides []*CompareSide) bool {
+	failed := false
+	for _, side := range sides {
+		if len(side.repo.Errors) == 0 {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Errors in %s (%d):\n", side.Path, len(side.repo.Errors))
+		for _, fileErr := range side.repo.Errors {
+			fmt.Fprintf(os.Stderr, "%s\n", fileErr)
+		}
+		failed = true
+	}
+	return failed
+}
+
+// newCompareSide indexes the files of a scan by their path relative to its
+// root, including those below -min, which count in the total
+func newCompareSide(path string, repo *RepoTokenInfo, options *CommandOptions) *CompareSide {
+	reportRevPaths(repo, options)
+	metadata := newScanMetadata(repo, options)
+	side := &CompareSide{
+		Path:   path,
+		Rev:    metadata.Rev,
+		Commit: metadata.Commit,
+		Dirty:  metadata.Dirty,
+		Total:  repo.TokenCount,
+		repo:   repo,
+		files:  make(map[string]*FileTokenInfo),
+	}
+	add := func(fileInfo *FileTokenInfo) {
+		side.files[filepath.ToSlash(relativeTo(repo.Path, fileInfo.Path))] = fileInfo
+	}
+	for _, dirInfo := range repo.Dirs {
+		for _, fileInfo := range dirInfo.Files {
+			add(fileInfo)
+		}
+	}
+	for _, fileInfo := range repo.BelowMin {
+		add(fileInfo)
+	}
+	side.Files = len(side.files)
+	return side
+}
+
+// newCompareReport matches the files of two scans by path. A file is
+// modified when its contents differ, even if its count doesn't. Changed
+// files are sorted by the size of their change, largest first.
+func newCompareReport(a *CompareSide, b *CompareSide, options *CommandOptions) *CompareReport {
+	report := &CompareReport{
+		Metadata: &ScanMetadata{
+			Tool:      "token-counter",
+			Version:   toolVersion(),
+			Model:     options.modelName(),
+			Fallback:  options.fallback,
+			Unit:      options.unitName(),
+			Command:   commandLine,
+			Timestamp: time.Now().UTC().Truncate(time.Second),
+			Files:     a.Files + b.Files,
+		},
+		A:        a,
+		B:        b,
+		Delta:    b.Total - a.Total,
+		Added:    &CompareSummary{},
+		Removed:  &CompareSummary{},
+		Modified: &CompareSummary{},
+		Files:    []*CompareEntry{},
+	}
+
+	for path, before := range a.files {
+		after, ok := b.files[path]
+		switch {
+		case !ok:
+			report.Files = append(report.Files, &CompareEntry{Path: path, Status: "removed", Before: before.TokenCount, Delta: -before.TokenCount})
+			report.Removed.Files++
+			report.Removed.Delta -= before.TokenCount
+		case after.Hash != before.Hash:
+			delta := after.TokenCount - before.TokenCount
+			report.Files = append(report.Files, &CompareEntry{Path: path, Status: "modified", Before: before.TokenCount, After: after.TokenCount, Delta: delta})
+			report.Modified.Files++
+			report.Modified.Delta += delta
+		default:
+			report.Unchanged++
+		}
+	}
+	for path, after := range b.files {
+		if _, ok := a.files[path]; !ok {
+			report.Files = append(report.Files, &CompareEntry{Path: path, Status: "added", After: after.TokenCount, Delta: after.TokenCount})
+			report.Added.Files++
+			report.Added.Delta += after.TokenCount
+		}
+	}
+
+	sort.Slice(report.Files, func(i, j int) bool {
+		x, y := report.Files[i], report.Files[j]
+		if dx, dy := max(x.Delta, -x.Delta), max(y.Delta, -y.Delta); dx != dy {
+			return dx > dy
+		}
+		return x.Path < y.Path
+	})
+	return report
+}
+
+// printCompare prints a comparison: the totals of both sides, the net
+// change, a summary of each kind of change and the changed files. Growth is
+// highlighted in red.
+func printCompare(report *CompareReport, options *CommandOptions) {
+	unit := options.unitName()
+	describe := func(side *CompareSide) string {
+		name := side.Path
+		if side.Rev != "" {
+			name += " at " + side.Rev
+		}
+		return fmt.Sprintf("%s (%s %s, %s files)", name, formatCount(side.Total), unit, formatCount(side.Files))
+	}
+	fmt.Println(options.paint(ansiBold, "Token Count Comparison"))
+	fmt.Printf("A: %s\n", describe(report.A))
+	fmt.Printf("B: %s\n", describe(report.B))
+	net := fmt.Sprintf("Net change: %s %s", signedCount(report.Delta), unit)
+	if report.A.Total > 0 {
+		net += fmt.Sprintf(" (%+.1f%%)", float64(report.Delta)*100/float64(report.A.Total))
+	}
+	fmt.Println(options.paint(ansiBold, net))
+	fmt.Println()
+
+	fmt.Printf("Added: %s files, %s %s\n", formatCount(report.Added.Files), signedCount(report.Added.Delta), unit)
+	fmt.Printf("Removed: %s files, %s %s\n", formatCount(report.Removed.Files), signedCount(report.Removed.Delta), unit)
+	fmt.Printf("Modified: %s files, %s %s\n", formatCount(report.Modified.Files), signedCount(report.Modified.Delta), unit)
+	fmt.Printf("Unchanged: %s files\n", formatCount(report.Unchanged))
+	if len(report.Files) == 0 {
+		return
+	}
+
+	fmt.Println()
+	fmt.Println(options.paint(ansiBold, "Files (sorted by change):"))
+	fmt.Println("----------------------------------")
+	for _, entry := range report.Files {
+		var line string
+		switch entry.Status {
+		case "added":
+			line = fmt.Sprintf("+ %s: %s %s (added)", entry.Path, signedCount(entry.Delta), unit)
+		case "removed":
+			line = fmt.Sprintf("- %s: %s %s (removed)", entry.Path, signedCount(entry.Delta), unit)
+		default:
+			line = fmt.Sprintf("~ %s: %s → %s %s (%s", entry.Path, formatCount(entry.Before), formatCount(entry.After), unit, signedCount(entry.Delta))
+			if entry.Before > 0 {
+				line += fmt.Sprintf(", %+.1f%%", float64(entry.Delta)*100/float64(entry.Before))
+			}
+			line += ")"
+		}
+		color := ansiPlain
+		if entry.Delta > 0 {
+			color = ansiRed
+		}
+		fmt.Println(options.paint(color, line))
+	}
+}
+
+// printCompareCSV writes the changed files of a comparison as CSV
+func printCompareCSV(w io.Writer, report *CompareReport) {
+	out := csv.NewWriter(w)
+	out.Write([]string{"path", "status", "before", "after", "delta"})
+	for _, entry := range report.Files {
+		out.Write([]string{entry.Path, entry.Status, strconv.Itoa(entry.Before), strconv.Itoa(entry.After), strconv.Itoa(entry.Delta)})
+	}
+	out.Flush()
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// compareJSON runs compare with args and returns its JSON report
+func compareJSON(t *testing.T, args ...string) *CompareReport {
+	t.Helper()
+	out := captureStdout(t, func() {
+		findCommand("compare").run(append([]string{"-model", "cl100k_base", "-quiet", "-format", "json"}, args...))
+	})
+	report := &CompareReport{}
+	if err := json.Unmarshal([]byte(out), report); err != nil {
+		t.Fatalf("report isn't JSON: %v\n%s", err, out)
+	}
+	return report
+}
+
+func TestCompareCommand(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "b")
+	writeTree(t, a, map[string]string{"same.txt": "one two", "changed.txt": "hello world", "gone.txt": "one two three", "recounted.txt": "cat"})
+	writeTree(t, b, map[string]string{"same.txt": "one two", "changed.txt": "hello world again and again", "new/added.txt": "four", "recounted.txt": "dog"})
+
+	report := compareJSON(t, a, b)
+	if report.A.Total != 8 || report.B.Total != 9 || report.Delta != 1 || report.Unchanged != 1 {
+		t.Errorf("totals %d and %d, delta %d, %d unchanged", report.A.Total, report.B.Total, report.Delta, report.Unchanged)
+	}
+	if *report.Added != (CompareSummary{1, 1}) || *report.Removed != (CompareSummary{1, -3}) || *report.Modified != (CompareSummary{2, 3}) {
+		t.Errorf("added %+v, removed %+v, modified %+v", report.Added, report.Removed, report.Modified)
+	}
+	var files []string
+	for _, entry := range report.Files {
+		files = append(files, entry.Status+" "+entry.Path)
+	}
+	// Largest changes first, and a file whose count is the same is still modified
+	want := []string{"modified changed.txt", "removed gone.txt", "added new/added.txt", "modified recounted.txt"}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("files %v, want %v", files, want)
+	}
+
+	if top := compareJSON(t, "-top", "1", a, b); len(top.Files) != 1 {
+		t.Errorf("-top 1 listed %d files", len(top.Files))
+	}
+
+	text := captureStdout(t, func() { findCommand("compare").run([]string{"-model", "cl100k_base", "-quiet", a, b}) })
+	for _, line := range []string{"Net change: +1 tokens (+12.5%)", "Added: 1 files, +1 tokens", "Removed: 1 files, -3 tokens", "Unchanged: 1 files"} {
+		if !strings.Contains(text, line) {
+			t.Errorf("text report has no %q:\n%s", line, text)
+		}
+	}
+}
+
+func TestCompareRevisions(t *testing.T) {
+	t.Cleanup(runExitHooks)
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q")
+	writeTree(t, dir, map[string]string{"a.txt": "one"})
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", "first")
+	runGit(t, dir, "tag", "v1")
+	writeTree(t, dir, map[string]string{"b.txt": "two three"})
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", "second")
+
+	report := compareJSON(t, "-rev-a", "v1", "-rev-b", "HEAD", dir)
+	if report.A.Rev != "v1" || report.B.Rev != "HEAD" || report.Delta != 2 || report.Added.Files != 1 || report.A.Commit == report.B.Commit {
+		t.Errorf("A %+v, B %+v, delta %d", report.A, report.B, report.Delta)
+	}
+	if len(report.Files) != 1 || report.Files[0].Path != "b.txt" {
+		t.Errorf("files %+v", report.Files)
+	}
+}
+
+func TestCompareCommandErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"one path", []string{"."}, "Error: compare needs two paths, or one path with -rev-a or -rev-b"},
+		{"unknown format", []string{"-format", "xml", ".", "."}, `Error: unknown format "xml" (expected text, csv or json)`},
+		{"missing directory", []string{".", "missing-directory"}, "Error: missing-directory is not a directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderr, code := exitStatus(t, func() { captureStdout(t, func() { findCommand("compare").run(tt.args) }) })
+			if code != 1 || !strings.Contains(stderr, tt.want) {
+				t.Errorf("exit %d, stderr:\n%s", code, stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"token-counter/tokenizers"
+)
+
+// completionShells lists the shells completion scripts can be generated for
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// completionFlag is a flag as the completion scripts see it
+type completionFlag struct {
+	Name   string
+	Usage  string
+	Bool   bool     // Takes no value
+	Files  bool     // Takes a path
+	Values []string // Takes one of these values, if set
+}
+
+// completionSpec is a command and its flags. The root command has no name.
+type completionSpec struct {
+	Name    string
+	Summary string
+	Flags   []completionFlag
+	Args    []string // Values of the positional arguments; paths if empty
+}
+
+// completionCommand defines the completion subcommand, which prints a
+// completion script for the given shell. The scripts are generated from the
+// commands' own flag sets, so they cover every flag without being kept in
+// sync by hand.
+func completionCommand(fs *flag.FlagSet) func() {
+	return func() {
+		shell := fs.Arg(0)
+		var script string
+		switch shell {
+		case "bash":
+			script = bashCompletion(completionSpecs())
+		case "zsh":
+			script = zshCompletion(completionSpecs())
+		case "fish":
+			script = fishCompletion(completionSpecs())
+		case "powershell":
+			script = powershellCompletion(completionSpecs())
+		default:
+			fmt.Fprintf(os.Stderr, "Error: completion needs a shell: %s\n", strings.Join(completionShells, ", "))
+			exit(1)
+		}
+		fmt.Print(script)
+	}
+}
+
+// completionSpecs describes the root command followed by the subcommands
+func completionSpecs() []completionSpec {
+	specs := []completionSpec{newCompletionSpec("", findCommand("scan"))}
+	for _, cmd := range commands {
+		specs = append(specs, newCompletionSpec(cmd.Name, cmd))
+	}
+	return specs
+}
+
+func newCompletionSpec(name string, cmd *command) completionSpec {
+	spec := completionSpec{Name: name, Summary: cmd.Summary}
+	switch cmd.Name {
+	case "completion":
+		spec.Args = completionShells
+	case "baseline":
+		spec.Args = []string{"write", "check"}
+	}
+
+	fs, _ := cmd.flagSet()
+	fs.VisitAll(func(f *flag.Flag) {
+		cf := completionFlag{Name: f.Name, Usage: f.Usage}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			cf.Bool = true
+		}
+		cf.Values, cf.Files = flagCompletions(cmd.Name, f.Name)
+		spec.Flags = append(spec.Flags, cf)
+	})
+	return spec
+}
+
+// flagCompletions returns the values a flag of a command accepts, or whether
+// it takes a path, for the flags where either is known
+func flagCompletions(command string, name string) ([]string, bool) {
+	if command == "history" && name == "format" {
+		return sortedKeys(historyFormats), false
+	}
+	if command == "plan" && name == "format" {
+		return sortedKeys(planFormats), false
+	}
+	if command == "commits" && name == "format" {
+		return sortedKeys(commitsFormats), false
+	}
+	if command == "commits" && name == "sort" {
+		return sortedKeys(commitsSorts), false
+	}
+	switch name {
+	case "model", "models":
+		return tokenizers.Names(), false
+	case "format":
+		return sortedKeys(outputFormats), false
+	case "count-mode":
+		return sortedKeys(countModes), false
+	case "allow-special", "disallow-special":
+		return []string{"all", "none"}, false
+	case "chat-format":
+		return sortedKeys(chatFormats), false
+	case "sort":
+		return sortedKeys(sortKeys), false
+	case "color":
+		return sortedKeys(colorModes), false
+	case "strip":
+		return sortedKeys(stripFilters), false
+	case "log-level":
+		return []string{"debug", "info", "warn", "error"}, false
+	case "log-format":
+		return []string{"text", "json"}, false
+	case "interval":
+		return sortedKeys(historyIntervals), false
+	case "view":
+		return sortedKeys(views), false
+	case "order":
+		return []string{"greedy", "priority"}, false
+	case "path", "tokenizer-file", "bpe-vocab", "bpe-encoder", "o", "output", "baseline", "config", "socket", "skipped-report", "files-from", "workspace", "template":
+		return nil, true
+	}
+	return nil, false
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// subcommandNames returns the names of the subcommands
+func subcommandNames(specs []completionSpec) []string {
+	var names []string
+	for _, spec := range specs[1:] {
+		names = append(names, spec.Name)
+	}
+	return names
+}
+
+func bashCompletion(specs []completionSpec) string {
+	var b strings.Builder
+	b.WriteString("# bash completion for token-counter\n")
+	b.WriteString("# Load it with: source <(token-counter completion bash)\n\n")
+	b.WriteString("_token_counter() {\n")
+	b.WriteString("    local cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\" cmd=\"\"\n")
+	fmt.Fprintf(&b, "    case \"${COMP_WORDS[1]}\" in\n        %s) cmd=\"${COMP_WORDS[1]}\" ;;\n    esac\n\n", strings.Join(subcommandNames(specs), "|"))
+
+	// Flag values, by the flag before the cursor
+	b.WriteString("    case \"$prev\" in\n")
+	seen := make(map[string]bool)
+	for _, spec := range specs {
+		for _, f := range spec.Flags {
+			if f.Bool || seen[f.Name] {
+				continue
+			}
+			seen[f.Name] = true
+			fmt.Fprintf(&b, "        -%s|--%s)\n", f.Name, f.Name)
+			switch {
+			case f.Files:
+				b.WriteString("            COMPREPLY=($(compgen -f -- \"$cur\"))\n")
+			case len(f.Values) > 0:
+				fmt.Fprintf(&b, "            COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n", strings.Join(f.Values, " "))
+			}
+			b.WriteString("            return ;;\n")
+		}
+	}
+	b.WriteString("    esac\n\n")
+
+	// Flag names, by command
+	b.WriteString("    if [[ \"$cur\" == -* ]]; then\n        local opts\n        case \"$cmd\" in\n")
+	// The root command comes last, as the catch-all
+	for _, spec := range append(specs[1:], specs[0]) {
+		var names []string
+		for _, f := range spec.Flags {
+			names = append(names, "-"+f.Name)
+		}
+		label := spec.Name
+		if label == "" {
+			label = "*"
+		}
+		fmt.Fprintf(&b, "            %s) opts=\"%s\" ;;\n", label, strings.Join(names, " "))
+	}
+	b.WriteString("        esac\n        COMPREPLY=($(compgen -W \"$opts\" -- \"$cur\"))\n        return\n    fi\n\n")
+
+	// Positional arguments
+	for _, spec := range specs {
+		if len(spec.Args) > 0 {
+			fmt.Fprintf(&b, "    if [[ \"$cmd\" == %s ]]; then\n        COMPREPLY=($(compgen -W \"%s\" -- \"$cur\"))\n        return\n    fi\n", spec.Name, strings.Join(spec.Args, " "))
+		}
+	}
+	fmt.Fprintf(&b, "    if [[ $COMP_CWORD -eq 1 ]]; then\n        COMPREPLY=($(compgen -W \"%s\" -- \"$cur\") $(compgen -f -- \"$cur\"))\n    fi\n", strings.Join(subcommandNames(specs), " "))
+	b.WriteString("}\n\ncomplete -o default -F _token_counter token-counter\n")
+	return b.String()
+}
+
+// zshQuote escapes s for a single-quoted _arguments spec
+func zshQuote(s string) string {
+	s = strings.ReplaceAll(s, "'", `'\''`)
+	s = strings.ReplaceAll(s, "[", `\[`)
+	s = strings.ReplaceAll(s, "]", `\]`)
+	return s
+}
+
+// zshFunction returns the completion function name for a command
+func zshFunction(spec completionSpec) string {
+	if spec.Name == "" {
+		return "_token_counter_scan"
+	}
+	return "_token_counter_" + strings.ReplaceAll(spec.Name, "-", "_")
+}
+
+func zshCompletion(specs []completionSpec) string {
+	var b strings.Builder
+	b.WriteString("#compdef token-counter\n")
+	b.WriteString("# zsh completion for token-counter\n")
+	b.WriteString("# Load it with: source <(token-counter completion zsh)\n\n")
+
+	for _, spec := range specs {
+		fmt.Fprintf(&b, "%s() {\n    _arguments \\\n", zshFunction(spec))
+		for _, f := range spec.Flags {
+			fmt.Fprintf(&b, "        '-%s[%s]", f.Name, zshQuote(f.Usage))
+			switch {
+			case f.Bool:
+			case f.Files:
+				b.WriteString(":path:_files")
+			case len(f.Values) > 0:
+				fmt.Fprintf(&b, ":value:(%s)", strings.Join(f.Values, " "))
+			default:
+				b.WriteString(":value: ")
+			}
+			b.WriteString("' \\\n")
+		}
+		if len(spec.Args) > 0 {
+			fmt.Fprintf(&b, "        '1:argument:(%s)'\n", strings.Join(spec.Args, " "))
+		} else {
+			b.WriteString("        '*:path:_files'\n")
+		}
+		b.WriteString("}\n\n")
+	}
+
+	b.WriteString("_token_counter() {\n")
+	b.WriteString("    if (( CURRENT > 2 )); then\n        case $words[2] in\n")
+	for _, spec := range specs[1:] {
+		fmt.Fprintf(&b, "            %s) shift words; (( CURRENT-- )); %s; return ;;\n", spec.Name, zshFunction(spec))
+	}
+	b.WriteString("        esac\n    fi\n")
+	b.WriteString("    if (( CURRENT == 2 )) && [[ $PREFIX != -* ]]; then\n        local -a subcommands\n        subcommands=(\n")
+	for _, spec := range specs[1:] {
+		fmt.Fprintf(&b, "            '%s:%s'\n", spec.Name, strings.ReplaceAll(spec.Summary, "'", `'\''`))
+	}
+	b.WriteString("        )\n        _describe -t commands 'command' subcommands\n        _files\n        return\n    fi\n")
+	fmt.Fprintf(&b, "    %s\n}\n\n", zshFunction(specs[0]))
+	b.WriteString("if [[ $funcstack[1] == _token_counter ]]; then\n    _token_counter \"$@\"\nelse\n    compdef _token_counter token-counter\nfi\n")
+	return b.String()
+}
+
+// fishQuote quotes s for fish
+func fishQuote(s string) string {
+	return "'" + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), "'", `\'`) + "'"
+}
+
+func fishCompletion(specs []completionSpec) string {
+	var b strings.Builder
+	b.WriteString("# fish completion for token-counter\n")
+	b.WriteString("# Load it with: token-counter completion fish | source\n\n")
+
+	names := strings.Join(subcommandNames(specs), " ")
+	for _, spec := range specs[1:] {
+		fmt.Fprintf(&b, "complete -c token-counter -n __fish_use_subcommand -a %s -d %s\n", spec.Name, fishQuote(spec.Summary))
+	}
+
+	for _, spec := range specs {
+		condition := fishQuote("not __fish_seen_subcommand_from " + names)
+		if spec.Name != "" {
+			condition = fishQuote("__fish_seen_subcommand_from " + spec.Name)
+		}
+		b.WriteString("\n")
+		for _, f := range spec.Flags {
+			fmt.Fprintf(&b, "complete -c token-counter -n %s -o %s -d %s", condition, f.Name, fishQuote(f.Usage))
+			switch {
+			case f.Bool:
+			case f.Files:
+				b.WriteString(" -r -F")
+			case len(f.Values) > 0:
+				fmt.Fprintf(&b, " -x -a %s", fishQuote(strings.Join(f.Values, " ")))
+			default:
+				b.WriteString(" -x")
+			}
+			b.WriteString("\n")
+		}
+		if len(spec.Args) > 0 {
+			fmt.Fprintf(&b, "complete -c token-counter -n %s -f -a %s\n", condition, fishQuote(strings.Join(spec.Args, " ")))
+		}
+	}
+	return b.String()
+}
+
+// powershellList formats values as a PowerShell array of single-quoted strings
+func powershellList(values []string) string {
+	var quoted []string
+	for _, value := range values {
+		quoted = append(quoted, "'"+strings.ReplaceAll(value, "'", "''")+"'")
+	}
+	return "@(" + strings.Join(quoted, ", ") + ")"
+}
+
+func powershellCompletion(specs []completionSpec) string {
+	var b strings.Builder
+	b.WriteString("# PowerShell completion for token-counter\n")
+	b.WriteString("# Load it with: token-counter completion powershell | Out-String | Invoke-Expression\n\n")
+	b.WriteString("Register-ArgumentCompleter -Native -CommandName token-counter -ScriptBlock {\n")
+	b.WriteString("    param($wordToComplete, $commandAst, $cursorPosition)\n\n")
+
+	b.WriteString("    $flags = @{\n")
+	for _, spec := range specs {
+		var names []string
+		for _, f := range spec.Flags {
+			names = append(names, "-"+f.Name)
+		}
+		fmt.Fprintf(&b, "        '%s' = %s\n", spec.Name, powershellList(names))
+	}
+	b.WriteString("    }\n")
+
+	b.WriteString("    $values = @{\n")
+	seen := make(map[string]bool)
+	for _, spec := range specs {
+		for _, f := range spec.Flags {
+			if len(f.Values) > 0 && !seen[f.Name] {
+				seen[f.Name] = true
+				fmt.Fprintf(&b, "        '-%s' = %s\n", f.Name, powershellList(f.Values))
+			}
+		}
+	}
+	b.WriteString("    }\n")
+
+	b.WriteString("    $arguments = @{\n")
+	for _, spec := range specs {
+		if len(spec.Args) > 0 {
+			fmt.Fprintf(&b, "        '%s' = %s\n", spec.Name, powershellList(spec.Args))
+		}
+	}
+	b.WriteString("    }\n")
+	fmt.Fprintf(&b, "    $subcommands = %s\n\n", powershellList(subcommandNames(specs)))
+
+	b.WriteString(`    $words = @($commandAst.CommandElements | ForEach-Object { $_.ToString() })
+    $cmd = ''
+    if ($words.Count -gt 1 -and $subcommands -contains $words[1]) { $cmd = $words[1] }
+    $prev = if ($wordToComplete) { $words[-2] } else { $words[-1] }
+
+    # Returning nothing falls back to path completion
+    $candidates = @()
+    if ($values.ContainsKey($prev)) {
+        $candidates = $values[$prev]
+    } elseif ($wordToComplete -like '-*') {
+        $candidates = $flags[$cmd]
+    } elseif ($arguments.ContainsKey($cmd)) {
+        $candidates = $arguments[$cmd]
+    } elseif ($cmd -eq '' -and $words.Count -le 2) {
+        $candidates = $subcommands
+    }
+
+    $candidates | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+        [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_)
+    }
+}
+`)
+	return b.String()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestCompletionScripts(t *testing.T) {
+	tests := []struct {
+		shell string
+		check string // Command that checks the syntax of the script on stdin
+		want  []string
+	}{
+		{"bash", "bash", []string{"complete -o default -F _token_counter token-counter", "-model|--model)", "cl100k_base", "baseline) opts="}},
+		{"zsh", "zsh", []string{"#compdef token-counter", "cl100k_base"}},
+		{"fish", "fish", []string{"complete -c token-counter -n __fish_use_subcommand -a scan", "-o model"}},
+		{"powershell", "", []string{"Register-ArgumentCompleter -Native -CommandName token-counter", "cl100k_base"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.shell, func(t *testing.T) {
+			out := captureStdout(t, completionCommand(flagSetWith(t, tt.shell)))
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("%s script is missing %q", tt.shell, want)
+				}
+			}
+			for _, cmd := range commands {
+				if !strings.Contains(out, cmd.Name) {
+					t.Errorf("%s script doesn't complete %s", tt.shell, cmd.Name)
+				}
+			}
+			if tt.check == "" {
+				return
+			}
+			if _, err := exec.LookPath(tt.check); err != nil {
+				return
+			}
+			check := exec.Command(tt.check, "-n")
+			check.Stdin = strings.NewReader(out)
+			if msg, err := check.CombinedOutput(); err != nil {
+				t.Errorf("%s -n: %v: %s", tt.check, err, msg)
+			}
+		})
+	}
+}
+
+func TestCompletionUnknownShell(t *testing.T) {
+	stderr, code := exitStatus(t, func() { completionCommand(flagSetWith(t, "tcsh"))() })
+	if code != 1 || !strings.Contains(stderr, "Error: completion needs a shell: bash, zsh, fish, powershell") {
+		t.Errorf("exit %d, stderr:\n%s", code, stderr)
+	}
+}
+
+func TestFlagCompletions(t *testing.T) {
+	tests := []struct {
+		command, flag string
+		values        bool
+		files         bool
+	}{
+		{"scan", "model", true, false},
+		{"history", "format", true, false},
+		{"scan", "output", false, true},
+		{"scan", "min", false, false},
+	}
+	for _, tt := range tests {
+		values, files := flagCompletions(tt.command, tt.flag)
+		if (len(values) > 0) != tt.values || files != tt.files {
+			t.Errorf("flagCompletions(%q, %q) = %v, %v", tt.command, tt.flag, values, files)
+		}
+	}
+	if values, _ := flagCompletions("history", "format"); strings.Join(values, ",") != strings.Join(sortedKeys(historyFormats), ",") {
+		t.Errorf("history -format completes %v", values)
+	}
+}
+
+// flagSetWith returns a flag set with no flags parsed from args
+func flagSetWith(t *testing.T, args ...string) *flag.FlagSet {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFile is the config file looked for in the scan root
+const defaultConfigFile = ".token-counter.yaml"
+
+// Config is a repository's token-counter configuration
+type Config struct {
+	Plan        PlanConfig         `yaml:"plan"`
+	Hook        HookConfig         `yaml:"hook"`
+	Extensions  ExtensionConfig    `yaml:"extensions"`   // Extensions to skip or count as text, on top of -skip-ext and -text-ext
+	Profiles    map[string]Profile `yaml:"profiles"`     // Named sets of flags, selected with -profile
+	ModelRoutes []ModelRoute       `yaml:"model_routes"` // Models that count the files under these paths; the first match wins
+}
+
+// Profile sets flags by name, like include: ["docs/**"] or model: o200k_base.
+// Lists are joined with commas, as the flags take them.
+type Profile map[string]interface{}
+
+// PlanConfig configures the plan subcommand
+type PlanConfig struct {
+	Budget        tokenAmount        `yaml:"budget"`
+	Reserve       tokenAmount        `yaml:"reserve"`        // Of the budget, left out of the split
+	Weights       map[string]float64 `yaml:"weights"`        // Priority of each directory, by root-relative path
+	DefaultWeight *float64           `yaml:"default_weight"` // Weight of files under no listed directory (default 1)
+}
+
+// loadConfig reads the config file at path or, without one, the default
+// config file in root if there is one
+func loadConfig(root string, path string) (*Config, error) {
+	explicit := path != ""
+	if !explicit {
+		path = filepath.Join(root, defaultConfigFile)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			return &Config{}, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	config := &Config{}
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(config); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+	return config, nil
+}
+
+// profileOnlyFlags can't be set by a profile, since they choose it
+var profileOnlyFlags = map[string]bool{"profile": true, "config": true, "path": true}
+
+// applyProfile sets the flags of the -profile profile of the config file on
+// fs, except the ones given on the command line, which take precedence.
+// Flags other commands have are left alone, so a profile can be shared by
+// scan, export and the others.
+func applyProfile(fs *flag.FlagSet, options *CommandOptions) error {
+	if options.Profile == "" {
+		return nil
+	}
+	root := options.Path
+	if info, err := os.Stat(root); err == nil && !info.IsDir() {
+		root = filepath.Dir(root)
+	}
+	config, err := loadConfig(root, options.ConfigFile)
+	if err != nil {
+		return err
+	}
+	profile, ok := config.Profiles[options.Profile]
+	if !ok {
+		if len(config.Profiles) == 0 {
+			return fmt.Errorf("unknown profile %q: the config file has no profiles", options.Profile)
+		}
+		return fmt.Errorf("unknown profile %q (expected %s)", options.Profile, strings.Join(sortedKeys(config.Profiles), ", "))
+	}
+
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	for _, name := range sortedKeys(profile) {
+		flagName := strings.ReplaceAll(name, "_", "-")
+		if profileOnlyFlags[flagName] {
+			return fmt.Errorf("profile %s: %s can't be set in a profile", options.Profile, name)
+		}
+		if fs.Lookup(flagName) == nil {
+			if !isFlag(flagName) {
+				return fmt.Errorf("profile %s: unknown flag %q", options.Profile, name)
+			}
+			logger.Debug("profile setting not used by this command", "profile", options.Profile, "flag", flagName)
+			continue
+		}
+		if given[flagName] {
+			continue
+		}
+		if err := fs.Set(flagName, profileValue(profile[name])); err != nil {
+			return fmt.Errorf("profile %s: invalid value for %s: %v", options.Profile, name, err)
+		}
+	}
+	return nil
+}
+
+// profileValue formats a profile setting as a flag value
+func profileValue(value interface{}) string {
+	if list, ok := value.([]interface{}); ok {
+		items := make([]string, len(list))
+		for i, item := range list {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(value)
+}
+
+// isFlag reports whether any command has a flag with this name
+func isFlag(name string) bool {
+	for _, c := range commands {
+		if fs, _ := c.flagSet(); fs.Lookup(name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenAmount is a number of tokens that can be written with a k or m
+// suffix, like 128k
+type tokenAmount int
+
+// UnmarshalYAML accepts a number or a string like 128k
+func (t *tokenAmount) UnmarshalYAML(node *yaml.Node) error {
+	n, err := parseTokenAmount(node.Value)
+	if err != nil {
+		return err
+	}
+	*t = tokenAmount(n)
+	return nil
+}
+
+// parseTokenAmount parses a number of tokens with an optional k (thousand)
+// or m (million) suffix, as context windows are usually given
+func parseTokenAmount(value string) (int, error) {
+	number := strings.ToLower(strings.TrimSpace(strings.ReplaceAll(value, "_", "")))
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(number, "k"):
+		multiplier = 1e3
+	case strings.HasSuffix(number, "m"):
+		multiplier = 1e6
+	}
+	if multiplier > 1 {
+		number = number[:len(number)-1]
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid number of tokens %q (expected e.g. 128000 or 128k)", value)
+	}
+	return int(n * multiplier), nil
+}
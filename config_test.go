@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const profilesConfig = `profiles:
+  docs:
+    include: ["docs/**", "*.md"]
+    model: o200k_base
+    max_file_bytes: 1K
+    budget: 8k
+  bad-value:
+    max_file_bytes: lots
+  typo:
+    modle: gpt-4o
+  sneaky:
+    config: other.yaml
+`
+
+// profileOptions parses args with the flags of scan and applies the profile
+// they select from the config file of dir
+func profileOptions(t *testing.T, dir string, args ...string) (*CommandOptions, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	options := &CommandOptions{}
+	registerFlags(fs, options)
+	registerWalkFlags(fs, options)
+	registerReportFlags(fs, options)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	options.Path = dir
+	return options, applyProfile(fs, options)
+}
+
+func TestApplyProfile(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{defaultConfigFile: profilesConfig, "docs/a.md": "hello", "README.md": "readme"})
+
+	options, err := profileOptions(t, dir, "-profile", "docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(options.Include, []string{"docs/**", "*.md"}) || options.Model != "o200k_base" || options.MaxFileBytes != 1024 {
+		t.Errorf("profile set include %v, model %q, max-file-bytes %d", options.Include, options.Model, options.MaxFileBytes)
+	}
+
+	// The command line wins
+	options, err = profileOptions(t, dir, "-profile", "docs", "-model", "cl100k_base")
+	if err != nil || options.Model != "cl100k_base" || options.MaxFileBytes != 1024 {
+		t.Errorf("profile with -model given: model %q, max-file-bytes %d, %v", options.Model, options.MaxFileBytes, err)
+	}
+
+	// A file reads the config file of its directory
+	options, err = profileOptions(t, filepath.Join(dir, "README.md"), "-profile", "docs")
+	if err != nil || options.Model != "o200k_base" {
+		t.Errorf("profile of a file: model %q, %v", options.Model, err)
+	}
+
+	// Without -profile, the config file isn't needed
+	if _, err := profileOptions(t, t.TempDir()); err != nil {
+		t.Errorf("no profile: %v", err)
+	}
+}
+
+func TestApplyProfileErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{defaultConfigFile: profilesConfig, "empty/" + defaultConfigFile: "plan:\n  budget: 10\n", "broken/" + defaultConfigFile: "profiles: [\n"})
+	tests := []struct {
+		name    string
+		dir     string
+		profile string
+		want    string
+	}{
+		{"unknown", dir, "api", `unknown profile "api" (expected bad-value, docs, sneaky, typo)`},
+		{"no profiles", filepath.Join(dir, "empty"), "docs", `unknown profile "docs": the config file has no profiles`},
+		{"bad value", dir, "bad-value", `profile bad-value: invalid value for max_file_bytes: invalid size "lots"`},
+		{"unknown flag", dir, "typo", `profile typo: unknown flag "modle"`},
+		{"profile-only flag", dir, "sneaky", "profile sneaky: config can't be set in a profile"},
+		{"broken config", filepath.Join(dir, "broken"), "docs", "error reading " + filepath.Join(dir, "broken", defaultConfigFile)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := profileOptions(t, tt.dir, "-profile", tt.profile); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("applyProfile error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseTokenAmount(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"128000", 128000, false},
+		{"128k", 128000, false},
+		{"1.5M", 1500000, false},
+		{"200_000", 200000, false},
+		{"lots", 0, true},
+		{"-5k", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseTokenAmount(tt.value)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("parseTokenAmount(%q) = %d, %v, want %d (error %v)", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
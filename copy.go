@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+)
+
+// CopyOptions stores scan's options for copying the selected files to the
+// clipboard
+type CopyOptions struct {
+	Enabled bool
+	Top     int      // Copy only this many files, those with the most tokens (0 for all)
+	Select  []string // Copy only the files matching these gitignore-style patterns
+}
+
+// registerCopyFlags defines scan's clipboard flags
+func registerCopyFlags(fs *flag.FlagSet, copyOptions *CopyOptions) {
+	fs.BoolVar(&copyOptions.Enabled, "copy", false, "Copy the contents of the scanned files, with path headers and a token total, to the system clipboard")
+	fs.IntVar(&copyOptions.Top, "copy-top", 0, "With -copy, copy only the N files with the most tokens (0 for all)")
+	fs.Func("copy-select", "With -copy, copy only the files matching these comma-separated gitignore-style patterns", func(value string) error {
+		copyOptions.Select = splitList(value)
+		return nil
+	})
+}
+
+// copySelection copies the files of a scan picked by the copy options to the
+// clipboard as an export bundle, ending with a line giving the total, and
+// says what was copied on stderr
+func copySelection(repo *RepoTokenInfo, options *CommandOptions, copyOptions *CopyOptions) error {
+	rootPath := repo.Path
+	if options.IsSingleFile {
+		rootPath = filepath.Dir(repo.Path)
+	}
+
+	// The patterns are matched together like the lines of a .gitignore, so
+	// later ones like !*_test.go can exclude files again
+	var patterns *gitignore.GitIgnore
+	if len(copyOptions.Select) > 0 {
+		patterns = gitignore.CompileIgnoreLines(copyOptions.Select...)
+	}
+
+	var files []*FileTokenInfo
+	for _, dirInfo := range repo.Dirs {
+		for _, fileInfo := range dirInfo.Files {
+			relativePath, err := filepath.Rel(rootPath, fileInfo.Path)
+			if err != nil {
+				relativePath = fileInfo.Path
+			}
+			if patterns == nil || patterns.MatchesPath(filepath.ToSlash(relativePath)) {
+				files = append(files, fileInfo)
+			}
+		}
+	}
+	if copyOptions.Top > 0 && len(files) > copyOptions.Top {
+		sort.Slice(files, func(i, j int) bool {
+			if files[i].TokenCount != files[j].TokenCount {
+				return files[i].TokenCount > files[j].TokenCount
+			}
+			return files[i].Path < files[j].Path
+		})
+		files = files[:copyOptions.Top]
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no files to copy")
+	}
+
+	// Bundle just the selection, in path order
+	selection := &RepoTokenInfo{Path: repo.Path, Dirs: make(map[string]*DirTokenInfo)}
+	for _, fileInfo := range files {
+		selection.addFile(fileInfo)
+	}
+	bundle, included, _, tokens, err := buildBundle(selection, options, &ExportOptions{Order: "priority"})
+	repo.Errors = append(repo.Errors, selection.Errors...)
+	if err != nil {
+		return err
+	}
+	bundle += fmt.Sprintf("==> %d files, %s %s <==\n", included, formatCount(tokens), options.unitName())
+
+	if err := copyToClipboard(bundle); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Copied %d files (%s %s) to the clipboard\n", included, formatCount(tokens), options.unitName())
+	return nil
+}
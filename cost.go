@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// cachePricing is how a provider prices prompt caching, as multiples of its
+// input price
+type cachePricing struct {
+	Write float64 // Of writing tokens to the cache, on a miss
+	Read  float64 // Of reading tokens from the cache, on a hit
+}
+
+// cachePricings are the prompt caching prices of -cache-pricing. Anthropic
+// charges extra to write the cache (for the 5-minute cache) and a tenth of
+// the price to read it; OpenAI caches automatically, without a surcharge,
+// and discounts cached input by half.
+var cachePricings = map[string]cachePricing{
+	"anthropic": {Write: 1.25, Read: 0.1},
+	"openai":    {Write: 1, Read: 0.5},
+}
+
+// CostEstimate is what sending the scanned tokens as a prompt would cost, in
+// USD, without and with prompt caching
+type CostEstimate struct {
+	Price           float64 `json:"price"`                       // Per million input tokens
+	CacheWritePrice float64 `json:"cache_write_price,omitempty"` // Per million tokens written to the cache
+	CacheReadPrice  float64 `json:"cache_read_price,omitempty"`  // Per million tokens read from the cache
+	CacheHitRate    float64 `json:"cache_hit_rate,omitempty"`    // Share of the tokens read from the cache by a warm request
+	Cold            float64 `json:"cold"`                        // With nothing cached yet, so every token is written to the cache
+	Warm            float64 `json:"warm,omitempty"`              // At the hit rate, the rest written again
+}
+
+// parseCacheHitRate parses a share of the tokens, as 0.8 or 80%
+func parseCacheHitRate(value string) (float64, error) {
+	number, percent := strings.CutSuffix(strings.TrimSpace(value), "%")
+	rate, err := strconv.ParseFloat(number, 64)
+	if percent {
+		rate /= 100
+	}
+	if err != nil || rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("invalid cache hit rate %q (expected a share like 0.8 or 80%%)", value)
+	}
+	return rate, nil
+}
+
+// validateCost checks the prices of the cost estimate and fills in the cache
+// prices of -cache-pricing that weren't given
+func validateCost(options *CommandOptions) error {
+	if options.Price < 0 || options.CacheWritePrice < 0 || options.CacheReadPrice < 0 {
+		return fmt.Errorf("-price, -cache-write-price and -cache-read-price can't be negative")
+	}
+	if options.CachePricing != "" {
+		pricing, ok := cachePricings[options.CachePricing]
+		if !ok {
+			return fmt.Errorf("unknown cache pricing %q (expected %s)", options.CachePricing, strings.Join(sortedKeys(cachePricings), " or "))
+		}
+		if options.CacheWritePrice == 0 {
+			options.CacheWritePrice = options.Price * pricing.Write
+		}
+		if options.CacheReadPrice == 0 {
+			options.CacheReadPrice = options.Price * pricing.Read
+		}
+	}
+	cached := options.CachePricing != "" || options.CacheWritePrice > 0 || options.CacheReadPrice > 0
+	if cached && options.Price == 0 {
+		return fmt.Errorf("prompt caching prices need -price, the price of uncached input")
+	}
+	if options.CacheHitRate > 0 && options.CacheReadPrice == 0 {
+		return fmt.Errorf("-cache-hit-rate needs the price of cache reads, from -cache-pricing or -cache-read-price")
+	}
+	return nil
+}
+
+// estimateCost estimates the cost of sending tokens as a prompt, or returns
+// nil without a price. The cold cost writes every token to the cache, at the
+// input price if writing has no price of its own; the warm one reads the
+// hit rate of them from it and writes the rest again.
+func estimateCost(tokens int, options *CommandOptions) *CostEstimate {
+	if options.Price == 0 {
+		return nil
+	}
+	estimate := &CostEstimate{
+		Price:           options.Price,
+		CacheWritePrice: options.CacheWritePrice,
+		CacheReadPrice:  options.CacheReadPrice,
+		CacheHitRate:    options.CacheHitRate,
+	}
+	writePrice := options.CacheWritePrice
+	if writePrice == 0 {
+		writePrice = options.Price
+	}
+	millions := float64(tokens) / 1e6
+	estimate.Cold = millions * writePrice
+	if options.CacheHitRate > 0 {
+		estimate.Warm = millions * (options.CacheHitRate*options.CacheReadPrice + (1-options.CacheHitRate)*writePrice)
+	}
+	// Fractions of a cent that are only float noise make the JSON hard to read
+	estimate.Cold = math.Round(estimate.Cold*1e6) / 1e6
+	estimate.Warm = math.Round(estimate.Warm*1e6) / 1e6
+	return estimate
+}
+
+// costSummary describes a cost estimate on one line, like "$0.3750 cold,
+// $0.0675 warm at 80% cache hits"
+func costSummary(estimate *CostEstimate) string {
+	if estimate.CacheHitRate == 0 {
+		if estimate.CacheWritePrice > 0 && estimate.CacheWritePrice != estimate.Price {
+			return fmt.Sprintf("$%.4f cold, writing the cache at $%g per million tokens", estimate.Cold, estimate.CacheWritePrice)
+		}
+		return fmt.Sprintf("$%.4f at $%g per million tokens", estimate.Cold, estimate.Price)
+	}
+	return fmt.Sprintf("$%.4f cold, $%.4f warm at %g%% cache hits", estimate.Cold, estimate.Warm, estimate.CacheHitRate*100)
+}
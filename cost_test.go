@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCacheHitRate(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    float64
+		wantErr bool
+	}{
+		{"0.8", 0.8, false},
+		{"80%", 0.8, false},
+		{" 100% ", 1, false},
+		{"0", 0, false},
+		{"1.5", 0, true},
+		{"-10%", 0, true},
+		{"most", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseCacheHitRate(tt.value)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("parseCacheHitRate = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateCost(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		write   float64
+		read    float64
+		wantErr string
+	}{
+		{"no price", nil, 0, 0, ""},
+		{"anthropic", []string{"-price", "2", "-cache-pricing", "anthropic"}, 2.5, 0.2, ""},
+		{"openai", []string{"-price", "2", "-cache-pricing", "openai"}, 2, 1, ""},
+		{"explicit prices", []string{"-price", "3", "-cache-pricing", "anthropic", "-cache-read-price", "0.5"}, 3.75, 0.5, ""},
+		{"negative", []string{"-price", "-1"}, 0, 0, "-price, -cache-write-price and -cache-read-price can't be negative"},
+		{"unknown pricing", []string{"-price", "3", "-cache-pricing", "gemini"}, 0, 0, `unknown cache pricing "gemini" (expected anthropic or openai)`},
+		{"without -price", []string{"-cache-write-price", "3"}, 0, 0, "prompt caching prices need -price, the price of uncached input"},
+		{"hit rate without reads", []string{"-price", "3", "-cache-hit-rate", "80%"}, 0, 0, "-cache-hit-rate needs the price of cache reads"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := testOptions(t, tt.args...)
+			err := validateCost(options)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("validateCost error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if options.CacheWritePrice != tt.write || options.CacheReadPrice != tt.read {
+				t.Errorf("cache prices %v and %v, want %v and %v", options.CacheWritePrice, options.CacheReadPrice, tt.write, tt.read)
+			}
+		})
+	}
+}
+
+func TestEstimateCost(t *testing.T) {
+	tests := []struct {
+		name    string
+		options CommandOptions
+		cold    float64
+		warm    float64
+		summary string
+	}{
+		{"input only", CommandOptions{Price: 3}, 0.9, 0, "$0.9000 at $3 per million tokens"},
+		{"cache writes", CommandOptions{Price: 3, CacheWritePrice: 3.75}, 1.125, 0, "$1.1250 cold, writing the cache at $3.75 per million tokens"},
+		{"warm", CommandOptions{Price: 3, CacheWritePrice: 3.75, CacheReadPrice: 0.3, CacheHitRate: 0.8}, 1.125, 0.297, "$1.1250 cold, $0.2970 warm at 80% cache hits"},
+		{"reads without a write price", CommandOptions{Price: 2, CacheReadPrice: 1, CacheHitRate: 0.5}, 0.6, 0.45, "$0.6000 cold, $0.4500 warm at 50% cache hits"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			estimate := estimateCost(300000, &tt.options)
+			if estimate.Cold != tt.cold || estimate.Warm != tt.warm {
+				t.Errorf("estimate %+v, want %v cold and %v warm", estimate, tt.cold, tt.warm)
+			}
+			if got := costSummary(estimate); got != tt.summary {
+				t.Errorf("costSummary = %q, want %q", got, tt.summary)
+			}
+		})
+	}
+	if estimate := estimateCost(300000, &CommandOptions{}); estimate != nil {
+		t.Errorf("estimate without a price %+v", estimate)
+	}
+}
+
+func TestScanCost(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world"})
+	out := captureStdout(t, func() {
+		findCommand("scan").run([]string{"-model", "cl100k_base", "-price", "3", "-cache-pricing", "anthropic", "-cache-hit-rate", "0.9", dir})
+	})
+	if !strings.Contains(out, "Estimated cost: $0.0000 cold, $0.0000 warm at 90% cache hits\n") {
+		t.Errorf("scan printed:\n%s", out)
+	}
+	stderr, code := exitStatus(t, func() { findCommand("scan").run([]string{"-cache-pricing", "openai", dir}) })
+	if code != 1 || !strings.Contains(stderr, "Error: prompt caching prices need -price") {
+		t.Errorf("exit %d, stderr:\n%s", code, stderr)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiClient is the HTTP client of requests to counting APIs
+var apiClient = &http.Client{Timeout: time.Minute}
+
+// apiSettings are the limits of requests to counting APIs, shared by every
+// API counter and set by the -api-* flags
+var apiSettings = struct {
+	Concurrency int  // Requests in flight at once, and files counted at once by a scan
+	Retries     int  // Retries of a request that failed with a rate limit, server or network error
+	Cache       bool // Whether to keep counts in the on-disk cache
+}{Concurrency: 4, Retries: 4, Cache: true}
+
+// apiSlots limits the requests in flight to apiSettings.Concurrency. It's
+// made on first use, after the flags are parsed.
+var (
+	apiSlots     chan struct{}
+	apiSlotsOnce sync.Once
+)
+
+// apiCounter is the tokenizer of models whose tokens are counted by a service
+// rather than a local tokenizer
+type apiCounter struct {
+	model string
+	count func(text string) (int, error)
+	cache bool // Whether counts may be cached, i.e. the model behind the name doesn't change
+}
+
+// Name returns the model name
+func (c *apiCounter) Name() string {
+	return c.model
+}
+
+// Count counts the tokens of text with the service, or takes the count from
+// the cache
+func (c *apiCounter) Count(text string) (int, error) {
+	if text == "" {
+		return 0, nil
+	}
+
+	cache := c.cache && apiSettings.Cache
+	key := c.cacheKey(text)
+	if cache {
+		if count, ok := readCachedCount(key); ok {
+			return count, nil
+		}
+	}
+
+	count, err := c.countWithRetries(text)
+	if err != nil {
+		return 0, err
+	}
+	if cache {
+		writeCachedCount(key, count)
+	}
+	return count, nil
+}
+
+// countWithRetries sends the count request once a slot is free, retrying it
+// with exponential backoff while it fails with a retryable error
+func (c *apiCounter) countWithRetries(text string) (int, error) {
+	apiSlotsOnce.Do(func() {
+		apiSlots = make(chan struct{}, max(apiSettings.Concurrency, 1))
+	})
+
+	for attempt := 0; ; attempt++ {
+		apiSlots <- struct{}{}
+		count, err := c.count(text)
+		<-apiSlots
+		if err == nil {
+			return count, nil
+		}
+
+		wait, retryable := retryDelay(err, attempt)
+		if !retryable || attempt >= apiSettings.Retries {
+			return 0, err
+		}
+		logger.Warn("retrying count request", "model", c.model, "attempt", attempt+1, "wait", wait, "err", err)
+		time.Sleep(wait)
+	}
+}
+
+// retryDelay reports whether a failed request is worth retrying, and how long
+// to wait first: what the server asked for with Retry-After, or an
+// exponentially growing delay with jitter, capped at 30 seconds
+func retryDelay(err error, attempt int) (time.Duration, bool) {
+	var apiErr *apiError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &apiErr):
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout, 529: // 529 is Anthropic's "overloaded"
+		default:
+			return 0, false
+		}
+		if apiErr.RetryAfter > 0 {
+			return apiErr.RetryAfter, true
+		}
+	case errors.As(err, &netErr):
+	default:
+		return 0, false
+	}
+
+	wait := min(500*time.Millisecond<<attempt, 30*time.Second)
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1)), true
+}
+
+// cacheKey identifies a count in the cache by the model and the text's hash
+func (c *apiCounter) cacheKey(text string) string {
+	sum := sha256.Sum256([]byte(c.model + "\x00" + text))
+	return hex.EncodeToString(sum[:])
+}
+
+// apiCacheDir returns the directory of the on-disk count cache, under the
+// user's cache directory
+func apiCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "token-counter", "counts"), nil
+}
+
+// cachePath returns the file a count is cached in. Keys are spread over
+// subdirectories by their first byte to keep directories small.
+func cachePath(key string) (string, error) {
+	dir, err := apiCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, key[:2], key), nil
+}
+
+// readCachedCount returns a count from the cache, if it's there
+func readCachedCount(key string) (int, bool) {
+	path, err := cachePath(key)
+	if err != nil {
+		return 0, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	return count, err == nil
+}
+
+// writeCachedCount stores a count in the cache. The cache is only an
+// optimization, so failures are logged rather than returned.
+func writeCachedCount(key string, count int) {
+	path, err := cachePath(key)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0755)
+	}
+	if err == nil {
+		// Write to a temporary file first so concurrent readers never see a
+		// partial count
+		tmp := fmt.Sprintf("%s.%d.tmp", path, os.Getpid())
+		if err = os.WriteFile(tmp, []byte(strconv.Itoa(count)), 0644); err == nil {
+			err = os.Rename(tmp, path)
+		}
+	}
+	if err != nil {
+		logger.Debug("not caching count", "err", err)
+	}
+}
+
+// usesAPI reports whether any of encs counts with a remote service
+func usesAPI(encs []namedCodec) bool {
+	for _, enc := range encs {
+		if _, ok := enc.Codec.(*apiCounter); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// apiError is returned for a request a counting API answered with an error
+// status
+type apiError struct {
+	Status     string
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration // From the Retry-After header, if any
+}
+
+func (e *apiError) Error() string {
+	if e.Message == "" {
+		return e.Status
+	}
+	return e.Status + ": " + e.Message
+}
+
+// postJSON posts request as JSON to url and decodes the response into
+// response. Error responses become an *apiError, with the message taken from
+// an {"error": {"message": ...}} or {"error": "..."} body.
+func postJSON(url string, header http.Header, request any, response any) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header = header.Clone()
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := apiClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &apiError{Status: resp.Status, StatusCode: resp.StatusCode}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			apiErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		var nested struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		var flat struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &nested) == nil && nested.Error.Message != "" {
+			apiErr.Message = nested.Error.Message
+		} else if json.Unmarshal(data, &flat) == nil {
+			apiErr.Message = flat.Error
+		}
+		return apiErr
+	}
+	return json.Unmarshal(data, response)
+}
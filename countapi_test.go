@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		attempt   int
+		retryable bool
+		min, max  time.Duration
+	}{
+		{"rate limited", &apiError{StatusCode: 429}, 0, true, 250 * time.Millisecond, 500 * time.Millisecond},
+		{"retry after", &apiError{StatusCode: 429, RetryAfter: 7 * time.Second}, 3, true, 7 * time.Second, 7 * time.Second},
+		{"overloaded, later attempt", &apiError{StatusCode: 529}, 2, true, time.Second, 2 * time.Second},
+		{"capped", &apiError{StatusCode: 503}, 20, true, 15 * time.Second, 30 * time.Second},
+		{"bad request", &apiError{StatusCode: 400}, 0, false, 0, 0},
+		{"timeout", &httpTimeout{}, 0, true, 250 * time.Millisecond, 500 * time.Millisecond},
+		{"other", errors.New("boom"), 0, false, 0, 0},
+	}
+	for _, tt := range tests {
+		wait, retryable := retryDelay(tt.err, tt.attempt)
+		if retryable != tt.retryable || wait < tt.min || wait > tt.max {
+			t.Errorf("%s: retryDelay = %v, %v, want %v between %v and %v", tt.name, wait, retryable, tt.retryable, tt.min, tt.max)
+		}
+	}
+}
+
+// httpTimeout is a net.Error for a timed out request
+type httpTimeout struct{}
+
+func (*httpTimeout) Error() string   { return "timeout" }
+func (*httpTimeout) Timeout() bool   { return true }
+func (*httpTimeout) Temporary() bool { return true }
+
+func TestPostJSONErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		header string
+		body   string
+		want   apiError
+	}{
+		{"nested", 400, "", `{"error": {"message": "bad model"}}`, apiError{Status: "400 Bad Request", StatusCode: 400, Message: "bad model"}},
+		{"flat", 404, "", `{"error": "not found"}`, apiError{Status: "404 Not Found", StatusCode: 404, Message: "not found"}},
+		{"plain", 500, "", "oops", apiError{Status: "500 Internal Server Error", StatusCode: 500}},
+		{"retry after", 429, "3", "{}", apiError{Status: "429 Too Many Requests", StatusCode: 429, RetryAfter: 3 * time.Second}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.header != "" {
+					w.Header().Set("Retry-After", tt.header)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+			var response struct{}
+			err := postJSON(server.URL, make(http.Header), map[string]string{}, &response)
+			var apiErr *apiError
+			if !errors.As(err, &apiErr) || *apiErr != tt.want {
+				t.Errorf("postJSON error = %#v, want %#v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPICounterRetries(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	defer func(retries int) { apiSettings.Retries = retries }(apiSettings.Retries)
+
+	tests := []struct {
+		name     string
+		failures []error // Errors of the attempts before the one that succeeds
+		retries  int
+		wantErr  bool
+		attempts int
+	}{
+		{"first try", nil, 4, false, 1},
+		{"after an overload", []error{&apiError{StatusCode: 529}}, 4, false, 2},
+		{"out of retries", []error{&apiError{StatusCode: 503}}, 0, true, 1},
+		{"not retryable", []error{&apiError{StatusCode: 401}}, 4, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiSettings.Retries = tt.retries
+			attempts := 0
+			c := &apiCounter{model: "fake", count: func(text string) (int, error) {
+				attempts++
+				if attempts <= len(tt.failures) {
+					return 0, tt.failures[attempts-1]
+				}
+				return 42, nil
+			}}
+			got, err := c.Count(tt.name)
+			if (err != nil) != tt.wantErr || attempts != tt.attempts || err == nil && got != 42 {
+				t.Errorf("Count = %d, %v after %d attempts, want error %v after %d", got, err, attempts, tt.wantErr, tt.attempts)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+// Package counter counts tokens for Go programs: of a string, of a stream as
+// it flows past, and of the files of a directory, kept current as they change
+// with an Index. The functions that can take long, reading a stream or a
+// directory, stop when their context is canceled.
+//
+// Models are looked up in the registry of the tokenizers package. Outside the
+// token-counter binary, which registers HuggingFace tokenizer.json files and
+// the API counters there too, the tiktoken encodings, like cl100k_base and
+// o200k_base, are available without registering anything.
+package counter
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tiktoken-go/tokenizer"
+
+	"token-counter/tokenizers"
+)
+
+// Tokenizer returns the tokenizer of model: the one registered for it with
+// the tokenizers package, or else the tiktoken encoding of that name
+func Tokenizer(model string) (tokenizers.Tokenizer, error) {
+	tok, err := tokenizers.New(model)
+	if err == nil {
+		return tok, nil
+	}
+	if codec, getErr := tokenizer.Get(tokenizer.Encoding(model)); getErr == nil {
+		return tiktoken{codec}, nil
+	}
+	return nil, err
+}
+
+// tiktoken counts with a tiktoken encoding that isn't registered
+type tiktoken struct {
+	codec tokenizer.Codec
+}
+
+// Count returns the number of tokens text encodes to
+func (t tiktoken) Count(text string) (int, error) {
+	ids, _, err := t.codec.Encode(text)
+	return len(ids), err
+}
+
+// Name returns the name of the encoding
+func (t tiktoken) Name() string {
+	return t.codec.GetName()
+}
+
+// Count returns the number of tokens of text with model
+func Count(text string, model string) (int, error) {
+	tok, err := Tokenizer(model)
+	if err != nil {
+		return 0, err
+	}
+	return tok.Count(text)
+}
+
+// CountUnits counts text in unit: words, chars (Unicode code points), bytes,
+// or tokens with tok otherwise
+func CountUnits(text string, tok tokenizers.Tokenizer, unit string) (int, error) {
+	switch unit {
+	case "words":
+		return CountWords(text), nil
+	case "chars":
+		return utf8.RuneCountInString(text), nil
+	case "bytes":
+		return len(text), nil
+	default:
+		return tok.Count(text)
+	}
+}
+
+// CountWords counts whitespace-separated words. Scripts written without
+// spaces (Chinese, Japanese) count each character as a word, which is how
+// word counts are usually billed for them.
+func CountWords(text string) int {
+	words := 0
+	inWord := false
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r):
+			words++
+			inWord = false
+		case unicode.IsSpace(r):
+			inWord = false
+		default:
+			if !inWord {
+				words++
+				inWord = true
+			}
+		}
+	}
+	return words
+}
@@ -0,0 +1,117 @@
+package counter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCount(t *testing.T) {
+	tests := []struct {
+		text    string
+		model   string
+		want    int
+		wantErr bool
+	}{
+		{"hello world", "cl100k_base", 2, false},
+		{"", "cl100k_base", 0, false},
+		{"hello world", "o200k_base", 2, false},
+		{"hello world", "no-such-model", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := Count(tt.text, tt.model)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("Count(%q, %q) = %d, %v, want %d (error %v)", tt.text, tt.model, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestCountUnits(t *testing.T) {
+	tests := []struct {
+		text string
+		unit string
+		want int
+	}{
+		{"hello wide world", "words", 3},
+		{"日本語", "words", 3},
+		{"héllo", "chars", 5},
+		{"héllo", "bytes", 6},
+		{"hello world", "tokens", 2},
+	}
+	tok, err := Tokenizer("cl100k_base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		got, err := CountUnits(tt.text, tok, tt.unit)
+		if err != nil || got != tt.want {
+			t.Errorf("CountUnits(%q, %q) = %d, %v, want %d", tt.text, tt.unit, got, err, tt.want)
+		}
+	}
+}
+
+func TestCountReader(t *testing.T) {
+	lines := strings.Repeat("func main() {\n\tfmt.Println(\"hello, world\")\n}\n\n", 2000)
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"empty", ""},
+		{"one line", "hello world"},
+		{"many lines", lines},
+		{"one long line", strings.Repeat("word ", maxPending/4)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := Count(tt.text, "cl100k_base")
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Read in small pieces, so the text is split many times
+			got, err := CountReader(io.LimitReader(strings.NewReader(tt.text), int64(len(tt.text))), "cl100k_base")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("CountReader = %d, want %d", got, want)
+			}
+		})
+	}
+
+	if _, err := CountReader(strings.NewReader("x"), "no-such-model"); err == nil {
+		t.Error("CountReader with an unknown model succeeded")
+	}
+}
+
+func TestCountWriter(t *testing.T) {
+	text := strings.Repeat("line of text\n", 500)
+	want, err := Count(text, "cl100k_base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewCountWriter("cl100k_base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < len(text); i += 7 {
+		if _, err := w.Write([]byte(text[i:min(i+7, len(text))])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := w.Count(); err != nil || got != want {
+		t.Errorf("Count() = %d, %v, want %d", got, err, want)
+	}
+}
+
+func TestCountReaderContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := CountReaderContext(ctx, strings.NewReader("hello"), "cl100k_base"); !errors.Is(err, context.Canceled) {
+		t.Errorf("CountReaderContext with a canceled context = %v, want context.Canceled", err)
+	}
+	if got, err := CountReaderContext(context.Background(), strings.NewReader("hello world"), "cl100k_base"); err != nil || got != 2 {
+		t.Errorf("CountReaderContext = %d, %v, want 2", got, err)
+	}
+}
@@ -0,0 +1,393 @@
+package counter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+
+	"token-counter/tokenizers"
+)
+
+// sniffSize is how much of a file is checked for NUL bytes, which mark it as
+// binary, like git does
+const sniffSize = 8000
+
+// Index holds the token counts of the text files under a directory and keeps
+// them current as files change. Update recounts only the files it's given
+// and adjusts the directory and total counts by the difference, so an editor
+// can call it on every save instead of counting the directory again. An
+// Index is safe for concurrent use.
+//
+// Its rules are a subset of a token-counter scan's, so its counts can
+// differ from the CLI's: it skips hidden files and directories, like .git,
+// the paths the root's .gitignore matches, symlinks and files with a NUL byte
+// in their first 8000 bytes, and counts every other file as UTF-8 text. Unlike
+// the CLI, it doesn't count symlinked files, doesn't apply the .gitignore
+// files of subdirectories, .git/info/exclude, core.excludesFile, .tokenignore
+// or .gitattributes, doesn't skip the extensions the CLI skips, like images
+// and lock files, and doesn't transcode UTF-16 or Latin-1 files. A file that
+// can't be read or counted is left out and its error kept, for Errors, as the
+// CLI lists it under Errors.
+type Index struct {
+	root string
+	tok  tokenizers.Tokenizer
+
+	mu      sync.RWMutex
+	ignorer *gitignore.GitIgnore
+	files   map[string]indexedFile // By path relative to the root, with forward slashes
+	dirs    map[string]*dirCount   // By path relative to the root, "." for the root
+	errs    map[string]error       // Files that couldn't be read or counted, by path like files
+	total   int
+}
+
+// dirCount totals the indexed files directly in a directory
+type dirCount struct {
+	tokens int
+	files  int
+}
+
+// indexedFile is the count of a file and the stamp it was counted at
+type indexedFile struct {
+	tokens int
+	stamp  stamp
+}
+
+// stamp identifies the contents of a file by its modification time and size
+type stamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// statStamp returns the stamp of the file at path, or the zero stamp if it
+// doesn't exist
+func statStamp(path string) stamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return stamp{}
+	}
+	return stamp{info.ModTime(), info.Size()}
+}
+
+// NewIndex counts the files under root with model, looked up like Tokenizer,
+// and returns an index of them. It stops with the context's error once ctx
+// is done.
+func NewIndex(ctx context.Context, root string, model string) (*Index, error) {
+	tok, err := Tokenizer(model)
+	if err != nil {
+		return nil, err
+	}
+	return NewTokenizerIndex(ctx, root, tok)
+}
+
+// NewTokenizerIndex is NewIndex counting with tok
+func NewTokenizerIndex(ctx context.Context, root string, tok tokenizers.Tokenizer) (*Index, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+	ix := &Index{root: filepath.Clean(root), tok: tok}
+	if err := ix.Rescan(ctx); err != nil {
+		return nil, err
+	}
+	return ix, nil
+}
+
+// Rescan replaces the index with a count of every file under the root. It
+// fails only if the root can't be read or ctx is done; the files and
+// directories under it that can't be read are kept for Errors.
+func (ix *Index) Rescan(ctx context.Context) error {
+	ignorer, _ := gitignore.CompileIgnoreFile(filepath.Join(ix.root, ".gitignore"))
+	files := make(map[string]indexedFile)
+	dirs := make(map[string]*dirCount)
+	errs := make(map[string]error)
+	total := 0
+	err := filepath.WalkDir(ix.root, func(file string, entry os.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		rel, _ := filepath.Rel(ix.root, file)
+		rel = filepath.ToSlash(rel)
+		if err != nil {
+			if rel == "." {
+				return err
+			}
+			errs[rel] = err
+			return nil
+		}
+		if entry.IsDir() {
+			if rel != "." && skips(rel, ignorer) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() || skips(rel, ignorer) {
+			return nil
+		}
+		before := statStamp(file)
+		tokens, ok, err := ix.count(file)
+		if err != nil {
+			errs[rel] = err
+			return nil
+		}
+		if ok {
+			files[rel] = indexedFile{tokens, before}
+			addToDir(dirs, rel, tokens, 1)
+			total += tokens
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.ignorer, ix.files, ix.dirs, ix.errs, ix.total = ignorer, files, dirs, errs, total
+	return nil
+}
+
+// Update recounts the given files, which may have been changed, created or
+// deleted since they were counted. Paths are absolute or relative to the
+// current directory and must be inside the root. A directory stands for the
+// files in it now and those indexed under it before. A change to the root's
+// .gitignore makes the whole root be counted again, since it can change
+// which files are counted. A file that can't be read or counted any more is
+// taken out of the counts and kept for Errors. Update stops with the
+// context's error once ctx is done, keeping the files it recounted so far.
+func (ix *Index) Update(ctx context.Context, paths []string) error {
+	var rels []string
+	for _, p := range paths {
+		rel, err := ix.relative(p)
+		if err != nil {
+			return err
+		}
+		if rel == ".gitignore" {
+			return ix.Rescan(ctx)
+		}
+		rels = append(rels, ix.expand(rel)...)
+	}
+
+	ix.mu.RLock()
+	ignorer := ix.ignorer
+	ix.mu.RUnlock()
+	for _, rel := range rels {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		file := filepath.Join(ix.root, filepath.FromSlash(rel))
+		before := statStamp(file)
+		ix.mu.RLock()
+		old, indexed := ix.files[rel]
+		ix.mu.RUnlock()
+		if indexed && old.stamp == before {
+			continue
+		}
+
+		tokens, ok := 0, false
+		var countErr error
+		if !skips(rel, ignorer) && !skipsParent(rel, ignorer) {
+			tokens, ok, countErr = ix.count(file)
+		}
+
+		ix.mu.Lock()
+		// Updates of the same file can overlap. A count the file changed
+		// during is left for the Update of that change to replace.
+		if ok && statStamp(file) != before {
+			ix.mu.Unlock()
+			continue
+		}
+		if old, indexed := ix.files[rel]; indexed {
+			addToDir(ix.dirs, rel, -old.tokens, -1)
+			ix.total -= old.tokens
+			delete(ix.files, rel)
+		}
+		delete(ix.errs, rel)
+		if countErr != nil {
+			ix.errs[rel] = countErr
+		}
+		if ok {
+			ix.files[rel] = indexedFile{tokens, before}
+			addToDir(ix.dirs, rel, tokens, 1)
+			ix.total += tokens
+		}
+		ix.mu.Unlock()
+	}
+	return nil
+}
+
+// count returns the tokens of file, and whether it's a regular text file that
+// is counted at all
+func (ix *Index) count(file string) (int, bool, error) {
+	info, err := os.Lstat(file)
+	if err != nil || !info.Mode().IsRegular() {
+		return 0, false, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	if bytes.IndexByte(data[:min(len(data), sniffSize)], 0) >= 0 {
+		return 0, false, nil
+	}
+	tokens, err := ix.tok.Count(string(data))
+	if err != nil {
+		return 0, false, err
+	}
+	return tokens, true, nil
+}
+
+// relative returns path relative to the root, with forward slashes, or an
+// error if it's outside the root
+func (ix *Index) relative(p string) (string, error) {
+	absRoot, err := filepath.Abs(ix.root)
+	if err != nil {
+		return "", err
+	}
+	absPath, err := filepath.Abs(p)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absRoot, absPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside %s", p, ix.root)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// expand returns the files a relative path stands for: the path itself, or
+// for a directory, the files under it now and in the index
+func (ix *Index) expand(rel string) []string {
+	rels := []string{rel}
+	prefix := rel + "/"
+	if rel == "." {
+		prefix = ""
+	}
+	ix.mu.RLock()
+	for indexed := range ix.files {
+		if strings.HasPrefix(indexed, prefix) {
+			rels = append(rels, indexed)
+		}
+	}
+	ix.mu.RUnlock()
+
+	dir := filepath.Join(ix.root, filepath.FromSlash(rel))
+	if info, err := os.Lstat(dir); err != nil || !info.IsDir() {
+		return rels
+	}
+	filepath.WalkDir(dir, func(file string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !entry.IsDir() {
+			rel, _ := filepath.Rel(ix.root, file)
+			rels = append(rels, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return rels
+}
+
+// addToDir adds files with tokens to the count of the directory of rel, or
+// takes them out for negative numbers, dropping the directory once it has no
+// files
+func addToDir(dirs map[string]*dirCount, rel string, tokens int, files int) {
+	dir := path.Dir(rel)
+	count, ok := dirs[dir]
+	if !ok {
+		count = &dirCount{}
+		dirs[dir] = count
+	}
+	count.tokens += tokens
+	count.files += files
+	if count.files == 0 {
+		delete(dirs, dir)
+	}
+}
+
+// TokenCount returns the total count of the files under the root
+func (ix *Index) TokenCount() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.total
+}
+
+// File returns the count of a file, if it's in the index
+func (ix *Index) File(p string) (int, bool) {
+	rel, err := ix.relative(p)
+	if err != nil {
+		return 0, false
+	}
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	file, ok := ix.files[rel]
+	return file.tokens, ok
+}
+
+// Files returns the counts of the indexed files by their paths relative to
+// the root, with forward slashes
+func (ix *Index) Files() map[string]int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	files := make(map[string]int, len(ix.files))
+	for rel, file := range ix.files {
+		files[rel] = file.tokens
+	}
+	return files
+}
+
+// Dirs returns the counts of the files directly in each directory with any,
+// by their paths relative to the root, with forward slashes and "." for the
+// root
+func (ix *Index) Dirs() map[string]int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	dirs := make(map[string]int, len(ix.dirs))
+	for rel, count := range ix.dirs {
+		dirs[rel] = count.tokens
+	}
+	return dirs
+}
+
+// Errors returns the errors of the files and directories that couldn't be
+// read or counted, by their paths relative to the root, with forward slashes
+func (ix *Index) Errors() map[string]error {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	errs := make(map[string]error, len(ix.errs))
+	for rel, err := range ix.errs {
+		errs[rel] = err
+	}
+	return errs
+}
+
+// skips reports whether the file or directory at rel is left out, with
+// everything under it for a directory: if it's hidden or the root's
+// .gitignore matches it
+func skips(rel string, ignorer *gitignore.GitIgnore) bool {
+	return strings.HasPrefix(path.Base(rel), ".") || ignorer != nil && ignorer.MatchesPath(rel)
+}
+
+// skipsParent reports whether a parent directory of the file at rel is left
+// out
+func skipsParent(rel string, ignorer *gitignore.GitIgnore) bool {
+	for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+		if skips(dir, ignorer) {
+			return true
+		}
+	}
+	return false
+}
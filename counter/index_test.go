@@ -0,0 +1,218 @@
+package counter
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// wordTokenizer counts the words of text, and fails on text containing FAIL
+type wordTokenizer struct{}
+
+func (wordTokenizer) Count(text string) (int, error) {
+	if strings.Contains(text, "FAIL") {
+		return 0, errors.New("can't count")
+	}
+	return len(strings.Fields(text)), nil
+}
+
+func (wordTokenizer) Name() string { return "words" }
+
+// writeTree creates the files under dir, by slash-separated path
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestIndexRescan(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  map[string]int
+	}{
+		{
+			name:  "text files",
+			files: map[string]string{"a.txt": "one two", "sub/b.txt": "three"},
+			want:  map[string]int{"a.txt": 2, "sub/b.txt": 1},
+		},
+		{
+			name:  "hidden files and directories",
+			files: map[string]string{".env": "x", ".git/config": "x", "a.txt": "one"},
+			want:  map[string]int{"a.txt": 1},
+		},
+		{
+			name:  "root .gitignore",
+			files: map[string]string{".gitignore": "build/\n*.log\n", "build/out.txt": "x", "run.log": "x", "a.txt": "one"},
+			want:  map[string]int{"a.txt": 1},
+		},
+		{
+			name:  "binary files",
+			files: map[string]string{"blob.bin": "one\x00two", "a.txt": "one"},
+			want:  map[string]int{"a.txt": 1},
+		},
+		// The differences from a scan, which would leave these files out
+		{
+			name:  "nested .gitignore isn't applied",
+			files: map[string]string{"sub/.gitignore": "*.txt\n", "sub/b.txt": "one"},
+			want:  map[string]int{"sub/b.txt": 1},
+		},
+		{
+			name:  ".tokenignore isn't applied",
+			files: map[string]string{".tokenignore": "b.txt\n", "b.txt": "one"},
+			want:  map[string]int{"b.txt": 1},
+		},
+		{
+			name:  "skipped extensions are counted",
+			files: map[string]string{"go.sum": "one two", "image.svg": "<svg/>"},
+			want:  map[string]int{"go.sum": 2, "image.svg": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, tt.files)
+			ix, err := NewTokenizerIndex(context.Background(), dir, wordTokenizer{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ix.Files(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Files() = %v, want %v", got, tt.want)
+			}
+			total := 0
+			for _, tokens := range tt.want {
+				total += tokens
+			}
+			if got := ix.TokenCount(); got != total {
+				t.Errorf("TokenCount() = %d, want %d", got, total)
+			}
+		})
+	}
+}
+
+func TestIndexErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "one two", "bad.txt": "FAIL here"})
+	ix, err := NewTokenizerIndex(context.Background(), dir, wordTokenizer{})
+	if err != nil {
+		t.Fatalf("NewTokenizerIndex failed on a file it can't count: %v", err)
+	}
+	if got := ix.TokenCount(); got != 2 {
+		t.Errorf("TokenCount() = %d, want 2", got)
+	}
+	if errs := ix.Errors(); len(errs) != 1 || errs["bad.txt"] == nil {
+		t.Errorf("Errors() = %v, want an error for bad.txt", errs)
+	}
+
+	// Fixing the file takes its error away, and breaking one adds it
+	writeTree(t, dir, map[string]string{"bad.txt": "fine now", "a.txt": "FAIL again"})
+	if err := ix.Update(context.Background(), []string{filepath.Join(dir, "bad.txt"), filepath.Join(dir, "a.txt")}); err != nil {
+		t.Fatal(err)
+	}
+	if got := ix.Files(); !reflect.DeepEqual(got, map[string]int{"bad.txt": 2}) {
+		t.Errorf("Files() = %v, want only bad.txt", got)
+	}
+	if errs := ix.Errors(); len(errs) != 1 || errs["a.txt"] == nil {
+		t.Errorf("Errors() = %v, want an error for a.txt", errs)
+	}
+
+	if _, err := NewTokenizerIndex(context.Background(), filepath.Join(dir, "missing"), wordTokenizer{}); err == nil {
+		t.Error("NewTokenizerIndex of a missing root succeeded")
+	}
+	if _, err := NewTokenizerIndex(context.Background(), filepath.Join(dir, "a.txt"), wordTokenizer{}); err == nil {
+		t.Error("NewTokenizerIndex of a file succeeded")
+	}
+}
+
+func TestIndexUpdate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, dir string)
+		paths  []string
+	}{
+		{"modified file", func(t *testing.T, dir string) {
+			writeTree(t, dir, map[string]string{"a.txt": "one two three four"})
+		}, []string{"a.txt"}},
+		{"created file", func(t *testing.T, dir string) {
+			writeTree(t, dir, map[string]string{"sub/new.txt": "five six"})
+		}, []string{"sub/new.txt"}},
+		{"deleted file", func(t *testing.T, dir string) {
+			os.Remove(filepath.Join(dir, "sub", "b.txt"))
+		}, []string{"sub/b.txt"}},
+		{"deleted directory", func(t *testing.T, dir string) {
+			os.RemoveAll(filepath.Join(dir, "sub"))
+		}, []string{"sub"}},
+		{"created directory", func(t *testing.T, dir string) {
+			writeTree(t, dir, map[string]string{"new/x.txt": "x", "new/deep/y.txt": "y y"})
+		}, []string{"new"}},
+		{"changed .gitignore", func(t *testing.T, dir string) {
+			writeTree(t, dir, map[string]string{".gitignore": "sub/\n"})
+		}, []string{".gitignore"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, map[string]string{"a.txt": "one two", "sub/b.txt": "three", "sub/c.txt": "four five"})
+			ix, err := NewTokenizerIndex(context.Background(), dir, wordTokenizer{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.change(t, dir)
+			var paths []string
+			for _, p := range tt.paths {
+				paths = append(paths, filepath.Join(dir, filepath.FromSlash(p)))
+			}
+			if err := ix.Update(context.Background(), paths); err != nil {
+				t.Fatal(err)
+			}
+
+			// An update leaves the index as a fresh scan would
+			fresh, err := NewTokenizerIndex(context.Background(), dir, wordTokenizer{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := ix.Files(), fresh.Files(); !reflect.DeepEqual(got, want) {
+				t.Errorf("Files() = %v, want %v", got, want)
+			}
+			if got, want := ix.Dirs(), fresh.Dirs(); !reflect.DeepEqual(got, want) {
+				t.Errorf("Dirs() = %v, want %v", got, want)
+			}
+			if got, want := ix.TokenCount(), fresh.TokenCount(); got != want {
+				t.Errorf("TokenCount() = %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestIndexUpdateErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "one"})
+	ix, err := NewTokenizerIndex(context.Background(), dir, wordTokenizer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Update(context.Background(), []string{filepath.Join(dir, "..", "elsewhere.txt")}); err == nil {
+		t.Error("Update of a path outside the root succeeded")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	writeTree(t, dir, map[string]string{"a.txt": "one two"})
+	if err := ix.Update(ctx, []string{filepath.Join(dir, "a.txt")}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Update with a canceled context = %v, want context.Canceled", err)
+	}
+	if _, err := NewTokenizerIndex(ctx, dir, wordTokenizer{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("NewTokenizerIndex with a canceled context = %v, want context.Canceled", err)
+	}
+}
@@ -0,0 +1,142 @@
+package counter
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"token-counter/tokenizers"
+)
+
+// maxPending is how much text a CountWriter holds back while waiting for a
+// place where the text can be split without changing its token count
+const maxPending = 1 << 20
+
+// CountWriter counts the tokens of the data written to it without keeping
+// more than a small tail of it in memory, so a stream can be counted as it
+// flows elsewhere, e.g. through io.TeeReader or io.MultiWriter.
+//
+// The text is tokenized in pieces split after a line break, where tiktoken's
+// pre-tokenizer splits anyway, so counts match Count on the whole text.
+// A HuggingFace tokenizer may count a token or so more per piece.
+// Lines longer than 1 MB are split before a space instead, which may differ
+// by a token or so per split. The data must be UTF-8.
+type CountWriter struct {
+	tok     tokenizers.Tokenizer
+	pending []byte
+	count   int
+	err     error
+}
+
+// NewCountWriter returns a CountWriter counting with model, looked up like
+// Tokenizer
+func NewCountWriter(model string) (*CountWriter, error) {
+	tok, err := Tokenizer(model)
+	if err != nil {
+		return nil, err
+	}
+	return NewTokenizerWriter(tok), nil
+}
+
+// NewTokenizerWriter returns a CountWriter counting with tok
+func NewTokenizerWriter(tok tokenizers.Tokenizer) *CountWriter {
+	return &CountWriter{tok: tok}
+}
+
+// Write counts the tokens of p, holding back the text after the last place
+// it can be split until more data arrives
+func (w *CountWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	w.pending = append(w.pending, p...)
+
+	split := splitPoint(w.pending)
+	if split == 0 {
+		return len(p), nil
+	}
+	count, err := w.tok.Count(string(w.pending[:split]))
+	if err != nil {
+		w.err = err
+		return 0, err
+	}
+	w.count += count
+	w.pending = append(w.pending[:0], w.pending[split:]...)
+	return len(p), nil
+}
+
+// Count returns the number of tokens written so far, including the text
+// still held back
+func (w *CountWriter) Count() (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	count, err := w.tok.Count(string(w.pending))
+	if err != nil {
+		return 0, err
+	}
+	return w.count + count, nil
+}
+
+// splitPoint returns where data can be split for counting: after the last
+// line break between two lines of text or, if data has grown past
+// maxPending without one, before the last single space between two words. It
+// returns 0 if data should be held back.
+func splitPoint(data []byte) int {
+	for i := len(data) - 1; i > 1; i-- {
+		// A single line break between two lines is a piece of its own in
+		// every encoding, except that o200k_base keeps slashes with the
+		// punctuation and line breaks before them, as in "}\n//"
+		if data[i-1] == '\n' && !isSpace(data[i-2]) && !isSpace(data[i]) && data[i] != '/' {
+			return i
+		}
+	}
+	if len(data) < maxPending {
+		return 0
+	}
+	for i := len(data) - 2; i > 0; i-- {
+		if data[i] == ' ' && !isSpace(data[i-1]) && !isSpace(data[i+1]) {
+			return i
+		}
+	}
+	return 0
+}
+
+// isSpace reports whether b is ASCII whitespace
+func isSpace(b byte) bool {
+	return bytes.IndexByte([]byte(" \t\r\n\v\f"), b) >= 0
+}
+
+// CountReader counts the tokens read from r until EOF without buffering all
+// of it, e.g. for HTTP request bodies or object storage streams. model is
+// looked up like Tokenizer.
+func CountReader(r io.Reader, model string) (int, error) {
+	return CountReaderContext(context.Background(), r, model)
+}
+
+// CountReaderContext is CountReader, stopping with the context's error once
+// ctx is done, such as when a client disconnects or a deadline passes
+func CountReaderContext(ctx context.Context, r io.Reader, model string) (int, error) {
+	w, err := NewCountWriter(model)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := io.Copy(w, contextReader{ctx, r}); err != nil {
+		return 0, err
+	}
+	return w.Count()
+}
+
+// contextReader reads from r until ctx is done
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// Read returns the context's error once it's done, and reads from r before
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
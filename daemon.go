@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// daemonServer answers JSON-RPC requests from editor plugins, keeping the
+// tokenizers loaded and an index of every directory it has scanned, so
+// repeated requests don't pay for process startup or a rescan
+type daemonServer struct {
+	options *CommandOptions // Defaults for every request
+
+	mu      sync.Mutex
+	codecs  map[string]namedCodec
+	indexes map[daemonIndexKey]*Index
+}
+
+// daemonIndexKey identifies an index by its absolute root and model
+type daemonIndexKey struct {
+	root  string
+	model string
+}
+
+// daemonParams holds the params of every method; each method uses a subset
+type daemonParams struct {
+	Text  string   `json:"text"`
+	Path  string   `json:"path"`
+	Paths []string `json:"paths"`
+	Model string   `json:"model"`
+	Limit int      `json:"limit"`
+}
+
+// daemonCommand defines the daemon subcommand, which serves JSON-RPC on a
+// unix socket, or on stdin and stdout without -socket
+func daemonCommand(fs *flag.FlagSet) func() {
+	options := &CommandOptions{}
+	var socket string
+
+	registerFlags(fs, options)
+	registerWalkFlags(fs, options)
+	fs.StringVar(&socket, "socket", "", "Unix socket to listen on (serves stdin and stdout if empty)")
+	return func() {
+		// Profiles come from the config file of the working directory
+		if err := applyProfile(fs, options); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		server := &daemonServer{options: options, codecs: make(map[string]namedCodec), indexes: make(map[daemonIndexKey]*Index)}
+		// Load the default tokenizer up front so a bad -model fails at startup
+		// and the first request is as fast as the others
+		if _, err := server.codec(""); err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading tokenizer: %v\n", err)
+			exit(1)
+		}
+
+		if socket == "" {
+			if err := serveRPC(os.Stdin, json.NewEncoder(os.Stdout), server.handle); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+			return
+		}
+
+		// A socket left behind by a daemon that was killed would make Listen fail
+		if info, err := os.Lstat(socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+			if conn, err := net.Dial("unix", socket); err == nil {
+				conn.Close()
+				fmt.Fprintf(os.Stderr, "Error: a daemon is already listening on %s\n", socket)
+				exit(1)
+			}
+			os.Remove(socket)
+		}
+		listener, err := net.Listen("unix", socket)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		// Closing the listener removes the socket
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			listener.Close()
+		}()
+
+		logger.Info("serving JSON-RPC", "socket", socket)
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+					return
+				}
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+			go func() {
+				defer conn.Close()
+				if err := serveRPC(conn, json.NewEncoder(conn), server.handle); err != nil {
+					logger.Debug("connection closed", "err", err)
+				}
+			}()
+		}
+	}
+}
+
+// handle dispatches a request to its method
+func (s *daemonServer) handle(req *rpcRequest) (interface{}, *rpcError) {
+	var params daemonParams
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{rpcInvalidParams, err.Error()}
+		}
+	}
+
+	var result interface{}
+	var err error
+	switch req.Method {
+	case "count":
+		result, err = s.count(&params)
+	case "scan":
+		if params.Path == "" {
+			return nil, &rpcError{rpcInvalidParams, "path is required"}
+		}
+		result, err = s.scan(&params)
+	case "invalidate":
+		result, err = s.invalidate(&params)
+	default:
+		if len(req.ID) == 0 {
+			return nil, nil
+		}
+		return nil, &rpcError{rpcMethodNotFound, fmt.Sprintf("method not found: %s", req.Method)}
+	}
+	if err != nil {
+		return nil, &rpcError{rpcServerError, err.Error()}
+	}
+	return result, nil
+}
+
+// requestOptions returns a copy of the daemon options with the model of a
+// request applied
+func (s *daemonServer) requestOptions(params *daemonParams) *CommandOptions {
+	options := *s.options
+	options.Models = nil
+	if params.Model != "" {
+		options.Model = params.Model
+		options.TokenizerFile, options.BPEVocab, options.BPEEncoder = "", "", ""
+	}
+	return &options
+}
+
+// codec returns the tokenizer for a requested model, loading it on first
+// use. An empty model selects the daemon's -model, -tokenizer-file or -bpe-vocab.
+func (s *daemonServer) codec(model string) (namedCodec, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if enc, ok := s.codecs[model]; ok {
+		return enc, nil
+	}
+	var enc namedCodec
+	if model == "" {
+		codec, err := newCodec(s.options)
+		if err != nil {
+			return namedCodec{}, err
+		}
+		enc = namedCodec{s.options.Model, codec}
+	} else {
+		codec, err := codecForName(model)
+		if err != nil {
+			return namedCodec{}, fmt.Errorf("unknown model %q", model)
+		}
+		enc = namedCodec{model, codec}
+	}
+	s.codecs[model] = enc
+	return enc, nil
+}
+
+// count counts a piece of text
+func (s *daemonServer) count(params *daemonParams) (interface{}, error) {
+	enc, err := s.codec(params.Model)
+	if err != nil {
+		return nil, err
+	}
+	count, err := countUnits(params.Text, enc, s.options.CountMode)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{s.options.unitName(): count, "model": enc.Name}, nil
+}
+
+// scan returns the counts of a directory from its index, scanning it the
+// first time, or the counts of a file, from the index of a directory it's in
+// if there's one
+func (s *daemonServer) scan(params *daemonParams) (interface{}, error) {
+	path, err := filepath.Abs(normalizePath(params.Path))
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	options := s.requestOptions(params)
+
+	if info.IsDir() {
+		key := daemonIndexKey{path, params.Model}
+		s.mu.Lock()
+		ix := s.indexes[key]
+		s.mu.Unlock()
+		if ix == nil {
+			// Scan outside the lock, so counts aren't held up by it
+			if ix, err = NewIndex(path, options); err != nil {
+				return nil, err
+			}
+			s.mu.Lock()
+			s.indexes[key] = ix
+			s.mu.Unlock()
+		}
+		return scanSummary(path, ix.Snapshot(), options, params.Limit), nil
+	}
+
+	fileInfo, ok := s.indexedFile(path, params.Model)
+	if !ok {
+		ctx, cancel := withTimeout(context.Background(), options)
+		defer cancel()
+		repo, err := ProcessSingleFile(ctx, path, options)
+		if err != nil {
+			return nil, err
+		}
+		if len(repo.Errors) > 0 {
+			return nil, repo.Errors[0]
+		}
+		found := false
+		for _, dirInfo := range repo.Dirs {
+			if len(dirInfo.Files) > 0 {
+				fileInfo, found = *dirInfo.Files[0], true
+			}
+		}
+		// A file below -min is kept in BelowMin rather than in Dirs
+		for _, belowMin := range repo.BelowMin {
+			fileInfo, found = *belowMin, true
+		}
+		if !found {
+			return nil, fmt.Errorf("%s was not counted", path)
+		}
+	}
+	return map[string]interface{}{
+		"path":             path,
+		options.unitName(): fileInfo.TokenCount,
+		"bytes":            fileInfo.Bytes,
+		"lines":            fileInfo.Lines,
+		"model":            options.Model,
+	}, nil
+}
+
+// indexedFile returns the counts of a file from the index of a directory
+// it's in, if it's counted there
+func (s *daemonServer) indexedFile(path string, model string) (FileTokenInfo, bool) {
+	s.mu.Lock()
+	var indexes []*Index
+	for key, ix := range s.indexes {
+		if key.model == model {
+			indexes = append(indexes, ix)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, ix := range indexes {
+		if fileInfo, ok := ix.File(path); ok {
+			return fileInfo, true
+		}
+	}
+	return FileTokenInfo{}, false
+}
+
+// invalidate recounts changed files in every index of a directory they're
+// in, or drops every index without paths so the next scans start over
+func (s *daemonServer) invalidate(params *daemonParams) (interface{}, error) {
+	s.mu.Lock()
+	if len(params.Paths) == 0 {
+		dropped := len(s.indexes)
+		s.indexes = make(map[daemonIndexKey]*Index)
+		s.mu.Unlock()
+		return map[string]interface{}{"dropped": dropped}, nil
+	}
+	indexes := make([]*Index, 0, len(s.indexes))
+	for _, ix := range s.indexes {
+		indexes = append(indexes, ix)
+	}
+	s.mu.Unlock()
+
+	updated := 0
+	for _, ix := range indexes {
+		var paths []string
+		for _, path := range params.Paths {
+			if _, err := ix.resolve(path); err == nil {
+				paths = append(paths, path)
+			}
+		}
+		if len(paths) == 0 {
+			continue
+		}
+		if err := ix.Update(paths); err != nil {
+			return nil, err
+		}
+		updated++
+	}
+	return map[string]interface{}{"updated": updated}, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// daemonCall sends a request to the daemon and returns its result decoded
+// from JSON, as a client sees it
+func daemonCall(t *testing.T, s *daemonServer, method string, params string) (map[string]interface{}, *rpcError) {
+	t.Helper()
+	result, rpcErr := s.handle(&rpcRequest{JSONRPC: "2.0", ID: json.RawMessage("1"), Method: method, Params: json.RawMessage(params)})
+	if rpcErr != nil {
+		return nil, rpcErr
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded, nil
+}
+
+func newTestDaemon(t *testing.T, args ...string) *daemonServer {
+	t.Helper()
+	return &daemonServer{options: testOptions(t, args...), codecs: make(map[string]namedCodec), indexes: make(map[daemonIndexKey]*Index)}
+}
+
+func TestDaemon(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "one two three", "sub/b.txt": "four"})
+	s := newTestDaemon(t, "-model", "cl100k_base")
+	path := func(rel string) string { return strings.ReplaceAll(filepath.Join(dir, rel), `\`, `\\`) }
+
+	count, rpcErr := daemonCall(t, s, "count", `{"text": "hello world"}`)
+	if rpcErr != nil || count["tokens"] != 2.0 || count["model"] != "cl100k_base" {
+		t.Errorf("count = %v, %v", count, rpcErr)
+	}
+	count, rpcErr = daemonCall(t, s, "count", `{"text": "hello world", "model": "o200k_base"}`)
+	if rpcErr != nil || count["tokens"] != 2.0 || count["model"] != "o200k_base" {
+		t.Errorf("count with o200k_base = %v, %v", count, rpcErr)
+	}
+
+	scan, rpcErr := daemonCall(t, s, "scan", `{"path": "`+path("")+`"}`)
+	if rpcErr != nil || scan["total"] != 4.0 || scan["files"] != 2.0 {
+		t.Fatalf("scan = %v, %v", scan, rpcErr)
+	}
+	file, rpcErr := daemonCall(t, s, "scan", `{"path": "`+path("a.txt")+`"}`)
+	if rpcErr != nil || file["tokens"] != 3.0 || file["lines"] != 1.0 {
+		t.Errorf("scan of a file = %v, %v", file, rpcErr)
+	}
+
+	// Changes are seen once they're invalidated
+	writeTree(t, dir, map[string]string{"a.txt": "one", "sub/new.txt": "five six seven"})
+	if scan, _ := daemonCall(t, s, "scan", `{"path": "`+path("")+`"}`); scan["total"] != 4.0 {
+		t.Errorf("scan before invalidate = %v, want the indexed counts", scan["total"])
+	}
+	invalidated, rpcErr := daemonCall(t, s, "invalidate", `{"paths": ["`+path("a.txt")+`", "`+path("sub/new.txt")+`"]}`)
+	if rpcErr != nil || invalidated["updated"] != 1.0 {
+		t.Errorf("invalidate = %v, %v", invalidated, rpcErr)
+	}
+	if scan, _ := daemonCall(t, s, "scan", `{"path": "`+path("")+`"}`); scan["total"] != 5.0 || scan["files"] != 3.0 {
+		t.Errorf("scan after invalidate = %v", scan)
+	}
+	if dropped, _ := daemonCall(t, s, "invalidate", `{}`); dropped["dropped"] != 1.0 || len(s.indexes) != 0 {
+		t.Errorf("invalidate of everything = %v", dropped)
+	}
+}
+
+func TestDaemonErrors(t *testing.T) {
+	s := newTestDaemon(t, "-model", "cl100k_base")
+	tests := []struct {
+		method string
+		params string
+		code   int
+		want   string
+	}{
+		{"count", `{"text": 5}`, rpcInvalidParams, "cannot unmarshal"},
+		{"count", `{"text": "a", "model": "no-such-model"}`, rpcServerError, `unknown model "no-such-model"`},
+		{"scan", `{}`, rpcInvalidParams, "path is required"},
+		{"scan", `{"path": "/no/such/dir"}`, rpcServerError, "no such file or directory"},
+		{"shutdown", `{}`, rpcMethodNotFound, "method not found: shutdown"},
+	}
+	for _, tt := range tests {
+		_, rpcErr := daemonCall(t, s, tt.method, tt.params)
+		if rpcErr == nil || rpcErr.Code != tt.code || !strings.Contains(rpcErr.Message, tt.want) {
+			t.Errorf("%s %s = %v, want code %d and %q", tt.method, tt.params, rpcErr, tt.code, tt.want)
+		}
+	}
+
+	// Notifications of unknown methods get no answer
+	if result, rpcErr := s.handle(&rpcRequest{JSONRPC: "2.0", Method: "initialized"}); result != nil || rpcErr != nil {
+		t.Errorf("notification got %v, %v", result, rpcErr)
+	}
+}
+
+func TestDaemonStdio(t *testing.T) {
+	s := newTestDaemon(t, "-model", "cl100k_base")
+	var out bytes.Buffer
+	requests := `{"jsonrpc":"2.0","id":1,"method":"count","params":{"text":"hello world"}}` + "\n" +
+		`{"jsonrpc":"2.0","id":2,"method":"nope"}` + "\n"
+	if err := serveRPC(strings.NewReader(requests), json.NewEncoder(&out), s.handle); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"id":1,"result":{"model":"cl100k_base","tokens":2}`) || !strings.Contains(lines[1], `"code":-32601`) {
+		t.Errorf("responses:\n%s", out.String())
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// datasetFormats are the output formats of the dataset subcommand
+var datasetFormats = map[string]bool{"text": true, "json": true}
+
+// DatasetReport is the result of counting the records of JSONL datasets
+type DatasetReport struct {
+	Metadata  *ScanMetadata    `json:"metadata"`
+	Total     int              `json:"total"`
+	Records   int              `json:"records"`
+	Fields    []*DatasetField  `json:"fields,omitempty"` // With -field, in the order given
+	Stats     DatasetStats     `json:"stats"`
+	Limit     int              `json:"limit,omitempty"`
+	OverLimit []*DatasetRecord `json:"over_limit,omitempty"` // Records above -limit, largest first
+	Errors    []*DatasetRecord `json:"errors,omitempty"`     // Lines that aren't a JSON object, left out of the counts
+
+	counts    []int // Count of every record, sorted ascending
+	histogram []histogramBucket
+}
+
+// DatasetField is the total of a -field across the records, and how many
+// records don't have it
+type DatasetField struct {
+	Field   string `json:"field"`
+	Total   int    `json:"total"`
+	Missing int    `json:"missing,omitempty"`
+}
+
+// DatasetStats summarizes the distribution of the per-record counts
+type DatasetStats struct {
+	Min    int     `json:"min"`
+	Median int     `json:"median"`
+	Mean   float64 `json:"mean"`
+	P90    int     `json:"p90"`
+	P99    int     `json:"p99"`
+	Max    int     `json:"max"`
+}
+
+// DatasetRecord is a record of a dataset by its file and line number
+type DatasetRecord struct {
+	File  string `json:"file"`
+	Line  int    `json:"line"`
+	Total int    `json:"total,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// datasetCommand defines the dataset subcommand, which counts every record of
+// JSONL datasets, such as fine-tuning data, and reports their distribution
+func datasetCommand(fs *flag.FlagSet) func() {
+	options := &CommandOptions{}
+	var fields []string
+	var limit int
+	registerFlags(fs, options)
+	fs.Func("field", "Field of each record to count, with dots for nested fields (e.g. prompt or input.text); repeat it to count several, totaled per field (default the whole record)", func(value string) error {
+		if value == "" {
+			return fmt.Errorf("empty field")
+		}
+		fields = append(fields, value)
+		return nil
+	})
+	fs.IntVar(&limit, "limit", 0, "Report the records with more tokens than this, e.g. a fine-tuning context length (0 for no limit)")
+	fs.StringVar(&options.Format, "format", "text", "Output format: text or json")
+	return func() {
+		if !datasetFormats[options.Format] {
+			fmt.Fprintf(os.Stderr, "Error: unknown format %q (expected text or json)\n", options.Format)
+			exit(1)
+		}
+		if fs.NArg() == 0 {
+			fmt.Fprintln(os.Stderr, "Error: dataset needs at least one .jsonl file, or - for stdin")
+			exit(1)
+		}
+
+		encs, err := newCodecs(options)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		report := &DatasetReport{Limit: limit}
+		for _, field := range fields {
+			report.Fields = append(report.Fields, &DatasetField{Field: field})
+		}
+		for _, path := range fs.Args() {
+			if err := countDataset(report, path, encs[0], options); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+		}
+		report.finish(fs.Args(), options)
+
+		if options.Format == "json" {
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+			fmt.Println(string(data))
+		} else {
+			printDataset(report, options)
+		}
+
+		if options.Strict && len(report.Errors) > 0 {
+			exit(1)
+		}
+	}
+}
+
+// countDataset counts the records of the JSONL file at path, or of stdin
+// for -, into report
+func countDataset(report *DatasetReport, path string, enc namedCodec, options *CommandOptions) error {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	reader := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		data, readErr := reader.ReadBytes('\n')
+		if readErr != nil && readErr != io.EOF {
+			return fmt.Errorf("%s: %v", path, readErr)
+		}
+		if text := strings.TrimSpace(string(data)); text != "" {
+			var record map[string]interface{}
+			if err := json.Unmarshal([]byte(text), &record); err != nil {
+				report.Errors = append(report.Errors, &DatasetRecord{File: path, Line: line, Error: "not a JSON object: " + err.Error()})
+			} else {
+				count, err := countRecord(report, record, enc, options)
+				if err != nil {
+					return fmt.Errorf("%s:%d: %v", path, line, err)
+				}
+				report.Records++
+				report.Total += count
+				report.counts = append(report.counts, count)
+				if report.Limit > 0 && count > report.Limit {
+					report.OverLimit = append(report.OverLimit, &DatasetRecord{File: path, Line: line, Total: count})
+				}
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+	}
+}
+
+// countRecord counts a record: the -field values, or the whole record
+// without any. Fields are totaled in report. A record that's a chat payload, or a field that's one, is
+// counted with the -chat-format overhead.
+func countRecord(report *DatasetReport, record map[string]interface{}, enc namedCodec, options *CommandOptions) (int, error) {
+	if len(report.Fields) == 0 {
+		return countRecordValue(record, enc, options)
+	}
+
+	// Fields are only added up once all of them are counted, so a record that
+	// fails counts nowhere
+	counts := make([]int, len(report.Fields))
+	present := make([]bool, len(report.Fields))
+	for i, field := range report.Fields {
+		value, ok := recordField(record, field.Field)
+		if !ok {
+			continue
+		}
+		count, err := countRecordValue(value, enc, options)
+		if err != nil {
+			return 0, err
+		}
+		counts[i], present[i] = count, true
+	}
+	total := 0
+	for i, field := range report.Fields {
+		if !present[i] {
+			field.Missing++
+		}
+		field.Total += counts[i]
+		total += counts[i]
+	}
+	return total, nil
+}
+
+// recordField looks up a field of a record by its dotted path
+func recordField(record map[string]interface{}, path string) (interface{}, bool) {
+	var value interface{} = record
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[key]; !ok || value == nil {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// countRecordValue counts a value of a record: a string as it is, a chat
+// payload with -chat-format as the API bills it, and anything else as its
+// JSON text
+func countRecordValue(value interface{}, enc namedCodec, options *CommandOptions) (int, error) {
+	if text, ok := value.(string); ok {
+		return countUnits(text, enc, options.CountMode)
+	}
+	if options.ChatFormat != "" && options.unitName() == "tokens" {
+		if conversation, ok := chatPayload(value); ok {
+			return countChat([]chatConversation{conversation}, enc, options.ChatFormat)
+		}
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return 0, err
+	}
+	return countUnits(string(data), enc, options.CountMode)
+}
+
+// finish computes the statistics of the counted records and fills in the
+// metadata
+func (report *DatasetReport) finish(paths []string, options *CommandOptions) {
+	sort.Ints(report.counts)
+	stats := computeFileStats(report.counts)
+	report.Stats = DatasetStats{stats.Min, stats.Median, stats.Mean, stats.P90, stats.P99, stats.Max}
+	report.histogram = buildHistogram(report.counts)
+	sort.SliceStable(report.OverLimit, func(i, j int) bool {
+		return report.OverLimit[i].Total > report.OverLimit[j].Total
+	})
+	report.Metadata = &ScanMetadata{
+		Tool:      "token-counter",
+		Version:   toolVersion(),
+		Model:     options.modelName(),
+		Unit:      options.unitName(),
+		Command:   commandLine,
+		Path:      strings.Join(paths, " "),
+		Timestamp: time.Now().UTC().Truncate(time.Second),
+		Files:     report.Records,
+	}
+}
+
+// printDataset prints the totals of a dataset, the distribution of its
+// records and the records over the limit
+func printDataset(report *DatasetReport, options *CommandOptions) {
+	unit := options.unitName()
+	fmt.Println(options.paint(ansiBold, fmt.Sprintf("Records: %s, %s %s", formatCount(report.Records), formatCount(report.Total), unit)))
+	for _, field := range report.Fields {
+		missing := ""
+		if field.Missing > 0 {
+			missing = fmt.Sprintf(", missing from %s records", formatCount(field.Missing))
+		}
+		fmt.Printf("  %s: %s %s (%.1f%%%s)\n", field.Field, formatCount(field.Total), unit, percentOf(field.Total, report.Total), missing)
+	}
+	fmt.Println()
+
+	if report.Records > 0 {
+		stats := report.Stats
+		fmt.Printf("Statistics (%s per record):\n", unit)
+		fmt.Println("----------------------------------")
+		fmt.Printf("Min:    %s\n", formatCount(stats.Min))
+		fmt.Printf("Median: %s\n", formatCount(stats.Median))
+		fmt.Printf("Mean:   %.1f\n", stats.Mean)
+		fmt.Printf("P90:    %s\n", formatCount(stats.P90))
+		fmt.Printf("P99:    %s\n", formatCount(stats.P99))
+		fmt.Printf("Max:    %s\n", formatCount(stats.Max))
+		fmt.Println()
+
+		maxRecords := 0
+		for _, bucket := range report.histogram {
+			maxRecords = max(maxRecords, bucket.Files)
+		}
+		fmt.Printf("Histogram (%s per record):\n", unit)
+		for _, bucket := range report.histogram {
+			width := bucket.Files * 40 / maxRecords
+			if width == 0 && bucket.Files > 0 {
+				width = 1
+			}
+			label := fmt.Sprintf("%d-%d", bucket.Low, bucket.High-1)
+			fmt.Printf("%15s | %-40s %d\n", label, strings.Repeat("#", width), bucket.Files)
+		}
+		fmt.Println()
+	}
+
+	if report.Limit > 0 {
+		if len(report.OverLimit) == 0 {
+			fmt.Printf("No record is over %s %s.\n\n", formatCount(report.Limit), unit)
+		} else {
+			fmt.Println(options.paint(ansiRed, fmt.Sprintf("%d records over %s %s:", len(report.OverLimit), formatCount(report.Limit), unit)))
+			for _, record := range report.OverLimit {
+				fmt.Printf("  %s:%d: %s %s\n", record.File, record.Line, formatCount(record.Total), unit)
+			}
+			fmt.Println()
+		}
+	}
+
+	if len(report.Errors) > 0 {
+		fmt.Fprintf(os.Stderr, "%d lines could not be counted:\n", len(report.Errors))
+		for _, record := range report.Errors {
+			fmt.Fprintf(os.Stderr, "  %s:%d: %s\n", record.File, record.Line, record.Error)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testDataset is a JSONL dataset with a line that isn't a record, and its
+// counts with cl100k_base: 4, 2 and 4 tokens
+const testDataset = `{"prompt":"hello","completion":"one two three"}
+{"prompt":"hello world"}
+not json
+
+{"prompt":"one two three","completion":"hello"}`
+
+func TestDatasetCommand(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"data.jsonl": testDataset})
+	data := filepath.Join(dir, "data.jsonl")
+	run := func(args ...string) string {
+		return captureStdout(t, func() {
+			captureStderr(t, func() { findCommand("dataset").run(append(append([]string{"-model", "cl100k_base"}, args...), data)) })
+		})
+	}
+
+	var report DatasetReport
+	out := run("-format", "json", "-field", "prompt", "-field", "completion", "-limit", "3")
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("dataset -format json doesn't parse: %v\n%s", err, out)
+	}
+	wantFields := []*DatasetField{{Field: "prompt", Total: 6}, {Field: "completion", Total: 4, Missing: 1}}
+	wantOver := []*DatasetRecord{{File: data, Line: 1, Total: 4}, {File: data, Line: 5, Total: 4}}
+	if report.Total != 10 || report.Records != 3 || !reflect.DeepEqual(report.Fields, wantFields) || !reflect.DeepEqual(report.OverLimit, wantOver) {
+		t.Errorf("report %s", out)
+	}
+	if report.Stats.Min != 2 || report.Stats.Max != 4 || len(report.Errors) != 1 || report.Errors[0].Line != 3 || report.Metadata.Files != 3 {
+		t.Errorf("stats %+v, errors %+v", report.Stats, report.Errors)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"whole records", nil, []string{"Records: 3, "}},
+		{"fields", []string{"-field", "prompt", "-limit", "2"}, []string{"Records: 3, 6 tokens\n  prompt: 6 tokens (100.0%)\n", "Min:    1\n", "1 records over 2 tokens:\n  " + data + ":5: 3 tokens\n"}},
+		{"no record over the limit", []string{"-field", "prompt", "-limit", "3"}, []string{"No record is over 3 tokens."}},
+		{"nested fields", []string{"-field", "prompt.text"}, []string{"Records: 3, 0 tokens\n  prompt.text: 0 tokens (0.0%, missing from 3 records)\n"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := run(tt.args...)
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("dataset printed\n%s\nwant %q", out, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCountRecordValue(t *testing.T) {
+	codec, err := codecForName("cl100k_base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := namedCodec{"cl100k_base", codec}
+	messages := []interface{}{map[string]interface{}{"role": "user", "content": "hello"}}
+	tests := []struct {
+		name    string
+		value   interface{}
+		options CommandOptions
+		want    int
+	}{
+		{"string", "hello world", CommandOptions{}, 2},
+		{"json", map[string]interface{}{"a": 1}, CommandOptions{}, 5},
+		{"chat", map[string]interface{}{"messages": messages}, CommandOptions{ChatFormat: "openai"}, 8},
+		{"chat in words", "one two three", CommandOptions{ChatFormat: "openai", CountMode: "words"}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := countRecordValue(tt.value, enc, &tt.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("countRecordValue = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDatasetCommandErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"data.jsonl": testDataset})
+	data := filepath.Join(dir, "data.jsonl")
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"format", []string{"-format", "xml", data}, `Error: unknown format "xml" (expected text or json)`},
+		{"no files", nil, "Error: dataset needs at least one .jsonl file, or - for stdin"},
+		{"missing file", []string{filepath.Join(dir, "missing.jsonl")}, "missing.jsonl: no such file or directory"},
+		{"empty field", []string{"-field", "", data}, "empty field"},
+		{"strict", []string{"-strict", data}, "data.jsonl:3: not a JSON object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderr, code := exitStatus(t, func() {
+				captureStdout(t, func() { findCommand("dataset").run(append([]string{"-model", "cl100k_base"}, tt.args...)) })
+			})
+			if code == 0 || !strings.Contains(stderr, tt.want) {
+				t.Errorf("exit %d, stderr:\n%s\nwant %q", code, stderr, tt.want)
+			}
+		})
+	}
+}
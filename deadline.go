@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// deadlineListing is the share of -deadline the walk may go on for once it
+// passed, listing the files left without reading them, to tell how many
+// there are
+const deadlineListing = 0.1
+
+// minDeadlineListing is the least time the walk may go on for to list them
+const minDeadlineListing = time.Second
+
+// scanDeadline is when a -deadline scan stops counting files, and when it
+// stops listing the ones left. A nil *scanDeadline never passes.
+type scanDeadline struct {
+	at        time.Time
+	listUntil time.Time
+}
+
+// newScanDeadline starts the clock of a scan with the -deadline of options,
+// or returns nil without one
+func newScanDeadline(options *CommandOptions) *scanDeadline {
+	if options.Deadline <= 0 {
+		return nil
+	}
+	now := time.Now()
+	listing := max(time.Duration(float64(options.Deadline)*deadlineListing), minDeadlineListing)
+	return &scanDeadline{at: now.Add(options.Deadline), listUntil: now.Add(options.Deadline + listing)}
+}
+
+// passed reports whether the scan should stop counting files
+func (d *scanDeadline) passed() bool {
+	return d != nil && !time.Now().Before(d.at)
+}
+
+// listingOver reports whether the scan should stop listing the files left
+func (d *scanDeadline) listingOver() bool {
+	return d != nil && !time.Now().Before(d.listUntil)
+}
+
+// PartialScan describes a scan -deadline cut short
+type PartialScan struct {
+	Deadline  string `json:"deadline"`           // The -deadline, like 30s
+	Remaining int    `json:"remaining"`          // Files the scan found but didn't count
+	AtLeast   bool   `json:"at_least,omitempty"` // Whether listing them was cut short too, so there are more
+}
+
+// newPartialScan returns the description of a partial scan for the reports,
+// or nil if the scan was complete
+func newPartialScan(repo *RepoTokenInfo, options *CommandOptions) *PartialScan {
+	if !repo.Partial {
+		return nil
+	}
+	return &PartialScan{Deadline: options.Deadline.String(), Remaining: repo.Remaining, AtLeast: repo.RemainingAtLeast}
+}
+
+// partialSummary describes a partial scan, like "the -deadline of 30s passed
+// with 1,204 files left uncounted"
+func partialSummary(repo *RepoTokenInfo, options *CommandOptions) string {
+	remaining := formatCount(repo.Remaining)
+	if repo.RemainingAtLeast {
+		remaining = "at least " + remaining
+	}
+	files := "files"
+	if repo.Remaining == 1 && !repo.RemainingAtLeast {
+		files = "file"
+	}
+	return fmt.Sprintf("the -deadline of %s passed with %s %s left uncounted", options.Deadline, remaining, files)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScanDeadline(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name        string
+		deadline    *scanDeadline
+		passed      bool
+		listingOver bool
+	}{
+		{"none", nil, false, false},
+		{"ahead", &scanDeadline{at: now.Add(time.Hour), listUntil: now.Add(2 * time.Hour)}, false, false},
+		{"listing", &scanDeadline{at: now.Add(-time.Second), listUntil: now.Add(time.Hour)}, true, false},
+		{"over", &scanDeadline{at: now.Add(-2 * time.Second), listUntil: now.Add(-time.Second)}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.deadline.passed() != tt.passed || tt.deadline.listingOver() != tt.listingOver {
+				t.Errorf("passed %v and listing over %v, want %v and %v", tt.deadline.passed(), tt.deadline.listingOver(), tt.passed, tt.listingOver)
+			}
+		})
+	}
+
+	if d := newScanDeadline(&CommandOptions{}); d != nil {
+		t.Errorf("deadline without -deadline %+v", d)
+	}
+	// Listing goes on for a tenth of the deadline, and at least a second
+	for deadline, want := range map[time.Duration]time.Duration{time.Minute: 6 * time.Second, time.Second: minDeadlineListing} {
+		if d := newScanDeadline(&CommandOptions{Deadline: deadline}); d.listUntil.Sub(d.at) != want {
+			t.Errorf("-deadline %v lists for %v, want %v", deadline, d.listUntil.Sub(d.at), want)
+		}
+	}
+}
+
+func TestPartialSummary(t *testing.T) {
+	options := &CommandOptions{Deadline: 30 * time.Second}
+	tests := []struct {
+		repo RepoTokenInfo
+		want string
+	}{
+		{RepoTokenInfo{Partial: true, Remaining: 1}, "the -deadline of 30s passed with 1 file left uncounted"},
+		{RepoTokenInfo{Partial: true, Remaining: 1204}, "the -deadline of 30s passed with 1,204 files left uncounted"},
+		{RepoTokenInfo{Partial: true, Remaining: 1, RemainingAtLeast: true}, "the -deadline of 30s passed with at least 1 files left uncounted"},
+	}
+	for _, tt := range tests {
+		if got := partialSummary(&tt.repo, options); got != tt.want {
+			t.Errorf("partialSummary = %q, want %q", got, tt.want)
+		}
+		if partial := newPartialScan(&tt.repo, options); partial == nil || partial.Deadline != "30s" || partial.Remaining != tt.repo.Remaining || partial.AtLeast != tt.repo.RemainingAtLeast {
+			t.Errorf("newPartialScan = %+v", partial)
+		}
+	}
+	if partial := newPartialScan(&RepoTokenInfo{}, options); partial != nil {
+		t.Errorf("complete scan described as partial: %+v", partial)
+	}
+}
+
+func TestDeadlineScan(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world", "sub/b.txt": "one two three", "sub/c.txt": "four"})
+	tests := []struct {
+		name      string
+		deadline  string
+		tokens    int
+		remaining int
+	}{
+		{"complete", "1h", 6, 0},
+		{"passed", "1ns", 0, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := testOptions(t, "-model", "cl100k_base")
+			options.Deadline, _ = time.ParseDuration(tt.deadline)
+			repo, err := ProcessRepository(t.Context(), dir, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if repo.TokenCount != tt.tokens || repo.Remaining != tt.remaining || repo.Partial != (tt.remaining > 0) {
+				t.Errorf("counted %d tokens with %d files left (partial %v), want %d with %d", repo.TokenCount, repo.Remaining, repo.Partial, tt.tokens, tt.remaining)
+			}
+			list, err := ProcessFileList(t.Context(), dir, []string{dir + "/a.txt", dir + "/sub/b.txt"}, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if list.Partial != (tt.remaining > 0) || tt.remaining > 0 && list.Remaining != 2 {
+				t.Errorf("file list partial %v with %d left", list.Partial, list.Remaining)
+			}
+		})
+	}
+
+	var stderr string
+	out := captureStdout(t, func() {
+		stderr = captureStderr(t, func() {
+			findCommand("scan").run([]string{"-deadline", "1ns", "-model", "cl100k_base", "-color", "never", dir})
+		})
+	})
+	if want := "Partial results: the -deadline of 1ns passed with 3 files left uncounted"; !strings.Contains(out, want) || !strings.Contains(stderr, "Warning: the -deadline of 1ns passed") {
+		t.Errorf("scan -deadline printed\n%s\nstderr:\n%s\nwant %q", out, stderr, want)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// DuplicateFile records a file whose contents are identical to a file found
+// earlier in the scan
+type DuplicateFile struct {
+	Path       string
+	Original   string // First file found with the same contents
+	TokenCount int
+}
+
+// contentHash returns the hex SHA-256 of data
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// contentHashes maps the content hashes seen in a scan to the first file
+// that had them
+type contentHashes map[string]string
+
+// check returns the path of the file first seen with the same contents as
+// fileInfo, or "" if it's the first, recording it as such. Empty files
+// aren't duplicates of each other.
+func (h contentHashes) check(fileInfo *FileTokenInfo) string {
+	if fileInfo.Bytes == 0 {
+		return ""
+	}
+	if original, ok := h[fileInfo.Hash]; ok {
+		return original
+	}
+	h[fileInfo.Hash] = fileInfo.Path
+	return ""
+}
+
+// checkFor checks fileInfo like check, unless the scan discards its files
+// without -dedupe, so the hashes don't grow with the tree when nothing
+// reports the duplicates
+func (h contentHashes) checkFor(fileInfo *FileTokenInfo, options *CommandOptions) string {
+	if options.DiscardFiles && !options.Dedupe {
+		return ""
+	}
+	return h.check(fileInfo)
+}
+
+// printDuplicates lists the files that are copies of another file, grouped
+// by the original, with the ones adding the most redundant tokens first
+func printDuplicates(repo *RepoTokenInfo, options *CommandOptions) {
+	if len(repo.Duplicates) == 0 {
+		return
+	}
+
+	copies := make(map[string][]*DuplicateFile)
+	var originals []string
+	redundant := make(map[string]int)
+	total := 0
+	for _, dup := range repo.Duplicates {
+		if _, ok := copies[dup.Original]; !ok {
+			originals = append(originals, dup.Original)
+		}
+		copies[dup.Original] = append(copies[dup.Original], dup)
+		redundant[dup.Original] += dup.TokenCount
+		total += dup.TokenCount
+	}
+	sort.Slice(originals, func(i, j int) bool {
+		if redundant[originals[i]] != redundant[originals[j]] {
+			return redundant[originals[i]] > redundant[originals[j]]
+		}
+		return originals[i] < originals[j]
+	})
+
+	note := "included in the totals, use -dedupe to count each once"
+	if options.Dedupe {
+		note = "left out of the totals"
+	}
+	fmt.Printf("Duplicate files (%s redundant %s, %s):\n", formatCount(total), options.unitName(), note)
+	fmt.Println("---------------")
+	for _, original := range originals {
+		relativePath := relativeTo(repo.Path, original)
+		dups := copies[original]
+		fmt.Printf("%s (%s %s) is duplicated by:\n", relativePath, formatCount(dups[0].TokenCount), options.unitName())
+		for _, dup := range dups {
+			relativePath := relativeTo(repo.Path, dup.Path)
+			fmt.Printf("  |- %s\n", relativePath)
+		}
+	}
+	fmt.Println()
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestContentHashesCheck(t *testing.T) {
+	h := make(contentHashes)
+	files := []struct {
+		info *FileTokenInfo
+		want string
+	}{
+		{&FileTokenInfo{Path: "a", Bytes: 5, Hash: contentHash([]byte("hello"))}, ""},
+		{&FileTokenInfo{Path: "b", Bytes: 5, Hash: contentHash([]byte("hello"))}, "a"},
+		{&FileTokenInfo{Path: "c", Bytes: 5, Hash: contentHash([]byte("world"))}, ""},
+		{&FileTokenInfo{Path: "d", Bytes: 0, Hash: contentHash(nil)}, ""},
+		{&FileTokenInfo{Path: "e", Bytes: 0, Hash: contentHash(nil)}, ""},
+	}
+	for _, f := range files {
+		if got := h.check(f.info); got != f.want {
+			t.Errorf("check(%s) = %q, want %q", f.info.Path, got, f.want)
+		}
+	}
+	if got := h.checkFor(&FileTokenInfo{Path: "f", Bytes: 5, Hash: contentHash([]byte("hello"))}, &CommandOptions{DiscardFiles: true}); got != "" {
+		t.Errorf("checkFor with DiscardFiles = %q, want \"\"", got)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"a.txt":     "the same words",
+		"b/a.txt":   "the same words",
+		"c/a.txt":   "the same words",
+		"other.txt": "other",
+		"empty1":    "",
+		"empty2":    "",
+	})
+
+	tests := []struct {
+		name    string
+		args    []string
+		counted int
+		note    string
+	}{
+		{"reported", nil, 6, "included in the totals"},
+		{"dedupe", []string{"-dedupe"}, 4, "left out of the totals"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, options := scanTree(t, dir, append([]string{"-model", "cl100k_base"}, tt.args...)...)
+			if got := len(countedPaths(dir, repo)); got != tt.counted {
+				t.Errorf("counted %d files, want %d", got, tt.counted)
+			}
+			var dups []string
+			for _, dup := range repo.Duplicates {
+				if dup.Original != filepath.Join(dir, "a.txt") {
+					t.Errorf("%s is reported as a duplicate of %s", dup.Path, dup.Original)
+				}
+				dups = append(dups, relativeTo(dir, dup.Path))
+			}
+			if want := []string{"b/a.txt", "c/a.txt"}; !reflect.DeepEqual(dups, want) {
+				t.Errorf("duplicates %v, want %v", dups, want)
+			}
+
+			out := captureStdout(t, func() { printDuplicates(repo, options) })
+			for _, want := range []string{tt.note, "a.txt (3 tokens) is duplicated by:", "  |- b/a.txt\n  |- c/a.txt"} {
+				if !strings.Contains(out, want) {
+					t.Errorf("printDuplicates is missing %q:\n%s", want, out)
+				}
+			}
+		})
+	}
+
+	if out := captureStdout(t, func() { printDuplicates(&RepoTokenInfo{}, &CommandOptions{}) }); out != "" {
+		t.Errorf("printDuplicates without duplicates printed %q", out)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// DiffFileInfo stores the changed lines of one file in a git diff and the
+// tokens its added lines take
+type DiffFileInfo struct {
+	Path         string
+	AddedLines   int
+	RemovedLines int
+	TokenCount   int // Tokens in the added and changed lines
+	RemovedCount int // Tokens in the removed lines
+	Binary       bool
+	added        []string
+	removed      []string
+}
+
+// DiffTokenInfo stores the token counts for a whole git diff
+type DiffTokenInfo struct {
+	Description string // What was diffed, e.g. "staged changes"
+	PatchTokens int    // Tokens in the full patch text, as it would be sent to a model
+	TokenCount  int    // Tokens in the added and changed lines only
+	Files       []*DiffFileInfo
+}
+
+// diffCommand defines the diff subcommand, which counts the tokens in the
+// working tree changes, the staged changes or a range of commits
+func diffCommand(fs *flag.FlagSet) func() {
+	options := &CommandOptions{}
+	var staged bool
+	var revRange string
+
+	registerFlags(fs, options)
+	fs.StringVar(&options.Path, "path", "", "Path of the repository, or a directory inside it, to diff (defaults to the current directory)")
+	fs.BoolVar(&options.ShowFiles, "files", true, "Whether to show individual file details")
+	fs.BoolVar(&staged, "staged", false, "Count the staged changes instead of the unstaged ones")
+	fs.StringVar(&revRange, "range", "", "Count the changes in a range of commits, e.g. main..HEAD")
+	return func() {
+		if staged && revRange != "" {
+			fmt.Fprintln(os.Stderr, "Error: -staged and -range can't be used together")
+			exit(1)
+		}
+		if len(options.Models) > 1 {
+			fmt.Fprintln(os.Stderr, "Error: -models is not supported by diff")
+			exit(1)
+		}
+
+		// The path is the repository (or a directory inside it) to diff
+		if options.Path == "" {
+			if fs.NArg() > 0 {
+				options.Path = fs.Arg(0)
+			} else {
+				options.Path = "."
+			}
+		}
+
+		gitArgs, description, err := diffArgs(staged, revRange)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		cmd := exec.Command("git", gitArgs...)
+		cmd.Dir = options.Path
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		patch, err := cmd.Output()
+		if err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				fmt.Fprintf(os.Stderr, "Error running git diff: %s\n", msg)
+			} else {
+				fmt.Fprintf(os.Stderr, "Error running git diff: %v\n", err)
+			}
+			exit(1)
+		}
+
+		diff, err := countDiff(string(patch), options)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error counting diff: %v\n", err)
+			exit(1)
+		}
+		diff.Description = description
+
+		PrintDiff(diff, options)
+	}
+}
+
+// diffArgs returns the arguments of the git diff of the staged changes, of
+// revRange or else of the unstaged changes, and the description of what it
+// diffs. A range starting with "-" is rejected, since git would take it for
+// an option, and "--" ends the revisions, so it can't be taken for a path.
+func diffArgs(staged bool, revRange string) ([]string, string, error) {
+	gitArgs := []string{"diff", "--no-color", "--no-ext-diff"}
+	description := "unstaged changes"
+	switch {
+	case staged:
+		gitArgs = append(gitArgs, "--staged")
+		description = "staged changes"
+	case strings.HasPrefix(revRange, "-"):
+		return nil, "", fmt.Errorf("invalid -range %q: a range can't start with \"-\"", revRange)
+	case revRange != "":
+		gitArgs = append(gitArgs, revRange)
+		description = revRange
+	}
+	return append(gitArgs, "--"), description, nil
+}
+
+// parseDiff splits a unified diff into files, collecting their added lines
+func parseDiff(patch string) []*DiffFileInfo {
+	var files []*DiffFileInfo
+	var current *DiffFileInfo
+	inHunk := false
+
+	scanner := bufio.NewScanner(strings.NewReader(patch))
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "diff --git ") {
+			// "diff --git a/path b/path"; the +++ header gives the path
+			// unambiguously, but deleted and binary files have no usable one
+			current = &DiffFileInfo{}
+			if i := strings.Index(line, " b/"); i >= 0 {
+				current.Path = line[i+3:]
+			}
+			files = append(files, current)
+			inHunk = false
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		// Inside a hunk, lines starting with "+++" or "---" are content
+		if !inHunk {
+			switch {
+			case strings.HasPrefix(line, "+++ "):
+				if path := strings.TrimPrefix(line, "+++ "); path != "/dev/null" {
+					current.Path = strings.TrimPrefix(path, "b/")
+				}
+			case strings.HasPrefix(line, "Binary files "):
+				current.Binary = true
+			case strings.HasPrefix(line, "@@"):
+				inHunk = true
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "+"):
+			current.AddedLines++
+			current.added = append(current.added, line[1:])
+		case strings.HasPrefix(line, "-"):
+			current.RemovedLines++
+			current.removed = append(current.removed, line[1:])
+		}
+	}
+	return files
+}
+
+// countDiff counts the tokens in a patch and in each file's added lines
+func countDiff(patch string, options *CommandOptions) (*DiffTokenInfo, error) {
+	encs, err := newCodecs(options)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &DiffTokenInfo{Files: parseDiff(patch)}
+	if diff.PatchTokens, err = countUnits(patch, encs[0], options.CountMode); err != nil {
+		return nil, err
+	}
+
+	if diff.TokenCount, _, err = countDiffFiles(diff.Files, encs[0], options.CountMode); err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+// countDiffFiles counts the added and removed lines of each file of a diff,
+// returning the totals
+func countDiffFiles(files []*DiffFileInfo, enc namedCodec, countMode string) (added int, removed int, err error) {
+	count := func(lines []string) (int, error) {
+		if len(lines) == 0 {
+			return 0, nil
+		}
+		return countUnits(strings.Join(lines, "\n")+"\n", enc, countMode)
+	}
+	for _, file := range files {
+		if file.TokenCount, err = count(file.added); err != nil {
+			return 0, 0, fmt.Errorf("%s: %v", file.Path, err)
+		}
+		if file.RemovedCount, err = count(file.removed); err != nil {
+			return 0, 0, fmt.Errorf("%s: %v", file.Path, err)
+		}
+		added += file.TokenCount
+		removed += file.RemovedCount
+		file.added, file.removed = nil, nil
+	}
+	return added, removed, nil
+}
+
+// PrintDiff prints the counts for a diff, with files sorted by token count
+func PrintDiff(diff *DiffTokenInfo, options *CommandOptions) {
+	unit := options.unitName()
+	fmt.Printf("Token Count Summary for git diff (%s)\n", diff.Description)
+	fmt.Printf("Total %s in patch: %d\n", unit, diff.PatchTokens)
+	fmt.Printf("Total %s in added lines: %d\n\n", unit, diff.TokenCount)
+
+	if !options.ShowFiles || len(diff.Files) == 0 {
+		return
+	}
+
+	files := append([]*DiffFileInfo(nil), diff.Files...)
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].TokenCount > files[j].TokenCount
+	})
+
+	fmt.Println("Files (sorted by token count):")
+	fmt.Println("----------------------------------")
+	for _, file := range files {
+		if file.Binary {
+			fmt.Printf("%s: binary\n", file.Path)
+			continue
+		}
+		fmt.Printf("%s: %d %s (+%d -%d lines)\n", file.Path, file.TokenCount, unit, file.AddedLines, file.RemovedLines)
+	}
+}
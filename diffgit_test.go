@@ -0,0 +1,82 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		staged      bool
+		revRange    string
+		want        []string
+		description string
+		wantErr     bool
+	}{
+		{"unstaged", false, "", []string{"diff", "--no-color", "--no-ext-diff", "--"}, "unstaged changes", false},
+		{"staged", true, "", []string{"diff", "--no-color", "--no-ext-diff", "--staged", "--"}, "staged changes", false},
+		{"range", false, "main..HEAD", []string{"diff", "--no-color", "--no-ext-diff", "main..HEAD", "--"}, "main..HEAD", false},
+		{"option as a range", false, "--output=/tmp/x", nil, "", true},
+		{"short option as a range", false, "-p", nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, description, err := diffArgs(tt.staged, tt.revRange)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("diffArgs error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) || description != tt.description {
+				t.Errorf("diffArgs = %q, %q, want %q, %q", got, description, tt.want, tt.description)
+			}
+		})
+	}
+}
+
+func TestCountDiff(t *testing.T) {
+	patch := `diff --git a/a.txt b/a.txt
+--- a/a.txt
++++ b/a.txt
+@@ -1,2 +1,2 @@
+ same
+-old line
++hello world
+diff --git a/new.txt b/new.txt
+new file mode 100644
+--- /dev/null
++++ b/new.txt
+@@ -0,0 +1 @@
++x
+diff --git a/logo.png b/logo.png
+Binary files a/logo.png and b/logo.png differ
+`
+	diff, err := countDiff(patch, testOptions(t, "-model", "cl100k_base"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diff.Files) != 3 || diff.Files[0].Path != "a.txt" || diff.Files[1].Path != "new.txt" || !diff.Files[2].Binary {
+		t.Fatalf("files = %+v, want a.txt, new.txt and binary logo.png", diff.Files)
+	}
+	// "hello world\n" and "x\n"
+	if diff.TokenCount != 5 || diff.Files[0].RemovedCount != 3 {
+		t.Errorf("added %d tokens, removed %d from a.txt, want 5 and 3", diff.TokenCount, diff.Files[0].RemovedCount)
+	}
+
+	if _, err := countDiff(patch, testOptions(t, "-model", "no-such-model")); err == nil {
+		t.Error("countDiff with an unknown model succeeded")
+	}
+}
+
+func TestDiffRangeWithGit(t *testing.T) {
+	// Without "--", git can't tell the revision from the file of that name
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"HEAD": "a file named like the revision"})
+	gitArgs, _, err := diffArgs(false, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "init", "-q")
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-qm", "initial")
+	runGit(t, dir, gitArgs...)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// DryRun is what a scan would count, found by walking and filtering the tree
+// without reading any file
+type DryRun struct {
+	Metadata *ScanMetadata  `json:"metadata"`
+	Files    int            `json:"files"`
+	Bytes    int64          `json:"bytes"`
+	Listed   []*DryRunEntry `json:"listed"`
+	Errors   []string       `json:"errors,omitempty"`
+}
+
+// DryRunEntry is a file a scan would count
+type DryRunEntry struct {
+	Path    string `json:"path"` // Relative to the scanned directory, with slashes
+	Bytes   int64  `json:"bytes"`
+	Archive bool   `json:"archive,omitempty"` // With -archives, whose entries would be counted
+}
+
+// validateDryRun checks the options of scan -dry-run. Options that need the
+// files' counts, or that report on single files, can't be previewed.
+func validateDryRun(options *CommandOptions, estimateOptions *EstimateOptions, filesFrom string, copyOptions *CopyOptions) error {
+	if options.Format != "text" && options.Format != "json" {
+		return fmt.Errorf("-dry-run can only print text or json, not %s", options.Format)
+	}
+	for _, conflict := range []struct {
+		set  bool
+		flag string
+	}{
+		{options.IsSingleFile, "-file"},
+		{filesFrom != "", "-files-from"},
+		{estimateOptions.Enabled, "-estimate"},
+		{options.Cached, "-cached"},
+		{options.Resume, "-resume"},
+		{options.Images, "-images"},
+		{options.MinTokens > 0, "-min"},
+		{options.Dedupe, "-dedupe"},
+		{options.ByAuthor, "-by-author"},
+		{options.WithMetadata, "-with-metadata"},
+		{options.Stats, "-stats"},
+		{options.HeadTokens > 0 || options.TailTokens > 0, "-head-tokens and -tail-tokens"},
+		{options.hasTiers(), "-warn-file-tokens and -crit-file-tokens"},
+		{copyOptions.Enabled, "-copy"},
+	} {
+		if conflict.set {
+			return fmt.Errorf("-dry-run can't be used with %s", conflict.flag)
+		}
+	}
+	return nil
+}
+
+// dryRunRepository walks rootPath as a scan would and lists the files it
+// would count, sorted by path
+func dryRunRepository(ctx context.Context, rootPath string, options *CommandOptions) (*DryRun, *RepoTokenInfo, error) {
+	dryRun := &DryRun{Listed: []*DryRunEntry{}}
+	listing := *options
+	listing.collectArchives = true
+	listing.collect = func(path string, info os.FileInfo) {
+		dryRun.Listed = append(dryRun.Listed, &DryRunEntry{
+			Path:    filepath.ToSlash(relativeTo(rootPath, path)),
+			Bytes:   info.Size(),
+			Archive: options.Archives && archiveKind(path) != "",
+		})
+		dryRun.Bytes += info.Size()
+	}
+	repo, err := ProcessRepository(ctx, rootPath, &listing)
+	if err != nil {
+		return nil, repo, err
+	}
+	sort.Slice(dryRun.Listed, func(i, j int) bool { return dryRun.Listed[i].Path < dryRun.Listed[j].Path })
+	dryRun.Files = len(dryRun.Listed)
+	for _, fileErr := range repo.Errors {
+		dryRun.Errors = append(dryRun.Errors, fileErr.Error())
+	}
+	return dryRun, repo, nil
+}
+
+// runDryRun lists the files a scan of options.Path would count and prints
+// them, returning the walk's result for -skipped-report and the errors.
+// Quiet mode prints only their paths, which -files-from reads back.
+func runDryRun(ctx context.Context, options *CommandOptions) *RepoTokenInfo {
+	if !options.Quiet {
+		fmt.Fprintf(os.Stderr, "Listing directory: %s\n", options.Path)
+	}
+	dryRun, repo, err := dryRunRepository(ctx, options.Path, options)
+	if interrupted(err) {
+		err = interruptedError(err, options)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error processing repository: %v\n", err)
+		exit(1)
+	}
+
+	switch {
+	case options.Quiet:
+		for _, entry := range dryRun.Listed {
+			fmt.Println(entry.Path)
+		}
+	case options.Format == "json":
+		dryRun.Metadata = newScanMetadata(repo, options)
+		dryRun.Metadata.Files = dryRun.Files
+		data, _ := json.MarshalIndent(dryRun, "", "  ")
+		fmt.Println(string(data))
+	default:
+		printDryRun(options.Path, dryRun, options)
+	}
+	return repo
+}
+
+// printDryRun prints the files a scan would count with their sizes
+func printDryRun(path string, dryRun *DryRun, options *CommandOptions) {
+	fmt.Println(options.paint(ansiBold, "Files a scan of "+path+" would count:"))
+	fmt.Println("----------------------------------")
+	for _, entry := range dryRun.Listed {
+		line := fmt.Sprintf("%s: %s bytes", entry.Path, formatCount(int(entry.Bytes)))
+		if entry.Archive {
+			line += " (archive, its entries would be counted)"
+		}
+		fmt.Println(line)
+	}
+	fmt.Println()
+	fmt.Printf("%s files, %s bytes; nothing was tokenized\n", options.paint(ansiBold, formatCount(dryRun.Files)), formatCount(int(dryRun.Bytes)))
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateDryRun(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		filesFrom string
+		estimate  bool
+		want      string
+	}{
+		{"text", nil, "", false, ""},
+		{"json", []string{"-format", "json"}, "", false, ""},
+		{"csv", []string{"-format", "csv"}, "", false, "-dry-run can only print text or json, not csv"},
+		{"-files-from", nil, "list.txt", false, "-dry-run can't be used with -files-from"},
+		{"-estimate", nil, "", true, "-dry-run can't be used with -estimate"},
+		{"-min", []string{"-min", "5"}, "", false, "-dry-run can't be used with -min"},
+		{"-dedupe", []string{"-dedupe"}, "", false, "-dry-run can't be used with -dedupe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := testOptions(t, tt.args...)
+			err := validateDryRun(options, &EstimateOptions{Enabled: tt.estimate}, tt.filesFrom, &CopyOptions{})
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("validateDryRun = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDryRunRepository(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		".gitignore":     "vendor\n",
+		"a.txt":          "hello world",
+		"src/b.go":       "one two three",
+		"vendor/c.go":    "four",
+		"logo.png":       "not text",
+		"docs/readme.md": "hello",
+	})
+	options := testOptions(t, "-model", "cl100k_base")
+	dryRun, repo, err := dryRunRepository(t.Context(), dir, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, entry := range dryRun.Listed {
+		paths = append(paths, entry.Path)
+	}
+	if got := strings.Join(paths, " "); got != "a.txt docs/readme.md src/b.go" {
+		t.Errorf("dry run listed %s", got)
+	}
+	if dryRun.Files != len(paths) || repo.TokenCount != 0 {
+		t.Errorf("dry run of %d files counted %d tokens", dryRun.Files, repo.TokenCount)
+	}
+	var bytes int64
+	for _, entry := range dryRun.Listed {
+		bytes += entry.Bytes
+	}
+	if dryRun.Bytes != bytes {
+		t.Errorf("dry run totals %d bytes, its files %d", dryRun.Bytes, bytes)
+	}
+
+	if _, _, err := dryRunRepository(t.Context(), dir+"/missing", options); err == nil {
+		t.Error("dry run of a missing directory succeeded")
+	}
+}
+
+func TestDryRunCommand(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world", "src/b.go": "one two three"})
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"text", nil, "a.txt: 11 bytes\nsrc/b.go: 13 bytes\n\n2 files, 24 bytes; nothing was tokenized\n"},
+		{"quiet", []string{"-quiet"}, "a.txt\nsrc/b.go\n"},
+		{"json", []string{"-format", "json"}, `"files": 2,
+  "bytes": 24,
+  "listed": [
+    {
+      "path": "a.txt",
+      "bytes": 11
+    },`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"-dry-run", "-model", "cl100k_base", "-color", "never"}, tt.args...)
+			out := captureStdout(t, func() { findCommand("scan").run(append(args, dir)) })
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("scan -dry-run printed\n%s\nwant %q", out, tt.want)
+			}
+		})
+	}
+
+	stderr, code := exitStatus(t, func() { findCommand("scan").run([]string{"-dry-run", "-dedupe", dir}) })
+	if code != 1 || !strings.Contains(stderr, "Error: -dry-run can't be used with -dedupe") {
+		t.Errorf("exit %d, stderr:\n%s", code, stderr)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/encoding/unicode/utf32"
+)
+
+// Byte order marks, longest first so UTF-32LE isn't taken for UTF-16LE
+var boms = []struct {
+	BOM      []byte
+	Name     string
+	Encoding encoding.Encoding
+}{
+	{[]byte{0xFF, 0xFE, 0x00, 0x00}, "utf-32le", utf32.UTF32(utf32.LittleEndian, utf32.ExpectBOM)},
+	{[]byte{0x00, 0x00, 0xFE, 0xFF}, "utf-32be", utf32.UTF32(utf32.BigEndian, utf32.ExpectBOM)},
+	{[]byte{0xEF, 0xBB, 0xBF}, "utf-8 with BOM", nil},
+	{[]byte{0xFF, 0xFE}, "utf-16le", unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)},
+	{[]byte{0xFE, 0xFF}, "utf-16be", unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)},
+}
+
+// decodeText converts file contents to UTF-8 so they tokenize like the text
+// they hold. It returns the text and the name of the encoding it was
+// converted from, or "" if the data was already plain UTF-8.
+//
+// Byte order marks are honored first. Without one, text that alternates NUL
+// bytes with ASCII is taken for BOM-less UTF-16, and anything else that isn't
+// valid UTF-8 is decoded as Latin-1 (as windows-1252, like browsers do).
+func decodeText(data []byte) (string, string) {
+	for _, bom := range boms {
+		if !bytes.HasPrefix(data, bom.BOM) {
+			continue
+		}
+		if bom.Encoding == nil {
+			return string(data[len(bom.BOM):]), bom.Name
+		}
+		if text, err := bom.Encoding.NewDecoder().Bytes(data); err == nil {
+			return string(text), bom.Name
+		}
+		break
+	}
+
+	if name, enc := sniffUTF16(data); enc != nil {
+		if text, err := enc.NewDecoder().Bytes(data); err == nil {
+			return string(text), name
+		}
+	}
+
+	if utf8.Valid(data) {
+		return string(data), ""
+	}
+	text, err := charmap.Windows1252.NewDecoder().Bytes(data)
+	if err != nil {
+		return string(data), ""
+	}
+	return string(text), "latin-1"
+}
+
+// sniffUTF16 detects UTF-16 without a byte order mark from the position of
+// NUL bytes: mostly-ASCII UTF-16 has a NUL in every other byte, on the odd
+// side for little-endian and the even side for big-endian
+func sniffUTF16(data []byte) (string, encoding.Encoding) {
+	sample := data
+	if len(sample) > 4096 {
+		sample = sample[:4096]
+	}
+	pairs := len(sample) / 2
+	if pairs < 2 {
+		return "", nil
+	}
+
+	evenNULs, oddNULs := 0, 0
+	for i := 0; i+1 < len(sample); i += 2 {
+		if sample[i] == 0 {
+			evenNULs++
+		}
+		if sample[i+1] == 0 {
+			oddNULs++
+		}
+	}
+
+	switch {
+	case oddNULs*10 >= pairs*4 && evenNULs*10 < pairs:
+		return "utf-16le", unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	case evenNULs*10 >= pairs*4 && oddNULs*10 < pairs:
+		return "utf-16be", unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	}
+	return "", nil
+}
+
+// printTranscoded lists the files that were converted to UTF-8 before
+// counting, and the encoding each one was in
+func printTranscoded(repo *RepoTokenInfo) {
+	var lines []string
+	for _, dirInfo := range repo.Dirs {
+		for _, fileInfo := range dirInfo.Files {
+			if fileInfo.Encoding != "" {
+				relativePath := relativeTo(repo.Path, fileInfo.Path)
+				lines = append(lines, fmt.Sprintf("%s (%s)", relativePath, fileInfo.Encoding))
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+	sort.Strings(lines)
+
+	fmt.Printf("Transcoded to UTF-8 (%d):\n", len(lines))
+	fmt.Println("-------------------")
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+	fmt.Println()
+}
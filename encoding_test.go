@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestDecodeText(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		text     string
+		encoding string
+	}{
+		{"utf-8", "héllo", "héllo", ""},
+		{"utf-8 with a bom", "\xef\xbb\xbfhéllo", "héllo", "utf-8 with BOM"},
+		{"utf-16le", "\xff\xfeh\x00\xe9\x00", "hé", "utf-16le"},
+		{"utf-16be", "\xfe\xff\x00h\x00\xe9", "hé", "utf-16be"},
+		{"utf-32le", "\xff\xfe\x00\x00h\x00\x00\x00", "h", "utf-32le"},
+		{"utf-16le without a bom", "h\x00i\x00!\x00", "hi!", "utf-16le"},
+		{"utf-16be without a bom", "\x00h\x00i\x00!", "hi!", "utf-16be"},
+		{"latin-1", "caf\xe9 \x93quoted\x94", "café “quoted”", "latin-1"},
+		{"too short to sniff", "h\x00", "h\x00", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, encoding := decodeText([]byte(tt.data))
+			if text != tt.text || encoding != tt.encoding {
+				t.Errorf("decodeText = %q, %q, want %q, %q", text, encoding, tt.text, tt.encoding)
+			}
+		})
+	}
+}
+
+func TestPrintTranscoded(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "plain", "sub/b.txt": "\xff\xfeh\x00i\x00", "c.txt": "caf\xe9"})
+	repo, _ := scanTree(t, dir, "-model", "cl100k_base")
+	if out := captureStdout(t, func() { printTranscoded(repo) }); out != "Transcoded to UTF-8 (2):\n-------------------\nc.txt (latin-1)\nsub/b.txt (utf-16le)\n\n" {
+		t.Errorf("printTranscoded printed %q", out)
+	}
+
+	plainDir := t.TempDir()
+	writeTree(t, plainDir, map[string]string{"a.txt": "plain"})
+	plain, _ := scanTree(t, plainDir, "-model", "cl100k_base")
+	if out := captureStdout(t, func() { printTranscoded(plain) }); out != "" {
+		t.Errorf("printTranscoded without transcoded files printed %q", out)
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// EstimateOptions stores scan's options for estimating the total from a
+// sample of the files
+type EstimateOptions struct {
+	Enabled     bool
+	SampleFiles int     // Most files to count
+	SampleBytes int64   // Most bytes to count, which bounds the time taken
+	Confidence  float64 // Confidence level of the interval, e.g. 0.95
+}
+
+// registerEstimateFlags defines scan's estimate flags
+func registerEstimateFlags(fs *flag.FlagSet, estimateOptions *EstimateOptions) {
+	estimateOptions.SampleBytes = 16 << 20
+	fs.BoolVar(&estimateOptions.Enabled, "estimate", false, "Estimate the total from a sample of the files, stratified by extension and spread over sizes, instead of counting every file")
+	fs.IntVar(&estimateOptions.SampleFiles, "sample-files", 1000, "With -estimate, count at most this many files")
+	fs.Func("sample-bytes", "With -estimate, count at most this many bytes, with an optional K, M or G suffix (default 16M)", func(value string) error {
+		size, err := parseByteSize(value)
+		estimateOptions.SampleBytes = size
+		return err
+	})
+	fs.Float64Var(&estimateOptions.Confidence, "confidence", 0.95, "Confidence level of the -estimate interval, between 0 and 1")
+}
+
+// Estimate is the extrapolated total of a scan that counted a sample of the
+// files, with a confidence interval
+type Estimate struct {
+	Metadata     *ScanMetadata        `json:"metadata"`
+	Total        int                  `json:"total"`
+	Low          int                  `json:"low"`  // Lower bound of the confidence interval
+	High         int                  `json:"high"` // Upper bound of the confidence interval
+	Confidence   float64              `json:"confidence"`
+	Files        int                  `json:"files"`
+	SampledFiles int                  `json:"sampled_files"`
+	Bytes        int64                `json:"bytes"`
+	SampledBytes int64                `json:"sampled_bytes"`
+	Extensions   []*ExtensionEstimate `json:"extensions"`
+	Errors       []string             `json:"errors,omitempty"`
+
+	margin float64
+}
+
+// ExtensionEstimate is the part of an estimate from the files with one
+// extension, which form a stratum of the sample
+type ExtensionEstimate struct {
+	Extension    string `json:"extension"`
+	Total        int    `json:"total"`
+	Files        int    `json:"files"`
+	SampledFiles int    `json:"sampled_files"`
+
+	paths    []string
+	sizes    []int64
+	bytes    int64
+	variance float64
+}
+
+// validateEstimate checks the options of scan -estimate. Options that need
+// every file counted, or that report on single files, can't be estimated.
+func validateEstimate(options *CommandOptions, estimateOptions *EstimateOptions, filesFrom string, copyOptions *CopyOptions) error {
+	if estimateOptions.SampleFiles < 1 || estimateOptions.SampleBytes < 1 {
+		return fmt.Errorf("-sample-files and -sample-bytes must be at least 1")
+	}
+	if c := estimateOptions.Confidence; c <= 0 || c >= 1 {
+		return fmt.Errorf("-confidence must be between 0 and 1, e.g. 0.95")
+	}
+	if options.Format != "text" && options.Format != "json" {
+		return fmt.Errorf("-estimate can only print text or json, not %s", options.Format)
+	}
+	for _, conflict := range []struct {
+		set  bool
+		flag string
+	}{
+		{options.IsSingleFile, "-file"},
+		{filesFrom != "", "-files-from"},
+		{options.Archives, "-archives"},
+		{options.Resume, "-resume"},
+		{options.Images, "-images"},
+		{options.MinTokens > 0, "-min"},
+		{options.Dedupe, "-dedupe"},
+		{len(options.Models) > 1, "-models"},
+		{options.ByAuthor, "-by-author"},
+		{options.WithMetadata, "-with-metadata"},
+		{options.Stats, "-stats"},
+		{options.HeadTokens > 0 || options.TailTokens > 0, "-head-tokens and -tail-tokens"},
+		{options.hasTiers(), "-warn-file-tokens and -crit-file-tokens"},
+		{options.SkippedReport != "", "-skipped-report"},
+		{copyOptions.Enabled, "-copy"},
+	} {
+		if conflict.set {
+			return fmt.Errorf("-estimate can't be used with %s", conflict.flag)
+		}
+	}
+	return nil
+}
+
+// runEstimate estimates the total of options.Path and prints it
+func runEstimate(ctx context.Context, options *CommandOptions, estimateOptions *EstimateOptions) {
+	if !options.Quiet {
+		fmt.Fprintf(os.Stderr, "Estimating directory: %s\n", options.Path)
+	}
+	estimate, repo, err := estimateRepository(ctx, options.Path, options, estimateOptions)
+	if interrupted(err) {
+		err = interruptedError(err, options)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error processing repository: %v\n", err)
+		exit(1)
+	}
+
+	switch {
+	case options.Quiet:
+		fmt.Println(estimate.Total)
+	case options.Format == "json":
+		estimate.Metadata = newScanMetadata(repo, options)
+		estimate.Metadata.Files = estimate.Files
+		writeEstimateJSON(estimate)
+	default:
+		printEstimate(options.Path, estimate, options)
+	}
+	PrintErrors(repo)
+	if options.Strict && len(repo.Errors) > 0 {
+		exit(1)
+	}
+}
+
+// estimateRepository lists the files a scan of rootPath would count, counts
+// a sample of them stratified by extension, and extrapolates the total.
+//
+// Token counts grow with file size, and so does the time to count a file, so
+// each extension's sample is proportional to the square root of its files
+// times its bytes, the optimal allocation under those costs, scaled to fit
+// both -sample-files and -sample-bytes. Within an extension, files are picked
+// at even steps through them in order of size, so the sample spans the sizes,
+// and its total is its bytes at the sample's tokens per byte. Extensions get
+// at least two files so their variance can be estimated; those that small
+// are counted in full.
+func estimateRepository(ctx context.Context, rootPath string, options *CommandOptions, estimateOptions *EstimateOptions) (*Estimate, *RepoTokenInfo, error) {
+	byExt := make(map[string]*ExtensionEstimate)
+	listing := *options
+	listing.collect = func(path string, info os.FileInfo) {
+		ext := strings.ToLower(filepath.Ext(path))
+		s := byExt[ext]
+		if s == nil {
+			s = &ExtensionEstimate{Extension: ext}
+			byExt[ext] = s
+		}
+		s.paths = append(s.paths, path)
+		s.sizes = append(s.sizes, info.Size())
+		s.bytes += info.Size()
+	}
+	repo, err := ProcessRepository(ctx, rootPath, &listing)
+	if err != nil {
+		return nil, repo, err
+	}
+
+	estimate := &Estimate{Confidence: estimateOptions.Confidence}
+	weight := func(s *ExtensionEstimate) float64 { return math.Sqrt(float64(len(s.paths)) * float64(s.bytes)) }
+	var weights, cost float64
+	for _, ext := range sortedKeys(byExt) {
+		s := byExt[ext]
+		s.Files = len(s.paths)
+		estimate.Files += s.Files
+		estimate.Bytes += s.bytes
+		estimate.Extensions = append(estimate.Extensions, s)
+		weights += weight(s)
+		cost += weight(s) * float64(s.bytes) / float64(s.Files)
+	}
+	scale := 0.0
+	if cost > 0 {
+		scale = min(float64(estimateOptions.SampleFiles)/weights, float64(estimateOptions.SampleBytes)/cost)
+	}
+
+	encs, err := newCodecs(options)
+	if err != nil {
+		return nil, repo, err
+	}
+	// The seed is fixed, so the same tree gives the same estimate
+	rng := rand.New(rand.NewPCG(1, uint64(estimate.Files)))
+	var total, variance float64
+	for _, s := range estimate.Extensions {
+		bySize := make([]int, s.Files)
+		for i := range bySize {
+			bySize[i] = i
+		}
+		sort.SliceStable(bySize, func(i, j int) bool { return s.sizes[bySize[i]] < s.sizes[bySize[j]] })
+		n := min(max(int(math.Ceil(scale*weight(s))), 2), s.Files)
+		step := float64(s.Files) / float64(n)
+		start := rng.Float64() * step
+
+		var counts, sizes []float64
+		var sampleTokens, sampleBytes float64
+		for j := range n {
+			if err := ctx.Err(); err != nil {
+				return nil, repo, err
+			}
+			i := bySize[min(int(start+float64(j)*step), s.Files-1)]
+			fileInfo, err := countFile(s.paths[i], encs, options)
+			if err != nil {
+				repo.Errors = append(repo.Errors, &FileError{s.paths[i], err})
+				continue
+			}
+			counts = append(counts, float64(fileInfo.TokenCount))
+			sizes = append(sizes, float64(s.sizes[i]))
+			sampleTokens += float64(fileInfo.TokenCount)
+			sampleBytes += float64(s.sizes[i])
+			estimate.SampledFiles++
+			estimate.SampledBytes += s.sizes[i]
+		}
+		s.SampledFiles = len(counts)
+		if s.SampledFiles == 0 {
+			continue
+		}
+
+		// Ratio estimator, with the variance of the residuals from the ratio
+		extTotal := sampleTokens / float64(s.SampledFiles) * float64(s.Files)
+		ratio := 0.0
+		if sampleBytes > 0 {
+			ratio = sampleTokens / sampleBytes
+			extTotal = ratio * float64(s.bytes)
+		}
+		if k, size := float64(s.SampledFiles), float64(s.Files); k > 1 && k < size {
+			residuals := 0.0
+			for j, count := range counts {
+				residual := count - ratio*sizes[j]
+				residuals += residual * residual
+			}
+			s.variance = size * size * (1 - k/size) * residuals / (k - 1) / k
+		}
+		s.Total = int(math.Round(extTotal))
+		total += extTotal
+		variance += s.variance
+	}
+
+	z := math.Sqrt2 * math.Erfinv(estimate.Confidence)
+	estimate.margin = z * math.Sqrt(variance)
+	estimate.Total = int(math.Round(total))
+	estimate.Low = max(int(math.Round(total-estimate.margin)), 0)
+	estimate.High = int(math.Round(total + estimate.margin))
+	sort.SliceStable(estimate.Extensions, func(i, j int) bool {
+		return estimate.Extensions[i].Total > estimate.Extensions[j].Total
+	})
+	for _, fileErr := range repo.Errors {
+		estimate.Errors = append(estimate.Errors, fileErr.Error())
+	}
+	return estimate, repo, nil
+}
+
+// printEstimate prints an estimate with its confidence interval and the
+// share of each extension
+func printEstimate(path string, estimate *Estimate, options *CommandOptions) {
+	unit := options.unitName()
+	fmt.Println(options.paint(ansiBold, "Token Count Estimate for: "+path))
+	fmt.Printf("Estimated %s: %s ± %s (%s to %s, %g%% confidence)\n", unit, options.paint(ansiBold, formatCount(estimate.Total)),
+		formatCount(int(math.Round(estimate.margin))), formatCount(estimate.Low), formatCount(estimate.High), estimate.Confidence*100)
+	fmt.Printf("Counted %s of %s files (%.1f%% of %s bytes)\n\n", formatCount(estimate.SampledFiles), formatCount(estimate.Files),
+		percentOf(int(estimate.SampledBytes>>10), int(estimate.Bytes>>10)), formatCount(int(estimate.Bytes)))
+	if len(estimate.Extensions) == 0 {
+		return
+	}
+
+	z := math.Sqrt2 * math.Erfinv(estimate.Confidence)
+	fmt.Println(options.paint(ansiBold, "Extensions (sorted by estimated "+strings.TrimSuffix(unit, "s")+" count):"))
+	fmt.Println("----------------------------------")
+	for _, ext := range estimate.Extensions {
+		name := ext.Extension
+		if name == "" {
+			name = "(none)"
+		}
+		fmt.Println(options.paint(shareColor(ext.Total, estimate.Total), fmt.Sprintf("%s: %s ± %s %s (%.1f%% of total, %s files, %s counted)",
+			name, formatCount(ext.Total), formatCount(int(math.Round(z*math.Sqrt(ext.variance)))), unit,
+			percentOf(ext.Total, estimate.Total), formatCount(ext.Files), formatCount(ext.SampledFiles))))
+	}
+}
+
+// writeEstimateJSON prints an estimate as indented JSON
+func writeEstimateJSON(estimate *Estimate) {
+	data, _ := json.MarshalIndent(estimate, "", "  ")
+	fmt.Println(string(data))
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestEstimateRepository(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{"README": "no extension here"}
+	for i := range 40 {
+		files[fmt.Sprintf("src/f%02d.go", i)] = "package main\n\n" + strings.Repeat("var x = 1\n", i+1)
+		files[fmt.Sprintf("docs/d%02d.md", i)] = strings.Repeat("Some words about it. ", i%5+1)
+	}
+	writeTree(t, dir, files)
+	exact, options := scanTree(t, dir, "-model", "cl100k_base")
+
+	tests := []struct {
+		name        string
+		sampleFiles int
+		exact       bool
+	}{
+		{"sample", 10, false},
+		{"every file", 1000, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			estimateOptions := &EstimateOptions{SampleFiles: tt.sampleFiles, SampleBytes: 16 << 20, Confidence: 0.95}
+			estimate, _, err := estimateRepository(t.Context(), dir, options, estimateOptions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if estimate.Files != 81 || len(estimate.Extensions) != 3 {
+				t.Errorf("%d files in %d extensions, want 81 in 3", estimate.Files, len(estimate.Extensions))
+			}
+			if tt.exact {
+				if estimate.SampledFiles != 81 || estimate.Total != exact.TokenCount || estimate.Low != estimate.Total || estimate.High != estimate.Total {
+					t.Errorf("estimate of every file %d (%d to %d) from %d files, want exactly %d", estimate.Total, estimate.Low, estimate.High, estimate.SampledFiles, exact.TokenCount)
+				}
+				return
+			}
+			if estimate.SampledFiles > 15 || estimate.SampledFiles < 5 {
+				t.Errorf("sampled %d files, want about 10", estimate.SampledFiles)
+			}
+			if estimate.Low > exact.TokenCount || estimate.High < exact.TokenCount || estimate.Low > estimate.Total || estimate.High < estimate.Total {
+				t.Errorf("estimate %d (%d to %d), actual total %d", estimate.Total, estimate.Low, estimate.High, exact.TokenCount)
+			}
+			// The extension without a sample to spare is counted in full
+			for _, ext := range estimate.Extensions {
+				if ext.Extension == "" && (ext.SampledFiles != 1 || ext.Total != 3) {
+					t.Errorf("files without an extension %+v", ext)
+				}
+			}
+			again, _, _ := estimateRepository(t.Context(), dir, options, estimateOptions)
+			if again.Total != estimate.Total {
+				t.Errorf("estimates of the same tree differ: %d and %d", estimate.Total, again.Total)
+			}
+		})
+	}
+}
+
+func TestValidateEstimate(t *testing.T) {
+	valid := EstimateOptions{SampleFiles: 10, SampleBytes: 1 << 20, Confidence: 0.95}
+	tests := []struct {
+		name     string
+		args     []string
+		estimate func(*EstimateOptions)
+		want     string
+	}{
+		{"defaults", nil, nil, ""},
+		{"json", []string{"-format", "json"}, nil, ""},
+		{"no files", nil, func(e *EstimateOptions) { e.SampleFiles = 0 }, "-sample-files and -sample-bytes must be at least 1"},
+		{"confidence of 1", nil, func(e *EstimateOptions) { e.Confidence = 1 }, "-confidence must be between 0 and 1"},
+		{"tree", []string{"-format", "tree"}, nil, "-estimate can only print text or json, not tree"},
+		{"-min", []string{"-min", "5"}, nil, "-estimate can't be used with -min"},
+		{"-dedupe", []string{"-dedupe"}, nil, "-estimate can't be used with -dedupe"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := testOptions(t, tt.args...)
+			estimateOptions := valid
+			if tt.estimate != nil {
+				tt.estimate(&estimateOptions)
+			}
+			err := validateEstimate(options, &estimateOptions, "", &CopyOptions{})
+			if tt.want == "" && err != nil || tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+				t.Errorf("validateEstimate = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrintEstimate(t *testing.T) {
+	estimate := &Estimate{
+		Total: 1200, Low: 1100, High: 1300, Confidence: 0.95, margin: 100,
+		Files: 40, SampledFiles: 10, Bytes: 40 << 10, SampledBytes: 10 << 10,
+		Extensions: []*ExtensionEstimate{{Extension: ".go", Total: 900, Files: 30, SampledFiles: 8}, {Total: 300, Files: 10, SampledFiles: 2}},
+	}
+	out := captureStdout(t, func() { printEstimate("repo", estimate, &CommandOptions{}) })
+	for _, want := range []string{
+		"Estimated tokens: 1,200 ± 100 (1,100 to 1,300, 95% confidence)",
+		"Counted 10 of 40 files (25.0% of 40,960 bytes)",
+		".go: 900 ± 0 tokens (75.0% of total, 30 files, 8 counted)",
+		"(none): 300 ± 0 tokens",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("estimate has no %q:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+)
+
+// explainFormats are the output formats of the explain subcommand
+var explainFormats = map[string]bool{"text": true, "json": true}
+
+// Explanation is why a scan includes a file or directory, or leaves it out
+type Explanation struct {
+	Path      string   `json:"path"`
+	Directory bool     `json:"directory,omitempty"`
+	Included  bool     `json:"included"`
+	Reason    string   `json:"reason,omitempty"` // Why it's left out, as in -skipped-report
+	Rule      string   `json:"rule,omitempty"`   // Such as the ignore file, line and pattern that matched
+	Under     string   `json:"under,omitempty"`  // The skipped directory it's in, if it wasn't skipped itself
+	Total     int      `json:"total,omitempty"`  // Of an included file
+	Files     int      `json:"files,omitempty"`  // Included under a directory
+	Passed    []string `json:"passed,omitempty"` // The filters an included file went through
+	Error     string   `json:"error,omitempty"`
+}
+
+// explainCommand defines the explain subcommand, which runs the walk of a
+// scan and reports the rule that includes or excludes each path given
+func explainCommand(fs *flag.FlagSet) func() {
+	options := &CommandOptions{}
+	registerFlags(fs, options)
+	registerWalkFlags(fs, options)
+	fs.StringVar(&options.Format, "format", "text", "Output format: text or json")
+	return func() {
+		if !explainFormats[options.Format] {
+			fmt.Fprintf(os.Stderr, "Error: unknown format %q (expected text or json)\n", options.Format)
+			exit(1)
+		}
+		if fs.NArg() == 0 {
+			fmt.Fprintln(os.Stderr, "Error: explain needs the path of at least one file or directory to explain")
+			exit(1)
+		}
+		targets := fs.Args()
+
+		// The scan root is -path, or the current directory, never the first
+		// argument as with scan
+		if options.Path == "" {
+			options.Path = "."
+		}
+		if err := resolveTarget(fs, options); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		if options.IsSingleFile {
+			fmt.Fprintf(os.Stderr, "Error: -path must be the directory a scan would walk, not a file\n")
+			exit(1)
+		}
+		if err := loadModelRoutes(options); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		ctx, cancel := commandContext(options)
+		defer cancel()
+		explanations, err := explainPaths(ctx, targets, options)
+		if interrupted(err) {
+			err = interruptedError(err, options)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error processing %s: %v\n", options.Path, err)
+			exit(1)
+		}
+
+		if options.Format == "json" {
+			data, err := json.MarshalIndent(explanations, "", "  ")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+			fmt.Println(string(data))
+		} else {
+			printExplanations(explanations, options)
+		}
+
+		for _, explanation := range explanations {
+			if explanation.Error != "" {
+				exit(1)
+			}
+		}
+	}
+}
+
+// explainPaths walks the options' path as a scan would, without counting,
+// and explains what happens to each target, a path relative to the current
+// directory
+func explainPaths(ctx context.Context, targets []string, options *CommandOptions) ([]*Explanation, error) {
+	root, err := filepath.Abs(options.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Where each target is in the walk, keyed by its path as the walk sees it
+	explanations := make([]*Explanation, len(targets))
+	walkPaths := make(map[string]*Explanation)
+	for i, target := range targets {
+		explanation := &Explanation{Path: filepath.ToSlash(target)}
+		explanations[i] = explanation
+		abs, err := filepath.Abs(target)
+		if err != nil {
+			explanation.Error = err.Error()
+			continue
+		}
+		rel, err := filepath.Rel(root, abs)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			explanation.Error = fmt.Sprintf("not under the scanned directory %s", options.Path)
+			continue
+		}
+		info, err := os.Lstat(abs)
+		if err != nil {
+			explanation.Error = err.Error()
+			continue
+		}
+		explanation.Path = filepath.ToSlash(rel)
+		explanation.Directory = info.IsDir()
+		walkPaths[filepath.Join(options.Path, rel)] = explanation
+	}
+
+	// Watch the walk for the targets, the directories they're in, and the
+	// files that reach counting
+	var counted []string
+	reached := make(map[string]bool)
+	listing := *options
+	listing.OnSkip = func(skip *SkippedFile) {
+		for path, explanation := range walkPaths {
+			if explanation.Reason != "" {
+				continue
+			}
+			if path == skip.Path || (skip.Directory && isUnder(skip.Path, path)) {
+				explanation.Reason, explanation.Rule = skip.Reason, skip.Detail
+				if path != skip.Path {
+					explanation.Under = filepath.ToSlash(relativeTo(options.Path, skip.Path))
+				}
+			}
+		}
+	}
+	listing.collect = func(path string, info os.FileInfo) {
+		counted = append(counted, path)
+		reached[path] = true
+		for target, explanation := range walkPaths {
+			if explanation.Directory && isUnder(target, path) {
+				explanation.Files++
+			}
+		}
+	}
+	repo, err := ProcessRepository(ctx, options.Path, &listing)
+	if err != nil {
+		return nil, err
+	}
+
+	encs, err := newCodecs(options)
+	if err != nil {
+		return nil, err
+	}
+	router, err := newModelRouter(options, encs)
+	if err != nil {
+		return nil, err
+	}
+	for path, explanation := range walkPaths {
+		for _, fileErr := range repo.Errors {
+			if fileErr.Path == path || isUnder(fileErr.Path, path) {
+				explanation.Error = fileErr.Err.Error()
+			}
+		}
+		if explanation.Reason == "gitignore" {
+			explanation.Rule = gitIgnoreRule(options.Path, path, explanation.Rule)
+		}
+		if explanation.Reason != "" || explanation.Error != "" {
+			continue
+		}
+		if explanation.Directory {
+			explanation.Included = true
+			continue
+		}
+		switch {
+		case options.Archives && archiveKind(path) != "":
+			explanation.Included = true
+			explanation.Passed = []string{"an archive, counted by its entries with -archives"}
+			continue
+		case !reached[path]:
+			explanation.Error = "the scan didn't reach it"
+			continue
+		}
+
+		// The last filters need the file's count, and for -dedupe the files
+		// counted before it
+		fileInfo, err := router.countFile(options.Path, path, encs, options)
+		if err != nil {
+			explanation.Error = err.Error()
+			continue
+		}
+		explanation.Total = fileInfo.TokenCount
+		if options.MinTokens > 0 && fileInfo.TokenCount < options.MinTokens {
+			explanation.Reason = "min-tokens"
+			explanation.Rule = fmt.Sprintf("%d %s is below -min", fileInfo.TokenCount, options.unitName())
+			continue
+		}
+		if options.Dedupe {
+			if original := duplicateOf(fileInfo, counted); original != "" {
+				explanation.Reason = "duplicate"
+				explanation.Rule = "duplicate of " + relativeTo(options.Path, original)
+				continue
+			}
+		}
+		explanation.Included = true
+		explanation.Passed = passedFilters(options)
+	}
+	return explanations, nil
+}
+
+// isUnder reports whether path is inside the directory dir
+func isUnder(dir string, path string) bool {
+	if dir == "." {
+		return path != "." && !filepath.IsAbs(path) && path != ".." && !strings.HasPrefix(path, ".."+string(filepath.Separator))
+	}
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// gitIgnoreRule finds the ignore file and line of the gitignore rule that
+// excluded path, like .gitignore:12: *.log, relying on detail if it can't.
+// A path in a submodule is matched against the submodule's own rules.
+func gitIgnoreRule(rootPath string, path string, detail string) string {
+	ignoreRoot := rootPath
+	for dir := filepath.Dir(path); isUnder(rootPath, dir); dir = filepath.Dir(dir) {
+		if isSubmodule(dir) {
+			ignoreRoot = dir
+			break
+		}
+	}
+	ignorer, _ := loadGitIgnore(ignoreRoot)
+	if ignorer == nil {
+		return detail
+	}
+
+	// The rule may be of a directory the path is in
+	for match := path; match == path || isUnder(ignoreRoot, match); match = filepath.Dir(match) {
+		relPath, err := matchPath(ignoreRoot, match)
+		if err != nil {
+			break
+		}
+		if ignored, rule := ignorer.MatchesPathHow(relPath); ignored {
+			return ignoreRuleSource(ignoreRoot, rule, detail)
+		}
+	}
+	return detail
+}
+
+// ignoreRuleSource describes a rule loadGitIgnore compiled for rootPath by
+// the file and line it's from
+func ignoreRuleSource(rootPath string, rule *gitignore.IgnorePattern, detail string) string {
+	source, line := gitIgnoreSource(rootPath, rule.LineNo)
+	if source == "" {
+		return detail
+	}
+	if rel, err := filepath.Rel(rootPath, source); err == nil && !strings.HasPrefix(rel, "..") {
+		source = filepath.ToSlash(rel)
+	}
+	return fmt.Sprintf("%s:%d: %s", source, line, ruleLine(rule.Line))
+}
+
+// duplicateOf returns the first of the files counted before fileInfo with
+// the same contents, as -dedupe finds it, or "" if there's none
+func duplicateOf(fileInfo *FileTokenInfo, counted []string) string {
+	if fileInfo.Bytes == 0 {
+		return ""
+	}
+	for _, path := range counted {
+		if path == fileInfo.Path {
+			return ""
+		}
+		data, err := os.ReadFile(path)
+		if err == nil && contentHash(data) == fileInfo.Hash {
+			return path
+		}
+	}
+	return ""
+}
+
+// passedFilters lists the filters of the options an included file went
+// through, in the order the scan applies them
+func passedFilters(options *CommandOptions) []string {
+	var passed []string
+	if len(options.Prune) > 0 {
+		passed = append(passed, "-prune")
+	}
+	if options.MaxDepth > 0 {
+		passed = append(passed, "-max-depth")
+	}
+	if options.IgnoreHidden {
+		passed = append(passed, "hidden files")
+	}
+	if options.RespectGitignore {
+		passed = append(passed, "gitignore rules")
+	}
+	passed = append(passed, tokenIgnoreFile+" files")
+	if len(options.SkipAttributes) > 0 {
+		passed = append(passed, "-skip-attributes")
+	}
+	if options.includer != nil {
+		passed = append(passed, "-include")
+	}
+	passed = append(passed, "file type")
+	if options.MaxFileBytes > 0 {
+		passed = append(passed, "-max-file-bytes")
+	}
+	passed = append(passed, "binary content")
+	if options.ExcludeGenerated {
+		passed = append(passed, "-exclude-generated")
+	}
+	if options.MinTokens > 0 {
+		passed = append(passed, "-min")
+	}
+	if options.Dedupe {
+		passed = append(passed, "-dedupe")
+	}
+	return passed
+}
+
+// printExplanations prints whether each path is included and the rule that
+// decided it
+func printExplanations(explanations []*Explanation, options *CommandOptions) {
+	for _, explanation := range explanations {
+		name := explanation.Path
+		if explanation.Directory && name != "." {
+			name += "/"
+		}
+		switch {
+		case explanation.Error != "":
+			fmt.Printf("%s: %s\n", name, options.paint(ansiRed, "error: "+explanation.Error))
+		case !explanation.Included:
+			how := "excluded [" + explanation.Reason + "]"
+			if explanation.Rule != "" {
+				how += " " + explanation.Rule
+			}
+			if explanation.Under != "" {
+				how += ", with the directory " + explanation.Under + "/"
+			}
+			if explanation.Total > 0 {
+				how += fmt.Sprintf(", %s %s", formatCount(explanation.Total), options.unitName())
+			}
+			fmt.Printf("%s: %s\n", name, options.paint(ansiRed, how))
+		case explanation.Directory:
+			fmt.Printf("%s: %s\n", name, options.paint(ansiBold, fmt.Sprintf("walked, %s files under it are counted", formatCount(explanation.Files))))
+		default:
+			fmt.Printf("%s: %s\n", name, options.paint(ansiBold, fmt.Sprintf("included, %s %s", formatCount(explanation.Total), options.unitName())))
+			if len(explanation.Passed) > 0 {
+				fmt.Printf("  passed: %s\n", strings.Join(explanation.Passed, ", "))
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExplainPaths(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		".gitignore":    "# logs\n*.log\nvendor\n",
+		"a.txt":         "hello world",
+		"copy.txt":      "hello world",
+		"debug.log":     "x",
+		"vendor/lib.go": "x",
+		".hidden":       "x",
+		"img.png":       "\x89PNG\r\n",
+		"bin.dat":       "a\x00b",
+		"src/b.go":      "one two three",
+	})
+	tests := []struct {
+		name   string
+		args   []string
+		target string
+		want   Explanation
+	}{
+		{"included", nil, "a.txt", Explanation{Path: "a.txt", Included: true, Total: 2,
+			Passed: []string{"hidden files", "gitignore rules", ".tokenignore files", "file type", "binary content"}}},
+		{"gitignore", nil, "debug.log", Explanation{Path: "debug.log", Reason: "gitignore", Rule: ".gitignore:2: *.log"}},
+		{"ignored directory", nil, "vendor", Explanation{Path: "vendor", Directory: true, Reason: "gitignore", Rule: ".gitignore:3: vendor"}},
+		{"in an ignored directory", nil, "vendor/lib.go", Explanation{Path: "vendor/lib.go", Reason: "gitignore", Rule: ".gitignore:3: vendor", Under: "vendor"}},
+		{"hidden", nil, ".hidden", Explanation{Path: ".hidden", Reason: "hidden"}},
+		{"extension", nil, "img.png", Explanation{Path: "img.png", Reason: "extension", Rule: "unsupported file type"}},
+		{"binary", nil, "bin.dat", Explanation{Path: "bin.dat", Reason: "binary", Rule: "binary content"}},
+		{"directory", nil, "src", Explanation{Path: "src", Directory: true, Included: true, Files: 1}},
+		{"below -min", []string{"-min", "3"}, "a.txt", Explanation{Path: "a.txt", Reason: "min-tokens", Rule: "2 tokens is below -min", Total: 2}},
+		{"duplicate", []string{"-dedupe"}, "copy.txt", Explanation{Path: "copy.txt", Reason: "duplicate", Rule: "duplicate of a.txt", Total: 2}},
+		{"missing", nil, "missing.txt", Explanation{Path: filepath.ToSlash(filepath.Join(dir, "missing.txt")), Error: "lstat " + filepath.Join(dir, "missing.txt") + ": no such file or directory"}},
+		{"outside", nil, "..", Explanation{Path: filepath.ToSlash(filepath.Dir(dir)), Error: "not under the scanned directory " + dir}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := testOptions(t, append(tt.args, "-model", "cl100k_base")...)
+			options.Path = dir
+			explanations, err := explainPaths(context.Background(), []string{filepath.Clean(filepath.Join(dir, tt.target))}, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := *explanations[0]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("explanation %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExplainCommand(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{".gitignore": "*.log\n", "a.txt": "hello world", "debug.log": "x"})
+	run := func(args ...string) string {
+		return captureStdout(t, func() {
+			findCommand("explain").run(append([]string{"-model", "cl100k_base", "-path", dir}, args...))
+		})
+	}
+	want := "a.txt: included, 2 tokens\n  passed: hidden files, gitignore rules, .tokenignore files, file type, binary content\n" +
+		"debug.log: excluded [gitignore] .gitignore:1: *.log\n" + ".: walked, 1 files under it are counted\n"
+	if out := run(filepath.Join(dir, "a.txt"), filepath.Join(dir, "debug.log"), dir); out != want {
+		t.Errorf("explain printed\n%s\nwant\n%s", out, want)
+	}
+	if out := run("-format", "json", filepath.Join(dir, "debug.log")); !strings.Contains(out, `"reason": "gitignore"`) {
+		t.Errorf("explain -format json printed\n%s", out)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"format", []string{"-format", "xml", dir}, `Error: unknown format "xml" (expected text or json)`},
+		{"no paths", nil, "Error: explain needs the path of at least one file or directory to explain"},
+		{"file root", []string{"-path", filepath.Join(dir, "a.txt"), "a.txt"}, "Error: -path must be the directory a scan would walk, not a file"},
+		// The error is printed with the other explanations, on stdout
+		{"error", []string{"-path", dir, filepath.Join(dir, "missing.txt")}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderr, code := exitStatus(t, func() { captureStdout(t, func() { findCommand("explain").run(tt.args) }) })
+			if code != 1 || !strings.Contains(stderr, tt.want) {
+				t.Errorf("exit %d, stderr:\n%s\nwant %q", code, stderr, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+)
+
+// bundleEntry is a file considered for an export bundle
+type bundleEntry struct {
+	Path     string // Path relative to the scan root, used in the header
+	File     *FileTokenInfo
+	Priority int // Index of the first -priority pattern matching the file
+}
+
+// ExportOptions stores the options of the export subcommand
+type ExportOptions struct {
+	Budget    int
+	Reserve   int // Of the budget, left for the rest of the prompt
+	Order     string
+	Priority  []string
+	Output    string
+	Clipboard bool
+}
+
+// exportCommand defines the export subcommand, which concatenates the files a
+// scan selects into a single bundle with path headers, within a token budget
+func exportCommand(fs *flag.FlagSet) func() {
+	options := &CommandOptions{}
+	exportOptions := &ExportOptions{}
+
+	registerFlags(fs, options)
+	registerWalkFlags(fs, options)
+	registerRevFlag(fs, options)
+	fs.IntVar(&exportOptions.Budget, "budget", 0, "Maximum number of tokens in the bundle (0 for no limit)")
+	fs.IntVar(&exportOptions.Reserve, "reserve", 0, "Tokens of the -budget to leave for the system prompt, tool schemas and expected output")
+	fs.StringVar(&exportOptions.Order, "order", "greedy", "How files are picked: greedy (smallest first, fitting as many files as possible) or priority (files matching -priority first, then by path)")
+	fs.Func("priority", "Comma-separated gitignore-style patterns of files to include first with -order priority", func(value string) error {
+		exportOptions.Priority = splitList(value)
+		return nil
+	})
+	fs.StringVar(&exportOptions.Output, "o", "", "File to write the bundle to (defaults to stdout)")
+	fs.BoolVar(&exportOptions.Clipboard, "clipboard", false, "Copy the bundle to the system clipboard instead of printing it")
+	return func() {
+		if exportOptions.Order != "greedy" && exportOptions.Order != "priority" {
+			fmt.Fprintf(os.Stderr, "Error: unknown -order %q (expected greedy or priority)\n", exportOptions.Order)
+			exit(1)
+		}
+		if exportOptions.Reserve < 0 || exportOptions.Reserve > 0 && exportOptions.Reserve >= exportOptions.Budget {
+			fmt.Fprintln(os.Stderr, "Error: -reserve needs a larger -budget to leave part of")
+			exit(1)
+		}
+
+		if err := resolveTarget(fs, options); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		var repo *RepoTokenInfo
+		var err error
+		ctx, cancel := commandContext(options)
+		defer cancel()
+		if options.IsSingleFile {
+			repo, err = ProcessSingleFile(ctx, options.Path, options)
+		} else {
+			repo, err = ProcessRepository(ctx, options.Path, options)
+		}
+		if interrupted(err) {
+			err = interruptedError(err, options)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error processing %s: %v\n", options.Path, err)
+			exit(1)
+		}
+
+		if options.Strict && len(repo.Errors) > 0 {
+			PrintErrors(repo)
+			exit(1)
+		}
+
+		bundle, included, skipped, tokens, err := buildBundle(repo, options, exportOptions)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error building bundle: %v\n", err)
+			exit(1)
+		}
+
+		switch {
+		case exportOptions.Clipboard:
+			err = copyToClipboard(bundle)
+		case exportOptions.Output != "":
+			err = ioutil.WriteFile(exportOptions.Output, []byte(bundle), 0644)
+		default:
+			_, err = fmt.Print(bundle)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing bundle: %v\n", err)
+			exit(1)
+		}
+
+		// Keep stdout clean for the bundle itself
+		fmt.Fprintf(os.Stderr, "Exported %d files (%d %s)", included, tokens, options.unitName())
+		if exportOptions.Budget > 0 {
+			fmt.Fprintf(os.Stderr, " of a %d %s budget", exportOptions.Budget, strings.TrimSuffix(options.unitName(), "s"))
+			if exportOptions.Reserve > 0 {
+				fmt.Fprintf(os.Stderr, " with %d reserved, %d of the usable budget remaining", exportOptions.Reserve, exportOptions.Budget-exportOptions.Reserve-tokens)
+			}
+		}
+		fmt.Fprintln(os.Stderr)
+		if skipped > 0 {
+			fmt.Fprintf(os.Stderr, "Skipped %d files that did not fit in the budget\n", skipped)
+		}
+
+		PrintErrors(repo)
+		if options.Strict && len(repo.Errors) > 0 {
+			exit(1)
+		}
+	}
+}
+
+// buildBundle orders the scanned files and concatenates as many as fit in the
+// budget. Each file's cost includes its path header, counted with the same
+// model as the scan.
+func buildBundle(repo *RepoTokenInfo, options *CommandOptions, exportOptions *ExportOptions) (bundle string, included int, skipped int, tokens int, err error) {
+	rootPath := repo.Path
+	if options.IsSingleFile {
+		rootPath = filepath.Dir(repo.Path)
+	}
+
+	var patterns []*gitignore.GitIgnore
+	for _, pattern := range exportOptions.Priority {
+		patterns = append(patterns, gitignore.CompileIgnoreLines(pattern))
+	}
+
+	var entries []*bundleEntry
+	for _, fileInfo := range repo.countedFiles(options) {
+		relativePath, relErr := filepath.Rel(rootPath, fileInfo.Path)
+		if relErr != nil {
+			relativePath = fileInfo.Path
+		}
+		entry := &bundleEntry{Path: filepath.ToSlash(relativePath), File: fileInfo, Priority: len(patterns)}
+		for i, pattern := range patterns {
+			if pattern.MatchesPath(entry.Path) {
+				entry.Priority = i
+				break
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if exportOptions.Order == "greedy" && a.File.TokenCount != b.File.TokenCount {
+			return a.File.TokenCount < b.File.TokenCount
+		}
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		return a.Path < b.Path
+	})
+
+	encs, err := newCodecs(options)
+	if err != nil {
+		return "", 0, 0, 0, err
+	}
+	enc := encs[0]
+
+	var sb strings.Builder
+	for _, entry := range entries {
+		data, readErr := ioutil.ReadFile(entry.File.Path)
+		if readErr != nil {
+			repo.Errors = append(repo.Errors, &FileError{entry.File.Path, readErr})
+			skipped++
+			continue
+		}
+		// Bundle the same text that was counted: decoded to UTF-8, in its -view
+		text, _ := decodeText(data)
+		if viewedText, viewed, viewErr := applyView(entry.File.Path, text, options.View); viewErr == nil && viewed {
+			text = viewedText
+		}
+
+		header, countErr := countUnits(bundleHeader(entry.Path), enc, options.CountMode)
+		if countErr != nil {
+			return "", 0, 0, 0, countErr
+		}
+		cost := header + entry.File.TokenCount + 1 // plus the blank separator line
+		if exportOptions.Budget > 0 && tokens+cost > exportOptions.Budget-exportOptions.Reserve {
+			skipped++
+			continue
+		}
+
+		sb.WriteString(bundleHeader(entry.Path))
+		sb.WriteString(text)
+		if len(text) > 0 && text[len(text)-1] != '\n' {
+			sb.WriteString("\n")
+		}
+		sb.WriteString("\n")
+		tokens += cost
+		included++
+	}
+
+	// Report the exact size of the bundle, since tokens can merge across the
+	// boundaries between files and the estimate above over-counts slightly
+	final, err := countUnits(sb.String(), enc, options.CountMode)
+	if err != nil {
+		return "", 0, 0, 0, err
+	}
+
+	return sb.String(), included, skipped, final, nil
+}
+
+// bundleHeader returns the line that introduces a file in an export bundle
+func bundleHeader(path string) string {
+	return fmt.Sprintf("==> %s <==\n", path)
+}
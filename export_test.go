@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildBundle(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"utf-8", "héllo world\n", "==> a.txt <==\nhéllo world\n\n"},
+		{"utf-16le with a byte order mark", "\xff\xfeh\x00\xe9\x00l\x00l\x00o\x00\n\x00", "==> a.txt <==\nhéllo\n\n"},
+		{"utf-16be without a byte order mark", "\x00h\x00e\x00l\x00l\x00o\x00\n", "==> a.txt <==\nhello\n\n"},
+		{"latin-1", "h\xe9llo", "==> a.txt <==\nhéllo\n\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, map[string]string{"a.txt": tt.data})
+			repo, options := scanTree(t, dir, "-model", "cl100k_base")
+			bundle, included, skipped, _, err := buildBundle(repo, options, &ExportOptions{Order: "greedy"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bundle != tt.want || included != 1 || skipped != 0 {
+				t.Errorf("buildBundle = %q, %d included, %d skipped, want %q, 1 included", bundle, included, skipped, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildBundleSkips(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"small.txt": "hi", "large.txt": strings.Repeat("word ", 200), "gone.txt": "bye"})
+	repo, options := scanTree(t, dir, "-model", "cl100k_base")
+	if err := os.Remove(filepath.Join(dir, "gone.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	bundle, included, skipped, _, err := buildBundle(repo, options, &ExportOptions{Budget: 50, Order: "greedy"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bundle != "==> small.txt <==\nhi\n\n" || included != 1 || skipped != 2 {
+		t.Errorf("buildBundle = %q, %d included, %d skipped, want only small.txt, 2 skipped", bundle, included, skipped)
+	}
+	if len(repo.Errors) != 1 || filepath.Base(repo.Errors[0].Path) != "gone.txt" {
+		t.Errorf("Errors = %v, want the read error of gone.txt", repo.Errors)
+	}
+}
+
+func TestBuildBundleReserve(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hi", "b.txt": "hello there"})
+	repo, options := scanTree(t, dir, "-model", "cl100k_base")
+	tests := []struct {
+		name     string
+		reserve  int
+		included []int // Files included, and skipped
+	}{
+		{"no reserve", 0, []int{2, 0}},
+		{"reserve", 10, []int{1, 1}},
+		{"reserve of nearly everything", 18, []int{0, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, included, skipped, tokens, err := buildBundle(repo, options, &ExportOptions{Budget: 20, Reserve: tt.reserve, Order: "greedy"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if included != tt.included[0] || skipped != tt.included[1] || tokens > 20-tt.reserve {
+				t.Errorf("buildBundle included %d and skipped %d in %d tokens, want %v", included, skipped, tokens, tt.included)
+			}
+		})
+	}
+}
+
+func TestExportReserve(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hi"})
+	stderr := captureStderr(t, func() {
+		captureStdout(t, func() {
+			findCommand("export").run([]string{"-model", "cl100k_base", "-budget", "30", "-reserve", "10", dir})
+		})
+	})
+	if !strings.Contains(stderr, " of a 30 token budget with 10 reserved, ") {
+		t.Errorf("export doesn't report the reserve:\n%s", stderr)
+	}
+
+	for _, args := range [][]string{{"-reserve", "10"}, {"-budget", "10", "-reserve", "10"}, {"-budget", "10", "-reserve", "-1"}} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			stderr, code := exitStatus(t, func() { findCommand("export").run(append(args, dir)) })
+			if code != 1 || !strings.Contains(stderr, "Error: -reserve needs a larger -budget to leave part of") {
+				t.Errorf("exit %d, stderr:\n%s", code, stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// defaultSkipExts are the extensions of binary and non-text files, which are
+// skipped without being read unless -text-ext lists them
+var defaultSkipExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true,
+	".pdf": true, ".zip": true, ".tar": true, ".gz": true,
+	".exe": true, ".dll": true, ".so": true, ".dylib": true,
+	".bin": true, ".obj": true, ".o": true,
+}
+
+// ExtensionConfig lists extensions in the config file on top of -skip-ext
+// and -text-ext, like text: [.obj] for Wavefront models
+type ExtensionConfig struct {
+	Skip []string `yaml:"skip"` // Extensions of files to skip without reading them
+	Text []string `yaml:"text"` // Extensions of files to count as text, whatever their content
+}
+
+// normalizeExt returns an extension as filepath.Ext returns it, lowercased,
+// so csv, .CSV and .csv are the same
+func normalizeExt(ext string) string {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return ext
+}
+
+// parseExtList parses a comma-separated list of extensions
+func parseExtList(value string) []string {
+	var exts []string
+	for _, ext := range splitList(value) {
+		exts = append(exts, normalizeExt(ext))
+	}
+	return exts
+}
+
+// loadExtensions adds the extensions of the config file to -skip-ext and
+// -text-ext, and checks that no extension is in both
+func loadExtensions(options *CommandOptions) error {
+	root := options.Path
+	if info, err := os.Stat(root); err == nil && !info.IsDir() {
+		root = filepath.Dir(root)
+	}
+	config, err := loadConfig(root, options.ConfigFile)
+	if err != nil {
+		return err
+	}
+	for _, ext := range config.Extensions.Skip {
+		options.SkipExts = append(options.SkipExts, normalizeExt(ext))
+	}
+	for _, ext := range config.Extensions.Text {
+		options.TextExts = append(options.TextExts, normalizeExt(ext))
+	}
+	for _, ext := range options.SkipExts {
+		if slices.Contains(options.TextExts, ext) {
+			return fmt.Errorf("%s can't be both skipped and counted as text", ext)
+		}
+	}
+	return nil
+}
+
+// skipsExtension reports whether files with ext, as filepath.Ext returns it
+// lowercased, are skipped without being read: those of defaultSkipExts and
+// -skip-ext, except the ones of -text-ext. Files it lets through are still
+// sniffed for binary content.
+func (o *CommandOptions) skipsExtension(ext string) bool {
+	if slices.Contains(o.TextExts, ext) {
+		return false
+	}
+	return defaultSkipExts[ext] || slices.Contains(o.SkipExts, ext)
+}
+
+// countsAsText reports whether -text-ext has the files with ext counted as
+// text, even if sniffing their content would call them binary
+func (o *CommandOptions) countsAsText(ext string) bool {
+	return slices.Contains(o.TextExts, ext)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseExtList(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{".csv", []string{".csv"}},
+		{"csv, .SVG ,Obj", []string{".csv", ".svg", ".obj"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := parseExtList(tt.value); !slices.Equal(got, tt.want) {
+			t.Errorf("parseExtList(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestLoadExtensions(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"ok.yaml":       "extensions:\n  skip: [svg]\n  text: [.OBJ]\n",
+		"conflict.yaml": "extensions:\n  skip: [.csv]\n",
+		"broken.yaml":   "extensions: [",
+	})
+	tests := []struct {
+		name    string
+		config  string
+		args    []string
+		skip    []string
+		text    []string
+		wantErr string
+	}{
+		{"config and flags", filepath.Join(dir, "ok.yaml"), []string{"-skip-ext", "csv"}, []string{".csv", ".svg"}, []string{".obj"}, ""},
+		{"both", filepath.Join(dir, "conflict.yaml"), []string{"-text-ext", "csv"}, nil, nil, ".csv can't be both skipped and counted as text"},
+		{"broken config", filepath.Join(dir, "broken.yaml"), nil, nil, nil, "yaml"},
+		{"missing config", filepath.Join(dir, "missing.yaml"), nil, nil, nil, "no such file or directory"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := testOptions(t, append([]string{"-path", dir, "-config", tt.config}, tt.args...)...)
+			err := loadExtensions(options)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("loadExtensions error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(options.SkipExts, tt.skip) || !slices.Equal(options.TextExts, tt.text) {
+				t.Errorf("skipping %v and counting %v as text, want %v and %v", options.SkipExts, options.TextExts, tt.skip, tt.text)
+			}
+		})
+	}
+}
+
+func TestExtensionFlags(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"a.txt":     "hello world",
+		"data.csv":  "one,two",
+		"model.obj": "v 0 0 0",
+		"blob.dat":  "four\x00",
+	})
+	tests := []struct {
+		name    string
+		args    []string
+		counted []string
+	}{
+		{"defaults", nil, []string{"a.txt", "data.csv"}},
+		{"-skip-ext", []string{"-skip-ext", "csv"}, []string{"a.txt"}},
+		{"-text-ext", []string{"-text-ext", ".obj,.dat"}, []string{"a.txt", "blob.dat", "data.csv", "model.obj"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, _ := scanTree(t, dir, append([]string{"-model", "cl100k_base"}, tt.args...)...)
+			if got := countedPaths(dir, repo); !slices.Equal(got, tt.counted) {
+				t.Errorf("counted %v, want %v", got, tt.counted)
+			}
+		})
+	}
+}
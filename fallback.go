@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/tiktoken-go/tokenizer"
+
+	"token-counter/tokenizers"
+)
+
+// modelFallbacks are the encodings -model-fallback tries, in order, when
+// -model isn't available: the newest first, then the one most models used
+// before it
+var modelFallbacks = []string{string(tokenizer.O200kBase), string(tokenizer.Cl100kBase)}
+
+// ModelFallback records that -model-fallback counted with another encoding
+// than -model, so the counts are approximate
+type ModelFallback struct {
+	Requested string `json:"requested"` // The -model that wasn't available
+	Reason    string `json:"reason"`    // Why, like unknown model "gpt-5"
+}
+
+// fallbackCodec loads the first encoding of modelFallbacks that's available
+// in place of -model, which failed to load with loadErr, and makes it the
+// model of the options, so reports name the encoding that counted. Loading
+// fails only if none of them is available either.
+func fallbackCodec(options *CommandOptions, loadErr error) (tokenizers.Tokenizer, error) {
+	for _, name := range modelFallbacks {
+		if name == options.Model {
+			continue
+		}
+		codec, err := codecForName(name)
+		if err != nil {
+			logger.Debug("fallback encoding not available", "model", name, "err", err)
+			continue
+		}
+		logger.Warn("model not available, counting with a fallback encoding; counts are approximate", "model", options.Model, "fallback", name, "err", loadErr)
+		options.fallback = &ModelFallback{Requested: options.Model, Reason: loadErr.Error()}
+		options.Model = name
+		return codec, nil
+	}
+	return nil, fmt.Errorf("%v, and no -model-fallback encoding is available", loadErr)
+}
+
+// fallbackSummary describes the approximate counts of a -model-fallback,
+// like "gpt-5 isn't available (unknown model "gpt-5"), counted with
+// o200k_base instead"
+func fallbackSummary(options *CommandOptions) string {
+	return fmt.Sprintf("%s isn't available (%s), counted with %s instead", options.fallback.Requested, options.fallback.Reason, options.Model)
+}
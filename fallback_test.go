@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNewCodecFallback(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		model     string
+		requested string
+		wantErr   string
+	}{
+		{"available", []string{"-model", "cl100k_base", "-model-fallback"}, "cl100k_base", "", ""},
+		{"fallback", []string{"-model", "gpt-99", "-model-fallback"}, "o200k_base", "gpt-99", ""},
+		{"no fallback", []string{"-model", "gpt-99"}, "gpt-99", "", "gpt-99"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := testOptions(t, tt.args...)
+			codec, err := newCodec(options)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("newCodec error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if codec.Name() != tt.model || options.Model != tt.model {
+				t.Errorf("counting with %s as %s, want %s", codec.Name(), options.Model, tt.model)
+			}
+			if tt.requested == "" {
+				if options.fallback != nil {
+					t.Errorf("fallback %+v without one", options.fallback)
+				}
+				return
+			}
+			if options.fallback == nil || options.fallback.Requested != tt.requested || options.fallback.Reason == "" {
+				t.Fatalf("fallback %+v, want one from %s", options.fallback, tt.requested)
+			}
+			if want := "gpt-99 isn't available (" + options.fallback.Reason + "), counted with o200k_base instead"; fallbackSummary(options) != want {
+				t.Errorf("fallbackSummary = %q, want %q", fallbackSummary(options), want)
+			}
+		})
+	}
+}
+
+func TestFallbackCodec(t *testing.T) {
+	loadErr := errors.New(`unknown model "gpt-99"`)
+	defer func(fallbacks []string) { modelFallbacks = fallbacks }(modelFallbacks)
+	tests := []struct {
+		name      string
+		model     string
+		fallbacks []string
+		want      string
+		wantErr   string
+	}{
+		{"first", "gpt-99", []string{"o200k_base", "cl100k_base"}, "o200k_base", ""},
+		{"first not available", "gpt-99", []string{"o300k_base", "cl100k_base"}, "cl100k_base", ""},
+		{"not itself", "o200k_base", []string{"o200k_base", "cl100k_base"}, "cl100k_base", ""},
+		{"none available", "gpt-99", []string{"o300k_base"}, "", `unknown model "gpt-99", and no -model-fallback encoding is available`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modelFallbacks = tt.fallbacks
+			options := &CommandOptions{Model: tt.model}
+			codec, err := fallbackCodec(options, loadErr)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr || options.fallback != nil {
+					t.Errorf("fallbackCodec error %v with fallback %+v, want %q", err, options.fallback, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || codec.Name() != tt.want || options.Model != tt.want || options.fallback.Requested != tt.model {
+				t.Errorf("fallbackCodec = %v, %v with fallback %+v, want %s", codec, err, options.fallback, tt.want)
+			}
+		})
+	}
+}
+
+func TestModelFallbackScan(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world"})
+	out := captureStdout(t, func() {
+		findCommand("scan").run([]string{"-model", "gpt-99", "-model-fallback", "-format", "json", dir})
+	})
+	if !strings.Contains(out, `"model": "o200k_base"`) || !strings.Contains(out, `"fallback": {
+      "requested": "gpt-99",`) {
+		t.Errorf("scan -model-fallback printed\n%s", out)
+	}
+}
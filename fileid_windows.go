@@ -0,0 +1,19 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// fileKey identifies a file or directory by its fully resolved path, since
+// os.FileInfo does not expose a file index on Windows
+func fileKey(path string, info os.FileInfo) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		if abs, err := filepath.Abs(resolved); err == nil {
+			return abs
+		}
+	}
+	return path
+}
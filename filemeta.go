@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// addFileMetadata records the modification time of every counted file and,
+// for the files git tracks, the author and date of the last commit that
+// changed them, for -with-metadata. Files outside a git repository, and
+// untracked ones, only get their modification time.
+func addFileMetadata(repo *RepoTokenInfo, options *CommandOptions) {
+	dir := repo.Path
+	if options.IsSingleFile {
+		dir = filepath.Dir(repo.Path)
+	}
+
+	byPath := make(map[string]*FileTokenInfo)
+	for _, dirInfo := range repo.Dirs {
+		for _, fileInfo := range dirInfo.Files {
+			if info, err := os.Stat(fileInfo.Path); err == nil {
+				fileInfo.ModTime = info.ModTime().UTC().Truncate(time.Second)
+			}
+			byPath[relativeTo(dir, fileInfo.Path)] = fileInfo
+		}
+	}
+	if err := lastCommits(dir, byPath); err != nil {
+		logger.Debug("no git history for -with-metadata", "path", dir, "error", err)
+	}
+}
+
+// lastCommits fills in the last author and commit date of the files in
+// byPath, keyed by slash path relative to dir, from a single git log of
+// dir, newest first. It stops reading once every file has been found.
+func lastCommits(dir string, byPath map[string]*FileTokenInfo) error {
+	// git log lists paths relative to the top of the repository
+	prefix, err := git(dir, "rev-parse", "--show-prefix")
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("git", "-c", "core.quotePath=false", "log", "--no-renames", "--name-only", "--format=%x00%an%x00%aI", "--", ".")
+	cmd.Dir = dir
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	remaining := len(byPath)
+	var author string
+	var date time.Time
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for remaining > 0 && scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "\x00") {
+			fields := strings.SplitN(line[1:], "\x00", 2)
+			author = fields[0]
+			if len(fields) == 2 {
+				date, _ = time.Parse(time.RFC3339, fields[1])
+			}
+			continue
+		}
+		if line == "" || !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		fileInfo := byPath[line[len(prefix):]]
+		if fileInfo == nil || fileInfo.LastAuthor != "" {
+			continue
+		}
+		fileInfo.LastAuthor, fileInfo.LastCommitTime = author, date
+		remaining--
+	}
+	if remaining > 0 {
+		err = scanner.Err()
+		if waitErr := cmd.Wait(); err == nil {
+			err = waitErr
+		}
+		return err
+	}
+	cmd.Process.Kill()
+	cmd.Wait()
+	return nil
+}
+
+// metadataSuffix describes the -with-metadata fields of a file for the text
+// report, e.g. ", modified 2024-05-02, last commit by Ada on 2024-04-30"
+func metadataSuffix(options *CommandOptions, fileInfo *FileTokenInfo) string {
+	if !options.WithMetadata {
+		return ""
+	}
+	var suffix string
+	if !fileInfo.ModTime.IsZero() {
+		suffix += ", modified " + fileInfo.ModTime.Format("2006-01-02")
+	}
+	if fileInfo.LastAuthor != "" {
+		suffix += ", last commit by " + fileInfo.LastAuthor + " on " + fileInfo.LastCommitTime.Format("2006-01-02")
+	}
+	return suffix
+}
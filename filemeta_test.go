@@ -0,0 +1,106 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAddFileMetadata(t *testing.T) {
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q")
+	writeTree(t, dir, map[string]string{"a.txt": "one", "sub/b.txt": "two"})
+	commitAt(t, dir, "2024-01-01T12:00:00Z", "first")
+	writeTree(t, dir, map[string]string{"sub/b.txt": "changed"})
+	commitAt(t, dir, "2024-03-05T12:00:00Z", "second")
+	writeTree(t, dir, map[string]string{"untracked.txt": "three"})
+
+	tests := []struct {
+		name   string
+		root   string
+		single bool
+		want   map[string]string // Last commit date of each file, "" for none
+	}{
+		{"repository", dir, false, map[string]string{"a.txt": "2024-01-01", "sub/b.txt": "2024-03-05", "untracked.txt": ""}},
+		{"subdirectory", filepath.Join(dir, "sub"), false, map[string]string{"b.txt": "2024-03-05"}},
+		{"single file", filepath.Join(dir, "a.txt"), true, map[string]string{"a.txt": "2024-01-01"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := testOptions(t, "-model", "cl100k_base", "-with-metadata")
+			var repo *RepoTokenInfo
+			if tt.single {
+				options.IsSingleFile = true
+				var err error
+				if repo, err = ProcessSingleFile(t.Context(), tt.root, options); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				repo, _ = scanTree(t, tt.root, "-model", "cl100k_base", "-with-metadata")
+			}
+			addFileMetadata(repo, options)
+
+			base := tt.root
+			if tt.single {
+				base = filepath.Dir(tt.root)
+			}
+			got := make(map[string]string)
+			for _, dirInfo := range repo.Dirs {
+				for _, fileInfo := range dirInfo.Files {
+					if age := time.Since(fileInfo.ModTime); age < 0 || age > time.Minute {
+						t.Errorf("%s modified %v", fileInfo.Path, fileInfo.ModTime)
+					}
+					date := ""
+					if fileInfo.LastAuthor != "" {
+						if fileInfo.LastAuthor != "Test" {
+							t.Errorf("%s last changed by %q", fileInfo.Path, fileInfo.LastAuthor)
+						}
+						date = fileInfo.LastCommitTime.Format("2006-01-02")
+					}
+					got[relativeTo(base, fileInfo.Path)] = date
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("files %v, want %v", got, tt.want)
+			}
+			for path, date := range tt.want {
+				if got[path] != date {
+					t.Errorf("%s last committed %q, want %q", path, got[path], date)
+				}
+			}
+		})
+	}
+
+	// Outside a repository, files only get their modification time
+	outside := t.TempDir()
+	writeTree(t, outside, map[string]string{"a.txt": "one"})
+	repo, options := scanTree(t, outside, "-model", "cl100k_base", "-with-metadata")
+	addFileMetadata(repo, options)
+	fileInfo := repo.Dirs[outside].Files[0]
+	if fileInfo.ModTime.IsZero() || fileInfo.LastAuthor != "" {
+		t.Errorf("file outside a repository: modified %v, author %q", fileInfo.ModTime, fileInfo.LastAuthor)
+	}
+}
+
+func TestMetadataSuffix(t *testing.T) {
+	fileInfo := &FileTokenInfo{
+		ModTime:        time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC),
+		LastAuthor:     "Ada",
+		LastCommitTime: time.Date(2024, 4, 30, 10, 0, 0, 0, time.UTC),
+	}
+	tests := []struct {
+		name     string
+		options  *CommandOptions
+		fileInfo *FileTokenInfo
+		want     string
+	}{
+		{"without -with-metadata", &CommandOptions{}, fileInfo, ""},
+		{"tracked", &CommandOptions{WithMetadata: true}, fileInfo, ", modified 2024-05-02, last commit by Ada on 2024-04-30"},
+		{"untracked", &CommandOptions{WithMetadata: true}, &FileTokenInfo{ModTime: fileInfo.ModTime}, ", modified 2024-05-02"},
+	}
+	for _, tt := range tests {
+		if got := metadataSuffix(tt.options, tt.fileInfo); got != tt.want {
+			t.Errorf("%s: %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
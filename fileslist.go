@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// readFileList reads the paths for -files-from from a file, or from stdin
+// if name is "-". Paths are NUL-delimited if the list contains a NUL, as
+// printed by git ls-files -z or find -print0, and one per line otherwise.
+// Empty entries are ignored, and so are repeated paths.
+func readFileList(name string) ([]string, error) {
+	var data []byte
+	var err error
+	if name == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []string
+	if bytes.IndexByte(data, 0) >= 0 {
+		entries = strings.Split(string(data), "\x00")
+	} else {
+		entries = strings.Split(string(data), "\n")
+		for i, entry := range entries {
+			entries[i] = strings.TrimSuffix(entry, "\r")
+		}
+	}
+
+	seen := make(map[string]bool)
+	var paths []string
+	for _, entry := range entries {
+		if entry == "" || seen[entry] {
+			continue
+		}
+		seen[entry] = true
+		paths = append(paths, entry)
+	}
+	return paths, nil
+}
+
+// ProcessFileList counts exactly the listed files, without walking rootPath
+// or applying its ignore rules. Relative paths are relative to rootPath, and
+// the report is laid out as if rootPath had been scanned. Binary and
+// unsupported files are still skipped, and paths that don't exist or are
+// directories are reported as errors.
+func ProcessFileList(ctx context.Context, rootPath string, paths []string, options *CommandOptions) (*RepoTokenInfo, error) {
+	repo := &RepoTokenInfo{
+		Path: rootPath,
+		Dirs: make(map[string]*DirTokenInfo),
+	}
+
+	encs, err := newCodecs(options)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(contentHashes)
+	batch := &fileBatch{
+		size: 1,
+		count: func(path string) (*FileTokenInfo, error) {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			return countFile(path, encs, options)
+		},
+		done: func(path string, fileInfo *FileTokenInfo, err error) error {
+			if err != nil && err == ctx.Err() {
+				return err
+			}
+			if err != nil {
+				repo.Errors = append(repo.Errors, &FileError{path, err})
+				return nil
+			}
+			if options.MinTokens > 0 && fileInfo.TokenCount < options.MinTokens {
+				logSkip(options, path, false, "min-tokens", fmt.Sprintf("%d %s is below -min", fileInfo.TokenCount, options.unitName()))
+				repo.addBelowMin(fileInfo, !options.FilterAffectsTotals)
+				return nil
+			}
+			if original := seen.checkFor(fileInfo, options); original != "" {
+				repo.Duplicates = append(repo.Duplicates, &DuplicateFile{fileInfo.Path, original, fileInfo.TokenCount})
+				if options.Dedupe {
+					logSkip(options, path, false, "duplicate", "duplicate of "+original)
+					return nil
+				}
+			}
+			logger.Debug("counted", "path", fileInfo.Path, options.unitName(), fileInfo.TokenCount)
+			repo.addFile(fileInfo)
+			if options.OnFile != nil {
+				if err := options.OnFile(fileInfo); err != nil {
+					return err
+				}
+			}
+			if options.DiscardFiles {
+				repo.discardFile(fileInfo)
+			}
+			return nil
+		},
+	}
+	if usesAPI(encs) {
+		batch.size = apiSettings.Concurrency
+	}
+
+	deadline := newScanDeadline(options)
+	for i, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return repo, err
+		}
+		if deadline.passed() {
+			repo.Partial, repo.Remaining = true, len(paths)-i
+			break
+		}
+		path = filepath.FromSlash(path)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(rootPath, path)
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			repo.Errors = append(repo.Errors, &FileError{path, err})
+			continue
+		}
+		if info.IsDir() {
+			repo.Errors = append(repo.Errors, &FileError{path, fmt.Errorf("is a directory; -files-from lists files")})
+			continue
+		}
+
+		ext := strings.ToLower(filepath.Ext(path))
+		if options.Images && imageExts[ext] {
+			img, err := measureImage(path)
+			if err != nil {
+				repo.Errors = append(repo.Errors, &FileError{path, err})
+				continue
+			}
+			repo.Images = append(repo.Images, img)
+			continue
+		}
+		if options.skipsExtension(ext) {
+			logSkip(options, path, false, "extension", "unsupported file type")
+			continue
+		}
+		if options.tooLarge(info) {
+			logSkip(options, path, false, "size", fmt.Sprintf("%d bytes is above -max-file-bytes", info.Size()))
+			continue
+		}
+		head, mimeType, binary, err := sniffHead(path)
+		if err != nil {
+			repo.Errors = append(repo.Errors, &FileError{path, err})
+			continue
+		}
+		if binary && !options.countsAsText(ext) {
+			logSkip(options, path, false, "binary", binaryReason(mimeType))
+			continue
+		}
+		if options.ExcludeGenerated {
+			if reason := generatedReason(path, head); reason != "" {
+				logSkip(options, path, false, "generated", reason)
+				continue
+			}
+		}
+
+		if err := batch.add(path); err != nil {
+			return repo, err
+		}
+	}
+	return repo, batch.flush()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadFileList(t *testing.T) {
+	tests := []struct {
+		name string
+		list string
+		want []string
+	}{
+		{"lines", "a.txt\nsub/b.txt\n", []string{"a.txt", "sub/b.txt"}},
+		{"CRLF", "a.txt\r\nsub/b.txt\r\n", []string{"a.txt", "sub/b.txt"}},
+		{"NUL-delimited", "a b.txt\x00new\nline.txt\x00", []string{"a b.txt", "new\nline.txt"}},
+		{"blank and repeated", "a.txt\n\na.txt\nb.txt\n", []string{"a.txt", "b.txt"}},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := filepath.Join(t.TempDir(), "list")
+			if err := os.WriteFile(list, []byte(tt.list), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readFileList(list)
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readFileList = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := readFileList(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("reading a missing list succeeded")
+	}
+}
+
+func TestProcessFileList(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		".gitignore":  "ignored.txt\n",
+		"a.txt":       "hello world",
+		"ignored.txt": "one two three",
+		"sub/b.txt":   "one",
+		"image.png":   "not an image",
+		"unlisted.md": "not counted",
+	})
+	paths := []string{"a.txt", "ignored.txt", filepath.Join(dir, "sub", "b.txt"), "image.png", "missing.txt", "sub"}
+
+	options := testOptions(t, "-model", "cl100k_base")
+	repo, err := ProcessFileList(context.Background(), dir, paths, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := countedPaths(dir, repo), []string{"a.txt", "ignored.txt", "sub/b.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("counted %v, want the listed files %v, ignore rules or not", got, want)
+	}
+	if repo.TokenCount != 6 {
+		t.Errorf("total %d, want 6", repo.TokenCount)
+	}
+
+	errs := make(map[string]string)
+	for _, fileErr := range repo.Errors {
+		rel, _ := filepath.Rel(dir, fileErr.Path)
+		errs[filepath.ToSlash(rel)] = fileErr.Err.Error()
+	}
+	if len(errs) != 2 || !strings.Contains(errs["sub"], "is a directory") || errs["missing.txt"] == "" {
+		t.Errorf("errors %v, want the missing file and the directory", errs)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ProcessFileList(ctx, dir, paths, options); err != context.Canceled {
+		t.Errorf("canceled list: %v", err)
+	}
+}
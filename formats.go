@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// resultNode converts a structured result to a YAML node tree through its
+// JSON form, so YAML and TOML use the same keys, order and omitted fields
+// as -format json
+func resultNode(result interface{}) (*yaml.Node, error) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	node := doc.Content[0]
+	clearStyle(node)
+	return node, nil
+}
+
+// clearStyle drops the flow style and quoting of JSON, so nodes are printed
+// in block style and strings are only quoted when they need to be
+func clearStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		clearStyle(child)
+	}
+}
+
+// WriteYAML writes the scan as a YAML ScanResult
+func WriteYAML(w io.Writer, repo *RepoTokenInfo, options *CommandOptions) error {
+	node, err := resultNode(newScanResult(repo, options))
+	if err != nil {
+		return err
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// WriteTOML writes the scan as a TOML ScanResult. Directories and their
+// files are arrays of tables, and null fields are left out, since TOML has
+// no null.
+func WriteTOML(w io.Writer, repo *RepoTokenInfo, options *CommandOptions) error {
+	node, err := resultNode(newScanResult(repo, options))
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(w)
+	writeTOMLTable(out, nil, node)
+	return out.Flush()
+}
+
+// tomlBareKey matches the keys TOML allows without quotes
+var tomlBareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// writeTOMLTable writes the key/value pairs of a mapping, followed by its
+// tables and arrays of tables, which TOML requires to come last
+func writeTOMLTable(w *bufio.Writer, path []string, node *yaml.Node) {
+	var tables, arrays []int
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		value := node.Content[i+1]
+		switch {
+		case value.Tag == "!!null":
+		case value.Kind == yaml.MappingNode:
+			tables = append(tables, i)
+		case isTableArray(value):
+			arrays = append(arrays, i)
+		default:
+			fmt.Fprintf(w, "%s = %s\n", tomlKey(node.Content[i].Value), tomlValue(value))
+		}
+	}
+	for _, i := range tables {
+		tablePath := append(append([]string(nil), path...), node.Content[i].Value)
+		fmt.Fprintf(w, "\n[%s]\n", tomlPath(tablePath))
+		writeTOMLTable(w, tablePath, node.Content[i+1])
+	}
+	for _, i := range arrays {
+		tablePath := append(append([]string(nil), path...), node.Content[i].Value)
+		for _, item := range node.Content[i+1].Content {
+			fmt.Fprintf(w, "\n[[%s]]\n", tomlPath(tablePath))
+			writeTOMLTable(w, tablePath, item)
+		}
+	}
+}
+
+// isTableArray reports whether a sequence is a non-empty list of mappings,
+// written as an array of tables
+func isTableArray(node *yaml.Node) bool {
+	if node.Kind != yaml.SequenceNode || len(node.Content) == 0 {
+		return false
+	}
+	for _, item := range node.Content {
+		if item.Kind != yaml.MappingNode {
+			return false
+		}
+	}
+	return true
+}
+
+// tomlValue formats a scalar, or an inline array or table
+func tomlValue(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		items := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Tag != "!!null" {
+				items = append(items, tomlValue(item))
+			}
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case yaml.MappingNode:
+		var pairs []string
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i+1].Tag != "!!null" {
+				pairs = append(pairs, tomlKey(node.Content[i].Value)+" = "+tomlValue(node.Content[i+1]))
+			}
+		}
+		return "{" + strings.Join(pairs, ", ") + "}"
+	}
+	switch node.Tag {
+	case "!!int", "!!float", "!!bool":
+		return node.Value
+	}
+	return tomlString(node.Value)
+}
+
+// tomlKey quotes a key unless it's a bare key
+func tomlKey(key string) string {
+	if tomlBareKey.MatchString(key) {
+		return key
+	}
+	return tomlString(key)
+}
+
+// tomlPath formats the dotted header of a table
+func tomlPath(path []string) string {
+	keys := make([]string, len(path))
+	for i, key := range path {
+		keys[i] = tomlKey(key)
+	}
+	return strings.Join(keys, ".")
+}
+
+// tomlString formats a basic string, escaping quotes, backslashes and
+// control characters
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
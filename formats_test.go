@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestWriteYAML(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world", "sub/b.txt": "one two three"})
+	repo, options := scanTree(t, dir, "-model", "cl100k_base")
+
+	var out bytes.Buffer
+	if err := WriteYAML(&out, repo, options); err != nil {
+		t.Fatal(err)
+	}
+	var fromYAML, fromJSON map[string]interface{}
+	if err := yaml.Unmarshal(out.Bytes(), &fromYAML); err != nil {
+		t.Fatalf("YAML doesn't parse: %v\n%s", err, out.String())
+	}
+	json.Unmarshal([]byte(mustJSON(t, newScanResult(repo, options))), &fromJSON)
+	// The timestamps of the two results differ
+	delete(fromYAML, "metadata")
+	delete(fromJSON, "metadata")
+	if got, want := mustJSON(t, fromYAML), mustJSON(t, fromJSON); got != want {
+		t.Errorf("YAML has\n%s\nwant the JSON result\n%s", got, want)
+	}
+	if strings.ContainsAny(out.String(), "{[") || strings.Contains(out.String(), `"sub"`) {
+		t.Errorf("YAML isn't in block style:\n%s", out.String())
+	}
+
+	if err := WriteYAML(failingWriter{}, repo, options); err == nil {
+		t.Error("WriteYAML to a failing writer succeeded")
+	}
+}
+
+// mustJSON marshals v, with sorted keys, for comparing
+func mustJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestWriteTOML(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world", "sub/b.txt": "one two three"})
+	repo, options := scanTree(t, dir, "-model", "cl100k_base")
+
+	var out bytes.Buffer
+	if err := WriteTOML(&out, repo, options); err != nil {
+		t.Fatal(err)
+	}
+	toml := out.String()
+	for _, want := range []string{
+		"total = 5\n",
+		"\n[metadata]\n",
+		"model = \"cl100k_base\"\n",
+		"\n[[directories]]\npath = \".\"\n",
+		"\n[[directories.files]]\npath = \"sub/b.txt\"\n",
+	} {
+		if !strings.Contains(toml, want) {
+			t.Errorf("TOML has no %q:\n%s", want, toml)
+		}
+	}
+	if strings.Contains(toml, "null") {
+		t.Errorf("TOML has a null:\n%s", toml)
+	}
+	// Key/value pairs come before the tables
+	if strings.Index(toml, "total =") > strings.Index(toml, "[metadata]") {
+		t.Errorf("total comes after a table:\n%s", toml)
+	}
+
+	if err := WriteTOML(failingWriter{}, repo, options); err == nil {
+		t.Error("WriteTOML to a failing writer succeeded")
+	}
+}
+
+func TestTOMLValues(t *testing.T) {
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"bare key", tomlKey("cl100k_base-2"), "cl100k_base-2"},
+		{"dotted key", tomlKey("a.txt"), `"a.txt"`},
+		{"string", tomlString(`say "hi"\`), `"say \"hi\"\\"`},
+		{"control characters", tomlString("a\tb\nc\x01"), `"a\tb\nc\u0001"`},
+		{"path", tomlPath([]string{"directories", "a b"}), `directories."a b"`},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: %s, want %s", tt.name, tt.got, tt.want)
+		}
+	}
+}
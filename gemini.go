@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+
+	"token-counter/tokenizers"
+)
+
+// isGeminiModel reports whether a -model name is a Gemini model, counted with
+// Google's countTokens API rather than a local tokenizer
+func isGeminiModel(name string) bool {
+	return strings.HasPrefix(name, "gemini-")
+}
+
+// newGeminiCounter returns a counter for model that asks the countTokens API
+// of Gemini or Vertex AI. With GEMINI_API_KEY (or GOOGLE_API_KEY) it uses the
+// Gemini API; otherwise, with GOOGLE_CLOUD_PROJECT, it uses Vertex AI in
+// GOOGLE_CLOUD_LOCATION (us-central1 by default), authenticating with
+// gcloud's access token.
+func newGeminiCounter(model string) (tokenizers.Tokenizer, error) {
+	header := make(http.Header)
+	var endpoint string
+
+	apiKey := os.Getenv("GEMINI_API_KEY")
+	if apiKey == "" {
+		apiKey = os.Getenv("GOOGLE_API_KEY")
+	}
+	project := os.Getenv("GOOGLE_CLOUD_PROJECT")
+
+	switch {
+	case apiKey != "":
+		base := os.Getenv("GEMINI_API_BASE_URL")
+		if base == "" {
+			base = "https://generativelanguage.googleapis.com"
+		}
+		endpoint = fmt.Sprintf("%s/v1beta/models/%s:countTokens", strings.TrimSuffix(base, "/"), url.PathEscape(model))
+		header.Set("x-goog-api-key", apiKey)
+	case project != "":
+		location := os.Getenv("GOOGLE_CLOUD_LOCATION")
+		if location == "" {
+			location = "us-central1"
+		}
+		token, err := exec.Command("gcloud", "auth", "print-access-token").Output()
+		if err != nil {
+			return nil, fmt.Errorf("error getting a Vertex AI access token from gcloud: %v", err)
+		}
+		endpoint = fmt.Sprintf("https://%s-aiplatform.googleapis.com/v1/projects/%s/locations/%s/publishers/google/models/%s:countTokens",
+			location, url.PathEscape(project), location, url.PathEscape(model))
+		header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	default:
+		return nil, fmt.Errorf("counting %s tokens needs GEMINI_API_KEY, or GOOGLE_CLOUD_PROJECT for Vertex AI", model)
+	}
+
+	type part struct {
+		Text string `json:"text"`
+	}
+	type content struct {
+		Role  string `json:"role"`
+		Parts []part `json:"parts"`
+	}
+	count := func(text string) (int, error) {
+		request := map[string][]content{"contents": {{Role: "user", Parts: []part{{Text: text}}}}}
+		var response struct {
+			TotalTokens int `json:"totalTokens"`
+		}
+		if err := postJSON(endpoint, header, request, &response); err != nil {
+			return 0, fmt.Errorf("countTokens for %s: %w", model, err)
+		}
+		return response.TotalTokens, nil
+	}
+	return &apiCounter{model: model, count: count, cache: true}, nil
+}
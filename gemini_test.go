@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGeminiCounter(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/v1beta/models/gemini-2.0-flash:countTokens" || r.Header.Get("x-goog-api-key") != "key" {
+			http.Error(w, `{"error": {"message": "wrong request"}}`, http.StatusBadRequest)
+			return
+		}
+		var request struct {
+			Contents []struct {
+				Role  string `json:"role"`
+				Parts []struct {
+					Text string `json:"text"`
+				} `json:"parts"`
+			} `json:"contents"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || len(request.Contents) != 1 || request.Contents[0].Role != "user" {
+			http.Error(w, `{"error": {"message": "bad body"}}`, http.StatusBadRequest)
+			return
+		}
+		text := request.Contents[0].Parts[0].Text
+		if text == "reject" {
+			http.Error(w, `{"error": {"message": "text rejected"}}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]int{"totalTokens": len(strings.Fields(text))})
+	}))
+	defer server.Close()
+	t.Setenv("GEMINI_API_KEY", "key")
+	t.Setenv("GEMINI_API_BASE_URL", server.URL+"/")
+
+	tok, err := newGeminiCounter("gemini-2.0-flash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text     string
+		want     int
+		err      string
+		requests int // Requests made so far
+	}{
+		{"one two three", 3, "", 1},
+		{"one two three", 3, "", 1}, // From the cache
+		{"", 0, "", 1},
+		{"reject", 0, "countTokens for gemini-2.0-flash: 400 Bad Request: text rejected", 2},
+	}
+	for _, tt := range tests {
+		got, err := tok.Count(tt.text)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("Count(%q) error = %v, want %q", tt.text, err, tt.err)
+			}
+		} else if err != nil || got != tt.want {
+			t.Errorf("Count(%q) = %d, %v, want %d", tt.text, got, err, tt.want)
+		}
+		if requests != tt.requests {
+			t.Errorf("after Count(%q), %d requests were made, want %d", tt.text, requests, tt.requests)
+		}
+	}
+}
+
+func TestGeminiCounterCredentials(t *testing.T) {
+	for _, env := range []string{"GEMINI_API_KEY", "GOOGLE_API_KEY", "GOOGLE_CLOUD_PROJECT"} {
+		t.Setenv(env, "")
+	}
+	if _, err := newGeminiCounter("gemini-2.0-flash"); err == nil || !strings.Contains(err.Error(), "needs GEMINI_API_KEY") {
+		t.Errorf("newGeminiCounter without credentials = %v", err)
+	}
+	if !isGeminiModel("gemini-1.5-pro") || isGeminiModel("gpt-4o") {
+		t.Error("isGeminiModel doesn't tell Gemini models apart")
+	}
+}
+
+func TestGeminiScan(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	defer func(concurrency int) { apiSettings.Concurrency = concurrency }(apiSettings.Concurrency)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Contents []struct {
+				Parts []struct {
+					Text string `json:"text"`
+				} `json:"parts"`
+			} `json:"contents"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		json.NewEncoder(w).Encode(map[string]int{"totalTokens": len(strings.Fields(request.Contents[0].Parts[0].Text))})
+	}))
+	defer server.Close()
+	t.Setenv("GEMINI_API_KEY", "key")
+	t.Setenv("GEMINI_API_BASE_URL", server.URL)
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "one two", "b/c.txt": "three four five", "b/d.txt": "six", "e.txt": "seven eight"})
+	repo, _ := scanTree(t, dir, "-model", "gemini-2.0-flash", "-api-concurrency", "3")
+	if repo.TokenCount != 8 || len(countedPaths(dir, repo)) != 4 {
+		t.Errorf("scan counted %d tokens in %v, want 8 in 4 files", repo.TokenCount, countedPaths(dir, repo))
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// generatedHeaderLines is how many lines at the start of a file are searched
+// for a generated-code marker
+const generatedHeaderLines = 10
+
+// minifiedLineBytes is the average line length above which a script or
+// stylesheet is taken to be minified
+const minifiedLineBytes = 500
+
+// generatedMarkers are the comments code generators put at the top of the
+// files they write, lowercased, like Go's "Code generated by stringer; DO NOT
+// EDIT." and Facebook's "@generated"
+var generatedMarkers = []string{
+	"code generated by",
+	"do not edit",
+	"@generated",
+	"auto-generated",
+	"autogenerated",
+	"automatically generated",
+	"this file was generated",
+}
+
+// generatedSuffixes are the name endings of files code generators write,
+// lowercased
+var generatedSuffixes = []string{
+	".pb.go", ".pb.gw.go", "_gen.go", "_generated.go", ".gen.go",
+	"_pb2.py", "_pb2_grpc.py", ".pb.cc", ".pb.h", ".pb.swift",
+	"_pb.js", "_pb.d.ts", "_grpc_pb.js",
+	".g.dart", ".freezed.dart", ".designer.cs", ".g.cs",
+	".generated.ts", ".generated.js", ".generated.cs",
+}
+
+// minifiedSuffixes are the name endings of minified and bundled scripts and
+// stylesheets, lowercased
+var minifiedSuffixes = []string{".min.js", ".min.mjs", ".min.css", ".bundle.js", ".chunk.js"}
+
+// minifiableExts are the extensions of the files whose line lengths are
+// checked for minification
+var minifiableExts = map[string]bool{".js": true, ".mjs": true, ".cjs": true, ".css": true}
+
+// lockfiles are the names of the files package managers generate to pin
+// dependencies
+var lockfiles = map[string]bool{
+	"package-lock.json":   true,
+	"npm-shrinkwrap.json": true,
+	"yarn.lock":           true,
+	"pnpm-lock.yaml":      true,
+	"bun.lock":            true,
+	"go.sum":              true,
+	"cargo.lock":          true,
+	"gemfile.lock":        true,
+	"poetry.lock":         true,
+	"pipfile.lock":        true,
+	"uv.lock":             true,
+	"composer.lock":       true,
+	"podfile.lock":        true,
+	"pubspec.lock":        true,
+	"mix.lock":            true,
+	"flake.lock":          true,
+	"packages.lock.json":  true,
+	"gradle.lockfile":     true,
+}
+
+// generatedReason tells whether the file at path, starting with head, looks
+// generated, and returns why, like "lockfile" or "header: // Code generated
+// by protoc-gen-go. DO NOT EDIT.", or an empty string if it doesn't. Names
+// are checked first, then markers in the first lines, then, for scripts and
+// stylesheets, whether their lines are as long as minified code's.
+func generatedReason(path string, head []byte) string {
+	name := strings.ToLower(filepath.Base(path))
+	if lockfiles[name] {
+		return "lockfile"
+	}
+	for _, suffix := range generatedSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return "name *" + suffix
+		}
+	}
+	for _, suffix := range minifiedSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return "minified, name *" + suffix
+		}
+	}
+
+	head = head[:min(len(head), sniffLen)]
+	lines := bytes.SplitN(head, []byte("\n"), generatedHeaderLines+1)
+	for _, line := range lines[:min(len(lines), generatedHeaderLines)] {
+		lower := strings.ToLower(string(line))
+		for _, marker := range generatedMarkers {
+			if strings.Contains(lower, marker) {
+				return "header: " + strings.TrimSpace(string(line))
+			}
+		}
+	}
+
+	// A sample too short to hold a long line says nothing
+	if minifiableExts[filepath.Ext(name)] && len(head) >= minifiedLineBytes {
+		if average := len(head) / countLines(head); average > minifiedLineBytes {
+			return fmt.Sprintf("minified, lines of %d bytes on average", average)
+		}
+	}
+	return ""
+}
+
+// addGenerated adds a file counted in the totals to those that look
+// generated, if it does
+func (repo *RepoTokenInfo) addGenerated(fileInfo *FileTokenInfo) {
+	if fileInfo.Generated != "" {
+		repo.GeneratedFiles++
+		repo.GeneratedTokens += fileInfo.TokenCount
+	}
+}
+
+// generatedSummary describes the generated files counted in the report,
+// e.g. "Generated code: 5,210 tokens (31.2% of total) in 4 files", or
+// returns an empty string if there are none
+func generatedSummary(repo *RepoTokenInfo, options *CommandOptions) string {
+	if repo.GeneratedFiles == 0 {
+		return ""
+	}
+	files := "files"
+	if repo.GeneratedFiles == 1 {
+		files = "file"
+	}
+	return fmt.Sprintf("Generated code: %s %s (%.1f%% of total) in %d %s; -exclude-generated leaves it out",
+		formatCount(repo.GeneratedTokens), options.unitName(), percentOf(repo.GeneratedTokens, repo.TokenCount), repo.GeneratedFiles, files)
+}
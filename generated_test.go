@@ -0,0 +1,85 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestGeneratedReason(t *testing.T) {
+	tests := []struct {
+		path string
+		head string
+		want string
+	}{
+		{"go.sum", "", "lockfile"},
+		{"web/Package-Lock.json", "{}", "lockfile"},
+		{"api/service.pb.go", "package api", "name *.pb.go"},
+		{"static/app.min.js", "x", "minified, name *.min.js"},
+		{"stringer.go", "// Code generated by stringer; DO NOT EDIT.\n\npackage main", "header: // Code generated by stringer; DO NOT EDIT."},
+		{"schema.sql", "-- comment\n-- @generated\n", "header: -- @generated"},
+		{"late.go", strings.Repeat("\n", generatedHeaderLines) + "// Code generated by hand", ""},
+		{"bundle.js", strings.Repeat("x", 1200), "minified, lines of 1200 bytes on average"},
+		{"short.js", strings.Repeat("x", 100), ""},
+		{"long.txt", strings.Repeat("x", 1200), ""},
+		{"main.go", "package main\n\nfunc main() {}\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := generatedReason(tt.path, []byte(tt.head)); got != tt.want {
+				t.Errorf("generatedReason = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExcludeGenerated(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"main.go":        "hello world",
+		"go.sum":         "one two three",
+		"api/api.pb.go":  "four",
+		"gen/strings.go": "// Code generated by stringer; DO NOT EDIT.\n",
+	})
+	tests := []struct {
+		name      string
+		args      []string
+		counted   []string
+		generated int
+	}{
+		{"counted", nil, []string{"api/api.pb.go", "gen/strings.go", "go.sum", "main.go"}, 3},
+		{"excluded", []string{"-exclude-generated"}, []string{"main.go"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, options := scanTree(t, dir, append([]string{"-model", "cl100k_base"}, tt.args...)...)
+			if got := countedPaths(dir, repo); !slices.Equal(got, tt.counted) {
+				t.Errorf("counted %v, want %v", got, tt.counted)
+			}
+			if repo.GeneratedFiles != tt.generated || repo.GeneratedTokens != repo.TokenCount-2 {
+				t.Errorf("%d generated files of %d tokens, want %d of %d", repo.GeneratedFiles, repo.GeneratedTokens, tt.generated, repo.TokenCount-2)
+			}
+			summary := generatedSummary(repo, options)
+			if (summary == "") != (tt.generated == 0) {
+				t.Errorf("generatedSummary = %q", summary)
+			}
+		})
+	}
+}
+
+func TestGeneratedSummary(t *testing.T) {
+	options := testOptions(t)
+	tests := []struct {
+		repo RepoTokenInfo
+		want string
+	}{
+		{RepoTokenInfo{TokenCount: 10}, ""},
+		{RepoTokenInfo{TokenCount: 10, GeneratedFiles: 1, GeneratedTokens: 5}, "Generated code: 5 tokens (50.0% of total) in 1 file; -exclude-generated leaves it out"},
+		{RepoTokenInfo{TokenCount: 8000, GeneratedFiles: 3, GeneratedTokens: 2000}, "Generated code: 2,000 tokens (25.0% of total) in 3 files; -exclude-generated leaves it out"},
+	}
+	for _, tt := range tests {
+		if got := generatedSummary(&tt.repo, options); got != tt.want {
+			t.Errorf("generatedSummary = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// SummaryOptions stores the options of -format gh-summary and -set-output
+type SummaryOptions struct {
+	Baseline  string // Baseline file to compare the scan against
+	Top       int    // Number of largest files listed
+	SetOutput bool   // Write the totals to $GITHUB_OUTPUT
+
+	baseline *Baseline // Read from Baseline before the scan starts
+}
+
+// registerSummaryFlags defines the flags of the GitHub Actions integration
+func registerSummaryFlags(fs *flag.FlagSet, summaryOptions *SummaryOptions) {
+	fs.StringVar(&summaryOptions.Baseline, "baseline", "", "Baseline file written by baseline write, e.g. from an artifact of the main branch, to report the change against with -format gh-summary or -set-output")
+	fs.IntVar(&summaryOptions.Top, "summary-top", 10, "Number of largest files listed by -format gh-summary")
+	fs.BoolVar(&summaryOptions.SetOutput, "set-output", false, "Write the total, file count and change against -baseline to $GITHUB_OUTPUT as step outputs")
+}
+
+// validateSummary checks the GitHub Actions flags and reads the baseline, so
+// a missing one fails before the scan rather than after it
+func validateSummary(options *CommandOptions, summaryOptions *SummaryOptions) error {
+	if summaryOptions.Baseline == "" {
+		return nil
+	}
+	if options.Format != "gh-summary" && !summaryOptions.SetOutput {
+		return fmt.Errorf("-baseline needs -format gh-summary or -set-output")
+	}
+	baseline, err := readBaseline(summaryOptions.Baseline)
+	if err != nil {
+		return err
+	}
+	if baseline.Model != options.modelName() || baseline.Unit != options.unitName() {
+		return fmt.Errorf("the baseline counts %s with %s, but this scan counts %s with %s", baseline.Unit, baseline.Model, options.unitName(), options.modelName())
+	}
+	summaryOptions.baseline = baseline
+	return nil
+}
+
+// writeGHSummary appends the Markdown summary of a scan to the job summary
+// in $GITHUB_STEP_SUMMARY, or writes it to -output, or stdout outside of
+// GitHub Actions
+func writeGHSummary(repo *RepoTokenInfo, options *CommandOptions, summaryOptions *SummaryOptions) error {
+	path := options.Output
+	if path == "" {
+		path = os.Getenv("GITHUB_STEP_SUMMARY")
+	}
+	if path == "" {
+		return printGHSummary(os.Stdout, repo, options, summaryOptions)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if err := printGHSummary(file, repo, options, summaryOptions); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// printGHSummary writes the totals of a scan, its largest files and, with a
+// baseline, the directories that changed most since it, as Markdown tables
+func printGHSummary(w io.Writer, repo *RepoTokenInfo, options *CommandOptions, summaryOptions *SummaryOptions) error {
+	unit := options.unitName()
+	metadata := newScanMetadata(repo, options)
+	var b strings.Builder
+	fmt.Fprintf(&b, "### Token count: %s %s\n\n", formatCount(repo.TokenCount), unit)
+	b.WriteString("| | |\n|---|---|\n")
+	fmt.Fprintf(&b, "| Total | %s %s |\n", formatCount(repo.TokenCount), unit)
+	fmt.Fprintf(&b, "| Files | %s |\n", formatCount(metadata.Files))
+	if metadata.Fallback != nil {
+		fmt.Fprintf(&b, "| Model | %s (approximate, %s isn't available) |\n", metadata.Model, metadata.Fallback.Requested)
+	} else {
+		fmt.Fprintf(&b, "| Model | %s |\n", metadata.Model)
+	}
+	if metadata.Commit != "" {
+		fmt.Fprintf(&b, "| Commit | `%.12s` |\n", metadata.Commit)
+	}
+	if baseline := summaryOptions.baseline; baseline != nil {
+		fmt.Fprintf(&b, "| Baseline | %s %s (%s) |\n", formatCount(baseline.Total), unit, changeOf(repo.TokenCount, baseline.Total))
+	}
+	if len(repo.Errors) > 0 {
+		fmt.Fprintf(&b, "| Errors | %d files could not be counted |\n", len(repo.Errors))
+	}
+
+	var files []*FileTokenInfo
+	for _, dirInfo := range repo.Dirs {
+		files = append(files, dirInfo.Files...)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].TokenCount != files[j].TokenCount {
+			return files[i].TokenCount > files[j].TokenCount
+		}
+		return files[i].Path < files[j].Path
+	})
+	if len(files) > summaryOptions.Top {
+		files = files[:summaryOptions.Top]
+	}
+	if len(files) > 0 {
+		fmt.Fprintf(&b, "\n#### Largest files\n\n| File | %s | Share |\n|---|---:|---:|\n", capitalize(unit))
+		for _, fileInfo := range files {
+			fmt.Fprintf(&b, "| %s | %s | %.1f%% |\n", markdownCode(relativeTo(repo.Path, fileInfo.Path)), formatCount(fileInfo.TokenCount), percentOf(fileInfo.TokenCount, repo.TokenCount))
+		}
+	}
+
+	if baseline := summaryOptions.baseline; baseline != nil {
+		changes := baselineChanges(baseline, newBaseline(repo, options))
+		if len(changes) > summaryOptions.Top {
+			changes = changes[:summaryOptions.Top]
+		}
+		b.WriteString("\n#### Changes since the baseline\n\n")
+		if len(changes) == 0 {
+			b.WriteString("No directory changed.\n")
+		} else {
+			b.WriteString("| Directory | Baseline | Now | Change |\n|---|---:|---:|---:|\n")
+			for _, change := range changes {
+				fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", markdownCode(change.path), formatCount(change.before), formatCount(change.after), changeOf(change.after, change.before))
+			}
+		}
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// baselineChange is a directory whose count differs from its baseline
+type baselineChange struct {
+	path          string
+	before, after int
+}
+
+// baselineChanges returns the directories whose counts differ between two
+// baselines, largest change first
+func baselineChanges(baseline *Baseline, current *Baseline) []baselineChange {
+	var changes []baselineChange
+	for path, after := range current.Directories {
+		if before := baseline.Directories[path]; before != after {
+			changes = append(changes, baselineChange{path, before, after})
+		}
+	}
+	for path, before := range baseline.Directories {
+		if _, ok := current.Directories[path]; !ok {
+			changes = append(changes, baselineChange{path, before, 0})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i].after-changes[i].before, changes[j].after-changes[j].before
+		if max(a, -a) != max(b, -b) {
+			return max(a, -a) > max(b, -b)
+		}
+		return changes[i].path < changes[j].path
+	})
+	return changes
+}
+
+// changeOf describes the change from before to after, e.g. +1,200, +4.5%
+func changeOf(after int, before int) string {
+	if before == 0 {
+		return signedCount(after) + ", new"
+	}
+	return fmt.Sprintf("%s, %+.1f%%", signedCount(after-before), float64(after-before)*100/float64(before))
+}
+
+// markdownCode formats a path as inline code in a Markdown table cell
+func markdownCode(path string) string {
+	return "`" + strings.ReplaceAll(path, "|", "\\|") + "`"
+}
+
+// capitalize returns s with its first letter in upper case
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// setGitHubOutput writes the totals of a scan to $GITHUB_OUTPUT, where later
+// steps read them as steps.<id>.outputs.total and so on
+func setGitHubOutput(repo *RepoTokenInfo, options *CommandOptions, summaryOptions *SummaryOptions) error {
+	path := os.Getenv("GITHUB_OUTPUT")
+	if path == "" {
+		return fmt.Errorf("-set-output needs $GITHUB_OUTPUT, which GitHub Actions sets for each step")
+	}
+	outputs := fmt.Sprintf("total=%d\nfiles=%d\nunit=%s\nmodel=%s\n", repo.TokenCount, newScanMetadata(repo, options).Files, options.unitName(), options.modelName())
+	if baseline := summaryOptions.baseline; baseline != nil {
+		outputs += fmt.Sprintf("baseline_total=%d\ndelta=%d\n", baseline.Total, repo.TokenCount-baseline.Total)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(file, outputs); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateSummary(t *testing.T) {
+	dir := t.TempDir()
+	writeBaseline(filepath.Join(dir, "cl100k.json"), &Baseline{Model: "cl100k_base", Unit: "tokens", Total: 7})
+	writeBaseline(filepath.Join(dir, "o200k.json"), &Baseline{Model: "o200k_base", Unit: "tokens", Total: 7})
+	tests := []struct {
+		name      string
+		format    string
+		baseline  string
+		setOutput bool
+		wantErr   string
+	}{
+		{"no baseline", "text", "", false, ""},
+		{"gh-summary", "gh-summary", "cl100k.json", false, ""},
+		{"set-output", "text", "cl100k.json", true, ""},
+		{"neither", "json", "cl100k.json", false, "-baseline needs -format gh-summary or -set-output"},
+		{"missing", "gh-summary", "missing.json", false, "no such file or directory"},
+		{"other model", "gh-summary", "o200k.json", false, "the baseline counts tokens with o200k_base, but this scan counts tokens with cl100k_base"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := testOptions(t, "-model", "cl100k_base", "-format", tt.format)
+			summaryOptions := &SummaryOptions{SetOutput: tt.setOutput}
+			if tt.baseline != "" {
+				summaryOptions.Baseline = filepath.Join(dir, tt.baseline)
+			}
+			err := validateSummary(options, summaryOptions)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if (summaryOptions.baseline != nil) != (tt.baseline != "") {
+					t.Errorf("baseline %+v read from %q", summaryOptions.baseline, tt.baseline)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateSummary error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPrintGHSummary(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world", "sub/b.txt": "one two three"})
+	repo, options := scanTree(t, dir, "-model", "cl100k_base")
+	baseline := &Baseline{Model: "cl100k_base", Unit: "tokens", Total: 7, Directories: map[string]int{".": 2, "sub": 1, "gone": 4}}
+	tests := []struct {
+		name     string
+		summary  *SummaryOptions
+		want     []string
+		excluded []string
+	}{
+		{"largest files", &SummaryOptions{Top: 10}, []string{
+			"### Token count: 5 tokens\n\n| | |\n|---|---|\n| Total | 5 tokens |\n| Files | 2 |\n| Model | cl100k_base |\n",
+			"#### Largest files\n\n| File | Tokens | Share |\n|---|---:|---:|\n| `sub/b.txt` | 3 | 60.0% |\n| `a.txt` | 2 | 40.0% |\n",
+		}, []string{"Baseline", "Changes since the baseline"}},
+		{"top and baseline", &SummaryOptions{Top: 1, baseline: baseline}, []string{
+			"| Baseline | 7 tokens (-2, -28.6%) |\n",
+			"| `sub/b.txt` | 3 | 60.0% |\n\n",
+			"#### Changes since the baseline\n\n| Directory | Baseline | Now | Change |\n|---|---:|---:|---:|\n| `gone` | 4 | 0 | -4, -100.0% |\n\n",
+		}, nil},
+		{"unchanged baseline", &SummaryOptions{Top: 10, baseline: newBaseline(repo, options)}, []string{"No directory changed.\n"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			if err := printGHSummary(&out, repo, options, tt.summary); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("summary is missing %q:\n%s", want, out.String())
+				}
+			}
+			for _, excluded := range tt.excluded {
+				if strings.Contains(out.String(), excluded) {
+					t.Errorf("summary has %q:\n%s", excluded, out.String())
+				}
+			}
+		})
+	}
+
+	if err := printGHSummary(failingWriter{}, repo, options, &SummaryOptions{}); err == nil {
+		t.Error("printGHSummary to a failing writer succeeded")
+	}
+}
+
+func TestWriteGHSummary(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world"})
+	repo, options := scanTree(t, dir, "-model", "cl100k_base")
+	summary := filepath.Join(t.TempDir(), "summary.md")
+	t.Setenv("GITHUB_STEP_SUMMARY", summary)
+	for range 2 {
+		if err := writeGHSummary(repo, options, &SummaryOptions{Top: 10}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, _ := os.ReadFile(summary)
+	if got := strings.Count(string(data), "### Token count: 2 tokens\n"); got != 2 {
+		t.Errorf("the job summary has %d summaries, want 2 appended:\n%s", got, data)
+	}
+
+	options.Output = filepath.Join(dir, "missing", "summary.md")
+	if err := writeGHSummary(repo, options, &SummaryOptions{}); err == nil {
+		t.Error("writeGHSummary to a missing directory succeeded")
+	}
+}
+
+func TestSetGitHubOutput(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world"})
+	repo, options := scanTree(t, dir, "-model", "cl100k_base")
+	output := filepath.Join(t.TempDir(), "output")
+	tests := []struct {
+		name    string
+		env     string
+		summary *SummaryOptions
+		want    string
+	}{
+		{"totals", output, &SummaryOptions{}, "total=2\nfiles=1\nunit=tokens\nmodel=cl100k_base\n"},
+		{"baseline", output, &SummaryOptions{baseline: &Baseline{Total: 5}}, "total=2\nfiles=1\nunit=tokens\nmodel=cl100k_base\nbaseline_total=5\ndelta=-3\n"},
+		{"outside GitHub Actions", "", &SummaryOptions{}, "-set-output needs $GITHUB_OUTPUT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			os.Remove(output)
+			t.Setenv("GITHUB_OUTPUT", tt.env)
+			err := setGitHubOutput(repo, options, tt.summary)
+			got, _ := os.ReadFile(output)
+			if err != nil {
+				got = []byte(err.Error())
+			}
+			if !strings.Contains(string(got), tt.want) {
+				t.Errorf("setGitHubOutput wrote %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -3,8 +3,17 @@ module token-counter
 go 1.24
 
 require (
+	github.com/dlclark/regexp2 v1.9.0
 	github.com/sabhiram/go-gitignore v0.0.0-20210923224102-525f6e181f06
-	github.com/tiktoken-go/tokenizer v0.1.0
+	github.com/tiktoken-go/tokenizer v0.2.0
+	golang.org/x/net v0.34.0
+	golang.org/x/sys v0.29.0
+	golang.org/x/text v0.26.0
+	google.golang.org/grpc v1.71.1
+	google.golang.org/protobuf v1.36.6
+	gopkg.in/yaml.v3 v3.0.1
 )
 
-require github.com/dlclark/regexp2 v1.9.0 // indirect
+require (
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250115164207-1a7da9e5054f // indirect
+)
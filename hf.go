@@ -0,0 +1,817 @@
+package main
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dlclark/regexp2"
+	"golang.org/x/text/unicode/norm"
+)
+
+// maxCachedWords caps the encodings an hfTokenizer caches. Once the cache is
+// full it's emptied and filled again, which keeps the words common in the
+// text being counted while bounding what a long-running server holds.
+const maxCachedWords = 1 << 16
+
+// gpt2SplitPattern is the pre-tokenization regex used by byte-level BPE
+// tokenizers (GPT-2 and the HuggingFace ByteLevel pre-tokenizer)
+const gpt2SplitPattern = `'s|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+`
+
+// hfTokenizerFile mirrors the parts of a HuggingFace tokenizer.json that
+// affect how text is split into tokens
+type hfTokenizerFile struct {
+	AddedTokens []struct {
+		ID      int    `json:"id"`
+		Content string `json:"content"`
+	} `json:"added_tokens"`
+	Normalizer   *hfComponent `json:"normalizer"`
+	PreTokenizer *hfComponent `json:"pre_tokenizer"`
+	Model        hfModel      `json:"model"`
+}
+
+// hfComponent holds the union of fields used by the normalizer and
+// pre-tokenizer types we support; which ones are set depends on Type
+type hfComponent struct {
+	Type             string        `json:"type"`
+	Normalizers      []hfComponent `json:"normalizers"`
+	Pretokenizers    []hfComponent `json:"pretokenizers"`
+	Prepend          string        `json:"prepend"`
+	Pattern          hfPattern     `json:"pattern"`
+	Content          string        `json:"content"`
+	Behavior         string        `json:"behavior"`
+	Invert           bool          `json:"invert"`
+	AddPrefixSpace   *bool         `json:"add_prefix_space"`
+	UseRegex         *bool         `json:"use_regex"`
+	Replacement      string        `json:"replacement"`
+	PrependScheme    string        `json:"prepend_scheme"`
+	Split            *bool         `json:"split"`
+	IndividualDigits bool          `json:"individual_digits"`
+	StripLeft        bool          `json:"strip_left"`
+	StripRight       bool          `json:"strip_right"`
+}
+
+// hfPattern is either a literal string or a regular expression
+type hfPattern struct {
+	String *string `json:"String"`
+	Regex  *string `json:"Regex"`
+}
+
+// hfModel is the BPE model section of a tokenizer.json
+type hfModel struct {
+	Type                    string          `json:"type"`
+	Vocab                   map[string]int  `json:"vocab"`
+	Merges                  json.RawMessage `json:"merges"`
+	UnkToken                *string         `json:"unk_token"`
+	ContinuingSubwordPrefix *string         `json:"continuing_subword_prefix"`
+	EndOfWordSuffix         *string         `json:"end_of_word_suffix"`
+	FuseUnk                 bool            `json:"fuse_unk"`
+	ByteFallback            bool            `json:"byte_fallback"`
+	IgnoreMerges            bool            `json:"ignore_merges"`
+}
+
+// normalizeFunc rewrites text before it is pre-tokenized
+type normalizeFunc func(text string) string
+
+// preTokenizeFunc splits text into the pieces the model encodes separately.
+// first is true when the text is at the very start of the input.
+type preTokenizeFunc func(pieces []string, first bool) ([]string, error)
+
+// hfTokenizer implements tokenizer.Codec for BPE models defined by a
+// HuggingFace fast-tokenizer file (Llama, Mistral, Qwen and friends)
+type hfTokenizer struct {
+	name        string
+	normalize   normalizeFunc
+	preTokenize preTokenizeFunc
+	byteLevel   bool
+
+	vocab        map[string]int
+	reverseVocab map[int]string
+	ranks        map[[2]string]int
+	unkID        int
+	hasUnk       bool
+	prefix       string
+	suffix       string
+	fuseUnk      bool
+	byteFallback bool
+	ignoreMerges bool
+
+	added      map[string]int
+	addedRegex *regexp.Regexp
+
+	cacheMu sync.Mutex // guards cache, so one tokenizer can be shared by the server's requests
+	cache   map[string][]int
+}
+
+// loadHFTokenizer loads a HuggingFace tokenizer.json file
+func loadHFTokenizer(path string) (*hfTokenizer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file hfTokenizerFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+
+	if file.Model.Type != "BPE" {
+		return nil, fmt.Errorf("unsupported tokenizer model type %q (only BPE is supported)", file.Model.Type)
+	}
+
+	merges, err := parseHFMerges(file.Model.Merges)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing merges in %s: %v", path, err)
+	}
+	return newHFTokenizer(path, &file, merges)
+}
+
+// newHFTokenizer builds a BPE tokenizer from a parsed tokenizer definition
+// and its merges, highest priority first
+func newHFTokenizer(name string, file *hfTokenizerFile, merges [][2]string) (*hfTokenizer, error) {
+	t := &hfTokenizer{
+		name:         name,
+		vocab:        file.Model.Vocab,
+		reverseVocab: make(map[int]string, len(file.Model.Vocab)),
+		fuseUnk:      file.Model.FuseUnk,
+		byteFallback: file.Model.ByteFallback,
+		ignoreMerges: file.Model.IgnoreMerges,
+		added:        make(map[string]int),
+		cache:        make(map[string][]int),
+	}
+	for token, id := range t.vocab {
+		t.reverseVocab[id] = token
+	}
+	if file.Model.UnkToken != nil {
+		t.unkID, t.hasUnk = t.vocab[*file.Model.UnkToken]
+	}
+	if file.Model.ContinuingSubwordPrefix != nil {
+		t.prefix = *file.Model.ContinuingSubwordPrefix
+	}
+	if file.Model.EndOfWordSuffix != nil {
+		t.suffix = *file.Model.EndOfWordSuffix
+	}
+
+	t.ranks = make(map[[2]string]int, len(merges))
+	for rank, merge := range merges {
+		if _, exists := t.ranks[merge]; !exists {
+			t.ranks[merge] = rank
+		}
+	}
+
+	// Added tokens are matched verbatim and split out before normalization
+	if len(file.AddedTokens) > 0 {
+		var patterns []string
+		for _, token := range file.AddedTokens {
+			t.added[token.Content] = token.ID
+			t.reverseVocab[token.ID] = token.Content
+			patterns = append(patterns, regexp.QuoteMeta(token.Content))
+		}
+		sort.Slice(patterns, func(i, j int) bool {
+			return len(patterns[i]) > len(patterns[j])
+		})
+		t.addedRegex = regexp.MustCompile(strings.Join(patterns, "|"))
+	}
+
+	var err error
+	t.normalize = func(text string) string { return text }
+	if file.Normalizer != nil {
+		if t.normalize, err = buildHFNormalizer(*file.Normalizer); err != nil {
+			return nil, err
+		}
+	}
+
+	t.preTokenize = func(pieces []string, first bool) ([]string, error) { return pieces, nil }
+	if file.PreTokenizer != nil {
+		if t.preTokenize, err = t.buildPreTokenizer(*file.PreTokenizer); err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
+
+// parseHFMerges accepts both merge formats: "a b" strings and ["a", "b"] pairs
+func parseHFMerges(raw json.RawMessage) ([][2]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var merges [][2]string
+	var pairs [][]string
+	if err := json.Unmarshal(raw, &pairs); err == nil {
+		for _, pair := range pairs {
+			if len(pair) != 2 {
+				return nil, fmt.Errorf("invalid merge %q", pair)
+			}
+			merges = append(merges, [2]string{pair[0], pair[1]})
+		}
+		return merges, nil
+	}
+
+	var lines []string
+	if err := json.Unmarshal(raw, &lines); err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		parts := strings.SplitN(line, " ", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid merge %q", line)
+		}
+		merges = append(merges, [2]string{parts[0], parts[1]})
+	}
+	return merges, nil
+}
+
+// buildHFNormalizer converts a normalizer definition into a function
+func buildHFNormalizer(c hfComponent) (normalizeFunc, error) {
+	switch c.Type {
+	case "Sequence":
+		var steps []normalizeFunc
+		for _, child := range c.Normalizers {
+			step, err := buildHFNormalizer(child)
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, step)
+		}
+		return func(text string) string {
+			for _, step := range steps {
+				text = step(text)
+			}
+			return text
+		}, nil
+	case "NFC":
+		return norm.NFC.String, nil
+	case "NFD":
+		return norm.NFD.String, nil
+	case "NFKC":
+		return norm.NFKC.String, nil
+	case "NFKD":
+		return norm.NFKD.String, nil
+	case "Lowercase":
+		return strings.ToLower, nil
+	case "StripAccents":
+		return func(text string) string {
+			return strings.Map(func(r rune) rune {
+				if unicode.Is(unicode.Mn, r) {
+					return -1
+				}
+				return r
+			}, text)
+		}, nil
+	case "Strip":
+		return func(text string) string {
+			if c.StripLeft {
+				text = strings.TrimLeftFunc(text, unicode.IsSpace)
+			}
+			if c.StripRight {
+				text = strings.TrimRightFunc(text, unicode.IsSpace)
+			}
+			return text
+		}, nil
+	case "Prepend":
+		return func(text string) string {
+			if text == "" {
+				return text
+			}
+			return c.Prepend + text
+		}, nil
+	case "Replace":
+		if c.Pattern.String != nil {
+			return func(text string) string {
+				return strings.ReplaceAll(text, *c.Pattern.String, c.Content)
+			}, nil
+		}
+		if c.Pattern.Regex != nil {
+			re, err := regexp2.Compile(*c.Pattern.Regex, regexp2.None)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Replace pattern: %v", err)
+			}
+			return func(text string) string {
+				out, err := re.Replace(text, c.Content, -1, -1)
+				if err != nil {
+					return text
+				}
+				return out
+			}, nil
+		}
+		return nil, fmt.Errorf("Replace normalizer without a pattern")
+	default:
+		return nil, fmt.Errorf("unsupported normalizer type %q", c.Type)
+	}
+}
+
+// buildPreTokenizer converts a pre-tokenizer definition into a function
+func (t *hfTokenizer) buildPreTokenizer(c hfComponent) (preTokenizeFunc, error) {
+	switch c.Type {
+	case "Sequence":
+		var steps []preTokenizeFunc
+		for _, child := range c.Pretokenizers {
+			step, err := t.buildPreTokenizer(child)
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, step)
+		}
+		return func(pieces []string, first bool) ([]string, error) {
+			var err error
+			for _, step := range steps {
+				if pieces, err = step(pieces, first); err != nil {
+					return nil, err
+				}
+			}
+			return pieces, nil
+		}, nil
+
+	case "ByteLevel":
+		t.byteLevel = true
+		useRegex := c.UseRegex == nil || *c.UseRegex
+		addPrefixSpace := c.AddPrefixSpace != nil && *c.AddPrefixSpace
+		re := regexp2.MustCompile(gpt2SplitPattern, regexp2.None)
+		return func(pieces []string, first bool) ([]string, error) {
+			if addPrefixSpace && first && len(pieces) > 0 && !strings.HasPrefix(pieces[0], " ") {
+				pieces[0] = " " + pieces[0]
+			}
+			if useRegex {
+				var err error
+				if pieces, err = splitPieces(pieces, regexMatcher(re), "Isolated", false); err != nil {
+					return nil, err
+				}
+			}
+			for i, piece := range pieces {
+				pieces[i] = byteLevelEncode(piece)
+			}
+			return pieces, nil
+		}, nil
+
+	case "Metaspace":
+		replacement := c.Replacement
+		if replacement == "" {
+			replacement = "▁"
+		}
+		scheme := c.PrependScheme
+		if scheme == "" {
+			scheme = "always"
+			if c.AddPrefixSpace != nil && !*c.AddPrefixSpace {
+				scheme = "never"
+			}
+		}
+		split := c.Split == nil || *c.Split
+		return func(pieces []string, first bool) ([]string, error) {
+			for i, piece := range pieces {
+				piece = strings.ReplaceAll(piece, " ", replacement)
+				if (scheme == "always" || (scheme == "first" && first && i == 0)) && !strings.HasPrefix(piece, replacement) {
+					piece = replacement + piece
+				}
+				pieces[i] = piece
+			}
+			if !split {
+				return pieces, nil
+			}
+			return splitPieces(pieces, stringMatcher(replacement), "MergedWithNext", false)
+		}, nil
+
+	case "Split":
+		var matcher pieceMatcher
+		switch {
+		case c.Pattern.String != nil:
+			matcher = stringMatcher(*c.Pattern.String)
+		case c.Pattern.Regex != nil:
+			re, err := regexp2.Compile(*c.Pattern.Regex, regexp2.None)
+			if err != nil {
+				return nil, fmt.Errorf("invalid Split pattern: %v", err)
+			}
+			matcher = regexMatcher(re)
+		default:
+			return nil, fmt.Errorf("Split pre-tokenizer without a pattern")
+		}
+		return func(pieces []string, first bool) ([]string, error) {
+			return splitPieces(pieces, matcher, c.Behavior, c.Invert)
+		}, nil
+
+	case "Whitespace":
+		re := regexp2.MustCompile(`\w+|[^\w\s]+`, regexp2.None)
+		return func(pieces []string, first bool) ([]string, error) {
+			return splitPieces(pieces, regexMatcher(re), "Removed", true)
+		}, nil
+
+	case "WhitespaceSplit":
+		return func(pieces []string, first bool) ([]string, error) {
+			var out []string
+			for _, piece := range pieces {
+				out = append(out, strings.Fields(piece)...)
+			}
+			return out, nil
+		}, nil
+
+	case "Digits":
+		pattern := `\p{N}+`
+		if c.IndividualDigits {
+			pattern = `\p{N}`
+		}
+		re := regexp2.MustCompile(pattern, regexp2.None)
+		return func(pieces []string, first bool) ([]string, error) {
+			return splitPieces(pieces, regexMatcher(re), "Isolated", false)
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported pre-tokenizer type %q", c.Type)
+	}
+}
+
+// pieceMatcher returns the byte ranges of every delimiter match in s
+type pieceMatcher func(s string) ([][2]int, error)
+
+// stringMatcher matches every occurrence of a literal delimiter
+func stringMatcher(delim string) pieceMatcher {
+	return func(s string) ([][2]int, error) {
+		var matches [][2]int
+		if delim == "" {
+			return matches, nil
+		}
+		for offset := 0; ; {
+			i := strings.Index(s[offset:], delim)
+			if i < 0 {
+				return matches, nil
+			}
+			matches = append(matches, [2]int{offset + i, offset + i + len(delim)})
+			offset += i + len(delim)
+		}
+	}
+}
+
+// regexMatcher matches a regexp2 pattern, converting its rune offsets to bytes
+func regexMatcher(re *regexp2.Regexp) pieceMatcher {
+	return func(s string) ([][2]int, error) {
+		runes := []rune(s)
+		offsets := make([]int, len(runes)+1)
+		for i, r := range runes {
+			offsets[i+1] = offsets[i] + utf8.RuneLen(r)
+		}
+
+		var matches [][2]int
+		m, err := re.FindRunesMatch(runes)
+		for ; m != nil && err == nil; m, err = re.FindNextMatch(m) {
+			if m.Length > 0 {
+				matches = append(matches, [2]int{offsets[m.Index], offsets[m.Index+m.Length]})
+			}
+		}
+		return matches, err
+	}
+}
+
+// splitPieces splits every piece on the matcher's delimiters, handling the
+// delimiters according to HuggingFace's SplitDelimiterBehavior
+func splitPieces(pieces []string, matcher pieceMatcher, behavior string, invert bool) ([]string, error) {
+	type segment struct {
+		text    string
+		isMatch bool
+	}
+
+	var out []string
+	for _, piece := range pieces {
+		matches, err := matcher(piece)
+		if err != nil {
+			return nil, err
+		}
+
+		var segments []segment
+		last := 0
+		for _, m := range matches {
+			if m[0] > last {
+				segments = append(segments, segment{piece[last:m[0]], invert})
+			}
+			segments = append(segments, segment{piece[m[0]:m[1]], !invert})
+			last = m[1]
+		}
+		if last < len(piece) {
+			segments = append(segments, segment{piece[last:], invert})
+		}
+
+		switch behavior {
+		case "Removed":
+			for _, seg := range segments {
+				if !seg.isMatch {
+					out = append(out, seg.text)
+				}
+			}
+		case "MergedWithPrevious":
+			canMerge := false
+			for _, seg := range segments {
+				if seg.isMatch && canMerge {
+					out[len(out)-1] += seg.text
+					canMerge = false
+				} else {
+					out = append(out, seg.text)
+					canMerge = !seg.isMatch
+				}
+			}
+		case "MergedWithNext":
+			pending := ""
+			for _, seg := range segments {
+				if seg.isMatch {
+					if pending != "" {
+						out = append(out, pending)
+					}
+					pending = seg.text
+				} else {
+					out = append(out, pending+seg.text)
+					pending = ""
+				}
+			}
+			if pending != "" {
+				out = append(out, pending)
+			}
+		case "Contiguous":
+			prevMatch := false
+			for _, seg := range segments {
+				if seg.isMatch && prevMatch {
+					out[len(out)-1] += seg.text
+				} else {
+					out = append(out, seg.text)
+				}
+				prevMatch = seg.isMatch
+			}
+		default: // Isolated
+			for _, seg := range segments {
+				out = append(out, seg.text)
+			}
+		}
+	}
+	return out, nil
+}
+
+// byteToRune and runeToByte are GPT-2's reversible mapping of bytes to
+// printable characters, used by byte-level BPE vocabularies
+var byteToRune, runeToByte = func() ([256]rune, map[rune]byte) {
+	var table [256]rune
+	reverse := make(map[rune]byte, 256)
+	n := 0
+	for b := 0; b < 256; b++ {
+		if (b >= '!' && b <= '~') || (b >= 0xA1 && b <= 0xAC) || (b >= 0xAE && b <= 0xFF) {
+			table[b] = rune(b)
+		} else {
+			table[b] = rune(256 + n)
+			n++
+		}
+		reverse[table[b]] = byte(b)
+	}
+	return table, reverse
+}()
+
+// byteLevelEncode maps each byte of s to its byte-level BPE character
+func byteLevelEncode(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		sb.WriteRune(byteToRune[s[i]])
+	}
+	return sb.String()
+}
+
+// Name returns the path of the tokenizer file
+func (t *hfTokenizer) Name() string {
+	return t.name
+}
+
+// Count returns the number of tokens text encodes to
+func (t *hfTokenizer) Count(text string) (int, error) {
+	ids, _, err := t.Encode(text)
+	return len(ids), err
+}
+
+// Encode tokenizes text into token ids and token strings
+func (t *hfTokenizer) Encode(text string) ([]uint, []string, error) {
+	var ids []uint
+	var tokens []string
+	emit := func(id int) {
+		ids = append(ids, uint(id))
+		tokens = append(tokens, t.reverseVocab[id])
+	}
+
+	encodeSegment := func(segment string, first bool) error {
+		segment = t.normalize(segment)
+		if segment == "" {
+			return nil
+		}
+		pieces, err := t.preTokenize([]string{segment}, first)
+		if err != nil {
+			return err
+		}
+		for _, piece := range pieces {
+			for _, id := range t.encodeWord(piece) {
+				emit(id)
+			}
+		}
+		return nil
+	}
+
+	// Split out added tokens, which map straight to their ids
+	last := 0
+	if t.addedRegex != nil {
+		for _, m := range t.addedRegex.FindAllStringIndex(text, -1) {
+			if err := encodeSegment(text[last:m[0]], last == 0); err != nil {
+				return nil, nil, err
+			}
+			emit(t.added[text[m[0]:m[1]]])
+			last = m[1]
+		}
+	}
+	if err := encodeSegment(text[last:], last == 0); err != nil {
+		return nil, nil, err
+	}
+
+	return ids, tokens, nil
+}
+
+// Decode reassembles text from token ids
+func (t *hfTokenizer) Decode(ids []uint) (string, error) {
+	var sb strings.Builder
+	for _, id := range ids {
+		token, ok := t.reverseVocab[int(id)]
+		if !ok {
+			return "", fmt.Errorf("invalid token: %d", id)
+		}
+		if _, isAdded := t.added[token]; isAdded {
+			sb.WriteString(token)
+			continue
+		}
+		var b byte
+		if t.byteFallback && len(token) == 6 && strings.HasPrefix(token, "<0x") {
+			if _, err := fmt.Sscanf(token, "<0x%02X>", &b); err == nil {
+				sb.WriteByte(b)
+				continue
+			}
+		}
+		token = strings.TrimPrefix(token, t.prefix)
+		token = strings.TrimSuffix(token, t.suffix)
+		if t.byteLevel {
+			for _, r := range token {
+				sb.WriteByte(runeToByte[r])
+			}
+			continue
+		}
+		sb.WriteString(strings.ReplaceAll(token, "▁", " "))
+	}
+	return sb.String(), nil
+}
+
+// encodeWord applies the BPE merges to a single pre-tokenized piece
+func (t *hfTokenizer) encodeWord(word string) []int {
+	if t.ignoreMerges {
+		if id, ok := t.vocab[word]; ok {
+			return []int{id}
+		}
+	}
+
+	// Short words repeat a lot in source code, so cache their encodings
+	cacheable := len(word) <= 256
+	if cacheable {
+		t.cacheMu.Lock()
+		ids, ok := t.cache[word]
+		t.cacheMu.Unlock()
+		if ok {
+			return ids
+		}
+	}
+
+	symbols := t.mergeSymbols(word)
+
+	var ids []int
+	unknown := false
+	for _, symbol := range symbols {
+		if id, ok := t.vocab[symbol]; ok {
+			ids = append(ids, id)
+			unknown = false
+			continue
+		}
+		if t.byteFallback {
+			fallback := make([]int, 0, len(symbol))
+			for i := 0; i < len(symbol); i++ {
+				id, ok := t.vocab[fmt.Sprintf("<0x%02X>", symbol[i])]
+				if !ok {
+					fallback = nil
+					break
+				}
+				fallback = append(fallback, id)
+			}
+			if fallback != nil {
+				ids = append(ids, fallback...)
+				unknown = false
+				continue
+			}
+		}
+		if t.hasUnk && !(t.fuseUnk && unknown) {
+			ids = append(ids, t.unkID)
+		}
+		unknown = true
+	}
+
+	if cacheable {
+		t.cacheMu.Lock()
+		if len(t.cache) >= maxCachedWords {
+			clear(t.cache)
+		}
+		t.cache[word] = ids
+		t.cacheMu.Unlock()
+	}
+	return ids
+}
+
+// mergeSymbols splits word into characters and repeatedly merges the
+// adjacent pair with the lowest merge rank, using a heap so long inputs
+// (SentencePiece-style tokenizers see whole lines as one word) stay fast
+func (t *hfTokenizer) mergeSymbols(word string) []string {
+	type symbol struct {
+		text       string
+		prev, next int
+		alive      bool
+	}
+
+	var symbols []symbol
+	for i, r := range word {
+		text := string(r)
+		if i > 0 {
+			text = t.prefix + text
+		}
+		symbols = append(symbols, symbol{text, len(symbols) - 1, len(symbols) + 1, true})
+	}
+	if len(symbols) == 0 {
+		return nil
+	}
+	symbols[len(symbols)-1].next = -1
+	symbols[len(symbols)-1].text += t.suffix
+
+	pairs := &mergeHeap{}
+	pushPair := func(left int) {
+		if left < 0 || symbols[left].next < 0 {
+			return
+		}
+		right := symbols[left].next
+		if rank, ok := t.ranks[[2]string{symbols[left].text, symbols[right].text}]; ok {
+			heap.Push(pairs, mergeCandidate{rank, left, symbols[left].text, symbols[right].text})
+		}
+	}
+	for i := range symbols {
+		pushPair(i)
+	}
+
+	for pairs.Len() > 0 {
+		c := heap.Pop(pairs).(mergeCandidate)
+		left := &symbols[c.left]
+		if !left.alive || left.next < 0 || left.text != c.leftText || symbols[left.next].text != c.rightText {
+			continue // stale candidate, one of the symbols has been merged since
+		}
+
+		right := &symbols[left.next]
+		left.text += strings.TrimPrefix(right.text, t.prefix)
+		right.alive = false
+		left.next = right.next
+		if left.next >= 0 {
+			symbols[left.next].prev = c.left
+		}
+
+		pushPair(left.prev)
+		pushPair(c.left)
+	}
+
+	var out []string
+	for i := 0; i >= 0; i = symbols[i].next {
+		out = append(out, symbols[i].text)
+	}
+	return out
+}
+
+// mergeCandidate is a pair of adjacent symbols that a merge rule applies to
+type mergeCandidate struct {
+	rank      int
+	left      int
+	leftText  string
+	rightText string
+}
+
+// mergeHeap orders merge candidates by rank, then by position
+type mergeHeap []mergeCandidate
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].rank != h[j].rank {
+		return h[i].rank < h[j].rank
+	}
+	return h[i].left < h[j].left
+}
+func (h mergeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(mergeCandidate)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testHFTokenizer is a tokenizer.json of a BPE model that knows "a", "b" and
+// "ab", splitting on whitespace
+const testHFTokenizer = `{
+	"pre_tokenizer": {"type": "WhitespaceSplit"},
+	"model": {
+		"type": "BPE",
+		"vocab": {"a": 0, "b": 1, "ab": 2, "[UNK]": 3},
+		"merges": ["a b"],
+		"unk_token": "[UNK]"
+	}
+}`
+
+func writeHFTokenizer(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tokenizer.json")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestHFTokenizer(t *testing.T) {
+	tok, err := loadHFTokenizer(writeHFTokenizer(t, testHFTokenizer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"ab", 1},
+		{"ab ba", 3},
+		{"abab b", 3},
+		{"x", 1},
+	}
+	for _, tt := range tests {
+		if got, err := tok.Count(tt.text); err != nil || got != tt.want {
+			t.Errorf("Count(%q) = %d, %v, want %d", tt.text, got, err, tt.want)
+		}
+	}
+}
+
+func TestHFTokenizerErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     string
+	}{
+		{"not json", "{", "error parsing"},
+		{"not bpe", `{"model": {"type": "WordPiece"}}`, "unsupported tokenizer model type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadHFTokenizer(writeHFTokenizer(t, tt.contents)); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("loadHFTokenizer error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+	if _, err := loadHFTokenizer(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("loadHFTokenizer of a missing file succeeded")
+	}
+}
+
+func TestHFTokenizerCache(t *testing.T) {
+	tok, err := loadHFTokenizer(writeHFTokenizer(t, testHFTokenizer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var words []string
+	for i := 0; i < maxCachedWords+10; i++ {
+		words = append(words, fmt.Sprintf("ab%d", i))
+	}
+	for _, word := range words {
+		if _, err := tok.Count(word); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(tok.cache) > maxCachedWords {
+		t.Errorf("cache holds %d words, want at most %d", len(tok.cache), maxCachedWords)
+	}
+	// Words counted after the cache was emptied still count the same
+	if got, err := tok.Count("ab"); err != nil || got != 1 {
+		t.Errorf("Count(%q) = %d, %v, want 1", "ab", got, err)
+	}
+}
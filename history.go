@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// historyIntervals are the values accepted by history's -interval
+var historyIntervals = map[string]bool{"daily": true, "weekly": true, "monthly": true}
+
+// historyFormats are the values accepted by history's -format
+var historyFormats = map[string]bool{"text": true, "csv": true, "json": true}
+
+// HistoryPoint is the count of the tree at one point of a repository's history
+type HistoryPoint struct {
+	Date       time.Time `json:"date"`
+	Commit     string    `json:"commit"` // Last commit before Date
+	TokenCount int       `json:"tokens"`
+	Files      int       `json:"files"`
+}
+
+// historyCommand defines the history subcommand, which counts the tokens of
+// past commits at regular intervals for a time series of the repository's
+// growth
+func historyCommand(fs *flag.FlagSet) func() {
+	options := &CommandOptions{}
+	var since, until, interval, format, rev string
+
+	registerFlags(fs, options)
+	registerWalkFlags(fs, options)
+	fs.StringVar(&since, "since", "", "First date to count, as YYYY-MM-DD (defaults to the date of the first commit)")
+	fs.StringVar(&until, "until", "", "Last date to count, as YYYY-MM-DD (defaults to today)")
+	fs.StringVar(&interval, "interval", "weekly", "Time between counts: daily, weekly or monthly")
+	fs.StringVar(&format, "format", "text", "Output format: text, csv or json")
+	fs.StringVar(&rev, "rev", "HEAD", "Branch or commit whose first-parent history is counted")
+	return func() {
+		if !historyIntervals[interval] {
+			fmt.Fprintf(os.Stderr, "Error: unknown interval %q (expected daily, weekly or monthly)\n", interval)
+			exit(1)
+		}
+		if !historyFormats[format] {
+			fmt.Fprintf(os.Stderr, "Error: unknown format %q (expected text, csv or json)\n", format)
+			exit(1)
+		}
+		if len(options.Models) > 1 {
+			fmt.Fprintln(os.Stderr, "Error: -models is not supported by history")
+			exit(1)
+		}
+
+		if options.Path == "" {
+			if fs.NArg() > 0 {
+				options.Path = fs.Arg(0)
+			} else {
+				options.Path = "."
+			}
+		}
+		if isGitHubURL(options.Path) {
+			fmt.Fprintln(os.Stderr, "Error: history needs a local clone with its full history")
+			exit(1)
+		}
+		if err := applyProfile(fs, options); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		// Only the part of the repository under the path is counted
+		root, err := git(options.Path, "rev-parse", "--show-toplevel")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		prefix, err := git(options.Path, "rev-parse", "--show-prefix")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		dates, err := historyDates(root, rev, since, until, interval)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		ctx, cancel := commandContext(options)
+		defer cancel()
+		var points []*HistoryPoint
+		var last *HistoryPoint
+		for _, date := range dates {
+			commit, err := git(root, "rev-list", "-1", "--first-parent", "--before="+date.Format(time.RFC3339), rev)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+			if commit == "" {
+				continue // Before the first commit
+			}
+
+			point := &HistoryPoint{Date: date, Commit: commit}
+			if last != nil && last.Commit == commit {
+				point.TokenCount, point.Files = last.TokenCount, last.Files
+			} else {
+				logger.Info("counting", "date", date.Format("2006-01-02"), "commit", commit[:min(len(commit), 12)])
+				repo, err := countCommit(ctx, root, commit, prefix, options)
+				if interrupted(err) {
+					err = interruptedError(err, options)
+				}
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error counting %s: %v\n", commit, err)
+					exit(1)
+				}
+				point.TokenCount = repo.TokenCount
+				for _, dirInfo := range repo.Dirs {
+					point.Files += len(dirInfo.Files)
+				}
+			}
+			points = append(points, point)
+			last = point
+		}
+
+		switch format {
+		case "csv":
+			printHistoryCSV(points)
+		case "json":
+			metadata := newScanMetadata(&RepoTokenInfo{Path: options.Path}, options)
+			if len(points) > 0 {
+				metadata.Files = points[len(points)-1].Files
+			}
+			data, _ := json.MarshalIndent(map[string]any{"metadata": metadata, "points": points}, "", "  ")
+			fmt.Println(string(data))
+		default:
+			printHistory(points, options)
+		}
+	}
+}
+
+// historyDates returns the dates to count: every interval from since to
+// until, ending with until itself
+func historyDates(root string, rev string, since string, until string, interval string) ([]time.Time, error) {
+	end := time.Now()
+	if until != "" {
+		date, err := time.ParseInLocation("2006-01-02", until, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -until %q (expected YYYY-MM-DD)", until)
+		}
+		// Count the day itself
+		end = date.AddDate(0, 0, 1).Add(-time.Second)
+	}
+
+	var start time.Time
+	if since != "" {
+		date, err := time.ParseInLocation("2006-01-02", since, time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -since %q (expected YYYY-MM-DD)", since)
+		}
+		start = date
+	} else {
+		// The first-parent history's oldest commit is the last line
+		out, err := git(root, "log", "--first-parent", "--format=%ct", rev)
+		if err != nil {
+			return nil, err
+		}
+		lines := strings.Split(out, "\n")
+		seconds, err := strconv.ParseInt(lines[len(lines)-1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("no commits in %s", rev)
+		}
+		first := time.Unix(seconds, 0)
+		start = time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, time.Local).AddDate(0, 0, 1)
+		if start.After(end) {
+			// The first commit is from today, so there's only today to count
+			start = end
+		}
+	}
+	if start.After(end) {
+		return nil, fmt.Errorf("-since is after -until")
+	}
+
+	var dates []time.Time
+	for date := start; date.Before(end); date = nextDate(date, interval) {
+		dates = append(dates, date)
+	}
+	return append(dates, end), nil
+}
+
+// nextDate returns the date one interval after date
+func nextDate(date time.Time, interval string) time.Time {
+	switch interval {
+	case "daily":
+		return date.AddDate(0, 0, 1)
+	case "monthly":
+		return date.AddDate(0, 1, 0)
+	default:
+		return date.AddDate(0, 0, 7)
+	}
+}
+
+// countCommit counts the files of a commit under prefix, scanning a snapshot
+// of them read from the object database into a temporary directory, like
+// -rev
+func countCommit(ctx context.Context, root string, commit string, prefix string, options *CommandOptions) (*RepoTokenInfo, error) {
+	dir, err := os.MkdirTemp("", "token-counter-history-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, filepath.FromSlash(prefix))
+	if prefix != "" {
+		if _, err := git(root, "rev-parse", "--verify", "--quiet", commit+":"+prefix); err != nil {
+			// The directory didn't exist yet at that commit
+			return &RepoTokenInfo{Path: path, Dirs: make(map[string]*DirTokenInfo)}, nil
+		}
+	}
+	if err := readCommit(root, commit, prefix, dir); err != nil {
+		return nil, err
+	}
+
+	scan := *options
+	scan.Path = path
+	scan.OnFile = nil
+	return ProcessRepository(ctx, path, &scan)
+}
+
+// git runs a git command in dir and returns its trimmed output, or an error
+// with git's message
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", fmt.Errorf("git %s: %v", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// printHistory prints the time series as a table with the change since the
+// previous point
+func printHistory(points []*HistoryPoint, options *CommandOptions) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "DATE\tCOMMIT\t%s\tFILES\tCHANGE\t\n", strings.ToUpper(options.unitName()))
+	for i, point := range points {
+		change := ""
+		if i > 0 {
+			delta := point.TokenCount - points[i-1].TokenCount
+			sign := "+"
+			if delta < 0 {
+				sign = "-"
+			}
+			change = sign + formatCount(max(delta, -delta))
+			if previous := points[i-1].TokenCount; previous > 0 {
+				change += fmt.Sprintf(" (%+.1f%%)", float64(delta)*100/float64(previous))
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t\n", point.Date.Format("2006-01-02"), point.Commit[:min(len(point.Commit), 12)], formatCount(point.TokenCount), point.Files, change)
+	}
+	w.Flush()
+}
+
+// printHistoryCSV prints the time series as CSV, with full commit hashes
+func printHistoryCSV(points []*HistoryPoint) {
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"date", "commit", "tokens", "files"})
+	for _, point := range points {
+		w.Write([]string{point.Date.Format("2006-01-02"), point.Commit, strconv.Itoa(point.TokenCount), strconv.Itoa(point.Files)})
+	}
+	w.Flush()
+}
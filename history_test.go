@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/csv"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// commitAt commits everything in dir with the commit and author dates set to
+// date, a local time like 2024-01-02T12:00:00
+func commitAt(t *testing.T, dir string, date string, message string) {
+	t.Helper()
+	t.Setenv("GIT_COMMITTER_DATE", date)
+	t.Setenv("GIT_AUTHOR_DATE", date)
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", message)
+}
+
+func TestHistoryCommand(t *testing.T) {
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q")
+	writeTree(t, dir, map[string]string{"a.txt": "one two", "sub/b.txt": "three"})
+	commitAt(t, dir, "2024-01-01T12:00:00", "first")
+	writeTree(t, dir, map[string]string{"sub/c.txt": "four five six"})
+	commitAt(t, dir, "2024-01-03T12:00:00", "second")
+	first := strings.TrimSpace(runGit(t, dir, "rev-parse", "HEAD~1"))
+	second := strings.TrimSpace(runGit(t, dir, "rev-parse", "HEAD"))
+
+	tests := []struct {
+		name string
+		path string
+		want [][]string
+	}{
+		{"root", dir, [][]string{
+			{"date", "commit", "tokens", "files"},
+			{"2024-01-02", first, "3", "2"},
+			{"2024-01-03", first, "3", "2"},
+			{"2024-01-04", second, "6", "3"},
+			{"2024-01-04", second, "6", "3"},
+		}},
+		{"subdirectory", dir + "/sub", [][]string{
+			{"date", "commit", "tokens", "files"},
+			{"2024-01-02", first, "1", "1"},
+			{"2024-01-03", first, "1", "1"},
+			{"2024-01-04", second, "4", "2"},
+			{"2024-01-04", second, "4", "2"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := captureStdout(t, func() {
+				captureStderr(t, func() {
+					findCommand("history").run([]string{"-model", "cl100k_base", "-since", "2024-01-01", "-until", "2024-01-04", "-interval", "daily", "-format", "csv", tt.path})
+				})
+			})
+			records, err := csv.NewReader(strings.NewReader(out)).ReadAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(records, tt.want) {
+				t.Errorf("history:\n%v\nwant:\n%v", records, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistoryCommandErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		args []string
+		path string
+		want string
+	}{
+		{"interval", []string{"-interval", "hourly"}, dir, `Error: unknown interval "hourly"`},
+		{"format", []string{"-format", "xml"}, dir, `Error: unknown format "xml"`},
+		{"not a repository", nil, dir, "Error: git rev-parse: fatal: not a git repository"},
+		{"remote", nil, "https://github.com/org/repo", "Error: history needs a local clone"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderr, code := exitStatus(t, func() { findCommand("history").run(append(tt.args, tt.path)) })
+			if code != 1 || !strings.Contains(stderr, tt.want) {
+				t.Errorf("exit %d, stderr:\n%s", code, stderr)
+			}
+		})
+	}
+}
+
+func TestHistoryDates(t *testing.T) {
+	day := func(s string) time.Time {
+		date, _ := time.ParseInLocation("2006-01-02", s, time.Local)
+		return date
+	}
+	end := day("2024-03-16").Add(-time.Second)
+	tests := []struct {
+		interval string
+		since    string
+		want     []time.Time
+		err      string
+	}{
+		{"weekly", "2024-03-01", []time.Time{day("2024-03-01"), day("2024-03-08"), day("2024-03-15"), end}, ""},
+		{"monthly", "2024-01-15", []time.Time{day("2024-01-15"), day("2024-02-15"), day("2024-03-15"), end}, ""},
+		{"daily", "2024-04-01", nil, "-since is after -until"},
+		{"daily", "March", nil, `invalid -since "March" (expected YYYY-MM-DD)`},
+	}
+	for _, tt := range tests {
+		got, err := historyDates("", "HEAD", tt.since, "2024-03-15", tt.interval)
+		if tt.err != "" {
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("historyDates(%s, %s) error = %v, want %q", tt.since, tt.interval, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("historyDates(%s, %s) = %v, %v, want %v", tt.since, tt.interval, got, err, tt.want)
+		}
+	}
+}
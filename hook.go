@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+)
+
+// hookMarker is in every pre-commit hook install-hook writes, so it can tell
+// its own hooks, which it replaces, from those it would clobber
+const hookMarker = "# Installed by token-counter install-hook"
+
+// defaultHookBase is the branch a pull request's changes are measured
+// against without hook.base in the config file
+const defaultHookBase = "main"
+
+// HookConfig configures the limits hook checks commits against
+type HookConfig struct {
+	MaxFileTokens tokenAmount `yaml:"max_file_tokens"` // Of each file the commit adds or changes, as staged
+	MaxPRTokens   tokenAmount `yaml:"max_pr_tokens"`   // Added by the branch since it left base, the commit included
+	Base          string      `yaml:"base"`            // Branch pull requests are merged into (default main)
+	Exclude       []string    `yaml:"exclude"`         // Gitignore-style patterns of files the limits don't apply to, like lockfiles
+}
+
+// hookFile is a staged file over -max-file-tokens
+type hookFile struct {
+	Path  string
+	Total int
+}
+
+// hookCommand defines the hook subcommand, which a pre-commit hook runs to
+// check the staged changes against the limits of the config file, and fails
+// if a file or the pull request they're part of would go over one
+func hookCommand(fs *flag.FlagSet) func() {
+	options := &CommandOptions{}
+	var maxFile, maxPR int
+	var base string
+
+	registerFlags(fs, options)
+	fs.StringVar(&options.Path, "path", "", "Path of the repository, or a directory inside it, to check (defaults to the current directory)")
+	fs.StringVar(&options.ConfigFile, "config", "", "Config file to read (defaults to "+defaultConfigFile+" in the repository root)")
+	fs.Func("max-file-tokens", "Tokens a staged file may have, e.g. 8k (overrides hook.max_file_tokens in the config file)", func(value string) error {
+		n, err := parseTokenAmount(value)
+		maxFile = n
+		return err
+	})
+	fs.Func("max-pr-tokens", "Tokens the branch may add since it left -base, the staged changes included, e.g. 50k (overrides hook.max_pr_tokens in the config file)", func(value string) error {
+		n, err := parseTokenAmount(value)
+		maxPR = n
+		return err
+	})
+	fs.StringVar(&base, "base", "", "Branch the pull request's changes are measured against (overrides hook.base in the config file, default "+defaultHookBase+")")
+	return func() {
+		if options.Path == "" {
+			options.Path = "."
+		}
+		root, err := git(options.Path, "rev-parse", "--show-toplevel")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		options.Path = root
+
+		config, err := loadConfig(root, options.ConfigFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		if maxFile == 0 {
+			maxFile = int(config.Hook.MaxFileTokens)
+		}
+		if maxPR == 0 {
+			maxPR = int(config.Hook.MaxPRTokens)
+		}
+		if base == "" {
+			base = config.Hook.Base
+		}
+		if base == "" {
+			base = defaultHookBase
+		}
+		if maxFile <= 0 && maxPR <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: hook needs a limit, from -max-file-tokens, -max-pr-tokens, or hook.max_file_tokens or hook.max_pr_tokens in %s\n", defaultConfigFile)
+			exit(1)
+		}
+		if err := loadModelRoutes(options); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		exclude := gitignore.CompileIgnoreLines(config.Hook.Exclude...)
+
+		passed := true
+		if maxFile > 0 {
+			over, err := checkStagedFiles(root, maxFile, exclude, options)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error checking the staged files: %v\n", err)
+				exit(1)
+			}
+			if len(over) > 0 {
+				passed = false
+				fmt.Printf("%s\n", options.paint(ansiRed, fmt.Sprintf("%d staged files are over the limit of %s %s per file:", len(over), formatCount(maxFile), options.unitName())))
+				for _, file := range over {
+					fmt.Printf("  %s: %s %s\n", file.Path, formatCount(file.Total), options.unitName())
+				}
+			}
+		}
+		if maxPR > 0 {
+			added, err := countBranchChanges(root, base, exclude, options)
+			switch {
+			case err != nil:
+				fmt.Fprintf(os.Stderr, "Error counting the changes since %s: %v\n", base, err)
+				exit(1)
+			case added > maxPR:
+				passed = false
+				fmt.Printf("%s\n", options.paint(ansiRed, fmt.Sprintf("The branch adds %s %s since %s, over the limit of %s per pull request", formatCount(added), options.unitName(), base, formatCount(maxPR))))
+			case !options.Quiet:
+				logger.Info("pull request within its limit", "base", base, "added", added, "limit", maxPR)
+			}
+		}
+
+		if !passed {
+			fmt.Println("The commit was blocked by token-counter hook; to commit anyway, run git commit --no-verify")
+			exit(1)
+		}
+	}
+}
+
+// checkStagedFiles counts the staged contents of the files the commit adds
+// or changes, which can differ from the working tree, and returns those over
+// limit, largest first. Binary files are left out, as a scan leaves them out.
+func checkStagedFiles(root string, limit int, exclude *gitignore.GitIgnore, options *CommandOptions) ([]*hookFile, error) {
+	out, err := git(root, "diff", "--cached", "--name-only", "-z", "--diff-filter=ACMR", "--no-renames")
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, path := range strings.Split(out, "\x00") {
+		if path != "" && !exclude.MatchesPath(path) {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return nil, nil
+	}
+
+	// Check the staged contents out of the index into a directory of their own
+	tmpDir, err := os.MkdirTemp("", "token-counter-hook-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+	cmd := exec.Command("git", "checkout-index", "-z", "--stdin", "--prefix="+tmpDir+string(filepath.Separator))
+	cmd.Dir = root
+	cmd.Stdin = strings.NewReader(strings.Join(paths, "\x00"))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git checkout-index: %s", msg)
+		}
+		return nil, fmt.Errorf("git checkout-index: %v", err)
+	}
+
+	encs, err := newCodecs(options)
+	if err != nil {
+		return nil, err
+	}
+	router, err := newModelRouter(options, encs)
+	if err != nil {
+		return nil, err
+	}
+	var over []*hookFile
+	for _, path := range paths {
+		staged := filepath.Join(tmpDir, filepath.FromSlash(path))
+		// Submodules and symlinks aren't checked out as files
+		if info, err := os.Lstat(staged); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if _, binary, err := sniffFile(staged); err != nil || (binary && !options.countsAsText(strings.ToLower(filepath.Ext(path)))) {
+			continue
+		}
+		fileInfo, err := router.countFile(tmpDir, staged, encs, options)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		logger.Debug("checked staged file", "path", path, "total", fileInfo.TokenCount)
+		if fileInfo.TokenCount > limit {
+			over = append(over, &hookFile{path, fileInfo.TokenCount})
+		}
+	}
+	sort.SliceStable(over, func(i, j int) bool { return over[i].Total > over[j].Total })
+	return over, nil
+}
+
+// countBranchChanges counts the tokens of the lines the branch added since
+// it left base, with the staged changes, as its pull request would show them.
+// Without base, as in a clone that doesn't have it, or before the first
+// commit, only the staged changes are counted.
+func countBranchChanges(root string, base string, exclude *gitignore.GitIgnore, options *CommandOptions) (int, error) {
+	args := []string{"diff", "--cached", "--no-color", "--no-ext-diff"}
+	if mergeBase, err := git(root, "merge-base", base, "HEAD"); err == nil {
+		args = append(args, mergeBase)
+	} else {
+		logger.Warn("counting only the staged changes, the branch's base wasn't found", "base", base)
+	}
+	patch, err := git(root, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	encs, err := newCodecs(options)
+	if err != nil {
+		return 0, err
+	}
+	var files []*DiffFileInfo
+	for _, file := range parseDiff(patch) {
+		if !exclude.MatchesPath(file.Path) {
+			files = append(files, file)
+		}
+	}
+	added, _, err := countDiffFiles(files, encs[0], options.CountMode)
+	return added, err
+}
+
+// installHookCommand defines the install-hook subcommand, which writes a git
+// pre-commit hook that runs hook with the given arguments
+func installHookCommand(fs *flag.FlagSet) func() {
+	var path string
+	var force bool
+
+	fs.StringVar(&path, "path", "", "Path of the repository, or a directory inside it, to install the hook in (defaults to the current directory)")
+	fs.BoolVar(&force, "force", false, "Whether to replace a pre-commit hook that token-counter didn't install")
+	return func() {
+		if path == "" {
+			path = "."
+		}
+		root, err := git(path, "rev-parse", "--show-toplevel")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		// Hooks are where core.hooksPath puts them, and shared by worktrees
+		hooksDir, err := git(root, "rev-parse", "--git-path", "hooks")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		if !filepath.IsAbs(hooksDir) {
+			hooksDir = filepath.Join(root, hooksDir)
+		}
+		hookPath := filepath.Join(hooksDir, "pre-commit")
+
+		if existing, err := os.ReadFile(hookPath); err == nil && !force && !bytes.Contains(existing, []byte(hookMarker)) {
+			fmt.Fprintf(os.Stderr, "Error: %s already exists and wasn't installed by token-counter (use -force to replace it)\n", hookPath)
+			exit(1)
+		}
+
+		script, err := hookScript(fs.Args())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		if err := os.MkdirAll(hooksDir, 0o755); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		if err := os.WriteFile(hookPath, []byte(script), 0o755); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing the hook: %v\n", err)
+			exit(1)
+		}
+		// WriteFile keeps the mode of a file it replaces
+		if err := os.Chmod(hookPath, 0o755); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "Installed the pre-commit hook in %s\n", hookPath)
+	}
+}
+
+// hookScript returns the pre-commit hook that runs this executable's hook
+// command with args. The executable is named by its absolute path, so the
+// hook works without token-counter on the PATH of every tool that commits.
+func hookScript(args []string) (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	command := []string{shellQuote(filepath.ToSlash(executable)), "hook"}
+	for _, arg := range args {
+		command = append(command, shellQuote(arg))
+	}
+	return fmt.Sprintf("#!/bin/sh\n%s\n# Checks the staged changes against the limits of %s\nexec %s\n", hookMarker, defaultConfigFile, strings.Join(command, " ")), nil
+}
+
+// shellQuote quotes s for sh
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
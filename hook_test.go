@@ -0,0 +1,157 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+)
+
+// hookRepo returns a repository whose main branch has a.txt, on a feature
+// branch that commits b.txt and stages c.txt, and a.txt grown in the working
+// tree only
+func hookRepo(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q")
+	writeTree(t, dir, map[string]string{"a.txt": "hello world\n"})
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "base")
+	runGit(t, dir, "checkout", "-q", "-b", "feature")
+	writeTree(t, dir, map[string]string{"b.txt": "one two three\n"})
+	runGit(t, dir, "add", ".")
+	runGit(t, dir, "commit", "-q", "-m", "feature")
+	writeTree(t, dir, map[string]string{"c.txt": "one two three four five six seven\n", "go.sum": "one two three four five six seven\n", "bin.dat": "a\x00b"})
+	runGit(t, dir, "add", ".")
+	writeTree(t, dir, map[string]string{"a.txt": strings.Repeat("word ", 100)})
+	return dir
+}
+
+func TestCheckStagedFiles(t *testing.T) {
+	dir := hookRepo(t)
+	options := testOptions(t, "-model", "cl100k_base")
+	tests := []struct {
+		name    string
+		limit   int
+		exclude []string
+		want    []hookFile
+	}{
+		{"over", 5, nil, []hookFile{{"c.txt", 8}, {"go.sum", 8}}},
+		{"excluded", 5, []string{"*.sum"}, []hookFile{{"c.txt", 8}}},
+		{"within", 8, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			over, err := checkStagedFiles(dir, tt.limit, gitignore.CompileIgnoreLines(tt.exclude...), options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []hookFile
+			for _, file := range over {
+				got = append(got, *file)
+			}
+			if len(got) != len(tt.want) || len(got) > 0 && got[0] != tt.want[0] || len(got) > 1 && got[1] != tt.want[1] {
+				t.Errorf("over the limit %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountBranchChanges(t *testing.T) {
+	dir := hookRepo(t)
+	options := testOptions(t, "-model", "cl100k_base")
+	tests := []struct {
+		name    string
+		base    string
+		exclude []string
+		want    int // b.txt adds 4 tokens, c.txt and go.sum 8 each
+	}{
+		{"since main", "main", nil, 20},
+		{"excluded", "main", []string{"go.sum"}, 12},
+		{"missing base", "develop", nil, 16},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, err := countBranchChanges(dir, tt.base, gitignore.CompileIgnoreLines(tt.exclude...), options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if added != tt.want {
+				t.Errorf("the branch adds %d tokens, want %d", added, tt.want)
+			}
+		})
+	}
+}
+
+func TestHookCommand(t *testing.T) {
+	dir := hookRepo(t)
+	writeTree(t, dir, map[string]string{"limits.yaml": "hook:\n  max_file_tokens: 100\n  max_pr_tokens: 100\n  exclude: [go.sum]\n"})
+	run := func(args ...string) {
+		findCommand("hook").run(append([]string{"-quiet", "-model", "cl100k_base", "-path", dir}, args...))
+	}
+	if out := captureStdout(t, func() { run("-config", filepath.Join(dir, "limits.yaml")) }); out != "" {
+		t.Errorf("a commit within the limits printed:\n%s", out)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"file limit", []string{"-max-file-tokens", "5"}, "2 staged files are over the limit of 5 tokens per file:\n  c.txt: 8 tokens\n  go.sum: 8 tokens\n" +
+			"The commit was blocked by token-counter hook; to commit anyway, run git commit --no-verify\n"},
+		{"pull request limit", []string{"-config", filepath.Join(dir, "limits.yaml"), "-max-pr-tokens", "10"}, "The branch adds 12 tokens since main, over the limit of 10 per pull request\n"},
+		{"no limit", nil, "Error: hook needs a limit, from -max-file-tokens, -max-pr-tokens, or hook.max_file_tokens or hook.max_pr_tokens in .token-counter.yaml"},
+		{"not a repository", []string{"-path", t.TempDir(), "-max-file-tokens", "5"}, "not a git repository"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderr, code := exitStatus(t, func() {
+				os.Stdout = os.Stderr
+				run(tt.args...)
+			})
+			if code != 1 || !strings.Contains(stderr, tt.want) {
+				t.Errorf("exit %d, output:\n%s\nwant %q", code, stderr, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstallHookCommand(t *testing.T) {
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q")
+	hookPath := filepath.Join(dir, ".git", "hooks", "pre-commit")
+	install := func(args ...string) {
+		captureStderr(t, func() { findCommand("install-hook").run(append([]string{"-path", dir}, args...)) })
+	}
+	install("--", "-max-file-tokens", "8k", "-config", "it's.yaml")
+	data, err := os.ReadFile(hookPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if script := string(data); !strings.HasPrefix(script, "#!/bin/sh\n"+hookMarker+"\n") || !strings.HasSuffix(script, `' hook '-max-file-tokens' '8k' '-config' 'it'\''s.yaml'`+"\n") {
+		t.Errorf("hook script:\n%s", script)
+	}
+	if info, _ := os.Stat(hookPath); info.Mode().Perm() != 0o755 {
+		t.Errorf("hook mode %v, want 0755", info.Mode())
+	}
+
+	// Its own hook is replaced, another one only with -force
+	install("--", "-max-pr-tokens", "50k")
+	if data, _ := os.ReadFile(hookPath); !strings.Contains(string(data), "'50k'") {
+		t.Errorf("the hook wasn't replaced:\n%s", data)
+	}
+	os.WriteFile(hookPath, []byte("#!/bin/sh\nlint\n"), 0o644)
+	t.Run("another hook", func(t *testing.T) {
+		stderr, code := exitStatus(t, func() { findCommand("install-hook").run([]string{"-path", dir}) })
+		if code != 1 || !strings.Contains(stderr, "pre-commit already exists and wasn't installed by token-counter (use -force to replace it)") {
+			t.Errorf("exit %d, stderr:\n%s", code, stderr)
+		}
+	})
+	install("-force")
+	if info, _ := os.Stat(hookPath); info.Mode().Perm() != 0o755 {
+		t.Errorf("forced hook mode %v, want 0755", info.Mode())
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"path/filepath"
+	"sort"
+)
+
+// htmlNode is a directory or file of the treemap in the HTML report
+type htmlNode struct {
+	Name     string      `json:"name"`
+	Tokens   int         `json:"tokens"`
+	Files    int         `json:"files"`
+	Children []*htmlNode `json:"children,omitempty"`
+}
+
+// htmlRow is a directory or file in the tables of the HTML report
+type htmlRow struct {
+	Path    string
+	Tokens  int
+	Files   int
+	Bytes   int
+	Lines   int
+	Percent float64
+}
+
+// htmlReport is the data the HTML report template is rendered from
+type htmlReport struct {
+	*ScanMetadata
+	Unit     string
+	Total    int
+	Cost     string // Estimated cost of the scan, "" without -price
+	Tree     *htmlNode
+	Dirs     []htmlRow
+	FileRows []htmlRow
+	Images   []*ImageInfo
+	Errors   int
+}
+
+// newHTMLNode converts a tree node and its children, largest first
+func newHTMLNode(node *treeNode) *htmlNode {
+	out := &htmlNode{Name: node.Name, Tokens: node.TokenCount, Files: node.Files}
+	for _, child := range node.Children {
+		out.Children = append(out.Children, newHTMLNode(child))
+	}
+	sort.Slice(out.Children, func(i, j int) bool {
+		if out.Children[i].Tokens != out.Children[j].Tokens {
+			return out.Children[i].Tokens > out.Children[j].Tokens
+		}
+		return out.Children[i].Name < out.Children[j].Name
+	})
+	return out
+}
+
+// WriteHTML writes the scan as a self-contained HTML page, with no external
+// scripts or styles: a zoomable treemap of the tokens by directory and file,
+// sortable tables of both and the model and cost of the scan
+func WriteHTML(w io.Writer, repo *RepoTokenInfo, options *CommandOptions) error {
+	rootPath := repo.Path
+	if options.IsSingleFile {
+		rootPath = filepath.Dir(repo.Path)
+	}
+	percent := func(tokens int) float64 {
+		if repo.TokenCount == 0 {
+			return 0
+		}
+		return float64(tokens) * 100 / float64(repo.TokenCount)
+	}
+	relative := func(path string) string {
+		if rel, err := filepath.Rel(rootPath, path); err == nil {
+			return filepath.ToSlash(rel)
+		}
+		return path
+	}
+
+	report := &htmlReport{
+		ScanMetadata: newScanMetadata(repo, options),
+		Unit:         options.unitName(),
+		Total:        repo.TokenCount,
+		Tree:         newHTMLNode(buildTree(repo)),
+		Images:       repo.Images,
+		Errors:       len(repo.Errors),
+	}
+	if estimate := estimateCost(repo.TokenCount, options); estimate != nil {
+		report.Cost = costSummary(estimate)
+	}
+	for _, dirInfo := range repo.Dirs {
+		report.Dirs = append(report.Dirs, htmlRow{
+			Path:    relative(dirInfo.Path),
+			Tokens:  dirInfo.TokenCount,
+			Files:   len(dirInfo.Files),
+			Percent: percent(dirInfo.TokenCount),
+		})
+		for _, fileInfo := range dirInfo.Files {
+			report.FileRows = append(report.FileRows, htmlRow{
+				Path:    relative(fileInfo.Path),
+				Tokens:  fileInfo.TokenCount,
+				Bytes:   fileInfo.Bytes,
+				Lines:   fileInfo.Lines,
+				Percent: percent(fileInfo.TokenCount),
+			})
+		}
+	}
+	for _, rows := range [][]htmlRow{report.Dirs, report.FileRows} {
+		sort.Slice(rows, func(i, j int) bool {
+			if rows[i].Tokens != rows[j].Tokens {
+				return rows[i].Tokens > rows[j].Tokens
+			}
+			return rows[i].Path < rows[j].Path
+		})
+	}
+
+	return htmlTemplate.Execute(w, report)
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"count": formatCount,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Token report: {{.Path}}</title>
+<style>
+body { font: 14px/1.4 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 24px; color: #222; }
+h1 { font-size: 20px; margin: 0 0 12px; }
+h2 { font-size: 16px; margin: 28px 0 8px; }
+.meta { border-collapse: collapse; margin-bottom: 16px; }
+.meta th { text-align: left; padding: 2px 16px 2px 0; color: #666; font-weight: normal; }
+#crumbs { margin: 8px 0; }
+#crumbs a { color: #0366d6; cursor: pointer; }
+#treemap { width: 100%; height: 560px; background: #f4f4f4; }
+#treemap rect { stroke: #fff; }
+#treemap .dir { cursor: zoom-in; }
+#treemap text { font-size: 11px; pointer-events: none; fill: #111; }
+table.data { border-collapse: collapse; width: 100%; }
+table.data th, table.data td { padding: 3px 8px; border-bottom: 1px solid #eee; }
+table.data th { text-align: left; cursor: pointer; user-select: none; background: #fafafa; }
+table.data td.n, table.data th.n { text-align: right; font-variant-numeric: tabular-nums; }
+.scroll { max-height: 480px; overflow: auto; }
+</style>
+</head>
+<body>
+<h1>Token report: {{.Path}}</h1>
+<table class="meta">
+<tr><th>Model</th><td>{{.Model}}</td></tr>
+<tr><th>Total</th><td>{{count .Total}} {{.Unit}} in {{count .Files}} files</td></tr>
+{{if .Cost}}<tr><th>Estimated cost</th><td>{{.Cost}}</td></tr>
+{{end}}{{if .Errors}}<tr><th>Errors</th><td>{{.Errors}} files could not be counted</td></tr>
+{{end}}{{if .Commit}}<tr><th>Commit</th><td>{{.Commit}}{{if .Dirty}} (with uncommitted changes){{end}}</td></tr>
+{{end}}{{if .Command}}<tr><th>Command</th><td><code>token-counter{{range .Command}} {{.}}{{end}}</code></td></tr>
+{{end}}<tr><th>Generated</th><td>{{.Timestamp.Format "2006-01-02 15:04:05 MST"}} by token-counter {{.Version}}</td></tr>
+</table>
+
+<h2>Treemap</h2>
+<div id="crumbs"></div>
+<svg id="treemap"></svg>
+
+<h2>Directories</h2>
+<div class="scroll">
+<table class="data sortable">
+<thead><tr><th>Path</th><th class="n">{{.Unit}}</th><th class="n">Files</th><th class="n">%</th></tr></thead>
+<tbody>
+{{range .Dirs}}<tr><td>{{.Path}}</td><td class="n" data-v="{{.Tokens}}">{{count .Tokens}}</td><td class="n" data-v="{{.Files}}">{{.Files}}</td><td class="n" data-v="{{.Percent}}">{{printf "%.1f" .Percent}}</td></tr>
+{{end}}</tbody>
+</table>
+</div>
+
+<h2>Files</h2>
+<div class="scroll">
+<table class="data sortable">
+<thead><tr><th>Path</th><th class="n">{{.Unit}}</th><th class="n">Bytes</th><th class="n">Lines</th><th class="n">%</th></tr></thead>
+<tbody>
+{{range .FileRows}}<tr><td>{{.Path}}</td><td class="n" data-v="{{.Tokens}}">{{count .Tokens}}</td><td class="n" data-v="{{.Bytes}}">{{count .Bytes}}</td><td class="n" data-v="{{.Lines}}">{{count .Lines}}</td><td class="n" data-v="{{.Percent}}">{{printf "%.1f" .Percent}}</td></tr>
+{{end}}</tbody>
+</table>
+</div>
+{{if .Images}}
+<h2>Images (estimated vision tokens, not included in the total)</h2>
+<table class="data sortable">
+<thead><tr><th>Path</th><th class="n">Width</th><th class="n">Height</th><th class="n">GPT-4o</th><th class="n">Claude</th></tr></thead>
+<tbody>
+{{range .Images}}<tr><td>{{.Path}}</td><td class="n" data-v="{{.Width}}">{{.Width}}</td><td class="n" data-v="{{.Height}}">{{.Height}}</td><td class="n" data-v="{{.OpenAITokens}}">{{count .OpenAITokens}}</td><td class="n" data-v="{{.ClaudeTokens}}">{{count .ClaudeTokens}}</td></tr>
+{{end}}</tbody>
+</table>
+{{end}}
+<script>
+const tree = {{.Tree}};
+const unit = {{.Unit}};
+const total = tree.tokens || 1;
+const svgNS = "http://www.w3.org/2000/svg";
+const svg = document.getElementById("treemap");
+let trail = [tree];
+
+// squarify lays out nodes, largest first, in the rectangle x, y, w, h with
+// the squarified treemap algorithm
+function squarify(nodes, x, y, w, h) {
+  const sum = nodes.reduce((s, n) => s + n.tokens, 0);
+  const out = [];
+  if (!sum || w <= 0 || h <= 0) return out;
+  const items = nodes.filter(n => n.tokens > 0).map(n => ({node: n, area: n.tokens * w * h / sum}));
+  const worst = (row, side) => {
+    const s = row.reduce((a, r) => a + r.area, 0);
+    const big = Math.max(...row.map(r => r.area)), small = Math.min(...row.map(r => r.area));
+    return Math.max(side * side * big / (s * s), s * s / (side * side * small));
+  };
+  const place = row => {
+    const s = row.reduce((a, r) => a + r.area, 0);
+    if (w >= h) {
+      const rw = s / h;
+      let ry = y;
+      for (const r of row) { out.push({node: r.node, x: x, y: ry, w: rw, h: r.area / rw}); ry += r.area / rw; }
+      x += rw; w -= rw;
+    } else {
+      const rh = s / w;
+      let rx = x;
+      for (const r of row) { out.push({node: r.node, x: rx, y: y, w: r.area / rh, h: rh}); rx += r.area / rh; }
+      y += rh; h -= rh;
+    }
+  };
+  let row = [];
+  for (const item of items) {
+    const side = Math.min(w, h);
+    if (!row.length || worst(row.concat([item]), side) <= worst(row, side)) {
+      row.push(item);
+    } else {
+      place(row);
+      row = [item];
+    }
+  }
+  if (row.length) place(row);
+  return out;
+}
+
+function el(name, attrs, parent) {
+  const e = document.createElementNS(svgNS, name);
+  for (const k in attrs) e.setAttribute(k, attrs[k]);
+  parent.appendChild(e);
+  return e;
+}
+
+// draw lays out the children of node in a rectangle, two levels deep, with
+// a hue per top-level child
+function draw(node, x, y, w, h, depth, hue, path) {
+  squarify(node.children || [], x, y, w, h).forEach((r, i) => {
+    const h2 = depth === 0 ? (i * 47) % 360 : hue;
+    const child = r.node;
+    const childPath = path ? path + "/" + child.name : child.name;
+    const rect = el("rect", {x: r.x, y: r.y, width: Math.max(r.w, 0), height: Math.max(r.h, 0),
+      fill: "hsl(" + h2 + ", 55%, " + (depth === 0 ? 72 : 82) + "%)"}, svg);
+    el("title", {}, rect).textContent = childPath + ": " + child.tokens.toLocaleString() + " " + unit +
+      " (" + (child.tokens * 100 / total).toFixed(1) + "% of total)";
+    if (child.children) {
+      rect.setAttribute("class", "dir");
+      rect.addEventListener("click", () => { trail.push(child); render(); });
+    }
+    if (r.w > 60 && r.h > 16) {
+      el("text", {x: r.x + 4, y: r.y + 13}, svg).textContent = child.name + " " + child.tokens.toLocaleString();
+    }
+    if (depth === 0 && child.children && r.w > 40 && r.h > 40) {
+      draw(child, r.x + 3, r.y + 18, r.w - 6, r.h - 21, 1, h2, childPath);
+    }
+  });
+}
+
+function render() {
+  while (svg.firstChild) svg.removeChild(svg.firstChild);
+  const box = svg.getBoundingClientRect();
+  const node = trail[trail.length - 1];
+  draw(node, 0, 0, box.width, box.height, 0, 0, trail.slice(1).map(n => n.name).join("/"));
+
+  const crumbs = document.getElementById("crumbs");
+  crumbs.textContent = "";
+  trail.forEach((n, i) => {
+    if (i > 0) crumbs.appendChild(document.createTextNode(" / "));
+    const a = document.createElement(i < trail.length - 1 ? "a" : "span");
+    a.textContent = n.name + " (" + n.tokens.toLocaleString() + ")";
+    if (i < trail.length - 1) a.addEventListener("click", () => { trail = trail.slice(0, i + 1); render(); });
+    crumbs.appendChild(a);
+  });
+}
+
+// Sort a table by a column when its header is clicked, again to reverse
+document.querySelectorAll("table.sortable").forEach(table => {
+  table.querySelectorAll("th").forEach((th, col) => {
+    th.addEventListener("click", () => {
+      const body = table.tBodies[0];
+      const desc = th.dataset.dir !== "desc";
+      th.dataset.dir = desc ? "desc" : "asc";
+      const key = tr => {
+        const td = tr.children[col];
+        return td.dataset.v !== undefined ? parseFloat(td.dataset.v) : td.textContent;
+      };
+      Array.from(body.rows).sort((a, b) => {
+        const ka = key(a), kb = key(b);
+        const c = typeof ka === "number" ? ka - kb : ka.localeCompare(kb);
+        return desc ? -c : c;
+      }).forEach(tr => body.appendChild(tr));
+    });
+  });
+});
+
+window.addEventListener("resize", render);
+render();
+</script>
+</body>
+</html>
+`))
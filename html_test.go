@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestWriteHTML(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"a.txt":         "one two",
+		"src/<b>.go":    "package b",
+		"src/deep/c.md": "four",
+	})
+	repo, options := scanTree(t, dir, "-model", "cl100k_base")
+
+	var out strings.Builder
+	if err := WriteHTML(&out, repo, options); err != nil {
+		t.Fatal(err)
+	}
+	html := out.String()
+	for _, want := range []string{
+		"<title>Token report: " + dir + "</title>",
+		"<tr><th>Model</th><td>cl100k_base</td></tr>",
+		"<td>src/&lt;b&gt;.go</td>",
+		`<td>a.txt</td><td class="n" data-v="2">2</td>`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML is missing %q", want)
+		}
+	}
+	if strings.Contains(html, "<b>.go") {
+		t.Error("HTML has an unescaped file name")
+	}
+
+	// The treemap's data is the tree of the scan, largest first
+	match := regexp.MustCompile(`const tree = (.*);`).FindStringSubmatch(html)
+	if match == nil {
+		t.Fatal("HTML has no tree")
+	}
+	var tree htmlNode
+	if err := json.Unmarshal([]byte(match[1]), &tree); err != nil {
+		t.Fatalf("tree doesn't parse: %v\n%s", err, match[1])
+	}
+	if tree.Tokens != repo.TokenCount || tree.Files != 3 || len(tree.Children) != 2 || tree.Children[0].Name != "src" || tree.Children[0].Tokens < tree.Children[1].Tokens {
+		t.Errorf("tree %+v", tree)
+	}
+
+	if err := WriteHTML(failingWriter{}, repo, options); err == nil {
+		t.Error("WriteHTML to a failing writer succeeded")
+	}
+}
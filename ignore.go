@@ -0,0 +1,205 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+)
+
+// loadGitIgnore compiles the ignore rules git consults for a repository rooted
+// at rootPath: the user's core.excludesFile, .git/info/exclude and the root
+// .gitignore. Sources are concatenated from lowest to highest precedence so
+// later patterns (including negations) override earlier ones, just like git.
+// It returns nil if none of the sources exist, along with any errors reading
+// sources that do.
+func loadGitIgnore(rootPath string) (*gitignore.GitIgnore, []*FileError) {
+	// An archive scanned with -archives has no ignore files of its own
+	if info, err := os.Stat(rootPath); err == nil && !info.IsDir() {
+		return nil, nil
+	}
+
+	var lines []string
+	var errs []*FileError
+	for _, source := range gitIgnoreSources(rootPath) {
+		if source == "" {
+			continue
+		}
+		data, err := os.ReadFile(source)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				errs = append(errs, &FileError{source, err})
+			}
+			continue
+		}
+		lines = append(lines, strings.Split(string(data), "\n")...)
+	}
+
+	if len(lines) == 0 {
+		return nil, errs
+	}
+	return gitignore.CompileIgnoreLines(lines...), errs
+}
+
+// gitIgnoreSources returns the ignore files loadGitIgnore reads for rootPath,
+// from lowest to highest precedence. Any of them may not exist.
+func gitIgnoreSources(rootPath string) []string {
+	return []string{
+		globalExcludesFile(rootPath),
+		filepath.Join(gitDir(rootPath), "info", "exclude"),
+		filepath.Join(rootPath, ".gitignore"),
+	}
+}
+
+// gitIgnoreSource maps the line number of a rule loadGitIgnore compiled for
+// rootPath back to the ignore file it came from and its line there, or
+// returns an empty path if the files changed since
+func gitIgnoreSource(rootPath string, lineNo int) (string, int) {
+	for _, source := range gitIgnoreSources(rootPath) {
+		if source == "" {
+			continue
+		}
+		data, err := os.ReadFile(source)
+		if err != nil {
+			continue
+		}
+		n := len(strings.Split(string(data), "\n"))
+		if lineNo <= n {
+			return source, lineNo
+		}
+		lineNo -= n
+	}
+	return "", 0
+}
+
+// gitDir returns the git directory for rootPath, following the "gitdir:"
+// indirection used by worktrees and submodules where .git is a file.
+func gitDir(rootPath string) string {
+	dotGit := filepath.Join(rootPath, ".git")
+	info, err := os.Stat(dotGit)
+	if err != nil || info.IsDir() {
+		return dotGit
+	}
+
+	data, err := os.ReadFile(dotGit)
+	if err != nil {
+		return dotGit
+	}
+	dir := strings.TrimSpace(strings.TrimPrefix(string(data), "gitdir:"))
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(rootPath, dir)
+	}
+	return dir
+}
+
+// globalExcludesFile returns the path of the user's global excludes file. It
+// asks git for core.excludesFile and falls back to git's default location,
+// $XDG_CONFIG_HOME/git/ignore (or ~/.config/git/ignore).
+func globalExcludesFile(rootPath string) string {
+	cmd := exec.Command("git", "config", "--path", "--get", "core.excludesFile")
+	cmd.Dir = rootPath
+	if out, err := cmd.Output(); err == nil {
+		if path := strings.TrimSpace(string(out)); path != "" {
+			return path
+		}
+	}
+
+	if xdg := os.Getenv("XDG_CONFIG_HOME"); xdg != "" {
+		return filepath.Join(xdg, "git", "ignore")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "git", "ignore")
+}
+
+// tokenIgnoreFile is the per-directory file listing paths (in gitignore
+// syntax) to exclude from token counting while git keeps tracking them
+const tokenIgnoreFile = ".tokenignore"
+
+// tokenIgnores holds the .tokenignore files found during a scan, keyed by the
+// directory they were loaded from
+type tokenIgnores map[string]*gitignore.GitIgnore
+
+// load compiles the .tokenignore file in dir, if there is one
+func (t tokenIgnores) load(dir string) *FileError {
+	path := filepath.Join(dir, tokenIgnoreFile)
+	if _, err := os.Stat(path); err != nil {
+		return nil
+	}
+
+	ignorer, err := gitignore.CompileIgnoreFile(path)
+	if err != nil {
+		return &FileError{path, err}
+	}
+	t[filepath.Clean(dir)] = ignorer
+	return nil
+}
+
+// matches reports whether path is excluded by a .tokenignore file in any of
+// its parent directories up to rootPath. Patterns are matched relative to the
+// directory containing the .tokenignore, as with nested .gitignore files.
+func (t tokenIgnores) matches(rootPath string, path string) bool {
+	return t.rule(rootPath, path) != ""
+}
+
+// rule returns the .tokenignore file and pattern that exclude path, like
+// docs/.tokenignore: *.svg, or an empty string if none does
+func (t tokenIgnores) rule(rootPath string, path string) string {
+	rootPath = filepath.Clean(rootPath)
+	if len(t) == 0 || filepath.Clean(path) == rootPath {
+		return ""
+	}
+
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		if ignorer, ok := t[dir]; ok {
+			if relPath, err := matchPath(dir, path); err == nil {
+				if ignored, pattern := ignorer.MatchesPathHow(relPath); ignored {
+					return relativeTo(rootPath, filepath.Join(dir, tokenIgnoreFile)) + ": " + ruleLine(pattern.Line)
+				}
+			}
+		}
+		if dir == rootPath || dir == filepath.Dir(dir) {
+			return ""
+		}
+	}
+}
+
+// prunes reports whether the directory at relPath is excluded by -prune,
+// either by its name or by its path relative to the root
+func (o *CommandOptions) prunes(relPath string) bool {
+	relPath = filepath.ToSlash(relPath)
+	name := relPath[strings.LastIndex(relPath, "/")+1:]
+	for _, prune := range o.Prune {
+		prune = strings.Trim(filepath.ToSlash(prune), "/")
+		if prune == name || prune == relPath {
+			return true
+		}
+	}
+	return false
+}
+
+// includes reports whether -include selects the file at path, matching its
+// path relative to the root. Without -include every file is selected.
+func (o *CommandOptions) includes(rootPath string, path string) bool {
+	if o.includer == nil {
+		return true
+	}
+	relPath, err := matchPath(rootPath, path)
+	if err != nil {
+		return false
+	}
+	return o.includer.MatchesPath(relPath)
+}
+
+// depth returns how many directories deep relPath is below the root, where
+// the root's own entries are at depth 1
+func depth(relPath string) int {
+	if relPath == "." || relPath == "" {
+		return 0
+	}
+	return len(strings.Split(filepath.ToSlash(relPath), "/"))
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGitIgnoreSources(t *testing.T) {
+	tests := []struct {
+		name   string
+		global string
+		files  map[string]string
+		args   []string
+		want   []string
+	}{
+		{
+			name:  ".gitignore",
+			files: map[string]string{".gitignore": "*.log\n", "a.txt": "a", "b.log": "b"},
+			want:  []string{"a.txt"},
+		},
+		{
+			name:  ".git/info/exclude",
+			files: map[string]string{".git/info/exclude": "local/\n", "a.txt": "a", "local/b.txt": "b"},
+			want:  []string{"a.txt"},
+		},
+		{
+			name:   "global excludes file",
+			global: "*.bak\n",
+			files:  map[string]string{"a.txt": "a", "a.txt.bak": "b"},
+			want:   []string{"a.txt"},
+		},
+		{
+			name:   ".gitignore overrides the global excludes file",
+			global: "*.log\n",
+			files:  map[string]string{".gitignore": "!keep.log\n", "keep.log": "a", "drop.log": "b"},
+			want:   []string{"keep.log"},
+		},
+		{
+			name:   "-gitignore=false",
+			global: "*.bak\n",
+			files:  map[string]string{".gitignore": "*.log\n", ".git/info/exclude": "*.tmp\n", "a.log": "a", "b.tmp": "b", "c.bak": "c"},
+			args:   []string{"-gitignore=false"},
+			want:   []string{"a.log", "b.tmp", "c.bak"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := t.TempDir()
+			t.Setenv("XDG_CONFIG_HOME", config)
+			if tt.global != "" {
+				writeTree(t, config, map[string]string{"git/ignore": tt.global})
+			}
+			dir := t.TempDir()
+			writeTree(t, dir, tt.files)
+			repo, _ := scanTree(t, dir, append([]string{"-model", "cl100k_base"}, tt.args...)...)
+			if got := countedPaths(dir, repo); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("counted %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadGitIgnoreErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{".gitignore": "*.log\n"})
+	// A source that exists but can't be read is reported, and the others
+	// still apply
+	if err := os.MkdirAll(filepath.Join(dir, ".git", "info", "exclude"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	ignorer, errs := loadGitIgnore(dir)
+	if len(errs) != 1 || errs[0].Path != filepath.Join(dir, ".git", "info", "exclude") {
+		t.Errorf("errors = %v, want the error reading .git/info/exclude", errs)
+	}
+	if ignorer == nil || !ignorer.MatchesPath("a.log") {
+		t.Error(".gitignore isn't applied")
+	}
+
+	if ignorer, errs := loadGitIgnore(t.TempDir()); ignorer != nil || len(errs) != 0 {
+		t.Errorf("loadGitIgnore without ignore files = %v, %v, want nil", ignorer, errs)
+	}
+}
+
+func TestGitDir(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"repo/.git/HEAD": "ref: refs/heads/main\n",
+		"worktree/.git":  "gitdir: ../repo/.git\n",
+		"absolute/.git":  "gitdir: " + filepath.Join(dir, "repo", ".git") + "\n",
+	})
+	tests := []struct {
+		root string
+		want string
+	}{
+		{"repo", filepath.Join(dir, "repo", ".git")},
+		{"worktree", filepath.Join(dir, "repo", ".git")},
+		{"absolute", filepath.Join(dir, "repo", ".git")},
+		{"none", filepath.Join(dir, "none", ".git")},
+	}
+	for _, tt := range tests {
+		if got := gitDir(filepath.Join(dir, tt.root)); got != tt.want {
+			t.Errorf("gitDir(%s) = %s, want %s", tt.root, got, tt.want)
+		}
+	}
+}
+
+func TestTokenIgnore(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		args  []string
+		want  []string
+	}{
+		{
+			name:  "root .tokenignore",
+			files: map[string]string{".tokenignore": "*.snap\nfixtures/\n", "a.go": "a", "a.snap": "b", "fixtures/x.json": "{}"},
+			want:  []string{"a.go"},
+		},
+		{
+			name:  "patterns relative to the .tokenignore's directory",
+			files: map[string]string{"api/.tokenignore": "/generated/\n", "api/generated/x.go": "x", "generated/y.go": "y"},
+			want:  []string{"generated/y.go"},
+		},
+		{
+			name:  "honored with -gitignore=false",
+			files: map[string]string{".tokenignore": "*.snap\n", "a.go": "a", "a.snap": "b"},
+			args:  []string{"-gitignore=false"},
+			want:  []string{"a.go"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, tt.files)
+			repo, _ := scanTree(t, dir, append([]string{"-model", "cl100k_base"}, tt.args...)...)
+			if got := countedPaths(dir, repo); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("counted %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	rules := tokenIgnores{}
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"docs/.tokenignore": "*.svg\n"})
+	if err := rules.load(filepath.Join(dir, "docs")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rules.rule(dir, filepath.Join(dir, "docs", "img", "a.svg")), "docs/.tokenignore: *.svg"; got != want {
+		t.Errorf("rule = %q, want %q", got, want)
+	}
+	if got := rules.rule(dir, filepath.Join(dir, "a.svg")); got != "" {
+		t.Errorf("rule outside docs = %q, want none", got)
+	}
+	if err := rules.load(t.TempDir()); err != nil {
+		t.Errorf("load without a .tokenignore = %v", err)
+	}
+}
+
+func TestDepthAndPrune(t *testing.T) {
+	files := map[string]string{
+		"a.txt":                   "a",
+		"src/b.txt":               "b",
+		"src/deep/c.txt":          "c",
+		"node_modules/x/index.js": "x",
+		"src/node_modules/y.js":   "y",
+		"vendor/lib/z.go":         "z",
+	}
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"no limits", nil, []string{"a.txt", "node_modules/x/index.js", "src/b.txt", "src/deep/c.txt", "src/node_modules/y.js", "vendor/lib/z.go"}},
+		{"max depth 1", []string{"-max-depth", "1"}, []string{"a.txt"}},
+		{"max depth 2", []string{"-max-depth", "2"}, []string{"a.txt", "src/b.txt"}},
+		{"prune by name", []string{"-prune", "node_modules"}, []string{"a.txt", "src/b.txt", "src/deep/c.txt", "vendor/lib/z.go"}},
+		{"prune by path", []string{"-prune", "vendor/lib,src/deep"}, []string{"a.txt", "node_modules/x/index.js", "src/b.txt", "src/node_modules/y.js"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, files)
+			repo, _ := scanTree(t, dir, append([]string{"-model", "cl100k_base"}, tt.args...)...)
+			if got := countedPaths(dir, repo); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("counted %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for relPath, want := range map[string]int{".": 0, "": 0, "a": 1, "a/b/c": 3} {
+		if got := depth(relPath); got != want {
+			t.Errorf("depth(%q) = %d, want %d", relPath, got, want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// imageExts are the image formats whose vision tokens -images estimates
+var imageExts = map[string]bool{".png": true, ".jpg": true, ".jpeg": true, ".gif": true}
+
+// ImageInfo stores the estimated vision token costs of an image, which are
+// reported separately from the text tokens
+type ImageInfo struct {
+	Path         string
+	Width        int
+	Height       int
+	OpenAITokens int // GPT-4o and GPT-4.1 at high detail
+	ClaudeTokens int
+}
+
+// measureImage reads the dimensions of an image from its header and
+// estimates its tokens
+func measureImage(path string) (*ImageInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading image size: %v", err)
+	}
+	return &ImageInfo{
+		Path:         path,
+		Width:        config.Width,
+		Height:       config.Height,
+		OpenAITokens: openAIImageTokens(config.Width, config.Height),
+		ClaudeTokens: claudeImageTokens(config.Width, config.Height),
+	}, nil
+}
+
+// openAIImageTokens estimates an image's tokens with OpenAI's tile formula
+// for high detail: the image is scaled to fit in 2048x2048, then so its
+// shortest side is at most 768 pixels, and costs 170 tokens per 512x512 tile
+// plus 85
+func openAIImageTokens(width int, height int) int {
+	w, h := float64(width), float64(height)
+	if w <= 0 || h <= 0 {
+		return 0
+	}
+	if longest := math.Max(w, h); longest > 2048 {
+		w, h = w*2048/longest, h*2048/longest
+	}
+	if shortest := math.Min(w, h); shortest > 768 {
+		w, h = w*768/shortest, h*768/shortest
+	}
+	tiles := math.Ceil(w/512) * math.Ceil(h/512)
+	return 85 + 170*int(tiles)
+}
+
+// claudeImageTokens estimates an image's tokens with Anthropic's formula of
+// one token per 750 pixels, after the image is scaled so its long edge is at
+// most 1568 pixels and it costs at most about 1,600 tokens
+func claudeImageTokens(width int, height int) int {
+	w, h := float64(width), float64(height)
+	if w <= 0 || h <= 0 {
+		return 0
+	}
+	if longest := math.Max(w, h); longest > 1568 {
+		w, h = w*1568/longest, h*1568/longest
+	}
+	if maxPixels := 1600.0 * 750; w*h > maxPixels {
+		scale := math.Sqrt(maxPixels / (w * h))
+		w, h = w*scale, h*scale
+	}
+	return int(math.Ceil(w * h / 750))
+}
+
+// PrintImages lists the images found by -images with their estimated vision
+// tokens, largest first
+func PrintImages(repo *RepoTokenInfo, options *CommandOptions) {
+	images := append([]*ImageInfo(nil), repo.Images...)
+	sort.Slice(images, func(i, j int) bool {
+		if images[i].OpenAITokens != images[j].OpenAITokens {
+			return images[i].OpenAITokens > images[j].OpenAITokens
+		}
+		return images[i].Path < images[j].Path
+	})
+
+	rootPath := repo.Path
+	if options.IsSingleFile {
+		rootPath = filepath.Dir(repo.Path)
+	}
+
+	header := fmt.Sprintf("Images (%d, estimated vision tokens, not included in the totals above):", len(images))
+	fmt.Println(header)
+	fmt.Println(strings.Repeat("-", len(header)))
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Path\tSize\tGPT-4o\tClaude")
+	openAITotal, claudeTotal := 0, 0
+	for _, img := range images {
+		relativePath := relativeTo(rootPath, img.Path)
+		fmt.Fprintf(w, "%s\t%dx%d\t%s\t%s\n", relativePath, img.Width, img.Height, formatCount(img.OpenAITokens), formatCount(img.ClaudeTokens))
+		openAITotal += img.OpenAITokens
+		claudeTotal += img.ClaudeTokens
+	}
+	fmt.Fprintf(w, "Total\t\t%s\t%s\n", formatCount(openAITotal), formatCount(claudeTotal))
+	w.Flush()
+	fmt.Println()
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pngImage returns an encoded blank PNG of the given size
+func pngImage(t *testing.T, width int, height int) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestImageTokens(t *testing.T) {
+	tests := []struct {
+		width, height int
+		openAI        int
+		claude        int
+	}{
+		{512, 512, 255, 350},
+		{1024, 1024, 765, 1399},
+		{4096, 2048, 1105, 1600},
+		{200, 200, 255, 54},
+		{0, 100, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := openAIImageTokens(tt.width, tt.height); got != tt.openAI {
+			t.Errorf("openAIImageTokens(%d, %d) = %d, want %d", tt.width, tt.height, got, tt.openAI)
+		}
+		if got := claudeImageTokens(tt.width, tt.height); got != tt.claude {
+			t.Errorf("claudeImageTokens(%d, %d) = %d, want %d", tt.width, tt.height, got, tt.claude)
+		}
+	}
+}
+
+func TestScanImages(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"small.png":  pngImage(t, 200, 200),
+		"docs/a.png": pngImage(t, 512, 512),
+		"broken.png": "not a png",
+		"a.txt":      "text",
+	})
+
+	options := testOptions(t, "-model", "cl100k_base")
+	options.Path = dir
+	options.Images = true
+	repo, err := ProcessRepository(t.Context(), dir, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.Images) != 2 || repo.TokenCount != 1 {
+		t.Fatalf("scan found %d images and %d tokens, want 2 images and 1 token", len(repo.Images), repo.TokenCount)
+	}
+	if len(repo.Errors) != 1 || filepath.Base(repo.Errors[0].Path) != "broken.png" || !strings.Contains(repo.Errors[0].Err.Error(), "error reading image size") {
+		t.Errorf("errors %v, want one for broken.png", repo.Errors)
+	}
+
+	out := captureStdout(t, func() { PrintImages(repo, options) })
+	for _, want := range []string{"Images (2, estimated vision tokens", "docs/a.png  512x512  255     350", "Total                510     404"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("images report is missing %q:\n%s", want, out)
+		}
+	}
+
+	if _, err := measureImage(filepath.Join(dir, "missing.png")); !os.IsNotExist(err) {
+		t.Errorf("measureImage of a missing file = %v", err)
+	}
+}
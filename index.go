@@ -0,0 +1,412 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+)
+
+// Index holds the result of a directory scan and keeps it current as files
+// change. Update recounts only the files it is given and adjusts the
+// directory and repository totals by the difference, so editors can call it
+// on every save instead of rescanning. An Index is safe for concurrent use.
+// It applies every scan flag, for the daemon and index commands; other Go
+// programs use counter.Index, which applies a subset of the default rules.
+type Index struct {
+	mu      sync.RWMutex
+	root    string
+	options *CommandOptions
+	encs    []namedCodec
+	ignorer *gitignore.GitIgnore
+	tokenIg tokenIgnores
+	attrs   *gitAttributes // With -skip-attributes
+	repo    *RepoTokenInfo
+	files   map[string]*FileTokenInfo
+
+	watchMu  sync.Mutex
+	watching bool                     // Whether Watch sees every change, once it caught up with those made while it started
+	cookies  map[string]chan struct{} // The syncs waiting for the watcher to see their cookie, by its path
+	syncs    int
+}
+
+// NewIndex scans rootPath and returns an index of the result
+func NewIndex(rootPath string, options *CommandOptions) (*Index, error) {
+	ix := &Index{root: filepath.Clean(rootPath), options: options}
+	if err := ix.Rescan(); err != nil {
+		return nil, err
+	}
+	return ix, nil
+}
+
+// Rescan replaces the index with a full scan of the root
+func (ix *Index) Rescan() error {
+	encs, err := newCodecs(ix.options)
+	if err != nil {
+		return err
+	}
+	repo, err := ProcessRepository(context.Background(), ix.root, ix.options)
+	if err != nil {
+		return err
+	}
+
+	var ignorer *gitignore.GitIgnore
+	if ix.options.RespectGitignore {
+		ignorer, _ = loadGitIgnore(ix.root)
+	}
+
+	files := make(map[string]*FileTokenInfo)
+	for _, dirInfo := range repo.Dirs {
+		for _, fileInfo := range dirInfo.Files {
+			files[fileInfo.Path] = fileInfo
+		}
+	}
+	for _, fileInfo := range repo.BelowMin {
+		files[fileInfo.Path] = fileInfo
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.encs = encs
+	ix.ignorer = ignorer
+	ix.tokenIg = make(tokenIgnores)
+	ix.attrs, _ = newGitAttributes(ix.root, ix.options.SkipAttributes)
+	ix.repo = repo
+	ix.files = files
+	return nil
+}
+
+// Update recounts the given files, which may have been changed, created or
+// deleted since the last scan. Paths are absolute or relative to the current
+// directory and must be inside the root. A directory stands for the files in
+// it now and those indexed under it before, so a directory created, deleted
+// or moved can be given as one path. A change to an ignore file makes the
+// whole root be rescanned, since it can change which files are counted.
+func (ix *Index) Update(paths []string) error {
+	type update struct {
+		path     string
+		info     *FileTokenInfo // nil if the file is no longer counted
+		belowMin bool           // Whether info has fewer tokens than -min
+		err      error
+		now      fileStamp // The file's stamp once it was counted
+	}
+
+	ix.mu.RLock()
+	encs, ignorer := ix.encs, ix.ignorer
+	ix.mu.RUnlock()
+
+	var resolved []string
+	for _, path := range paths {
+		path, err := ix.resolve(path)
+		if err != nil {
+			return err
+		}
+		resolved = append(resolved, ix.expand(path)...)
+	}
+
+	// Count outside the lock, so readers aren't blocked by tokenizing
+	var updates []update
+	for _, path := range resolved {
+
+		switch filepath.Base(path) {
+		case ".gitignore", tokenIgnoreFile, gitAttributesFile:
+			return ix.Rescan()
+		}
+
+		// A file the watcher reports again, such as after the kernel dropped
+		// events, is only recounted if it changed
+		ix.mu.RLock()
+		old := ix.files[path]
+		ix.mu.RUnlock()
+		if old != nil && old.stamp != (fileStamp{}) && old.stamp == statStamp(path) {
+			continue
+		}
+
+		u := update{path: path}
+		if ix.counted(path, ignorer) {
+			u.info, u.err = countFile(path, encs, ix.options)
+			u.belowMin = u.err == nil && ix.options.MinTokens > 0 && u.info.TokenCount < ix.options.MinTokens
+		}
+		u.now = statStamp(path)
+		updates = append(updates, u)
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	for _, u := range updates {
+		// Updates of the same file can overlap. A count the file changed
+		// during loses to a current one another Update stored meanwhile, and
+		// one of a file deleted meanwhile doesn't bring it back.
+		if u.err == nil && u.info != nil && u.info.stamp != u.now {
+			if old, ok := ix.files[u.path]; ok && u.now != (fileStamp{}) && old.stamp == u.now {
+				continue
+			}
+			if u.now == (fileStamp{}) {
+				u.info, u.belowMin = nil, false
+			}
+		}
+		if old, ok := ix.files[u.path]; ok {
+			if !ix.repo.removeBelowMin(old, !ix.options.FilterAffectsTotals) {
+				ix.repo.removeFile(old)
+			}
+			delete(ix.files, u.path)
+		}
+		ix.repo.removeErrors(u.path)
+
+		if u.err != nil {
+			ix.repo.Errors = append(ix.repo.Errors, &FileError{u.path, u.err})
+			continue
+		}
+		switch {
+		case u.belowMin:
+			ix.repo.addBelowMin(u.info, !ix.options.FilterAffectsTotals)
+			ix.files[u.path] = u.info
+		case u.info != nil:
+			ix.repo.addFile(u.info)
+			ix.files[u.path] = u.info
+		}
+	}
+	return nil
+}
+
+// expand returns the files a resolved path stands for: the path itself, or
+// for a directory, the files under it now and in the index
+func (ix *Index) expand(path string) []string {
+	paths := []string{path}
+	prefix := path + string(filepath.Separator)
+	ix.mu.RLock()
+	for indexed := range ix.files {
+		if strings.HasPrefix(indexed, prefix) {
+			paths = append(paths, indexed)
+		}
+	}
+	ix.mu.RUnlock()
+
+	if info, err := os.Lstat(path); err != nil || !info.IsDir() {
+		return paths
+	}
+	filepath.WalkDir(path, func(file string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			if rel, _ := filepath.Rel(ix.root, file); file != path && ix.options.prunes(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		paths = append(paths, file)
+		return nil
+	})
+	return paths
+}
+
+// resolve maps path to the form the scan recorded it in, under the root
+func (ix *Index) resolve(path string) (string, error) {
+	absRoot, err := filepath.Abs(ix.root)
+	if err != nil {
+		return "", err
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absRoot, absPath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside %s", path, ix.root)
+	}
+	return filepath.Join(ix.root, rel), nil
+}
+
+// counted reports whether a scan would count path, applying the same rules
+// as ProcessRepository to the file and each of its parent directories
+func (ix *Index) counted(path string, ignorer *gitignore.GitIgnore) bool {
+	info, err := os.Lstat(path)
+	if err != nil || info.IsDir() {
+		return false
+	}
+	// A symlinked file is counted with or without -follow-symlinks
+	if info.Mode()&os.ModeSymlink != 0 {
+		if info, err = os.Stat(path); err != nil || info.IsDir() {
+			return false
+		}
+	}
+
+	rel, err := filepath.Rel(ix.root, path)
+	if err != nil || !ix.options.includes(ix.root, path) {
+		return false
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	if ix.options.MaxDepth > 0 && len(parts)-1 >= ix.options.MaxDepth {
+		return false
+	}
+	for i := range parts {
+		if i < len(parts)-1 && ix.options.prunes(filepath.Join(parts[:i+1]...)) {
+			return false
+		}
+		if ix.options.IgnoreHidden && strings.HasPrefix(parts[i], ".") {
+			return false
+		}
+		if ignorer != nil && ignorer.MatchesPath(strings.Join(parts[:i+1], "/")) {
+			return false
+		}
+		if !ix.options.Submodules && i < len(parts)-1 && isSubmodule(filepath.Join(ix.root, filepath.Join(parts[:i+1]...))) {
+			return false
+		}
+	}
+
+	// .tokenignore files in directories created since the scan aren't known
+	// yet, so load every parent's before matching
+	ix.mu.Lock()
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		ix.tokenIg.load(dir)
+		ix.attrs.load(dir)
+		if dir == ix.root || dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	excluded := ix.tokenIg.matches(ix.root, path) || ix.attrs.rule(ix.root, path) != ""
+	ix.mu.Unlock()
+	if excluded {
+		return false
+	}
+
+	ext := strings.ToLower(filepath.Ext(path))
+	if ix.options.skipsExtension(ext) || ix.options.tooLarge(info) {
+		return false
+	}
+	head, _, binary, err := sniffHead(path)
+	if err != nil {
+		return true
+	}
+	return (!binary || ix.options.countsAsText(ext)) && !(ix.options.ExcludeGenerated && generatedReason(path, head) != "")
+}
+
+// Match returns the counts of the indexed files whose root-relative paths
+// match any of the gitignore-style patterns, e.g. src/** or *.go
+func (ix *Index) Match(patterns []string) []FileTokenInfo {
+	matcher := gitignore.CompileIgnoreLines(patterns...)
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	var files []FileTokenInfo
+	for path, fileInfo := range ix.files {
+		if matcher.MatchesPath(relativeTo(ix.root, path)) {
+			files = append(files, *fileInfo)
+		}
+	}
+	return files
+}
+
+// TokenCount returns the total count for the root
+func (ix *Index) TokenCount() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.repo.TokenCount
+}
+
+// File returns the counts for a file, if it's in the index
+func (ix *Index) File(path string) (FileTokenInfo, bool) {
+	path, err := ix.resolve(path)
+	if err != nil {
+		return FileTokenInfo{}, false
+	}
+
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	fileInfo, ok := ix.files[path]
+	if !ok {
+		return FileTokenInfo{}, false
+	}
+	return *fileInfo, true
+}
+
+// Snapshot returns a copy of the current scan result that later updates
+// won't modify, for printing or inspection
+func (ix *Index) Snapshot() *RepoTokenInfo {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	repo := *ix.repo
+	repo.Dirs = make(map[string]*DirTokenInfo, len(ix.repo.Dirs))
+	for dirPath, dirInfo := range ix.repo.Dirs {
+		dir := *dirInfo
+		dir.Files = append([]*FileTokenInfo(nil), dirInfo.Files...)
+		dir.ModelCounts = addModelCounts(nil, dirInfo.ModelCounts)
+		repo.Dirs[dirPath] = &dir
+	}
+	repo.ModelCounts = addModelCounts(nil, ix.repo.ModelCounts)
+	repo.Errors = append([]*FileError(nil), ix.repo.Errors...)
+	repo.SkippedSymlinks = append([]*SymlinkInfo(nil), ix.repo.SkippedSymlinks...)
+	repo.Duplicates = append([]*DuplicateFile(nil), ix.repo.Duplicates...)
+	return &repo
+}
+
+// removeFile takes a counted file out of its directory and the repository
+// totals, dropping the directory once it's empty
+func (repo *RepoTokenInfo) removeFile(fileInfo *FileTokenInfo) {
+	dirPath := filepath.Dir(fileInfo.Path)
+	dirInfo, ok := repo.Dirs[dirPath]
+	if !ok {
+		return
+	}
+
+	for i, f := range dirInfo.Files {
+		if f == fileInfo {
+			dirInfo.Files = append(dirInfo.Files[:i], dirInfo.Files[i+1:]...)
+			break
+		}
+	}
+	dirInfo.TokenCount -= fileInfo.TokenCount
+	dirInfo.ModelCounts = subModelCounts(dirInfo.ModelCounts, fileInfo.ModelCounts)
+	dirInfo.StrippedTokenCount -= fileInfo.StrippedTokenCount
+	if len(dirInfo.Files) == 0 {
+		delete(repo.Dirs, dirPath)
+	}
+
+	repo.TokenCount -= fileInfo.TokenCount
+	repo.ModelCounts = subModelCounts(repo.ModelCounts, fileInfo.ModelCounts)
+	repo.StrippedTokenCount -= fileInfo.StrippedTokenCount
+	repo.SegmentCounts = subModelCounts(repo.SegmentCounts, fileInfo.Segments)
+}
+
+// removeBelowMin undoes addBelowMin, returning false if fileInfo isn't one
+// of the files below -min
+func (repo *RepoTokenInfo) removeBelowMin(fileInfo *FileTokenInfo, countTotal bool) bool {
+	for i, f := range repo.BelowMin {
+		if f != fileInfo {
+			continue
+		}
+		repo.BelowMin = append(repo.BelowMin[:i], repo.BelowMin[i+1:]...)
+		if countTotal {
+			repo.TokenCount -= fileInfo.TokenCount
+			repo.ModelCounts = subModelCounts(repo.ModelCounts, fileInfo.ModelCounts)
+			repo.StrippedTokenCount -= fileInfo.StrippedTokenCount
+			repo.SegmentCounts = subModelCounts(repo.SegmentCounts, fileInfo.Segments)
+		}
+		return true
+	}
+	return false
+}
+
+// removeErrors drops any errors recorded for path
+func (repo *RepoTokenInfo) removeErrors(path string) {
+	errs := repo.Errors[:0]
+	for _, fileErr := range repo.Errors {
+		if fileErr.Path != path {
+			errs = append(errs, fileErr)
+		}
+	}
+	repo.Errors = errs
+}
+
+// subModelCounts subtracts the per-model counts in src from dst
+func subModelCounts(dst map[string]int, src map[string]int) map[string]int {
+	for model, count := range src {
+		dst[model] -= count
+	}
+	return dst
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// indexedPaths returns the paths of a snapshot's files, relative to root
+func indexedPaths(root string, ix *Index) []string {
+	return countedPaths(root, ix.Snapshot())
+}
+
+func TestIndexUpdate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, dir string)
+		paths  []string
+	}{
+		{"modified file", func(t *testing.T, dir string) {
+			writeTree(t, dir, map[string]string{"a.txt": "one two three four five"})
+		}, []string{"a.txt"}},
+		{"created file", func(t *testing.T, dir string) {
+			writeTree(t, dir, map[string]string{"src/new.go": "package src"})
+		}, []string{"src/new.go"}},
+		{"deleted file", func(t *testing.T, dir string) {
+			os.Remove(filepath.Join(dir, "src", "b.go"))
+		}, []string{"src/b.go"}},
+		{"deleted directory", func(t *testing.T, dir string) {
+			os.RemoveAll(filepath.Join(dir, "src"))
+		}, []string{"src"}},
+		{"ignored file", func(t *testing.T, dir string) {
+			writeTree(t, dir, map[string]string{"debug.log": "ignored"})
+		}, []string{"debug.log"}},
+		{"changed .gitignore", func(t *testing.T, dir string) {
+			writeTree(t, dir, map[string]string{".gitignore": "*.log\nsrc/\n"})
+		}, []string{".gitignore"}},
+		{"created .tokenignore", func(t *testing.T, dir string) {
+			writeTree(t, dir, map[string]string{"src/.tokenignore": "b.go\n"})
+		}, []string{"src/.tokenignore"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, map[string]string{".gitignore": "*.log\n", "a.txt": "hello world", "src/b.go": "package src", "src/c.go": "package src // c"})
+			ix, err := NewIndex(dir, testOptions(t, "-model", "cl100k_base"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.change(t, dir)
+			var paths []string
+			for _, p := range tt.paths {
+				paths = append(paths, filepath.Join(dir, filepath.FromSlash(p)))
+			}
+			if err := ix.Update(paths); err != nil {
+				t.Fatal(err)
+			}
+
+			// An update leaves the index as a fresh scan would
+			fresh, _ := scanTree(t, dir, "-model", "cl100k_base")
+			if got, want := indexedPaths(dir, ix), countedPaths(dir, fresh); !reflect.DeepEqual(got, want) {
+				t.Errorf("indexed %v, want %v", got, want)
+			}
+			if got, want := ix.TokenCount(), fresh.TokenCount; got != want {
+				t.Errorf("TokenCount() = %d, want %d", got, want)
+			}
+			for dirPath, dirInfo := range fresh.Dirs {
+				if got := ix.Snapshot().Dirs[dirPath]; got == nil || got.TokenCount != dirInfo.TokenCount {
+					t.Errorf("directory %s = %+v, want %d tokens", dirPath, got, dirInfo.TokenCount)
+				}
+			}
+		})
+	}
+}
+
+func TestIndexQueries(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world", "src/b.go": "package src", "src/c.go": "package src"})
+	ix, err := NewIndex(dir, testOptions(t, "-model", "cl100k_base"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if file, ok := ix.File(filepath.Join(dir, "a.txt")); !ok || file.TokenCount != 2 {
+		t.Errorf("File(a.txt) = %+v, %v, want 2 tokens", file, ok)
+	}
+	if _, ok := ix.File(filepath.Join(dir, "missing.txt")); ok {
+		t.Error("File of a file that isn't indexed succeeded")
+	}
+
+	var matched []string
+	for _, file := range ix.Match([]string{"src/*.go"}) {
+		matched = append(matched, relativeTo(dir, file.Path))
+	}
+	sort.Strings(matched)
+	if !reflect.DeepEqual(matched, []string{"src/b.go", "src/c.go"}) {
+		t.Errorf("Match(src/*.go) = %v", matched)
+	}
+
+	// Later updates don't change a snapshot
+	snapshot := ix.Snapshot()
+	writeTree(t, dir, map[string]string{"a.txt": "many more words than there were before"})
+	if err := ix.Update([]string{filepath.Join(dir, "a.txt")}); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.TokenCount == ix.TokenCount() || snapshot.Dirs[dir].TokenCount != 2 {
+		t.Errorf("snapshot changed with the update: %d tokens, %d in the root", snapshot.TokenCount, snapshot.Dirs[dir].TokenCount)
+	}
+}
+
+func TestIndexErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello"})
+	ix, err := NewIndex(dir, testOptions(t, "-model", "cl100k_base"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Update([]string{filepath.Join(dir, "..", "elsewhere.txt")}); err == nil {
+		t.Error("Update of a path outside the root succeeded")
+	}
+	if _, err := NewIndex(filepath.Join(dir, "missing"), testOptions(t, "-model", "cl100k_base")); err == nil {
+		t.Error("NewIndex of a missing directory succeeded")
+	}
+	if _, err := NewIndex(dir, testOptions(t, "-model", "no-such-model")); err == nil {
+		t.Error("NewIndex with an unknown model succeeded")
+	}
+}
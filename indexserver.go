@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// indexFormats are the values accepted by index's -format
+var indexFormats = map[string]bool{"text": true, "json": true}
+
+// indexServer answers queries about a directory from an Index that a
+// watcher keeps current, so they never wait for a scan
+type indexServer struct {
+	ix      *Index
+	options *CommandOptions
+	started time.Time
+	stop    context.CancelFunc
+
+	mu      sync.Mutex
+	updated time.Time // When a change was last applied
+}
+
+// IndexQuery is the answer to index query: the files matching the patterns
+type IndexQuery struct {
+	Root     string         `json:"root"`
+	Model    string         `json:"model"`
+	Unit     string         `json:"unit"`
+	Patterns []string       `json:"patterns"`
+	Total    int            `json:"total"`
+	Files    int            `json:"files"`
+	Largest  []mcpFileCount `json:"largest"`
+	Updated  time.Time      `json:"updated"`
+}
+
+// IndexStatus is the answer to index status
+type IndexStatus struct {
+	Root    string    `json:"root"`
+	Model   string    `json:"model"`
+	Unit    string    `json:"unit"`
+	Total   int       `json:"total"`
+	Files   int       `json:"files"`
+	Errors  int       `json:"errors"`
+	PID     int       `json:"pid"`
+	Started time.Time `json:"started"`
+	Updated time.Time `json:"updated"`
+}
+
+// IndexFiles is the answer to the files method, which scan -cached asks:
+// every indexed file with the stamp it was counted at, and whether the index
+// was current when it answered
+type IndexFiles struct {
+	Root     string         `json:"root"`
+	Settings string         `json:"settings"` // Key of the settings the files were counted with
+	Scan     string         `json:"scan"`     // Key of those and the settings that select the files
+	Fresh    bool           `json:"fresh"`    // Whether the index had applied every change made before the request
+	Files    []*cachedFile  `json:"files"`
+	BelowMin []*cachedFile  `json:"below_min,omitempty"`
+	Errors   []*cachedError `json:"errors,omitempty"`
+}
+
+// indexParams holds the params of every index method
+type indexParams struct {
+	Patterns []string `json:"patterns"`
+	Limit    int      `json:"limit"`
+	Sync     bool     `json:"sync,omitempty"` // With files, wait for the index to be current
+}
+
+// indexCommand defines the index subcommand. index start scans a directory,
+// keeps the result current by watching it for changes and serves it on a
+// unix socket; index query, status and stop talk to the index of the current
+// directory, or of the nearest parent that has one.
+func indexCommand(fs *flag.FlagSet) func() {
+	options := &CommandOptions{}
+	var socket, format string
+	var top int
+
+	registerFlags(fs, options)
+	registerWalkFlags(fs, options)
+	fs.StringVar(&socket, "socket", "", "Unix socket of the index (default one in the temporary directory named after the root)")
+	fs.IntVar(&top, "top", 10, "With query, the number of largest matching files to list")
+	fs.StringVar(&format, "format", "text", "Output format of query and status: text or json")
+	return func() {
+		// The action comes first, so parse the flags that follow it too
+		action := fs.Arg(0)
+		switch action {
+		case "start", "query", "status", "stop":
+		default:
+			fmt.Fprintln(os.Stderr, "Error: expected index start, index query, index status or index stop")
+			fs.Usage()
+			exit(2)
+		}
+		fs.Parse(fs.Args()[1:])
+		if !indexFormats[format] {
+			fmt.Fprintf(os.Stderr, "Error: unknown format %q (expected text or json)\n", format)
+			exit(1)
+		}
+
+		if action == "start" {
+			startIndex(fs, options, socket)
+			return
+		}
+
+		// The directory can be given as the first argument, as with start; for
+		// query, only if it's written as a path, so it isn't taken for a pattern
+		args := fs.Args()
+		dir := options.Path
+		if len(args) > 0 && (action != "query" || isDirArgument(args[0])) {
+			if dir != "" {
+				fmt.Fprintln(os.Stderr, "Error: the directory was given both with -path and as an argument")
+				exit(1)
+			}
+			dir, args = args[0], args[1:]
+		}
+		if action != "query" && len(args) > 0 {
+			fmt.Fprintf(os.Stderr, "Error: index %s takes at most one directory\n", action)
+			exit(1)
+		}
+		if dir == "" {
+			dir = "."
+		}
+		if socket == "" {
+			var err error
+			if socket, err = findIndexSocket(dir); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+		}
+		var params indexParams
+		if action == "query" {
+			if len(args) == 0 {
+				fmt.Fprintln(os.Stderr, "Error: index query needs one or more patterns, e.g. src/**")
+				exit(1)
+			}
+			params = indexParams{Patterns: args, Limit: top}
+		}
+		result, err := callIndex(socket, action, params)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		switch {
+		case action == "stop":
+			if !options.Quiet {
+				fmt.Fprintln(os.Stderr, "Stopped the index")
+			}
+		case format == "json":
+			var indented bytes.Buffer
+			json.Indent(&indented, result, "", "  ")
+			fmt.Println(indented.String())
+		case action == "query":
+			var query IndexQuery
+			if err := json.Unmarshal(result, &query); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+			printIndexQuery(&query, options)
+		default:
+			var status IndexStatus
+			if err := json.Unmarshal(result, &status); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+			printIndexStatus(&status, options)
+		}
+	}
+}
+
+// startIndex scans the target directory and serves its index until it's
+// stopped, by index stop or a signal
+func startIndex(fs *flag.FlagSet, options *CommandOptions, socket string) {
+	if err := resolveTarget(fs, options); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+	if options.IsSingleFile {
+		fmt.Fprintln(os.Stderr, "Error: index needs a directory to scan")
+		exit(1)
+	}
+	root, err := filepath.Abs(options.Path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+	if socket == "" {
+		socket = indexSocket(root)
+	}
+
+	// A socket left behind by an index that was killed would make Listen fail
+	if info, err := os.Lstat(socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", socket); err == nil {
+			conn.Close()
+			fmt.Fprintf(os.Stderr, "Error: an index is already listening on %s\n", socket)
+			exit(1)
+		}
+		os.Remove(socket)
+	}
+
+	if !options.Quiet {
+		fmt.Fprintf(os.Stderr, "Indexing directory: %s\n", root)
+	}
+	ix, err := NewIndex(root, options)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error processing %s: %v\n", root, err)
+		exit(1)
+	}
+	PrintErrors(ix.Snapshot())
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		exit(1)
+	}
+	// Closing the listener removes the socket
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	server := &indexServer{ix: ix, options: options, started: now, updated: now, stop: stop}
+	go func() {
+		err := ix.Watch(ctx, func(paths []string, err error) {
+			if err != nil {
+				logger.Warn("updating the index", "error", err)
+			}
+			logger.Debug("updated the index", "paths", len(paths), "total", ix.TokenCount())
+			server.mu.Lock()
+			server.updated = time.Now().UTC().Truncate(time.Second)
+			server.mu.Unlock()
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error watching %s: %v\n", root, err)
+			exit(1)
+		}
+	}()
+
+	logger.Info("serving the index", "root", root, "socket", socket, "total", ix.TokenCount())
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		go func() {
+			defer conn.Close()
+			if err := serveRPC(conn, json.NewEncoder(conn), server.handle); err != nil {
+				logger.Debug("connection closed", "err", err)
+			}
+		}()
+	}
+}
+
+// handle dispatches a request to its method
+func (s *indexServer) handle(req *rpcRequest) (interface{}, *rpcError) {
+	var params indexParams
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{rpcInvalidParams, err.Error()}
+		}
+	}
+
+	s.mu.Lock()
+	updated := s.updated
+	s.mu.Unlock()
+	switch req.Method {
+	case "query":
+		if len(params.Patterns) == 0 {
+			return nil, &rpcError{rpcInvalidParams, "patterns are required"}
+		}
+		return s.query(&params, updated), nil
+	case "status":
+		repo := s.ix.Snapshot()
+		files := len(repo.BelowMin)
+		for _, dirInfo := range repo.Dirs {
+			files += len(dirInfo.Files)
+		}
+		return &IndexStatus{
+			Root:    s.ix.root,
+			Model:   s.options.modelName(),
+			Unit:    s.options.unitName(),
+			Total:   repo.TokenCount,
+			Files:   files,
+			Errors:  len(repo.Errors),
+			PID:     os.Getpid(),
+			Started: s.started,
+			Updated: updated,
+		}, nil
+	case "files":
+		return s.files(params.Sync), nil
+	case "stop":
+		// Answer before the listener closes
+		time.AfterFunc(100*time.Millisecond, s.stop)
+		return map[string]interface{}{}, nil
+	}
+	if len(req.ID) == 0 {
+		return nil, nil
+	}
+	return nil, &rpcError{rpcMethodNotFound, fmt.Sprintf("method not found: %s", req.Method)}
+}
+
+// query totals the indexed files matching the patterns and lists the largest
+func (s *indexServer) query(params *indexParams, updated time.Time) *IndexQuery {
+	query := &IndexQuery{
+		Root:     s.ix.root,
+		Model:    s.options.modelName(),
+		Unit:     s.options.unitName(),
+		Patterns: params.Patterns,
+		Largest:  []mcpFileCount{},
+		Updated:  updated,
+	}
+	files := s.ix.Match(params.Patterns)
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].TokenCount != files[j].TokenCount {
+			return files[i].TokenCount > files[j].TokenCount
+		}
+		return files[i].Path < files[j].Path
+	})
+	for i, fileInfo := range files {
+		query.Total += fileInfo.TokenCount
+		if i < params.Limit {
+			query.Largest = append(query.Largest, mcpFileCount{relativeTo(s.ix.root, fileInfo.Path), fileInfo.TokenCount, fileInfo.Bytes, fileInfo.Lines})
+		}
+	}
+	query.Files = len(files)
+	return query
+}
+
+// files lists the indexed files for scan -cached, after waiting for the
+// watcher to apply every change made until now if sync is set. An index that
+// can't sync answers anyway, as not fresh, so the scan checks the stamps.
+func (s *indexServer) files(sync bool) *IndexFiles {
+	answer := &IndexFiles{
+		Root:     s.ix.root,
+		Settings: countSettings(s.options),
+		Scan:     scanSettings(s.options),
+		Files:    []*cachedFile{},
+	}
+	if sync {
+		ctx, cancel := context.WithTimeout(context.Background(), indexSyncTimeout)
+		err := s.ix.Sync(ctx)
+		cancel()
+		if err != nil {
+			logger.Debug("answering without syncing", "err", err)
+		}
+		answer.Fresh = err == nil
+	}
+
+	repo := s.ix.Snapshot()
+	for _, dirInfo := range repo.Dirs {
+		for _, fileInfo := range dirInfo.Files {
+			answer.Files = append(answer.Files, newCachedFile(s.ix.root, fileInfo))
+		}
+	}
+	for _, fileInfo := range repo.BelowMin {
+		answer.BelowMin = append(answer.BelowMin, newCachedFile(s.ix.root, fileInfo))
+	}
+	for _, fileErr := range repo.Errors {
+		answer.Errors = append(answer.Errors, &cachedError{relativeTo(s.ix.root, fileErr.Path), fileErr.Err.Error()})
+	}
+	return answer
+}
+
+// indexSyncTimeout is how long the files method waits for the watcher to
+// see its cookie. Polling watchers take up to watchPoll.
+const indexSyncTimeout = watchPoll + 3*time.Second
+
+// indexSocket returns the default socket of the index of root, named after
+// it so index query can find it from the directory alone
+func indexSocket(root string) string {
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(os.TempDir(), fmt.Sprintf("token-counter-%x.sock", sum[:8]))
+}
+
+// findIndexSocket returns the socket of the index of dir, or of the nearest
+// parent of it that has one
+func findIndexSocket(dir string) (string, error) {
+	dir, err := filepath.Abs(normalizePath(dir))
+	if err != nil {
+		return "", err
+	}
+	for candidate := dir; ; candidate = filepath.Dir(candidate) {
+		socket := indexSocket(candidate)
+		if info, err := os.Stat(socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+			return socket, nil
+		}
+		if candidate == filepath.Dir(candidate) {
+			break
+		}
+	}
+	return "", fmt.Errorf("no index is running for %s; start one with token-counter index start", dir)
+}
+
+// callIndex sends a request to the index listening on socket and returns the
+// result
+func callIndex(socket string, method string, params indexParams) (json.RawMessage, error) {
+	conn, err := net.DialTimeout("unix", socket, 5*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("no index is listening on %s: %v", socket, err)
+	}
+	defer conn.Close()
+
+	request, err := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": 1, "method": method, "params": params})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write(append(request, '\n')); err != nil {
+		return nil, err
+	}
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		return nil, fmt.Errorf("reading the answer of the index: %v", err)
+	}
+	if response.Error != nil {
+		return nil, errors.New(response.Error.Message)
+	}
+	return response.Result, nil
+}
+
+// isDirArgument reports whether an argument of index query is a directory
+// written as a path, like ., ../app, ./src or an absolute path, rather than
+// a pattern relative to the indexed root
+func isDirArgument(arg string) bool {
+	path := filepath.ToSlash(arg)
+	if path != "." && path != ".." && !strings.HasPrefix(path, "./") && !strings.HasPrefix(path, "../") && !filepath.IsAbs(arg) {
+		return false
+	}
+	info, err := os.Stat(arg)
+	return err == nil && info.IsDir()
+}
+
+// printIndexQuery prints the total of the files matching a query and the
+// largest of them
+func printIndexQuery(query *IndexQuery, options *CommandOptions) {
+	if options.Quiet {
+		fmt.Println(query.Total)
+		return
+	}
+	unit := options.unitName()
+	fmt.Println(options.paint(ansiBold, fmt.Sprintf("Total %s matching %s: %s in %s files", unit, strings.Join(query.Patterns, ", "), formatCount(query.Total), formatCount(query.Files))))
+	if len(query.Largest) == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Println("Largest files:")
+	for _, file := range query.Largest {
+		fmt.Println(options.paint(shareColor(file.Tokens, query.Total), fmt.Sprintf("  %s: %s %s (%.1f%%)", file.Path, formatCount(file.Tokens), unit, percentOf(file.Tokens, query.Total))))
+	}
+}
+
+// printIndexStatus prints what an index holds and when it last changed
+func printIndexStatus(status *IndexStatus, options *CommandOptions) {
+	if options.Quiet {
+		fmt.Println(status.Total)
+		return
+	}
+	fmt.Println(options.paint(ansiBold, "Index of "+status.Root))
+	fmt.Printf("Total %s: %s in %s files (%s)\n", status.Unit, formatCount(status.Total), formatCount(status.Files), status.Model)
+	fmt.Printf("Started: %s (pid %d)\n", status.Started.Local().Format(time.DateTime), status.PID)
+	fmt.Printf("Updated: %s\n", status.Updated.Local().Format(time.DateTime))
+	if status.Errors > 0 {
+		fmt.Printf("Errors: %d files could not be counted\n", status.Errors)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIndexServer(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world", "src/b.go": "one two three", "src/c.go": "four"})
+	options := testOptions(t, "-model", "cl100k_base")
+	ix, err := NewIndex(dir, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &indexServer{ix: ix, options: options}
+	tests := []struct {
+		name    string
+		method  string
+		params  string
+		want    string // In the JSON of the result, or the error message
+		wantErr int
+	}{
+		{"query", "query", `{"patterns":["src/**"],"limit":1}`, `"total":4,"files":2,"largest":[{"path":"src/b.go","tokens":3`, 0},
+		{"no match", "query", `{"patterns":["*.md"]}`, `"total":0,"files":0,"largest":[]`, 0},
+		{"status", "status", "", `"total":6,"files":3,"errors":0`, 0},
+		{"files", "files", "", `"fresh":false,"files":[`, 0},
+		{"no patterns", "query", `{}`, "patterns are required", rpcInvalidParams},
+		{"invalid params", "query", `[1]`, "cannot unmarshal", rpcInvalidParams},
+		{"unknown method", "scan", "", "method not found: scan", rpcMethodNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, rpcErr := server.handle(&rpcRequest{ID: json.RawMessage("1"), Method: tt.method, Params: json.RawMessage(tt.params)})
+			if tt.wantErr != 0 {
+				if rpcErr == nil || rpcErr.Code != tt.wantErr || !strings.Contains(rpcErr.Message, tt.want) {
+					t.Errorf("handle error %+v, want %d %q", rpcErr, tt.wantErr, tt.want)
+				}
+				return
+			}
+			if rpcErr != nil {
+				t.Fatal(rpcErr.Message)
+			}
+			if got := mustJSON(t, result); !strings.Contains(got, tt.want) {
+				t.Errorf("handle = %s, want it to contain %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexCommand(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world", "src/b.go": "one two three"})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		findCommand("index").run([]string{"start", "-quiet", "-model", "cl100k_base", dir})
+	}()
+	socket := indexSocket(dir)
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := callIndex(socket, "status", indexParams{}); err == nil {
+			break
+		}
+		if time.Since(start) > 10*time.Second {
+			t.Fatal("the index didn't start")
+		}
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"query", []string{"query", filepath.Join(dir, "src"), "src/**"}, "Total tokens matching src/**: 3 in 1 files\n\nLargest files:\n  src/b.go: 3 tokens (100.0%)\n"},
+		{"json query", []string{"query", "-format", "json", dir, "*.txt"}, `"total": 2`},
+		{"status", []string{"status", dir}, "Total tokens: 5 in 2 files (cl100k_base)"},
+		{"quiet status", []string{"status", "-quiet", filepath.Join(dir, "src")}, "5\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := captureStdout(t, func() { findCommand("index").run(tt.args) })
+			if !strings.Contains(out, tt.want) {
+				t.Errorf("index %s printed\n%s\nwant %q", strings.Join(tt.args, " "), out, tt.want)
+			}
+		})
+	}
+
+	findCommand("index").run([]string{"stop", "-quiet", dir})
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("index stop didn't stop the index")
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("the socket is left after stopping: %v", err)
+	}
+}
+
+func TestIndexCommandErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		args []string
+		code int
+		want string
+	}{
+		{"no action", []string{}, 2, "Error: expected index start, index query, index status or index stop"},
+		{"format", []string{"status", "-format", "xml"}, 1, `Error: unknown format "xml" (expected text or json)`},
+		{"not running", []string{"status", dir}, 1, "no index is running for"},
+		{"no patterns", []string{"query", "-socket", filepath.Join(dir, "index.sock")}, 1, "Error: index query needs one or more patterns, e.g. src/**"},
+		{"two directories", []string{"status", dir, dir}, 1, "Error: index status takes at most one directory"},
+		{"no listener", []string{"status", "-socket", filepath.Join(dir, "index.sock")}, 1, "no index is listening on"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderr, code := exitStatus(t, func() { findCommand("index").run(tt.args) })
+			if code != tt.code || !strings.Contains(stderr, tt.want) {
+				t.Errorf("exit %d, stderr:\n%s\nwant exit %d with %q", code, stderr, tt.code, tt.want)
+			}
+		})
+	}
+}
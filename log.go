@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// logLevel is the minimum level logged to stderr, set with -log-level
+var logLevel = new(slog.LevelVar)
+
+// logger writes diagnostics to stderr, leaving stdout to the reports
+var logger = slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel}))
+
+// parseLogLevel sets the level from the value of -log-level
+func parseLogLevel(value string) error {
+	switch strings.ToLower(value) {
+	case "debug":
+		logLevel.Set(slog.LevelDebug)
+	case "info":
+		logLevel.Set(slog.LevelInfo)
+	case "warn":
+		logLevel.Set(slog.LevelWarn)
+	case "error":
+		logLevel.Set(slog.LevelError)
+	default:
+		return fmt.Errorf("unknown log level %q (expected debug, info, warn or error)", value)
+	}
+	return nil
+}
+
+// parseLogFormat switches the logger to the format given to -log-format
+func parseLogFormat(value string) error {
+	handlerOptions := &slog.HandlerOptions{Level: logLevel}
+	switch value {
+	case "text":
+		logger = slog.New(slog.NewTextHandler(os.Stderr, handlerOptions))
+	case "json":
+		logger = slog.New(slog.NewJSONHandler(os.Stderr, handlerOptions))
+	default:
+		return fmt.Errorf("unknown log format %q (expected text or json)", value)
+	}
+	return nil
+}
+
+// logSkip records why a file or directory was left out of the counts, with
+// a reason like gitignore and a detail like the rule that matched. Every
+// skip decision goes through here, so -log-level debug explains them all and
+// OnSkip sees them all.
+func logSkip(options *CommandOptions, path string, dir bool, reason string, detail string) {
+	if detail == "" {
+		logger.Debug("skipped", "path", path, "reason", reason)
+	} else {
+		logger.Debug("skipped", "path", path, "reason", reason, "detail", detail)
+	}
+	if options.OnSkip != nil {
+		options.OnSkip(&SkippedFile{Path: path, Directory: dir, Reason: reason, Detail: detail})
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseLogLevel(t *testing.T) {
+	defer logLevel.Set(logLevel.Level())
+	tests := []struct {
+		value string
+		want  slog.Level
+		err   bool
+	}{
+		{"debug", slog.LevelDebug, false},
+		{"INFO", slog.LevelInfo, false},
+		{"warn", slog.LevelWarn, false},
+		{"error", slog.LevelError, false},
+		{"verbose", 0, true},
+	}
+	for _, tt := range tests {
+		err := parseLogLevel(tt.value)
+		if (err != nil) != tt.err {
+			t.Errorf("parseLogLevel(%q) error = %v, want error %v", tt.value, err, tt.err)
+			continue
+		}
+		if err == nil && logLevel.Level() != tt.want {
+			t.Errorf("parseLogLevel(%q) set %v, want %v", tt.value, logLevel.Level(), tt.want)
+		}
+	}
+}
+
+func TestParseLogFormat(t *testing.T) {
+	defer func(l *slog.Logger) { logger = l }(logger)
+	for _, value := range []string{"text", "json"} {
+		if err := parseLogFormat(value); err != nil {
+			t.Errorf("parseLogFormat(%q) = %v", value, err)
+		}
+	}
+	if err := parseLogFormat("xml"); err == nil {
+		t.Error("parseLogFormat(\"xml\") succeeded")
+	}
+}
+
+func TestLogSkip(t *testing.T) {
+	defer func(l *slog.Logger) { logger = l }(logger)
+	var buf bytes.Buffer
+	logger = slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	var skipped []*SkippedFile
+	options := &CommandOptions{OnSkip: func(s *SkippedFile) { skipped = append(skipped, s) }}
+	logSkip(options, "vendor", true, "gitignore", "vendor/")
+	logSkip(options, "a.png", false, "extension", "")
+
+	if len(skipped) != 2 || *skipped[0] != (SkippedFile{Path: "vendor", Directory: true, Reason: "gitignore", Detail: "vendor/"}) ||
+		*skipped[1] != (SkippedFile{Path: "a.png", Reason: "extension"}) {
+		t.Errorf("OnSkip saw %+v", skipped)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "detail=vendor/") || strings.Contains(lines[1], "detail=") {
+		t.Errorf("logged:\n%s", buf.String())
+	}
+}
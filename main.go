@@ -1,22 +1,62 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
+	"text/template"
+	"time"
 
 	gitignore "github.com/sabhiram/go-gitignore"
 	"github.com/tiktoken-go/tokenizer"
+
+	"token-counter/tokenizers"
 )
 
 // FileTokenInfo stores token count information for a file
 type FileTokenInfo struct {
 	Path       string
 	TokenCount int
+	Bytes      int
+	Lines      int
+	ModelCounts map[string]int // Token count per model when comparing models
+	Model      string // Model a model route of the config file counted the file with
+	StrippedTokenCount int // Token count after the -strip filters, if any
+	Segments   map[string]int // Counts of the segments of a Markdown, HTML, Vue or Svelte file, with -segments
+	Encoding   string // Encoding the file was transcoded to UTF-8 from, if it wasn't UTF-8
+	Generated  string // Why the file looks generated, if it does, like "lockfile"
+	Hash       string // SHA-256 of the contents, to find duplicates
+	stamp      fileStamp // Modification time and size when the file was read, for the caches
+	ModTime    time.Time // Last modification time, with -with-metadata
+	LastAuthor string    // Author of the last commit that changed the file, with -with-metadata
+	LastCommitTime time.Time // Author date of that commit
+	Head       *TruncationPoint // Where cutting the file to -head-tokens lands
+	Tail       *TruncationPoint // Where cutting the file to -tail-tokens lands
+	LineRanges []*Snippet       // Counts of the -lines ranges
+	Functions  []*Snippet       // Counts of the top-level functions, with -per-function
+}
+
+// TokensPerLine returns the average number of tokens per line of the file
+func (f *FileTokenInfo) TokensPerLine() float64 {
+	if f.Lines == 0 {
+		return 0
+	}
+	return float64(f.TokenCount) / float64(f.Lines)
+}
+
+// TokensPerKB returns the number of tokens per 1024 bytes of the file
+func (f *FileTokenInfo) TokensPerKB() float64 {
+	if f.Bytes == 0 {
+		return 0
+	}
+	return float64(f.TokenCount) * 1024 / float64(f.Bytes)
 }
 
 // DirTokenInfo stores token count information for a directory
@@ -24,6 +64,8 @@ type DirTokenInfo struct {
 	Path       string
 	TokenCount int
 	Files      []*FileTokenInfo
+	ModelCounts map[string]int
+	StrippedTokenCount int
 }
 
 // RepoTokenInfo stores token count information for the entire repository
@@ -31,6 +73,39 @@ type RepoTokenInfo struct {
 	Path       string
 	TokenCount int
 	Dirs       map[string]*DirTokenInfo
+	ModelCounts map[string]int
+	StrippedTokenCount int
+	SegmentCounts   map[string]int // Totals of the segments of composite files, with -segments
+	SkippedSymlinks []*SymlinkInfo
+	Submodules      []*SubmoduleInfo // Nested repositories, counted or skipped
+	Duplicates      []*DuplicateFile // Files with the same contents as one found earlier
+	Errors          []*FileError // Per-file errors; the files are left out of the counts
+	Images          []*ImageInfo // Images measured with -images, not counted in TokenCount
+	BelowMin        []*FileTokenInfo // Files with fewer tokens than -min, left out of Dirs but counted in TokenCount unless -filter-affects-totals
+	DiscardedFiles  int              // Files counted in the totals whose records were dropped, with DiscardFiles
+	GeneratedFiles  int              // Counted files that look generated
+	GeneratedTokens int              // Tokens of those files
+	Partial         bool             // Whether -deadline passed before every file was counted
+	Remaining       int              // Files found but left uncounted when it did
+	RemainingAtLeast bool            // Whether listing them was cut short too, so there are more
+	Authors         []*AuthorTokenInfo // With -by-author, by git blame, once the report is printed
+}
+
+// FileError records an error encountered while processing a single file
+type FileError struct {
+	Path string
+	Err  error
+}
+
+// Error implements the error interface
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+// SymlinkInfo records a symlink that was not followed and why
+type SymlinkInfo struct {
+	Path   string
+	Reason string
 }
 
 // CommandOptions stores the command-line options
@@ -40,9 +115,90 @@ type CommandOptions struct {
 	RespectGitignore bool
 	ShowFiles       bool
 	MinTokens       int
+	FilterAffectsTotals bool // Leave the files below MinTokens out of the totals, not just the report
 	SortByTokens    bool
+	SortBy          string   // Order of directories and files: tokens, name, path or files
+	Reverse         bool     // Reverse the -sort order
+	Color           string   // When to color the output: auto, always or never
+	Quiet           bool     // Print only the total, without banners or reports
+	Archives        bool     // Count the text entries of zip, tar and gzip archives
+	MaxDepth        int      // Don't descend more than this many directories below the root (0 for no limit)
+	WalkWorkers     int      // Number of directories listed at once (1 to walk sequentially)
+	Prune           []string // Directory names (or paths relative to the root) to skip
+	Include         []string // Gitignore-style patterns of the files to count (all if empty)
+	SkipAttributes  []string // .gitattributes attributes whose paths to skip, like linguist-generated
+	ExcludeGenerated bool    // Skip the files that look generated, like lockfiles and minified bundles
+	SkipExts        []string // Extensions of the files to skip without reading them, on top of the binary ones
+	TextExts        []string // Extensions of the files to count as text, even binary ones
+	includer        *gitignore.GitIgnore
+	collect         func(path string, info os.FileInfo) // Called with each file to count instead of counting it, for -estimate
+	profile         *scanProfile                        // Times the phases of the scan for -profile-scan
+	collectArchives bool                                // Whether collect lists -archives archives too, rather than their entries being counted
+	Profile         string   // Config file profile whose settings apply
+	ConfigFile      string   // Config file to read instead of the default one in the root
 	IgnoreHidden    bool
 	IsSingleFile    bool  // Indicates if the path is a single file rather than a directory
+	Readability     bool  // Reduce a web page given as the path to the text of its main content
+	FollowSymlinks  bool
+	TokenizerFile   string // HuggingFace tokenizer.json to use instead of Model
+	BPEVocab        string // GPT-2-style vocab.bpe merges to use instead of Model, with BPEEncoder
+	BPEEncoder      string // GPT-2-style encoder.json vocabulary to use with BPEVocab
+	Models          []string // Models to compare; the first one is used for the main counts
+	ModelFallback   bool     // Count with the first available encoding of modelFallbacks if Model isn't available
+	fallback        *ModelFallback // Model that wasn't available, once ModelFallback replaced it
+	routes          []ModelRoute // Models of the config file for the files under some paths, for scan
+	Format          string   // Output format: text or tree
+	Strip           []string // Filters applied before counting stripped tokens
+	View            string   // View of the files to count, such as signatures (full if empty)
+	CountMode       string   // Unit to count: tokens, words, chars or bytes
+	ChatFormat      string   // API whose message overhead .json and .jsonl chat payloads are counted with
+	Segments        bool     // Count the prose and code, or markup, script and style, of composite files apart
+	Strict          bool     // Fail the run if any file could not be processed, and stop the walk at the first unreadable directory
+	SkipErrors      bool     // Record the directories that can't be read and carry on, unless Strict
+	Stats           bool     // Print per-file statistics and a histogram
+	Submodules      bool     // Descend into git submodules
+	ByAuthor        bool     // Attribute tokens to authors with git blame
+	ByAge           bool     // Bucket tokens by how long ago their files last changed
+	ageBuckets      []ageLimit // Limits of the -by-age buckets, youngest first
+	WithMetadata    bool     // Record each file's modification time and last git author
+	HeadTokens      int      // Find where each file's first this many tokens end (0 to skip)
+	TailTokens      int      // Find where each file's last this many tokens start (0 to skip)
+	Lines           []LineRange // Line ranges of a single file to count on their own
+	PerFunction     bool     // Count each top-level function of a single Go or Python file
+	Dedupe          bool     // Count files with identical contents once
+	MaxFileBytes    int64    // Don't count files larger than this (0 for no limit)
+	MinDirTokens    int      // Collapse directories with fewer tokens in the report
+	MaxFileTokens   int      // Warn about files with more tokens in GitHub annotations
+	WarnFileTokens  int      // Highlight files with more tokens, and exit with exitWarnTier
+	CritFileTokens  int      // Highlight files with more tokens, and exit with exitCritTier
+	Timeout         time.Duration // Stop scanning after this long (0 for no limit)
+	Deadline        time.Duration // Stop counting after this long and report the files counted, as a complete scan (0 for no limit)
+	Output          string   // File to write an html report to (stdout if empty)
+	Template        string   // Go text/template file to render the report through instead of -format
+	template        *template.Template // The parsed Template
+	summary         *SummaryOptions    // -format gh-summary and -set-output settings, for scan
+	Price           float64  // USD per million tokens, to estimate the cost in reports (0 if unknown)
+	CachePricing    string   // Provider whose prompt caching prices apply, with -price
+	CacheWritePrice float64  // USD per million tokens written to the prompt cache
+	CacheReadPrice  float64  // USD per million tokens read from the prompt cache
+	CacheHitRate    float64  // Share of the tokens a warm request reads from the cache
+	Images          bool     // Estimate the vision tokens of images, reported separately
+	Rev             string   // Commit-ish whose files are counted instead of the working tree
+	RevCommit       string   // Commit Rev resolved to
+	revPath         string   // The Path Rev was given for, which reports name
+	revSnapshot     string   // Where the snapshot of revPath at Rev is scanned
+	OnFile          func(*FileTokenInfo) error // Called after each counted file; an error stops the scan
+	DiscardFiles    bool     // Keep only the totals of the files after OnFile, not their records, to bound memory
+	MaxMemory       int64    // Memory the scan should stay under, in bytes (0 for no limit)
+	memory          *memoryBudget // Bytes of file contents being counted at once, with MaxMemory
+	stream          *jsonLines    // Where -format jsonl streams the files to
+	OnSkip          func(*SkippedFile)         // Called for each file or directory the scan leaves out
+	Cached          bool     // Answer from a current index, or recount only the files changed since the last cached scan
+	Resume          bool     // Checkpoint the counts during the scan, and reuse those of an interrupted one
+	Exec            string   // Shell command whose output to count instead of a path
+	cache           *countCache // Counts of a cached scan to reuse
+	SkippedReport   string   // File to write the list of skipped files to
+	Telemetry       *telemetry // Spans and metrics of the scan for -otel-endpoint (nil if not sent)
 }
 
 // CountTokensInFile counts the number of tokens in a single file
@@ -52,118 +208,652 @@ func CountTokensInFile(path string, modelName string) (int, error) {
 		return 0, err
 	}
 
-	// Use the specified model or default to cl100k_base
-	enc, err := tokenizer.Get(tokenizer.Encoding(modelName))
+	return CountTokens(string(data), modelName)
+}
+
+// CountTokens counts the number of tokens in a string
+func CountTokens(text string, modelName string) (int, error) {
+	enc, err := codecForName(modelName)
 	if err != nil {
 		return 0, err
 	}
+	return enc.Count(text)
+}
 
-	tokens, _, err := enc.Encode(string(data))
-	return len(tokens), err
+// newCodec returns the tokenizer selected by the options: a HuggingFace
+// tokenizer.json if one was given, otherwise the -model encoding or model
+func newCodec(options *CommandOptions) (tokenizers.Tokenizer, error) {
+	if options.BPEVocab != "" || options.BPEEncoder != "" {
+		if options.BPEVocab == "" || options.BPEEncoder == "" {
+			return nil, fmt.Errorf("-bpe-vocab and -bpe-encoder must be given together")
+		}
+		if options.TokenizerFile != "" {
+			return nil, fmt.Errorf("-tokenizer-file can't be used with -bpe-vocab")
+		}
+		bpe, err := loadGPT2Tokenizer(options.BPEVocab, options.BPEEncoder)
+		if err != nil {
+			return nil, err
+		}
+		return bpe, nil
+	}
+	if options.TokenizerFile != "" {
+		hf, err := loadHFTokenizer(options.TokenizerFile)
+		if err != nil {
+			return nil, err
+		}
+		return hf, nil
+	}
+	codec, err := codecForName(options.Model)
+	if err != nil && options.ModelFallback {
+		return fallbackCodec(options, err)
+	}
+	return codec, err
 }
 
-// ProcessRepository walks through the repository and counts tokens
-func ProcessRepository(rootPath string, options *CommandOptions) (*RepoTokenInfo, error) {
+// countFile reads a file and collects its token count and size metrics. The
+// token count comes from the first codec; when several are given, the count
+// for each of them is recorded in ModelCounts as well. With -strip, the count
+// after preprocessing is recorded too.
+func countFile(path string, encs []namedCodec, options *CommandOptions) (*FileTokenInfo, error) {
+	// The contents are held twice while counting, as bytes and as text. The
+	// file is stamped before it's read, so a change while it's counted makes
+	// the stamp out of date rather than the count.
+	info, statErr := os.Stat(path)
+	if statErr == nil && options.memory != nil {
+		defer options.memory.acquire(2 * info.Size())()
+	}
+	profile := options.profile.startFile(path)
+	readStart := time.Now()
+	data, err := ioutil.ReadFile(path)
+	profile.since(phaseRead, readStart)
+	if err != nil {
+		return nil, err
+	}
+	fileInfo, err := countProfiledData(path, data, encs, options, profile)
+	if err == nil && statErr == nil {
+		fileInfo.stamp = stampOf(info)
+	}
+	return fileInfo, err
+}
+
+// countData counts the contents of a file that has already been read, such
+// as an entry of an archive
+func countData(path string, data []byte, encs []namedCodec, options *CommandOptions) (*FileTokenInfo, error) {
+	return countProfiledData(path, data, encs, options, options.profile.startFile(path))
+}
+
+// countProfiledData counts the contents of a file, timing its phases in
+// profile for -profile-scan
+func countProfiledData(path string, data []byte, encs []namedCodec, options *CommandOptions, profile *fileProfile) (fileInfo *FileTokenInfo, err error) {
+	span := options.Telemetry.startFile(path)
+	defer func() { span.endFile(fileInfo, err) }()
+	defer func() {
+		if err == nil {
+			options.profile.endFile(profile, fileInfo.Bytes, fileInfo.TokenCount)
+		}
+	}()
+
+	// Count the text, not the bytes, of files that aren't UTF-8
+	decodeStart := time.Now()
+	text, encoding := decodeText(data)
+
+	fileInfo = &FileTokenInfo{
+		Path:     path,
+		Bytes:    len(data),
+		Encoding: encoding,
+		Hash:     contentHash(data),
+		Generated: generatedReason(path, []byte(text[:min(len(text), sniffLen)])),
+	}
+
+	// Count parts of a single file by their line numbers in the file itself
+	if options.IsSingleFile && (len(options.Lines) > 0 || options.PerFunction) {
+		if fileInfo.LineRanges, fileInfo.Functions, err = countSnippets(path, text, encs[0], options); err != nil {
+			return nil, err
+		}
+	}
+
+	// Count only what the -view shows of the file, sizes included
+	text, viewed, err := applyView(path, text, options.View)
+	profile.since(phaseDecode, decodeStart)
+	if err != nil {
+		return nil, err
+	}
+	if viewed {
+		fileInfo.Bytes = len(text)
+	}
+	fileInfo.Lines = countLines([]byte(text))
+
+	// Count chat payloads as the API bills them, with the messages' overhead
+	var chat []chatConversation
+	if options.ChatFormat != "" && options.unitName() == "tokens" {
+		var ok bool
+		if chat, ok = parseChat(path, text); !ok {
+			logger.Debug("counting the file as text, it's not a chat payload", "path", path)
+		}
+	}
+
+	tokenizeStart := time.Now()
+	for i, enc := range encs {
+		var count int
+		if chat != nil {
+			count, err = countChat(chat, enc, options.ChatFormat)
+		} else {
+			count, err = countUnits(text, enc, options.CountMode)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			fileInfo.TokenCount = count
+		}
+		if len(encs) > 1 {
+			if fileInfo.ModelCounts == nil {
+				fileInfo.ModelCounts = make(map[string]int, len(encs))
+			}
+			fileInfo.ModelCounts[enc.Name] = count
+		}
+	}
+
+	if options.HeadTokens > 0 {
+		if fileInfo.Head, err = truncationPoint(text, fileInfo.TokenCount, options.HeadTokens, encs[0], options.CountMode, false); err != nil {
+			return nil, err
+		}
+	}
+	if options.TailTokens > 0 {
+		if fileInfo.Tail, err = truncationPoint(text, fileInfo.TokenCount, options.TailTokens, encs[0], options.CountMode, true); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(options.Strip) > 0 {
+		count, err := countUnits(stripContent(path, text, options.Strip), encs[0], options.CountMode)
+		if err != nil {
+			return nil, err
+		}
+		fileInfo.StrippedTokenCount = count
+	}
+
+	// Break down composite files by segment, unless they're counted as a chat
+	if options.Segments && chat == nil {
+		if fileInfo.Segments, err = countSegments(path, text, encs[0], options.CountMode); err != nil {
+			return nil, err
+		}
+	}
+	profile.since(phaseTokenize, tokenizeStart)
+
+	return fileInfo, nil
+}
+
+// countLines counts lines in data, including a final line without a newline
+func countLines(data []byte) int {
+	lines := bytes.Count(data, []byte("\n"))
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		lines++
+	}
+	return lines
+}
+
+// ProcessRepository walks through the repository and counts tokens. When ctx
+// is canceled, it stops and returns what it counted so far with ctx's error.
+func ProcessRepository(ctx context.Context, rootPath string, options *CommandOptions) (*RepoTokenInfo, error) {
+	defer options.profile.walkedSince(time.Now())
 	repo := &RepoTokenInfo{
 		Path: rootPath,
 		Dirs: make(map[string]*DirTokenInfo),
 	}
 
-	// Load .gitignore if needed
+	encs, err := newCodecs(options)
+	if err != nil {
+		return nil, err
+	}
+	router, err := newModelRouter(options, encs)
+	if err != nil {
+		return nil, err
+	}
+
+	// Load .gitignore, .git/info/exclude and the global excludes file if needed
 	var ignorer *gitignore.GitIgnore
-	var err error
 	if options.RespectGitignore {
-		gitignorePath := filepath.Join(rootPath, ".gitignore")
-		if _, statErr := os.Stat(gitignorePath); statErr == nil {
-			ignorer, err = gitignore.CompileIgnoreFile(gitignorePath)
-			if err != nil {
-				fmt.Printf("Warning: Error loading .gitignore file: %v\n", err)
+		var errs []*FileError
+		ignorer, errs = loadGitIgnore(rootPath)
+		repo.Errors = append(repo.Errors, errs...)
+	}
+
+	// .tokenignore files are always honored and loaded as directories are entered
+	tokenIgnorer := make(tokenIgnores)
+
+	// With -skip-attributes, .gitattributes files are loaded the same way
+	attributes, attrErr := newGitAttributes(rootPath, options.SkipAttributes)
+	if attrErr != nil {
+		repo.Errors = append(repo.Errors, attrErr)
+	}
+
+	// Track visited directories and files by identity when following symlinks,
+	// so cycles are detected and files reachable through several paths are
+	// only counted once
+	visitedDirs := make(map[string]bool)
+	visitedFiles := make(map[string]bool)
+
+	// Submodules found so far, each with its own ignore rules
+	subs := make(submodules)
+
+	// addFile records a counted file, or one below the minimum
+	seen := make(contentHashes)
+	addFile := func(fileInfo *FileTokenInfo) error {
+		if options.MinTokens > 0 && fileInfo.TokenCount < options.MinTokens {
+			logSkip(options, fileInfo.Path, false, "min-tokens", fmt.Sprintf("%d %s is below -min", fileInfo.TokenCount, options.unitName()))
+			repo.addBelowMin(fileInfo, !options.FilterAffectsTotals)
+			return nil
+		}
+		if original := seen.checkFor(fileInfo, options); original != "" {
+			repo.Duplicates = append(repo.Duplicates, &DuplicateFile{fileInfo.Path, original, fileInfo.TokenCount})
+			if options.Dedupe {
+				logSkip(options, fileInfo.Path, false, "duplicate", "duplicate of "+original)
+				return nil
+			}
+		}
+		logger.Debug("counted", "path", fileInfo.Path, options.unitName(), fileInfo.TokenCount)
+
+		// Add the file to its directory and the repository totals
+		repo.addFile(fileInfo)
+		subs.addFile(rootPath, fileInfo)
+
+		if options.OnFile != nil {
+			if err := options.OnFile(fileInfo); err != nil {
+				return err
 			}
 		}
+		if options.DiscardFiles {
+			repo.discardFile(fileInfo)
+		}
+		return nil
 	}
 
-	err = filepath.Walk(rootPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
+	// Files are counted in batches, concurrently, when counting with an API,
+	// and added in the order they were found
+	batch := &fileBatch{
+		size: 1,
+		count: func(path string) (*FileTokenInfo, error) {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			if fileInfo := options.cache.lookup(path); fileInfo != nil {
+				return fileInfo, nil
+			}
+			fileInfo, err := router.countFile(rootPath, path, encs, options)
+			if err == nil {
+				options.cache.store(fileInfo)
+			}
+			return fileInfo, err
+		},
+		done: func(path string, fileInfo *FileTokenInfo, err error) error {
+			if err != nil && err == ctx.Err() {
+				return err
+			}
+			if err != nil {
+				repo.Errors = append(repo.Errors, &FileError{path, err})
+				return nil
+			}
+			return addFile(fileInfo)
+		},
+	}
+	if usesAPI(router.all(encs)) {
+		batch.size = apiSettings.Concurrency
+	}
+
+	deadline := newScanDeadline(options)
+	var walkFn filepath.WalkFunc
+	walkFn = func(path string, info os.FileInfo, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if deadline.listingOver() {
+			repo.Partial, repo.RemainingAtLeast = true, true
+			return filepath.SkipAll
+		}
+		// A directory that can't be read is recorded once the ignore rules
+		// have had their say, unless errors stop the walk. The root always
+		// has to be readable.
+		if err != nil && (!options.SkipErrors || options.Strict || filepath.Clean(path) == filepath.Clean(rootPath)) {
 			return err
 		}
-
-		// Get relative path for gitignore matching
-		relPath, err := filepath.Rel(rootPath, path)
-		if err != nil {
-			relPath = path
+		// An entry that can't be stat'd, like a file deleted during the walk,
+		// has nothing to filter by, so it's recorded right away
+		if err != nil && info == nil {
+			repo.Errors = append(repo.Errors, &FileError{path, err})
+			return nil
 		}
 
-		// Skip hidden files and directories if specified
-		if options.IgnoreHidden && strings.HasPrefix(filepath.Base(path), ".") {
+		// skip logs why path is left out, and skips the whole of a directory
+		skip := func(reason string, detail string) error {
+			logSkip(options, path, info.IsDir(), reason, detail)
 			if info.IsDir() {
 				return filepath.SkipDir
 			}
 			return nil
 		}
 
-		// Check if the file is ignored by .gitignore
-		if ignorer != nil && ignorer.MatchesPath(relPath) {
-			if info.IsDir() {
-				return filepath.SkipDir
+		// Get relative path for gitignore matching
+		relPath, relErr := filepath.Rel(rootPath, path)
+		if relErr != nil {
+			relPath = path
+		}
+
+		// Skip pruned directories and anything below -max-depth
+		if info.IsDir() && relPath != "." {
+			if options.prunes(relPath) {
+				return skip("pruned", "")
+			}
+			if options.MaxDepth > 0 && depth(relPath) >= options.MaxDepth {
+				return skip("max-depth", "below -max-depth")
 			}
-			return nil
+		}
+
+		// Skip hidden files and directories if specified. The root itself is
+		// never hidden, even when it's given as "." or "..".
+		if options.IgnoreHidden && relPath != "." && strings.HasPrefix(filepath.Base(path), ".") {
+			return skip("hidden", "")
+		}
+
+		// Check if the file is ignored by .gitignore. Inside a submodule its own
+		// rules apply instead of the parent repository's, as in git.
+		matchIgnorer := ignorer
+		if subPath, sub := subs.innermost(rootPath, path); sub != nil {
+			matchIgnorer = sub.ignorer
+			relPath, _ = filepath.Rel(subPath, path)
+		}
+		if matchIgnorer != nil {
+			if ignored, rule := matchIgnorer.MatchesPathHow(filepath.ToSlash(relPath)); ignored {
+				return skip("gitignore", "rule "+ruleLine(rule.Line))
+			}
+		}
+
+		// Check if the file is excluded by a .tokenignore
+		if rule := tokenIgnorer.rule(rootPath, path); rule != "" {
+			return skip("tokenignore", rule)
+		}
+
+		// Check if the file is marked with an attribute -skip-attributes skips
+		if rule := attributes.rule(rootPath, path); rule != "" {
+			return skip("gitattributes", rule)
+		}
+		if err != nil {
+			repo.Errors = append(repo.Errors, &FileError{path, err})
+			return filepath.SkipDir
+		}
+
+		// Resolve symlinks, or record them as skipped if we don't follow them
+		if info.Mode()&os.ModeSymlink != 0 {
+			skipSymlink := func(reason string) error {
+				repo.SkippedSymlinks = append(repo.SkippedSymlinks, &SymlinkInfo{path, reason})
+				return skip("symlink", reason)
+			}
+			target, err := os.Stat(path)
+			if err != nil {
+				return skipSymlink("broken symlink")
+			}
+
+			// Symlinked files are counted either way, as they always were
+			if target.IsDir() {
+				if !options.FollowSymlinks {
+					return skipSymlink("not following symlinks")
+				}
+				resolved, err := filepath.EvalSymlinks(path)
+				if err != nil {
+					return skipSymlink("broken symlink")
+				}
+				if linksToAncestor(path, resolved) {
+					return skipSymlink("symlink cycle")
+				}
+				if visitedDirs[fileKey(resolved, target)] {
+					return skipSymlink("duplicate link to an already-walked directory")
+				}
+				return walkSymlinkedDir(path, resolved, options.WalkWorkers, walkFn, options.profile)
+			}
+			info = target
 		}
 
 		// Skip directories themselves (we'll count files inside them)
 		if info.IsDir() {
+			// Skip submodules, or start tracking their subtotals and ignore rules
+			if filepath.Clean(path) != filepath.Clean(rootPath) && isSubmodule(path) {
+				sub := &submodule{info: &SubmoduleInfo{Path: path}}
+				repo.Submodules = append(repo.Submodules, sub.info)
+				if !options.Submodules {
+					sub.info.Skipped = true
+					return skip("submodule", "")
+				}
+				if options.RespectGitignore {
+					var errs []*FileError
+					sub.ignorer, errs = loadGitIgnore(path)
+					repo.Errors = append(repo.Errors, errs...)
+				}
+				subs[filepath.Clean(path)] = sub
+			}
+
+			visitedDirs[fileKey(path, info)] = true
+			if fileErr := tokenIgnorer.load(path); fileErr != nil {
+				repo.Errors = append(repo.Errors, fileErr)
+			}
+			if fileErr := attributes.load(path); fileErr != nil {
+				repo.Errors = append(repo.Errors, fileErr)
+			}
 			return nil
 		}
 
-		// Skip binary files and certain extensions
+		// Skip files -include doesn't select
+		if !options.includes(rootPath, path) {
+			return skip("include", "not matched by -include")
+		}
+
+		// Skip binary files and certain extensions, except archives with -archives
 		ext := strings.ToLower(filepath.Ext(path))
-		if shouldSkipFile(path, ext, info) {
+		if options.Images && imageExts[ext] {
+			img, err := measureImage(path)
+			if err != nil {
+				repo.Errors = append(repo.Errors, &FileError{path, err})
+				return nil
+			}
+			repo.Images = append(repo.Images, img)
 			return nil
 		}
+		archive := options.Archives && archiveKind(path) != ""
+		if !archive && options.skipsExtension(ext) {
+			return skip("extension", "unsupported file type")
+		}
+		if options.tooLarge(info) {
+			return skip("size", fmt.Sprintf("%d bytes is above -max-file-bytes", info.Size()))
+		}
+		if !archive {
+			head, mimeType, binary, err := sniffHead(path)
+			if err != nil {
+				repo.Errors = append(repo.Errors, &FileError{path, err})
+				return nil
+			}
+			if binary && !options.countsAsText(ext) {
+				return skip("binary", binaryReason(mimeType))
+			}
+			if options.ExcludeGenerated {
+				if reason := generatedReason(path, head); reason != "" {
+					return skip("generated", reason)
+				}
+			}
+		}
 
-		// Count tokens in the file
-		tokenCount, err := CountTokensInFile(path, options.Model)
-		if err != nil {
-			fmt.Printf("Error processing %s: %v\n", path, err)
+		// Skip files already counted through another path
+		if options.FollowSymlinks {
+			key := fileKey(path, info)
+			if visitedFiles[key] {
+				return skip("already-counted", "already counted through another path")
+			}
+			visitedFiles[key] = true
+		}
+
+		// Past the -deadline, the files left are only listed, to tell how many
+		if options.collect == nil && deadline.passed() {
+			repo.Partial = true
+			repo.Remaining++
 			return nil
 		}
 
-		// Skip files with fewer tokens than the minimum if specified
-		if options.MinTokens > 0 && tokenCount < options.MinTokens {
+		// List the archive itself for -dry-run, which reads no file
+		if archive && options.collect != nil && options.collectArchives {
+			options.collect(path, info)
 			return nil
 		}
 
-		// Get directory path
-		dirPath := filepath.Dir(path)
-		
-		// Create or update directory info
-		dirInfo, exists := repo.Dirs[dirPath]
-		if !exists {
-			dirInfo = &DirTokenInfo{
-				Path:  dirPath,
-				Files: []*FileTokenInfo{},
+		// Count the entries of an archive as files under its path
+		if archive {
+			defer options.profile.countingSince(time.Now())
+			if err := batch.flush(); err != nil {
+				return err
+			}
+			archiveEncs := router.codecs(rootPath, path, encs)
+			files, errs, err := countArchive(path, archiveEncs, options)
+			repo.Errors = append(repo.Errors, errs...)
+			if err != nil {
+				repo.Errors = append(repo.Errors, &FileError{path, err})
+				return nil
+			}
+			for _, fileInfo := range files {
+				router.record(fileInfo, archiveEncs[0].Name)
+				if err := addFile(fileInfo); err != nil {
+					return err
+				}
 			}
-			repo.Dirs[dirPath] = dirInfo
+			return nil
 		}
 
-		// Add file info to directory
-		fileInfo := &FileTokenInfo{
-			Path:       path,
-			TokenCount: tokenCount,
+		// List the file for -estimate, which counts a sample of them itself
+		if options.collect != nil {
+			options.collect(path, info)
+			return nil
 		}
-		dirInfo.Files = append(dirInfo.Files, fileInfo)
-		dirInfo.TokenCount += tokenCount
-		
-		// Add to repository total
-		repo.TokenCount += tokenCount
 
-		return nil
-	})
+		// Count tokens in the file, once its batch is full
+		defer options.profile.countingSince(time.Now())
+		return batch.add(path)
+	}
+
+	// Always resolve the scan root itself, so a symlinked path still gets scanned
+	if rootInfo, statErr := os.Lstat(rootPath); statErr == nil && rootInfo.Mode()&os.ModeSymlink != 0 {
+		var resolved string
+		resolved, err = filepath.EvalSymlinks(rootPath)
+		if err == nil {
+			err = walkSymlinkedDir(rootPath, resolved, options.WalkWorkers, walkFn, options.profile)
+		}
+	} else {
+		err = walkTree(rootPath, options.WalkWorkers, walkFn, options.profile)
+	}
+	if err == nil {
+		flushStart := time.Now()
+		err = batch.flush()
+		options.profile.countingSince(flushStart)
+	}
 
 	return repo, err
 }
 
+// addFile adds a counted file to its directory, creating it if needed, and
+// to the repository totals
+func (repo *RepoTokenInfo) addFile(fileInfo *FileTokenInfo) {
+	dirPath := filepath.Dir(fileInfo.Path)
+	dirInfo, exists := repo.Dirs[dirPath]
+	if !exists {
+		dirInfo = &DirTokenInfo{
+			Path:  dirPath,
+			Files: []*FileTokenInfo{},
+		}
+		repo.Dirs[dirPath] = dirInfo
+	}
+
+	dirInfo.Files = append(dirInfo.Files, fileInfo)
+	dirInfo.TokenCount += fileInfo.TokenCount
+	dirInfo.ModelCounts = addModelCounts(dirInfo.ModelCounts, fileInfo.ModelCounts)
+	dirInfo.StrippedTokenCount += fileInfo.StrippedTokenCount
+
+	repo.TokenCount += fileInfo.TokenCount
+	repo.ModelCounts = addModelCounts(repo.ModelCounts, fileInfo.ModelCounts)
+	repo.StrippedTokenCount += fileInfo.StrippedTokenCount
+	repo.SegmentCounts = addModelCounts(repo.SegmentCounts, fileInfo.Segments)
+	repo.addGenerated(fileInfo)
+}
+
+// addBelowMin records a file with fewer tokens than -min. It's left out of
+// the directories, so the report doesn't list it, but with countTotal its
+// tokens still count in the repository's total.
+func (repo *RepoTokenInfo) addBelowMin(fileInfo *FileTokenInfo, countTotal bool) {
+	repo.BelowMin = append(repo.BelowMin, fileInfo)
+	if countTotal {
+		repo.TokenCount += fileInfo.TokenCount
+		repo.ModelCounts = addModelCounts(repo.ModelCounts, fileInfo.ModelCounts)
+		repo.StrippedTokenCount += fileInfo.StrippedTokenCount
+		repo.SegmentCounts = addModelCounts(repo.SegmentCounts, fileInfo.Segments)
+		repo.addGenerated(fileInfo)
+	}
+}
+
+// countedFiles returns the files counted in the repository's total: those
+// in its directories, and those below -min unless -filter-affects-totals
+// leaves them out of it
+func (repo *RepoTokenInfo) countedFiles(options *CommandOptions) []*FileTokenInfo {
+	var files []*FileTokenInfo
+	for _, dirInfo := range repo.Dirs {
+		files = append(files, dirInfo.Files...)
+	}
+	if !options.FilterAffectsTotals {
+		files = append(files, repo.BelowMin...)
+	}
+	return files
+}
+
+// belowMinSummary describes the files below -min for the text and tree
+// reports, e.g. "12 files below -min: 340 tokens (0.4% of total)", or
+// returns an empty string if there are none
+func belowMinSummary(repo *RepoTokenInfo, options *CommandOptions) string {
+	if len(repo.BelowMin) == 0 {
+		return ""
+	}
+	tokens := 0
+	for _, fileInfo := range repo.BelowMin {
+		tokens += fileInfo.TokenCount
+	}
+	files := "files"
+	if len(repo.BelowMin) == 1 {
+		files = "file"
+	}
+	if options.FilterAffectsTotals {
+		return fmt.Sprintf("%d %s below -min: %s %s, not included in the total", len(repo.BelowMin), files, formatCount(tokens), options.unitName())
+	}
+	return fmt.Sprintf("%d %s below -min: %s %s (%.1f%% of total)", len(repo.BelowMin), files, formatCount(tokens), options.unitName(), percentOf(tokens, repo.TokenCount))
+}
+
+// linksToAncestor reports whether the symlink at path points to resolved,
+// the directory the link is in or one above it, so following it would walk
+// the same directories forever
+func linksToAncestor(path string, resolved string) bool {
+	parent, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(resolved, parent)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// walkSymlinkedDir walks target, the resolved directory a symlink points to,
+// reporting every entry to walkFn under the symlink's path instead
+func walkSymlinkedDir(linkPath string, target string, workers int, walkFn filepath.WalkFunc, profile *scanProfile) error {
+	return walkTree(target, workers, func(path string, info os.FileInfo, err error) error {
+		rel, relErr := filepath.Rel(target, path)
+		if relErr != nil {
+			return relErr
+		}
+		return walkFn(filepath.Join(linkPath, rel), info, err)
+	}, profile)
+}
+
 // ProcessSingleFile counts tokens in a single file
-func ProcessSingleFile(filePath string, options *CommandOptions) (*RepoTokenInfo, error) {
+func ProcessSingleFile(ctx context.Context, filePath string, options *CommandOptions) (*RepoTokenInfo, error) {
 	// Check if file exists
 	fileInfo, err := os.Stat(filePath)
 	if (err != nil) {
@@ -177,15 +867,39 @@ func ProcessSingleFile(filePath string, options *CommandOptions) (*RepoTokenInfo
 	
 	// Check if we should skip this file
 	ext := strings.ToLower(filepath.Ext(filePath))
-	if shouldSkipFile(filePath, ext, fileInfo) {
+	if options.Images && imageExts[ext] {
+		img, err := measureImage(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("error processing file: %v", err)
+		}
+		return &RepoTokenInfo{Path: filePath, Dirs: make(map[string]*DirTokenInfo), Images: []*ImageInfo{img}}, nil
+	}
+	if options.skipsExtension(ext) {
 		return nil, fmt.Errorf("skipping binary or unsupported file type: %s", filePath)
 	}
+	if mimeType, binary, err := sniffFile(filePath); err != nil {
+		return nil, fmt.Errorf("error processing file: %v", err)
+	} else if binary && !options.countsAsText(ext) {
+		return nil, fmt.Errorf("skipping file with %s: %s", binaryReason(mimeType), filePath)
+	}
 	
 	// Count tokens in the file
-	tokenCount, err := CountTokensInFile(filePath, options.Model)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	encs, err := newCodecs(options)
+	if err != nil {
+		return nil, err
+	}
+	router, err := newModelRouter(options, encs)
+	if err != nil {
+		return nil, err
+	}
+	fileTokenInfo, err := router.countFile(filepath.Dir(filePath), filePath, encs, options)
 	if err != nil {
 		return nil, fmt.Errorf("error processing file: %v", err)
 	}
+	tokenCount := fileTokenInfo.TokenCount
 	
 	// Skip if fewer tokens than minimum
 	if options.MinTokens > 0 && tokenCount < options.MinTokens {
@@ -199,6 +913,9 @@ func ProcessSingleFile(filePath string, options *CommandOptions) (*RepoTokenInfo
 		Path:       filePath,
 		TokenCount: tokenCount,
 		Dirs:       make(map[string]*DirTokenInfo),
+		ModelCounts: fileTokenInfo.ModelCounts,
+		StrippedTokenCount: fileTokenInfo.StrippedTokenCount,
+		SegmentCounts: fileTokenInfo.Segments,
 	}
 	
 	// Add directory info
@@ -206,122 +923,471 @@ func ProcessSingleFile(filePath string, options *CommandOptions) (*RepoTokenInfo
 		Path:       dirPath,
 		TokenCount: tokenCount,
 		Files:      []*FileTokenInfo{},
+		ModelCounts: fileTokenInfo.ModelCounts,
+		StrippedTokenCount: fileTokenInfo.StrippedTokenCount,
 	}
 	repo.Dirs[dirPath] = dirInfo
 	
 	// Add file info
-	fileTokenInfo := &FileTokenInfo{
-		Path:       filePath,
-		TokenCount: tokenCount,
-	}
 	dirInfo.Files = append(dirInfo.Files, fileTokenInfo)
 	
 	return repo, nil
 }
 
-// shouldSkipFile determines if a file should be skipped based on extension or other criteria
-func shouldSkipFile(path string, ext string, info os.FileInfo) bool {
-	// Skip files without an extension if they're executables (like the token-counter binary)
-	if ext == "" && info.Mode()&0111 != 0 {
-		return true
+// PrintErrors prints the per-file errors collected during a scan to stderr
+func PrintErrors(repo *RepoTokenInfo) {
+	if len(repo.Errors) == 0 {
+		return
 	}
 
-	// Skip the binary with the same name as the module
-	if filepath.Base(path) == "token-counter" {
-		return true
+	fmt.Fprintf(os.Stderr, "Errors (%d): %s\n", len(repo.Errors), errorSummary(repo.Errors))
+	fmt.Fprintln(os.Stderr, "-----------")
+	for _, fileErr := range repo.Errors {
+		fmt.Fprintf(os.Stderr, "%s\n", fileErr)
 	}
-	
-	// List of binary or non-text file extensions to skip
-	skipExts := map[string]bool{
-		".jpg": true, ".jpeg": true, ".png": true, ".gif": true, 
-		".pdf": true, ".zip": true, ".tar": true, ".gz": true,
-		".exe": true, ".dll": true, ".so": true, ".dylib": true,
-		".bin": true, ".obj": true, ".o": true,
+}
+
+// errorSummary counts errors by their cause, e.g. "2 permission denied, 1
+// not found"
+func errorSummary(errs []*FileError) string {
+	var denied, missing, other int
+	for _, fileErr := range errs {
+		switch {
+		case errors.Is(fileErr.Err, os.ErrPermission):
+			denied++
+		case errors.Is(fileErr.Err, os.ErrNotExist):
+			missing++
+		default:
+			other++
+		}
 	}
-	
-	return skipExts[ext]
+	var parts []string
+	for _, kind := range []struct {
+		count int
+		name  string
+	}{{denied, "permission denied"}, {missing, "not found"}, {other, "other"}} {
+		if kind.count > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", kind.count, kind.name))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// strippedSuffix describes the token count after -strip relative to the raw
+// count, or returns an empty string if no filters were requested
+func strippedSuffix(options *CommandOptions, raw int, stripped int) string {
+	if len(options.Strip) == 0 {
+		return ""
+	}
+	saved := 0.0
+	if raw > 0 {
+		saved = float64(raw-stripped) * 100 / float64(raw)
+	}
+	return fmt.Sprintf(", %s stripped (-%.1f%%)", formatCount(stripped), saved)
+}
+
+// percentOf returns part as a percentage of total
+func percentOf(part int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) * 100 / float64(total)
 }
 
 // PrintResults prints the token counting results
 func PrintResults(repo *RepoTokenInfo, options *CommandOptions) {
-	fmt.Printf("Token Count Summary for: %s\n", repo.Path)
+	fmt.Println(options.paint(ansiBold, "Token Count Summary for: "+repo.Path))
 	
 	// Special handling for single file
 	if options.IsSingleFile {
-		fmt.Printf("Total tokens: %d\n", repo.TokenCount)
+		fmt.Printf("Total %s: %s%s\n", options.unitName(), options.paint(ansiBold, formatCount(repo.TokenCount)), strippedSuffix(options, repo.TokenCount, repo.StrippedTokenCount))
+		if options.fallback != nil {
+			fmt.Println(options.paint(ansiYellow, "Approximate: "+fallbackSummary(options)))
+		}
+		if estimate := estimateCost(repo.TokenCount, options); estimate != nil {
+			fmt.Printf("Estimated cost: %s\n", costSummary(estimate))
+		}
+		for _, dirInfo := range repo.Dirs {
+			for _, fileInfo := range dirInfo.Files {
+				fmt.Printf("Size: %s bytes, %s lines\n", formatCount(fileInfo.Bytes), formatCount(fileInfo.Lines))
+				if fileInfo.Encoding != "" {
+					fmt.Printf("Encoding: %s (transcoded to UTF-8)\n", fileInfo.Encoding)
+				}
+				if fileInfo.Model != "" {
+					fmt.Printf("Model: %s (model route of the config file)\n", fileInfo.Model)
+				}
+				if fileInfo.Generated != "" {
+					fmt.Printf("Generated: %s\n", fileInfo.Generated)
+				}
+				fmt.Printf("Density: %.1f %s/line, %.1f %s/KB\n", fileInfo.TokensPerLine(), options.unitName(), fileInfo.TokensPerKB(), options.unitName())
+				if len(fileInfo.Segments) > 0 {
+					fmt.Printf("Segments (%s): %s\n", options.unitName(), segmentSummary(fileInfo.Segments))
+				}
+				if fileInfo.Head != nil {
+					fmt.Printf("First %s %s: end on line %s (%s bytes)\n", formatCount(options.HeadTokens), options.unitName(), formatCount(fileInfo.Head.Line), formatCount(fileInfo.Head.Bytes))
+				}
+				if fileInfo.Tail != nil {
+					fmt.Printf("Last %s %s: start on line %s (%s bytes)\n", formatCount(options.TailTokens), options.unitName(), formatCount(fileInfo.Tail.Line), formatCount(fileInfo.Tail.Bytes))
+				}
+				if options.WithMetadata {
+					fmt.Printf("Modified: %s\n", fileInfo.ModTime.Format(time.RFC3339))
+					if fileInfo.LastAuthor != "" {
+						fmt.Printf("Last commit: %s by %s\n", fileInfo.LastCommitTime.Format(time.RFC3339), fileInfo.LastAuthor)
+					}
+				}
+				printSnippets(fileInfo, options)
+			}
+		}
+		if len(options.Models) > 1 {
+			fmt.Println()
+			printModelComparison(repo, options)
+		}
 		return
 	}
 	
-	fmt.Printf("Total tokens in repository: %d\n\n", repo.TokenCount)
-	
-	// Sort directories by token count (highest first)
-	type DirEntry struct {
-		Path  string
-		Info  *DirTokenInfo
+	fmt.Printf("Total %s in repository: %s%s\n", options.unitName(), options.paint(ansiBold, formatCount(repo.TokenCount)), strippedSuffix(options, repo.TokenCount, repo.StrippedTokenCount))
+	if repo.Partial {
+		fmt.Println(options.paint(ansiYellow, "Partial results: "+partialSummary(repo, options)))
 	}
-	
-	var dirs []DirEntry
-	for path, info := range repo.Dirs {
-		dirs = append(dirs, DirEntry{path, info})
+	if options.fallback != nil {
+		fmt.Println(options.paint(ansiYellow, "Approximate: "+fallbackSummary(options)))
+	}
+	if estimate := estimateCost(repo.TokenCount, options); estimate != nil {
+		fmt.Printf("Estimated cost: %s\n", costSummary(estimate))
+	}
+	if summary := generatedSummary(repo, options); summary != "" {
+		fmt.Println(summary)
 	}
+	fmt.Println()
 	
-	sort.Slice(dirs, func(i, j int) bool {
-		return dirs[i].Info.TokenCount > dirs[j].Info.TokenCount
-	})
+	// Sort directories by the -sort key (token count, highest first, by default)
+	dirs := options.sortedDirs(repo)
 	
-	// Print directory summaries
-	fmt.Println("Directories (sorted by token count):")
+	// Print directory summaries, with each directory's share of the total and
+	// the running share of the directories listed so far
+	fmt.Println(options.paint(ansiBold, fmt.Sprintf("Directories (sorted by %s):", options.sortDescription())))
 	fmt.Println("----------------------------------")
-	for _, entry := range dirs {
-		dirInfo := entry.Info
-		fmt.Printf("%s: %d tokens\n", dirInfo.Path, dirInfo.TokenCount)
+	cumulative := 0
+	collapsed, collapsedTokens := 0, 0
+	for _, dirInfo := range dirs {
+		if dirInfo.TokenCount < options.MinDirTokens {
+			collapsed++
+			collapsedTokens += dirInfo.TokenCount
+			continue
+		}
+		cumulative += dirInfo.TokenCount
+		// Large directories and files are highlighted and small files dimmed
+		fmt.Println(options.paint(shareColor(dirInfo.TokenCount, repo.TokenCount), fmt.Sprintf("%s: %s %s (%.1f%% of total, %.1f%% cumulative)%s",
+			filepath.ToSlash(dirInfo.Path), formatCount(dirInfo.TokenCount), options.unitName(),
+			percentOf(dirInfo.TokenCount, repo.TokenCount), percentOf(cumulative, repo.TokenCount),
+			strippedSuffix(options, dirInfo.TokenCount, dirInfo.StrippedTokenCount))))
 		
 		// Only print file details if requested
 		if options.ShowFiles {
 			// Sort files within directory
-			sort.Slice(dirInfo.Files, func(i, j int) bool {
-				return dirInfo.Files[i].TokenCount > dirInfo.Files[j].TokenCount
-			})
+			options.sortFiles(dirInfo.Files)
 			
 			// Print file details
 			for _, fileInfo := range dirInfo.Files {
-				relativePath, _ := filepath.Rel(repo.Path, fileInfo.Path)
-				fmt.Printf("  |- %s: %d tokens\n", relativePath, fileInfo.TokenCount)
+				relativePath := relativeTo(repo.Path, fileInfo.Path)
+				fmt.Println(options.paint(options.fileColor(fileInfo.TokenCount, repo.TokenCount), fmt.Sprintf("  |- %s: %s %s%s (%.1f%% of total, %s bytes, %s lines, %.1f %s/line, %.1f %s/KB%s%s)",
+					relativePath, formatCount(fileInfo.TokenCount), options.unitName(),
+					strippedSuffix(options, fileInfo.TokenCount, fileInfo.StrippedTokenCount),
+					percentOf(fileInfo.TokenCount, repo.TokenCount), formatCount(fileInfo.Bytes), formatCount(fileInfo.Lines),
+					fileInfo.TokensPerLine(), options.unitName(), fileInfo.TokensPerKB(), options.unitName(),
+					truncationSuffix(options, fileInfo), metadataSuffix(options, fileInfo))))
 			}
 		}
 		fmt.Println()
 	}
+
+	if collapsed > 0 {
+		fmt.Println(options.paint(ansiDim, fmt.Sprintf("%d directories below -min-dir-tokens: %s %s (%.1f%% of total)",
+			collapsed, formatCount(collapsedTokens), options.unitName(), percentOf(collapsedTokens, repo.TokenCount))))
+		fmt.Println()
+	}
+	if summary := belowMinSummary(repo, options); summary != "" {
+		fmt.Println(options.paint(ansiDim, summary))
+		fmt.Println()
+	}
+
+	// Print the side-by-side model comparison if requested
+	if len(options.Models) > 1 {
+		printModelComparison(repo, options)
+	}
+
+	// Print the subtotals of the models the config file routed files to
+	if len(options.routes) > 0 {
+		printModelRoutes(repo, options)
+	}
+
+	// Print the prose and code of composite files with -segments
+	printSegments(repo, options)
+
+	if len(repo.Submodules) > 0 {
+		printSubmodules(repo, options)
+	}
+
+	printTranscoded(repo)
+	printDuplicates(repo, options)
+
+	// Print symlinks that were not followed
+	if len(repo.SkippedSymlinks) > 0 {
+		fmt.Println("Skipped symlinks:")
+		fmt.Println("-----------------")
+		for _, link := range repo.SkippedSymlinks {
+			relativePath := relativeTo(repo.Path, link.Path)
+			fmt.Printf("%s (%s)\n", relativePath, link.Reason)
+		}
+		fmt.Println()
+	}
 }
 
-func main() {
-	options := &CommandOptions{}
+// registerFlags defines the counting flags shared by every command that
+// counts tokens on the given flag set
+func registerFlags(fs *flag.FlagSet, options *CommandOptions) {
+	fs.StringVar(&options.Model, "model", string(tokenizer.Cl100kBase), "Token counting model to use (e.g., cl100k_base for GPT-4)")
+	fs.StringVar(&options.TokenizerFile, "tokenizer-file", "", "Path to a HuggingFace tokenizer.json to count with instead of -model (e.g. for Llama, Mistral or Qwen)")
+	fs.StringVar(&options.BPEVocab, "bpe-vocab", "", "Path to a GPT-2-style vocab.bpe merges file to count with instead of -model, with -bpe-encoder")
+	fs.StringVar(&options.BPEEncoder, "bpe-encoder", "", "Path to the GPT-2-style encoder.json vocabulary that goes with -bpe-vocab")
+	fs.Func("models", "Comma-separated list of models to compare side by side (e.g. cl100k_base,o200k_base)", func(value string) error {
+		options.Models = splitList(value)
+		return nil
+	})
+	fs.BoolVar(&options.ModelFallback, "model-fallback", false, "If -model isn't available, e.g. a model newer than this build, count with o200k_base or else cl100k_base, with a warning, and mark the results approximate")
+	fs.BoolVar(&options.Quiet, "quiet", false, "Print only the total, without banners or reports")
+	fs.BoolVar(&options.Quiet, "q", false, "Shorthand for -quiet")
+	fs.BoolVar(&options.Strict, "strict", false, "Stop at the first directory that can't be read, and exit with an error if any file could not be processed")
+	fs.BoolVar(&options.SkipErrors, "skip-errors", true, "Record directories that can't be read, e.g. for lack of permission, and carry on without them (ignored with -strict)")
+	fs.Func("color", "When to color the output: auto (when writing to a terminal), always or never (default auto)", func(value string) error {
+		mode, err := parseColorMode(value)
+		options.Color = mode
+		return err
+	})
+	fs.Func("log-level", "Minimum level of diagnostics logged to stderr: debug (explains every skipped file), info, warn or error (default info)", parseLogLevel)
+	fs.Func("log-format", "Format of diagnostics logged to stderr: text or json (default text)", parseLogFormat)
+	fs.Func("count-mode", "What to count: tokens, words, chars or bytes (default tokens)", func(value string) error {
+		mode, err := parseCountMode(value)
+		options.CountMode = mode
+		return err
+	})
+	fs.Func("chat-format", "Count .json and .jsonl files of chat messages as this API bills them, with its per-message overhead: openai or anthropic", func(value string) error {
+		format, err := parseChatFormat(value)
+		options.ChatFormat = format
+		return err
+	})
+	fs.BoolVar(&options.Segments, "segments", false, "Break down the counts of Markdown files into prose and fenced code, and of HTML, Vue and Svelte files into markup, script and style")
+	fs.Func("strip", "Comma-separated filters to apply before counting stripped tokens: comments, blank-lines, trailing-whitespace", func(value string) error {
+		filters, err := parseStripFilters(value)
+		options.Strip = filters
+		return err
+	})
+	fs.Func("view", "View of the files to count: full, signatures (Go declarations without function bodies) or exported (only exported Go declarations) (default full)", func(value string) error {
+		view, err := parseView(value)
+		options.View = view
+		return err
+	})
+	fs.Func("allow-special", "Special tokens of tiktoken encodings, like <|endoftext|>, counted as one token where their text appears: all, none or a comma-separated list (default none, counting them as the text they're written with)", func(value string) error {
+		tokens, err := parseSpecial(value)
+		specialSettings.Allowed = tokens
+		return err
+	})
+	fs.Func("disallow-special", "Special tokens of tiktoken encodings whose text in a file is an error: all, none or a comma-separated list (default none)", func(value string) error {
+		tokens, err := parseSpecial(value)
+		specialSettings.Disallowed = tokens
+		return err
+	})
+	fs.IntVar(&apiSettings.Concurrency, "api-concurrency", apiSettings.Concurrency, "Number of requests to counting APIs (Gemini, Claude, Ollama) in flight at once")
+	fs.IntVar(&apiSettings.Retries, "api-retries", apiSettings.Retries, "Number of times to retry a counting API request that was rate limited or failed")
+	fs.BoolVar(&apiSettings.Cache, "api-cache", apiSettings.Cache, "Whether to cache counting API responses on disk")
+}
+
+// registerWalkFlags defines the flags that select which files a directory
+// scan counts, for the commands that scan one
+func registerWalkFlags(fs *flag.FlagSet, options *CommandOptions) {
+	fs.StringVar(&options.Path, "path", "", "Path to the directory or file to analyze (defaults to current directory if not provided)")
+	fs.BoolVar(&options.Readability, "readability", false, "When the path is a web page URL, count only the text of its main content, without navigation, ads and markup")
+	fs.BoolVar(&options.RespectGitignore, "gitignore", true, "Whether to respect .gitignore rules")
+	fs.IntVar(&options.MinTokens, "min", 0, "Minimum token count for a file to be listed; smaller files still count in the total")
+	fs.BoolVar(&options.FilterAffectsTotals, "filter-affects-totals", false, "Whether to leave the files below -min out of the totals too, as older versions did")
+	fs.BoolVar(&options.IgnoreHidden, "no-hidden", true, "Whether to ignore hidden files and directories (starting with .)")
+	fs.BoolVar(&options.Submodules, "submodules", true, "Whether to descend into git submodules (with per-submodule subtotals)")
+	fs.BoolVar(&options.Archives, "archives", false, "Whether to count the text files inside .zip, .tar, .tar.gz/.tgz and .gz archives instead of skipping them")
+	fs.IntVar(&options.MaxDepth, "max-depth", 0, "Maximum number of directory levels to descend below the root (0 for no limit)")
+	fs.Func("prune", "Comma-separated directory names or root-relative paths to skip regardless of .gitignore (e.g. node_modules,vendor,dist)", func(value string) error {
+		options.Prune = splitList(value)
+		return nil
+	})
+	fs.Func("include", "Comma-separated gitignore-style patterns of the files to count, relative to the root (e.g. docs/**,*.go); other files are skipped", func(value string) error {
+		options.Include = splitList(value)
+		options.includer = gitignore.CompileIgnoreLines(options.Include...)
+		return nil
+	})
+	fs.Func("skip-attributes", "Comma-separated .gitattributes attributes whose paths to skip: export-ignore, linguist-vendored, linguist-generated, or all", func(value string) error {
+		attrs, err := parseSkipAttributes(value)
+		options.SkipAttributes = attrs
+		return err
+	})
+	fs.BoolVar(&options.ExcludeGenerated, "exclude-generated", false, "Whether to skip files that look generated: lockfiles, protobuf and other generated sources, minified bundles, and files with a header like \"Code generated ... DO NOT EDIT\"")
+	fs.Func("skip-ext", "Comma-separated extensions of files to skip without reading them, on top of the binary ones (e.g. .svg,.csv)", func(value string) error {
+		options.SkipExts = parseExtList(value)
+		return nil
+	})
+	fs.Func("text-ext", "Comma-separated extensions of files to count as text, even ones skipped as binary by default or by their content (e.g. .obj)", func(value string) error {
+		options.TextExts = parseExtList(value)
+		return nil
+	})
+	fs.BoolVar(&options.FollowSymlinks, "follow-symlinks", false, "Whether to follow symlinked directories (with cycle detection) and count files reachable through several symlinks once; symlinked files are counted either way")
+	fs.Func("max-file-bytes", "Skip files larger than this many bytes, with an optional K, M or G suffix (e.g. 10M)", func(value string) error {
+		size, err := parseByteSize(value)
+		options.MaxFileBytes = size
+		return err
+	})
+	fs.BoolVar(&options.Dedupe, "dedupe", false, "Whether to count files with identical contents only once (duplicates are reported either way)")
+	fs.DurationVar(&options.Timeout, "timeout", 0, "Stop scanning after this long, e.g. 60s, reporting what was counted so far (0 for no limit)")
+	fs.Func("max-memory", "Memory to stay under, with an optional K, M or G suffix (e.g. 512MB): garbage is collected harder near it and fewer files are read at once (default no limit)", func(value string) error {
+		size, err := parseByteSize(value)
+		setMemoryLimit(options, size)
+		return err
+	})
+	fs.IntVar(&options.WalkWorkers, "walk-workers", defaultWalkWorkers, "Number of directories to list at once while walking the tree (1 to walk sequentially)")
+	fs.StringVar(&options.Profile, "profile", "", "Profile of the config file whose settings to use, e.g. docs (flags given on the command line take precedence)")
+	fs.StringVar(&options.ConfigFile, "config", "", "Config file to read (defaults to "+defaultConfigFile+" in the scanned directory)")
+}
+
+// registerReportFlags defines the flags that shape the scan report
+func registerReportFlags(fs *flag.FlagSet, options *CommandOptions) {
+	fs.BoolVar(&options.ShowFiles, "files", true, "Whether to show individual file details")
+	fs.BoolVar(&options.ByAuthor, "by-author", false, "Whether to report how many tokens each author's lines contribute, using git blame")
+	fs.BoolVar(&options.ByAge, "by-age", false, "Whether to report how many tokens are in files last changed within each -age-buckets age, by their last commit or modification time")
+	options.ageBuckets, _ = parseAgeBuckets(defaultAgeBuckets)
+	fs.Func("age-buckets", "Comma-separated ages that bound the -by-age buckets, in days, weeks, months or years (default "+defaultAgeBuckets+")", func(value string) error {
+		buckets, err := parseAgeBuckets(value)
+		options.ageBuckets = buckets
+		return err
+	})
+	fs.BoolVar(&options.WithMetadata, "with-metadata", false, "Whether to report each file's modification time and the author and date of the last commit that changed it")
+	fs.BoolVar(&options.Stats, "stats", false, "Whether to show per-file statistics (min/median/mean/p90/p99/max) and a size histogram")
+	fs.Func("sort", "Order of directories and files: tokens, name, path or files (default tokens)", func(value string) error {
+		key, err := parseSortKey(value)
+		options.SortBy = key
+		return err
+	})
+	fs.BoolVar(&options.Reverse, "reverse", false, "Whether to reverse the -sort order")
+	fs.IntVar(&options.MinDirTokens, "min-dir-tokens", 0, "Collapse directories with fewer tokens than this into a single line of the report (their files still count)")
+	fs.StringVar(&options.Format, "format", "text", "Output format: text, tree, github-annotations, gh-summary, html, json, jsonl or ndjson (one line per file, streamed as counted, then the totals), yaml or toml")
+	fs.StringVar(&options.Output, "output", "", "File to write the -format html, json, jsonl, yaml or toml report to (defaults to stdout), or to append the gh-summary to (defaults to $GITHUB_STEP_SUMMARY)")
+	fs.Float64Var(&options.Price, "price", 0, "Price in USD per million input tokens, to estimate what sending the scan as a prompt costs")
+	fs.StringVar(&options.CachePricing, "cache-pricing", "", "Prompt caching prices to estimate with, as multiples of -price: anthropic (writes 1.25x, reads 0.1x) or openai (reads 0.5x)")
+	fs.Float64Var(&options.CacheWritePrice, "cache-write-price", 0, "Price in USD per million tokens written to the prompt cache (overrides -cache-pricing)")
+	fs.Float64Var(&options.CacheReadPrice, "cache-read-price", 0, "Price in USD per million tokens read from the prompt cache (overrides -cache-pricing)")
+	fs.Func("cache-hit-rate", "Share of the tokens a warm request reads from the prompt cache, e.g. 0.8 or 80%, for a warm cost next to the cold one", func(value string) error {
+		rate, err := parseCacheHitRate(value)
+		options.CacheHitRate = rate
+		return err
+	})
+	fs.IntVar(&options.MaxFileTokens, "max-file-tokens", 0, "Token count above which -format github-annotations warns about a file (0 for no warnings)")
+	fs.IntVar(&options.WarnFileTokens, "warn-file-tokens", 0, "Token count above which a file is highlighted in yellow and the scan exits with status 3 (0 for no warning tier)")
+	fs.IntVar(&options.CritFileTokens, "crit-file-tokens", 0, "Token count above which a file is highlighted in red and the scan exits with status 4 (0 for no critical tier)")
+}
+
+// resolveTarget fills in the path to analyze from the flags, the first
+// positional argument or the current directory, and detects whether it's a
+// file. GitHub repository URLs are cloned into a temporary directory, S3 and
+// GCS prefixes downloaded into one, and other URLs fetched into a temporary
+// file.
+func resolveTarget(fs *flag.FlagSet, options *CommandOptions) error {
+	// Count the output of -exec as a file of its own
+	if options.Exec != "" {
+		if options.Path != "" || fs.NArg() > 0 {
+			return fmt.Errorf("-exec counts the output of a command and can't be given a path")
+		}
+		if !options.Quiet {
+			logger.Info("running command", "command", options.Exec)
+		}
+		path, err := captureCommand(options.Exec)
+		if err != nil {
+			return err
+		}
+		options.Path = path
+	}
 
-	// Define command line flags
-	flag.StringVar(&options.Path, "path", "", "Path to the directory or file to analyze (defaults to current directory if not provided)")
-	flag.StringVar(&options.Model, "model", string(tokenizer.Cl100kBase), "Token counting model to use (e.g., cl100k_base for GPT-4)")
-	flag.BoolVar(&options.RespectGitignore, "gitignore", true, "Whether to respect .gitignore rules")
-	flag.BoolVar(&options.ShowFiles, "files", true, "Whether to show individual file details")
-	flag.IntVar(&options.MinTokens, "min", 0, "Minimum token count for a file to be included")
-	flag.BoolVar(&options.IgnoreHidden, "no-hidden", true, "Whether to ignore hidden files and directories (starting with .)")
-	flag.BoolVar(&options.IsSingleFile, "file", false, "Treat the path as a single file rather than a directory")
-	
-	// Parse command line flags
-	flag.Parse()
-	
 	// If no path is provided via flags, check positional args or use current directory
 	if options.Path == "" {
-		if flag.NArg() > 0 {
-			options.Path = flag.Arg(0)
+		if fs.NArg() > 0 {
+			options.Path = fs.Arg(0)
 		} else {
 			var err error
 			options.Path, err = os.Getwd()
 			if err != nil {
-				fmt.Printf("Error getting current directory: %v\n", err)
-				os.Exit(1)
+				return fmt.Errorf("error getting current directory: %v", err)
 			}
 		}
 	}
-	
+
+	// Fetch remote repositories into a temporary directory and scan that
+	if isGitHubURL(options.Path) {
+		if !options.Quiet {
+			logger.Info("cloning repository", "url", options.Path)
+		}
+		dir, err := fetchGitHubRepo(options.Path)
+		if err != nil {
+			return err
+		}
+		options.Path = dir
+	}
+
+	// Download bucket prefixes into a temporary directory and scan that
+	if isBucketURL(options.Path) {
+		if !options.Quiet {
+			logger.Info("listing bucket", "url", options.Path)
+		}
+		dir, err := fetchBucket(options.Path, options)
+		if err != nil {
+			return err
+		}
+		options.Path = dir
+	}
+
+	// Fetch web pages into a temporary file and count that
+	if isWebURL(options.Path) {
+		if !options.Quiet {
+			logger.Info("fetching page", "url", options.Path)
+		}
+		path, err := fetchWebPage(options.Path, options.Readability)
+		if err != nil {
+			return err
+		}
+		options.Path = path
+	}
+
+	// Windows extended-length paths are scanned through their plain form
+	options.Path = normalizePath(options.Path)
+
+	// Read a pipe, like a process substitution, into a file that can be read again
+	if info, err := os.Stat(options.Path); err == nil && info.Mode()&os.ModeNamedPipe != 0 {
+		path, err := capturePipe(options.Path)
+		if err != nil {
+			return err
+		}
+		options.Path = path
+	}
+
+	// Apply the settings of a config file profile, which may select a revision
+	if err := applyProfile(fs, options); err != nil {
+		return err
+	}
+	if err := loadExtensions(options); err != nil {
+		return err
+	}
+
+	// Count a revision from the object database rather than the working tree
+	if options.Rev != "" {
+		if err := snapshotRev(options); err != nil {
+			return err
+		}
+	}
+
 	// Check if path is a file
 	if !options.IsSingleFile {
 		fileInfo, err := os.Stat(options.Path)
@@ -330,29 +1396,409 @@ func main() {
 		}
 	}
 
-	var repo *RepoTokenInfo
-	var err error
+	// With -archives, an archive is scanned like a directory of its entries
+	if options.Archives && archiveKind(options.Path) != "" {
+		options.IsSingleFile = false
+	}
+	return nil
+}
+
+func main() {
+	defer runExitHooks()
+
+	// Dispatch subcommands. Anything else is a shortcut for scan, so
+	// token-counter <path> keeps working.
+	if len(os.Args) > 1 {
+		if cmd := findCommand(os.Args[1]); cmd != nil {
+			cmd.run(os.Args[2:])
+			return
+		}
+	}
+	findCommand("scan").run(os.Args[1:])
+}
+
+// scanCommand defines the scan subcommand, which counts the tokens in a
+// directory or file and prints the report
+func scanCommand(fs *flag.FlagSet) func() {
+	options := &CommandOptions{}
+	registerFlags(fs, options)
+	registerWalkFlags(fs, options)
+	registerReportFlags(fs, options)
+	fs.BoolVar(&options.IsSingleFile, "file", false, "Treat the path as a single file rather than a directory (like the file subcommand)")
+	fs.BoolVar(&options.Images, "images", false, "Estimate the vision tokens of PNG, JPEG and GIF images for GPT-4o and Claude, reported separately from the text tokens")
+	registerSnippetFlags(fs, options)
+	fs.StringVar(&options.Template, "template", "", "Go text/template file to render the report through, with the fields of the json report, instead of -format")
+	fs.StringVar(&options.SkippedReport, "skipped-report", "", "File to write a JSON list of every file and directory the scan skipped, and why")
+	var filesFrom, otelEndpoint string
+	var dryRun, profileScan bool
+	fs.IntVar(&options.HeadTokens, "head-tokens", 0, "Report where each file's first this many tokens end, in lines and bytes, to see where truncating it would cut (0 to skip)")
+	fs.IntVar(&options.TailTokens, "tail-tokens", 0, "Report where each file's last this many tokens start, in lines and bytes (0 to skip)")
+	fs.StringVar(&otelEndpoint, "otel-endpoint", "", "OpenTelemetry collector to send the scan's spans and metrics to over OTLP/HTTP, e.g. http://localhost:4318")
+	fs.BoolVar(&profileScan, "profile-scan", false, "Report on stderr the time spent walking, reading, decoding, tokenizing and aggregating, the tokenizing speed of each extension and the slowest files")
+	fs.BoolVar(&dryRun, "dry-run", false, "List the files the scan would count, with their sizes, after walking and filtering the tree but without reading them")
+	fs.BoolVar(&options.Cached, "cached", false, "Answer from a running index of the directory if it has every change, otherwise count only the files changed since the last -cached scan")
+	fs.BoolVar(&options.Resume, "resume", false, "Checkpoint the counts made during the scan, and continue an interrupted -resume scan of the same files where it left off")
+	fs.DurationVar(&options.Deadline, "deadline", 0, "Stop counting files after this long, e.g. 30s, and report the files counted, marked as partial with the number left, exiting successfully (0 for no limit)")
+	fs.StringVar(&options.Exec, "exec", "", "Shell command to run and count the output of, as a file of its own, instead of a path (e.g. \"kubectl get pods -A -o yaml\")")
+	fs.StringVar(&filesFrom, "files-from", "", "Count exactly the files listed in this file, or on stdin with -, one per line or NUL-delimited, instead of walking the directory")
+	registerRevFlag(fs, options)
+	copyOptions := &CopyOptions{}
+	registerCopyFlags(fs, copyOptions)
+	estimateOptions := &EstimateOptions{}
+	registerEstimateFlags(fs, estimateOptions)
+	summaryOptions := &SummaryOptions{}
+	registerSummaryFlags(fs, summaryOptions)
+	options.summary = summaryOptions
+	return func() {
+		if err := resolveTarget(fs, options); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		if filesFrom != "" && options.IsSingleFile {
+			fmt.Fprintln(os.Stderr, "Error: -files-from needs a directory to resolve the listed paths against")
+			exit(1)
+		}
+
+		if options.Cached && (options.IsSingleFile || filesFrom != "") {
+			fmt.Fprintln(os.Stderr, "Error: -cached only applies to the scan of a directory")
+			exit(1)
+		}
+
+		if err := validateResume(options, filesFrom); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		if len(options.Models) > 1 && options.unitName() != "tokens" {
+			fmt.Fprintf(os.Stderr, "Error: -models can only be used when counting tokens\n")
+			exit(1)
+		}
+
+		if !outputFormats[options.Format] {
+			fmt.Fprintf(os.Stderr, "Error: unknown format %q (expected text, tree, github-annotations, gh-summary, html, json, jsonl or ndjson, yaml or toml)\n", options.Format)
+			exit(1)
+		}
+		if name, ok := formatAliases[options.Format]; ok {
+			options.Format = name
+		}
+
+		if err := loadTemplate(options); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		if err := loadModelRoutes(options); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		if err := validateSummary(options, summaryOptions); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		if err := validateTiers(options); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		if err := validateCost(options); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		if err := validateTruncation(options); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		if err := validateSnippets(options); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		if options.Format == "jsonl" && !options.Quiet {
+			if err := startJSONLines(options); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+		}
+
+		if u, err := url.Parse(otelEndpoint); otelEndpoint != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+			fmt.Fprintf(os.Stderr, "Error: -otel-endpoint must be an http or https URL, e.g. http://localhost:4318\n")
+			exit(1)
+		}
+
+		if estimateOptions.Enabled {
+			if err := validateEstimate(options, estimateOptions, filesFrom, copyOptions); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+		}
+		if dryRun {
+			if err := validateDryRun(options, estimateOptions, filesFrom, copyOptions); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+		}
+
+		var repo *RepoTokenInfo
+		var err error
+		ctx, cancel := commandContext(options)
+		defer cancel()
+
+		if estimateOptions.Enabled {
+			runEstimate(ctx, options, estimateOptions)
+			return
+		}
+
+		// Collect what the scan leaves out for -skipped-report
+		var skipped []*SkippedFile
+		if options.SkippedReport != "" {
+			options.OnSkip = func(skip *SkippedFile) { skipped = append(skipped, skip) }
+		}
+		writeSkipped := func() {
+			if options.SkippedReport == "" {
+				return
+			}
+			if err := writeSkippedReport(options.SkippedReport, repo, skipped, options); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", options.SkippedReport, err)
+				exit(1)
+			}
+		}
+
+		if dryRun {
+			repo = runDryRun(ctx, options)
+			writeSkipped()
+			PrintErrors(repo)
+			if options.Strict && len(repo.Errors) > 0 {
+				exit(1)
+			}
+			return
+		}
+
+		// Banners go to stderr, so they never mix with the report
+		banners := !options.Quiet
+
+		options.Telemetry = newTelemetry(otelEndpoint, options.Path, options)
+		if profileScan {
+			options.profile = newScanProfile()
+		}
+		options.Telemetry.startPhase("walk")
 	
-	// Process a single file or a repository based on the options
-	if options.IsSingleFile {
-		fmt.Printf("Processing single file: %s\n", options.Path)
-		repo, err = ProcessSingleFile(options.Path, options)
+		// Process a single file or a repository based on the options
+		if options.IsSingleFile {
+			if banners {
+				fmt.Fprintf(os.Stderr, "Processing single file: %s\n", revReportedPath(options.Path, options))
+			}
+			repo, err = ProcessSingleFile(ctx, options.Path, options)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error processing file: %v\n", err)
+				exit(1)
+			}
+		} else if filesFrom != "" {
+			paths, err := readFileList(filesFrom)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading -files-from: %v\n", err)
+				exit(1)
+			}
+			if banners {
+				fmt.Fprintf(os.Stderr, "Processing %d listed files in: %s\n", len(paths), revReportedPath(options.Path, options))
+			}
+			repo, err = ProcessFileList(ctx, options.Path, paths, options)
+			if interrupted(err) && repo != nil {
+				reportPartial(repo, err, options, func() {
+					writeSkipped()
+					printReport(repo, options)
+				})
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error processing files: %v\n", err)
+				exit(1)
+			}
+		} else {
+			if banners {
+				fmt.Fprintf(os.Stderr, "Processing directory: %s\n", revReportedPath(options.Path, options))
+				if options.RespectGitignore {
+					fmt.Fprintln(os.Stderr, "Respecting .gitignore rules if present")
+				}
+			}
+			if options.Cached {
+				repo, err = cachedScan(ctx, options)
+			} else if options.Resume {
+				repo, err = resumableScan(ctx, options)
+			} else {
+				repo, err = ProcessRepository(ctx, options.Path, options)
+			}
+			if interrupted(err) && repo != nil {
+				reportPartial(repo, err, options, func() {
+					writeSkipped()
+					printReport(repo, options)
+				})
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error processing repository: %v\n", err)
+				exit(1)
+			}
+		}
+
+		if copyOptions.Enabled {
+			if err := copySelection(repo, options, copyOptions); err != nil {
+				fmt.Fprintf(os.Stderr, "Error copying to the clipboard: %v\n", err)
+				exit(1)
+			}
+		}
+
+		writeSkipped()
+		printReport(repo, options)
+		if code := tierExitCode(repo, options); code != 0 {
+			exit(code)
+		}
+	}
+}
+
+// fileCommand defines the file subcommand, which counts the tokens in a
+// single file
+func fileCommand(fs *flag.FlagSet) func() {
+	options := &CommandOptions{}
+	registerFlags(fs, options)
+	registerSnippetFlags(fs, options)
+	return func() {
+		if fs.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, "Error: file needs the path of one file")
+			exit(1)
+		}
+		options.Path = normalizePath(fs.Arg(0))
+		options.IsSingleFile = true
+
+		if len(options.Models) > 1 && options.unitName() != "tokens" {
+			fmt.Fprintln(os.Stderr, "Error: -models can only be used when counting tokens")
+			exit(1)
+		}
+		if info, err := os.Stat(options.Path); err == nil && info.IsDir() {
+			fmt.Fprintf(os.Stderr, "Error: %s is a directory; use token-counter scan to count it\n", options.Path)
+			exit(1)
+		}
+		if err := validateSnippets(options); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		if !options.Quiet {
+			fmt.Fprintf(os.Stderr, "Processing single file: %s\n", options.Path)
+		}
+		ctx, cancel := commandContext(options)
+		defer cancel()
+		repo, err := ProcessSingleFile(ctx, options.Path, options)
 		if err != nil {
-			fmt.Printf("Error processing file: %v\n", err)
-			os.Exit(1)
+			fmt.Fprintf(os.Stderr, "Error processing file: %v\n", err)
+			exit(1)
+		}
+
+		printReport(repo, options)
+	}
+}
+
+// printReport prints the results of a scan in the selected format, followed
+// by the errors. Quiet mode prints just the number, so the output can be
+// captured by scripts.
+func printReport(repo *RepoTokenInfo, options *CommandOptions) {
+	options.Telemetry.startPhase("aggregate")
+	options.profile.startAggregate()
+	reportRevPaths(repo, options)
+	if repo.Partial {
+		fmt.Fprintf(os.Stderr, "Warning: %s; showing partial results\n", partialSummary(repo, options))
+	}
+	options.Telemetry.result(repo)
+	if options.WithMetadata {
+		addFileMetadata(repo, options)
+	}
+	if options.Quiet {
+		fmt.Println(repo.TokenCount)
+		// The job summary has a file of its own, so quiet doesn't drop it
+		if options.Format == "gh-summary" && (options.Output != "" || os.Getenv("GITHUB_STEP_SUMMARY") != "") {
+			if err := writeGHSummary(repo, options, options.summary); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing the job summary: %v\n", err)
+				exit(1)
+			}
 		}
 	} else {
-		fmt.Printf("Processing directory: %s\n", options.Path)
-		if options.RespectGitignore {
-			fmt.Println("Respecting .gitignore rules if present")
+		// Blame before writing, so the structured formats include the authors
+		if options.ByAuthor {
+			authors, errs, err := countByAuthor(repo, options)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error attributing tokens to authors: %v\n", err)
+				exit(1)
+			}
+			repo.Authors = authors
+			repo.Errors = append(repo.Errors, errs...)
 		}
-		repo, err = ProcessRepository(options.Path, options)
-		if err != nil {
-			fmt.Printf("Error processing repository: %v\n", err)
-			os.Exit(1)
+		switch options.Format {
+		case "tree":
+			PrintTree(repo, options)
+		case "github-annotations":
+			PrintAnnotations(repo, options)
+		case "gh-summary":
+			if err := writeGHSummary(repo, options, options.summary); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing the job summary: %v\n", err)
+				exit(1)
+			}
+		case "jsonl":
+			if err := options.stream.finish(repo, options); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing the jsonl report: %v\n", err)
+				exit(1)
+			}
+		case "html", "json", "yaml", "toml", "template":
+			if err := writeStructured(structuredFormats[options.Format], repo, options); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing the %s report: %v\n", options.Format, err)
+				exit(1)
+			}
+		default:
+			PrintResults(repo, options)
+		}
+		if len(repo.Images) > 0 && (options.Format == "text" || options.Format == "tree") {
+			fmt.Println()
+			PrintImages(repo, options)
+		}
+		if options.Stats && (options.Format == "text" || options.Format == "tree") {
+			fmt.Println()
+			PrintStats(repo, options)
+		}
+		if options.ByAuthor && (options.Format == "text" || options.Format == "tree") {
+			fmt.Println()
+			PrintAuthors(repo.Authors, options)
+		}
+		if options.ByAge && (options.Format == "text" || options.Format == "tree") {
+			fmt.Println()
+			PrintAges(countByAge(repo, options), options)
+		}
+		if options.hasTiers() && (options.Format == "text" || options.Format == "tree") {
+			fmt.Println()
+			printTierSummary(repo, options)
 		}
 	}
-	
-	// Print results
-	PrintResults(repo, options)
-}
\ No newline at end of file
+
+	if options.summary != nil && options.summary.SetOutput {
+		if err := setGitHubOutput(repo, options, options.summary); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	}
+
+	// The profile goes to stderr too, after the report it timed
+	if options.profile != nil {
+		root := repo.Path
+		if options.IsSingleFile {
+			root = filepath.Dir(root)
+		}
+		fmt.Fprintln(os.Stderr)
+		options.profile.print(os.Stderr, root, options)
+	}
+
+	// Report per-file errors separately, so they never mix with the results
+	PrintErrors(repo)
+	if options.Strict && len(repo.Errors) > 0 {
+		exit(1)
+	}
+}
@@ -0,0 +1,530 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestMain keeps the user's and the system's git configuration, such as a
+// global excludes file, out of the scans the tests make
+func TestMain(m *testing.M) {
+	home, err := os.MkdirTemp("", "token-counter-test")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("HOME", home)
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	os.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	os.Unsetenv("GIT_CONFIG_GLOBAL")
+	code := m.Run()
+	os.RemoveAll(home)
+	os.Exit(code)
+}
+
+// testOptions returns the options of a command given args, with the flags
+// scan registers
+func testOptions(t *testing.T, args ...string) *CommandOptions {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	options := &CommandOptions{}
+	registerFlags(fs, options)
+	registerWalkFlags(fs, options)
+	registerReportFlags(fs, options)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return options
+}
+
+// writeTree creates the files under dir, by slash-separated path
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// captureStdout returns what f prints to stdout
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	return capture(t, &os.Stdout, f)
+}
+
+// captureStderr returns what f prints to stderr
+func captureStderr(t *testing.T, f func()) string {
+	t.Helper()
+	return capture(t, &os.Stderr, f)
+}
+
+// capture returns what f writes to the file *stream, standing in for it
+func capture(t *testing.T, stream **os.File, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := *stream
+	*stream = w
+	defer func() { *stream = saved }()
+	done := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- data
+	}()
+	f()
+	w.Close()
+	return string(<-done)
+}
+
+// countedPaths returns the paths of the files a scan of root listed,
+// relative to it and sorted
+func countedPaths(root string, repo *RepoTokenInfo) []string {
+	var paths []string
+	for _, dirInfo := range repo.Dirs {
+		for _, fileInfo := range dirInfo.Files {
+			paths = append(paths, relativeTo(root, fileInfo.Path))
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// runGit runs git in dir as a fixed author, skipping the test if git isn't
+// installed, and returns its output
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git isn't installed")
+	}
+	cmd := exec.Command("git", append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com", "-c", "init.defaultBranch=main"}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v: %s", args, err, out)
+	}
+	return string(out)
+}
+
+// exitTestEnv names the test a subprocess of exitStatus runs the function of
+const exitTestEnv = "TOKEN_COUNTER_EXIT_TEST"
+
+// exitStatus runs f, which is expected to exit, in a subprocess running just
+// the current test, and returns what it printed to stderr and its exit code.
+// The subprocess runs the first exitStatus of the test, so each test or
+// subtest calls it at most once.
+func exitStatus(t *testing.T, f func()) (string, int) {
+	t.Helper()
+	if os.Getenv(exitTestEnv) == t.Name() {
+		f()
+		t.SkipNow()
+	}
+	var pattern []string
+	for _, part := range strings.Split(t.Name(), "/") {
+		pattern = append(pattern, "^"+regexp.QuoteMeta(part)+"$")
+	}
+	cmd := exec.Command(os.Args[0], "-test.run", strings.Join(pattern, "/"))
+	cmd.Env = append(os.Environ(), exitTestEnv+"="+t.Name())
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		t.Fatal(err)
+	}
+	return stderr.String(), cmd.ProcessState.ExitCode()
+}
+
+// scanTree counts the files of dir with the options of args
+func scanTree(t *testing.T, dir string, args ...string) (*RepoTokenInfo, *CommandOptions) {
+	t.Helper()
+	options := testOptions(t, args...)
+	options.Path = dir
+	repo, err := ProcessRepository(context.Background(), dir, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo, options
+}
+
+func TestSymlinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		files   []string
+		tokens  int
+		skipped map[string]string
+	}{
+		{
+			name:   "not following",
+			files:  []string{"a.txt", "linked.txt", "sub/b.txt"},
+			tokens: 5,
+			skipped: map[string]string{
+				"dangles": "broken symlink",
+				"pkg":     "not following symlinks",
+				"pkg2":    "not following symlinks",
+				"sub/up":  "not following symlinks",
+			},
+		},
+		{
+			name:   "following",
+			args:   []string{"-follow-symlinks"},
+			files:  []string{"a.txt", "pkg/c.txt", "sub/b.txt"},
+			tokens: 4,
+			skipped: map[string]string{
+				"dangles": "broken symlink",
+				"pkg2":    "duplicate link to an already-walked directory",
+				"sub/up":  "symlink cycle",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root, ext := t.TempDir(), t.TempDir()
+			writeTree(t, root, map[string]string{"a.txt": "hello world", "sub/b.txt": "x"})
+			writeTree(t, ext, map[string]string{"c.txt": "one"})
+			for link, target := range map[string]string{
+				"linked.txt": "a.txt",
+				"pkg":        ext,
+				"pkg2":       ext,
+				"sub/up":     "..",
+				"dangles":    "missing.txt",
+			} {
+				if err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(link))); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			repo, _ := scanTree(t, root, append([]string{"-model", "cl100k_base"}, tt.args...)...)
+			files := countedPaths(root, repo)
+			if !reflect.DeepEqual(files, tt.files) || repo.TokenCount != tt.tokens {
+				t.Errorf("counted %v, %d tokens, want %v, %d tokens", files, repo.TokenCount, tt.files, tt.tokens)
+			}
+			skipped := make(map[string]string)
+			for _, link := range repo.SkippedSymlinks {
+				skipped[relativeTo(root, link.Path)] = link.Reason
+			}
+			if !reflect.DeepEqual(skipped, tt.skipped) {
+				t.Errorf("skipped symlinks %v, want %v", skipped, tt.skipped)
+			}
+		})
+	}
+}
+
+func TestCountLines(t *testing.T) {
+	tests := []struct {
+		data string
+		want int
+	}{
+		{"", 0},
+		{"one", 1},
+		{"one\n", 1},
+		{"one\ntwo", 2},
+		{"\n\n", 2},
+	}
+	for _, tt := range tests {
+		if got := countLines([]byte(tt.data)); got != tt.want {
+			t.Errorf("countLines(%q) = %d, want %d", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestDensity(t *testing.T) {
+	tests := []struct {
+		file    FileTokenInfo
+		perLine float64
+		perKB   float64
+	}{
+		{FileTokenInfo{TokenCount: 100, Lines: 10, Bytes: 512}, 10, 200},
+		{FileTokenInfo{}, 0, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.file.TokensPerLine(); got != tt.perLine {
+			t.Errorf("TokensPerLine() = %v, want %v", got, tt.perLine)
+		}
+		if got := tt.file.TokensPerKB(); got != tt.perKB {
+			t.Errorf("TokensPerKB() = %v, want %v", got, tt.perKB)
+		}
+	}
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world\nhello world\n"})
+	repo, _ := scanTree(t, dir, "-model", "cl100k_base")
+	file := repo.Dirs[dir].Files[0]
+	if file.Lines != 2 || file.Bytes != 24 || file.TokensPerLine() != 3 {
+		t.Errorf("a.txt has %d lines, %d bytes, %v tokens per line, want 2, 24 and 3", file.Lines, file.Bytes, file.TokensPerLine())
+	}
+}
+
+func TestProcessSingleFile(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world", "logo.png": "\x89PNG\r\n\x1a\n", "sub/b.txt": "x"})
+	tests := []struct {
+		name    string
+		path    string
+		tokens  int
+		wantErr string
+	}{
+		{"text file", "a.txt", 2, ""},
+		{"directory", "sub", 0, "is a directory"},
+		{"missing file", "missing.txt", 0, "error accessing file"},
+		{"binary file", "logo.png", 0, "skipping"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := testOptions(t, "-model", "cl100k_base")
+			options.IsSingleFile = true
+			repo, err := ProcessSingleFile(context.Background(), filepath.Join(dir, tt.path), options)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ProcessSingleFile error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if repo.TokenCount != tt.tokens {
+				t.Errorf("TokenCount = %d, want %d", repo.TokenCount, tt.tokens)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	repo := &RepoTokenInfo{Errors: []*FileError{
+		{"a.txt", os.ErrPermission},
+		{"b.txt", &os.PathError{Op: "open", Path: "b.txt", Err: os.ErrNotExist}},
+		{"c.txt", os.ErrPermission},
+		{"d.txt", io.ErrUnexpectedEOF},
+	}}
+	if got, want := errorSummary(repo.Errors), "2 permission denied, 1 not found, 1 other"; got != want {
+		t.Errorf("errorSummary = %q, want %q", got, want)
+	}
+	out := captureStderr(t, func() { PrintErrors(repo) })
+	if !strings.HasPrefix(out, "Errors (4): 2 permission denied") || !strings.Contains(out, "d.txt: unexpected EOF") {
+		t.Errorf("PrintErrors printed:\n%s", out)
+	}
+	if out := captureStderr(t, func() { PrintErrors(&RepoTokenInfo{}) }); out != "" {
+		t.Errorf("PrintErrors without errors printed %q", out)
+	}
+}
+
+func TestUnreadableFiles(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can read every file")
+	}
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello", "secret.txt": "x", "locked/b.txt": "y"})
+	if err := os.Chmod(filepath.Join(dir, "secret.txt"), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(dir, "locked"), 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(filepath.Join(dir, "locked"), 0o755)
+
+	// An unreadable file is kept as an error, and the scan goes on
+	repo, _ := scanTree(t, dir, "-model", "cl100k_base")
+	if got := countedPaths(dir, repo); !reflect.DeepEqual(got, []string{"a.txt"}) {
+		t.Errorf("counted %v, want only a.txt", got)
+	}
+	if got := errorSummary(repo.Errors); got != "2 permission denied" {
+		t.Errorf("errors %v, want 2 permission denied", repo.Errors)
+	}
+
+	// With -strict or without -skip-errors, an unreadable directory stops
+	// the scan
+	for _, args := range [][]string{{"-strict"}, {"-skip-errors=false"}} {
+		options := testOptions(t, append([]string{"-model", "cl100k_base"}, args...)...)
+		if _, err := ProcessRepository(context.Background(), dir, options); !errors.Is(err, os.ErrPermission) {
+			t.Errorf("ProcessRepository with %v = %v, want a permission error", args, err)
+		}
+	}
+}
+
+func TestPrintErrors(t *testing.T) {
+	repo := &RepoTokenInfo{Errors: []*FileError{
+		{"locked", os.ErrPermission},
+		{"gone.txt", &os.PathError{Op: "open", Path: "gone.txt", Err: os.ErrNotExist}},
+		{"secret.txt", &os.PathError{Op: "open", Path: "secret.txt", Err: os.ErrPermission}},
+	}}
+	out := captureStderr(t, func() { PrintErrors(repo) })
+	if !strings.HasPrefix(out, "Errors (3): 2 permission denied, 1 not found\n-----------\n") || !strings.Contains(out, "gone.txt") {
+		t.Errorf("PrintErrors printed:\n%s", out)
+	}
+	if out := captureStderr(t, func() { PrintErrors(&RepoTokenInfo{}) }); out != "" {
+		t.Errorf("PrintErrors without errors printed %q", out)
+	}
+}
+
+func TestPrintResultsPercentages(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"a/x.txt": "word word word word word word",
+		"b/y.txt": "word word word",
+		"c/z.txt": "word",
+	})
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		notWant []string
+	}{
+		{"shares", nil, []string{
+			"a: 6 tokens (60.0% of total, 60.0% cumulative)",
+			"b: 3 tokens (30.0% of total, 90.0% cumulative)",
+			"c: 1 tokens (10.0% of total, 100.0% cumulative)",
+			"  |- a/x.txt: 6 tokens (60.0% of total,",
+		}, nil},
+		{"no files", []string{"-files=false"}, []string{"a: 6 tokens (60.0% of total, 60.0% cumulative)"}, []string{"|- a/x.txt"}},
+		{"min-dir-tokens", []string{"-min-dir-tokens", "2"}, []string{
+			"b: 3 tokens (30.0% of total, 90.0% cumulative)",
+			"1 directories below -min-dir-tokens: 1 tokens (10.0% of total)",
+		}, []string{"c: 1 tokens"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, options := scanTree(t, dir, append([]string{"-model", "cl100k_base", "-color", "never"}, tt.args...)...)
+			out := captureStdout(t, func() { PrintResults(repo, options) })
+			for _, want := range tt.want {
+				if !strings.Contains(out, want) {
+					t.Errorf("report is missing %q:\n%s", want, out)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(out, notWant) {
+					t.Errorf("report has %q:\n%s", notWant, out)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxFileBytes(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"small.txt": "hello",
+		"data.csv":  strings.Repeat("1,2,3\n", 400),
+	})
+
+	tests := []struct {
+		limit string
+		want  []string
+	}{
+		{"0", []string{"data.csv", "small.txt"}},
+		{"1K", []string{"small.txt"}},
+		{"2400", []string{"data.csv", "small.txt"}},
+		{"2399", []string{"small.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.limit, func(t *testing.T) {
+			var skipped []*SkippedFile
+			options := testOptions(t, "-model", "cl100k_base", "-max-file-bytes", tt.limit)
+			options.Path = dir
+			options.OnSkip = func(s *SkippedFile) { skipped = append(skipped, s) }
+			repo, err := ProcessRepository(context.Background(), dir, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := countedPaths(dir, repo); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("counted %v, want %v", got, tt.want)
+			}
+			if len(tt.want) == 1 && (len(skipped) != 1 || skipped[0].Reason != "size") {
+				t.Errorf("skipped %+v, want data.csv for its size", skipped)
+			}
+		})
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	registerWalkFlags(fs, &CommandOptions{})
+	if err := fs.Parse([]string{"-max-file-bytes", "big"}); err == nil {
+		t.Error("-max-file-bytes big was accepted")
+	}
+}
+
+func TestScanStreams(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world"})
+
+	tests := []struct {
+		format string
+		stdout string
+	}{
+		{"json", `"total": 2`},
+		{"text", "a.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var stdout string
+			stderr := captureStderr(t, func() {
+				stdout = captureStdout(t, func() {
+					findCommand("scan").run([]string{"-model", "cl100k_base", "-format", tt.format, dir})
+				})
+			})
+			if !strings.Contains(stderr, "Processing directory: "+dir) {
+				t.Errorf("stderr has no banner:\n%s", stderr)
+			}
+			if strings.Contains(stdout, "Processing directory") || !strings.Contains(stdout, tt.stdout) {
+				t.Errorf("stdout:\n%s", stdout)
+			}
+		})
+	}
+
+	stderr, code := exitStatus(t, func() {
+		findCommand("scan").run([]string{"-format", "xml", dir})
+	})
+	if code != 1 || !strings.Contains(stderr, `Error: unknown format "xml"`) {
+		t.Errorf("unknown format: exit %d, stderr:\n%s", code, stderr)
+	}
+}
+
+func TestBelowMin(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"small.txt": "hi", "tiny.txt": "yo", "large.txt": strings.Repeat("word ", 100)})
+	tests := []struct {
+		name    string
+		args    []string
+		total   int
+		summary string
+		result  *BelowMinResult
+	}{
+		{"counted in the total", []string{"-min", "10"}, 103, "2 files below -min: 2 tokens (1.9% of total)", &BelowMinResult{Files: 2, Total: 2, InTotal: true}},
+		{"left out of the total", []string{"-min", "10", "-filter-affects-totals"}, 101, "2 files below -min: 2 tokens, not included in the total", &BelowMinResult{Files: 2, Total: 2}},
+		{"without -min", nil, 103, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, options := scanTree(t, dir, append([]string{"-model", "cl100k_base"}, tt.args...)...)
+			if repo.TokenCount != tt.total {
+				t.Errorf("total %d, want %d", repo.TokenCount, tt.total)
+			}
+			if got := belowMinSummary(repo, options); got != tt.summary {
+				t.Errorf("summary %q, want %q", got, tt.summary)
+			}
+			if got := newScanResult(repo, options).BelowMin; !reflect.DeepEqual(got, tt.result) {
+				t.Errorf("below_min %+v, want %+v", got, tt.result)
+			}
+			if got := countedPaths(dir, repo); len(tt.args) > 0 && !reflect.DeepEqual(got, []string{"large.txt"}) {
+				t.Errorf("listed %v, want only large.txt", got)
+			}
+		})
+	}
+}
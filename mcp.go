@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// mcpProtocolVersion is the Model Context Protocol revision the server speaks
+const mcpProtocolVersion = "2024-11-05"
+
+// rpcRequest is an incoming JSON-RPC 2.0 request or notification (which has
+// no ID)
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// rpcResponse is an outgoing JSON-RPC 2.0 response
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// JSON-RPC error codes
+const (
+	rpcParseError     = -32700
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcServerError    = -32000 // A method failed, e.g. on a missing file
+)
+
+// mcpTool describes a tool in the tools/list response
+type mcpTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+}
+
+// mcpToolResult is the result of a tools/call request. Tool failures are
+// reported here with IsError, so the model sees them, rather than as
+// protocol errors.
+type mcpToolResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError,omitempty"`
+}
+
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// mcpServer answers MCP requests using the options given on the command line
+// as defaults for every tool call
+type mcpServer struct {
+	options *CommandOptions
+	out     *json.Encoder
+}
+
+// mcpTools lists the tools the server exposes
+var mcpTools = []mcpTool{
+	{
+		Name:        "count_tokens",
+		Description: "Count the tokens in a piece of text.",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"text":  map[string]interface{}{"type": "string", "description": "Text to count"},
+				"model": map[string]interface{}{"type": "string", "description": "Encoding to count with, e.g. cl100k_base or o200k_base"},
+			},
+			"required": []string{"text"},
+		},
+	},
+	{
+		Name:        "count_file",
+		Description: "Count the tokens in a local file.",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path":  map[string]interface{}{"type": "string", "description": "Path of the file"},
+				"model": map[string]interface{}{"type": "string", "description": "Encoding to count with, e.g. cl100k_base or o200k_base"},
+			},
+			"required": []string{"path"},
+		},
+	},
+	{
+		Name:        "scan_directory",
+		Description: "Count the tokens in every text file under a local directory, respecting .gitignore and .tokenignore. Returns the total and the largest directories and files.",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"path":       map[string]interface{}{"type": "string", "description": "Path of the directory"},
+				"model":      map[string]interface{}{"type": "string", "description": "Encoding to count with, e.g. cl100k_base or o200k_base"},
+				"min_tokens": map[string]interface{}{"type": "integer", "description": "Minimum token count for a file to be listed; smaller files still count in the total"},
+				"limit":      map[string]interface{}{"type": "integer", "description": "Maximum number of files to list (default 50)"},
+			},
+			"required": []string{"path"},
+		},
+	},
+}
+
+// mcpCommand defines the mcp subcommand, which runs a Model Context Protocol
+// server on stdin and stdout so agents can ask for token counts directly
+func mcpCommand(fs *flag.FlagSet) func() {
+	options := &CommandOptions{}
+	registerFlags(fs, options)
+	registerWalkFlags(fs, options)
+	return func() {
+		// Profiles come from the config file of the working directory
+		if err := applyProfile(fs, options); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		server := &mcpServer{options: options, out: json.NewEncoder(os.Stdout)}
+		if err := server.serve(os.Stdin); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	}
+}
+
+// serve reads newline-delimited JSON-RPC messages from r until it's closed
+func (s *mcpServer) serve(r io.Reader) error {
+	return serveRPC(r, s.out, s.handle)
+}
+
+// serveRPC reads newline-delimited JSON-RPC messages from r until it's
+// closed, answering each request with the result of handle
+func serveRPC(r io.Reader, out *json.Encoder, handle func(*rpcRequest) (interface{}, *rpcError)) error {
+	reply := func(resp rpcResponse) {
+		resp.JSONRPC = "2.0"
+		if err := out.Encode(resp); err != nil {
+			logger.Error("writing response", "error", err)
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	// Requests can carry whole documents to count
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var req rpcRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			reply(rpcResponse{ID: json.RawMessage("null"), Error: &rpcError{rpcParseError, err.Error()}})
+			continue
+		}
+
+		result, rpcErr := handle(&req)
+		// Notifications don't get a response
+		if len(req.ID) == 0 {
+			continue
+		}
+		reply(rpcResponse{ID: req.ID, Result: result, Error: rpcErr})
+	}
+	return scanner.Err()
+}
+
+// handle dispatches a request to its method
+func (s *mcpServer) handle(req *rpcRequest) (interface{}, *rpcError) {
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"protocolVersion": mcpProtocolVersion,
+			"capabilities":    map[string]interface{}{"tools": map[string]interface{}{}},
+			"serverInfo":      map[string]interface{}{"name": "token-counter", "version": toolVersion()},
+		}, nil
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "tools/list":
+		return map[string]interface{}{"tools": mcpTools}, nil
+	case "tools/call":
+		var params struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &rpcError{rpcInvalidParams, err.Error()}
+		}
+		return s.callTool(params.Name, params.Arguments)
+	default:
+		if len(req.ID) == 0 {
+			// Notifications such as notifications/initialized need no handling
+			return nil, nil
+		}
+		return nil, &rpcError{rpcMethodNotFound, fmt.Sprintf("method not found: %s", req.Method)}
+	}
+}
+
+// toolArguments holds the arguments of every tool; each tool uses a subset
+type toolArguments struct {
+	Text      string `json:"text"`
+	Path      string `json:"path"`
+	Model     string `json:"model"`
+	MinTokens int    `json:"min_tokens"`
+	Limit     int    `json:"limit"`
+}
+
+// callTool runs a tool and wraps its JSON result, or its error, as text content
+func (s *mcpServer) callTool(name string, rawArgs json.RawMessage) (interface{}, *rpcError) {
+	var args toolArguments
+	if len(rawArgs) > 0 {
+		if err := json.Unmarshal(rawArgs, &args); err != nil {
+			return nil, &rpcError{rpcInvalidParams, err.Error()}
+		}
+	}
+	if args.Path != "" {
+		args.Path = normalizePath(args.Path)
+	}
+
+	var result interface{}
+	var err error
+	switch name {
+	case "count_tokens":
+		result, err = s.countTokens(&args)
+	case "count_file":
+		result, err = s.countFile(&args)
+	case "scan_directory":
+		result, err = s.scanDirectory(&args)
+	default:
+		return nil, &rpcError{rpcInvalidParams, fmt.Sprintf("unknown tool: %s", name)}
+	}
+	if err != nil {
+		return mcpToolResult{Content: []mcpContent{{"text", err.Error()}}, IsError: true}, nil
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, &rpcError{rpcInvalidParams, err.Error()}
+	}
+	return mcpToolResult{Content: []mcpContent{{"text", string(data)}}}, nil
+}
+
+// toolOptions returns a copy of the server options with the model from a
+// tool call applied
+func (s *mcpServer) toolOptions(args *toolArguments) *CommandOptions {
+	options := *s.options
+	options.Models = nil
+	if args.Model != "" {
+		options.Model = args.Model
+		options.TokenizerFile, options.BPEVocab, options.BPEEncoder = "", "", ""
+	}
+	return &options
+}
+
+type mcpFileCount struct {
+	Path   string `json:"path"`
+	Tokens int    `json:"tokens"`
+	Bytes  int    `json:"bytes"`
+	Lines  int    `json:"lines"`
+}
+
+type mcpDirCount struct {
+	Path   string `json:"path"`
+	Tokens int    `json:"tokens"`
+	Files  int    `json:"files"`
+}
+
+func (s *mcpServer) countTokens(args *toolArguments) (interface{}, error) {
+	options := s.toolOptions(args)
+	encs, err := newCodecs(options)
+	if err != nil {
+		return nil, err
+	}
+	count, err := countUnits(args.Text, encs[0], options.CountMode)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{options.unitName(): count, "model": encs[0].Name}, nil
+}
+
+func (s *mcpServer) countFile(args *toolArguments) (interface{}, error) {
+	if args.Path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+	options := s.toolOptions(args)
+	ctx, cancel := withTimeout(context.Background(), options)
+	defer cancel()
+	repo, err := ProcessSingleFile(ctx, args.Path, options)
+	if err != nil {
+		return nil, err
+	}
+	if len(repo.Errors) > 0 {
+		return nil, repo.Errors[0]
+	}
+	return map[string]interface{}{"path": args.Path, options.unitName(): repo.TokenCount, "model": options.Model}, nil
+}
+
+func (s *mcpServer) scanDirectory(args *toolArguments) (interface{}, error) {
+	if args.Path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+	info, err := os.Stat(args.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", args.Path)
+	}
+
+	options := s.toolOptions(args)
+	options.MinTokens = args.MinTokens
+	ctx, cancel := withTimeout(context.Background(), options)
+	defer cancel()
+	repo, err := ProcessRepository(ctx, args.Path, options)
+	if interrupted(err) {
+		err = fmt.Errorf("scan %v", interruptedError(err, options))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return scanSummary(args.Path, repo, options, args.Limit), nil
+}
+
+// scanSummary returns the total of a scan with its largest directories and
+// files, at most limit of each (50 if limit isn't positive), relative to root
+func scanSummary(root string, repo *RepoTokenInfo, options *CommandOptions, limit int) map[string]interface{} {
+	if limit <= 0 {
+		limit = 50
+	}
+
+	var dirs []mcpDirCount
+	var files []mcpFileCount
+	fileCount := 0
+	for _, dirInfo := range repo.Dirs {
+		dirs = append(dirs, mcpDirCount{relativeTo(root, dirInfo.Path), dirInfo.TokenCount, len(dirInfo.Files)})
+		for _, fileInfo := range dirInfo.Files {
+			files = append(files, mcpFileCount{relativeTo(root, fileInfo.Path), fileInfo.TokenCount, fileInfo.Bytes, fileInfo.Lines})
+		}
+		fileCount += len(dirInfo.Files)
+	}
+	// Ties are broken by path, so answers don't change from one call to the
+	// next
+	sort.Slice(dirs, func(i, j int) bool {
+		if dirs[i].Tokens != dirs[j].Tokens {
+			return dirs[i].Tokens > dirs[j].Tokens
+		}
+		return dirs[i].Path < dirs[j].Path
+	})
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Tokens != files[j].Tokens {
+			return files[i].Tokens > files[j].Tokens
+		}
+		return files[i].Path < files[j].Path
+	})
+	if len(files) > limit {
+		files = files[:limit]
+	}
+	if len(dirs) > limit {
+		dirs = dirs[:limit]
+	}
+
+	var errs []string
+	for _, fileErr := range repo.Errors {
+		errs = append(errs, fileErr.Error())
+	}
+
+	return map[string]interface{}{
+		"path":        root,
+		"model":       options.Model,
+		"unit":        options.unitName(),
+		"total":       repo.TokenCount,
+		"files":       fileCount,
+		"directories": dirs,
+		"largest":     files,
+		"errors":      errs,
+	}
+}
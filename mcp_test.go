@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mcpExchange sends requests, one per line, to an MCP server with the
+// options of args and returns its responses
+func mcpExchange(t *testing.T, requests []string, args ...string) []rpcResponse {
+	t.Helper()
+	var out bytes.Buffer
+	server := &mcpServer{options: testOptions(t, args...), out: json.NewEncoder(&out)}
+	if err := server.serve(strings.NewReader(strings.Join(requests, "\n"))); err != nil {
+		t.Fatal(err)
+	}
+	var responses []rpcResponse
+	decoder := json.NewDecoder(&out)
+	for decoder.More() {
+		var resp rpcResponse
+		if err := decoder.Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		responses = append(responses, resp)
+	}
+	return responses
+}
+
+// toolCall returns the request calling an MCP tool with the arguments
+func toolCall(id int, name string, arguments string) string {
+	return fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"name":%q,"arguments":%s}}`, id, name, arguments)
+}
+
+func TestMCPServer(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world", "sub/b.txt": "one two three"})
+	pathArgs := func(path string, extra string) string {
+		data, _ := json.Marshal(path)
+		return fmt.Sprintf(`{"path":%s%s}`, data, extra)
+	}
+
+	tests := []struct {
+		name    string
+		request string
+		want    string // In the response's text content, or its error message
+		isError bool   // Whether the tool reports an error
+		rpcErr  int    // The JSON-RPC error code, if the request fails
+	}{
+		{"initialize", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{}}`, "", false, 0},
+		{"tools/list", `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`, "", false, 0},
+		{"count_tokens", toolCall(1, "count_tokens", `{"text":"hello world"}`), `"tokens": 2`, false, 0},
+		{"count_tokens with a model", toolCall(1, "count_tokens", `{"text":"hello world","model":"o200k_base"}`), `"model": "o200k_base"`, false, 0},
+		{"count_tokens with an unknown model", toolCall(1, "count_tokens", `{"text":"x","model":"no-such-model"}`), "no-such-model", true, 0},
+		{"count_file", toolCall(1, "count_file", pathArgs(filepath.Join(dir, "a.txt"), "")), `"tokens": 2`, false, 0},
+		{"count_file of a missing file", toolCall(1, "count_file", pathArgs(filepath.Join(dir, "missing.txt"), "")), "error accessing file", true, 0},
+		{"count_file without a path", toolCall(1, "count_file", `{}`), "path is required", true, 0},
+		{"scan_directory", toolCall(1, "scan_directory", pathArgs(dir, `,"limit":1`)), `"total": 5`, false, 0},
+		{"scan_directory of a file", toolCall(1, "scan_directory", pathArgs(filepath.Join(dir, "a.txt"), "")), "is not a directory", true, 0},
+		{"unknown tool", toolCall(1, "delete_files", `{}`), "unknown tool", false, rpcInvalidParams},
+		{"unknown method", `{"jsonrpc":"2.0","id":1,"method":"resources/list"}`, "method not found", false, rpcMethodNotFound},
+		{"malformed request", `{"jsonrpc":`, "", false, rpcParseError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses := mcpExchange(t, []string{tt.request}, "-model", "cl100k_base")
+			if len(responses) != 1 {
+				t.Fatalf("got %d responses, want 1", len(responses))
+			}
+			resp := responses[0]
+			if tt.rpcErr != 0 {
+				if resp.Error == nil || resp.Error.Code != tt.rpcErr || !strings.Contains(resp.Error.Message, tt.want) {
+					t.Errorf("error = %+v, want code %d with %q", resp.Error, tt.rpcErr, tt.want)
+				}
+				return
+			}
+			if resp.Error != nil {
+				t.Fatalf("error = %+v", resp.Error)
+			}
+			data, _ := json.Marshal(resp.Result)
+			var result mcpToolResult
+			json.Unmarshal(data, &result)
+			if tt.want == "" {
+				return
+			}
+			if len(result.Content) != 1 || !strings.Contains(result.Content[0].Text, tt.want) || result.IsError != tt.isError {
+				t.Errorf("result = %+v, want %q (error %v)", result, tt.want, tt.isError)
+			}
+		})
+	}
+}
+
+func TestMCPNotifications(t *testing.T) {
+	responses := mcpExchange(t, []string{
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		"",
+		`{"jsonrpc":"2.0","id":"a","method":"ping"}`,
+	})
+	if len(responses) != 1 || string(responses[0].ID) != `"a"` {
+		t.Errorf("responses = %+v, want only the ping's", responses)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sync"
+)
+
+// memoryBudget limits the bytes of file contents held at once by the files
+// being counted. A file larger than the whole budget is counted on its own.
+type memoryBudget struct {
+	mu    sync.Mutex
+	freed *sync.Cond
+	limit int64
+	used  int64
+}
+
+// setMemoryLimit applies -max-memory: the Go runtime collects garbage harder
+// as the process nears the limit, and half of it is the budget of the file
+// contents being counted, which slows down the counting workers instead of
+// letting them read more
+func setMemoryLimit(options *CommandOptions, limit int64) {
+	options.MaxMemory = limit
+	if limit <= 0 {
+		options.memory = nil
+		return
+	}
+	debug.SetMemoryLimit(limit)
+	budget := &memoryBudget{limit: limit / 2}
+	budget.freed = sync.NewCond(&budget.mu)
+	options.memory = budget
+}
+
+// acquire waits until n more bytes fit in the budget, and returns the
+// function that gives them back. A nil budget doesn't wait.
+func (b *memoryBudget) acquire(n int64) func() {
+	if b == nil {
+		return func() {}
+	}
+	b.mu.Lock()
+	for b.used > 0 && b.used+n > b.limit {
+		b.freed.Wait()
+	}
+	b.used += n
+	b.mu.Unlock()
+	return func() {
+		b.mu.Lock()
+		b.used -= n
+		b.mu.Unlock()
+		b.freed.Broadcast()
+	}
+}
+
+// discardFile forgets the per-file record of a file already added to the
+// totals, for scans that stream their files rather than report them
+func (repo *RepoTokenInfo) discardFile(fileInfo *FileTokenInfo) {
+	dirInfo := repo.Dirs[filepath.Dir(fileInfo.Path)]
+	if n := len(dirInfo.Files); n > 0 && dirInfo.Files[n-1] == fileInfo {
+		dirInfo.Files[n-1] = nil
+		dirInfo.Files = dirInfo.Files[:n-1]
+		repo.DiscardedFiles++
+	}
+}
+
+// jsonLines streams the files of a scan as JSON Lines, one object per file
+// as it's counted, and ends with the totals
+type jsonLines struct {
+	w    io.Writer
+	file *os.File // -output, if the lines go to a file
+	enc  *json.Encoder
+	root string
+}
+
+// StreamedTotal is the last line of a -format jsonl scan
+type StreamedTotal struct {
+	Metadata  *ScanMetadata    `json:"metadata"`
+	Total     int              `json:"total"`
+	Cost      *CostEstimate    `json:"cost,omitempty"`
+	Generated *GeneratedResult `json:"generated,omitempty"`
+	Errors    int              `json:"errors,omitempty"`
+}
+
+// startJSONLines sets up a scan to stream its files to -output, or stdout,
+// and to keep only their totals
+func startJSONLines(options *CommandOptions) error {
+	stream := &jsonLines{w: os.Stdout, root: options.Path}
+	if options.Output != "" {
+		file, err := os.Create(options.Output)
+		if err != nil {
+			return err
+		}
+		stream.w, stream.file = file, file
+	}
+	stream.enc = json.NewEncoder(stream.w)
+	options.stream = stream
+	options.DiscardFiles = true
+	options.OnFile = func(fileInfo *FileTokenInfo) error {
+		path := fileInfo.Path
+		if rel, err := filepath.Rel(stream.root, path); err == nil {
+			path = filepath.ToSlash(rel)
+		}
+		return stream.enc.Encode(&FileResult{
+			Path:        path,
+			Total:       fileInfo.TokenCount,
+			Bytes:       fileInfo.Bytes,
+			Lines:       fileInfo.Lines,
+			ModelTotals: fileInfo.ModelCounts,
+			Model:       fileInfo.Model,
+			Stripped:    fileInfo.StrippedTokenCount,
+			Segments:    fileInfo.Segments,
+			Encoding:    fileInfo.Encoding,
+			Generated:   fileInfo.Generated,
+			Head:        fileInfo.Head,
+			Tail:        fileInfo.Tail,
+		})
+	}
+	return nil
+}
+
+// finish writes the line with the totals of the scan and closes -output
+func (s *jsonLines) finish(repo *RepoTokenInfo, options *CommandOptions) error {
+	total := &StreamedTotal{
+		Metadata: newScanMetadata(repo, options),
+		Total:    repo.TokenCount,
+		Cost:     estimateCost(repo.TokenCount, options),
+		Errors:   len(repo.Errors),
+	}
+	if repo.GeneratedFiles > 0 {
+		total.Generated = &GeneratedResult{Files: repo.GeneratedFiles, Total: repo.GeneratedTokens}
+	}
+	err := s.enc.Encode(total)
+	if s.file != nil {
+		if closeErr := s.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryBudget(t *testing.T) {
+	var none *memoryBudget
+	none.acquire(1 << 40)()
+
+	tests := []struct {
+		name   string
+		held   int64 // Bytes acquired first
+		n      int64
+		blocks bool
+	}{
+		{"fits", 40, 60, false},
+		{"over the limit", 60, 60, true},
+		{"larger than the budget, alone", 0, 500, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			budget := &memoryBudget{limit: 100}
+			budget.freed = sync.NewCond(&budget.mu)
+			release := budget.acquire(tt.held)
+			acquired := make(chan func())
+			go func() { acquired <- budget.acquire(tt.n) }()
+			select {
+			case second := <-acquired:
+				if tt.blocks {
+					t.Fatal("acquire didn't wait for the budget")
+				}
+				second()
+			case <-time.After(50 * time.Millisecond):
+				if !tt.blocks {
+					t.Fatal("acquire waited within the budget")
+				}
+				release()
+				(<-acquired)()
+				release = func() {}
+			}
+			release()
+			if budget.used != 0 {
+				t.Errorf("%d bytes are still used", budget.used)
+			}
+		})
+	}
+}
+
+func TestSetMemoryLimit(t *testing.T) {
+	t.Cleanup(func() { debug.SetMemoryLimit(math.MaxInt64) })
+	options := testOptions(t, "-max-memory", "64M")
+	if options.MaxMemory != 64<<20 || options.memory == nil || options.memory.limit != 32<<20 || debug.SetMemoryLimit(-1) != 64<<20 {
+		t.Errorf("-max-memory 64M set %d, a budget of %+v", options.MaxMemory, options.memory)
+	}
+	setMemoryLimit(options, 0)
+	if options.memory != nil {
+		t.Error("a limit of 0 kept the budget")
+	}
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	registerWalkFlags(fs, &CommandOptions{})
+	if err := fs.Parse([]string{"-max-memory", "lots"}); err == nil {
+		t.Error("-max-memory lots parsed")
+	}
+}
+
+func TestJSONLines(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world", "sub/b.txt": "one two three"})
+	out := captureStdout(t, func() { findCommand("scan").run([]string{"-format", "jsonl", "-model", "cl100k_base", dir}) })
+
+	var files []FileResult
+	var total StreamedTotal
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		if strings.Contains(scanner.Text(), `"metadata"`) {
+			if err := json.Unmarshal(scanner.Bytes(), &total); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		var file FileResult
+		if err := json.Unmarshal(scanner.Bytes(), &file); err != nil {
+			t.Fatalf("line %q doesn't parse: %v", scanner.Text(), err)
+		}
+		files = append(files, file)
+	}
+	if len(files) != 2 || total.Total != 5 || total.Metadata == nil || total.Metadata.Files != 2 || !strings.HasSuffix(out, "}\n") {
+		t.Errorf("scan -format jsonl printed:\n%s", out)
+	}
+	for _, file := range files {
+		if want := map[string]int{"a.txt": 2, "sub/b.txt": 3}[file.Path]; file.Total != want {
+			t.Errorf("%s total %d, want %d", file.Path, file.Total, want)
+		}
+	}
+
+	// The records of streamed files aren't kept
+	options := testOptions(t, "-model", "cl100k_base", "-format", "jsonl", "-output", filepath.Join(t.TempDir(), "scan.jsonl"))
+	options.Path = dir
+	if err := startJSONLines(options); err != nil {
+		t.Fatal(err)
+	}
+	repo, err := ProcessRepository(t.Context(), dir, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := options.stream.finish(repo, options); err != nil {
+		t.Fatal(err)
+	}
+	if paths := countedPaths(dir, repo); len(paths) != 0 || repo.DiscardedFiles != 2 || repo.TokenCount != 5 {
+		t.Errorf("kept %v and discarded %d files of %d tokens", paths, repo.DiscardedFiles, repo.TokenCount)
+	}
+	if data, _ := os.ReadFile(options.Output); strings.Count(string(data), "\n") != 3 {
+		t.Errorf("-output has\n%s\nwant 3 lines", data)
+	}
+
+	options.Output = filepath.Join(dir, "missing", "scan.jsonl")
+	if err := startJSONLines(options); err == nil {
+		t.Error("startJSONLines to a missing directory succeeded")
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world", "go.sum": "one two three"})
+	out := captureStdout(t, func() { findCommand("scan").run([]string{"-format", "ndjson", "-model", "cl100k_base", dir}) })
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	tests := []struct {
+		line int
+		want string
+	}{
+		{0, `{"path":"a.txt","total":2,`},
+		{1, `"generated":"lockfile"`},
+		{2, `"total":5,"generated":{"files":1,"total":3}}`},
+	}
+	if len(lines) != 3 {
+		t.Fatalf("scan -format ndjson printed:\n%s", out)
+	}
+	for _, tt := range tests {
+		if !strings.Contains(lines[tt.line], tt.want) {
+			t.Errorf("line %d is %s, want it to contain %s", tt.line+1, lines[tt.line], tt.want)
+		}
+	}
+
+	stderr, code := exitStatus(t, func() { findCommand("scan").run([]string{"-format", "ndjsonl", dir}) })
+	if code != 1 || !strings.Contains(stderr, `Error: unknown format "ndjsonl" (expected text, tree, github-annotations, gh-summary, html, json, jsonl or ndjson, yaml or toml)`) {
+		t.Errorf("exit %d, stderr:\n%s", code, stderr)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"path/filepath"
+	"runtime/debug"
+	"time"
+)
+
+// version is the release of token-counter, set at build time with
+// -ldflags "-X main.version=v1.2.3"
+var version = ""
+
+// commandLine is the subcommand and arguments token-counter was run with,
+// recorded in the metadata of structured reports
+var commandLine []string
+
+// toolVersion returns the release of token-counter: the one set at build
+// time, or else the module version go install recorded, or the commit it was
+// built from
+func toolVersion() string {
+	if version != "" {
+		return version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		return v
+	}
+	revision, dirty := "", false
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			dirty = setting.Value == "true"
+		}
+	}
+	if revision == "" {
+		return "devel"
+	}
+	revision = "devel-" + revision[:min(len(revision), 12)]
+	if dirty {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+// ScanMetadata describes how a report was produced, so archived reports can
+// be interpreted and reproduced later
+type ScanMetadata struct {
+	Tool      string         `json:"tool"`
+	Version   string         `json:"version"`
+	Model     string         `json:"model"`
+	Fallback  *ModelFallback `json:"fallback,omitempty"` // With -model-fallback, the model that wasn't available, so the counts are approximate
+	Unit      string         `json:"unit"`
+	Command   []string       `json:"command"` // Subcommand, flags and arguments
+	Path      string         `json:"path"`
+	Rev       string         `json:"rev,omitempty"`    // Revision given to -rev, if any
+	Commit    string         `json:"commit,omitempty"` // Commit scanned: Rev's, or HEAD of the scanned repository if it's one
+	Dirty     bool           `json:"dirty,omitempty"`  // Whether tracked files had uncommitted changes
+	Timestamp time.Time      `json:"timestamp"`
+	Files     int            `json:"files"`
+	Partial   *PartialScan   `json:"partial,omitempty"` // With -deadline, if it passed before every file was counted
+}
+
+// newScanMetadata returns the metadata of a scan
+func newScanMetadata(repo *RepoTokenInfo, options *CommandOptions) *ScanMetadata {
+	metadata := &ScanMetadata{
+		Tool:      "token-counter",
+		Version:   toolVersion(),
+		Model:     options.modelName(),
+		Unit:      options.unitName(),
+		Command:   commandLine,
+		Path:      revReportedPath(repo.Path, options),
+		Timestamp: time.Now().UTC().Truncate(time.Second),
+		Partial:   newPartialScan(repo, options),
+		Fallback:  options.fallback,
+	}
+	metadata.Files = len(repo.countedFiles(options)) + repo.DiscardedFiles
+
+	if options.RevCommit != "" {
+		metadata.Rev, metadata.Commit = options.Rev, options.RevCommit
+		return metadata
+	}
+	dir := repo.Path
+	if options.IsSingleFile {
+		dir = filepath.Dir(repo.Path)
+	}
+	if commit, err := git(dir, "rev-parse", "HEAD"); err == nil {
+		metadata.Commit = commit
+		if status, err := git(dir, "status", "--porcelain", "--untracked-files=no"); err == nil {
+			metadata.Dirty = status != ""
+		}
+	}
+	return metadata
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewScanMetadata(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "one", "b/c.txt": "two"})
+
+	repo, options := scanTree(t, dir, "-model", "cl100k_base")
+	metadata := newScanMetadata(repo, options)
+	if metadata.Tool != "token-counter" || metadata.Model != "cl100k_base" || metadata.Unit != "tokens" || metadata.Path != dir || metadata.Files != 2 {
+		t.Errorf("metadata %+v", metadata)
+	}
+	if metadata.Commit != "" || metadata.Dirty {
+		t.Errorf("metadata outside a repository has commit %q, dirty %v", metadata.Commit, metadata.Dirty)
+	}
+	if age := time.Since(metadata.Timestamp); age < 0 || age > time.Minute || metadata.Timestamp.Location() != time.UTC {
+		t.Errorf("timestamp %v", metadata.Timestamp)
+	}
+
+	runGit(t, dir, "init", "-q")
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", "first")
+	head := strings.TrimSpace(runGit(t, dir, "rev-parse", "HEAD"))
+	tests := []struct {
+		name  string
+		edit  func()
+		dirty bool
+	}{
+		{"clean", func() {}, false},
+		{"untracked file", func() { writeTree(t, dir, map[string]string{"new.txt": "new"}) }, false},
+		{"modified file", func() { writeTree(t, dir, map[string]string{"a.txt": "changed"}) }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.edit()
+			metadata := newScanMetadata(repo, options)
+			if metadata.Commit != head || metadata.Dirty != tt.dirty {
+				t.Errorf("commit %q, dirty %v, want %q, %v", metadata.Commit, metadata.Dirty, head, tt.dirty)
+			}
+		})
+	}
+
+	// A single file is described by the repository it's in
+	single := testOptions(t, "-model", "cl100k_base")
+	single.IsSingleFile = true
+	fileRepo := &RepoTokenInfo{Path: filepath.Join(dir, "a.txt"), Dirs: make(map[string]*DirTokenInfo)}
+	if metadata := newScanMetadata(fileRepo, single); metadata.Commit != head {
+		t.Errorf("metadata of a single file has commit %q, want %q", metadata.Commit, head)
+	}
+}
+
+func TestToolVersion(t *testing.T) {
+	defer func(v string) { version = v }(version)
+	version = "v1.2.3"
+	if got := toolVersion(); got != "v1.2.3" {
+		t.Errorf("toolVersion() = %q, want the version set at build time", got)
+	}
+	version = ""
+	if got := toolVersion(); got == "" {
+		t.Error("toolVersion() without a build-time version is empty")
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scanDurationBuckets are the upper bounds, in seconds, of the scan duration
+// histogram
+var scanDurationBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300}
+
+// languageNames maps file extensions to the language label of the per-repo
+// gauges. Other extensions are labeled with the extension itself.
+var languageNames = map[string]string{
+	".go": "Go", ".py": "Python", ".js": "JavaScript", ".jsx": "JavaScript", ".mjs": "JavaScript",
+	".ts": "TypeScript", ".tsx": "TypeScript", ".java": "Java", ".kt": "Kotlin", ".rs": "Rust",
+	".c": "C", ".h": "C", ".cc": "C++", ".cpp": "C++", ".hpp": "C++", ".cs": "C#",
+	".rb": "Ruby", ".php": "PHP", ".swift": "Swift", ".scala": "Scala", ".sh": "Shell",
+	".bash": "Shell", ".zsh": "Shell", ".sql": "SQL", ".html": "HTML", ".htm": "HTML",
+	".css": "CSS", ".scss": "CSS", ".md": "Markdown", ".json": "JSON", ".yaml": "YAML",
+	".yml": "YAML", ".toml": "TOML", ".xml": "XML", ".proto": "Protocol Buffers", ".txt": "Text",
+}
+
+// languageOf returns the language label of a file
+func languageOf(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if name, ok := languageNames[ext]; ok {
+		return name
+	}
+	if ext == "" {
+		return "other"
+	}
+	return ext[1:]
+}
+
+// serverMetrics collects what serve exposes on /metrics in the Prometheus
+// text format
+type serverMetrics struct {
+	mu            sync.Mutex
+	requests      map[string]int64 // By gRPC method
+	filesScanned  int64
+	tokensCounted int64
+	scanBuckets   []int64 // Scans per bucket of scanDurationBuckets, not cumulative
+	scanCount     int64
+	scanSeconds   float64
+	repoTokens    map[string]map[string]int // Tokens by language of each -metrics-repos entry
+}
+
+func newServerMetrics() *serverMetrics {
+	return &serverMetrics{
+		requests:    make(map[string]int64),
+		scanBuckets: make([]int64, len(scanDurationBuckets)),
+		repoTokens:  make(map[string]map[string]int),
+	}
+}
+
+// request records a gRPC call of method that counted tokens
+func (m *serverMetrics) request(method string, tokens int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[method]++
+	m.tokensCounted += int64(tokens)
+}
+
+// file records a file counted by a scan
+func (m *serverMetrics) file(fileInfo *FileTokenInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.filesScanned++
+	m.tokensCounted += int64(fileInfo.TokenCount)
+}
+
+// scan records how long a finished scan took
+func (m *serverMetrics) scan(duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seconds := duration.Seconds()
+	for i, bound := range scanDurationBuckets {
+		if seconds <= bound {
+			m.scanBuckets[i]++
+			break
+		}
+	}
+	m.scanCount++
+	m.scanSeconds += seconds
+}
+
+// setRepo replaces the per-language counts of a configured repository
+func (m *serverMetrics) setRepo(name string, repo *RepoTokenInfo) {
+	byLanguage := make(map[string]int)
+	for _, dirInfo := range repo.Dirs {
+		for _, fileInfo := range dirInfo.Files {
+			byLanguage[languageOf(fileInfo.Path)] += fileInfo.TokenCount
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.repoTokens[name] = byLanguage
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format
+func (m *serverMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.write(w)
+}
+
+func (m *serverMetrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP token_counter_requests_total gRPC requests handled, by method.")
+	fmt.Fprintln(w, "# TYPE token_counter_requests_total counter")
+	for _, method := range sortedKeys(m.requests) {
+		fmt.Fprintf(w, "token_counter_requests_total{method=%s} %d\n", promLabel(method), m.requests[method])
+	}
+
+	fmt.Fprintln(w, "# HELP token_counter_files_scanned_total Files counted by repository scans.")
+	fmt.Fprintln(w, "# TYPE token_counter_files_scanned_total counter")
+	fmt.Fprintf(w, "token_counter_files_scanned_total %d\n", m.filesScanned)
+
+	fmt.Fprintln(w, "# HELP token_counter_tokens_counted_total Tokens counted by requests and scans, in the server's -count-mode unit.")
+	fmt.Fprintln(w, "# TYPE token_counter_tokens_counted_total counter")
+	fmt.Fprintf(w, "token_counter_tokens_counted_total %d\n", m.tokensCounted)
+
+	fmt.Fprintln(w, "# HELP token_counter_scan_duration_seconds Duration of repository scans.")
+	fmt.Fprintln(w, "# TYPE token_counter_scan_duration_seconds histogram")
+	cumulative := int64(0)
+	for i, bound := range scanDurationBuckets {
+		cumulative += m.scanBuckets[i]
+		fmt.Fprintf(w, "token_counter_scan_duration_seconds_bucket{le=\"%g\"} %d\n", bound, cumulative)
+	}
+	fmt.Fprintf(w, "token_counter_scan_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.scanCount)
+	fmt.Fprintf(w, "token_counter_scan_duration_seconds_sum %g\n", m.scanSeconds)
+	fmt.Fprintf(w, "token_counter_scan_duration_seconds_count %d\n", m.scanCount)
+
+	fmt.Fprintln(w, "# HELP token_counter_repo_tokens Tokens in each repository given to -metrics-repos, by language.")
+	fmt.Fprintln(w, "# TYPE token_counter_repo_tokens gauge")
+	for _, name := range sortedKeys(m.repoTokens) {
+		byLanguage := m.repoTokens[name]
+		for _, language := range sortedKeys(byLanguage) {
+			fmt.Fprintf(w, "token_counter_repo_tokens{repo=%s,language=%s} %d\n", promLabel(name), promLabel(language), byLanguage[language])
+		}
+	}
+}
+
+// promLabel quotes a label value for the Prometheus text format
+func promLabel(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value) + `"`
+}
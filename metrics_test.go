@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLanguageOf(t *testing.T) {
+	for path, want := range map[string]string{
+		"main.go": "Go", "App.TSX": "TypeScript", "notes.txt": "Text", "Makefile": "other", "data.parquet": "parquet",
+	} {
+		if got := languageOf(path); got != want {
+			t.Errorf("languageOf(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestServerMetrics(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"main.go": "package main\n", "README.md": "# Title\n"})
+	repo, _ := scanTree(t, dir, "-model", "cl100k_base")
+
+	m := newServerMetrics()
+	m.request("Count", 5)
+	m.request("Count", 3)
+	m.request(`Odd"Method`, 0)
+	m.file(&FileTokenInfo{TokenCount: 7})
+	m.scan(300 * time.Millisecond)
+	m.scan(2 * time.Minute)
+	m.setRepo("api\nv2", repo)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type %q", got)
+	}
+	out := rec.Body.String()
+	for _, want := range []string{
+		`token_counter_requests_total{method="Count"} 2`,
+		`token_counter_requests_total{method="Odd\"Method"} 1`,
+		"token_counter_files_scanned_total 1\n",
+		"token_counter_tokens_counted_total 15\n",
+		`token_counter_scan_duration_seconds_bucket{le="0.1"} 0`,
+		`token_counter_scan_duration_seconds_bucket{le="0.5"} 1`,
+		`token_counter_scan_duration_seconds_bucket{le="60"} 1`,
+		`token_counter_scan_duration_seconds_bucket{le="300"} 2`,
+		`token_counter_scan_duration_seconds_bucket{le="+Inf"} 2`,
+		"token_counter_scan_duration_seconds_count 2\n",
+		`token_counter_repo_tokens{repo="api\nv2",language="Go"} 3`,
+		`token_counter_repo_tokens{repo="api\nv2",language="Markdown"}`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("metrics are missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestServeMetricsFlags(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"repos without addr", []string{"-metrics-repos", "a"}, "Error: -metrics-repos needs -metrics-addr"},
+		{"zero interval", []string{"-metrics-addr", "127.0.0.1:0", "-metrics-interval", "0"}, "Error: -metrics-interval must be positive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := append([]string{"-model", "cl100k_base", "-addr", "127.0.0.1:0"}, tt.args...)
+			stderr, code := exitStatus(t, func() { findCommand("serve").run(append(args, dir)) })
+			if code != 1 || !strings.Contains(stderr, tt.want) {
+				t.Errorf("exit %d, stderr:\n%s", code, stderr)
+			}
+		})
+	}
+}
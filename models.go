@@ -0,0 +1,230 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/tiktoken-go/tokenizer"
+
+	"token-counter/counter"
+	"token-counter/tokenizers"
+)
+
+// namedCodec pairs a tokenizer with the model name it was requested as
+type namedCodec struct {
+	Name  string
+	Codec tokenizers.Tokenizer
+}
+
+// The built-in tokenizers: the tiktoken encodings by name, HuggingFace
+// tokenizer.json files by path and the API counters by their name prefixes
+func init() {
+	for _, enc := range encodings {
+		tokenizers.Register(string(enc.Name), func(name string) (tokenizers.Tokenizer, error) {
+			codec, err := tokenizer.Get(tokenizer.Encoding(name))
+			if err != nil {
+				return nil, err
+			}
+			return tiktokenTokenizer{codec}, nil
+		})
+	}
+	tokenizers.RegisterMatch(func(name string) bool { return strings.HasSuffix(name, ".json") }, func(name string) (tokenizers.Tokenizer, error) {
+		hf, err := loadHFTokenizer(name)
+		if err != nil {
+			return nil, err
+		}
+		return hf, nil
+	})
+	tokenizers.RegisterMatch(isGeminiModel, newGeminiCounter)
+	tokenizers.RegisterMatch(isAnthropicModel, newAnthropicCounter)
+	tokenizers.RegisterMatch(isOllamaModel, newOllamaCounter)
+}
+
+// tiktokenTokenizer counts with a tiktoken encoding
+type tiktokenTokenizer struct {
+	codec tokenizer.Codec
+}
+
+// Count returns the number of tokens text encodes to, with its special
+// tokens treated as -allow-special and -disallow-special say
+func (t tiktokenTokenizer) Count(text string) (int, error) {
+	if len(specialSettings.Allowed) == 0 && len(specialSettings.Disallowed) == 0 {
+		return t.encode(text)
+	}
+	return t.countSpecial(text)
+}
+
+// encode returns the number of tokens text encodes to as plain text
+func (t tiktokenTokenizer) encode(text string) (int, error) {
+	ids, _, err := t.codec.Encode(text)
+	return len(ids), err
+}
+
+// Name returns the name of the encoding
+func (t tiktokenTokenizer) Name() string {
+	return t.codec.GetName()
+}
+
+// encodings lists the tiktoken encodings -model and -models accept, with the
+// OpenAI models that use them
+var encodings = []struct {
+	Name   tokenizer.Encoding
+	Models string
+}{
+	{tokenizer.Cl100kBase, "GPT-4, GPT-3.5 Turbo, text-embedding-ada-002, text-embedding-3"},
+	{tokenizer.O200kBase, "GPT-4o, GPT-4.1, o1, o3, o4-mini"},
+	{tokenizer.P50kBase, "Codex, text-davinci-002, text-davinci-003"},
+	{tokenizer.P50kEdit, "text-davinci-edit-001, code-davinci-edit-001"},
+	{tokenizer.R50kBase, "GPT-3 (davinci, curie, babbage, ada)"},
+}
+
+// isEncoding reports whether name is one of the tiktoken encodings
+func isEncoding(name string) bool {
+	for _, enc := range encodings {
+		if string(enc.Name) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// modelsCommand defines the models subcommand, which lists the encodings
+// tokens can be counted with
+func modelsCommand(fs *flag.FlagSet) func() {
+	return func() {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ENCODING\tUSED BY")
+		for _, enc := range encodings {
+			name := string(enc.Name)
+			if enc.Name == tokenizer.Cl100kBase {
+				name += " (default)"
+			}
+			fmt.Fprintf(w, "%s\t%s\n", name, enc.Models)
+		}
+		// Tokenizers registered by the program itself
+		for _, name := range tokenizers.Names() {
+			if !isEncoding(name) {
+				fmt.Fprintf(w, "%s\t%s\n", name, "(registered tokenizer)")
+			}
+		}
+		w.Flush()
+		fmt.Println()
+		fmt.Println("Pass an encoding to -model, or several to -models to compare them. Other")
+		fmt.Println("models can be counted with their HuggingFace tokenizer.json, given to")
+		fmt.Println("-tokenizer-file or listed in -models. Gemini models (e.g. gemini-1.5-pro)")
+		fmt.Println("are counted with Google's countTokens API, using GEMINI_API_KEY or, for")
+		fmt.Println("Vertex AI, GOOGLE_CLOUD_PROJECT. Claude models (e.g. claude-sonnet-4-5) are")
+		fmt.Println("counted with Anthropic's token counting API, using ANTHROPIC_API_KEY. Models")
+		fmt.Println("served by a local Ollama are counted with their own tokenizer as")
+		fmt.Println("ollama:<name> (e.g. ollama:llama3.1). Go programs built with token-counter")
+		fmt.Println("can add their own tokenizers to the registry of the tokenizers package.")
+	}
+}
+
+// newCodecs returns the tokenizers selected by the options. With -models every
+// listed model is loaded, the first one being used for the main token counts;
+// otherwise it's the -tokenizer-file or the -model encoding.
+func newCodecs(options *CommandOptions) ([]namedCodec, error) {
+	if err := validateSpecial(); err != nil {
+		return nil, err
+	}
+	if options.ModelFallback && len(options.Models) > 0 {
+		return nil, fmt.Errorf("-model-fallback applies to -model, not -models")
+	}
+	if len(options.Models) == 0 {
+		enc, err := newCodec(options)
+		if err != nil {
+			return nil, err
+		}
+		return []namedCodec{{options.Model, enc}}, nil
+	}
+
+	var codecs []namedCodec
+	for _, name := range options.Models {
+		enc, err := codecForName(name)
+		if err != nil {
+			return nil, fmt.Errorf("error loading model %s: %v", name, err)
+		}
+		codecs = append(codecs, namedCodec{name, enc})
+	}
+	return codecs, nil
+}
+
+// codecForName loads the tokenizer registered for a model name: a tiktoken
+// encoding, a HuggingFace tokenizer if the name is the path of a .json file,
+// the API counter of a Gemini, Claude or Ollama model, or a tokenizer a
+// program built with token-counter registered itself
+func codecForName(name string) (tokenizers.Tokenizer, error) {
+	return counter.Tokenizer(name)
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// addModelCounts adds the per-model counts in src to dst
+func addModelCounts(dst map[string]int, src map[string]int) map[string]int {
+	if len(src) == 0 {
+		return dst
+	}
+	if dst == nil {
+		dst = make(map[string]int, len(src))
+	}
+	for model, count := range src {
+		dst[model] += count
+	}
+	return dst
+}
+
+// printModelComparison prints a side-by-side table of token counts for each
+// model passed to -models, with the change relative to the first model
+func printModelComparison(repo *RepoTokenInfo, options *CommandOptions) {
+	fmt.Println("Model comparison:")
+	fmt.Println("-----------------")
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Path\t%s\t\n", strings.Join(options.Models, "\t"))
+	printComparisonRow(w, "Total", repo.ModelCounts, options.Models)
+
+	if !options.IsSingleFile {
+		for _, dirInfo := range options.sortedDirs(repo) {
+			relativePath := relativeTo(repo.Path, dirInfo.Path)
+			printComparisonRow(w, relativePath, dirInfo.ModelCounts, options.Models)
+			if options.ShowFiles {
+				options.sortFiles(dirInfo.Files)
+				for _, fileInfo := range dirInfo.Files {
+					relativePath := relativeTo(repo.Path, fileInfo.Path)
+					printComparisonRow(w, "  "+relativePath, fileInfo.ModelCounts, options.Models)
+				}
+			}
+		}
+	}
+	w.Flush()
+	fmt.Println()
+}
+
+// printComparisonRow prints one row of the model comparison table
+func printComparisonRow(w *tabwriter.Writer, label string, counts map[string]int, models []string) {
+	base := counts[models[0]]
+	cells := []string{fmt.Sprintf("%d", base)}
+	for _, model := range models[1:] {
+		count := counts[model]
+		if base == 0 {
+			cells = append(cells, fmt.Sprintf("%d", count))
+			continue
+		}
+		change := float64(count-base) * 100 / float64(base)
+		cells = append(cells, fmt.Sprintf("%d (%+.1f%%)", count, change))
+	}
+	fmt.Fprintf(w, "%s\t%s\t\n", label, strings.Join(cells, "\t"))
+}
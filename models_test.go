@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewCodecs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		wantErr string
+	}{
+		{"default model", nil, []string{"cl100k_base"}, ""},
+		{"-model", []string{"-model", "o200k_base"}, []string{"o200k_base"}, ""},
+		{"-models", []string{"-models", "cl100k_base,o200k_base"}, []string{"cl100k_base", "o200k_base"}, ""},
+		{"unknown -models entry", []string{"-models", "cl100k_base,no-such-model"}, nil, "error loading model no-such-model"},
+		{"unknown -model", []string{"-model", "no-such-model"}, nil, "no-such-model"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			codecs, err := newCodecs(testOptions(t, tt.args...))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("newCodecs error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, codec := range codecs {
+				names = append(names, codec.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("codecs %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestModelComparison(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world", "sub/b.txt": "héllo wörld"})
+	repo, options := scanTree(t, dir, "-models", "cl100k_base,o200k_base")
+	if len(repo.ModelCounts) != 2 || repo.ModelCounts["cl100k_base"] != repo.TokenCount {
+		t.Errorf("ModelCounts = %v, want both models with cl100k_base's the total %d", repo.ModelCounts, repo.TokenCount)
+	}
+
+	out := captureStdout(t, func() { printModelComparison(repo, options) })
+	for _, want := range []string{"Model comparison:", "cl100k_base", "o200k_base", "Total", "sub"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("comparison is missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestAddModelCounts(t *testing.T) {
+	got := addModelCounts(nil, map[string]int{"a": 1})
+	got = addModelCounts(got, map[string]int{"a": 2, "b": 3})
+	if got["a"] != 3 || got["b"] != 3 {
+		t.Errorf("addModelCounts = %v, want a: 3, b: 3", got)
+	}
+	if got := addModelCounts(nil, nil); got != nil {
+		t.Errorf("addModelCounts(nil, nil) = %v, want nil", got)
+	}
+}
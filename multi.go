@@ -0,0 +1,400 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// multiFormats are the values accepted by multi's -format
+var multiFormats = map[string]bool{"text": true, "csv": true, "json": true}
+
+// Workspace is a workspace file of multi: the repositories to count together
+type Workspace struct {
+	Repositories []WorkspaceRepo `yaml:"repositories"`
+}
+
+// WorkspaceRepo is a repository of a workspace file, given either as its path
+// or as a mapping with a path and a name
+type WorkspaceRepo struct {
+	Name string `yaml:"name"` // Name in the report (defaults to the directory name)
+	Path string `yaml:"path"` // Directory, glob of directories or GitHub URL, relative to the workspace file
+}
+
+// UnmarshalYAML accepts a plain path as well as a mapping
+func (r *WorkspaceRepo) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		r.Path = node.Value
+		return nil
+	}
+	type plain WorkspaceRepo
+	return node.Decode((*plain)(r))
+}
+
+// MultiReport is the combined count of several repositories
+type MultiReport struct {
+	Metadata     *ScanMetadata `json:"metadata"`
+	Total        int           `json:"total"`
+	Repositories []*MultiRepo  `json:"repositories"`
+	Directories  []*MultiEntry `json:"largest_directories"` // Across all repositories, largest first
+	Files        []*MultiEntry `json:"largest_files"`       // Across all repositories, largest first
+}
+
+// MultiRepo is the count of one repository of a multi report
+type MultiRepo struct {
+	Name   string  `json:"name"`
+	Path   string  `json:"path"`
+	Commit string  `json:"commit,omitempty"` // HEAD of the repository, if it's a git repository
+	Dirty  bool    `json:"dirty,omitempty"`  // Whether tracked files had uncommitted changes
+	Total  int     `json:"total"`
+	Share  float64 `json:"share"` // Percentage of the total of all repositories
+	Files  int     `json:"files"`
+	Errors int     `json:"errors"`
+
+	repo *RepoTokenInfo
+}
+
+// MultiEntry is a directory or file of a cross-repository ranking, with its
+// path relative to its repository
+type MultiEntry struct {
+	Repository string `json:"repository"`
+	Path       string `json:"path"`
+	Total      int    `json:"total"`
+}
+
+// multiCommand defines the multi subcommand, which counts several
+// repositories with the same settings and reports them together, with a
+// total for each and rankings of the largest directories and files across
+// all of them
+func multiCommand(fs *flag.FlagSet) func() {
+	options := &CommandOptions{}
+	var workspaceFile, format string
+	var top int
+
+	registerFlags(fs, options)
+	registerWalkFlags(fs, options)
+	fs.StringVar(&workspaceFile, "workspace", "", "YAML workspace file listing the repositories to count, in addition to the ones given as arguments")
+	fs.IntVar(&top, "top", 10, "Number of directories and files to list in the cross-repository rankings (0 for none)")
+	fs.StringVar(&format, "format", "text", "Output format: text, csv or json")
+	return func() {
+		if !multiFormats[format] {
+			fmt.Fprintf(os.Stderr, "Error: unknown format %q (expected text, csv or json)\n", format)
+			exit(1)
+		}
+		if len(options.Models) > 1 {
+			fmt.Fprintln(os.Stderr, "Error: -models is not supported by multi")
+			exit(1)
+		}
+
+		repos, err := multiRepos(fs.Args(), options.Path, workspaceFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		if len(repos) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: multi needs repositories, as arguments or with -workspace")
+			exit(1)
+		}
+
+		// A profile applies to every repository, so it's read from -config
+		// or the current directory rather than from each of them
+		options.Path = "."
+		if err := applyProfile(fs, options); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		ctx, cancel := commandContext(options)
+		defer cancel()
+		for _, repo := range repos {
+			if isGitHubURL(repo.Path) {
+				if !options.Quiet {
+					logger.Info("cloning repository", "url", repo.Path)
+				}
+				dir, err := fetchGitHubRepo(repo.Path)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %s: %v\n", repo.Name, err)
+					exit(1)
+				}
+				repo.Path = dir
+			}
+			if !options.Quiet {
+				fmt.Fprintf(os.Stderr, "Processing repository %s: %s\n", repo.Name, repo.Path)
+			}
+			repo.repo, err = ProcessRepository(ctx, repo.Path, options)
+			if interrupted(err) {
+				err = interruptedError(err, options)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error processing %s: %v\n", repo.Path, err)
+				exit(1)
+			}
+		}
+
+		report := newMultiReport(repos, top, options)
+		report.Metadata.Path = workspaceFile
+		switch format {
+		case "csv":
+			printMultiCSV(os.Stdout, report)
+		case "json":
+			data, _ := json.MarshalIndent(report, "", "  ")
+			fmt.Println(string(data))
+		default:
+			printMulti(os.Stdout, report, options)
+		}
+
+		failed := false
+		for _, repo := range repos {
+			if len(repo.repo.Errors) == 0 {
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "Errors in %s (%d):\n", repo.Name, len(repo.repo.Errors))
+			for _, fileErr := range repo.repo.Errors {
+				fmt.Fprintf(os.Stderr, "%s\n", fileErr)
+			}
+			failed = true
+		}
+		if options.Strict && failed {
+			exit(1)
+		}
+	}
+}
+
+// multiRepos lists the repositories of the arguments, -path and the
+// workspace file, in that order. Workspace paths are relative to the file and
+// may be globs, which match directories only. Repositories are named after
+// their directory, unless the workspace file names them, and those with the
+// same directory name are told apart by their path.
+func multiRepos(args []string, path string, workspaceFile string) ([]*MultiRepo, error) {
+	var entries []WorkspaceRepo
+	for _, arg := range args {
+		entries = append(entries, WorkspaceRepo{Path: arg})
+	}
+	if path != "" {
+		entries = append(entries, WorkspaceRepo{Path: path})
+	}
+	if workspaceFile != "" {
+		workspace, err := loadWorkspace(workspaceFile)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, workspace...)
+	}
+
+	var repos []*MultiRepo
+	seen := make(map[string]bool)
+	add := func(name string, path string) {
+		if !isGitHubURL(path) {
+			path = filepath.Clean(normalizePath(path))
+		}
+		if seen[path] {
+			return
+		}
+		seen[path] = true
+		repos = append(repos, &MultiRepo{Name: name, Path: path})
+	}
+	for _, entry := range entries {
+		if entry.Path == "" {
+			return nil, fmt.Errorf("%s: a repository has no path", workspaceFile)
+		}
+		if isGitHubURL(entry.Path) {
+			name := entry.Name
+			if name == "" {
+				name = gitHubURLPattern.FindStringSubmatch(entry.Path)[2]
+			}
+			add(name, entry.Path)
+			continue
+		}
+		if !strings.ContainsAny(entry.Path, "*?[") {
+			info, err := os.Stat(entry.Path)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				return nil, fmt.Errorf("%s is not a directory", entry.Path)
+			}
+			add(entry.Name, entry.Path)
+			continue
+		}
+
+		matches, err := filepath.Glob(entry.Path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", entry.Path, err)
+		}
+		var dirs []string
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && info.IsDir() {
+				dirs = append(dirs, match)
+			}
+		}
+		if len(dirs) == 0 {
+			return nil, fmt.Errorf("%s matches no directories", entry.Path)
+		}
+		if entry.Name != "" && len(dirs) > 1 {
+			return nil, fmt.Errorf("%s: name %q can't be given to the %d directories it matches", entry.Path, entry.Name, len(dirs))
+		}
+		for _, dir := range dirs {
+			add(entry.Name, dir)
+		}
+	}
+
+	bases := make(map[string]int)
+	for _, repo := range repos {
+		if repo.Name == "" {
+			bases[filepath.Base(repo.Path)]++
+		}
+	}
+	for _, repo := range repos {
+		if repo.Name != "" {
+			continue
+		}
+		repo.Name = filepath.Base(repo.Path)
+		if bases[repo.Name] > 1 {
+			repo.Name = filepath.ToSlash(filepath.Clean(repo.Path))
+		}
+	}
+	return repos, nil
+}
+
+// loadWorkspace reads the repositories of a workspace file, with relative
+// paths resolved against the file's directory
+func loadWorkspace(path string) ([]WorkspaceRepo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	workspace := &Workspace{}
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(workspace); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+	dir := filepath.Dir(path)
+	for i, repo := range workspace.Repositories {
+		if repo.Path != "" && !isGitHubURL(repo.Path) && !filepath.IsAbs(repo.Path) {
+			workspace.Repositories[i].Path = filepath.Join(dir, filepath.FromSlash(repo.Path))
+		}
+	}
+	return workspace.Repositories, nil
+}
+
+// newMultiReport totals the scanned repositories and ranks them, and the
+// top directories and files across them, by their counts
+func newMultiReport(repos []*MultiRepo, top int, options *CommandOptions) *MultiReport {
+	report := &MultiReport{
+		Metadata: &ScanMetadata{
+			Tool:      "token-counter",
+			Version:   toolVersion(),
+			Model:     options.modelName(),
+			Unit:      options.unitName(),
+			Command:   commandLine,
+			Timestamp: time.Now().UTC().Truncate(time.Second),
+		},
+		Repositories: repos,
+		Directories:  []*MultiEntry{},
+		Files:        []*MultiEntry{},
+	}
+
+	var dirs, files []*MultiEntry
+	for _, repo := range repos {
+		metadata := newScanMetadata(repo.repo, options)
+		repo.Commit, repo.Dirty = metadata.Commit, metadata.Dirty
+		repo.Total = repo.repo.TokenCount
+		repo.Errors = len(repo.repo.Errors)
+		report.Total += repo.Total
+
+		for _, dirInfo := range repo.repo.Dirs {
+			repo.Files += len(dirInfo.Files)
+			dirs = append(dirs, &MultiEntry{repo.Name, relativeTo(repo.repo.Path, dirInfo.Path), dirInfo.TokenCount})
+			for _, fileInfo := range dirInfo.Files {
+				files = append(files, &MultiEntry{repo.Name, relativeTo(repo.repo.Path, fileInfo.Path), fileInfo.TokenCount})
+			}
+		}
+		report.Metadata.Files += repo.Files
+	}
+	for _, repo := range repos {
+		repo.Share = percentOf(repo.Total, report.Total)
+	}
+
+	sort.SliceStable(repos, func(i, j int) bool {
+		return repos[i].Total > repos[j].Total
+	})
+	report.Directories = append(report.Directories, rankEntries(dirs, top)...)
+	report.Files = append(report.Files, rankEntries(files, top)...)
+	return report
+}
+
+// rankEntries returns the top largest entries, ties in repository and path
+// order so the rankings are stable between runs
+func rankEntries(entries []*MultiEntry, top int) []*MultiEntry {
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Total != b.Total {
+			return a.Total > b.Total
+		}
+		if a.Repository != b.Repository {
+			return a.Repository < b.Repository
+		}
+		return a.Path < b.Path
+	})
+	return entries[:min(len(entries), max(top, 0))]
+}
+
+// String names an entry by its repository and path, e.g. billing/internal/db
+func (e *MultiEntry) String() string {
+	if e.Path == "." {
+		return e.Repository
+	}
+	return e.Repository + "/" + e.Path
+}
+
+// printMulti prints the grand total, a table of the repositories and the
+// cross-repository rankings
+func printMulti(w io.Writer, report *MultiReport, options *CommandOptions) {
+	unit := options.unitName()
+	fmt.Fprintf(w, "Token Count Summary for %d repositories\n", len(report.Repositories))
+	fmt.Fprintf(w, "Total %s: %s in %d files\n\n", unit, formatCount(report.Total), report.Metadata.Files)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "%s\tSHARE\tFILES\t\tREPOSITORY\n", strings.ToUpper(unit))
+	for _, repo := range report.Repositories {
+		fmt.Fprintf(tw, "%s\t%.1f%%\t%d\t\t%s\n", formatCount(repo.Total), repo.Share, repo.Files, options.paint(shareColor(repo.Total, report.Total), repo.Name))
+	}
+	tw.Flush()
+
+	printRanking := func(title string, entries []*MultiEntry) {
+		if len(entries) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "\n%s:\n", title)
+		for _, entry := range entries {
+			fmt.Fprintf(w, "  %s: %s %s (%.1f%%)\n", entry, formatCount(entry.Total), unit, percentOf(entry.Total, report.Total))
+		}
+	}
+	printRanking("Largest directories across repositories", report.Directories)
+	printRanking("Largest files across repositories", report.Files)
+}
+
+// printMultiCSV prints the repositories of the report as CSV
+func printMultiCSV(w io.Writer, report *MultiReport) {
+	out := csv.NewWriter(w)
+	out.Write([]string{"repository", "path", "commit", "total", "share", "files", "errors"})
+	for _, repo := range report.Repositories {
+		out.Write([]string{repo.Name, repo.Path, repo.Commit, strconv.Itoa(repo.Total), strconv.FormatFloat(repo.Share, 'f', 1, 64), strconv.Itoa(repo.Files), strconv.Itoa(repo.Errors)})
+	}
+	out.Flush()
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMultiRepos(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"services/billing/a.txt": "one",
+		"services/auth/a.txt":    "one",
+		"services/README":        "not a directory",
+		"other/auth/a.txt":       "one",
+		"web/a.txt":              "one",
+	})
+	workspace := filepath.Join(dir, "workspace.yaml")
+	if err := os.WriteFile(workspace, []byte("repositories:\n  - services/*\n  - name: frontend\n    path: web\n  - https://github.com/owner/tool\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		args      []string
+		workspace string
+		want      map[string]string
+	}{
+		{
+			name: "arguments",
+			args: []string{filepath.Join(dir, "web"), filepath.Join(dir, "web") + "/"},
+			want: map[string]string{"web": filepath.Join(dir, "web")},
+		},
+		{
+			name:      "workspace",
+			workspace: workspace,
+			want: map[string]string{
+				"billing":  filepath.Join(dir, "services", "billing"),
+				"auth":     filepath.Join(dir, "services", "auth"),
+				"frontend": filepath.Join(dir, "web"),
+				"tool":     "https://github.com/owner/tool",
+			},
+		},
+		{
+			name:      "same directory names",
+			args:      []string{filepath.Join(dir, "other", "auth")},
+			workspace: workspace,
+			want: map[string]string{
+				filepath.ToSlash(filepath.Join(dir, "other", "auth")):    filepath.Join(dir, "other", "auth"),
+				filepath.ToSlash(filepath.Join(dir, "services", "auth")): filepath.Join(dir, "services", "auth"),
+				"billing":  filepath.Join(dir, "services", "billing"),
+				"frontend": filepath.Join(dir, "web"),
+				"tool":     "https://github.com/owner/tool",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repos, err := multiRepos(tt.args, "", tt.workspace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := make(map[string]string)
+			for _, repo := range repos {
+				got[repo.Name] = repo.Path
+			}
+			if len(got) != len(repos) || len(got) != len(tt.want) {
+				t.Errorf("repositories %v, want %v", got, tt.want)
+			}
+			for name, path := range tt.want {
+				if got[name] != path {
+					t.Errorf("repository %s at %q, want %q", name, got[name], path)
+				}
+			}
+		})
+	}
+}
+
+func TestMultiReposErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a/x.txt": "one", "b/x.txt": "one", "file.txt": "one"})
+	workspace := func(contents string) string {
+		path := filepath.Join(t.TempDir(), "workspace.yaml")
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	tests := []struct {
+		name      string
+		args      []string
+		workspace string
+		want      string
+	}{
+		{"missing directory", []string{filepath.Join(dir, "missing")}, "", "no such file"},
+		{"a file", []string{filepath.Join(dir, "file.txt")}, "", "is not a directory"},
+		{"glob without directories", []string{filepath.Join(dir, "*.md")}, "", "matches no directories"},
+		{"named glob", nil, workspace("repositories:\n  - name: both\n    path: " + filepath.Join(dir, "*") + "\n"), `name "both" can't be given to the 2 directories it matches`},
+		{"no path", nil, workspace("repositories:\n  - name: nothing\n"), "a repository has no path"},
+		{"unknown field", nil, workspace("repos:\n  - a\n"), "field repos not found"},
+		{"missing workspace", nil, filepath.Join(dir, "missing.yaml"), "no such file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := multiRepos(tt.args, "", tt.workspace); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("multiRepos error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMultiCommand(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"small/a.txt":     "hello world",
+		"large/a.txt":     "one two three",
+		"large/sub/b.txt": "four five six seven",
+	})
+
+	out := captureStdout(t, func() {
+		findCommand("multi").run([]string{"-model", "cl100k_base", "-quiet", "-format", "json", "-top", "2", filepath.Join(dir, "small"), filepath.Join(dir, "large")})
+	})
+	var report MultiReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil {
+		t.Fatalf("report isn't JSON: %v\n%s", err, out)
+	}
+	if report.Total != 9 || report.Metadata.Files != 3 || len(report.Repositories) != 2 {
+		t.Fatalf("report %+v", report)
+	}
+	if large := report.Repositories[0]; large.Name != "large" || large.Total != 7 || large.Files != 2 || large.Share < 77 || large.Share > 78 {
+		t.Errorf("largest repository %+v", large)
+	}
+	if len(report.Files) != 2 || report.Files[0].String() != "large/sub/b.txt" || report.Files[1].String() != "large/a.txt" {
+		t.Errorf("largest files %v", report.Files)
+	}
+
+	text := captureStdout(t, func() {
+		findCommand("multi").run([]string{"-model", "cl100k_base", "-quiet", filepath.Join(dir, "small"), filepath.Join(dir, "large")})
+	})
+	for _, want := range []string{"Token Count Summary for 2 repositories", "Total tokens: 9 in 3 files", "Largest directories across repositories:", "  large/sub: 4 tokens (44.4%)"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text report has no %q:\n%s", want, text)
+		}
+	}
+
+}
+
+func TestMultiCommandErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"unknown format", []string{"-format", "xml", "."}, `Error: unknown format "xml" (expected text, csv or json)`},
+		{"several models", []string{"-models", "cl100k_base,o200k_base", "."}, "Error: -models is not supported by multi"},
+		{"no repositories", nil, "Error: multi needs repositories, as arguments or with -workspace"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderr, code := exitStatus(t, func() { findCommand("multi").run(tt.args) })
+			if code != 1 || !strings.Contains(stderr, tt.want) {
+				t.Errorf("exit %d, stderr:\n%s", code, stderr)
+			}
+		})
+	}
+}
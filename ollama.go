@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"token-counter/tokenizers"
+)
+
+// ollamaPrefix selects a model served by a local Ollama, as in
+// -model ollama:llama3.1
+const ollamaPrefix = "ollama:"
+
+// isOllamaModel reports whether a -model name is an Ollama model
+func isOllamaModel(name string) bool {
+	return strings.HasPrefix(name, ollamaPrefix)
+}
+
+// ollamaURL returns the address of the Ollama server: OLLAMA_HOST, which may
+// leave out the scheme and port as Ollama's own CLI allows, or the default
+func ollamaURL() string {
+	host := os.Getenv("OLLAMA_HOST")
+	if host == "" {
+		return "http://127.0.0.1:11434"
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	if strings.Count(host, ":") == 1 {
+		host += ":11434"
+	}
+	return strings.TrimSuffix(host, "/")
+}
+
+// newOllamaCounter returns a counter for the Ollama model named after the
+// ollama: prefix of name, so counts come from the exact tokenizer of the
+// local model. Texts are tokenized with the /api/tokenize endpoint; servers
+// without it are asked to evaluate the text as a raw prompt instead, and the
+// number of prompt tokens they report is used.
+func newOllamaCounter(name string) (tokenizers.Tokenizer, error) {
+	model := strings.TrimPrefix(name, ollamaPrefix)
+	if model == "" {
+		return nil, fmt.Errorf("expected a model name after %s", ollamaPrefix)
+	}
+	base := ollamaURL()
+	header := make(http.Header)
+
+	// Check the model is there up front, so a typo fails once rather than
+	// for every file
+	var show struct{}
+	if err := postJSON(base+"/api/show", header, map[string]string{"model": model}, &show); err != nil {
+		return nil, fmt.Errorf("error loading %s from Ollama at %s: %v", model, base, err)
+	}
+
+	var noTokenize atomic.Bool
+	count := func(text string) (int, error) {
+		if !noTokenize.Load() {
+			var response struct {
+				Tokens []int `json:"tokens"`
+			}
+			err := postJSON(base+"/api/tokenize", header, map[string]string{"model": model, "content": text}, &response)
+			if err == nil {
+				return len(response.Tokens), nil
+			}
+			var apiErr *apiError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+				return 0, fmt.Errorf("ollama tokenize %s: %w", model, err)
+			}
+			noTokenize.Store(true)
+		}
+
+		// Raw mode skips the prompt template, so only the text is counted.
+		// Generating a single token keeps the request cheap.
+		var response struct {
+			PromptEvalCount int `json:"prompt_eval_count"`
+		}
+		request := map[string]any{
+			"model":   model,
+			"prompt":  text,
+			"raw":     true,
+			"stream":  false,
+			"options": map[string]int{"num_predict": 1},
+		}
+		if err := postJSON(base+"/api/generate", header, request, &response); err != nil {
+			return 0, fmt.Errorf("ollama generate %s: %w", model, err)
+		}
+		return response.PromptEvalCount, nil
+	}
+	// Tags like llama3.1 can be pulled again and change, so counts aren't
+	// cached; a local server is quick to ask anyway
+	return &apiCounter{model: name, count: count}, nil
+}
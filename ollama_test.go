@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ollamaServer fakes an Ollama serving model, with or without the tokenize
+// endpoint
+func ollamaServer(t *testing.T, model string, tokenize bool) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]any
+		json.NewDecoder(r.Body).Decode(&request)
+		if request["model"] != model {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]string{"error": "model '" + request["model"].(string) + "' not found"})
+			return
+		}
+		switch {
+		case r.URL.Path == "/api/show":
+			w.Write([]byte("{}"))
+		case r.URL.Path == "/api/tokenize" && tokenize:
+			json.NewEncoder(w).Encode(map[string][]int{"tokens": make([]int, len(strings.Fields(request["content"].(string))))})
+		case r.URL.Path == "/api/generate" && request["raw"] == true:
+			json.NewEncoder(w).Encode(map[string]int{"prompt_eval_count": len(strings.Fields(request["prompt"].(string)))})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOllamaCounter(t *testing.T) {
+	for _, tokenize := range []bool{true, false} {
+		server := ollamaServer(t, "llama3.1", tokenize)
+		t.Setenv("OLLAMA_HOST", server.URL)
+		tok, err := newOllamaCounter("ollama:llama3.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tok.Name() != "ollama:llama3.1" {
+			t.Errorf("Name() = %q", tok.Name())
+		}
+		for i := 0; i < 2; i++ {
+			if got, err := tok.Count("one two three four"); err != nil || got != 4 {
+				t.Errorf("Count with tokenize %v = %d, %v, want 4", tokenize, got, err)
+			}
+		}
+	}
+}
+
+func TestOllamaCounterErrors(t *testing.T) {
+	server := ollamaServer(t, "llama3.1", true)
+	t.Setenv("OLLAMA_HOST", server.URL)
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"ollama:", "expected a model name after ollama:"},
+		{"ollama:mistral", "error loading mistral from Ollama at " + server.URL + ": 404 Not Found: model 'mistral' not found"},
+	}
+	for _, tt := range tests {
+		if _, err := newOllamaCounter(tt.name); err == nil || err.Error() != tt.want {
+			t.Errorf("newOllamaCounter(%q) = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestOllamaURL(t *testing.T) {
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"", "http://127.0.0.1:11434"},
+		{"0.0.0.0", "http://0.0.0.0:11434"},
+		{"gpu-box:8080", "http://gpu-box:8080"},
+		{"https://ollama.example.com:443/", "https://ollama.example.com:443"},
+	}
+	for _, tt := range tests {
+		t.Setenv("OLLAMA_HOST", tt.host)
+		if got := ollamaURL(); got != tt.want {
+			t.Errorf("ollamaURL() with OLLAMA_HOST=%q = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// otelTimeout bounds how long exporting the telemetry of a scan may take, so
+// an unreachable collector can't hold up the exit
+const otelTimeout = 10 * time.Second
+
+// telemetry records the spans and metrics of a scan for -otel-endpoint and
+// sends them to an OpenTelemetry collector when the command exits, as OTLP
+// over HTTP with JSON encoding. The scan is the root span; its phases, walk
+// and aggregate, are its children, and every counted file is a tokenize span
+// of the phase it was counted in, except in scans that discard their files,
+// like -format jsonl, which only total them so the spans don't grow with the
+// tree. A nil *telemetry records nothing.
+type telemetry struct {
+	endpoint  string            // Base URL of the collector, e.g. http://localhost:4318
+	headers   map[string]string // From OTEL_EXPORTER_OTLP_HEADERS, e.g. for an API key
+	root      string            // Scan root, which file paths are made relative to
+	model     string
+	traceID   string
+	fileSpans bool // Whether every counted file gets a span
+
+	mu     sync.Mutex
+	scan   *otelSpan
+	phase  *otelSpan // Phase files are currently counted in
+	spans  []*otelSpan
+	files  int64
+	tokens int64
+	errors int64
+	repo   *RepoTokenInfo // Result of the scan, once it's reported
+}
+
+// otelSpan is a span of the scan's trace
+type otelSpan struct {
+	t          *telemetry
+	id         string
+	parent     string
+	name       string
+	start, end time.Time
+	attributes []otelKeyValue
+	err        error
+}
+
+// newTelemetry starts the telemetry of a scan of root, or returns nil if no
+// endpoint is set. The telemetry is exported by an exit hook, so it's sent
+// however the command exits.
+func newTelemetry(endpoint string, root string, options *CommandOptions) *telemetry {
+	if endpoint == "" {
+		return nil
+	}
+	t := &telemetry{
+		endpoint:  strings.TrimSuffix(endpoint, "/"),
+		headers:   parseOTelHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+		root:      root,
+		model:     options.modelName(),
+		traceID:   randomID(16),
+		fileSpans: !options.DiscardFiles,
+	}
+	t.scan = t.startSpan("scan", "")
+	atExit(t.export)
+	return t
+}
+
+// parseOTelHeaders parses the key=value,key=value list of
+// OTEL_EXPORTER_OTLP_HEADERS
+func parseOTelHeaders(value string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range splitList(value) {
+		if key, val, ok := strings.Cut(pair, "="); ok {
+			headers[strings.TrimSpace(key)] = strings.TrimSpace(val)
+		}
+	}
+	return headers
+}
+
+// randomID returns n random bytes in hex, for trace and span IDs
+func randomID(n int) string {
+	id := make([]byte, n)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// startSpan starts a span with the given parent span ID
+func (t *telemetry) startSpan(name string, parent string) *otelSpan {
+	span := &otelSpan{t: t, id: randomID(8), parent: parent, name: name, start: time.Now()}
+	t.spans = append(t.spans, span)
+	return span
+}
+
+// startPhase ends the current phase of the scan, if any, and starts the next
+func (t *telemetry) startPhase(name string) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.phase != nil && t.phase.end.IsZero() {
+		t.phase.end = time.Now()
+	}
+	t.phase = t.startSpan(name, t.scan.id)
+}
+
+// startFile starts the tokenize span of a file, as a child of the current
+// phase
+func (t *telemetry) startFile(path string) *otelSpan {
+	if t == nil {
+		return nil
+	}
+	if !t.fileSpans {
+		// Unrecorded, it still adds the file to the totals as it ends
+		return &otelSpan{t: t}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parent := t.scan.id
+	if t.phase != nil {
+		parent = t.phase.id
+	}
+	span := t.startSpan("tokenize", parent)
+	span.attributes = append(span.attributes, otelString("file.path", relativeTo(t.root, path)))
+	return span
+}
+
+// endFile ends the tokenize span of a file with its counts, or the error
+// counting it failed with
+func (s *otelSpan) endFile(fileInfo *FileTokenInfo, err error) {
+	if s == nil {
+		return
+	}
+	t := s.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s.end = time.Now()
+	if err != nil {
+		s.err = err
+		t.errors++
+		return
+	}
+	s.attributes = append(s.attributes, otelInt("file.bytes", int64(fileInfo.Bytes)), otelInt("file.tokens", int64(fileInfo.TokenCount)))
+	t.files++
+	t.tokens += int64(fileInfo.TokenCount)
+}
+
+// result records the counts of the scan, for the root span and the
+// repository gauge
+func (t *telemetry) result(repo *RepoTokenInfo) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.repo = repo
+}
+
+// export ends the open spans and sends the trace and the metrics of the
+// scan. Failing to send them is a warning; the scan's results stand.
+func (t *telemetry) export() {
+	t.mu.Lock()
+	now := time.Now()
+	for _, span := range t.spans {
+		if span.end.IsZero() {
+			span.end = now
+		}
+	}
+	t.scan.attributes = append(t.scan.attributes, otelString("scan.path", t.root), otelString("scan.model", t.model))
+	if t.repo != nil {
+		files := 0
+		for _, dirInfo := range t.repo.Dirs {
+			files += len(dirInfo.Files)
+		}
+		t.scan.attributes = append(t.scan.attributes, otelInt("scan.files", int64(files)), otelInt("scan.tokens", int64(t.repo.TokenCount)), otelInt("scan.errors", int64(len(t.repo.Errors))))
+	}
+	traces, metrics := t.traceRequest(), t.metricsRequest()
+	t.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), otelTimeout)
+	defer cancel()
+	for _, req := range []struct {
+		path string
+		body any
+	}{{"/v1/traces", traces}, {"/v1/metrics", metrics}} {
+		if err := t.post(ctx, req.path, req.body); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: sending telemetry to %s: %v\n", t.endpoint, err)
+			return
+		}
+	}
+}
+
+// post sends an OTLP request to a path of the collector
+func (t *telemetry) post(ctx context.Context, path string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s: %s", path, resp.Status)
+	}
+	return nil
+}
+
+// The OTLP/HTTP JSON encoding of the requests. IDs are hex, and 64-bit
+// integers are strings, as the protocol's JSON mapping requires.
+
+type otelAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type otelKeyValue struct {
+	Key   string       `json:"key"`
+	Value otelAnyValue `json:"value"`
+}
+
+func otelString(key string, value string) otelKeyValue {
+	return otelKeyValue{key, otelAnyValue{StringValue: &value}}
+}
+
+func otelInt(key string, value int64) otelKeyValue {
+	s := strconv.FormatInt(value, 10)
+	return otelKeyValue{key, otelAnyValue{IntValue: &s}}
+}
+
+// otelTime formats a time as the string of its Unix nanoseconds
+func otelTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+type otelResource struct {
+	Attributes []otelKeyValue `json:"attributes"`
+}
+
+type otelScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// resource describes the process the telemetry comes from
+func (t *telemetry) resource() otelResource {
+	return otelResource{[]otelKeyValue{otelString("service.name", "token-counter"), otelString("service.version", toolVersion())}}
+}
+
+func (t *telemetry) scope() otelScope {
+	return otelScope{"token-counter", toolVersion()}
+}
+
+type otelStatus struct {
+	Code    int    `json:"code"` // 0 unset, 2 error
+	Message string `json:"message,omitempty"`
+}
+
+type otelSpanData struct {
+	TraceID      string         `json:"traceId"`
+	SpanID       string         `json:"spanId"`
+	ParentSpanID string         `json:"parentSpanId,omitempty"`
+	Name         string         `json:"name"`
+	Kind         int            `json:"kind"` // 1 internal
+	Start        string         `json:"startTimeUnixNano"`
+	End          string         `json:"endTimeUnixNano"`
+	Attributes   []otelKeyValue `json:"attributes,omitempty"`
+	Status       otelStatus     `json:"status"`
+}
+
+// traceRequest builds the export request of the scan's spans
+func (t *telemetry) traceRequest() any {
+	spans := make([]otelSpanData, 0, len(t.spans))
+	for _, span := range t.spans {
+		data := otelSpanData{
+			TraceID:      t.traceID,
+			SpanID:       span.id,
+			ParentSpanID: span.parent,
+			Name:         span.name,
+			Kind:         1,
+			Start:        otelTime(span.start),
+			End:          otelTime(span.end),
+			Attributes:   span.attributes,
+		}
+		if span.err != nil {
+			data.Status = otelStatus{2, span.err.Error()}
+		}
+		spans = append(spans, data)
+	}
+	return map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource":   t.resource(),
+			"scopeSpans": []any{map[string]any{"scope": t.scope(), "spans": spans}},
+		}},
+	}
+}
+
+type otelNumberPoint struct {
+	Attributes []otelKeyValue `json:"attributes,omitempty"`
+	Start      string         `json:"startTimeUnixNano,omitempty"`
+	Time       string         `json:"timeUnixNano"`
+	AsInt      string         `json:"asInt"`
+}
+
+type otelHistogramPoint struct {
+	Attributes     []otelKeyValue `json:"attributes,omitempty"`
+	Start          string         `json:"startTimeUnixNano"`
+	Time           string         `json:"timeUnixNano"`
+	Count          string         `json:"count"`
+	Sum            float64        `json:"sum"`
+	BucketCounts   []string       `json:"bucketCounts"`
+	ExplicitBounds []float64      `json:"explicitBounds"`
+}
+
+// metricsRequest builds the export request of the scan's metrics: the
+// files, tokens and errors it counted and how long it took, as deltas, and
+// the repository's total as a gauge, so its trend can be charted per path
+func (t *telemetry) metricsRequest() any {
+	start, end := otelTime(t.scan.start), otelTime(t.scan.end)
+	attributes := []otelKeyValue{otelString("model", t.model)}
+	sum := func(name string, unit string, description string, value int64) map[string]any {
+		return map[string]any{
+			"name": name, "unit": unit, "description": description,
+			"sum": map[string]any{
+				"aggregationTemporality": 1, // delta
+				"isMonotonic":            true,
+				"dataPoints":             []otelNumberPoint{{attributes, start, end, strconv.FormatInt(value, 10)}},
+			},
+		}
+	}
+
+	seconds := t.scan.end.Sub(t.scan.start).Seconds()
+	buckets := make([]string, len(scanDurationBuckets)+1)
+	for i := range buckets {
+		buckets[i] = "0"
+	}
+	bucket := len(scanDurationBuckets)
+	for i, bound := range scanDurationBuckets {
+		if seconds <= bound {
+			bucket = i
+			break
+		}
+	}
+	buckets[bucket] = "1"
+
+	metrics := []any{
+		sum("token_counter.files", "{file}", "Files counted", t.files),
+		sum("token_counter.tokens", "{token}", "Tokens counted", t.tokens),
+		sum("token_counter.file_errors", "{file}", "Files that couldn't be counted", t.errors),
+		map[string]any{
+			"name": "token_counter.scan.duration", "unit": "s", "description": "Duration of scans",
+			"histogram": map[string]any{
+				"aggregationTemporality": 1,
+				"dataPoints":             []otelHistogramPoint{{attributes, start, end, "1", seconds, buckets, scanDurationBuckets}},
+			},
+		},
+	}
+	if t.repo != nil {
+		gaugeAttributes := append([]otelKeyValue{otelString("path", t.root)}, attributes...)
+		metrics = append(metrics, map[string]any{
+			"name": "token_counter.repository.tokens", "unit": "{token}", "description": "Total tokens of the scanned path",
+			"gauge": map[string]any{
+				"dataPoints": []otelNumberPoint{{gaugeAttributes, "", end, strconv.FormatInt(int64(t.repo.TokenCount), 10)}},
+			},
+		})
+	}
+	return map[string]any{
+		"resourceMetrics": []any{map[string]any{
+			"resource":     t.resource(),
+			"scopeMetrics": []any{map[string]any{"scope": t.scope(), "metrics": metrics}},
+		}},
+	}
+}
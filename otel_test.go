@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// otelCollector records the OTLP requests posted to it by path, answering
+// with status
+func otelCollector(t *testing.T, status int) (*httptest.Server, map[string]map[string]any, *sync.Mutex) {
+	t.Helper()
+	var mu sync.Mutex
+	requests := make(map[string]map[string]any)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var doc map[string]any
+		if err := json.Unmarshal(body, &doc); err != nil || r.Header.Get("Content-Type") != "application/json" || r.Header.Get("Api-Key") != "secret" {
+			t.Errorf("%s: content type %q, api-key %q, body %s", r.URL.Path, r.Header.Get("Content-Type"), r.Header.Get("Api-Key"), body)
+		}
+		mu.Lock()
+		requests[r.URL.Path] = doc
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests, &mu
+}
+
+// otelScan scans dir sending telemetry to endpoint, and returns what it
+// printed to stderr exporting it
+func otelScan(t *testing.T, dir string, endpoint string) string {
+	t.Helper()
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Api-Key = secret, ignored")
+	options := testOptions(t, "-model", "cl100k_base")
+	options.Path = dir
+	options.Telemetry = newTelemetry(endpoint+"/", dir, options)
+	options.Telemetry.startPhase("walk")
+	repo, err := ProcessRepository(t.Context(), dir, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	captureStdout(t, func() { printReport(repo, options) })
+	return captureStderr(t, runExitHooks)
+}
+
+func TestTelemetry(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world", "sub/b.txt": "one two three"})
+	srv, requests, mu := otelCollector(t, http.StatusOK)
+	if stderr := otelScan(t, dir, srv.URL); stderr != "" {
+		t.Errorf("export printed %q", stderr)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+
+	var traces struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []otelSpanData `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	data, _ := json.Marshal(requests["/v1/traces"])
+	if err := json.Unmarshal(data, &traces); err != nil || len(traces.ResourceSpans) != 1 || len(traces.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("traces %s", data)
+	}
+	spans := traces.ResourceSpans[0].ScopeSpans[0].Spans
+	byName := make(map[string][]otelSpanData)
+	for _, span := range spans {
+		byName[span.Name] = append(byName[span.Name], span)
+		if span.TraceID != spans[0].TraceID || len(span.TraceID) != 32 || span.End < span.Start {
+			t.Errorf("span %+v", span)
+		}
+	}
+	scan, walk := byName["scan"], byName["walk"]
+	if len(scan) != 1 || len(walk) != 1 || len(byName["aggregate"]) != 1 || len(byName["tokenize"]) != 2 {
+		t.Fatalf("spans %v", byName)
+	}
+	if walk[0].ParentSpanID != scan[0].SpanID {
+		t.Errorf("walk isn't a child of the scan")
+	}
+	var files []string
+	for _, span := range byName["tokenize"] {
+		if span.ParentSpanID != walk[0].SpanID {
+			t.Errorf("tokenize span isn't a child of the walk")
+		}
+		files = append(files, *span.Attributes[0].Value.StringValue)
+	}
+	sort.Strings(files)
+	if strings.Join(files, ",") != "a.txt,sub/b.txt" {
+		t.Errorf("tokenize spans of %v", files)
+	}
+	attributes := make(map[string]string)
+	for _, kv := range scan[0].Attributes {
+		if kv.Value.IntValue != nil {
+			attributes[kv.Key] = *kv.Value.IntValue
+		} else {
+			attributes[kv.Key] = *kv.Value.StringValue
+		}
+	}
+	if attributes["scan.tokens"] != "5" || attributes["scan.files"] != "2" || attributes["scan.model"] != "cl100k_base" {
+		t.Errorf("scan attributes %v", attributes)
+	}
+
+	metrics, _ := json.Marshal(requests["/v1/metrics"])
+	for _, want := range []string{`"name":"token_counter.tokens"`, `"asInt":"5"`, `"name":"token_counter.repository.tokens"`, `"name":"token_counter.scan.duration"`} {
+		if !strings.Contains(string(metrics), want) {
+			t.Errorf("metrics have no %s: %s", want, metrics)
+		}
+	}
+}
+
+func TestTelemetryErrors(t *testing.T) {
+	if newTelemetry("", ".", &CommandOptions{}) != nil {
+		t.Error("telemetry without an endpoint")
+	}
+
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world"})
+	srv, _, _ := otelCollector(t, http.StatusServiceUnavailable)
+	stderr := otelScan(t, dir, srv.URL)
+	if !strings.Contains(stderr, "Warning: sending telemetry to "+srv.URL+": /v1/traces: 503 Service Unavailable") {
+		t.Errorf("export to a failing collector printed %q", stderr)
+	}
+}
+
+func TestParseOTelHeaders(t *testing.T) {
+	tests := []struct {
+		value string
+		want  map[string]string
+	}{
+		{"", map[string]string{}},
+		{"api-key=secret", map[string]string{"api-key": "secret"}},
+		{"a = 1, b=x=y,broken", map[string]string{"a": "1", "b": "x=y"}},
+	}
+	for _, tt := range tests {
+		got := parseOTelHeaders(tt.value)
+		data, _ := json.Marshal(got)
+		want, _ := json.Marshal(tt.want)
+		if string(data) != string(want) {
+			t.Errorf("parseOTelHeaders(%q) = %s, want %s", tt.value, data, want)
+		}
+	}
+}
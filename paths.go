@@ -0,0 +1,31 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// relativeTo returns path relative to root, falling back to path itself,
+// with forward slashes, as reports show paths on every platform
+func relativeTo(root string, path string) string {
+	if rel, err := filepath.Rel(root, path); err == nil {
+		path = rel
+	}
+	return filepath.ToSlash(path)
+}
+
+// matchPath returns the path relative to a root that ignore patterns are
+// matched against, which always uses forward slashes
+func matchPath(root string, path string) (string, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// ruleLine returns the text of an ignore rule for reports, without the
+// carriage return of a file with CRLF line endings
+func ruleLine(line string) string {
+	return strings.TrimRight(line, "\r")
+}
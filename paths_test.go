@@ -0,0 +1,47 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRelativeTo(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "repo")
+	tests := []struct {
+		path string
+		want string
+	}{
+		{filepath.Join(root, "a.txt"), "a.txt"},
+		{filepath.Join(root, "sub", "dir", "b.txt"), "sub/dir/b.txt"},
+		{root, "."},
+		{"relative.txt", "relative.txt"},
+	}
+	for _, tt := range tests {
+		if got := relativeTo(root, tt.path); got != tt.want {
+			t.Errorf("relativeTo(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "repo")
+	if got, err := matchPath(root, filepath.Join(root, "sub", "b.txt")); err != nil || got != "sub/b.txt" {
+		t.Errorf("matchPath = %q, %v, want sub/b.txt", got, err)
+	}
+	if _, err := matchPath(root, "relative.txt"); err == nil {
+		t.Error("matchPath of a relative path under an absolute root succeeded")
+	}
+}
+
+func TestRuleLine(t *testing.T) {
+	tests := []struct{ line, want string }{
+		{"*.log", "*.log"},
+		{"*.log\r", "*.log"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := ruleLine(tt.line); got != tt.want {
+			t.Errorf("ruleLine(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
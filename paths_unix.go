@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+// normalizePath prepares a path given on the command line for a scan. Only
+// Windows paths need it.
+func normalizePath(path string) string {
+	return path
+}
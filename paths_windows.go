@@ -0,0 +1,25 @@
+//go:build windows
+
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// normalizePath prepares a path given on the command line for a scan. The
+// \\?\ prefix of extended-length paths is removed, since git and
+// filepath.Rel don't understand it, and the path is made absolute, so the os
+// package adds the prefix back itself to paths longer than MAX_PATH.
+func normalizePath(path string) string {
+	switch {
+	case strings.HasPrefix(path, `\\?\UNC\`):
+		path = `\\` + path[len(`\\?\UNC\`):]
+	case strings.HasPrefix(path, `\\?\`):
+		path = path[len(`\\?\`):]
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
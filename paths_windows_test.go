@@ -0,0 +1,21 @@
+//go:build windows
+
+package main
+
+import "testing"
+
+func TestNormalizePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{`\\?\C:\repo\sub`, `C:\repo\sub`},
+		{`\\?\UNC\server\share\repo`, `\\server\share\repo`},
+		{`C:\repo`, `C:\repo`},
+	}
+	for _, tt := range tests {
+		if got := normalizePath(tt.path); got != tt.want {
+			t.Errorf("normalizePath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
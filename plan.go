@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// planFormats are the values accepted by plan's -format
+var planFormats = map[string]bool{"text": true, "json": true}
+
+// otherGroup names the files under no directory with a weight
+const otherGroup = "(other)"
+
+// PlanGroup is a weighted directory of a budget plan, with the share of the
+// budget it was allocated and what fits in it
+type PlanGroup struct {
+	Directory string      `json:"directory"`
+	Weight    float64     `json:"weight"`
+	Tokens    int         `json:"tokens"`    // Tokens of all its files
+	Allocated int         `json:"allocated"` // Share of the budget
+	Used      int         `json:"used"`      // Tokens of the files that fit, including the truncated one
+	Status    string      `json:"status"`    // fits, truncated or excluded
+	Files     []*PlanFile `json:"files"`
+}
+
+// PlanFile is a file of a budget plan and whether it fits
+type PlanFile struct {
+	Path   string `json:"path"`
+	Tokens int    `json:"tokens"`
+	Used   int    `json:"used"`   // Tokens of it that fit
+	Status string `json:"status"` // fits, truncated or dropped
+}
+
+// Plan is the split of a token budget across weighted directories
+type Plan struct {
+	Metadata *ScanMetadata `json:"metadata"`
+	Budget   int           `json:"budget"`
+	Reserved int           `json:"reserved,omitempty"` // Of the budget, for the system prompt, tool schemas and output
+	Usable   int           `json:"usable"`             // The budget less what's reserved, split across the directories
+	Used     int           `json:"used"`
+	Leftover int           `json:"leftover"` // Of the usable budget
+	Groups   []*PlanGroup  `json:"directories"`
+}
+
+// planCommand defines the plan subcommand, which splits a token budget across
+// directories by the weights in the config file and reports what fits
+func planCommand(fs *flag.FlagSet) func() {
+	options := &CommandOptions{}
+	var format string
+	var budget, reserve int
+	var showFiles bool
+
+	registerFlags(fs, options)
+	registerWalkFlags(fs, options)
+	registerRevFlag(fs, options)
+	fs.Func("budget", "Total token budget, e.g. 128k (overrides plan.budget in the config file)", func(value string) error {
+		n, err := parseTokenAmount(value)
+		budget = n
+		return err
+	})
+	fs.Func("reserve", "Tokens of the budget to set aside for the system prompt, tool schemas and expected output, e.g. 8k (overrides plan.reserve in the config file)", func(value string) error {
+		n, err := parseTokenAmount(value)
+		reserve = n
+		return err
+	})
+	fs.StringVar(&format, "format", "text", "Output format: text or json")
+	fs.BoolVar(&showFiles, "files", false, "Whether to list the files of each directory and whether they fit")
+	return func() {
+		if !planFormats[format] {
+			fmt.Fprintf(os.Stderr, "Error: unknown format %q (expected text or json)\n", format)
+			exit(1)
+		}
+		if err := resolveTarget(fs, options); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		if options.IsSingleFile {
+			fmt.Fprintln(os.Stderr, "Error: plan needs a directory to scan")
+			exit(1)
+		}
+
+		config, err := loadConfig(options.Path, options.ConfigFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		if budget == 0 {
+			budget = int(config.Plan.Budget)
+		}
+		if budget <= 0 {
+			fmt.Fprintf(os.Stderr, "Error: plan needs a budget, from -budget or plan.budget in %s\n", defaultConfigFile)
+			exit(1)
+		}
+		if reserve == 0 {
+			reserve = int(config.Plan.Reserve)
+		}
+		if reserve >= budget {
+			fmt.Fprintf(os.Stderr, "Error: the reserve of %s tokens leaves nothing of the %s token budget\n", formatCount(reserve), formatCount(budget))
+			exit(1)
+		}
+
+		ctx, cancel := commandContext(options)
+		defer cancel()
+		repo, err := ProcessRepository(ctx, options.Path, options)
+		if interrupted(err) {
+			err = interruptedError(err, options)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error processing %s: %v\n", options.Path, err)
+			exit(1)
+		}
+
+		plan := newPlan(repo, budget, reserve, &config.Plan)
+		if format == "json" {
+			plan.Metadata = newScanMetadata(repo, options)
+			data, _ := json.MarshalIndent(plan, "", "  ")
+			fmt.Println(string(data))
+		} else {
+			printPlan(plan, options, showFiles)
+		}
+
+		PrintErrors(repo)
+		if options.Strict && len(repo.Errors) > 0 {
+			exit(1)
+		}
+	}
+}
+
+// newPlan groups the files of a scan by the most specific weighted directory
+// they're in and splits the budget between the groups in proportion to their
+// weights, once reserve is set aside. A group needing less than its share gets just what it needs, and
+// the rest is split again between the others. Within a group, files are
+// taken smallest first, so as many as possible fit; the first one that
+// doesn't is truncated to what's left and the larger ones are dropped.
+func newPlan(repo *RepoTokenInfo, budget int, reserve int, config *PlanConfig) *Plan {
+	defaultWeight := 1.0
+	if config.DefaultWeight != nil {
+		defaultWeight = *config.DefaultWeight
+	}
+
+	groups := make(map[string]*PlanGroup)
+	for dir, weight := range config.Weights {
+		dir = filepath.ToSlash(filepath.Clean(dir))
+		groups[dir] = &PlanGroup{Directory: dir, Weight: weight}
+	}
+	for _, dirInfo := range repo.Dirs {
+		for _, fileInfo := range dirInfo.Files {
+			relativePath, err := filepath.Rel(repo.Path, fileInfo.Path)
+			if err != nil {
+				relativePath = fileInfo.Path
+			}
+			relativePath = filepath.ToSlash(relativePath)
+
+			var group *PlanGroup
+			for dir, candidate := range groups {
+				if dir == otherGroup || !inPlanDir(relativePath, dir) {
+					continue
+				}
+				if group == nil || planDirDepth(dir) > planDirDepth(group.Directory) {
+					group = candidate
+				}
+			}
+			if group == nil {
+				group = groups[otherGroup]
+			}
+			if group == nil {
+				group = &PlanGroup{Directory: otherGroup, Weight: defaultWeight}
+				groups[otherGroup] = group
+			}
+			group.Tokens += fileInfo.TokenCount
+			group.Files = append(group.Files, &PlanFile{Path: relativePath, Tokens: fileInfo.TokenCount})
+		}
+	}
+
+	plan := &Plan{Budget: budget, Reserved: reserve, Usable: budget - reserve}
+	for _, group := range groups {
+		plan.Groups = append(plan.Groups, group)
+	}
+	sort.Slice(plan.Groups, func(i, j int) bool {
+		a, b := plan.Groups[i], plan.Groups[j]
+		if a.Weight != b.Weight {
+			return a.Weight > b.Weight
+		}
+		return a.Directory < b.Directory
+	})
+
+	// Water-fill the budget: give every group its weighted share of what's
+	// left, settle the groups that need less, and repeat with the others
+	remaining := float64(plan.Usable)
+	shares := make(map[*PlanGroup]float64)
+	var active []*PlanGroup
+	for _, group := range plan.Groups {
+		if group.Weight > 0 && group.Tokens > 0 {
+			active = append(active, group)
+		}
+	}
+	for len(active) > 0 {
+		totalWeight := 0.0
+		for _, group := range active {
+			totalWeight += group.Weight
+		}
+		var unsettled []*PlanGroup
+		for _, group := range active {
+			if share := remaining * group.Weight / totalWeight; float64(group.Tokens) <= share {
+				shares[group] = float64(group.Tokens)
+			} else {
+				unsettled = append(unsettled, group)
+			}
+		}
+		if len(unsettled) == len(active) {
+			for _, group := range active {
+				shares[group] = remaining * group.Weight / totalWeight
+			}
+			break
+		}
+		for _, group := range active {
+			if _, settled := shares[group]; settled {
+				remaining -= shares[group]
+			}
+		}
+		active = unsettled
+	}
+
+	for _, group := range plan.Groups {
+		group.Allocated = int(math.Floor(shares[group]))
+		sort.Slice(group.Files, func(i, j int) bool {
+			if group.Files[i].Tokens != group.Files[j].Tokens {
+				return group.Files[i].Tokens < group.Files[j].Tokens
+			}
+			return group.Files[i].Path < group.Files[j].Path
+		})
+		left := group.Allocated
+		for _, file := range group.Files {
+			switch {
+			case file.Tokens <= left:
+				file.Used, file.Status = file.Tokens, "fits"
+			case left > 0:
+				file.Used, file.Status = left, "truncated"
+			default:
+				file.Status = "dropped"
+			}
+			left -= file.Used
+			group.Used += file.Used
+		}
+		switch {
+		case group.Weight <= 0:
+			group.Status = "excluded"
+		case group.Used >= group.Tokens:
+			group.Status = "fits"
+		default:
+			group.Status = "truncated"
+		}
+		plan.Used += group.Used
+	}
+	plan.Leftover = plan.Usable - plan.Used
+	return plan
+}
+
+// inPlanDir reports whether a root-relative path is in the weighted directory
+// dir, "." being the root
+func inPlanDir(path string, dir string) bool {
+	return dir == "." || path == dir || strings.HasPrefix(path, dir+"/")
+}
+
+// planDirDepth returns how deep a weighted directory is, for the most
+// specific one to win
+func planDirDepth(dir string) int {
+	if dir == "." {
+		return 0
+	}
+	return strings.Count(dir, "/") + 1
+}
+
+// printPlan prints the directories of a plan with their allocations, and with
+// showFiles their files
+func printPlan(plan *Plan, options *CommandOptions, showFiles bool) {
+	unit := options.unitName()
+	if plan.Reserved > 0 {
+		fmt.Printf("Budget: %s %s, %s reserved, %s usable\n\n", formatCount(plan.Budget), unit, formatCount(plan.Reserved), formatCount(plan.Usable))
+	} else {
+		fmt.Printf("Budget: %s %s\n\n", formatCount(plan.Budget), unit)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(w, "DIRECTORY\tWEIGHT\t%s\tALLOCATED\tUSED\t\tSTATUS\n", strings.ToUpper(unit))
+	for _, group := range plan.Groups {
+		fits, truncated, dropped := 0, 0, 0
+		for _, file := range group.Files {
+			switch file.Status {
+			case "fits":
+				fits++
+			case "truncated":
+				truncated++
+			default:
+				dropped++
+			}
+		}
+		status := group.Status
+		if group.Status == "truncated" {
+			status = fmt.Sprintf("truncated: %d of %d files fit", fits, len(group.Files))
+			if truncated > 0 {
+				status += ", 1 truncated"
+			}
+			if dropped > 0 {
+				status += fmt.Sprintf(", %d dropped", dropped)
+			}
+		}
+		fmt.Fprintf(w, "%s\t%g\t%s\t%s\t%s\t\t%s\n", group.Directory, group.Weight, formatCount(group.Tokens), formatCount(group.Allocated), formatCount(group.Used), status)
+	}
+	w.Flush()
+	if plan.Reserved > 0 {
+		fmt.Printf("\nUsed: %s %s, usable budget remaining: %s %s\n", formatCount(plan.Used), unit, formatCount(plan.Leftover), unit)
+	} else {
+		fmt.Printf("\nUsed: %s %s, leftover: %s %s\n", formatCount(plan.Used), unit, formatCount(plan.Leftover), unit)
+	}
+
+	if !showFiles {
+		return
+	}
+	for _, group := range plan.Groups {
+		if len(group.Files) == 0 {
+			continue
+		}
+		fmt.Printf("\n%s:\n", group.Directory)
+		for _, file := range group.Files {
+			switch file.Status {
+			case "truncated":
+				fmt.Printf("  %s: truncated to %s of %s %s\n", file.Path, formatCount(file.Used), formatCount(file.Tokens), unit)
+			default:
+				fmt.Printf("  %s: %s (%s %s)\n", file.Path, file.Status, formatCount(file.Tokens), unit)
+			}
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// planRepo returns a scan of the files under /repo with the given counts, by
+// slash-separated path
+func planRepo(files map[string]int) *RepoTokenInfo {
+	repo := &RepoTokenInfo{Path: "/repo", Dirs: make(map[string]*DirTokenInfo)}
+	for path, tokens := range files {
+		repo.addFile(&FileTokenInfo{Path: filepath.Join("/repo", filepath.FromSlash(path)), TokenCount: tokens})
+	}
+	return repo
+}
+
+func TestNewPlan(t *testing.T) {
+	repo := planRepo(map[string]int{"src/a.go": 100, "src/b.go": 50, "src/gen/c.go": 40, "docs/x.md": 30, "main.go": 20})
+	zero := 0.0
+	tests := []struct {
+		name     string
+		budget   int
+		reserve  int
+		config   PlanConfig
+		want     map[string]string // Group status and used tokens, like "truncated 60"
+		leftover int
+	}{
+		{"weighted", 100, 0, PlanConfig{Weights: map[string]float64{"src": 3, "docs": 1}},
+			map[string]string{"src": "truncated 60", "docs": "truncated 20", otherGroup: "fits 20"}, 0},
+		{"everything fits", 1000, 0, PlanConfig{Weights: map[string]float64{"src": 3}},
+			map[string]string{"src": "fits 190", otherGroup: "fits 50"}, 760},
+		{"most specific directory", 1000, 0, PlanConfig{Weights: map[string]float64{"src": 1, "src/gen": 0}},
+			map[string]string{"src": "fits 150", "src/gen": "excluded 0", otherGroup: "fits 50"}, 800},
+		{"reserve and default weight", 120, 20, PlanConfig{Weights: map[string]float64{"src": 1}, DefaultWeight: &zero},
+			map[string]string{"src": "truncated 100", otherGroup: "excluded 0"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := newPlan(repo, tt.budget, tt.reserve, &tt.config)
+			got := make(map[string]string)
+			for _, group := range plan.Groups {
+				got[group.Directory] = group.Status + " " + strconv.Itoa(group.Used)
+				if group.Used > group.Allocated && group.Weight > 0 {
+					t.Errorf("%s uses %d of its %d tokens", group.Directory, group.Used, group.Allocated)
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("groups %v, want %v", got, tt.want)
+			}
+			for dir, want := range tt.want {
+				if got[dir] != want {
+					t.Errorf("%s is %q, want %q", dir, got[dir], want)
+				}
+			}
+			if plan.Usable != tt.budget-tt.reserve || plan.Leftover != tt.leftover || plan.Used+plan.Leftover != plan.Usable {
+				t.Errorf("usable %d, used %d, leftover %d, want leftover %d", plan.Usable, plan.Used, plan.Leftover, tt.leftover)
+			}
+		})
+	}
+}
+
+func TestNewPlanFiles(t *testing.T) {
+	repo := planRepo(map[string]int{"src/a.go": 100, "src/b.go": 50, "src/c.go": 10})
+	plan := newPlan(repo, 80, 0, &PlanConfig{Weights: map[string]float64{"src": 1}})
+	var got []string
+	for _, file := range plan.Groups[0].Files {
+		got = append(got, file.Path+" "+file.Status+" "+strconv.Itoa(file.Used))
+	}
+	if want := "src/c.go fits 10,src/b.go fits 50,src/a.go truncated 20"; strings.Join(got, ",") != want {
+		t.Errorf("files %v, want %s", got, want)
+	}
+
+	out := captureStdout(t, func() { printPlan(plan, &CommandOptions{}, true) })
+	for _, want := range []string{"Budget: 80 tokens", "truncated: 2 of 3 files fit, 1 truncated", "  src/a.go: truncated to 20 of 100 tokens", "Used: 80 tokens, leftover: 0 tokens"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("plan is missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestPlanCommand(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		".token-counter.yaml": "plan:\n  budget: 3\n  weights:\n    src: 2\n",
+		"src/a.txt":           "one two",
+		"b.txt":               "three four",
+		"empty.yaml":          "plan: {}\n",
+	})
+	out := captureStdout(t, func() { findCommand("plan").run([]string{"-model", "cl100k_base", "-format", "json", dir}) })
+	var plan Plan
+	if err := json.Unmarshal([]byte(out), &plan); err != nil {
+		t.Fatalf("plan -format json doesn't parse: %v\n%s", err, out)
+	}
+	if plan.Budget != 3 || plan.Used != 3 || len(plan.Groups) != 2 || plan.Groups[0].Directory != "src" || plan.Groups[0].Allocated != 2 || plan.Metadata == nil {
+		t.Errorf("plan %+v", plan)
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"format", []string{"-format", "xml"}, `Error: unknown format "xml"`},
+		{"no budget", []string{"-config", filepath.Join(dir, "empty.yaml")}, "Error: plan needs a budget, from -budget or plan.budget in .token-counter.yaml"},
+		{"missing config", []string{"-config", filepath.Join(dir, "missing.yaml")}, "missing.yaml: no such file or directory"},
+		{"reserve", []string{"-budget", "8k", "-reserve", "8k"}, "Error: the reserve of 8,000 tokens leaves nothing of the 8,000 token budget"},
+		{"bad budget", []string{"-budget", "lots"}, `invalid value "lots" for flag -budget`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderr, code := exitStatus(t, func() { findCommand("plan").run(append(tt.args, dir)) })
+			if code == 0 || !strings.Contains(stderr, tt.want) {
+				t.Errorf("exit %d, stderr:\n%s", code, stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// gitHubURLPattern matches https://github.com/org/repo URLs, optionally with
+// a .git suffix, a /tree/<branch> path or an @<branch> suffix
+var gitHubURLPattern = regexp.MustCompile(`^https?://github\.com/([^/@]+)/([^/@]+?)(?:\.git)?(?:/tree/([^@]+?))?/?(?:@(.+))?$`)
+
+// exitHooks are run by exit before the program terminates
+var exitHooks []func()
+
+// atExit registers a function to run before the program exits, such as
+// removing a temporary clone
+func atExit(hook func()) {
+	exitHooks = append(exitHooks, hook)
+}
+
+// runExitHooks runs the registered exit hooks, most recent first
+func runExitHooks() {
+	for i := len(exitHooks) - 1; i >= 0; i-- {
+		exitHooks[i]()
+	}
+	exitHooks = nil
+}
+
+// exit runs the exit hooks and terminates the program with the given code
+func exit(code int) {
+	runExitHooks()
+	os.Exit(code)
+}
+
+// isGitHubURL reports whether path refers to a remote GitHub repository
+func isGitHubURL(path string) bool {
+	return gitHubURLPattern.MatchString(path)
+}
+
+// fetchGitHubRepo downloads a GitHub repository into a temporary directory
+// and returns the path of the checkout. It shallow-clones with git when git is
+// available and falls back to the tarball API otherwise. The directory is
+// removed when the program exits.
+func fetchGitHubRepo(url string) (string, error) {
+	m := gitHubURLPattern.FindStringSubmatch(url)
+	if m == nil {
+		return "", fmt.Errorf("not a GitHub repository URL: %s", url)
+	}
+	owner, name := m[1], m[2]
+	branch := m[3]
+	if m[4] != "" {
+		branch = m[4]
+	}
+
+	tmpDir, err := os.MkdirTemp("", "token-counter-")
+	if err != nil {
+		return "", err
+	}
+	atExit(func() { os.RemoveAll(tmpDir) })
+
+	dir := filepath.Join(tmpDir, name)
+	if _, err := exec.LookPath("git"); err == nil {
+		args := []string{"clone", "--quiet", "--depth", "1", "--single-branch"}
+		if branch != "" {
+			args = append(args, "--branch", branch)
+		}
+		args = append(args, fmt.Sprintf("https://github.com/%s/%s.git", owner, name), dir)
+
+		cmd := exec.Command("git", args...)
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return "", fmt.Errorf("error cloning %s: %v", url, err)
+		}
+		return dir, nil
+	}
+
+	if err := downloadGitHubTarball(owner, name, branch, dir); err != nil {
+		return "", fmt.Errorf("error downloading %s: %v", url, err)
+	}
+	return dir, nil
+}
+
+// downloadGitHubTarball extracts a repository snapshot from the GitHub
+// tarball API into dir, stripping the archive's top-level directory
+func downloadGitHubTarball(owner, name, ref, dir string) error {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/tarball/%s", owner, name, ref)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response from %s: %s", url, resp.Status)
+	}
+
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return err
+	}
+	// Entries look like owner-repo-sha/path/to/file
+	return extractTar(gz, dir, true)
+}
+
+// extractTar extracts the directories and regular files of a tar stream into
+// dir, dropping the top-level directory of every entry if stripTop is set
+func extractTar(r io.Reader, dir string, stripTop bool) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		name := header.Name
+		if stripTop {
+			parts := strings.SplitN(name, "/", 2)
+			if len(parts) < 2 {
+				continue
+			}
+			name = parts[1]
+		}
+		if name == "" {
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid path in archive: %s", header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode)&0755)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
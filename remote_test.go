@@ -0,0 +1,93 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIsGitHubURL(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"https://github.com/org/repo", true},
+		{"https://github.com/org/repo.git", true},
+		{"https://github.com/org/repo/tree/main", true},
+		{"https://github.com/org/repo@v1.0", true},
+		{"http://github.com/org/repo/", true},
+		{"https://gitlab.com/org/repo", false},
+		{"https://github.com/org", false},
+		{"./github.com/org/repo", false},
+	}
+	for _, tt := range tests {
+		if got := isGitHubURL(tt.path); got != tt.want {
+			t.Errorf("isGitHubURL(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+
+	if _, err := fetchGitHubRepo("https://example.com/org/repo"); err == nil {
+		t.Error("fetchGitHubRepo of a URL that isn't GitHub's succeeded")
+	}
+}
+
+// tarball returns a tar stream of the files, by name
+func tarball(t *testing.T, files map[string]string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, contents := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(contents)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(contents)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestExtractTar(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		stripTop bool
+		want     []string
+		wantErr  string
+	}{
+		{"plain", map[string]string{"a.txt": "a", "src/b.go": "b"}, false, []string{"a.txt", "src/b.go"}, ""},
+		{"top directory stripped", map[string]string{"org-repo-abc123/a.txt": "a", "org-repo-abc123/src/b.go": "b", "README": "dropped"}, true, []string{"a.txt", "src/b.go"}, ""},
+		{"path escaping the directory", map[string]string{"../evil.txt": "x"}, false, nil, "invalid path in archive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			err := extractTar(tarball(t, tt.files), dir, tt.stripTop)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("extractTar error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+				if err == nil && !info.IsDir() {
+					got = append(got, relativeTo(dir, path))
+				}
+				return nil
+			})
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("extracted %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ScanResult is the structured form of a scan, written by -format json
+type ScanResult struct {
+	Metadata    *ScanMetadata      `json:"metadata"`
+	Total       int                `json:"total"`
+	ModelTotals map[string]int     `json:"model_totals,omitempty"`   // With -models
+	Stripped    int                `json:"stripped,omitempty"`       // With -strip
+	Segments    map[string]int     `json:"segment_totals,omitempty"` // With -segments
+	Cost        *CostEstimate      `json:"cost,omitempty"`           // With -price
+	Directories []*DirResult       `json:"directories"`
+	BelowMin    *BelowMinResult    `json:"below_min,omitempty"` // With -min, the files left out of directories
+	Generated   *GeneratedResult   `json:"generated,omitempty"` // The counted files that look generated
+	Ages        *AgeReport         `json:"ages,omitempty"`      // With -by-age
+	Stats       *StatsResult       `json:"stats,omitempty"`     // With -stats
+	Authors     []*AuthorTokenInfo `json:"authors,omitempty"`   // With -by-author
+	Images      []*ImageResult     `json:"images,omitempty"`
+	Errors      []string           `json:"errors,omitempty"`
+}
+
+// StatsResult is the -stats distribution of the per-file counts of a
+// ScanResult
+type StatsResult struct {
+	FileStats
+	Histogram []histogramBucket `json:"histogram"`
+}
+
+// DirResult is a directory of a ScanResult, with the files directly in it
+type DirResult struct {
+	Path        string         `json:"path"`
+	Total       int            `json:"total"`
+	ModelTotals map[string]int `json:"model_totals,omitempty"`
+	Files       []*FileResult  `json:"files"`
+}
+
+// FileResult is a counted file of a ScanResult
+type FileResult struct {
+	Path        string           `json:"path"`
+	Total       int              `json:"total"`
+	Bytes       int              `json:"bytes"`
+	Lines       int              `json:"lines"`
+	ModelTotals map[string]int   `json:"model_totals,omitempty"`
+	Model       string           `json:"model,omitempty"` // Model a model route counted the file with
+	Stripped    int              `json:"stripped,omitempty"`
+	Segments    map[string]int   `json:"segments,omitempty"`    // With -segments, for composite files
+	Encoding    string           `json:"encoding,omitempty"`    // Encoding the file was transcoded from
+	Generated   string           `json:"generated,omitempty"`   // Why the file looks generated, if it does
+	Modified    *time.Time       `json:"modified,omitempty"`    // With -with-metadata
+	LastAuthor  string           `json:"last_author,omitempty"` // With -with-metadata, for files git tracks
+	LastCommit  *time.Time       `json:"last_commit,omitempty"` // Author date of the last commit that changed the file
+	Head        *TruncationPoint `json:"head,omitempty"`        // With -head-tokens
+	Tail        *TruncationPoint `json:"tail,omitempty"`        // With -tail-tokens
+	LineRanges  []*Snippet       `json:"line_ranges,omitempty"` // With -lines
+	Functions   []*Snippet       `json:"functions,omitempty"`   // With -per-function
+}
+
+// ImageResult is an image of a ScanResult, with its estimated vision tokens
+type ImageResult struct {
+	Path   string `json:"path"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	OpenAI int    `json:"openai_tokens"`
+	Claude int    `json:"claude_tokens"`
+}
+
+// BelowMinResult sums up the files with fewer tokens than -min, which count
+// in the total unless -filter-affects-totals is set
+type BelowMinResult struct {
+	Files   int  `json:"files"`
+	Total   int  `json:"total"`
+	InTotal bool `json:"in_total"`
+}
+
+// GeneratedResult sums up the counted files that look generated, which
+// -exclude-generated leaves out
+type GeneratedResult struct {
+	Files int `json:"files"`
+	Total int `json:"total"`
+}
+
+// newScanResult builds the structured form of a scan, with paths relative
+// to the scan root and directories and files in -sort order
+func newScanResult(repo *RepoTokenInfo, options *CommandOptions) *ScanResult {
+	rootPath := repo.Path
+	if options.IsSingleFile {
+		rootPath = filepath.Dir(repo.Path)
+	}
+	relative := func(path string) string {
+		if rel, err := filepath.Rel(rootPath, path); err == nil {
+			return filepath.ToSlash(rel)
+		}
+		return path
+	}
+
+	result := &ScanResult{
+		Metadata:    newScanMetadata(repo, options),
+		Total:       repo.TokenCount,
+		ModelTotals: repo.ModelCounts,
+		Stripped:    repo.StrippedTokenCount,
+		Segments:    repo.SegmentCounts,
+		Cost:        estimateCost(repo.TokenCount, options),
+		Directories: []*DirResult{},
+	}
+	for _, dirInfo := range options.sortedDirs(repo) {
+		dir := &DirResult{
+			Path:        relative(dirInfo.Path),
+			Total:       dirInfo.TokenCount,
+			ModelTotals: dirInfo.ModelCounts,
+			Files:       []*FileResult{},
+		}
+		files := append([]*FileTokenInfo(nil), dirInfo.Files...)
+		options.sortFiles(files)
+		for _, fileInfo := range files {
+			dir.Files = append(dir.Files, &FileResult{
+				Path:        relative(fileInfo.Path),
+				Total:       fileInfo.TokenCount,
+				Bytes:       fileInfo.Bytes,
+				Lines:       fileInfo.Lines,
+				ModelTotals: fileInfo.ModelCounts,
+				Model:       fileInfo.Model,
+				Stripped:    fileInfo.StrippedTokenCount,
+				Segments:    fileInfo.Segments,
+				Encoding:    fileInfo.Encoding,
+				Generated:   fileInfo.Generated,
+				Modified:    optionalTime(fileInfo.ModTime),
+				LastAuthor:  fileInfo.LastAuthor,
+				LastCommit:  optionalTime(fileInfo.LastCommitTime),
+				Head:        fileInfo.Head,
+				Tail:        fileInfo.Tail,
+				LineRanges:  fileInfo.LineRanges,
+				Functions:   fileInfo.Functions,
+			})
+		}
+		result.Directories = append(result.Directories, dir)
+	}
+	if repo.GeneratedFiles > 0 {
+		result.Generated = &GeneratedResult{Files: repo.GeneratedFiles, Total: repo.GeneratedTokens}
+	}
+	if options.ByAge {
+		result.Ages = countByAge(repo, options)
+	}
+	if options.Stats {
+		counts := fileCounts(repo, options)
+		result.Stats = &StatsResult{FileStats: computeFileStats(counts), Histogram: buildHistogram(counts)}
+	}
+	result.Authors = repo.Authors
+	if len(repo.BelowMin) > 0 {
+		result.BelowMin = &BelowMinResult{Files: len(repo.BelowMin), InTotal: !options.FilterAffectsTotals}
+		for _, fileInfo := range repo.BelowMin {
+			result.BelowMin.Total += fileInfo.TokenCount
+		}
+	}
+	for _, img := range repo.Images {
+		result.Images = append(result.Images, &ImageResult{
+			Path:   relative(img.Path),
+			Width:  img.Width,
+			Height: img.Height,
+			OpenAI: img.OpenAITokens,
+			Claude: img.ClaudeTokens,
+		})
+	}
+	for _, fileErr := range repo.Errors {
+		result.Errors = append(result.Errors, fileErr.Error())
+	}
+	return result
+}
+
+// optionalTime returns a pointer to t, or nil if it's zero, so unset times
+// are left out of the structured reports
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// WriteJSON writes the scan as an indented JSON ScanResult
+func WriteJSON(w io.Writer, repo *RepoTokenInfo, options *CommandOptions) error {
+	data, err := json.MarshalIndent(newScanResult(repo, options), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+// structuredFormats are the -format values that write a document, to
+// -output or stdout, rather than a report for the terminal
+var structuredFormats = map[string]func(io.Writer, *RepoTokenInfo, *CommandOptions) error{
+	"html": WriteHTML,
+	"json": WriteJSON,
+	"yaml": WriteYAML,
+	"toml": WriteTOML,
+	// -template selects this one itself, in loadTemplate
+	"template": WriteTemplate,
+}
+
+// writeStructured writes the scan in a structured format to -output, or to
+// stdout without it
+func writeStructured(write func(io.Writer, *RepoTokenInfo, *CommandOptions) error, repo *RepoTokenInfo, options *CommandOptions) error {
+	if options.Output == "" {
+		return write(os.Stdout, repo, options)
+	}
+	file, err := os.Create(options.Output)
+	if err != nil {
+		return err
+	}
+	if err := write(file, repo, options); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestPrintReportStructuredStats(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"a.go":     "package a\n\nfunc A() int { return 1 }\n",
+		"b/b.go":   "package b\n",
+		"b/README": "Some words about b.\n",
+	})
+
+	tests := []struct {
+		format string
+		parse  func(string) (map[string]interface{}, error)
+	}{
+		{"json", func(out string) (map[string]interface{}, error) {
+			var doc map[string]interface{}
+			return doc, json.Unmarshal([]byte(out), &doc)
+		}},
+		{"yaml", func(out string) (map[string]interface{}, error) {
+			var doc map[string]interface{}
+			return doc, yaml.Unmarshal([]byte(out), &doc)
+		}},
+		{"toml", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			repo, options := scanTree(t, dir, "-format", tt.format, "-stats")
+			out := captureStdout(t, func() { printReport(repo, options) })
+			if strings.Contains(out, "Statistics (") || strings.Contains(out, "Histogram (") {
+				t.Fatalf("-format %s -stats printed the text tables:\n%s", tt.format, out)
+			}
+			if tt.parse == nil {
+				if !strings.Contains(out, "[stats]") {
+					t.Fatalf("-format %s -stats has no stats table:\n%s", tt.format, out)
+				}
+				return
+			}
+			doc, err := tt.parse(out)
+			if err != nil {
+				t.Fatalf("-format %s -stats doesn't parse: %v\n%s", tt.format, err, out)
+			}
+			stats, ok := doc["stats"].(map[string]interface{})
+			if !ok {
+				t.Fatalf("-format %s -stats has no stats: %v", tt.format, doc)
+			}
+			if files, _ := stats["files"].(float64); tt.format == "json" && files != 3 {
+				t.Errorf("stats.files = %v, want 3", stats["files"])
+			}
+		})
+	}
+}
+
+func TestPrintReportTextStats(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.go": "package a\n"})
+	repo, options := scanTree(t, dir, "-stats")
+	out := captureStdout(t, func() { printReport(repo, options) })
+	if !strings.Contains(out, "Statistics (tokens per file):") {
+		t.Fatalf("-stats didn't print the statistics:\n%s", out)
+	}
+}
+
+func TestPrintReportQuiet(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world", "b/c.txt": "one two three"})
+
+	for _, format := range []string{"text", "json", "tree"} {
+		t.Run(format, func(t *testing.T) {
+			repo, options := scanTree(t, dir, "-model", "cl100k_base", "-quiet", "-format", format)
+			out := captureStdout(t, func() { printReport(repo, options) })
+			if want := strconv.Itoa(repo.TokenCount) + "\n"; out != want {
+				t.Errorf("-quiet -format %s printed %q, want %q", format, out, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// checkpointInterval is how often a -resume scan saves the counts it made
+const checkpointInterval = 30 * time.Second
+
+// checkpointPath returns the file the checkpoint of a scan of root is kept
+// in, under the user's cache directory, named after the root and the
+// settings of the whole scan, so only a scan of the same files resumes it
+func checkpointPath(root string, scan string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(root + "\x00" + scan))
+	return filepath.Join(dir, "token-counter", "checkpoints", hex.EncodeToString(sum[:16])+".json"), nil
+}
+
+// validateResume checks that -resume is used on the scan of a directory
+func validateResume(options *CommandOptions, filesFrom string) error {
+	if !options.Resume {
+		return nil
+	}
+	switch {
+	case options.IsSingleFile || filesFrom != "":
+		return fmt.Errorf("-resume only applies to the scan of a directory")
+	case options.Cached:
+		return fmt.Errorf("-resume can't be used with -cached, which reuses the counts of the last scan already")
+	}
+	return nil
+}
+
+// resumableScan scans the options' path for -resume. The counts made so far
+// are saved every checkpointInterval, and when the scan is interrupted or
+// fails, so the next -resume scan of the same files reuses those of the
+// files that are unchanged since, by their modification time and size, and
+// only reads the rest. The aggregates are rebuilt from the counts, so nothing
+// else needs saving. The checkpoint is removed once a scan completes.
+func resumableScan(ctx context.Context, options *CommandOptions) (*RepoTokenInfo, error) {
+	scan := scanSettings(options)
+	cache := openCountCache(options, func(root string, settings string) (string, error) {
+		return checkpointPath(root, scan)
+	})
+	cache.checkpoint = checkpointInterval
+	if !options.Quiet {
+		if len(cache.entries) > 0 {
+			logger.Info("resuming from the checkpoint", "files", len(cache.entries), "path", cache.file)
+		} else {
+			logger.Info("no checkpoint to resume from, starting the scan", "path", cache.file)
+		}
+	}
+
+	options.cache = cache
+	repo, err := ProcessRepository(ctx, options.Path, options)
+	options.cache = nil
+	logger.Debug("reused checkpointed counts", "files", cache.hits)
+	if err != nil || repo.Partial {
+		if saveErr := cache.save(); saveErr != nil {
+			logger.Warn("not saving the checkpoint", "err", saveErr)
+		} else {
+			logger.Warn("saved the checkpoint; run the scan again with -resume to continue", "files", len(cache.counted))
+		}
+		return repo, err
+	}
+	if err := os.Remove(cache.file); err != nil && cache.file != "" && !os.IsNotExist(err) {
+		logger.Warn("not removing the checkpoint", "path", cache.file, "err", err)
+	}
+	return repo, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateResume(t *testing.T) {
+	tests := []struct {
+		name      string
+		options   CommandOptions
+		filesFrom string
+		want      string
+	}{
+		{"off", CommandOptions{IsSingleFile: true}, "", ""},
+		{"directory", CommandOptions{Resume: true}, "", ""},
+		{"file", CommandOptions{Resume: true, IsSingleFile: true}, "", "-resume only applies to the scan of a directory"},
+		{"-files-from", CommandOptions{Resume: true}, "list.txt", "-resume only applies to the scan of a directory"},
+		{"-cached", CommandOptions{Resume: true, Cached: true}, "", "-resume can't be used with -cached"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateResume(&tt.options, tt.filesFrom)
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if !strings.HasPrefix(got, tt.want) || (tt.want == "") != (err == nil) {
+				t.Errorf("validateResume = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResumableScan(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world", "sub/b.txt": "one two three"})
+	options := testOptions(t, "-model", "cl100k_base")
+	options.Path = dir
+
+	// A scan that fails after the first file leaves a checkpoint of it
+	stop := errors.New("stopped")
+	options.OnFile = func(*FileTokenInfo) error { return stop }
+	if _, err := resumableScan(context.Background(), options); err != stop {
+		t.Fatalf("interrupted scan returned %v", err)
+	}
+	options.OnFile = nil
+	file, err := checkpointPath(dir, scanSettings(options))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored scanCacheFile
+	data, err := os.ReadFile(file)
+	if err != nil || json.Unmarshal(data, &stored) != nil || len(stored.Files) != 1 || stored.Files[0].Path != "a.txt" {
+		t.Fatalf("the checkpoint has %s, %v", data, err)
+	}
+
+	// Resuming takes the checkpointed counts, even when they're wrong, and
+	// removes the checkpoint once the scan is done
+	stored.Files[0].Info.TokenCount = 100
+	data, _ = json.Marshal(&stored)
+	os.WriteFile(file, data, 0o644)
+	repo, err := resumableScan(context.Background(), options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if repo.TokenCount != 103 {
+		t.Errorf("resumed scan counted %d tokens, want 103 from the checkpoint", repo.TokenCount)
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("the checkpoint is left after a complete scan: %v", err)
+	}
+
+	// Other settings don't resume the checkpoint
+	other := testOptions(t, "-model", "o200k_base")
+	if path, _ := checkpointPath(dir, scanSettings(other)); path == file || filepath.Dir(path) != filepath.Dir(file) {
+		t.Errorf("checkpoints %s and %s", path, file)
+	}
+}
+
+func TestResumeCommand(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	writeTree(t, dir, map[string]string{"a.txt": "hello world"})
+	if out := captureStdout(t, func() { findCommand("scan").run([]string{"-resume", "-quiet", "-model", "cl100k_base", dir}) }); out != "2\n" {
+		t.Errorf("scan -resume printed %q", out)
+	}
+	stderr, code := exitStatus(t, func() { findCommand("scan").run([]string{"-resume", "-cached", dir}) })
+	if code != 1 || !strings.Contains(stderr, "Error: -resume can't be used with -cached") {
+		t.Errorf("exit %d, stderr:\n%s", code, stderr)
+	}
+}
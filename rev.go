@@ -0,0 +1,279 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// registerRevFlag registers -rev, for the commands that scan a path through
+// resolveTarget
+func registerRevFlag(fs *flag.FlagSet, options *CommandOptions) {
+	fs.StringVar(&options.Rev, "rev", "", "Count the files at this commit, tag or branch, read from the git object database, instead of the working tree")
+}
+
+// snapshotRev replaces options.Path with a snapshot of the same path at
+// options.Rev, extracted from the git object database into a temporary
+// directory, so the working tree is left alone. The snapshot is named after
+// the repository and the revision, and removed when the program exits.
+// Reports name the path as given rather than the snapshot.
+func snapshotRev(options *CommandOptions) error {
+	if isGitHubURL(options.Path) {
+		return fmt.Errorf("-rev needs a local git repository")
+	}
+	if options.ByAuthor {
+		return fmt.Errorf("-by-author can't be used with -rev")
+	}
+	if options.WithMetadata {
+		return fmt.Errorf("-with-metadata can't be used with -rev")
+	}
+	if options.ByAge {
+		return fmt.Errorf("-by-age can't be used with -rev")
+	}
+
+	// The path may not exist in the working tree, if it was removed since
+	dir, base := options.Path, ""
+	if info, err := os.Stat(options.Path); err != nil || !info.IsDir() {
+		dir, base = filepath.Dir(options.Path), filepath.Base(options.Path)
+	}
+	root, err := git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return err
+	}
+	prefix, err := git(dir, "rev-parse", "--show-prefix")
+	if err != nil {
+		return err
+	}
+	prefix = strings.TrimSuffix(prefix+base, "/")
+
+	commit, err := git(root, "rev-parse", "--verify", "--quiet", options.Rev+"^{commit}")
+	if err != nil {
+		return fmt.Errorf("unknown revision %q", options.Rev)
+	}
+	if prefix != "" {
+		if _, err := git(root, "cat-file", "-t", commit+":"+prefix); err != nil {
+			return fmt.Errorf("%s doesn't exist at %s", prefix, options.Rev)
+		}
+	}
+
+	tmpDir, err := os.MkdirTemp("", "token-counter-rev-")
+	if err != nil {
+		return err
+	}
+	atExit(func() { os.RemoveAll(tmpDir) })
+	snapshot := filepath.Join(tmpDir, filepath.Base(root)+"@"+strings.ReplaceAll(options.Rev, "/", "-"))
+	if err := os.Mkdir(snapshot, 0o755); err != nil {
+		return err
+	}
+	if !options.Quiet {
+		logger.Info("reading revision", "rev", options.Rev, "commit", commit)
+	}
+	if err := readCommit(root, commit, prefix, snapshot); err != nil {
+		return err
+	}
+
+	options.revPath = options.Path
+	options.Path = filepath.Join(snapshot, filepath.FromSlash(prefix))
+	options.revSnapshot = options.Path
+	options.RevCommit = commit
+	return nil
+}
+
+// readCommit writes the files of a commit under prefix into dir, reading the
+// tree with git ls-tree and the blobs with git cat-file. Unlike git archive,
+// these ignore .gitattributes, so export-ignore and export-subst don't change
+// what's counted. Symlinks are recreated, and submodules left as empty
+// directories, like in a fresh clone.
+func readCommit(root string, commit string, prefix string, dir string) error {
+	args := []string{"ls-tree", "-r", "-z", "--full-tree", commit}
+	if prefix != "" {
+		args = append(args, "--", prefix)
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Dir = root
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	listing, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("git ls-tree: %s", msg)
+		}
+		return fmt.Errorf("git ls-tree: %v", err)
+	}
+
+	// Entries look like <mode> SP <type> SP <object> TAB <path> NUL
+	type blob struct {
+		mode   string
+		object string
+		target string
+	}
+	var blobs []blob
+	for _, entry := range strings.Split(string(listing), "\x00") {
+		meta, name, ok := strings.Cut(entry, "\t")
+		fields := strings.Fields(meta)
+		if !ok || len(fields) != 3 {
+			continue
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		if !strings.HasPrefix(target, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("invalid path in %s: %s", commit, name)
+		}
+		switch fields[1] {
+		case "blob":
+			blobs = append(blobs, blob{fields[0], fields[2], target})
+		case "commit":
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		}
+	}
+	if len(blobs) == 0 {
+		return nil
+	}
+
+	cmd = exec.Command("git", "cat-file", "--batch")
+	cmd.Dir = root
+	stderr.Reset()
+	cmd.Stderr = &stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go func() {
+		defer stdin.Close()
+		w := bufio.NewWriter(stdin)
+		for _, b := range blobs {
+			fmt.Fprintln(w, b.object)
+		}
+		w.Flush()
+	}()
+	r := bufio.NewReader(stdout)
+	var writeErr error
+	for _, b := range blobs {
+		if writeErr = writeBlob(r, b.mode, b.target); writeErr != nil {
+			break
+		}
+	}
+	io.Copy(io.Discard, stdout) // Let git finish if writing failed
+	if err := cmd.Wait(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("git cat-file: %s", msg)
+		}
+		return fmt.Errorf("git cat-file: %v", err)
+	}
+	return writeErr
+}
+
+// writeBlob reads the next object of git cat-file --batch from r and writes
+// it to target, as a symlink for mode 120000 and a file otherwise
+func writeBlob(r *bufio.Reader, mode string, target string) error {
+	// Each object is <object> SP <type> SP <size> LF <contents> LF
+	header, err := r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("git cat-file: %v", err)
+	}
+	fields := strings.Fields(header)
+	if len(fields) != 3 {
+		return fmt.Errorf("git cat-file: %s", strings.TrimSpace(header))
+	}
+	size, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return fmt.Errorf("git cat-file: %s", strings.TrimSpace(header))
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+
+	if mode == "120000" {
+		link := make([]byte, size)
+		if _, err := io.ReadFull(r, link); err != nil {
+			return err
+		}
+		if err := os.Symlink(string(link), target); err != nil {
+			return err
+		}
+	} else {
+		perm := os.FileMode(0o644)
+		if mode == "100755" {
+			perm = 0o755
+		}
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+		if err != nil {
+			return err
+		}
+		_, err = io.CopyN(f, r, size)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	_, err = r.Discard(1)
+	return err
+}
+
+// revReportedPath returns the path a report names for a path of the -rev
+// snapshot: the same path under the one -rev was given. Other paths,
+// and everything without -rev, are returned as they are.
+func revReportedPath(path string, options *CommandOptions) string {
+	if options.revSnapshot == "" {
+		return path
+	}
+	rel, err := filepath.Rel(options.revSnapshot, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return path
+	}
+	return filepath.Join(options.revPath, rel)
+}
+
+// reportRevPaths renames the paths of a scan of the -rev snapshot after the
+// path -rev was given, so reports don't show the temporary directory. It's
+// done once the files have been read, just before reporting.
+func reportRevPaths(repo *RepoTokenInfo, options *CommandOptions) {
+	if options.revSnapshot == "" {
+		return
+	}
+	rename := func(path *string) { *path = revReportedPath(*path, options) }
+	rename(&repo.Path)
+	dirs := make(map[string]*DirTokenInfo, len(repo.Dirs))
+	for _, dirInfo := range repo.Dirs {
+		rename(&dirInfo.Path)
+		for _, fileInfo := range dirInfo.Files {
+			rename(&fileInfo.Path)
+		}
+		dirs[dirInfo.Path] = dirInfo
+	}
+	repo.Dirs = dirs
+	for _, fileInfo := range repo.BelowMin {
+		rename(&fileInfo.Path)
+	}
+	for _, duplicate := range repo.Duplicates {
+		rename(&duplicate.Path)
+		rename(&duplicate.Original)
+	}
+	for _, fileErr := range repo.Errors {
+		rename(&fileErr.Path)
+	}
+	for _, symlink := range repo.SkippedSymlinks {
+		rename(&symlink.Path)
+	}
+	for _, sub := range repo.Submodules {
+		rename(&sub.Path)
+	}
+	for _, img := range repo.Images {
+		rename(&img.Path)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotRev(t *testing.T) {
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q")
+	writeTree(t, dir, map[string]string{"a.txt": "one two", "sub/b.txt": "three", "old/c.txt": "four", "run.sh": "#!/bin/sh\n"})
+	os.Chmod(filepath.Join(dir, "run.sh"), 0o755)
+	if err := os.Symlink("a.txt", filepath.Join(dir, "link.txt")); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", "first")
+	runGit(t, dir, "tag", "v1")
+	runGit(t, dir, "rm", "-q", "-r", "old")
+	writeTree(t, dir, map[string]string{"a.txt": "one two changed", "sub/new.txt": "new"})
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", "second")
+	writeTree(t, dir, map[string]string{"sub/b.txt": "uncommitted"})
+	t.Cleanup(runExitHooks)
+
+	tests := []struct {
+		name string
+		path string
+		rev  string
+		want []string
+	}{
+		{"root at a tag", dir, "v1", []string{"a.txt", "link.txt", "old/c.txt", "run.sh", "sub/b.txt"}},
+		{"root at HEAD", dir, "HEAD", []string{"a.txt", "link.txt", "run.sh", "sub/b.txt", "sub/new.txt"}},
+		{"subdirectory", filepath.Join(dir, "sub"), "v1", []string{"b.txt"}},
+		{"directory removed since", filepath.Join(dir, "old"), "v1", []string{"c.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := testOptions(t, "-model", "cl100k_base")
+			options.Path, options.Rev = tt.path, tt.rev
+			if err := snapshotRev(options); err != nil {
+				t.Fatal(err)
+			}
+			if options.Path == tt.path || !strings.Contains(options.Path, "@"+tt.rev) || options.RevCommit == "" {
+				t.Errorf("snapshot at %s, commit %q", options.Path, options.RevCommit)
+			}
+			repo, err := ProcessRepository(t.Context(), options.Path, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reportRevPaths(repo, options)
+			if repo.Path != tt.path {
+				t.Errorf("report names %s, want %s", repo.Path, tt.path)
+			}
+			if got := countedPaths(tt.path, repo); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("counted %v, want %v", got, tt.want)
+			}
+			for _, fileInfo := range repo.Dirs[tt.path].Files {
+				if filepath.Base(fileInfo.Path) == "b.txt" && fileInfo.TokenCount != 1 {
+					t.Errorf("b.txt has %d tokens, want the committed 1", fileInfo.TokenCount)
+				}
+			}
+		})
+	}
+
+	// Modes and symlinks are kept
+	options := testOptions(t)
+	options.Path, options.Rev = dir, "v1"
+	if err := snapshotRev(options); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(options.Path, "run.sh")); err != nil || runtime.GOOS != "windows" && info.Mode().Perm()&0o100 == 0 {
+		t.Errorf("run.sh in the snapshot: %v, %v", info, err)
+	}
+	if target, err := os.Readlink(filepath.Join(options.Path, "link.txt")); err != nil || target != "a.txt" {
+		t.Errorf("link.txt in the snapshot points to %q, %v", target, err)
+	}
+}
+
+func TestSnapshotRevErrors(t *testing.T) {
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q")
+	writeTree(t, dir, map[string]string{"a.txt": "one"})
+	runGit(t, dir, "add", "-A")
+	runGit(t, dir, "commit", "-q", "-m", "first")
+	t.Cleanup(runExitHooks)
+
+	tests := []struct {
+		name string
+		path string
+		rev  string
+		args []string
+		want string
+	}{
+		{"unknown revision", dir, "v9", nil, `unknown revision "v9"`},
+		{"missing path", filepath.Join(dir, "nope"), "HEAD", nil, "nope doesn't exist at HEAD"},
+		{"remote", "https://github.com/org/repo", "HEAD", nil, "-rev needs a local git repository"},
+		{"not a repository", t.TempDir(), "HEAD", nil, "not a git repository"},
+		{"by author", dir, "HEAD", []string{"-by-author"}, "-by-author can't be used with -rev"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := testOptions(t, tt.args...)
+			options.Path, options.Rev = tt.path, tt.rev
+			if err := snapshotRev(options); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("snapshotRev error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+)
+
+// ModelRoute assigns the files matching any of its gitignore-style patterns,
+// relative to the scan root, to the model that will read them
+type ModelRoute struct {
+	Paths []string `yaml:"paths"`
+	Model string   `yaml:"model"`
+}
+
+// loadModelRoutes reads the model_routes of the config file into the
+// options, unless they don't apply to this scan: with -models every file is
+// counted with every model, and words, chars and bytes don't depend on it
+func loadModelRoutes(options *CommandOptions) error {
+	if len(options.Models) > 0 || options.unitName() != "tokens" {
+		return nil
+	}
+	root := options.Path
+	if options.IsSingleFile {
+		root = filepath.Dir(root)
+	}
+	config, err := loadConfig(root, options.ConfigFile)
+	if err != nil {
+		return err
+	}
+	for i, route := range config.ModelRoutes {
+		if route.Model == "" || len(route.Paths) == 0 {
+			return fmt.Errorf("model route %d needs a model and at least one path", i+1)
+		}
+	}
+	options.routes = config.ModelRoutes
+	return nil
+}
+
+// routedCodec is the tokenizer of a model route and the matcher of its paths
+type routedCodec struct {
+	matcher *gitignore.GitIgnore
+	codec   namedCodec
+}
+
+// modelRouter picks the tokenizer of each file from the model routes. Files
+// no route matches are counted with the main one. A nil router counts every
+// file with the codecs it's given.
+type modelRouter struct {
+	routes   []routedCodec
+	fallback namedCodec
+}
+
+// newModelRouter loads the tokenizer of every model the routes name, once
+// each, or returns nil without routes
+func newModelRouter(options *CommandOptions, encs []namedCodec) (*modelRouter, error) {
+	if len(options.routes) == 0 {
+		return nil, nil
+	}
+	router := &modelRouter{fallback: namedCodec{options.modelName(), encs[0].Codec}}
+	loaded := map[string]namedCodec{router.fallback.Name: router.fallback}
+	for _, route := range options.routes {
+		enc, ok := loaded[route.Model]
+		if !ok {
+			codec, err := codecForName(route.Model)
+			if err != nil {
+				return nil, fmt.Errorf("error loading model %s: %v", route.Model, err)
+			}
+			enc = namedCodec{route.Model, codec}
+			loaded[route.Model] = enc
+		}
+		router.routes = append(router.routes, routedCodec{gitignore.CompileIgnoreLines(route.Paths...), enc})
+	}
+	return router, nil
+}
+
+// codecs returns the codecs to count the file at path with: those of the
+// first route matching its path relative to rootPath, or encs
+func (r *modelRouter) codecs(rootPath string, path string, encs []namedCodec) []namedCodec {
+	if r == nil {
+		return encs
+	}
+	rel, err := filepath.Rel(rootPath, path)
+	if err != nil {
+		return []namedCodec{r.fallback}
+	}
+	rel = filepath.ToSlash(rel)
+	for _, route := range r.routes {
+		if route.matcher.MatchesPath(rel) {
+			return []namedCodec{route.codec}
+		}
+	}
+	return []namedCodec{r.fallback}
+}
+
+// all returns every codec the router counts with, the main one first
+func (r *modelRouter) all(encs []namedCodec) []namedCodec {
+	if r == nil {
+		return encs
+	}
+	all := []namedCodec{r.fallback}
+	for _, route := range r.routes {
+		all = append(all, route.codec)
+	}
+	return all
+}
+
+// countFile counts a file with the model its route assigns it, recording the
+// count under that model's name so directories and the repository add up
+// per-model subtotals
+func (r *modelRouter) countFile(rootPath string, path string, encs []namedCodec, options *CommandOptions) (*FileTokenInfo, error) {
+	encs = r.codecs(rootPath, path, encs)
+	fileInfo, err := countFile(path, encs, options)
+	if err != nil || r == nil {
+		return fileInfo, err
+	}
+	r.record(fileInfo, encs[0].Name)
+	return fileInfo, nil
+}
+
+// record marks a file as counted with model
+func (r *modelRouter) record(fileInfo *FileTokenInfo, model string) {
+	if r == nil {
+		return
+	}
+	fileInfo.Model = model
+	fileInfo.ModelCounts = map[string]int{model: fileInfo.TokenCount}
+}
+
+// printModelRoutes prints the subtotal and file count of each model the
+// model routes counted with
+func printModelRoutes(repo *RepoTokenInfo, options *CommandOptions) {
+	files := make(map[string]int)
+	for _, dirInfo := range repo.Dirs {
+		for _, fileInfo := range dirInfo.Files {
+			files[fileInfo.Model]++
+		}
+	}
+	if !options.FilterAffectsTotals {
+		for _, fileInfo := range repo.BelowMin {
+			files[fileInfo.Model]++
+		}
+	}
+	models := sortedKeys(repo.ModelCounts)
+	sort.SliceStable(models, func(i, j int) bool {
+		return repo.ModelCounts[models[i]] > repo.ModelCounts[models[j]]
+	})
+
+	fmt.Println(options.paint(ansiBold, "Totals by model:"))
+	fmt.Println("----------------")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, model := range models {
+		label := model
+		if model == options.modelName() {
+			label += " (default)"
+		}
+		fmt.Fprintf(w, "%s\t%s %s\t%.1f%%\t%d files\t\n", label, formatCount(repo.ModelCounts[model]), options.unitName(),
+			percentOf(repo.ModelCounts[model], repo.TokenCount), files[model])
+	}
+	w.Flush()
+	fmt.Println()
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadModelRoutes(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		".token-counter.yaml": "model_routes:\n  - paths: [docs/**]\n    model: o200k_base\n",
+		"bad.yaml":            "model_routes:\n  - paths: [docs/**]\n",
+		"docs/a.md":           "hello",
+	})
+	tests := []struct {
+		name    string
+		args    []string
+		mode    string
+		routes  int
+		wantErr string
+	}{
+		{"routes", nil, "", 1, ""},
+		// The config file is read from the file's directory, which has none
+		{"single file", []string{"-path", filepath.Join(dir, "docs", "a.md")}, "", 0, ""},
+		{"models", []string{"-models", "cl100k_base,o200k_base"}, "", 0, ""},
+		{"words", nil, "words", 0, ""},
+		{"without a model", []string{"-config", filepath.Join(dir, "bad.yaml")}, "", 0, "model route 1 needs a model and at least one path"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := testOptions(t, tt.args...)
+			options.CountMode = tt.mode
+			if options.Path == "" {
+				options.Path = dir
+			} else {
+				options.IsSingleFile = true
+			}
+			err := loadModelRoutes(options)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("loadModelRoutes error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(options.routes) != tt.routes {
+				t.Errorf("routes %v, want %d", options.routes, tt.routes)
+			}
+		})
+	}
+}
+
+func TestModelRoutes(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"docs/a.md": "hello world", "src/b.go": "one two three", "src/c.go": "four"})
+	tests := []struct {
+		name    string
+		routes  []ModelRoute
+		models  map[string]string // Model of each file
+		totals  map[string]int
+		wantErr string
+	}{
+		{"routed", []ModelRoute{{Paths: []string{"docs/**"}, Model: "o200k_base"}},
+			map[string]string{"docs/a.md": "o200k_base", "src/b.go": "cl100k_base", "src/c.go": "cl100k_base"},
+			map[string]int{"o200k_base": 2, "cl100k_base": 4}, ""},
+		{"first match wins", []ModelRoute{{Paths: []string{"src/b.go"}, Model: "o200k_base"}, {Paths: []string{"src/"}, Model: "p50k_base"}},
+			map[string]string{"docs/a.md": "cl100k_base", "src/b.go": "o200k_base", "src/c.go": "p50k_base"},
+			map[string]int{"o200k_base": 3, "cl100k_base": 2, "p50k_base": 1}, ""},
+		{"unknown model", []ModelRoute{{Paths: []string{"docs/**"}, Model: "nope"}}, nil, nil, "error loading model nope"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := testOptions(t, "-model", "cl100k_base")
+			options.Path = dir
+			options.routes = tt.routes
+			repo, err := ProcessRepository(context.Background(), dir, options)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("ProcessRepository error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, dirInfo := range repo.Dirs {
+				for _, fileInfo := range dirInfo.Files {
+					rel := relativeTo(dir, fileInfo.Path)
+					if fileInfo.Model != tt.models[rel] || fileInfo.ModelCounts[fileInfo.Model] != fileInfo.TokenCount {
+						t.Errorf("%s counted with %s (%v), want %s", rel, fileInfo.Model, fileInfo.ModelCounts, tt.models[rel])
+					}
+				}
+			}
+			for model, want := range tt.totals {
+				if repo.ModelCounts[model] != want {
+					t.Errorf("%s subtotal %d, want %d", model, repo.ModelCounts[model], want)
+				}
+			}
+			if repo.TokenCount != 6 {
+				t.Errorf("total %d, want the subtotals' 6", repo.TokenCount)
+			}
+
+			out := captureStdout(t, func() { printModelRoutes(repo, options) })
+			if !strings.Contains(out, "Totals by model:") || !strings.Contains(out, "cl100k_base (default)") {
+				t.Errorf("printModelRoutes printed:\n%s", out)
+			}
+		})
+	}
+}
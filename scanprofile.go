@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// profileSlowest is how many of the slowest files -profile-scan lists
+const profileSlowest = 5
+
+// Phases of counting a file that -profile-scan times
+const (
+	phaseRead = iota
+	phaseDecode
+	phaseTokenize
+	phaseCount // Not a phase: the number of them
+)
+
+// scanProfile records where a scan spends its time for -profile-scan: the
+// walk, reading, decoding and tokenizing each file, and aggregating the
+// report, with the tokenizing speed of each extension, the slowest files,
+// and how busy each walk worker was listing directories. Counting is timed
+// on the walk's goroutine, and the walk is the rest of the time it takes. A
+// nil *scanProfile records nothing.
+type scanProfile struct {
+	mu         sync.Mutex
+	start      time.Time
+	walked     time.Duration // Of the walk, counting included
+	counting   time.Duration // Of counting files, as the walk waits for it
+	aggregated time.Time     // When the report started to be aggregated
+	phases     [phaseCount]time.Duration
+	extensions map[string]*extensionProfile
+	slowest    []*fileProfile
+	workers    []*workerProfile // By walk worker
+}
+
+// extensionProfile is the tokenizing of the files with one extension
+type extensionProfile struct {
+	files    int
+	bytes    int64
+	tokens   int64
+	tokenize time.Duration
+}
+
+// fileProfile is the time counting one file took
+type fileProfile struct {
+	path   string
+	tokens int
+	phases [phaseCount]time.Duration
+}
+
+// workerProfile is what a walk worker listed
+type workerProfile struct {
+	dirs int
+	busy time.Duration
+}
+
+// newScanProfile starts the profile of a scan
+func newScanProfile() *scanProfile {
+	return &scanProfile{
+		start:      time.Now(),
+		extensions: make(map[string]*extensionProfile),
+	}
+}
+
+// countingSince adds the time the walk waited for files to be counted since
+// start
+func (p *scanProfile) countingSince(start time.Time) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.counting += time.Since(start)
+	p.mu.Unlock()
+}
+
+// walkedSince records the time the walk took, from start
+func (p *scanProfile) walkedSince(start time.Time) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.walked += time.Since(start)
+	p.mu.Unlock()
+}
+
+// listed records that a walk worker listed a directory in elapsed
+func (p *scanProfile) listed(worker int, elapsed time.Duration) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.workers) <= worker {
+		p.workers = append(p.workers, &workerProfile{})
+	}
+	w := p.workers[worker]
+	w.dirs++
+	w.busy += elapsed
+}
+
+// startFile starts timing the phases of counting a file
+func (p *scanProfile) startFile(path string) *fileProfile {
+	if p == nil {
+		return nil
+	}
+	return &fileProfile{path: path}
+}
+
+// since adds the time since start to a phase of the file
+func (f *fileProfile) since(phase int, start time.Time) {
+	if f != nil {
+		f.phases[phase] += time.Since(start)
+	}
+}
+
+// endFile adds a counted file of bytes to the profile
+func (p *scanProfile) endFile(f *fileProfile, bytes int, tokens int) {
+	if p == nil || f == nil {
+		return
+	}
+	f.tokens = tokens
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for phase, elapsed := range f.phases {
+		p.phases[phase] += elapsed
+	}
+	ext := strings.ToLower(filepath.Ext(f.path))
+	e := p.extensions[ext]
+	if e == nil {
+		e = &extensionProfile{}
+		p.extensions[ext] = e
+	}
+	e.files++
+	e.bytes += int64(bytes)
+	e.tokens += int64(tokens)
+	e.tokenize += f.phases[phaseTokenize]
+
+	// Keep the slowest files, slowest first
+	p.slowest = append(p.slowest, f)
+	sort.SliceStable(p.slowest, func(i, j int) bool { return p.slowest[i].total() > p.slowest[j].total() })
+	if len(p.slowest) > profileSlowest {
+		p.slowest = p.slowest[:profileSlowest]
+	}
+}
+
+// total is the time counting the file took
+func (f *fileProfile) total() time.Duration {
+	var total time.Duration
+	for _, elapsed := range f.phases {
+		total += elapsed
+	}
+	return total
+}
+
+// startAggregate records that the report started to be aggregated
+func (p *scanProfile) startAggregate() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.aggregated = time.Now()
+	p.mu.Unlock()
+}
+
+// print writes the profile to w, with paths relative to root
+func (p *scanProfile) print(w io.Writer, root string, options *CommandOptions) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	end := time.Now()
+	total := end.Sub(p.start)
+	var aggregate time.Duration
+	if !p.aggregated.IsZero() {
+		aggregate = end.Sub(p.aggregated)
+	}
+	// The rest is what counting took apart from the timed phases, like
+	// hashing the files, and what the scan took outside of the walk, like
+	// reading -files-from
+	walk := max(p.walked-p.counting, 0)
+	other := total - walk - aggregate
+	for _, elapsed := range p.phases {
+		other -= elapsed
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, options.paint(ansiBold, "Scan profile:"))
+	fmt.Fprintln(w, "-------------")
+	fmt.Fprintln(tw, "PHASE\tTIME\tSHARE\t")
+	for _, phase := range []struct {
+		name    string
+		elapsed time.Duration
+	}{
+		{"walk (listing, filtering, sniffing)", walk},
+		{"read", p.phases[phaseRead]},
+		{"decode", p.phases[phaseDecode]},
+		{"tokenize", p.phases[phaseTokenize]},
+		{"aggregate (report)", aggregate},
+		{"other", max(other, 0)},
+	} {
+		fmt.Fprintf(tw, "%s\t%s\t%.1f%%\t\n", phase.name, roundDuration(phase.elapsed), percentOf(int(phase.elapsed), int(total)))
+	}
+	fmt.Fprintf(tw, "total\t%s\t\t\n", roundDuration(total))
+	tw.Flush()
+
+	if len(p.extensions) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, options.paint(ansiBold, "Tokenizing speed by extension:"))
+		exts := sortedKeys(p.extensions)
+		sort.SliceStable(exts, func(i, j int) bool { return p.extensions[exts[i]].tokenize > p.extensions[exts[j]].tokenize })
+		fmt.Fprintf(tw, "EXTENSION\tFILES\tMB\t%s\tTIME\t%s/S\tMB/S\t\n", strings.ToUpper(options.unitName()), strings.ToUpper(options.unitName()))
+		for _, ext := range exts {
+			e := p.extensions[ext]
+			name := ext
+			if name == "" {
+				name = "(none)"
+			}
+			seconds := e.tokenize.Seconds()
+			var perSecond, mbPerSecond float64
+			if seconds > 0 {
+				perSecond, mbPerSecond = float64(e.tokens)/seconds, float64(e.bytes)/(1<<20)/seconds
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%.2f\t%s\t%s\t%s\t%.2f\t\n", name, formatCount(e.files), float64(e.bytes)/(1<<20),
+				formatCount(int(e.tokens)), roundDuration(e.tokenize), formatCount(int(perSecond)), mbPerSecond)
+		}
+		tw.Flush()
+	}
+
+	if len(p.slowest) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, options.paint(ansiBold, "Slowest files to count:"))
+		for _, f := range p.slowest {
+			fmt.Fprintf(w, "  %s: %s (read %s, decode %s, tokenize %s), %s %s\n", relativeTo(root, f.path), roundDuration(f.total()),
+				roundDuration(f.phases[phaseRead]), roundDuration(f.phases[phaseDecode]), roundDuration(f.phases[phaseTokenize]),
+				formatCount(f.tokens), options.unitName())
+		}
+	}
+
+	if len(p.workers) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, options.paint(ansiBold, "Walk workers:"))
+		fmt.Fprintln(tw, "WORKER\tDIRECTORIES\tBUSY\t")
+		for i, worker := range p.workers {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t\n", i+1, formatCount(worker.dirs), roundDuration(worker.busy))
+		}
+		tw.Flush()
+	}
+}
+
+// roundDuration rounds a duration for display, to a precision that suits it
+func roundDuration(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	}
+	return d.Round(time.Microsecond)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScanProfile(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world", "src/b.go": "one two three", "src/c.go": "four"})
+	options := testOptions(t, "-model", "cl100k_base", "-walk-workers", "2")
+	options.profile = newScanProfile()
+	_, err := ProcessRepository(t.Context(), dir, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := options.profile
+	if p.extensions[".go"].files != 2 || p.extensions[".go"].tokens != 4 || p.extensions[".txt"].files != 1 {
+		t.Errorf("extension profiles .go %+v, .txt %+v", p.extensions[".go"], p.extensions[".txt"])
+	}
+	if len(p.slowest) != 3 || p.slowest[0].total() < p.slowest[2].total() {
+		t.Errorf("slowest files %+v, want all 3, slowest first", p.slowest)
+	}
+	dirs := 0
+	for _, worker := range p.workers {
+		dirs += worker.dirs
+	}
+	if dirs != 2 {
+		t.Errorf("walk workers listed %d directories, want 2", dirs)
+	}
+
+	var out bytes.Buffer
+	p.startAggregate()
+	p.print(&out, dir, options)
+	for _, want := range []string{"Scan profile:", "walk (listing, filtering, sniffing)", "\ntotal ", "Tokenizing speed by extension:", "EXTENSION  FILES  MB    TOKENS", "\n.go ", "Slowest files to count:", "  src/b.go: ", "tokenize", "), 3 tokens\n", "Walk workers:"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("profile printed\n%s\nwant %q", out.String(), want)
+		}
+	}
+}
+
+func TestNilScanProfile(t *testing.T) {
+	var p *scanProfile
+	f := p.startFile("a.txt")
+	f.since(phaseRead, time.Now())
+	p.endFile(f, 10, 2)
+	p.listed(0, time.Second)
+	p.countingSince(time.Now())
+	p.walkedSince(time.Now())
+	p.startAggregate()
+	var out bytes.Buffer
+	p.print(&out, ".", &CommandOptions{})
+	if out.Len() != 0 {
+		t.Errorf("nil profile printed %q", out.String())
+	}
+}
+
+func TestRoundDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want time.Duration
+	}{
+		{1234567891, 1235 * time.Millisecond},
+		{1234567, 1230 * time.Microsecond},
+		{1234, time.Microsecond},
+	}
+	for _, tt := range tests {
+		if got := roundDuration(tt.d); got != tt.want {
+			t.Errorf("roundDuration(%v) = %v, want %v", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestProfileScanCommand(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world"})
+	var out string
+	stderr := captureStderr(t, func() {
+		out = captureStdout(t, func() { findCommand("scan").run([]string{"-profile-scan", "-quiet", "-model", "cl100k_base", dir}) })
+	})
+	if out != "2\n" || !strings.Contains(stderr, "Scan profile:") || !strings.Contains(stderr, "  a.txt: ") {
+		t.Errorf("scan -profile-scan printed %q, stderr:\n%s", out, stderr)
+	}
+}
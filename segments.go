@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// segment is a part of a composite file counted on its own with -segments,
+// such as a fenced code block of a Markdown file
+type segment struct {
+	Name string // prose, code, markup, script or style
+	Text string
+}
+
+// segmenters split composite files into their segments, by lowercase file
+// extension
+var segmenters = map[string]func(text string) []segment{
+	".md":       markdownSegments,
+	".markdown": markdownSegments,
+	".mdx":      markdownSegments,
+	".html":     markupSegments,
+	".htm":      markupSegments,
+	".vue":      markupSegments,
+	".svelte":   markupSegments,
+}
+
+// countSegments counts each segment of a composite file and totals them by
+// name, or returns nil for a file that isn't one. Segments are counted
+// separately, so their sum can be off from the file's count by a few tokens
+// where they meet.
+func countSegments(path string, text string, enc namedCodec, mode string) (map[string]int, error) {
+	split := segmenters[strings.ToLower(filepath.Ext(path))]
+	if split == nil {
+		return nil, nil
+	}
+	counts := make(map[string]int)
+	for _, seg := range split(text) {
+		n, err := countUnits(seg.Text, enc, mode)
+		if err != nil {
+			return nil, err
+		}
+		counts[seg.Name] += n
+	}
+	return counts, nil
+}
+
+// appendSegment adds text to the segments, merged with the last one if it
+// has the same name
+func appendSegment(segments []segment, name string, text string) []segment {
+	if text == "" {
+		return segments
+	}
+	if n := len(segments); n > 0 && segments[n-1].Name == name {
+		segments[n-1].Text += text
+		return segments
+	}
+	return append(segments, segment{name, text})
+}
+
+// markdownSegments splits Markdown into prose and fenced code blocks, fences
+// included. A block that's never closed runs to the end of the file, as in
+// CommonMark.
+func markdownSegments(text string) []segment {
+	var segments []segment
+	var fence string // Opening fence of the code block we're in, if any
+	for _, line := range strings.SplitAfter(text, "\n") {
+		marker := markdownFence(line)
+		switch {
+		case fence == "" && marker != "":
+			fence = marker
+			segments = appendSegment(segments, "code", line)
+		case fence != "":
+			// A closing fence is at least as long as the opening one, with
+			// the same character and nothing after it
+			if strings.HasPrefix(marker, fence) && strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(line), fence[:1])) == "" {
+				fence = ""
+			}
+			segments = appendSegment(segments, "code", line)
+		default:
+			segments = appendSegment(segments, "prose", line)
+		}
+	}
+	return segments
+}
+
+// markdownFence returns the fence a line opens or closes a code block with,
+// three or more backticks or tildes indented by at most three spaces, or ""
+func markdownFence(line string) string {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || len(trimmed) < 3 || (trimmed[0] != '`' && trimmed[0] != '~') {
+		return ""
+	}
+	n := 0
+	for n < len(trimmed) && trimmed[n] == trimmed[0] {
+		n++
+	}
+	if n < 3 || (trimmed[0] == '`' && strings.Contains(trimmed[n:], "`")) {
+		return ""
+	}
+	return trimmed[:n]
+}
+
+// markupElement and markupClose find the script and style elements of HTML
+// and single-file components
+var (
+	markupElement = regexp.MustCompile(`(?i)<(script|style)\b[^>]*>`)
+	markupClose   = map[string]*regexp.Regexp{
+		"script": regexp.MustCompile(`(?i)</script\s*>`),
+		"style":  regexp.MustCompile(`(?i)</style\s*>`),
+	}
+)
+
+// markupSegments splits HTML, Vue and Svelte components into the contents of
+// their script and style elements, and the markup around them, tags
+// included: a Vue template, a Svelte component's markup or an HTML page
+func markupSegments(text string) []segment {
+	var segments []segment
+	for text != "" {
+		open := markupElement.FindStringSubmatchIndex(text)
+		if open == nil {
+			break
+		}
+		name := strings.ToLower(text[open[2]:open[3]])
+		segments = appendSegment(segments, "markup", text[:open[1]])
+		text = text[open[1]:]
+		end := len(text)
+		if close := markupClose[name].FindStringIndex(text); close != nil {
+			end = close[0]
+		}
+		segments = appendSegment(segments, name, text[:end])
+		text = text[end:]
+	}
+	return appendSegment(segments, "markup", text)
+}
+
+// segmentSummary describes the segments of a file, e.g. "prose 1,204, code
+// 310", largest first
+func segmentSummary(counts map[string]int) string {
+	names := sortedKeys(counts)
+	sort.SliceStable(names, func(i, j int) bool { return counts[names[i]] > counts[names[j]] })
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + " " + formatCount(counts[name])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// printSegments prints the total of each segment across the composite files
+// of a scan, and how many files have it
+func printSegments(repo *RepoTokenInfo, options *CommandOptions) {
+	if len(repo.SegmentCounts) == 0 {
+		return
+	}
+	files := make(map[string]int)
+	total := 0
+	for _, dirInfo := range repo.Dirs {
+		for _, fileInfo := range dirInfo.Files {
+			for name := range fileInfo.Segments {
+				files[name]++
+			}
+		}
+	}
+	for _, count := range repo.SegmentCounts {
+		total += count
+	}
+	names := sortedKeys(repo.SegmentCounts)
+	sort.SliceStable(names, func(i, j int) bool {
+		return repo.SegmentCounts[names[i]] > repo.SegmentCounts[names[j]]
+	})
+
+	fmt.Println(options.paint(ansiBold, "Totals by segment:"))
+	fmt.Println("------------------")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s\t%s %s\t%.1f%%\t%d files\t\n", name, formatCount(repo.SegmentCounts[name]), options.unitName(),
+			percentOf(repo.SegmentCounts[name], total), files[name])
+	}
+	w.Flush()
+	fmt.Println()
+}
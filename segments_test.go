@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMarkdownSegments(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []segment
+	}{
+		{"prose", "# Title\n\nSome text.\n", []segment{{"prose", "# Title\n\nSome text.\n"}}},
+		{"fenced code", "Run:\n```sh\nmake\n```\nDone.\n", []segment{{"prose", "Run:\n"}, {"code", "```sh\nmake\n```\n"}, {"prose", "Done.\n"}}},
+		{"longer closing fence", "~~~\na\n~~~~\nb", []segment{{"code", "~~~\na\n~~~~\n"}, {"prose", "b"}}},
+		{"other fence inside", "````\n```\nx\n```\n````\n", []segment{{"code", "````\n```\nx\n```\n````\n"}}},
+		{"unclosed", "a\n```\nb\n", []segment{{"prose", "a\n"}, {"code", "```\nb\n"}}},
+		{"indented four spaces", "    ```\nx\n", []segment{{"prose", "    ```\nx\n"}}},
+		{"inline backticks", "``` a ` b\nx\n", []segment{{"prose", "``` a ` b\nx\n"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markdownSegments(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("markdownSegments = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarkupSegments(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []segment
+	}{
+		{"vue", "<template><p>hi</p></template>\n<script setup>\nlet a = 1\n</script>\n<style scoped>p { color: red }</style>\n",
+			[]segment{{"markup", "<template><p>hi</p></template>\n<script setup>"}, {"script", "\nlet a = 1\n"}, {"markup", "</script>\n<style scoped>"}, {"style", "p { color: red }"}, {"markup", "</style>\n"}}},
+		{"upper case", "<SCRIPT>x</Script >", []segment{{"markup", "<SCRIPT>"}, {"script", "x"}, {"markup", "</Script >"}}},
+		{"unclosed", "<p>a</p><style>b", []segment{{"markup", "<p>a</p><style>"}, {"style", "b"}}},
+		{"empty element", "<script src=a.js></script>", []segment{{"markup", "<script src=a.js></script>"}}},
+		{"markup only", "<p>hi</p>", []segment{{"markup", "<p>hi</p>"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markupSegments(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("markupSegments = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// failingTokenizer fails every count
+type failingTokenizer struct{}
+
+func (failingTokenizer) Count(string) (int, error) { return 0, errors.New("counting failed") }
+func (failingTokenizer) Name() string              { return "failing" }
+
+func TestCountSegments(t *testing.T) {
+	tests := []struct {
+		path string
+		text string
+		want map[string]int
+	}{
+		{"README.MD", "one two\n```\nthree\n```\n", map[string]int{"prose": 2, "code": 3}},
+		{"page.html", "<p>one</p><script>two three</script>", map[string]int{"markup": 2, "script": 2}},
+		{"main.go", "package main", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := countSegments(tt.path, tt.text, namedCodec{}, "words")
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("countSegments = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+	if _, err := countSegments("a.md", "text", namedCodec{"failing", failingTokenizer{}}, "tokens"); err == nil {
+		t.Error("countSegments with a failing tokenizer succeeded")
+	}
+	if got := segmentSummary(map[string]int{"code": 310, "prose": 1204}); got != "prose 1,204, code 310" {
+		t.Errorf("segmentSummary = %q", got)
+	}
+}
+
+func TestScanSegments(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.md": "one two\n```\nthree\n```\n", "b.md": "four", "c.txt": "five"})
+	repo, options := scanTree(t, dir, "-segments", "-count-mode", "words")
+	if want := map[string]int{"prose": 3, "code": 3}; !reflect.DeepEqual(repo.SegmentCounts, want) {
+		t.Errorf("segment totals %v, want %v", repo.SegmentCounts, want)
+	}
+	out := captureStdout(t, func() { printSegments(repo, options) })
+	for _, want := range []string{"Totals by segment:", "prose  3 words  50.0%  2 files", "code   3 words  50.0%  1 files"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("printSegments is missing %q:\n%s", want, out)
+		}
+	}
+
+	repo, options = scanTree(t, dir, "-count-mode", "words")
+	if repo.SegmentCounts != nil || captureStdout(t, func() { printSegments(repo, options) }) != "" {
+		t.Errorf("a scan without -segments has segments %v", repo.SegmentCounts)
+	}
+}
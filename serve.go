@@ -0,0 +1,373 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "token-counter/api/tokencounter/v1"
+)
+
+// tokenCounterServer implements the TokenCounter gRPC service defined in
+// api/tokencounter/v1/token_counter.proto
+type tokenCounterServer struct {
+	pb.UnimplementedTokenCounterServer
+
+	options *CommandOptions // Server defaults; Path is the root ScanRepo is confined to
+	root    string
+	metrics *serverMetrics
+
+	mu     sync.Mutex
+	codecs map[string]namedCodec
+}
+
+// serveCommand defines the serve subcommand, which serves the counting engine
+// over gRPC until the process is stopped
+func serveCommand(fs *flag.FlagSet) func() {
+	options := &CommandOptions{}
+	var addr, metricsAddr string
+	var metricsRepos []string
+	var metricsInterval time.Duration
+
+	registerFlags(fs, options)
+	registerWalkFlags(fs, options)
+	fs.StringVar(&addr, "addr", "localhost:50051", "Address to listen on; the service has no authentication, so a non-loopback address, like :50051, lets anyone who can reach it read the files under the scan root")
+	fs.StringVar(&metricsAddr, "metrics-addr", "", "Address to serve Prometheus metrics on at /metrics, and badges of the -metrics-repos at /badge/<repo>.svg and .json, e.g. :9090 (disabled if empty)")
+	fs.Func("metrics-repos", "Comma-separated directories under the scan root to rescan for the per-language token gauges of /metrics", func(value string) error {
+		metricsRepos = splitList(value)
+		return nil
+	})
+	fs.DurationVar(&metricsInterval, "metrics-interval", 5*time.Minute, "How often to rescan the -metrics-repos directories")
+	return func() {
+		if err := resolveTarget(fs, options); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+		if options.IsSingleFile {
+			fmt.Fprintln(os.Stderr, "Error: serve needs a directory to use as the scan root")
+			exit(1)
+		}
+
+		root, err := filepath.Abs(options.Path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		server := &tokenCounterServer{options: options, root: root, metrics: newServerMetrics(), codecs: make(map[string]namedCodec)}
+		// Load the default tokenizer up front so a bad -model fails at startup
+		if _, err := server.codec(""); err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading tokenizer: %v\n", err)
+			exit(1)
+		}
+
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+
+		if metricsAddr != "" {
+			if metricsInterval <= 0 {
+				fmt.Fprintln(os.Stderr, "Error: -metrics-interval must be positive")
+				exit(1)
+			}
+			metricsListener, err := net.Listen("tcp", metricsAddr)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				exit(1)
+			}
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", server.metrics)
+			mux.HandleFunc("GET /badge/{repo...}", server.serveBadge)
+			go func() {
+				if err := http.Serve(metricsListener, mux); err != nil {
+					logger.Error("metrics server stopped", "err", err)
+				}
+			}()
+			go server.watchRepos(metricsRepos, metricsInterval)
+			logger.Info("serving metrics", "addr", metricsListener.Addr().String(), "repos", len(metricsRepos))
+		} else if len(metricsRepos) > 0 {
+			fmt.Fprintln(os.Stderr, "Error: -metrics-repos needs -metrics-addr")
+			exit(1)
+		}
+
+		grpcServer := grpc.NewServer()
+		pb.RegisterTokenCounterServer(grpcServer, server)
+
+		logger.Info("serving gRPC", "addr", listener.Addr().String(), "root", root)
+		if err := grpcServer.Serve(listener); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			exit(1)
+		}
+	}
+}
+
+// codec returns the tokenizer for a requested model, loading it on first use.
+// An empty model selects the server's -model or -tokenizer-file. Clients may
+// only name tiktoken encodings, not tokenizer files on the server.
+func (s *tokenCounterServer) codec(model string) (namedCodec, error) {
+	if strings.HasSuffix(model, ".json") {
+		return namedCodec{}, status.Errorf(codes.InvalidArgument, "unknown model %q", model)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if enc, ok := s.codecs[model]; ok {
+		return enc, nil
+	}
+
+	var enc namedCodec
+	if model == "" {
+		codec, err := newCodec(s.options)
+		if err != nil {
+			return namedCodec{}, err
+		}
+		enc = namedCodec{s.options.Model, codec}
+	} else {
+		codec, err := codecForName(model)
+		if err != nil {
+			return namedCodec{}, status.Errorf(codes.InvalidArgument, "unknown model %q", model)
+		}
+		enc = namedCodec{model, codec}
+	}
+	s.codecs[model] = enc
+	return enc, nil
+}
+
+// count answers a single CountRequest
+func (s *tokenCounterServer) count(req *pb.CountRequest) (*pb.CountResponse, error) {
+	enc, err := s.codec(req.GetModel())
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := countUnits(req.GetText(), enc, s.options.CountMode)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "counting failed: %v", err)
+	}
+	return &pb.CountResponse{Id: req.GetId(), Model: enc.Name, Tokens: int64(tokens)}, nil
+}
+
+// Count counts the tokens in a single piece of text
+func (s *tokenCounterServer) Count(ctx context.Context, req *pb.CountRequest) (*pb.CountResponse, error) {
+	resp, err := s.count(req)
+	if err == nil {
+		s.metrics.request("Count", int(resp.Tokens))
+	}
+	return resp, err
+}
+
+// CountStream answers every request on the stream in order
+func (s *tokenCounterServer) CountStream(stream grpc.BidiStreamingServer[pb.CountRequest, pb.CountResponse]) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		resp, err := s.count(req)
+		if err != nil {
+			return err
+		}
+		s.metrics.request("CountStream", int(resp.Tokens))
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// ScanRepo scans a directory under the scan root, sending a progress message
+// per counted file followed by the full result
+func (s *tokenCounterServer) ScanRepo(req *pb.ScanRepoRequest, stream grpc.ServerStreamingServer[pb.ScanRepoResponse]) error {
+	path, err := s.confine(req.GetPath())
+	if errors.Is(err, errOutsideRoot) {
+		return status.Errorf(codes.PermissionDenied, "%s is outside the scan root", req.GetPath())
+	}
+	if err != nil {
+		return status.Errorf(codes.NotFound, "%s: no such directory", req.GetPath())
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return status.Errorf(codes.NotFound, "%s: no such directory", req.GetPath())
+	}
+	if !info.IsDir() {
+		return status.Errorf(codes.InvalidArgument, "%s is not a directory", req.GetPath())
+	}
+
+	options := *s.options
+	options.Path = path
+	options.IsSingleFile = false
+	options.Models = nil
+	options.RespectGitignore = req.RespectGitignore == nil || req.GetRespectGitignore()
+	options.IgnoreHidden = !req.GetIncludeHidden()
+	options.MinTokens = int(req.GetMinTokens())
+	if model := req.GetModel(); model != "" {
+		// Validate the model before scanning, and use the status error for it
+		if _, err := s.codec(model); err != nil {
+			return err
+		}
+		options.Model = model
+		options.TokenizerFile, options.BPEVocab, options.BPEEncoder = "", "", ""
+	}
+
+	var filesScanned, tokensSoFar int64
+	options.OnFile = func(fileInfo *FileTokenInfo) error {
+		if err := stream.Context().Err(); err != nil {
+			return err
+		}
+		s.metrics.file(fileInfo)
+		filesScanned++
+		tokensSoFar += int64(fileInfo.TokenCount)
+		return stream.Send(&pb.ScanRepoResponse{Event: &pb.ScanRepoResponse_Progress{Progress: &pb.ScanProgress{
+			File:         s.fileCount(fileInfo),
+			FilesScanned: filesScanned,
+			TokensSoFar:  tokensSoFar,
+		}}})
+	}
+
+	ctx, cancel := withTimeout(stream.Context(), &options)
+	defer cancel()
+	start := time.Now()
+	repo, err := ProcessRepository(ctx, path, &options)
+	s.metrics.scan(time.Since(start))
+	s.metrics.request("ScanRepo", 0)
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return status.Errorf(codes.DeadlineExceeded, "scan timed out after %s", options.Timeout)
+		}
+		if errors.Is(err, context.Canceled) {
+			return status.Error(codes.Canceled, "scan canceled")
+		}
+		return status.Errorf(codes.Internal, "scan failed: %v", err)
+	}
+
+	return stream.Send(&pb.ScanRepoResponse{Event: &pb.ScanRepoResponse_Result{Result: s.scanResult(repo)}})
+}
+
+// watchRepos scans each of repos every interval, starting now, to update
+// their per-language gauges. The paths are relative to the scan root.
+func (s *tokenCounterServer) watchRepos(repos []string, interval time.Duration) {
+	if len(repos) == 0 {
+		return
+	}
+	for {
+		for _, name := range repos {
+			path, err := s.confine(name)
+			if err != nil {
+				logger.Warn("metrics scan failed", "repo", name, "err", err)
+				continue
+			}
+			options := *s.options
+			options.Path = path
+			options.IsSingleFile = false
+			options.Models = nil
+			options.OnFile = func(fileInfo *FileTokenInfo) error {
+				s.metrics.file(fileInfo)
+				return nil
+			}
+
+			ctx, cancel := withTimeout(context.Background(), &options)
+			start := time.Now()
+			repo, err := ProcessRepository(ctx, options.Path, &options)
+			cancel()
+			s.metrics.scan(time.Since(start))
+			if err != nil {
+				logger.Warn("metrics scan failed", "repo", name, "err", err)
+				continue
+			}
+			s.metrics.setRepo(name, repo)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// errOutsideRoot is the error of confine for a path that leads out of the
+// scan root
+var errOutsideRoot = errors.New("outside the scan root")
+
+// confine returns the path under the scan root that a client's path names.
+// The path is cleaned as if it were absolute, so ".." can't climb out of the
+// root, and then resolved through its symlinks, since a scan follows a
+// symlinked root, so a link inside the root can't lead out of it either.
+func (s *tokenCounterServer) confine(name string) (string, error) {
+	path := filepath.Join(s.root, filepath.Clean("/"+name))
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	root, err := filepath.EvalSymlinks(s.root)
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(root, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s: %w", name, errOutsideRoot)
+	}
+	return path, nil
+}
+
+// relPath returns path relative to the scan root, as clients see it
+func (s *tokenCounterServer) relPath(path string) string {
+	if rel, err := filepath.Rel(s.root, path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// fileCount converts a counted file to its protobuf message
+func (s *tokenCounterServer) fileCount(fileInfo *FileTokenInfo) *pb.FileCount {
+	return &pb.FileCount{
+		Path:   s.relPath(fileInfo.Path),
+		Tokens: int64(fileInfo.TokenCount),
+		Bytes:  int64(fileInfo.Bytes),
+		Lines:  int64(fileInfo.Lines),
+	}
+}
+
+// scanResult converts a finished scan to its protobuf message, with
+// directories and files sorted by path so results are stable
+func (s *tokenCounterServer) scanResult(repo *RepoTokenInfo) *pb.ScanResult {
+	result := &pb.ScanResult{
+		Path:        s.relPath(repo.Path),
+		TotalTokens: int64(repo.TokenCount),
+	}
+
+	for _, dirInfo := range repo.Dirs {
+		dir := &pb.DirectoryCount{Path: s.relPath(dirInfo.Path), Tokens: int64(dirInfo.TokenCount)}
+		for _, fileInfo := range dirInfo.Files {
+			dir.Files = append(dir.Files, s.fileCount(fileInfo))
+		}
+		sort.Slice(dir.Files, func(i, j int) bool {
+			return dir.Files[i].Path < dir.Files[j].Path
+		})
+		result.Directories = append(result.Directories, dir)
+	}
+	sort.Slice(result.Directories, func(i, j int) bool {
+		return result.Directories[i].Path < result.Directories[j].Path
+	})
+
+	for _, fileErr := range repo.Errors {
+		result.Errors = append(result.Errors, &pb.FileError{Path: s.relPath(fileErr.Path), Message: fileErr.Err.Error()})
+	}
+	return result
+}
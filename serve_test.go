@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	pb "token-counter/api/tokencounter/v1"
+)
+
+// scanStream collects the messages ScanRepo sends
+type scanStream struct {
+	grpc.ServerStream
+	sent []*pb.ScanRepoResponse
+}
+
+func (s *scanStream) Context() context.Context { return context.Background() }
+
+func (s *scanStream) Send(resp *pb.ScanRepoResponse) error {
+	s.sent = append(s.sent, resp)
+	return nil
+}
+
+func TestConfine(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	writeTree(t, base, map[string]string{
+		"root/app/main.go":  "package main\n",
+		"outside/secret.go": "package secret\n",
+	})
+	if err := os.Symlink(filepath.Join(base, "outside"), filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "app"), filepath.Join(root, "inside")); err != nil {
+		t.Fatal(err)
+	}
+	s := &tokenCounterServer{root: root}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr error
+	}{
+		{"directory", "app", filepath.Join(root, "app"), nil},
+		{"root", "", root, nil},
+		{"dot-dot is cleaned away", "../../app", filepath.Join(root, "app"), nil},
+		{"symlink within the root", "inside", filepath.Join(root, "inside"), nil},
+		{"symlink out of the root", "escape", "", errOutsideRoot},
+		{"missing", "nope", "", os.ErrNotExist},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.confine(tt.path)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("confine(%q) error = %v, want %v", tt.path, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("confine(%q) = %q, %v, want %q", tt.path, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanRepo(t *testing.T) {
+	base := t.TempDir()
+	root := filepath.Join(base, "root")
+	writeTree(t, base, map[string]string{
+		"root/app/main.go":  "package main\n\nfunc main() {}\n",
+		"outside/secret.go": "package secret\n",
+	})
+	if err := os.Symlink(filepath.Join(base, "outside"), filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	options := testOptions(t)
+	options.Quiet = true
+	s := &tokenCounterServer{options: options, root: root, metrics: newServerMetrics(), codecs: make(map[string]namedCodec)}
+
+	tests := []struct {
+		name string
+		path string
+		code codes.Code
+	}{
+		{"directory under the root", "app", codes.OK},
+		{"symlink out of the root", "escape", codes.PermissionDenied},
+		{"missing directory", "nope", codes.NotFound},
+		{"file", "app/main.go", codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := &scanStream{}
+			err := s.ScanRepo(&pb.ScanRepoRequest{Path: tt.path}, stream)
+			if code := status.Code(err); code != tt.code {
+				t.Fatalf("ScanRepo(%q) = %v, want %v", tt.path, err, tt.code)
+			}
+			if tt.code != codes.OK {
+				return
+			}
+			result := stream.sent[len(stream.sent)-1].GetResult()
+			if result == nil || result.GetTotalTokens() == 0 {
+				t.Fatalf("ScanRepo(%q) sent no result with tokens: %v", tt.path, stream.sent)
+			}
+		})
+	}
+}
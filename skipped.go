@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// SkippedFile is a file or directory a scan left out, and why. Reason is one
+// of pruned, max-depth, hidden, gitignore, tokenignore, gitattributes,
+// symlink, submodule, include, extension, size, binary, generated,
+// already-counted, min-tokens or duplicate.
+type SkippedFile struct {
+	Path      string `json:"path"`
+	Directory bool   `json:"directory,omitempty"` // Everything under it was left out too
+	Reason    string `json:"reason"`
+	Detail    string `json:"detail,omitempty"` // Such as the ignore rule that matched or the detected type
+}
+
+// SkippedReport is the list of everything a scan left out, written by
+// -skipped-report
+type SkippedReport struct {
+	Metadata *ScanMetadata  `json:"metadata"`
+	Reasons  map[string]int `json:"reasons"` // Number of skipped files and directories by reason
+	Skipped  []*SkippedFile `json:"skipped"`
+}
+
+// writeSkippedReport writes the skipped files and directories of a scan to
+// path as JSON, with paths relative to the scan root
+func writeSkippedReport(path string, repo *RepoTokenInfo, skipped []*SkippedFile, options *CommandOptions) error {
+	report := &SkippedReport{
+		Metadata: newScanMetadata(repo, options),
+		Reasons:  make(map[string]int),
+		Skipped:  []*SkippedFile{},
+	}
+	for _, skip := range skipped {
+		entry := *skip
+		if rel, err := filepath.Rel(repo.Path, skip.Path); err == nil {
+			entry.Path = filepath.ToSlash(rel)
+		}
+		report.Reasons[skip.Reason]++
+		report.Skipped = append(report.Skipped, &entry)
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
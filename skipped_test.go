@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteSkippedReport(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"a.txt":         "one",
+		".hidden/b.txt": "two",
+		"image.png":     "not an image",
+		"binary.dat":    "zero\x00byte",
+	})
+
+	var skipped []*SkippedFile
+	options := testOptions(t, "-model", "cl100k_base")
+	options.Path = dir
+	options.OnSkip = func(s *SkippedFile) { skipped = append(skipped, s) }
+	repo, err := ProcessRepository(context.Background(), dir, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "skipped.json")
+	if err := writeSkippedReport(path, repo, skipped, options); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report SkippedReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("report isn't JSON: %v\n%s", err, data)
+	}
+	if report.Metadata == nil || report.Metadata.Model != "cl100k_base" {
+		t.Errorf("metadata %+v", report.Metadata)
+	}
+
+	reasons := make(map[string]string)
+	for _, skip := range report.Skipped {
+		reasons[skip.Path] = skip.Reason
+	}
+	tests := []struct {
+		path   string
+		reason string
+	}{
+		{".hidden", "hidden"},
+		{"image.png", "extension"},
+		{"binary.dat", "binary"},
+	}
+	for _, tt := range tests {
+		if reasons[tt.path] != tt.reason {
+			t.Errorf("%s skipped as %q, want %q", tt.path, reasons[tt.path], tt.reason)
+		}
+		if report.Reasons[tt.reason] == 0 {
+			t.Errorf("reasons %v leave out %s", report.Reasons, tt.reason)
+		}
+	}
+	if _, ok := reasons["a.txt"]; ok {
+		t.Error("a counted file is in the report")
+	}
+
+	// Nothing skipped is an empty list, not null
+	empty := filepath.Join(t.TempDir(), "empty.json")
+	if err := writeSkippedReport(empty, repo, nil, options); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(empty); !json.Valid(data) || !strings.Contains(string(data), `"skipped": []`) {
+		t.Errorf("empty report:\n%s", data)
+	}
+
+	if err := writeSkippedReport(filepath.Join(dir, "missing", "skipped.json"), repo, skipped, options); err == nil {
+		t.Error("writing to a missing directory succeeded")
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// sniffLen is how much of a file is read to tell whether it's text
+const sniffLen = 8000
+
+// looksBinary reports whether data contains a NUL byte near its start,
+// which text files don't, unless they're UTF-16 or UTF-32
+func looksBinary(data []byte) bool {
+	sample := data
+	if len(sample) > sniffLen {
+		sample = sample[:sniffLen]
+	}
+	if bytes.IndexByte(sample, 0) < 0 {
+		return false
+	}
+	for _, bom := range boms {
+		if bytes.HasPrefix(data, bom.BOM) {
+			return false
+		}
+	}
+	_, enc := sniffUTF16(data)
+	return enc == nil
+}
+
+// sniffType tells from the start of a file's contents whether it's binary,
+// returning the MIME type it was recognized as. Files with NUL bytes are
+// binary unless they're UTF-16 or UTF-32 text; others are sniffed with the
+// algorithm browsers use, and anything it doesn't call text/*, such as a PDF
+// or an image, is binary. Extensions play no part, so a Dockerfile or a
+// shell script counts and a PNG saved as .txt doesn't.
+func sniffType(data []byte) (string, bool) {
+	if bytes.IndexByte(data[:min(len(data), sniffLen)], 0) >= 0 {
+		if looksBinary(data) {
+			return mediaType(http.DetectContentType(data)), true
+		}
+		return "text/plain", false
+	}
+	mimeType := mediaType(http.DetectContentType(data))
+	return mimeType, !strings.HasPrefix(mimeType, "text/")
+}
+
+// sniffFile reads the start of a file and sniffs its type
+func sniffFile(path string) (string, bool, error) {
+	_, mimeType, binary, err := sniffHead(path)
+	return mimeType, binary, err
+}
+
+// sniffHead sniffs the type of a file like sniffFile, returning the start of
+// it that was read too
+func sniffHead(path string) ([]byte, string, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, "", false, err
+	}
+	defer file.Close()
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, "", false, err
+	}
+	mimeType, binary := sniffType(head[:n])
+	return head[:n], mimeType, binary, nil
+}
+
+// mediaType strips the parameters, such as the charset, from a MIME type
+func mediaType(mimeType string) string {
+	mediaType, _, _ := strings.Cut(mimeType, ";")
+	return strings.TrimSpace(mediaType)
+}
+
+// binaryReason explains the skipping of a binary file of the given type
+func binaryReason(mimeType string) string {
+	if mimeType == "" || mimeType == "application/octet-stream" {
+		return "binary content"
+	}
+	return "binary content (" + mimeType + ")"
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSniffType(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		mimeType string
+		binary   bool
+	}{
+		{"text", []byte("hello world\n"), "text/plain", false},
+		{"html", []byte("<!DOCTYPE html><html></html>"), "text/html", false},
+		{"empty", nil, "text/plain", false},
+		{"png", []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "image/png", true},
+		{"pdf", []byte("%PDF-1.7\n"), "application/pdf", true},
+		{"nul", []byte("abc\x00def"), "application/octet-stream", true},
+		{"utf-16 with bom", []byte("\xff\xfeh\x00i\x00"), "text/plain", false},
+		{"utf-16 without bom", []byte("h\x00e\x00l\x00l\x00o\x00 \x00w\x00o\x00r\x00l\x00d\x00"), "text/plain", false},
+	}
+	for _, tt := range tests {
+		mimeType, binary := sniffType(tt.data)
+		if mimeType != tt.mimeType || binary != tt.binary {
+			t.Errorf("%s: sniffType = %q, %v, want %q, %v", tt.name, mimeType, binary, tt.mimeType, tt.binary)
+		}
+	}
+}
+
+func TestSniffedScan(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"Dockerfile":   "FROM scratch\n",
+		"run":          "#!/bin/sh\necho hi\n",
+		"image.txt":    "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR",
+		"blob.dat":     "abc\x00def",
+		"notes.md":     "# Notes\n",
+		"doc.pdf.text": "%PDF-1.7\n",
+	})
+	var skipped []*SkippedFile
+	options := testOptions(t, "-model", "cl100k_base")
+	options.Path = dir
+	options.OnSkip = func(s *SkippedFile) { skipped = append(skipped, s) }
+	repo, err := ProcessRepository(t.Context(), dir, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := countedPaths(dir, repo), []string{"Dockerfile", "notes.md", "run"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("counted %v, want %v", got, want)
+	}
+	reasons := make(map[string]string)
+	for _, s := range skipped {
+		reasons[filepath.Base(s.Path)] = s.Detail
+	}
+	if want := map[string]string{"image.txt": "binary content (image/png)", "blob.dat": "binary content", "doc.pdf.text": "binary content (application/pdf)"}; !reflect.DeepEqual(reasons, want) {
+		t.Errorf("skipped %v, want %v", reasons, want)
+	}
+
+	if _, _, err := sniffFile(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("sniffFile of a missing file = %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// pythonDefLine matches the first line of a top-level Python function or
+// class, and pythonTopLevel any line starting a top-level statement
+var (
+	pythonDefLine  = regexp.MustCompile(`^(?:async\s+def|def|class)\s+([A-Za-z_]\w*)`)
+	pythonTopLevel = regexp.MustCompile(`^[^\s#]`)
+)
+
+// LineRange is an inclusive range of line numbers, counting from 1
+type LineRange struct {
+	Start int
+	End   int // 0 for the end of the file
+}
+
+// Snippet is the count of some lines of a file: a -lines range, or a
+// function for -per-function
+type Snippet struct {
+	Name   string `json:"name,omitempty"` // Function name, e.g. (*Server).Handle
+	Start  int    `json:"start_line"`
+	End    int    `json:"end_line"`
+	Tokens int    `json:"total"`
+}
+
+// registerSnippetFlags defines the flags counting parts of a single file
+func registerSnippetFlags(fs *flag.FlagSet, options *CommandOptions) {
+	fs.Func("lines", "Also count the tokens of just these lines of the file, e.g. 120-340, 500- or 42 (repeatable)", func(value string) error {
+		r, err := parseLineRange(value)
+		options.Lines = append(options.Lines, r)
+		return err
+	})
+	fs.BoolVar(&options.PerFunction, "per-function", false, "Also count the tokens of each top-level function of a Go or Python file")
+}
+
+// validateSnippets checks that -lines and -per-function are given for a
+// single file, which they count as it is, not as a -view shows it
+func validateSnippets(options *CommandOptions) error {
+	if len(options.Lines) == 0 && !options.PerFunction {
+		return nil
+	}
+	if !options.IsSingleFile {
+		return fmt.Errorf("-lines and -per-function need a single file, not a directory")
+	}
+	if options.View != "" && options.View != "full" {
+		return fmt.Errorf("-lines and -per-function can't be used with -view")
+	}
+	return nil
+}
+
+// parseLineRange parses a -lines range: N-M, N- to the end, or a single line
+func parseLineRange(value string) (LineRange, error) {
+	start, end, isRange := strings.Cut(strings.TrimSpace(value), "-")
+	r := LineRange{}
+	var err error
+	if r.Start, err = strconv.Atoi(start); err != nil || r.Start < 1 {
+		return r, fmt.Errorf("invalid line range %q (expected e.g. 120-340, 500- or 42)", value)
+	}
+	switch {
+	case !isRange:
+		r.End = r.Start
+	case end != "":
+		if r.End, err = strconv.Atoi(end); err != nil || r.End < r.Start {
+			return r, fmt.Errorf("invalid line range %q (expected e.g. 120-340, 500- or 42)", value)
+		}
+	}
+	return r, nil
+}
+
+// countSnippets counts the -lines ranges and, with -per-function, the
+// functions of a file's text, line numbers and all taken from the file as it
+// is rather than its -view
+func countSnippets(path string, text string, enc namedCodec, options *CommandOptions) (ranges []*Snippet, functions []*Snippet, err error) {
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	count := func(snippet *Snippet) (err error) {
+		snippet.Tokens, err = countUnits(strings.Join(lines[snippet.Start-1:snippet.End], ""), enc, options.CountMode)
+		return err
+	}
+
+	for _, r := range options.Lines {
+		if r.Start > len(lines) {
+			return nil, nil, fmt.Errorf("line %d is past the end of the file (%d lines)", r.Start, len(lines))
+		}
+		snippet := &Snippet{Start: r.Start, End: r.End}
+		if snippet.End == 0 || snippet.End > len(lines) {
+			snippet.End = len(lines)
+		}
+		if err := count(snippet); err != nil {
+			return nil, nil, err
+		}
+		ranges = append(ranges, snippet)
+	}
+
+	if options.PerFunction {
+		var spans []*Snippet
+		switch ext := strings.ToLower(filepath.Ext(path)); ext {
+		case ".go":
+			if spans, err = goFunctions(path, text); err != nil {
+				return nil, nil, err
+			}
+		case ".py", ".pyw":
+			spans = pythonFunctions(lines)
+		default:
+			return nil, nil, fmt.Errorf("-per-function supports Go and Python files, not %s", strings.TrimPrefix(ext, "."))
+		}
+		for _, span := range spans {
+			if err := count(span); err != nil {
+				return nil, nil, err
+			}
+		}
+		sort.SliceStable(spans, func(i, j int) bool { return spans[i].Tokens > spans[j].Tokens })
+		functions = spans
+	}
+	return ranges, functions, nil
+}
+
+// goFunctions returns the lines of each function and method declared in a
+// Go file, with its doc comment. Methods are named after their receiver's
+// type, e.g. (*Server).Handle.
+func goFunctions(path string, text string) ([]*Snippet, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, text, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	var functions []*Snippet
+	for _, decl := range file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		name := fn.Name.Name
+		if fn.Recv != nil && len(fn.Recv.List) > 0 {
+			name = "(" + types.ExprString(fn.Recv.List[0].Type) + ")." + name
+		}
+		start := fn.Pos()
+		if fn.Doc != nil {
+			start = fn.Doc.Pos()
+		}
+		functions = append(functions, &Snippet{Name: name, Start: fset.Position(start).Line, End: fset.Position(fn.End()).Line})
+	}
+	return functions, nil
+}
+
+// pythonFunctions returns the lines of each top-level function and class of
+// a Python file, decorators included. A definition runs until the next
+// top-level statement, less the blank and comment lines before it; triple-
+// quoted strings are skipped, so a docstring line at the margin doesn't end
+// one. Python has no parser in Go's standard library, so this reads the
+// layout rather than the syntax tree.
+func pythonFunctions(lines []string) []*Snippet {
+	var functions []*Snippet
+	var current *Snippet
+	decorators := 0 // First line of the decorators above the next definition
+	inString := ""
+	end := func(last int) {
+		if current == nil {
+			return
+		}
+		for last > current.Start {
+			if trimmed := strings.TrimSpace(lines[last-1]); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+				break
+			}
+			last--
+		}
+		current.End = last
+		functions = append(functions, current)
+		current = nil
+	}
+
+	for i, line := range lines {
+		number := i + 1
+		if inString == "" && pythonTopLevel.MatchString(line) {
+			if m := pythonDefLine.FindStringSubmatch(line); m != nil {
+				end(number - 1)
+				start := number
+				if decorators > 0 {
+					start = decorators
+				}
+				kind := "def "
+				if strings.HasPrefix(line, "class") {
+					kind = "class "
+				}
+				current = &Snippet{Name: kind + m[1], Start: start}
+				decorators = 0
+			} else if strings.HasPrefix(line, "@") {
+				if decorators == 0 {
+					decorators = number
+				}
+			} else {
+				end(number - 1)
+				decorators = 0
+			}
+		}
+		// Track triple-quoted strings, which may run over several lines
+		for _, quote := range []string{`"""`, `'''`} {
+			if inString == "" || inString == quote {
+				if strings.Count(line, quote)%2 == 1 {
+					if inString == "" {
+						inString = quote
+					} else {
+						inString = ""
+					}
+				}
+			}
+		}
+	}
+	end(len(lines))
+	return functions
+}
+
+// printSnippets prints the -lines and -per-function counts of a single file
+func printSnippets(fileInfo *FileTokenInfo, options *CommandOptions) {
+	unit := options.unitName()
+	for _, r := range fileInfo.LineRanges {
+		lines := fmt.Sprintf("Lines %d-%d", r.Start, r.End)
+		if r.Start == r.End {
+			lines = fmt.Sprintf("Line %d", r.Start)
+		}
+		fmt.Printf("%s: %s %s (%.1f%% of file)\n", lines, formatCount(r.Tokens), unit, percentOf(r.Tokens, fileInfo.TokenCount))
+	}
+	if !options.PerFunction {
+		return
+	}
+	fmt.Println()
+	fmt.Println(options.paint(ansiBold, "Functions (sorted by "+strings.TrimSuffix(unit, "s")+" count):"))
+	fmt.Println("----------------------------------")
+	if len(fileInfo.Functions) == 0 {
+		fmt.Println("No top-level functions")
+	}
+	for _, fn := range fileInfo.Functions {
+		fmt.Println(options.paint(shareColor(fn.Tokens, fileInfo.TokenCount), fmt.Sprintf("%s (lines %d-%d): %s %s (%.1f%% of file)",
+			fn.Name, fn.Start, fn.End, formatCount(fn.Tokens), unit, percentOf(fn.Tokens, fileInfo.TokenCount))))
+	}
+}
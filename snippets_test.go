@@ -0,0 +1,156 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLineRange(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    LineRange
+		wantErr bool
+	}{
+		{"120-340", LineRange{120, 340}, false},
+		{"500-", LineRange{500, 0}, false},
+		{" 42 ", LineRange{42, 42}, false},
+		{"0-3", LineRange{}, true},
+		{"10-5", LineRange{}, true},
+		{"a-b", LineRange{}, true},
+		{"", LineRange{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseLineRange(tt.value)
+		if (err != nil) != tt.wantErr || !tt.wantErr && got != tt.want {
+			t.Errorf("parseLineRange(%q) = %+v, %v, want %+v", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestValidateSnippets(t *testing.T) {
+	tests := []struct {
+		name    string
+		options CommandOptions
+		want    string
+	}{
+		{"unset", CommandOptions{}, ""},
+		{"single file", CommandOptions{IsSingleFile: true, PerFunction: true}, ""},
+		{"directory", CommandOptions{Lines: []LineRange{{1, 2}}}, "-lines and -per-function need a single file, not a directory"},
+		{"view", CommandOptions{IsSingleFile: true, PerFunction: true, View: "signatures"}, "-lines and -per-function can't be used with -view"},
+	}
+	for _, tt := range tests {
+		err := validateSnippets(&tt.options)
+		if tt.want == "" && err != nil || tt.want != "" && (err == nil || err.Error() != tt.want) {
+			t.Errorf("%s: %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+const testGoSnippetFile = `package server
+
+// Server serves requests
+type Server struct{}
+
+// Handle handles a request,
+// at some length
+func (s *Server) Handle(path string) error {
+	return nil
+}
+
+func helper() {}
+`
+
+const testPythonSnippetFile = `import os
+
+@cache
+@retry(times=3)
+def load(path):
+    """Load a file.
+
+This line is at the margin, inside the docstring.
+"""
+    return open(path).read()
+
+# A comment before the class
+class Store:
+    def get(self, key):
+        return key
+
+CONSTANT = 1
+`
+
+func TestCountSnippets(t *testing.T) {
+	tests := []struct {
+		name      string
+		path      string
+		text      string
+		lines     []LineRange
+		ranges    []Snippet
+		functions []Snippet
+	}{
+		{
+			name:      "Go",
+			path:      "server.go",
+			text:      testGoSnippetFile,
+			lines:     []LineRange{{1, 1}, {11, 0}},
+			ranges:    []Snippet{{Start: 1, End: 1, Tokens: 2}, {Start: 11, End: 12, Tokens: 3}},
+			functions: []Snippet{{Name: "(*Server).Handle", Start: 6, End: 10, Tokens: 19}, {Name: "helper", Start: 12, End: 12, Tokens: 3}},
+		},
+		{
+			name: "Python",
+			path: "store.py",
+			text: testPythonSnippetFile,
+			functions: []Snippet{
+				{Name: "def load", Start: 3, End: 10, Tokens: 19},
+				{Name: "class Store", Start: 13, End: 15, Tokens: 7},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := &CommandOptions{CountMode: "words", Lines: tt.lines, PerFunction: true}
+			ranges, functions, err := countSnippets(tt.path, tt.text, namedCodec{}, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := derefSnippets(ranges); !reflect.DeepEqual(got, tt.ranges) {
+				t.Errorf("ranges %+v, want %+v", got, tt.ranges)
+			}
+			if got := derefSnippets(functions); !reflect.DeepEqual(got, tt.functions) {
+				t.Errorf("functions %+v, want %+v", got, tt.functions)
+			}
+		})
+	}
+}
+
+// derefSnippets copies snippets out of their pointers, for comparing
+func derefSnippets(snippets []*Snippet) []Snippet {
+	var list []Snippet
+	for _, s := range snippets {
+		list = append(list, *s)
+	}
+	return list
+}
+
+func TestCountSnippetsErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		text    string
+		options CommandOptions
+		want    string
+	}{
+		{"past the end", "a.txt", "one\ntwo\n", CommandOptions{Lines: []LineRange{{3, 3}}}, "line 3 is past the end of the file (2 lines)"},
+		{"unsupported language", "a.rb", "def a; end\n", CommandOptions{PerFunction: true}, "-per-function supports Go and Python files, not rb"},
+		{"invalid Go", "a.go", "package a\nfunc {", CommandOptions{PerFunction: true}, "expected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.options.CountMode = "words"
+			if _, _, err := countSnippets(tt.path, tt.text, namedCodec{}, &tt.options); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("countSnippets error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// sortKeys are the values accepted by -sort
+var sortKeys = map[string]bool{"tokens": true, "name": true, "path": true, "files": true}
+
+// parseSortKey validates the value of -sort
+func parseSortKey(value string) (string, error) {
+	if !sortKeys[value] {
+		return "", fmt.Errorf("unknown sort key %q (expected tokens, name, path or files)", value)
+	}
+	return value, nil
+}
+
+// sortKey returns the key directories and files are ordered by
+func (o *CommandOptions) sortKey() string {
+	if o.SortBy == "" {
+		return "tokens"
+	}
+	return o.SortBy
+}
+
+// sortDescription describes the ordering for report headings, e.g.
+// "token count" or "name, reversed"
+func (o *CommandOptions) sortDescription() string {
+	var description string
+	switch o.sortKey() {
+	case "tokens":
+		description = strings.TrimSuffix(o.unitName(), "s") + " count"
+	case "files":
+		description = "file count"
+	default:
+		description = o.sortKey()
+	}
+	if o.Reverse {
+		description += ", reversed"
+	}
+	return description
+}
+
+// entryLess orders two report entries by the -sort key. Counts sort largest
+// first and names alphabetically, with ties broken by path so the order is
+// stable between runs; -reverse flips the whole order.
+func (o *CommandOptions) entryLess(pathA string, pathB string, tokensA int, tokensB int, filesA int, filesB int) bool {
+	if o.Reverse {
+		pathA, pathB = pathB, pathA
+		tokensA, tokensB = tokensB, tokensA
+		filesA, filesB = filesB, filesA
+	}
+
+	switch o.sortKey() {
+	case "name":
+		if a, b := filepath.Base(pathA), filepath.Base(pathB); a != b {
+			return a < b
+		}
+	case "files":
+		if filesA != filesB {
+			return filesA > filesB
+		}
+		if tokensA != tokensB {
+			return tokensA > tokensB
+		}
+	case "tokens":
+		if tokensA != tokensB {
+			return tokensA > tokensB
+		}
+	}
+	return pathA < pathB
+}
+
+// sortDirs orders directories for a report
+func (o *CommandOptions) sortDirs(dirs []*DirTokenInfo) {
+	sort.Slice(dirs, func(i, j int) bool {
+		return o.entryLess(dirs[i].Path, dirs[j].Path, dirs[i].TokenCount, dirs[j].TokenCount, len(dirs[i].Files), len(dirs[j].Files))
+	})
+}
+
+// sortFiles orders the files of a directory for a report. Sorting files by
+// file count falls back to their token counts.
+func (o *CommandOptions) sortFiles(files []*FileTokenInfo) {
+	sort.Slice(files, func(i, j int) bool {
+		return o.entryLess(files[i].Path, files[j].Path, files[i].TokenCount, files[j].TokenCount, 1, 1)
+	})
+}
+
+// sortedDirs returns the directories of a scan in report order
+func (o *CommandOptions) sortedDirs(repo *RepoTokenInfo) []*DirTokenInfo {
+	dirs := make([]*DirTokenInfo, 0, len(repo.Dirs))
+	for _, dirInfo := range repo.Dirs {
+		dirs = append(dirs, dirInfo)
+	}
+	o.sortDirs(dirs)
+	return dirs
+}
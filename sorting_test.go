@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSortDirs(t *testing.T) {
+	dirs := []*DirTokenInfo{
+		{Path: "b", TokenCount: 10, Files: make([]*FileTokenInfo, 3)},
+		{Path: "a/z", TokenCount: 30, Files: make([]*FileTokenInfo, 1)},
+		{Path: "c", TokenCount: 10, Files: make([]*FileTokenInfo, 2)},
+	}
+	tests := []struct {
+		args        []string
+		want        []string
+		description string
+	}{
+		{nil, []string{"a/z", "b", "c"}, "token count"},
+		{[]string{"-reverse"}, []string{"c", "b", "a/z"}, "token count, reversed"},
+		{[]string{"-sort", "name"}, []string{"b", "c", "a/z"}, "name"},
+		{[]string{"-sort", "path"}, []string{"a/z", "b", "c"}, "path"},
+		{[]string{"-sort", "files"}, []string{"b", "c", "a/z"}, "file count"},
+		{[]string{"-sort", "files", "-reverse"}, []string{"a/z", "c", "b"}, "file count, reversed"},
+		{[]string{"-count-mode", "words"}, []string{"a/z", "b", "c"}, "word count"},
+	}
+	for _, tt := range tests {
+		options := testOptions(t, tt.args...)
+		sorted := append([]*DirTokenInfo(nil), dirs...)
+		options.sortDirs(sorted)
+		var got []string
+		for _, dirInfo := range sorted {
+			got = append(got, dirInfo.Path)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%v sorted %v, want %v", tt.args, got, tt.want)
+		}
+		if got := options.sortDescription(); got != tt.description {
+			t.Errorf("%v described as %q, want %q", tt.args, got, tt.description)
+		}
+	}
+
+	if _, err := parseSortKey("size"); err == nil {
+		t.Error("parseSortKey of an unknown key succeeded")
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// specialSettings are how the tiktoken encodings treat text that spells a
+// special token, like <|endoftext|>, set by -allow-special and
+// -disallow-special. Special tokens in neither list are counted as the
+// plain text they're written with.
+var specialSettings = struct {
+	Allowed    []string // Counted as the one special token, or "all"
+	Disallowed []string // Fail the count of the text they're in, or "all"
+}{}
+
+// specialTokens lists the special tokens of each tiktoken encoding
+var specialTokens = map[string][]string{
+	"cl100k_base": {"<|endoftext|>", "<|fim_prefix|>", "<|fim_middle|>", "<|fim_suffix|>", "<|endofprompt|>"},
+	"o200k_base":  {"<|endoftext|>", "<|endofprompt|>"},
+	"p50k_base":   {"<|endoftext|>"},
+	"p50k_edit":   {"<|endoftext|>", "<|fim_prefix|>", "<|fim_middle|>", "<|fim_suffix|>"},
+	"r50k_base":   {"<|endoftext|>"},
+}
+
+// parseSpecial parses the value of -allow-special or -disallow-special: all,
+// none or a comma-separated list of special tokens
+func parseSpecial(value string) ([]string, error) {
+	switch value {
+	case "all":
+		return []string{"all"}, nil
+	case "none", "":
+		return nil, nil
+	}
+	known := make(map[string]bool)
+	for _, tokens := range specialTokens {
+		for _, token := range tokens {
+			known[token] = true
+		}
+	}
+	tokens := splitList(value)
+	for _, token := range tokens {
+		if !known[token] {
+			return nil, fmt.Errorf("unknown special token %q (expected all, none or some of %s)", token, strings.Join(sortedKeys(known), ", "))
+		}
+	}
+	return tokens, nil
+}
+
+// validateSpecial checks that no special token is both allowed and
+// disallowed
+func validateSpecial() error {
+	allowed, disallowed := specialSettings.Allowed, specialSettings.Disallowed
+	if len(allowed) == 0 || len(disallowed) == 0 {
+		return nil
+	}
+	if allowed[0] == "all" || disallowed[0] == "all" {
+		return fmt.Errorf("-allow-special and -disallow-special can't both list every special token")
+	}
+	for _, token := range allowed {
+		for _, other := range disallowed {
+			if token == other {
+				return fmt.Errorf("%s is both allowed and disallowed", token)
+			}
+		}
+	}
+	return nil
+}
+
+// specialSet returns the special tokens of an encoding a setting covers
+func specialSet(setting []string, encoding []string) map[string]bool {
+	set := make(map[string]bool)
+	if len(setting) > 0 && setting[0] == "all" {
+		setting = encoding
+	}
+	for _, token := range setting {
+		for _, known := range encoding {
+			if token == known {
+				set[token] = true
+			}
+		}
+	}
+	return set
+}
+
+// countSpecial counts text with a tiktoken encoding whose special tokens are
+// treated as specialSettings say: the allowed ones are one token each, the
+// disallowed ones an error, and the rest counted as text
+func (t tiktokenTokenizer) countSpecial(text string) (int, error) {
+	encoding := specialTokens[t.codec.GetName()]
+	allowed := specialSet(specialSettings.Allowed, encoding)
+	disallowed := specialSet(specialSettings.Disallowed, encoding)
+	if len(allowed) == 0 && len(disallowed) == 0 {
+		return t.encode(text)
+	}
+	watched := append(sortedKeys(allowed), sortedKeys(disallowed)...)
+	// Longest first, so no token is found as part of a longer one
+	sort.SliceStable(watched, func(i, j int) bool { return len(watched[i]) > len(watched[j]) })
+
+	count := 0
+	for text != "" {
+		start, token := -1, ""
+		for _, candidate := range watched {
+			if i := strings.Index(text, candidate); i >= 0 && (start < 0 || i < start) {
+				start, token = i, candidate
+			}
+		}
+		if start < 0 {
+			break
+		}
+		if disallowed[token] {
+			return 0, fmt.Errorf("the text contains the special token %s; count it as a token with -allow-special or as text with -disallow-special none", token)
+		}
+		n, err := t.encode(text[:start])
+		if err != nil {
+			return 0, err
+		}
+		count += n + 1
+		text = text[start+len(token):]
+	}
+	n, err := t.encode(text)
+	return count + n, err
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseSpecial(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr string
+	}{
+		{"all", "all", ""},
+		{"none", "", ""},
+		{"<|endoftext|>,<|fim_prefix|>", "<|endoftext|>,<|fim_prefix|>", ""},
+		{"<|endoftext|>,<|start|>", "", `unknown special token "<|start|>" (expected all, none or some of <|endofprompt|>, <|endoftext|>,`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseSpecial(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("parseSpecial error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || strings.Join(got, ",") != tt.want {
+				t.Errorf("parseSpecial = %v, %v, want %s", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateSpecial(t *testing.T) {
+	t.Cleanup(func() { specialSettings.Allowed, specialSettings.Disallowed = nil, nil })
+	tests := []struct {
+		name                string
+		allowed, disallowed []string
+		wantErr             string
+	}{
+		{"neither", nil, nil, ""},
+		{"different tokens", []string{"<|endoftext|>"}, []string{"<|fim_prefix|>"}, ""},
+		{"only allowed", []string{"all"}, nil, ""},
+		{"both all", []string{"all"}, []string{"<|fim_prefix|>"}, "-allow-special and -disallow-special can't both list every special token"},
+		{"both", []string{"<|endoftext|>", "<|fim_prefix|>"}, []string{"<|fim_prefix|>"}, "<|fim_prefix|> is both allowed and disallowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			specialSettings.Allowed, specialSettings.Disallowed = tt.allowed, tt.disallowed
+			err := validateSpecial()
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("validateSpecial = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCountSpecial(t *testing.T) {
+	t.Cleanup(func() { specialSettings.Allowed, specialSettings.Disallowed = nil, nil })
+	count := func(model string, text string) (int, error) {
+		t.Helper()
+		tok, err := codecForName(model)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok.Count(text)
+	}
+	text := "a<|endoftext|>b<|fim_prefix|>c"
+	// Counted before any setting applies, as plain text
+	plain, _ := count("cl100k_base", text)
+	a, _ := count("cl100k_base", "a")
+	rest, _ := count("cl100k_base", "b<|fim_prefix|>c")
+	r50k, _ := count("r50k_base", text)
+	tests := []struct {
+		name                string
+		model               string
+		allowed, disallowed []string
+		want                int
+		wantErr             string
+	}{
+		{"as text", "cl100k_base", nil, nil, plain, ""},
+		{"all allowed", "cl100k_base", []string{"all"}, nil, 5, ""},
+		{"one allowed", "cl100k_base", []string{"<|endoftext|>"}, nil, a + 1 + rest, ""},
+		{"not in the encoding", "r50k_base", []string{"<|fim_prefix|>"}, nil, r50k, ""},
+		{"disallowed", "cl100k_base", []string{"<|endoftext|>"}, []string{"<|fim_prefix|>"}, 0, "the text contains the special token <|fim_prefix|>"},
+		{"all disallowed", "o200k_base", nil, []string{"all"}, 0, "the text contains the special token <|endoftext|>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			specialSettings.Allowed, specialSettings.Disallowed = tt.allowed, tt.disallowed
+			got, err := count(tt.model, text)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Count error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Count = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
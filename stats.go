@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// FileStats summarizes the distribution of per-file counts in a scan
+type FileStats struct {
+	Files  int     `json:"files"`
+	Min    int     `json:"min"`
+	Median int     `json:"median"`
+	Mean   float64 `json:"mean"`
+	P90    int     `json:"p90"`
+	P99    int     `json:"p99"`
+	Max    int     `json:"max"`
+}
+
+// histogramBucket counts files whose size falls in [Low, High)
+type histogramBucket struct {
+	Low   int `json:"low"`
+	High  int `json:"high"`
+	Files int `json:"files"`
+}
+
+// fileCounts returns the count of every file in a scan, sorted ascending
+func fileCounts(repo *RepoTokenInfo, options *CommandOptions) []int {
+	var counts []int
+	for _, fileInfo := range repo.countedFiles(options) {
+		counts = append(counts, fileInfo.TokenCount)
+	}
+	sort.Ints(counts)
+	return counts
+}
+
+// computeFileStats computes summary statistics of sorted per-file counts
+func computeFileStats(counts []int) FileStats {
+	stats := FileStats{Files: len(counts)}
+	if len(counts) == 0 {
+		return stats
+	}
+
+	total := 0
+	for _, count := range counts {
+		total += count
+	}
+	stats.Min = counts[0]
+	stats.Max = counts[len(counts)-1]
+	stats.Mean = float64(total) / float64(len(counts))
+	stats.Median = percentile(counts, 50)
+	stats.P90 = percentile(counts, 90)
+	stats.P99 = percentile(counts, 99)
+	return stats
+}
+
+// percentile returns the p-th percentile of sorted values (nearest rank)
+func percentile(sorted []int, p float64) int {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// buildHistogram buckets sorted counts by powers of two, which keeps both
+// small files and the long tail of huge ones readable
+func buildHistogram(counts []int) []histogramBucket {
+	if len(counts) == 0 {
+		return nil
+	}
+
+	var buckets []histogramBucket
+	low, high := 0, 128
+	i := 0
+	for i < len(counts) {
+		bucket := histogramBucket{Low: low, High: high}
+		for i < len(counts) && counts[i] < high {
+			bucket.Files++
+			i++
+		}
+		buckets = append(buckets, bucket)
+		low, high = high, high*2
+	}
+	return buckets
+}
+
+// PrintStats prints per-file statistics and a histogram of file sizes
+func PrintStats(repo *RepoTokenInfo, options *CommandOptions) {
+	counts := fileCounts(repo, options)
+	stats := computeFileStats(counts)
+	unit := options.unitName()
+
+	fmt.Printf("Statistics (%s per file):\n", unit)
+	fmt.Println("----------------------------------")
+	fmt.Printf("Files:  %d\n", stats.Files)
+	fmt.Printf("Min:    %d\n", stats.Min)
+	fmt.Printf("Median: %d\n", stats.Median)
+	fmt.Printf("Mean:   %.1f\n", stats.Mean)
+	fmt.Printf("P90:    %d\n", stats.P90)
+	fmt.Printf("P99:    %d\n", stats.P99)
+	fmt.Printf("Max:    %d\n", stats.Max)
+	fmt.Println()
+
+	buckets := buildHistogram(counts)
+	if len(buckets) == 0 {
+		return
+	}
+
+	maxFiles := 0
+	for _, bucket := range buckets {
+		if bucket.Files > maxFiles {
+			maxFiles = bucket.Files
+		}
+	}
+
+	fmt.Printf("Histogram (%s per file):\n", unit)
+	for _, bucket := range buckets {
+		width := 0
+		if maxFiles > 0 {
+			width = int(math.Round(float64(bucket.Files) * 40 / float64(maxFiles)))
+		}
+		if width == 0 && bucket.Files > 0 {
+			width = 1
+		}
+		label := fmt.Sprintf("%d-%d", bucket.Low, bucket.High-1)
+		fmt.Printf("%15s | %-40s %d\n", label, strings.Repeat("#", width), bucket.Files)
+	}
+	fmt.Println()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFilesBelowMin(t *testing.T) {
+	files := map[string]string{
+		"small.txt": "hi",
+		"large.txt": strings.Repeat("word ", 100),
+	}
+	tests := []struct {
+		name       string
+		args       []string
+		counts     []int
+		files      int
+		bundled    []string
+		chunkTotal string
+	}{
+		{"counted in the total", []string{"-min", "10"}, []int{1, 101}, 2, []string{"small.txt", "large.txt"}, "Total chunks: 3 (from 102 tokens)"},
+		{"left out with -filter-affects-totals", []string{"-min", "10", "-filter-affects-totals"}, []int{101}, 1, []string{"large.txt"}, "Total chunks: 2 (from 101 tokens)"},
+		{"without -min", nil, []int{1, 101}, 2, []string{"small.txt", "large.txt"}, "Total chunks: 3 (from 102 tokens)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, files)
+			repo, options := scanTree(t, dir, append([]string{"-model", "cl100k_base"}, tt.args...)...)
+
+			if got := fileCounts(repo, options); !reflect.DeepEqual(got, tt.counts) {
+				t.Errorf("fileCounts = %v, want %v", got, tt.counts)
+			}
+			if got := newScanMetadata(repo, options).Files; got != tt.files {
+				t.Errorf("metadata files = %d, want %d", got, tt.files)
+			}
+
+			bundle, included, _, _, err := buildBundle(repo, options, &ExportOptions{Order: "greedy"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if included != len(tt.bundled) {
+				t.Errorf("buildBundle included %d files, want %d", included, len(tt.bundled))
+			}
+			for _, name := range tt.bundled {
+				if !strings.Contains(bundle, "==> "+name+" <==") {
+					t.Errorf("bundle is missing %s", name)
+				}
+			}
+
+			out := captureStdout(t, func() { PrintChunks(repo, options, 64, 0) })
+			if !strings.Contains(out, tt.chunkTotal) {
+				t.Errorf("PrintChunks printed %q, want %q", out, tt.chunkTotal)
+			}
+		})
+	}
+}
+
+func TestComputeFileStats(t *testing.T) {
+	tests := []struct {
+		counts []int
+		want   FileStats
+	}{
+		{nil, FileStats{}},
+		{[]int{5}, FileStats{Files: 1, Min: 5, Median: 5, Mean: 5, P90: 5, P99: 5, Max: 5}},
+		{[]int{1, 2, 3, 4, 5, 6, 7, 8, 9, 100}, FileStats{Files: 10, Min: 1, Median: 5, Mean: 14.5, P90: 9, P99: 100, Max: 100}},
+	}
+	for _, tt := range tests {
+		if got := computeFileStats(tt.counts); got != tt.want {
+			t.Errorf("computeFileStats(%v) = %+v, want %+v", tt.counts, got, tt.want)
+		}
+	}
+}
+
+func TestBuildHistogram(t *testing.T) {
+	tests := []struct {
+		counts []int
+		want   []histogramBucket
+	}{
+		{nil, nil},
+		{[]int{0, 127}, []histogramBucket{{0, 128, 2}}},
+		{[]int{5, 130, 600}, []histogramBucket{{0, 128, 1}, {128, 256, 1}, {256, 512, 0}, {512, 1024, 1}}},
+	}
+	for _, tt := range tests {
+		if got := buildHistogram(tt.counts); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("buildHistogram(%v) = %v, want %v", tt.counts, got, tt.want)
+		}
+	}
+}
+
+func TestPrintStats(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world", "b.txt": strings.Repeat("word ", 200)})
+	repo, options := scanTree(t, dir, "-model", "cl100k_base")
+	out := captureStdout(t, func() { PrintStats(repo, options) })
+	for _, want := range []string{"Statistics (tokens per file):", "Files:  2", "Min:    2", "Max:    201", "128-255 |"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("PrintStats is missing %q:\n%s", want, out)
+		}
+	}
+}
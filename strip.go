@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// stripFilters are the preprocessing steps accepted by -strip
+var stripFilters = map[string]bool{
+	"comments":            true,
+	"blank-lines":         true,
+	"trailing-whitespace": true,
+}
+
+// commentSyntax describes how comments and strings are written in a language
+type commentSyntax struct {
+	Line    []string    // Line comment markers
+	Block   [][2]string // Block comment start and end markers
+	Strings string      // Characters that delimit string literals
+}
+
+var (
+	cLikeSyntax  = commentSyntax{Line: []string{"//"}, Block: [][2]string{{"/*", "*/"}}, Strings: "\"'`"}
+	hashSyntax   = commentSyntax{Line: []string{"#"}, Strings: "\"'"}
+	dashSyntax   = commentSyntax{Line: []string{"--"}, Strings: "\"'"}
+	markupSyntax = commentSyntax{Block: [][2]string{{"<!--", "-->"}}}
+)
+
+// commentSyntaxByExt maps file extensions to their comment syntax
+var commentSyntaxByExt = map[string]commentSyntax{
+	".go": cLikeSyntax, ".c": cLikeSyntax, ".h": cLikeSyntax, ".cc": cLikeSyntax,
+	".cpp": cLikeSyntax, ".hpp": cLikeSyntax, ".cs": cLikeSyntax, ".java": cLikeSyntax,
+	".js": cLikeSyntax, ".jsx": cLikeSyntax, ".mjs": cLikeSyntax, ".ts": cLikeSyntax,
+	".tsx": cLikeSyntax, ".kt": cLikeSyntax, ".kts": cLikeSyntax, ".scala": cLikeSyntax,
+	".swift": cLikeSyntax, ".dart": cLikeSyntax, ".php": cLikeSyntax,
+	// Rust uses ' for lifetimes, so only double quotes delimit strings
+	".rs":   {Line: []string{"//"}, Block: [][2]string{{"/*", "*/"}}, Strings: "\""},
+	".css":  {Block: [][2]string{{"/*", "*/"}}, Strings: "\"'"},
+	".scss": cLikeSyntax, ".less": cLikeSyntax,
+	".py": hashSyntax, ".rb": hashSyntax, ".sh": hashSyntax, ".bash": hashSyntax,
+	".zsh": hashSyntax, ".pl": hashSyntax, ".r": hashSyntax, ".yaml": hashSyntax,
+	".yml": hashSyntax, ".toml": hashSyntax, ".ps1": hashSyntax, ".mk": hashSyntax,
+	".sql": dashSyntax, ".lua": dashSyntax, ".hs": dashSyntax,
+	".html": markupSyntax, ".htm": markupSyntax, ".xml": markupSyntax, ".svg": markupSyntax,
+	".vue": markupSyntax, ".md": markupSyntax,
+}
+
+// commentSyntaxByName maps well-known extensionless file names to their syntax
+var commentSyntaxByName = map[string]commentSyntax{
+	"Makefile": hashSyntax, "Dockerfile": hashSyntax, "Gemfile": hashSyntax, "Rakefile": hashSyntax,
+}
+
+// parseStripFilters validates the comma-separated value of -strip
+func parseStripFilters(value string) ([]string, error) {
+	filters := splitList(value)
+	for _, filter := range filters {
+		if !stripFilters[filter] {
+			return nil, fmt.Errorf("unknown strip filter %q (expected comments, blank-lines or trailing-whitespace)", filter)
+		}
+	}
+	return filters, nil
+}
+
+// stripContent applies the -strip filters to the content of the file at path
+func stripContent(path string, text string, filters []string) string {
+	for _, filter := range filters {
+		switch filter {
+		case "comments":
+			if syntax, ok := lookupCommentSyntax(path); ok {
+				text = stripComments(text, syntax)
+			}
+		case "blank-lines":
+			text = stripBlankLines(text)
+		case "trailing-whitespace":
+			text = stripTrailingWhitespace(text)
+		}
+	}
+	return text
+}
+
+// lookupCommentSyntax returns the comment syntax for a file, if known
+func lookupCommentSyntax(path string) (commentSyntax, bool) {
+	if syntax, ok := commentSyntaxByName[filepath.Base(path)]; ok {
+		return syntax, true
+	}
+	syntax, ok := commentSyntaxByExt[strings.ToLower(filepath.Ext(path))]
+	return syntax, ok
+}
+
+// stripComments removes comments from source text, leaving string literals
+// intact. Lines that held nothing but a comment are dropped entirely.
+func stripComments(text string, syntax commentSyntax) string {
+	out := make([]byte, 0, len(text))
+	lineStart := 0      // Offset in out where the current line starts
+	hadComment := false // Whether a comment was removed from the current line
+
+	endLine := func() {
+		if hadComment && strings.TrimSpace(string(out[lineStart:])) == "" {
+			// Drop the line that only held a comment
+			out = out[:lineStart]
+		} else {
+			out = append(out, '\n')
+		}
+		lineStart = len(out)
+		hadComment = false
+	}
+
+	for i := 0; i < len(text); {
+		c := text[i]
+
+		if c == '\n' {
+			endLine()
+			i++
+			continue
+		}
+
+		// String literals are copied verbatim, honoring backslash escapes
+		if strings.IndexByte(syntax.Strings, c) >= 0 {
+			end := i + 1
+			for end < len(text) && text[end] != c {
+				if text[end] == '\\' && c != '`' {
+					end++
+				} else if text[end] == '\n' && c != '`' {
+					break // Unterminated string, don't swallow the rest of the file
+				}
+				end++
+			}
+			if end < len(text) && text[end] == c {
+				end++
+			}
+			if end > len(text) {
+				end = len(text)
+			}
+			out = append(out, text[i:end]...)
+			i = end
+			continue
+		}
+
+		if marker := matchPrefix(text[i:], syntax.Line); marker != "" {
+			hadComment = true
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+			continue
+		}
+
+		if block, ok := matchBlock(text[i:], syntax.Block); ok {
+			hadComment = true
+			end := strings.Index(text[i+len(block[0]):], block[1])
+			var comment string
+			if end < 0 {
+				comment = text[i:]
+				i = len(text)
+			} else {
+				comment = text[i : i+len(block[0])+end+len(block[1])]
+				i += len(comment)
+			}
+			// Keep the line structure of multi-line block comments
+			for n := strings.Count(comment, "\n"); n > 0; n-- {
+				endLine()
+				hadComment = true
+			}
+			continue
+		}
+
+		out = append(out, c)
+		i++
+	}
+
+	if hadComment && strings.TrimSpace(string(out[lineStart:])) == "" {
+		out = out[:lineStart]
+	}
+	return string(out)
+}
+
+// matchPrefix returns the first marker that text starts with
+func matchPrefix(text string, markers []string) string {
+	for _, marker := range markers {
+		if strings.HasPrefix(text, marker) {
+			return marker
+		}
+	}
+	return ""
+}
+
+// matchBlock returns the block comment delimiters that text starts with
+func matchBlock(text string, blocks [][2]string) ([2]string, bool) {
+	for _, block := range blocks {
+		if strings.HasPrefix(text, block[0]) {
+			return block, true
+		}
+	}
+	return [2]string{}, false
+}
+
+// stripBlankLines removes lines that contain only whitespace
+func stripBlankLines(text string) string {
+	lines := strings.SplitAfter(text, "\n")
+	var out strings.Builder
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			out.WriteString(line)
+		}
+	}
+	return out.String()
+}
+
+// stripTrailingWhitespace removes spaces and tabs at the end of every line
+func stripTrailingWhitespace(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseStripFilters(t *testing.T) {
+	if got, err := parseStripFilters("comments, blank-lines"); err != nil || strings.Join(got, ",") != "comments,blank-lines" {
+		t.Errorf("parseStripFilters = %v, %v, want comments and blank-lines", got, err)
+	}
+	if _, err := parseStripFilters("comments,docstrings"); err == nil || !strings.Contains(err.Error(), `"docstrings"`) {
+		t.Errorf("parseStripFilters of an unknown filter = %v, want an error naming it", err)
+	}
+}
+
+func TestStripContent(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		text    string
+		filters []string
+		want    string
+	}{
+		{
+			name:    "go comments",
+			path:    "main.go",
+			text:    "// Package main\npackage main\n\nvar s = \"// not a comment\" /* inline */\n/*\nblock\n*/\nfunc main() {}\n",
+			filters: []string{"comments"},
+			want:    "package main\n\nvar s = \"// not a comment\" \nfunc main() {}\n",
+		},
+		{
+			name:    "python comments",
+			path:    "a.py",
+			text:    "# comment\nx = '# kept'  # trailing\n",
+			filters: []string{"comments"},
+			want:    "x = '# kept'  \n",
+		},
+		{
+			name:    "makefile by name",
+			path:    "Makefile",
+			text:    "# comment\nall:\n",
+			filters: []string{"comments"},
+			want:    "all:\n",
+		},
+		{
+			name:    "unknown syntax",
+			path:    "notes.txt",
+			text:    "# kept\n// kept\n",
+			filters: []string{"comments"},
+			want:    "# kept\n// kept\n",
+		},
+		{
+			name:    "blank lines",
+			path:    "a.txt",
+			text:    "one\n\n  \ntwo\n",
+			filters: []string{"blank-lines"},
+			want:    "one\ntwo\n",
+		},
+		{
+			name:    "trailing whitespace",
+			path:    "a.txt",
+			text:    "one  \ntwo\t\r\n",
+			filters: []string{"trailing-whitespace"},
+			want:    "one\ntwo\n",
+		},
+		{
+			name:    "all filters",
+			path:    "a.js",
+			text:    "let a = 1; // one  \n\n\nlet b = 2;\n",
+			filters: []string{"comments", "trailing-whitespace", "blank-lines"},
+			want:    "let a = 1;\nlet b = 2;\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripContent(tt.path, tt.text, tt.filters); got != tt.want {
+				t.Errorf("stripContent = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStrippedScan(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"main.go": "// a long comment that takes up some tokens\npackage main\n"})
+	repo, _ := scanTree(t, dir, "-model", "cl100k_base", "-strip", "comments")
+	if repo.StrippedTokenCount == 0 || repo.StrippedTokenCount >= repo.TokenCount {
+		t.Errorf("stripped %d of %d tokens, want fewer but some", repo.StrippedTokenCount, repo.TokenCount)
+	}
+}
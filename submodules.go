@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	gitignore "github.com/sabhiram/go-gitignore"
+)
+
+// SubmoduleInfo stores the subtotal for a git submodule (or any nested
+// repository) found below the scan root
+type SubmoduleInfo struct {
+	Path       string
+	TokenCount int
+	Files      int
+	Skipped    bool // Not descended into because of -submodules=false
+}
+
+// submodule is a submodule found during a scan, with the ignore rules that
+// apply inside it in place of the parent repository's
+type submodule struct {
+	info    *SubmoduleInfo
+	ignorer *gitignore.GitIgnore
+}
+
+// submodules holds the submodules found during a scan, keyed by directory
+type submodules map[string]*submodule
+
+// isSubmodule reports whether dir is the root of a nested git repository.
+// Submodules have a .git file pointing into the parent's .git/modules, and
+// plain nested clones have a .git directory; either marks a submodule.
+func isSubmodule(dir string) bool {
+	_, err := os.Lstat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// innermost returns the closest submodule containing path, not counting path
+// itself, or nil if path belongs to the scanned repository
+func (s submodules) innermost(rootPath string, path string) (string, *submodule) {
+	rootPath = filepath.Clean(rootPath)
+	if len(s) == 0 {
+		return "", nil
+	}
+	for dir := filepath.Dir(path); dir != rootPath && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if sub, ok := s[dir]; ok {
+			return dir, sub
+		}
+	}
+	return "", nil
+}
+
+// addFile adds a counted file to the subtotal of every submodule containing
+// it, so a submodule's subtotal includes any submodules nested inside it
+func (s submodules) addFile(rootPath string, fileInfo *FileTokenInfo) {
+	rootPath = filepath.Clean(rootPath)
+	if len(s) == 0 {
+		return
+	}
+	for dir := filepath.Dir(fileInfo.Path); dir != rootPath && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if sub, ok := s[dir]; ok {
+			sub.info.TokenCount += fileInfo.TokenCount
+			sub.info.Files++
+		}
+	}
+}
+
+// printSubmodules prints the subtotal of each submodule, sorted by path
+func printSubmodules(repo *RepoTokenInfo, options *CommandOptions) {
+	subs := append([]*SubmoduleInfo(nil), repo.Submodules...)
+	sort.Slice(subs, func(i, j int) bool {
+		return subs[i].Path < subs[j].Path
+	})
+
+	fmt.Println("Submodules:")
+	fmt.Println("-----------")
+	for _, sub := range subs {
+		relativePath := relativeTo(repo.Path, sub.Path)
+		if sub.Skipped {
+			fmt.Printf("%s (skipped)\n", relativePath)
+			continue
+		}
+		fmt.Printf("%s: %d %s (%d files)\n", relativePath, sub.TokenCount, options.unitName(), sub.Files)
+	}
+	fmt.Println()
+}
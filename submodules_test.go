@@ -0,0 +1,59 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSubmodules(t *testing.T) {
+	files := map[string]string{
+		".gitignore":           "*.gen\n",
+		"a.txt":                "hello world",
+		"x.gen":                "ignored by the parent",
+		"lib/.git":             "gitdir: ../.git/modules/lib\n",
+		"lib/.gitignore":       "*.tmp\n",
+		"lib/b.txt":            "x",
+		"lib/y.gen":            "the parent's rules don't apply here",
+		"lib/z.tmp":            "ignored by the submodule",
+		"lib/nested/.git/HEAD": "ref: refs/heads/main\n",
+		"lib/nested/c.txt":     "one two",
+	}
+	tests := []struct {
+		name string
+		args []string
+		want []string
+		subs map[string]string
+	}{
+		{
+			name: "descended into",
+			want: []string{"a.txt", "lib/b.txt", "lib/nested/c.txt", "lib/y.gen"},
+			subs: map[string]string{"lib": "lib: 11 tokens (3 files)", "lib/nested": "lib/nested: 2 tokens (1 files)"},
+		},
+		{
+			name: "skipped",
+			args: []string{"-submodules=false"},
+			want: []string{"a.txt"},
+			subs: map[string]string{"lib": "lib (skipped)"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, files)
+			repo, options := scanTree(t, dir, append([]string{"-model", "cl100k_base"}, tt.args...)...)
+			if got := countedPaths(dir, repo); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("counted %v, want %v", got, tt.want)
+			}
+			if len(repo.Submodules) != len(tt.subs) {
+				t.Errorf("submodules %+v, want %v", repo.Submodules, tt.subs)
+			}
+			out := captureStdout(t, func() { printSubmodules(repo, options) })
+			for _, line := range tt.subs {
+				if !strings.Contains(out, line+"\n") {
+					t.Errorf("printSubmodules is missing %q:\n%s", line, out)
+				}
+			}
+		})
+	}
+}
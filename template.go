@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs are the functions a -template can call, besides text/template's
+// own
+var templateFuncs = template.FuncMap{
+	"count": formatCount,
+	"percent": func(part int, total int) string {
+		return fmt.Sprintf("%.1f%%", percentOf(part, total))
+	},
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"join":  strings.Join,
+	"base":  filepath.Base,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"pad": func(width int, s string) string {
+		return fmt.Sprintf("%-*s", width, s)
+	},
+	"padLeft": func(width int, s string) string {
+		return fmt.Sprintf("%*s", width, s)
+	},
+}
+
+// loadTemplate parses the -template file before the scan starts, so a
+// mistake in it doesn't waste one, and selects it as the output format
+func loadTemplate(options *CommandOptions) error {
+	if options.Template == "" {
+		return nil
+	}
+	if options.Format != "text" {
+		return fmt.Errorf("-template can't be used with -format %s", options.Format)
+	}
+	text, err := os.ReadFile(options.Template)
+	if err != nil {
+		return err
+	}
+	tmpl, err := template.New(filepath.Base(options.Template)).Funcs(templateFuncs).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return err
+	}
+	options.template = tmpl
+	options.Format = "template"
+	return nil
+}
+
+// WriteTemplate renders the scan's ScanResult, the structure -format json
+// writes, through the -template
+func WriteTemplate(w io.Writer, repo *RepoTokenInfo, options *CommandOptions) error {
+	return options.template.Execute(w, newScanResult(repo, options))
+}
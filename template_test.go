@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadTemplate(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"ok.tmpl":     "{{.Total}}",
+		"broken.tmpl": "{{.Total",
+	})
+	tests := []struct {
+		name     string
+		template string
+		format   string
+		want     string // Error, or the format the options end up with
+	}{
+		{"none", "", "text", "text"},
+		{"selects itself", filepath.Join(dir, "ok.tmpl"), "text", "template"},
+		{"with -format", filepath.Join(dir, "ok.tmpl"), "json", "-template can't be used with -format json"},
+		{"missing", filepath.Join(dir, "missing.tmpl"), "text", "no such file or directory"},
+		{"parse error", filepath.Join(dir, "broken.tmpl"), "text", "unclosed action"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options := &CommandOptions{Template: tt.template, Format: tt.format}
+			err := loadTemplate(options)
+			got := options.Format
+			if err != nil {
+				got = err.Error()
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("loadTemplate = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteTemplate(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"docs/a.txt": "hello world", "sub/b.txt": "one two three"})
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  string
+	}{
+		{"fields", "{{.Total}} {{len .Directories}}", "5 2", ""},
+		{"functions", `{{range .Directories}}{{pad 5 (base .Path)}}|{{padLeft 3 (count .Total)}}|{{percent .Total $.Total}}{{"\n"}}{{end}}`,
+			"sub  |  3|60.0%\ndocs |  2|40.0%\n", ""},
+		{"json", "{{json .ModelTotals}}", "null", ""},
+		{"missing field", "{{.Tokens}}", "", "can't evaluate field Tokens"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "report.tmpl")
+			writeTree(t, filepath.Dir(file), map[string]string{"report.tmpl": tt.template})
+			repo, options := scanTree(t, dir, "-model", "cl100k_base")
+			options.Template = file
+			if err := loadTemplate(options); err != nil {
+				t.Fatal(err)
+			}
+			var out bytes.Buffer
+			err := WriteTemplate(&out, repo, options)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("WriteTemplate error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("WriteTemplate wrote %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Exit statuses of a scan that found files over -warn-file-tokens or
+// -crit-file-tokens, so scripts can tell the tiers apart
+const (
+	exitWarnTier = 3
+	exitCritTier = 4
+)
+
+// Tiers of a file's count relative to -warn-file-tokens and -crit-file-tokens
+const (
+	tierNone = iota
+	tierWarn
+	tierCrit
+)
+
+// validateTiers checks that -crit-file-tokens, if set with -warn-file-tokens,
+// is the higher of the two
+func validateTiers(options *CommandOptions) error {
+	if options.WarnFileTokens < 0 || options.CritFileTokens < 0 {
+		return fmt.Errorf("-warn-file-tokens and -crit-file-tokens can't be negative")
+	}
+	if options.WarnFileTokens > 0 && options.CritFileTokens > 0 && options.CritFileTokens <= options.WarnFileTokens {
+		return fmt.Errorf("-crit-file-tokens (%d) must be above -warn-file-tokens (%d)", options.CritFileTokens, options.WarnFileTokens)
+	}
+	return nil
+}
+
+// hasTiers reports whether either threshold is set
+func (o *CommandOptions) hasTiers() bool {
+	return o.WarnFileTokens > 0 || o.CritFileTokens > 0
+}
+
+// fileTier returns the tier of a file with count tokens
+func (o *CommandOptions) fileTier(count int) int {
+	switch {
+	case o.CritFileTokens > 0 && count > o.CritFileTokens:
+		return tierCrit
+	case o.WarnFileTokens > 0 && count > o.WarnFileTokens:
+		return tierWarn
+	}
+	return tierNone
+}
+
+// fileColor picks the line color for a file. With thresholds set, files over
+// -crit-file-tokens are red, files over -warn-file-tokens yellow and the rest
+// plain; otherwise the color follows the file's share of the total.
+func (o *CommandOptions) fileColor(count int, total int) string {
+	if !o.hasTiers() {
+		return shareColor(count, total)
+	}
+	switch o.fileTier(count) {
+	case tierCrit:
+		return ansiRed
+	case tierWarn:
+		return ansiYellow
+	}
+	return ansiPlain
+}
+
+// countTiers returns the number of files over each threshold. Files over
+// -crit-file-tokens are also over -warn-file-tokens, so they count in both.
+func countTiers(repo *RepoTokenInfo, options *CommandOptions) (warn int, crit int) {
+	for _, dirInfo := range repo.Dirs {
+		for _, fileInfo := range dirInfo.Files {
+			switch options.fileTier(fileInfo.TokenCount) {
+			case tierCrit:
+				crit++
+				if options.WarnFileTokens > 0 {
+					warn++
+				}
+			case tierWarn:
+				warn++
+			}
+		}
+	}
+	return warn, crit
+}
+
+// printTierSummary prints how many files are over the thresholds, e.g.
+// "12 files over warn (8,000 tokens), 2 over critical (32,000 tokens)"
+func printTierSummary(repo *RepoTokenInfo, options *CommandOptions) {
+	warn, crit := countTiers(repo, options)
+	unit := options.unitName()
+	var parts []string
+	if options.WarnFileTokens > 0 {
+		parts = append(parts, options.paint(tierSummaryColor(warn, ansiYellow), fmt.Sprintf("%s over warn (%s %s)", tierCount(warn, len(parts) == 0), formatCount(options.WarnFileTokens), unit)))
+	}
+	if options.CritFileTokens > 0 {
+		parts = append(parts, options.paint(tierSummaryColor(crit, ansiRed), fmt.Sprintf("%s over critical (%s %s)", tierCount(crit, len(parts) == 0), formatCount(options.CritFileTokens), unit)))
+	}
+	fmt.Println(strings.Join(parts, ", "))
+}
+
+// tierCount formats a count of the tier summary; the first one names what's
+// counted, as in "12 files over warn, 2 over critical"
+func tierCount(count int, first bool) string {
+	switch {
+	case !first:
+		return strconv.Itoa(count)
+	case count == 1:
+		return "1 file"
+	}
+	return fmt.Sprintf("%d files", count)
+}
+
+// tierSummaryColor highlights a count of the tier summary if it isn't zero
+func tierSummaryColor(count int, code string) string {
+	if count == 0 {
+		return ansiPlain
+	}
+	return code
+}
+
+// tierExitCode returns the exit status for the files over the thresholds:
+// exitCritTier if any file is over -crit-file-tokens, exitWarnTier if any is
+// over -warn-file-tokens, and 0 otherwise
+func tierExitCode(repo *RepoTokenInfo, options *CommandOptions) int {
+	warn, crit := countTiers(repo, options)
+	switch {
+	case crit > 0:
+		return exitCritTier
+	case warn > 0:
+		return exitWarnTier
+	}
+	return 0
+}
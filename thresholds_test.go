@@ -0,0 +1,113 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateTiers(t *testing.T) {
+	tests := []struct {
+		warn, crit int
+		want       string
+	}{
+		{0, 0, ""},
+		{100, 0, ""},
+		{0, 100, ""},
+		{100, 200, ""},
+		{200, 100, "-crit-file-tokens (100) must be above -warn-file-tokens (200)"},
+		{100, 100, "-crit-file-tokens (100) must be above -warn-file-tokens (100)"},
+		{-1, 0, "can't be negative"},
+	}
+	for _, tt := range tests {
+		err := validateTiers(&CommandOptions{WarnFileTokens: tt.warn, CritFileTokens: tt.crit})
+		if tt.want == "" && err != nil || tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+			t.Errorf("validateTiers(warn %d, crit %d) = %v, want %q", tt.warn, tt.crit, err, tt.want)
+		}
+	}
+}
+
+func TestFileTiers(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"small.txt":  "one",
+		"medium.txt": strings.Repeat("word ", 20),
+		"large.txt":  strings.Repeat("word ", 60),
+	})
+
+	tests := []struct {
+		name      string
+		args      []string
+		warn      int
+		crit      int
+		code      int
+		summary   string
+		largeTier int
+	}{
+		{"under both", []string{"-warn-file-tokens", "1000", "-crit-file-tokens", "2000"}, 0, 0, 0, "0 files over warn (1,000 tokens), 0 over critical (2,000 tokens)", tierNone},
+		{"over warn", []string{"-warn-file-tokens", "10", "-crit-file-tokens", "1000"}, 2, 0, exitWarnTier, "2 files over warn (10 tokens), 0 over critical (1,000 tokens)", tierWarn},
+		{"over critical", []string{"-warn-file-tokens", "10", "-crit-file-tokens", "40"}, 2, 1, exitCritTier, "2 files over warn (10 tokens), 1 over critical (40 tokens)", tierCrit},
+		{"critical alone", []string{"-crit-file-tokens", "40"}, 0, 1, exitCritTier, "1 file over critical (40 tokens)", tierCrit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, options := scanTree(t, dir, append([]string{"-model", "cl100k_base"}, tt.args...)...)
+			if warn, crit := countTiers(repo, options); warn != tt.warn || crit != tt.crit {
+				t.Errorf("countTiers = %d, %d, want %d, %d", warn, crit, tt.warn, tt.crit)
+			}
+			if code := tierExitCode(repo, options); code != tt.code {
+				t.Errorf("tierExitCode = %d, want %d", code, tt.code)
+			}
+			if out := captureStdout(t, func() { printTierSummary(repo, options) }); out != tt.summary+"\n" {
+				t.Errorf("summary %q, want %q", out, tt.summary)
+			}
+			if tier := options.fileTier(60); tier != tt.largeTier {
+				t.Errorf("tier of 60 tokens = %d, want %d", tier, tt.largeTier)
+			}
+		})
+	}
+}
+
+func TestFileColor(t *testing.T) {
+	options := &CommandOptions{WarnFileTokens: 10, CritFileTokens: 20}
+	tests := []struct {
+		count int
+		want  string
+	}{
+		{5, ansiPlain},
+		{15, ansiYellow},
+		{25, ansiRed},
+	}
+	for _, tt := range tests {
+		if got := options.fileColor(tt.count, 100); got != tt.want {
+			t.Errorf("fileColor(%d) = %q, want %q", tt.count, got, tt.want)
+		}
+	}
+	if got, want := (&CommandOptions{}).fileColor(90, 100), shareColor(90, 100); got != want {
+		t.Errorf("fileColor without tiers = %q, want the share color %q", got, want)
+	}
+}
+
+func TestScanTierExit(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"large.txt": strings.Repeat("word ", 60)})
+	tests := []struct {
+		name string
+		args []string
+		code int
+		want string
+	}{
+		{"warn", []string{"-warn-file-tokens", "10"}, exitWarnTier, ""},
+		{"critical", []string{"-warn-file-tokens", "10", "-crit-file-tokens", "20"}, exitCritTier, ""},
+		{"crit below warn", []string{"-warn-file-tokens", "20", "-crit-file-tokens", "10"}, 1, "Error: -crit-file-tokens (10) must be above -warn-file-tokens (20)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderr, code := exitStatus(t, func() {
+				findCommand("scan").run(append([]string{"-model", "cl100k_base", "-quiet"}, append(tt.args, dir)...))
+			})
+			if code != tt.code || !strings.Contains(stderr, tt.want) {
+				t.Errorf("exit %d, want %d, stderr:\n%s", code, tt.code, stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+// Package tokenizers defines the interface token-counter counts tokens with,
+// and the registry -model and -models look models up in. The built-in
+// tokenizers register themselves here, and a Go program built with
+// token-counter can register its own, such as a company-internal model, to
+// count with it in every command without changing the scanning or reporting
+// code.
+package tokenizers
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Tokenizer counts the tokens of text for one model. Implementations must be
+// safe for concurrent use, since files are counted in parallel when counting
+// with an API.
+type Tokenizer interface {
+	// Count returns the number of tokens in text
+	Count(text string) (int, error)
+	// Name returns the name of the model or tokenizer
+	Name() string
+}
+
+// Factory returns the tokenizer for a model name it was registered for. It's
+// called once per name and command, so it may load vocabularies or check
+// credentials.
+type Factory func(model string) (Tokenizer, error)
+
+// matcher is a factory for every model name match accepts
+type matcher struct {
+	match   func(model string) bool
+	factory Factory
+}
+
+var (
+	mu       sync.RWMutex
+	names    = make(map[string]Factory)
+	matchers []matcher
+)
+
+// Register makes a tokenizer available as the model called name. It panics
+// if name is empty, factory is nil or name is already registered, so
+// conflicting registrations are found at startup.
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if name == "" || factory == nil {
+		panic("tokenizers: Register needs a name and a factory")
+	}
+	if _, exists := names[name]; exists {
+		panic(fmt.Sprintf("tokenizers: %q is already registered", name))
+	}
+	names[name] = factory
+}
+
+// RegisterMatch makes a tokenizer available for every model name match
+// accepts, such as the names with a prefix, e.g. ollama:llama3.1. Exact names
+// from Register take precedence, and matchers are tried in the order they
+// were registered.
+func RegisterMatch(match func(model string) bool, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	if match == nil || factory == nil {
+		panic("tokenizers: RegisterMatch needs a matcher and a factory")
+	}
+	matchers = append(matchers, matcher{match, factory})
+}
+
+// New returns the tokenizer for a model name
+func New(model string) (Tokenizer, error) {
+	factory := lookup(model)
+	if factory == nil {
+		return nil, fmt.Errorf("unknown model %q", model)
+	}
+	return factory(model)
+}
+
+// Registered reports whether a tokenizer is registered for a model name
+func Registered(model string) bool {
+	return lookup(model) != nil
+}
+
+// Names returns the names registered with Register, sorted
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	list := make([]string, 0, len(names))
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// lookup returns the factory for a model name, or nil if there's none
+func lookup(model string) Factory {
+	mu.RLock()
+	defer mu.RUnlock()
+	if factory, ok := names[model]; ok {
+		return factory
+	}
+	for _, m := range matchers {
+		if m.match(model) {
+			return m.factory
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package tokenizers
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// words counts whitespace-separated words, standing in for a real tokenizer
+type words string
+
+func (w words) Count(text string) (int, error) { return len(strings.Fields(text)), nil }
+func (w words) Name() string                   { return string(w) }
+
+func TestRegistry(t *testing.T) {
+	Register("test-words", func(model string) (Tokenizer, error) { return words(model), nil })
+	Register("test-broken", func(model string) (Tokenizer, error) { return nil, errors.New("no vocabulary") })
+	RegisterMatch(func(model string) bool { return strings.HasPrefix(model, "test-prefix:") }, func(model string) (Tokenizer, error) {
+		return words(model), nil
+	})
+	// An exact name wins over a matcher that accepts it too
+	RegisterMatch(func(model string) bool { return model == "test-words" }, func(model string) (Tokenizer, error) {
+		return nil, errors.New("matcher used over the exact name")
+	})
+
+	tests := []struct {
+		model   string
+		name    string
+		wantErr string
+	}{
+		{"test-words", "test-words", ""},
+		{"test-prefix:llama", "test-prefix:llama", ""},
+		{"test-broken", "", "no vocabulary"},
+		{"test-unknown", "", `unknown model "test-unknown"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			tok, err := New(tt.model)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("New(%q) error %v, want %q", tt.model, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n, _ := tok.Count("one two three"); tok.Name() != tt.name || n != 3 {
+				t.Errorf("New(%q) = %q counting %d", tt.model, tok.Name(), n)
+			}
+		})
+	}
+
+	if !Registered("test-prefix:x") || Registered("test-unknown") {
+		t.Error("Registered doesn't follow the registry")
+	}
+	if names := Names(); !slices.IsSorted(names) || !slices.Contains(names, "test-words") || slices.Contains(names, "test-prefix:llama") {
+		t.Errorf("Names() = %v", names)
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	Register("test-twice", func(string) (Tokenizer, error) { return words(""), nil })
+	tests := []struct {
+		name     string
+		register func()
+	}{
+		{"repeated name", func() { Register("test-twice", func(string) (Tokenizer, error) { return words(""), nil }) }},
+		{"empty name", func() { Register("", func(string) (Tokenizer, error) { return words(""), nil }) }},
+		{"nil factory", func() { Register("test-nil", nil) }},
+		{"nil matcher", func() { RegisterMatch(nil, func(string) (Tokenizer, error) { return words(""), nil }) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("no panic")
+				}
+			}()
+			tt.register()
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// treeNode is a directory or file in the tree rendering of a scan, with
+// directory token counts including everything below them
+type treeNode struct {
+	Name       string
+	TokenCount int
+	Files      int
+	IsDir      bool
+	Children   map[string]*treeNode
+}
+
+// buildTree arranges the files of a scan into a tree rooted at the scan path
+func buildTree(repo *RepoTokenInfo) *treeNode {
+	root := &treeNode{Name: repo.Path, IsDir: true, Children: make(map[string]*treeNode)}
+
+	for _, dirInfo := range repo.Dirs {
+		for _, fileInfo := range dirInfo.Files {
+			relativePath, err := filepath.Rel(repo.Path, fileInfo.Path)
+			if err != nil {
+				relativePath = fileInfo.Path
+			}
+
+			node := root
+			node.TokenCount += fileInfo.TokenCount
+			node.Files++
+			parts := strings.Split(filepath.ToSlash(relativePath), "/")
+			for i, part := range parts {
+				child, exists := node.Children[part]
+				if !exists {
+					child = &treeNode{Name: part, IsDir: i < len(parts)-1, Children: make(map[string]*treeNode)}
+					node.Children[part] = child
+				}
+				child.TokenCount += fileInfo.TokenCount
+				child.Files++
+				node = child
+			}
+		}
+	}
+	return root
+}
+
+// PrintTree prints the scan as an indented tree, like the tree command, with
+// token counts and a bar showing each node's share of the total
+func PrintTree(repo *RepoTokenInfo, options *CommandOptions) {
+	root := buildTree(repo)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s%s\t%10s %s\t%6.1f%%\t%s%s\n", treeColor(options, ansiBold), root.Name, formatCount(root.TokenCount), options.unitName(), 100.0, percentageBar(100, 20), treeColor(options, ansiReset))
+	if !options.IsSingleFile {
+		printTreeChildren(w, root, "", repo.TokenCount, options)
+	}
+	w.Flush()
+	if summary := belowMinSummary(repo, options); summary != "" {
+		fmt.Println()
+		fmt.Println(options.paint(ansiDim, summary))
+	}
+}
+
+// printTreeChildren prints the children of node in -sort order, largest
+// first by default. Directories below -min-dir-tokens are collapsed into a
+// single row after the others.
+func printTreeChildren(w *tabwriter.Writer, node *treeNode, prefix string, total int, options *CommandOptions) {
+	var children []*treeNode
+	collapsed := &treeNode{}
+	for _, child := range node.Children {
+		switch {
+		case child.IsDir && child.TokenCount < options.MinDirTokens:
+			collapsed.Files++
+			collapsed.TokenCount += child.TokenCount
+		case child.IsDir || options.ShowFiles:
+			children = append(children, child)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return options.entryLess(children[i].Name, children[j].Name, children[i].TokenCount, children[j].TokenCount, children[i].Files, children[j].Files)
+	})
+	if collapsed.Files > 0 {
+		collapsed.Name = fmt.Sprintf("(%d smaller directories)", collapsed.Files)
+		children = append(children, collapsed)
+	}
+
+	for i, child := range children {
+		branch, indent := "├── ", "│   "
+		if i == len(children)-1 {
+			branch, indent = "└── ", "    "
+		}
+
+		name := child.Name
+		if child.IsDir {
+			name += "/"
+		}
+		percentage := 0.0
+		if total > 0 {
+			percentage = float64(child.TokenCount) * 100 / float64(total)
+		}
+		color := shareColor(child.TokenCount, total)
+		if !child.IsDir {
+			color = options.fileColor(child.TokenCount, total)
+		}
+		fmt.Fprintf(w, "%s%s%s%s\t%10s %s\t%6.1f%%\t%s%s\n", treeColor(options, color), prefix, branch, name,
+			formatCount(child.TokenCount), options.unitName(), percentage, percentageBar(percentage, 20), treeColor(options, ansiReset))
+
+		if child.IsDir {
+			printTreeChildren(w, child, prefix+indent, total, options)
+		}
+	}
+}
+
+// treeColor returns the escape sequence starting or ending a tree row, if
+// colors are enabled. Every row starts with a sequence of the same length
+// (ansiBold is padded to match), so tabwriter keeps the columns aligned.
+func treeColor(options *CommandOptions, code string) string {
+	if !options.useColor() {
+		return ""
+	}
+	if code == ansiBold {
+		return "\x1b[01m"
+	}
+	return code
+}
+
+// percentageBar renders a percentage as a bar of the given width, using
+// partial block characters for eighths of a cell
+func percentageBar(percentage float64, width int) string {
+	eighths := int(percentage / 100 * float64(width*8))
+	bar := strings.Repeat("█", eighths/8)
+	if partial := eighths % 8; partial > 0 {
+		bar += string([]rune("▏▎▍▌▋▊▉")[partial-1])
+	}
+	return bar
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildTree(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world", "src/b.txt": "x", "src/lib/c.txt": "one two"})
+	repo, options := scanTree(t, dir, "-model", "cl100k_base")
+
+	root := buildTree(repo)
+	if root.TokenCount != repo.TokenCount || root.Files != 3 {
+		t.Errorf("root has %d tokens in %d files, want %d in 3", root.TokenCount, root.Files, repo.TokenCount)
+	}
+	src := root.Children["src"]
+	if src == nil || !src.IsDir || src.Files != 2 || src.TokenCount != 3 {
+		t.Fatalf("src = %+v, want a directory of 2 files and 3 tokens", src)
+	}
+	if lib := src.Children["lib"]; lib == nil || lib.Children["c.txt"] == nil || lib.Children["c.txt"].IsDir {
+		t.Errorf("src/lib = %+v, want a directory holding the file c.txt", lib)
+	}
+
+	out := captureStdout(t, func() { PrintTree(repo, options) })
+	lines := strings.Split(out, "\n")
+	// Children are listed largest first
+	if len(lines) < 4 || !strings.Contains(lines[1], "src") || !strings.Contains(lines[len(lines)-2], "a.txt") {
+		t.Errorf("PrintTree printed:\n%s", out)
+	}
+}
+
+func TestPercentageBar(t *testing.T) {
+	tests := []struct {
+		percentage float64
+		width      int
+		want       string
+	}{
+		{0, 10, ""},
+		{100, 4, "████"},
+		{50, 4, "██"},
+		{12.5, 2, "▎"},
+		{60, 1, "▌"},
+	}
+	for _, tt := range tests {
+		if got := percentageBar(tt.percentage, tt.width); got != tt.want {
+			t.Errorf("percentageBar(%v, %d) = %q, want %q", tt.percentage, tt.width, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// TruncationPoint is where cutting a file down to its first or last
+// -head-tokens or -tail-tokens would land
+type TruncationPoint struct {
+	Bytes int `json:"bytes"` // Bytes kept
+	Line  int `json:"line"`  // Line the cut lands on: the last line kept of a head, the first of a tail
+}
+
+// validateTruncation checks -head-tokens and -tail-tokens. Finding a cut
+// takes a count per step of the search, too many to make over a counting API.
+func validateTruncation(options *CommandOptions) error {
+	if options.HeadTokens < 0 || options.TailTokens < 0 {
+		return fmt.Errorf("-head-tokens and -tail-tokens can't be negative")
+	}
+	if options.HeadTokens == 0 && options.TailTokens == 0 || options.unitName() != "tokens" {
+		return nil
+	}
+	codec, err := newCodec(options)
+	if err != nil {
+		return err
+	}
+	if _, ok := codec.(*apiCounter); ok {
+		return fmt.Errorf("-head-tokens and -tail-tokens need a local tokenizer, not the %s counting API", options.modelName())
+	}
+	return nil
+}
+
+// truncationPoint finds the longest prefix of text, or suffix if fromEnd is
+// set, with at most n units, by binary search over its length. Cuts are only
+// made between characters, and a text with n units or fewer is kept whole.
+func truncationPoint(text string, total int, n int, enc namedCodec, mode string, fromEnd bool) (*TruncationPoint, error) {
+	piece := func(size int) string {
+		if fromEnd {
+			start := len(text) - size
+			for start < len(text) && !utf8.RuneStart(text[start]) {
+				start++
+			}
+			return text[start:]
+		}
+		for size > 0 && size < len(text) && !utf8.RuneStart(text[size]) {
+			size--
+		}
+		return text[:size]
+	}
+
+	kept := text
+	if total > n {
+		// count(piece(lo)) <= n throughout
+		lo, hi := 0, len(text)
+		for lo < hi {
+			mid := lo + (hi-lo+1)/2
+			count, err := countUnits(piece(mid), enc, mode)
+			if err != nil {
+				return nil, err
+			}
+			if count <= n {
+				lo = mid
+			} else {
+				hi = mid - 1
+			}
+		}
+		kept = piece(lo)
+	}
+
+	point := &TruncationPoint{Bytes: len(kept), Line: countLines([]byte(kept))}
+	if fromEnd && kept != "" {
+		point.Line = countLines([]byte(text)) - point.Line + 1
+	}
+	return point, nil
+}
+
+// truncationSuffix describes where -head-tokens and -tail-tokens would cut a
+// file for the text report, e.g. ", first 1,000 tokens end on line 120
+// (3,912 bytes)"
+func truncationSuffix(options *CommandOptions, fileInfo *FileTokenInfo) string {
+	var parts []string
+	if fileInfo.Head != nil {
+		parts = append(parts, fmt.Sprintf("first %s %s end on line %s (%s bytes)", formatCount(options.HeadTokens), options.unitName(), formatCount(fileInfo.Head.Line), formatCount(fileInfo.Head.Bytes)))
+	}
+	if fileInfo.Tail != nil {
+		parts = append(parts, fmt.Sprintf("last %s %s start on line %s (%s bytes)", formatCount(options.TailTokens), options.unitName(), formatCount(fileInfo.Tail.Line), formatCount(fileInfo.Tail.Bytes)))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return ", " + strings.Join(parts, ", ")
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTruncationPoint(t *testing.T) {
+	const text = "one two three\nfour five\nsix\n"
+	tests := []struct {
+		name    string
+		text    string
+		n       int
+		fromEnd bool
+		want    TruncationPoint
+	}{
+		{"head", text, 4, false, TruncationPoint{Bytes: 19, Line: 2}},
+		{"tail", text, 2, true, TruncationPoint{Bytes: 10, Line: 2}},
+		{"head of a short file", text, 10, false, TruncationPoint{Bytes: len(text), Line: 3}},
+		{"tail of a short file", text, 10, true, TruncationPoint{Bytes: len(text), Line: 1}},
+		{"multibyte characters", "日本語", 2, false, TruncationPoint{Bytes: 6, Line: 1}},
+		{"multibyte tail", "日本語", 1, true, TruncationPoint{Bytes: 3, Line: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			total, _ := countUnits(tt.text, namedCodec{}, "words")
+			got, err := truncationPoint(tt.text, total, tt.n, namedCodec{}, "words", tt.fromEnd)
+			if err != nil || *got != tt.want {
+				t.Errorf("truncationPoint = %+v, %v, want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestScanTruncation(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": strings.Repeat("word\n", 100)})
+	options := testOptions(t, "-model", "cl100k_base", "-count-mode", "words")
+	options.HeadTokens, options.TailTokens = 10, 5
+	repo, err := ProcessRepository(t.Context(), dir, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileInfo := repo.Dirs[dir].Files[0]
+	if fileInfo.Head == nil || *fileInfo.Head != (TruncationPoint{Bytes: 50, Line: 10}) {
+		t.Errorf("head %+v", fileInfo.Head)
+	}
+	if fileInfo.Tail == nil || *fileInfo.Tail != (TruncationPoint{Bytes: 26, Line: 95}) {
+		t.Errorf("tail %+v", fileInfo.Tail)
+	}
+	want := ", first 10 words end on line 10 (50 bytes), last 5 words start on line 95 (26 bytes)"
+	if got := truncationSuffix(options, fileInfo); got != want {
+		t.Errorf("suffix %q, want %q", got, want)
+	}
+}
+
+func TestValidateTruncation(t *testing.T) {
+	tests := []struct {
+		name       string
+		head, tail int
+		model      string
+		want       string
+	}{
+		{"unset", 0, 0, "cl100k_base", ""},
+		{"local tokenizer", 100, 50, "cl100k_base", ""},
+		{"negative", -1, 0, "cl100k_base", "-head-tokens and -tail-tokens can't be negative"},
+		{"counting API", 100, 0, "claude-sonnet-4-5", "need a local tokenizer, not the claude-sonnet-4-5 counting API"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ANTHROPIC_API_KEY", "test")
+			options := testOptions(t, "-model", tt.model)
+			options.HeadTokens, options.TailTokens = tt.head, tt.tail
+			err := validateTruncation(options)
+			if tt.want == "" && err != nil || tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+				t.Errorf("validateTruncation = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"token-counter/counter"
+)
+
+// countModes are the units -count-mode can report
+var countModes = map[string]bool{
+	"tokens": true,
+	"words":  true,
+	"chars":  true,
+	"bytes":  true,
+}
+
+// parseCountMode validates the value of -count-mode
+func parseCountMode(value string) (string, error) {
+	if !countModes[value] {
+		return "", fmt.Errorf("unknown count mode %q (expected tokens, words, chars or bytes)", value)
+	}
+	return value, nil
+}
+
+// parseByteSize parses a size in bytes, optionally with a K, M or G suffix
+// (powers of 1024, with or without a trailing B)
+func parseByteSize(value string) (int64, error) {
+	number := strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(value)), "B")
+	multiplier := int64(1)
+	switch {
+	case strings.HasSuffix(number, "K"):
+		multiplier = 1 << 10
+	case strings.HasSuffix(number, "M"):
+		multiplier = 1 << 20
+	case strings.HasSuffix(number, "G"):
+		multiplier = 1 << 30
+	}
+	if multiplier > 1 {
+		number = number[:len(number)-1]
+	}
+	size, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size %q (expected bytes, e.g. 500000 or 10M)", value)
+	}
+	return size * multiplier, nil
+}
+
+// tooLarge reports whether a file is above -max-file-bytes
+func (o *CommandOptions) tooLarge(info os.FileInfo) bool {
+	return o.MaxFileBytes > 0 && info.Size() > o.MaxFileBytes
+}
+
+// unitName returns the name of the unit being counted, for use in reports
+func (o *CommandOptions) unitName() string {
+	if o.CountMode == "" {
+		return "tokens"
+	}
+	return o.CountMode
+}
+
+// modelName returns the name of the model or tokenizer files counting tokens,
+// for use in reports
+func (o *CommandOptions) modelName() string {
+	if o.BPEVocab != "" {
+		return filepath.Base(o.BPEVocab)
+	}
+	if o.TokenizerFile != "" {
+		return filepath.Base(o.TokenizerFile)
+	}
+	return o.Model
+}
+
+// countUnits counts text in the unit selected by -count-mode, using enc when
+// counting tokens
+func countUnits(text string, enc namedCodec, mode string) (int, error) {
+	return counter.CountUnits(text, enc.Codec, mode)
+}
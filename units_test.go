@@ -0,0 +1,67 @@
+package main
+
+import "testing"
+
+func TestParseCountMode(t *testing.T) {
+	for _, mode := range []string{"tokens", "words", "chars", "bytes"} {
+		if got, err := parseCountMode(mode); err != nil || got != mode {
+			t.Errorf("parseCountMode(%q) = %q, %v", mode, got, err)
+		}
+	}
+	if _, err := parseCountMode("lines"); err == nil {
+		t.Error("parseCountMode of an unknown mode succeeded")
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{"500000", 500000, false},
+		{"10K", 10 << 10, false},
+		{"10kb", 10 << 10, false},
+		{"5M", 5 << 20, false},
+		{" 1G ", 1 << 30, false},
+		{"0", 0, false},
+		{"-1", 0, true},
+		{"ten", 0, true},
+		{"10T", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseByteSize(tt.value)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseByteSize(%q) = %d, %v, want %d (error %v)", tt.value, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestCountModes(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "héllo wide world", "b.txt": "日本語"})
+	tests := []struct {
+		mode string
+		want int
+	}{
+		{"words", 6},
+		{"chars", 19},
+		{"bytes", 26},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			repo, options := scanTree(t, dir, "-count-mode", tt.mode)
+			if repo.TokenCount != tt.want {
+				t.Errorf("counted %d %s, want %d", repo.TokenCount, tt.mode, tt.want)
+			}
+			if options.unitName() != tt.mode {
+				t.Errorf("unitName() = %q, want %q", options.unitName(), tt.mode)
+			}
+		})
+	}
+
+	options := testOptions(t)
+	if options.unitName() != "tokens" {
+		t.Errorf("unitName() = %q, want tokens", options.unitName())
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"path/filepath"
+	"strings"
+)
+
+// Transformer rewrites the text of a file before it's counted, for a view of
+// it such as its API without the implementation. It returns false when it
+// doesn't apply to the file, which is then counted as it is.
+type Transformer func(path string, text string) (string, bool, error)
+
+// views maps the names -view accepts to their transformers, by lowercase file
+// extension. The full view counts every file as it is.
+var views = map[string]map[string]Transformer{
+	"full":       {},
+	"signatures": {".go": goSignatures},
+	"exported":   {".go": goExported},
+}
+
+// RegisterView adds a transformer for files with the extension ext to the
+// view named name, creating the view if needed, so more languages and views
+// can be plugged in without touching the traversal or the reports
+func RegisterView(name string, ext string, transform Transformer) {
+	if views[name] == nil {
+		views[name] = make(map[string]Transformer)
+	}
+	views[name][strings.ToLower(ext)] = transform
+}
+
+// parseView validates the value of -view
+func parseView(value string) (string, error) {
+	if _, ok := views[value]; !ok {
+		return "", fmt.Errorf("unknown view %q (expected %s)", value, strings.Join(sortedKeys(views), ", "))
+	}
+	return value, nil
+}
+
+// applyView returns the text of the file at path as the view shows it, and
+// whether the view changed it
+func applyView(path string, text string, view string) (string, bool, error) {
+	transform := views[view][strings.ToLower(filepath.Ext(path))]
+	if transform == nil {
+		return text, false, nil
+	}
+	viewed, ok, err := transform(path, text)
+	if err != nil || !ok {
+		return text, false, err
+	}
+	return viewed, true, nil
+}
+
+// goSignatures is the signatures view of Go files: every declaration, with
+// its doc comment, but without function bodies
+func goSignatures(path string, text string) (string, bool, error) {
+	return goView(path, text, false)
+}
+
+// goExported is the exported view of Go files: the signatures of the
+// exported declarations only, as go doc shows a package
+func goExported(path string, text string) (string, bool, error) {
+	return goView(path, text, true)
+}
+
+// goView prints a Go file without function bodies and, with exportedOnly,
+// without unexported declarations. Comments inside what's removed go too.
+// Files that don't parse are counted as they are.
+func goView(path string, text string, exportedOnly bool) (string, bool, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, text, parser.ParseComments)
+	if err != nil {
+		logger.Debug("counting the whole file, it doesn't parse", "path", path, "err", err)
+		return "", false, nil
+	}
+
+	// removed are the ranges dropped from the file, to drop their comments
+	var removed [][2]token.Pos
+	remove := func(doc *ast.CommentGroup, node ast.Node) {
+		start := node.Pos()
+		if doc != nil {
+			start = doc.Pos()
+		}
+		removed = append(removed, [2]token.Pos{start, node.End()})
+	}
+
+	var decls []ast.Decl
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if exportedOnly && !exportedFunc(d) {
+				remove(d.Doc, d)
+				continue
+			}
+			if d.Body != nil {
+				remove(nil, d.Body)
+				d.Body = nil
+			}
+		case *ast.GenDecl:
+			if exportedOnly && d.Tok != token.IMPORT {
+				var specs []ast.Spec
+				for _, spec := range d.Specs {
+					if exportedSpec(spec) {
+						specs = append(specs, spec)
+					} else {
+						remove(specDoc(spec), spec)
+					}
+				}
+				if len(specs) == 0 {
+					remove(d.Doc, d)
+					continue
+				}
+				d.Specs = specs
+			}
+		}
+		decls = append(decls, decl)
+	}
+	file.Decls = decls
+
+	var comments []*ast.CommentGroup
+	for _, group := range file.Comments {
+		inside := false
+		for _, r := range removed {
+			if group.Pos() >= r[0] && group.End() <= r[1] {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			comments = append(comments, group)
+		}
+	}
+	file.Comments = comments
+
+	var buf bytes.Buffer
+	config := printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8} // As gofmt prints
+	if err := config.Fprint(&buf, fset, file); err != nil {
+		return "", false, err
+	}
+	return buf.String(), true, nil
+}
+
+// exportedFunc reports whether a function or method is part of the package's
+// API: an exported function, or an exported method of an exported type
+func exportedFunc(d *ast.FuncDecl) bool {
+	if !d.Name.IsExported() {
+		return false
+	}
+	if d.Recv == nil || len(d.Recv.List) == 0 {
+		return true
+	}
+	typ := d.Recv.List[0].Type
+	for {
+		switch t := typ.(type) {
+		case *ast.StarExpr:
+			typ = t.X
+		case *ast.IndexExpr:
+			typ = t.X
+		case *ast.IndexListExpr:
+			typ = t.X
+		case *ast.Ident:
+			return t.IsExported()
+		default:
+			return true
+		}
+	}
+}
+
+// exportedSpec reports whether a type, const or var spec declares anything
+// exported
+func exportedSpec(spec ast.Spec) bool {
+	switch s := spec.(type) {
+	case *ast.TypeSpec:
+		return s.Name.IsExported()
+	case *ast.ValueSpec:
+		for _, name := range s.Names {
+			if name.IsExported() {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// specDoc returns the doc comment of a spec
+func specDoc(spec ast.Spec) *ast.CommentGroup {
+	switch s := spec.(type) {
+	case *ast.TypeSpec:
+		return s.Doc
+	case *ast.ValueSpec:
+		return s.Doc
+	case *ast.ImportSpec:
+		return s.Doc
+	}
+	return nil
+}
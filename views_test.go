@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const viewSource = `// Package shapes draws shapes.
+package shapes
+
+import "fmt"
+
+// Shape is anything with an area.
+type Shape interface{ Area() float64 }
+
+// scale is unexported.
+var scale = 2
+
+// Square is a square.
+type Square struct{ side float64 }
+
+// Area returns the area of the square.
+func (s *Square) Area() float64 {
+	// The body's comment goes with the body
+	return s.side * s.side
+}
+
+// helper is unexported.
+func helper() { fmt.Println(scale) }
+
+type inner struct{}
+
+// Exported is a method of an unexported type.
+func (inner) Exported() {}
+`
+
+func TestApplyView(t *testing.T) {
+	tests := []struct {
+		view    string
+		path    string
+		text    string
+		changed bool
+		want    []string
+		notWant []string
+	}{
+		{"full", "a.go", viewSource, false, []string{"return s.side"}, nil},
+		{"signatures", "a.go", viewSource, true,
+			[]string{"// Area returns the area of the square.\nfunc (s *Square) Area() float64\n", "func helper()", "// scale is unexported."},
+			[]string{"return s.side", "The body's comment", "fmt.Println"}},
+		{"exported", "a.go", viewSource, true,
+			[]string{"type Shape interface", "type Square struct", "func (s *Square) Area() float64", `import "fmt"`},
+			[]string{"helper", "scale", "inner", "Exported", "return s.side"}},
+		{"signatures", "a.py", "def f():\n    return 1\n", false, []string{"return 1"}, nil},
+		{"signatures", "broken.go", "package x\nfunc {", false, []string{"func {"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.view+" "+tt.path, func(t *testing.T) {
+			got, changed, err := applyView(tt.path, tt.text, tt.view)
+			if err != nil || changed != tt.changed {
+				t.Fatalf("applyView = %v, %v, want changed %v", changed, err, tt.changed)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("view is missing %q:\n%s", want, got)
+				}
+			}
+			for _, notWant := range tt.notWant {
+				if strings.Contains(got, notWant) {
+					t.Errorf("view has %q:\n%s", notWant, got)
+				}
+			}
+		})
+	}
+}
+
+func TestRegisterView(t *testing.T) {
+	defer delete(views, "test-upper")
+	RegisterView("test-upper", ".TXT", func(path string, text string) (string, bool, error) {
+		if text == "fail" {
+			return "", false, errors.New("can't transform")
+		}
+		return strings.ToUpper(text), true, nil
+	})
+	if got, changed, err := applyView("a.txt", "hello", "test-upper"); got != "HELLO" || !changed || err != nil {
+		t.Errorf("applyView with a registered view = %q, %v, %v", got, changed, err)
+	}
+	if _, _, err := applyView("a.txt", "fail", "test-upper"); err == nil {
+		t.Error("applyView didn't return the transformer's error")
+	}
+	if _, err := parseView("test-upper"); err != nil {
+		t.Errorf("parseView of a registered view = %v", err)
+	}
+	if _, err := parseView("outline"); err == nil || !strings.Contains(err.Error(), `unknown view "outline" (expected exported, full, signatures`) {
+		t.Errorf("parseView(outline) = %v", err)
+	}
+}
+
+func TestViewScan(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"shapes.go": viewSource})
+	full, _ := scanTree(t, dir, "-model", "cl100k_base")
+	signatures, _ := scanTree(t, dir, "-model", "cl100k_base", "-view", "signatures")
+	exported, _ := scanTree(t, dir, "-model", "cl100k_base", "-view", "exported")
+	if !(full.TokenCount > signatures.TokenCount && signatures.TokenCount > exported.TokenCount && exported.TokenCount > 0) {
+		t.Errorf("full %d, signatures %d, exported %d tokens, want each view smaller", full.TokenCount, signatures.TokenCount, exported.TokenCount)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// defaultWalkWorkers is the number of directories listed at once by default.
+// Listing is mostly waiting on the filesystem, so it's more than the CPUs of
+// a small machine.
+const defaultWalkWorkers = 8
+
+// dirListing is the result of listing a directory: its entries, sorted by
+// name, or the error that stopped the listing
+type dirListing struct {
+	entries []os.FileInfo
+	err     error
+}
+
+// parallelWalker walks a tree like filepath.Walk, calling walkFn for every
+// file and directory in lexical order from a single goroutine, so the walk
+// function needs no locking and sees the same order and SkipDir behavior.
+// What's parallel is the listing: when a directory is visited, all of its
+// subdirectories are listed (and their entries stat'ed) by up to workers
+// goroutines, so they're usually ready by the time the walk reaches them.
+// Listing only runs one level ahead of the walk, so skipping a directory
+// saves listing anything below it.
+type parallelWalker struct {
+	slots   chan int // The free workers, by number
+	profile *scanProfile
+}
+
+// newParallelWalker returns a walker listing up to workers directories at
+// once, recording how long each of them takes in profile
+func newParallelWalker(workers int, profile *scanProfile) *parallelWalker {
+	w := &parallelWalker{slots: make(chan int, max(workers, 1)), profile: profile}
+	for i := 0; i < cap(w.slots); i++ {
+		w.slots <- i
+	}
+	return w
+}
+
+// walkTree walks root with walkFn, in parallel when workers is above 1 and
+// with filepath.Walk otherwise. With a profile, the parallel walk records
+// the listing of each directory by the worker that listed it.
+func walkTree(root string, workers int, walkFn filepath.WalkFunc, profile *scanProfile) error {
+	if workers <= 1 {
+		return filepath.Walk(root, walkFn)
+	}
+	return newParallelWalker(workers, profile).walk(root, walkFn)
+}
+
+// walk walks root, with the same semantics as filepath.Walk
+func (w *parallelWalker) walk(root string, walkFn filepath.WalkFunc) error {
+	info, err := os.Lstat(root)
+	if err != nil {
+		err = walkFn(root, nil, err)
+	} else {
+		err = w.walkDir(root, info, w.list(root), walkFn)
+	}
+	if err == filepath.SkipDir || err == filepath.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walkDir visits path and, when it's a directory, its entries from the
+// listing being made
+func (w *parallelWalker) walkDir(path string, info os.FileInfo, listing <-chan dirListing, walkFn filepath.WalkFunc) error {
+	if !info.IsDir() {
+		return walkFn(path, info, nil)
+	}
+
+	result := <-listing
+	if err := walkFn(path, info, result.err); err != nil || result.err != nil {
+		return err
+	}
+
+	// Start listing the subdirectories before visiting any entry
+	listings := make(map[string]<-chan dirListing)
+	for _, entry := range result.entries {
+		if entry.IsDir() {
+			listings[entry.Name()] = w.list(filepath.Join(path, entry.Name()))
+		}
+	}
+
+	for _, entry := range result.entries {
+		err := w.walkDir(filepath.Join(path, entry.Name()), entry, listings[entry.Name()], walkFn)
+		if err != nil && (!entry.IsDir() || err != filepath.SkipDir) {
+			return err
+		}
+	}
+	return nil
+}
+
+// list lists dir in the background once a worker is free
+func (w *parallelWalker) list(dir string) <-chan dirListing {
+	listing := make(chan dirListing, 1)
+	go func() {
+		worker := <-w.slots
+		defer func() { w.slots <- worker }()
+		start := time.Now()
+		result := readDirInfos(dir)
+		w.profile.listed(worker, time.Since(start))
+		listing <- result
+	}()
+	return listing
+}
+
+// readDirInfos lists dir and stats its entries without following symlinks,
+// like filepath.Walk does
+func readDirInfos(dir string) dirListing {
+	file, err := os.Open(dir)
+	if err != nil {
+		return dirListing{err: err}
+	}
+	defer file.Close()
+	entries, err := file.Readdir(-1)
+	if err != nil {
+		return dirListing{err: err}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return dirListing{entries: entries}
+}
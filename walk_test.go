@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// walkOrder returns the paths walk visits under root, relative to it, with
+// the directories named in skip skipped and the walk stopped at stop
+func walkOrder(t *testing.T, root string, walk func(filepath.WalkFunc) error, skip string, stop string) ([]string, error) {
+	t.Helper()
+	var visited []string
+	err := walk(func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := relativeTo(root, path)
+		visited = append(visited, rel)
+		switch rel {
+		case skip:
+			return filepath.SkipDir
+		case stop:
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return visited, err
+}
+
+func TestParallelWalker(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"a.txt": "", "b/c.txt": "", "b/d/e.txt": "", "b/d/f.txt": "", "g/h.txt": "", "g/i/j.txt": "", "k.txt": "",
+	})
+
+	tests := []struct {
+		name       string
+		skip, stop string
+	}{
+		{"everything", "", ""},
+		{"skip a directory", "b/d", ""},
+		{"skip the parent of a file", "b/c.txt", ""},
+		{"stop", "", "g/h.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, wantErr := walkOrder(t, root, func(fn filepath.WalkFunc) error { return filepath.Walk(root, fn) }, tt.skip, tt.stop)
+			for _, workers := range []int{1, 2, 8} {
+				got, err := walkOrder(t, root, func(fn filepath.WalkFunc) error { return walkTree(root, workers, fn, nil) }, tt.skip, tt.stop)
+				if !reflect.DeepEqual(got, want) || err != wantErr {
+					t.Errorf("%d workers visited %v, %v, want %v, %v", workers, got, err, want, wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestParallelWalkerErrors(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing")
+	var got error
+	err := walkTree(missing, 4, func(path string, info os.FileInfo, err error) error {
+		got = err
+		return err
+	}, nil)
+	if !os.IsNotExist(got) || !os.IsNotExist(err) {
+		t.Errorf("walk of a missing root gave walkFn %v and returned %v", got, err)
+	}
+
+	stop := errors.New("stop")
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{"a/b.txt": "", "c.txt": ""})
+	visited := 0
+	err = walkTree(root, 4, func(path string, info os.FileInfo, err error) error {
+		visited++
+		if filepath.Base(path) == "b.txt" {
+			return stop
+		}
+		return nil
+	}, nil)
+	if err != stop || visited != 3 {
+		t.Errorf("walk stopped by walkFn returned %v after %d paths, want stop after 3", err, visited)
+	}
+}
+
+func TestWalkWorkersScan(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "one", "b/c.txt": "two three", "b/d/e.txt": "four", ".hidden/f.txt": "five"})
+	want, _ := scanTree(t, dir, "-model", "cl100k_base", "-walk-workers", "1")
+	for _, workers := range []string{"2", "16"} {
+		got, _ := scanTree(t, dir, "-model", "cl100k_base", "-walk-workers", workers)
+		if got.TokenCount != want.TokenCount || !reflect.DeepEqual(countedPaths(dir, got), countedPaths(dir, want)) {
+			t.Errorf("-walk-workers %s counted %v (%d tokens), want %v (%d tokens)", workers, countedPaths(dir, got), got.TokenCount, countedPaths(dir, want), want.TokenCount)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// watchSettle is how long the watcher waits for changes to stop before it
+// applies them, so a burst of them, like a git checkout, is one update
+const watchSettle = 250 * time.Millisecond
+
+// watchPoll is how often the tree is polled for changes on platforms without
+// inotify
+const watchPoll = 2 * time.Second
+
+// syncCookiePrefix starts the names of the files Sync creates in the root
+// for the watcher to see
+const syncCookiePrefix = ".token-counter-cookie-"
+
+// fileStamp is what the watcher and the caches compare to notice that a file
+// changed
+type fileStamp struct {
+	modTime int64
+	size    int64
+}
+
+// stampOf returns the stamp of a file from its info
+func stampOf(info os.FileInfo) fileStamp {
+	return fileStamp{info.ModTime().UnixNano(), info.Size()}
+}
+
+// statStamp returns the stamp of the file at path, or the zero stamp if it
+// can't be read
+func statStamp(path string) fileStamp {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}
+	}
+	return stampOf(info)
+}
+
+// Watch keeps the index current until ctx is done, watching the root for
+// changes and applying them in batches once they settle. Each batch is passed
+// to updated with the error of applying it. A change to an ignore file
+// restarts the watcher, since it can change which directories are watched.
+// Once the watcher is ready, the changes made while it was starting are
+// caught up with, and from then on Sync can wait for the index to be current.
+func (ix *Index) Watch(ctx context.Context, updated func(paths []string, err error)) error {
+	defer ix.setWatching(false)
+	for {
+		watchCtx, stop := context.WithCancel(ctx)
+		events := make(chan string, 1024)
+		errc := make(chan error, 1)
+		readyc := make(chan struct{})
+		go func() {
+			errc <- watchTree(watchCtx, ix.root, ix.watches, events, func() { close(readyc) })
+		}()
+
+		restart := false
+		pending := make(map[string]bool)
+		apply := func() {
+			if len(pending) == 0 {
+				return
+			}
+			paths := sortedKeys(pending)
+			pending = make(map[string]bool)
+			updated(paths, ix.Update(paths))
+			for _, path := range paths {
+				if base := filepath.Base(path); base == ".gitignore" || base == tokenIgnoreFile || base == gitAttributesFile {
+					restart = true
+				}
+			}
+		}
+		settle := time.NewTimer(watchSettle)
+		settle.Stop()
+		for !restart {
+			select {
+			case <-ctx.Done():
+				stop()
+				return nil
+			case err := <-errc:
+				stop()
+				return err
+			case <-readyc:
+				readyc = nil
+				if paths := ix.changedFiles(); len(paths) > 0 {
+					updated(paths, ix.Update(paths))
+				}
+				ix.setWatching(true)
+			case path := <-events:
+				// Every change made before a sync's cookie was created has
+				// arrived before it, so apply them now
+				if strings.HasPrefix(filepath.Base(path), syncCookiePrefix) {
+					if done := ix.takeCookie(path); done != nil {
+						settle.Stop()
+						apply()
+						close(done)
+					}
+					continue
+				}
+				pending[path] = true
+				settle.Reset(watchSettle)
+			case <-settle.C:
+				apply()
+			}
+		}
+		// Changes made until the new watcher is ready are caught up with then
+		ix.setWatching(false)
+		stop()
+		<-errc
+	}
+}
+
+// setWatching records whether the watcher sees every change, so Sync can
+// rely on it
+func (ix *Index) setWatching(watching bool) {
+	ix.watchMu.Lock()
+	ix.watching = watching
+	ix.watchMu.Unlock()
+}
+
+// takeCookie returns the channel of the sync waiting for the cookie at path,
+// removing it so it's closed once, or nil if none is
+func (ix *Index) takeCookie(path string) chan struct{} {
+	ix.watchMu.Lock()
+	defer ix.watchMu.Unlock()
+	done := ix.cookies[path]
+	delete(ix.cookies, path)
+	return done
+}
+
+// Sync waits until the index holds every change made to the tree before it
+// was called, for answers that must be current. It creates a cookie file in
+// the root and waits for the watcher to see it: the watcher receives events
+// in order, so by then it has received the earlier ones too, and it applies
+// them before it lets Sync return. It fails if the watcher isn't running or
+// hasn't caught up since it started, or if the root isn't writable.
+func (ix *Index) Sync(ctx context.Context) error {
+	ix.watchMu.Lock()
+	if !ix.watching {
+		ix.watchMu.Unlock()
+		return errors.New("the index isn't watching for changes")
+	}
+	if ix.cookies == nil {
+		ix.cookies = make(map[string]chan struct{})
+	}
+	ix.syncs++
+	cookie := filepath.Join(ix.root, fmt.Sprintf("%s%d-%d", syncCookiePrefix, os.Getpid(), ix.syncs))
+	done := make(chan struct{})
+	ix.cookies[cookie] = done
+	ix.watchMu.Unlock()
+
+	defer func() {
+		ix.takeCookie(cookie)
+		os.Remove(cookie)
+	}()
+	if err := os.WriteFile(cookie, nil, 0o600); err != nil {
+		return err
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// changedFiles returns the files that changed since they were counted, and
+// those created or deleted since, by their stamps, for the changes made while
+// the watcher was starting
+func (ix *Index) changedFiles() []string {
+	ix.mu.RLock()
+	ignorer := ix.ignorer
+	stamps := make(map[string]fileStamp, len(ix.files))
+	for path, fileInfo := range ix.files {
+		// Archive entries have no stamp of their own
+		if fileInfo.stamp != (fileStamp{}) {
+			stamps[path] = fileInfo.stamp
+		}
+	}
+	ix.mu.RUnlock()
+
+	var changed []string
+	filepath.WalkDir(ix.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			if !ix.watches(path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), syncCookiePrefix) {
+			return nil
+		}
+		stamp, indexed := stamps[path]
+		delete(stamps, path)
+		switch {
+		case indexed && stamp != statStamp(path):
+			changed = append(changed, path)
+		case !indexed && ix.counted(path, ignorer):
+			changed = append(changed, path)
+		}
+		return nil
+	})
+	// What's left wasn't found, so it was deleted
+	return append(changed, sortedKeys(stamps)...)
+}
+
+// watches reports whether the watcher should watch a directory, leaving out
+// those a scan never enters
+func (ix *Index) watches(dir string) bool {
+	rel, err := filepath.Rel(ix.root, dir)
+	if err != nil {
+		return false
+	}
+	if rel == "." {
+		return true
+	}
+	base := filepath.Base(dir)
+	if base == ".git" || ix.options.prunes(rel) || ix.options.IgnoreHidden && strings.HasPrefix(base, ".") {
+		return false
+	}
+	if ix.options.MaxDepth > 0 && depth(rel) >= ix.options.MaxDepth {
+		return false
+	}
+	ix.mu.RLock()
+	ignorer := ix.ignorer
+	ix.mu.RUnlock()
+	return ignorer == nil || !ignorer.MatchesPath(filepath.ToSlash(rel))
+}
@@ -0,0 +1,114 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchMask selects the inotify events that can change a count
+const watchMask = unix.IN_CLOSE_WRITE | unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO | unix.IN_DELETE_SELF
+
+// watchTree sends the paths created, written, deleted or moved under root to
+// events until ctx is done, watching every directory watch accepts with
+// inotify. Directories created later are watched as they appear; if the
+// kernel drops events, the root itself is sent, to recount everything. ready
+// is called once the directories there are now are watched.
+func watchTree(ctx context.Context, root string, watch func(dir string) bool, events chan<- string, ready func()) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("inotify: %v", err)
+	}
+	// A non-blocking descriptor goes through the runtime's poller, so closing
+	// the file ends a pending read
+	file := os.NewFile(uintptr(fd), "inotify")
+	go func() {
+		<-ctx.Done()
+		file.Close()
+	}()
+
+	dirs := make(map[int]string) // By watch descriptor
+	add := func(dir string) error {
+		return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || !entry.IsDir() {
+				return nil
+			}
+			if !watch(path) {
+				return filepath.SkipDir
+			}
+			wd, err := unix.InotifyAddWatch(fd, path, watchMask)
+			if errors.Is(err, unix.ENOSPC) {
+				return fmt.Errorf("too many directories to watch; raise fs.inotify.max_user_watches")
+			}
+			if err == nil {
+				dirs[wd] = path
+			}
+			return nil
+		})
+	}
+	if err := add(root); err != nil {
+		file.Close()
+		return err
+	}
+	ready()
+
+	send := func(path string) bool {
+		select {
+		case events <- path:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := file.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("inotify: %v", err)
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			name := strings.TrimRight(string(buf[offset+unix.SizeofInotifyEvent:offset+unix.SizeofInotifyEvent+int(event.Len)]), "\x00")
+			offset += unix.SizeofInotifyEvent + int(event.Len)
+
+			if event.Mask&unix.IN_Q_OVERFLOW != 0 {
+				if !send(root) {
+					return nil
+				}
+				continue
+			}
+			dir, ok := dirs[int(event.Wd)]
+			if !ok {
+				continue
+			}
+			if event.Mask&unix.IN_IGNORED != 0 {
+				delete(dirs, int(event.Wd))
+				continue
+			}
+			path := dir
+			if name != "" {
+				path = filepath.Join(dir, name)
+			}
+			if event.Mask&unix.IN_ISDIR != 0 && event.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+				if err := add(path); err != nil {
+					return err
+				}
+			}
+			if !send(path) {
+				return nil
+			}
+		}
+	}
+}
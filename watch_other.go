@@ -0,0 +1,67 @@
+//go:build !linux
+
+package main
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+// watchTree sends the paths created, written or deleted under root to events
+// until ctx is done, polling every directory watch accepts every watchPoll.
+// ready is called once the first poll is done: later changes are all seen.
+func watchTree(ctx context.Context, root string, watch func(dir string) bool, events chan<- string, ready func()) error {
+	poll := func() map[string]fileStamp {
+		stamps := make(map[string]fileStamp)
+		filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if entry.IsDir() {
+				if !watch(path) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info, err := entry.Info(); err == nil {
+				stamps[path] = stampOf(info)
+			}
+			return nil
+		})
+		return stamps
+	}
+
+	last := poll()
+	ready()
+	ticker := time.NewTicker(watchPoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		current := poll()
+		var changed []string
+		for path, stamp := range current {
+			if previous, ok := last[path]; !ok || previous != stamp {
+				changed = append(changed, path)
+			}
+		}
+		for path := range last {
+			if _, ok := current[path]; !ok {
+				changed = append(changed, path)
+			}
+		}
+		last = current
+		for _, path := range changed {
+			select {
+			case events <- path:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{"a.txt": "hello world"})
+	ix, err := NewIndex(dir, testOptions(t, "-model", "cl100k_base"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Sync(context.Background()); err == nil || !strings.Contains(err.Error(), "isn't watching") {
+		t.Errorf("Sync before Watch = %v, want an error", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	watched := make(chan error, 1)
+	go func() { watched <- ix.Watch(ctx, func([]string, error) {}) }()
+	defer func() {
+		cancel()
+		if err := <-watched; err != nil {
+			t.Errorf("Watch = %v", err)
+		}
+	}()
+	sync := func() {
+		t.Helper()
+		for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+			syncCtx, cancel := context.WithTimeout(context.Background(), indexSyncTimeout)
+			err := ix.Sync(syncCtx)
+			cancel()
+			if err == nil {
+				return
+			}
+			if time.Since(start) > 10*time.Second {
+				t.Fatalf("Sync = %v", err)
+			}
+		}
+	}
+	sync()
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  int
+	}{
+		{"modified file", map[string]string{"a.txt": "hello"}, 1},
+		{"created file", map[string]string{"src/b.go": "one two three"}, 4},
+		{"ignored file", map[string]string{".gitignore": "src/\n"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			writeTree(t, dir, tt.files)
+			sync()
+			if got := ix.TokenCount(); got != tt.want {
+				t.Errorf("TokenCount = %d, want %d: %v", got, tt.want, indexedPaths(dir, ix))
+			}
+		})
+	}
+	for _, path := range indexedPaths(dir, ix) {
+		if strings.HasPrefix(filepath.Base(path), syncCookiePrefix) {
+			t.Errorf("the sync cookie %s is counted", path)
+		}
+	}
+}
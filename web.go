@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// maxPageBytes is the largest web page fetched, to keep a runaway download
+// from filling the disk
+const maxPageBytes = 64 << 20
+
+// unsafeNameChars matches the characters replaced in the name of a fetched
+// page's file
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Class and id patterns of the elements readability extraction drops as
+// boilerplate, unless they also look like content
+var (
+	unlikelyContent = regexp.MustCompile(`(?i)ad-|ads|banner|breadcrumb|combx|comment|community|cookie|disqus|extra|footer|footnote|header|legends|menu|modal|nav|pager|popup|promo|related|remark|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|subscribe|tags|tool|widget`)
+	likelyContent   = regexp.MustCompile(`(?i)and|article|body|column|content|entry|main|shadow|story|text|blog|post`)
+)
+
+// boilerplateTags are the elements readability extraction always drops
+var boilerplateTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Iframe: true, atom.Svg: true, atom.Canvas: true,
+	atom.Form: true, atom.Button: true, atom.Input: true, atom.Select: true, atom.Textarea: true, atom.Template: true,
+	atom.Nav: true, atom.Header: true, atom.Footer: true, atom.Aside: true, atom.Dialog: true, atom.Object: true, atom.Embed: true,
+}
+
+// blockTags are the elements whose text starts on a line of its own
+var blockTags = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Main: true, atom.Blockquote: true,
+	atom.Pre: true, atom.Ul: true, atom.Ol: true, atom.Li: true, atom.Dl: true, atom.Dt: true, atom.Dd: true,
+	atom.Table: true, atom.Tr: true, atom.Figure: true, atom.Figcaption: true, atom.Hr: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+}
+
+// isWebURL reports whether path is an http or https URL, other than a GitHub
+// repository's, to fetch and count as a single page
+func isWebURL(path string) bool {
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") || isGitHubURL(path) {
+		return false
+	}
+	u, err := url.Parse(path)
+	return err == nil && u.Host != ""
+}
+
+// fetchWebPage downloads a web page into a temporary file named after its
+// URL and returns the file's path. With readability set, an HTML page is
+// reduced to the text of its main content first; otherwise the page is
+// saved as served. The file is removed when the program exits.
+func fetchWebPage(pageURL string, readability bool) (string, error) {
+	req, err := http.NewRequest("GET", pageURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", "token-counter/"+toolVersion())
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response from %s: %s", pageURL, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("error reading %s: %v", pageURL, err)
+	}
+	if len(body) > maxPageBytes {
+		return "", fmt.Errorf("%s is larger than %d MB", pageURL, maxPageBytes>>20)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "" {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(body))
+	}
+	ext := ".txt"
+	isHTML := mediaType == "text/html" || mediaType == "application/xhtml+xml"
+	if isHTML {
+		ext = ".html"
+	}
+	if readability {
+		if isHTML {
+			text, err := extractReadable(body, contentType)
+			if err != nil {
+				return "", fmt.Errorf("error extracting the text of %s: %v", pageURL, err)
+			}
+			body, ext = []byte(text), ".txt"
+		} else {
+			fmt.Fprintf(os.Stderr, "Warning: %s is %s, not HTML; counting it as served without -readability\n", pageURL, mediaType)
+		}
+	}
+
+	tmpDir, err := os.MkdirTemp("", "token-counter-")
+	if err != nil {
+		return "", err
+	}
+	atExit(func() { os.RemoveAll(tmpDir) })
+	u, _ := url.Parse(pageURL)
+	name := strings.Trim(unsafeNameChars.ReplaceAllString(u.Host+u.Path, "_"), "_.")
+	if len(name) > 100 {
+		name = name[:100]
+	}
+	for _, pageExt := range []string{".html", ".htm", ".txt"} {
+		name = strings.TrimSuffix(name, pageExt)
+	}
+	path := filepath.Join(tmpDir, name+ext)
+	if err := os.WriteFile(path, body, 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// extractReadable returns the title and the main text of an HTML page,
+// without its navigation, ads and markup, in the spirit of Mozilla's
+// Readability. Paragraphs score their parents by their length and commas,
+// the element with the most content not made of links wins, and its text is
+// laid out with a blank line between blocks.
+func extractReadable(page []byte, contentType string) (string, error) {
+	r, err := charset.NewReader(bytes.NewReader(page), contentType)
+	if err != nil {
+		return "", err
+	}
+	doc, err := html.Parse(r)
+	if err != nil {
+		return "", err
+	}
+
+	var title string
+	for n := range doc.Descendants() {
+		if n.DataAtom == atom.Title && n.Parent != nil && n.Parent.DataAtom == atom.Head {
+			title = strings.Join(strings.Fields(nodeText(n)), " ")
+			break
+		}
+	}
+	dropBoilerplate(doc)
+
+	scores := make(map[*html.Node]float64)
+	for n := range doc.Descendants() {
+		if n.Type != html.ElementNode || (n.DataAtom != atom.P && n.DataAtom != atom.Pre && n.DataAtom != atom.Td && n.DataAtom != atom.Blockquote) {
+			continue
+		}
+		text := strings.Join(strings.Fields(nodeText(n)), " ")
+		if len(text) < 25 || n.Parent == nil {
+			continue
+		}
+		score := 1 + float64(strings.Count(text, ",")) + math.Min(float64(len(text))/100, 3)
+		scores[n.Parent] += score
+		if n.Parent.Parent != nil {
+			scores[n.Parent.Parent] += score / 2
+		}
+	}
+
+	// Candidates are taken in document order, so ties go to the first
+	var best *html.Node
+	bestScore := 0.0
+	for n := range doc.Descendants() {
+		score, ok := scores[n]
+		if !ok {
+			continue
+		}
+		score = (score + classWeight(n)) * (1 - linkDensity(n))
+		if best == nil || score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+	if best == nil {
+		for n := range doc.Descendants() {
+			if n.DataAtom == atom.Body {
+				best = n
+				break
+			}
+		}
+	}
+
+	var b strings.Builder
+	if title != "" {
+		b.WriteString(title + "\n\n")
+	}
+	if best != nil {
+		writeText(&b, best)
+	}
+	return strings.TrimSpace(collapseBlankLines(b.String())) + "\n", nil
+}
+
+// dropBoilerplate removes the elements that are never content, and those
+// whose class or id names look like boilerplate but not like content
+func dropBoilerplate(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.CommentNode || c.Type == html.ElementNode && boilerplateTags[c.DataAtom] {
+			n.RemoveChild(c)
+		} else if names := attr(c, "class") + " " + attr(c, "id"); c.Type == html.ElementNode && c.DataAtom != atom.Body &&
+			unlikelyContent.MatchString(names) && !likelyContent.MatchString(names) {
+			n.RemoveChild(c)
+		} else {
+			dropBoilerplate(c)
+		}
+		c = next
+	}
+}
+
+// classWeight scores an element's class and id names, up for content and
+// down for boilerplate
+func classWeight(n *html.Node) float64 {
+	weight := 0.0
+	for _, name := range []string{attr(n, "class"), attr(n, "id")} {
+		if name == "" {
+			continue
+		}
+		if likelyContent.MatchString(name) {
+			weight += 25
+		}
+		if unlikelyContent.MatchString(name) {
+			weight -= 25
+		}
+	}
+	if n.DataAtom == atom.Article || n.DataAtom == atom.Main {
+		weight += 25
+	}
+	return weight
+}
+
+// linkDensity is the share of an element's text inside links
+func linkDensity(n *html.Node) float64 {
+	total := len(nodeText(n))
+	if total == 0 {
+		return 0
+	}
+	links := 0
+	for c := range n.Descendants() {
+		if c.DataAtom == atom.A {
+			links += len(nodeText(c))
+		}
+	}
+	return float64(links) / float64(total)
+}
+
+// attr returns the value of an element's attribute, or "" if it has none
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// nodeText concatenates the text nodes under n
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	for c := range n.Descendants() {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+	}
+	return b.String()
+}
+
+// writeText writes the text under n, collapsing whitespace except in pre
+// elements, with block elements on lines of their own, list items marked
+// with a dash and headings with #s
+func writeText(b *strings.Builder, n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		switch {
+		case c.Type == html.TextNode:
+			if c.Data == "" {
+				continue
+			}
+			if c.Data[0] <= ' ' {
+				writeSpace(b)
+			}
+			if text := strings.Join(strings.Fields(c.Data), " "); text != "" {
+				b.WriteString(text)
+				if c.Data[len(c.Data)-1] <= ' ' {
+					writeSpace(b)
+				}
+			}
+		case c.Type != html.ElementNode:
+		case c.DataAtom == atom.Br:
+			b.WriteString("\n")
+		case c.DataAtom == atom.Pre:
+			b.WriteString("\n\n" + nodeText(c) + "\n\n")
+		case blockTags[c.DataAtom]:
+			b.WriteString("\n\n")
+			if level := headingLevel(c.DataAtom); level > 0 {
+				b.WriteString(strings.Repeat("#", level) + " ")
+			} else if c.DataAtom == atom.Li {
+				b.WriteString("- ")
+			}
+			writeText(b, c)
+			b.WriteString("\n\n")
+		default:
+			writeText(b, c)
+		}
+	}
+}
+
+// writeSpace separates the next text from the text before it by a space,
+// unless it starts a line
+func writeSpace(b *strings.Builder) {
+	if s := b.String(); s != "" && !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\n") {
+		b.WriteString(" ")
+	}
+}
+
+// headingLevel returns the level of a heading element, or 0 for others
+func headingLevel(a atom.Atom) int {
+	for level, heading := range []atom.Atom{atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6} {
+		if a == heading {
+			return level + 1
+		}
+	}
+	return 0
+}
+
+// collapseBlankLines trims the spaces at the end of every line and leaves at
+// most one blank line between paragraphs
+func collapseBlankLines(text string) string {
+	var lines []string
+	blank := false
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			blank = len(lines) > 0
+			continue
+		}
+		if blank {
+			lines = append(lines, "")
+			blank = false
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
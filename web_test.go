@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testArticle is a page with navigation, a sidebar and a footer around its
+// article
+const testArticle = `<!DOCTYPE html>
+<html><head><title>  The  Article </title><script>var tracking = 1;</script></head>
+<body>
+<nav><a href="/">Home</a> <a href="/about">About</a></nav>
+<div class="sidebar"><p>Subscribe to our newsletter, for updates, offers and more, every week.</p></div>
+<article class="post">
+<h1>How it works</h1>
+<p>The first paragraph explains the idea, with enough words and commas, to score.</p>
+<p>The second <b>paragraph</b> goes on, at some length, about the details of it.</p>
+<ul><li>One point</li><li>Another point</li></ul>
+</article>
+<footer>Copyright, all rights reserved, everywhere, forever and ever.</footer>
+</body></html>`
+
+func TestExtractReadable(t *testing.T) {
+	text, err := extractReadable([]byte(testArticle), "text/html; charset=utf-8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "The Article\n\n# How it works\n\nThe first paragraph explains the idea, with enough words and commas, to score.\n\nThe second paragraph goes on, at some length, about the details of it.\n\n- One point\n\n- Another point\n"
+	if text != want {
+		t.Errorf("extractReadable =\n%q\nwant\n%q", text, want)
+	}
+
+	// Without paragraphs to score, the body is the content
+	if text, _ := extractReadable([]byte("<html><body>Just <i>a</i> line</body></html>"), ""); text != "Just a line\n" {
+		t.Errorf("page without paragraphs: %q", text)
+	}
+}
+
+func TestIsWebURL(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"https://example.com/post", true},
+		{"http://localhost:8080/", true},
+		{"https://github.com/owner/repo", false},
+		{"ftp://example.com/file", false},
+		{"https://", false},
+		{"docs/page.html", false},
+	}
+	for _, tt := range tests {
+		if got := isWebURL(tt.path); got != tt.want {
+			t.Errorf("isWebURL(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestFetchWebPage(t *testing.T) {
+	t.Cleanup(runExitHooks)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/blog/post.html":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(testArticle))
+		case "/notes":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("plain notes"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+	host = unsafeNameChars.ReplaceAllString(host, "_")
+
+	tests := []struct {
+		name        string
+		path        string
+		readability bool
+		file        string
+		contains    string
+	}{
+		{"page as served", "/blog/post.html", false, host + "_blog_post.html", "<nav>"},
+		{"readable page", "/blog/post.html", true, host + "_blog_post.txt", "# How it works"},
+		{"plain text", "/notes", true, host + "_notes.txt", "plain notes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var path string
+			var err error
+			stderr := captureStderr(t, func() { path, err = fetchWebPage(srv.URL+tt.path, tt.readability) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, _ := os.ReadFile(path)
+			if filepath.Base(path) != tt.file || !strings.Contains(string(data), tt.contains) {
+				t.Errorf("fetched %s:\n%s", path, data)
+			}
+			if tt.name == "plain text" && !strings.Contains(stderr, "is text/plain, not HTML") {
+				t.Errorf("no warning for -readability of a text page: %q", stderr)
+			}
+		})
+	}
+
+	if _, err := fetchWebPage(srv.URL+"/missing", false); err == nil || !strings.Contains(err.Error(), "404 Not Found") {
+		t.Errorf("fetching a missing page: %v", err)
+	}
+}